@@ -0,0 +1,281 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Authentication protocols, see RFC 3118, Section 2.
+const (
+	// AuthConfigurationToken carries a shared, unencrypted token, see
+	// RFC 3118, Section 4. It only protects against misconfigured
+	// servers, not against attackers.
+	AuthConfigurationToken uint8 = 0
+
+	// AuthDelayed authenticates messages with an HMAC keyed by a secret
+	// shared by client and server, see RFC 3118, Section 5.
+	AuthDelayed uint8 = 1
+)
+
+// AuthHMACMD5 is the HMAC-MD5 algorithm of delayed authentication.
+const AuthHMACMD5 uint8 = 1
+
+// AuthRDMCounter is the replay detection method of a monotonically
+// increasing counter, see RFC 3118, Section 2.
+const AuthRDMCounter uint8 = 0
+
+const (
+	// authFixedLen is the length of the protocol, algorithm, RDM and
+	// replay detection fields.
+	authFixedLen = 11
+
+	// delayedInfoLen is the length of the authentication information
+	// of delayed authentication: a secret ID and an HMAC-MD5.
+	delayedInfoLen = 4 + md5.Size
+)
+
+var (
+	// ErrNotAuthenticated is returned by VerifyPacket for packets
+	// without an authentication option.
+	ErrNotAuthenticated = errors.New("packet has no authentication option")
+
+	// ErrBadAuthentication is returned by VerifyPacket for packets whose
+	// HMAC does not match.
+	ErrBadAuthentication = errors.New("packet authentication failed")
+)
+
+// Authentication is the value of OptionAuthentication as defined by RFC
+// 3118, Section 2.
+type Authentication struct {
+	// Protocol is AuthConfigurationToken or AuthDelayed.
+	Protocol uint8
+
+	// Algorithm is the algorithm of Protocol, AuthHMACMD5 for delayed
+	// authentication.
+	Algorithm uint8
+
+	// RDM is the replay detection method, usually AuthRDMCounter.
+	RDM uint8
+
+	// ReplayDetection is the replay detection value, e.g. the counter.
+	ReplayDetection uint64
+
+	// Info is the authentication information: the token, or the secret
+	// ID and HMAC-MD5 of delayed authentication. A client asks for
+	// delayed authentication with a DHCPDISCOVER without information.
+	Info []byte
+}
+
+// NewDelayedAuthentication returns delayed authentication with HMAC-MD5 by
+// the secret with the ID, to be signed by SignPacket once the packet is
+// marshaled.
+func NewDelayedAuthentication(id uint32, replay uint64) *Authentication {
+	info := make([]byte, delayedInfoLen)
+	binary.BigEndian.PutUint32(info, id)
+	return &Authentication{
+		Protocol:        AuthDelayed,
+		Algorithm:       AuthHMACMD5,
+		RDM:             AuthRDMCounter,
+		ReplayDetection: replay,
+		Info:            info,
+	}
+}
+
+// SecretID returns the ID of the secret of delayed authentication with
+// HMAC-MD5, or false if a is not that or carries no information.
+func (a *Authentication) SecretID() (uint32, bool) {
+	if a.Protocol != AuthDelayed || a.Algorithm != AuthHMACMD5 || len(a.Info) != delayedInfoLen {
+		return 0, false
+	}
+	return binary.BigEndian.Uint32(a.Info), true
+}
+
+// String implements fmt.Stringer.
+func (a *Authentication) String() string {
+	switch {
+	case a.Protocol == AuthConfigurationToken:
+		return fmt.Sprintf("token %q (replay %d)", a.Info, a.ReplayDetection)
+	case a.Protocol == AuthDelayed && a.Algorithm == AuthHMACMD5:
+		if id, ok := a.SecretID(); ok {
+			return fmt.Sprintf("delayed HMAC-MD5 secret %d (replay %d)", id, a.ReplayDetection)
+		}
+		return fmt.Sprintf("delayed HMAC-MD5 requested (replay %d)", a.ReplayDetection)
+	}
+	return fmt.Sprintf("protocol %d algorithm %d (replay %d) %x", a.Protocol, a.Algorithm, a.ReplayDetection, a.Info)
+}
+
+// ParseAuthentication decodes the authentication in b, the value of
+// OptionAuthentication.
+func ParseAuthentication(b []byte) (*Authentication, error) {
+	if len(b) < authFixedLen {
+		return nil, fmt.Errorf("authentication of %d bytes, want at least %d", len(b), authFixedLen)
+	}
+	a := &Authentication{
+		Protocol:        b[0],
+		Algorithm:       b[1],
+		RDM:             b[2],
+		ReplayDetection: binary.BigEndian.Uint64(b[3:authFixedLen]),
+		Info:            append([]byte(nil), b[authFixedLen:]...),
+	}
+	if a.Protocol == AuthDelayed && a.Algorithm == AuthHMACMD5 && len(a.Info) != 0 && len(a.Info) != delayedInfoLen {
+		return nil, fmt.Errorf("delayed authentication information of %d bytes, want 0 or %d", len(a.Info), delayedInfoLen)
+	}
+	return a, nil
+}
+
+// MarshalBinary encodes a as the value of OptionAuthentication.
+func (a *Authentication) MarshalBinary() ([]byte, error) {
+	if authFixedLen+len(a.Info) > 255 {
+		return nil, fmt.Errorf("authentication information of %d bytes is too long", len(a.Info))
+	}
+	b := make([]byte, authFixedLen, authFixedLen+len(a.Info))
+	b[0], b[1], b[2] = a.Protocol, a.Algorithm, a.RDM
+	binary.BigEndian.PutUint64(b[3:], a.ReplayDetection)
+	return append(b, a.Info...), nil
+}
+
+// Authentication returns the authentication.
+//
+// It returns nil if the option is not present or malformed. The option is
+// defined by RFC 3118.
+func (o Options) Authentication() *Authentication {
+	v := o.Get(OptionAuthentication)
+	if v == nil {
+		return nil
+	}
+	a, err := ParseAuthentication(v)
+	if err != nil {
+		return nil
+	}
+	return a
+}
+
+// SetAuthentication sets the authentication. Delayed authentication must
+// be signed with SignPacket after marshaling.
+//
+// A nil or invalid value removes the option.
+func (o Options) SetAuthentication(v *Authentication) {
+	var b []byte
+	if v != nil {
+		b, _ = v.MarshalBinary()
+	}
+	o.setBytes(OptionAuthentication, b)
+}
+
+// KeyStore holds the secrets of delayed authentication.
+type KeyStore interface {
+	// Key returns the secret with the ID, or false if there is none.
+	Key(id uint32) ([]byte, bool)
+}
+
+// Keys is a KeyStore of secrets by ID.
+type Keys map[uint32][]byte
+
+// Key implements KeyStore.
+func (k Keys) Key(id uint32) ([]byte, bool) {
+	key, ok := k[id]
+	return key, ok
+}
+
+// SignPacket signs the marshaled packet b in place with the delayed
+// authentication it carries, as set by SetAuthentication with
+// NewDelayedAuthentication, using the secret of keys with its ID.
+//
+// The HMAC-MD5 is computed over the whole packet with the hops and giaddr
+// fields, which relay agents change, and the HMAC itself set to zero, see
+// RFC 3118, Sections 4 and 5.4.
+func SignPacket(b []byte, keys KeyStore) error {
+	_, mac, key, err := delayedAuth(b, keys)
+	if err != nil {
+		return err
+	}
+	copy(b[mac:], authHMAC(b, mac, key))
+	return nil
+}
+
+// VerifyPacket checks the delayed authentication of the marshaled packet b
+// with the secrets of keys and returns it.
+//
+// It returns ErrNotAuthenticated if b carries no authentication option, and
+// ErrBadAuthentication if the HMAC does not match. Checking the replay
+// detection value is up to the caller, which knows the last one seen.
+func VerifyPacket(b []byte, keys KeyStore) (*Authentication, error) {
+	a, mac, key, err := delayedAuth(b, keys)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(b[mac:mac+md5.Size], authHMAC(b, mac, key)) {
+		return nil, ErrBadAuthentication
+	}
+	return a, nil
+}
+
+// delayedAuth returns the delayed authentication of the marshaled packet b,
+// the offset of its HMAC in b, and the secret of keys it is keyed by.
+//
+// Only the options field is searched: packets whose authentication option
+// was moved to the sname or file field are taken as not authenticated.
+func delayedAuth(b []byte, keys KeyStore) (*Authentication, int, []byte, error) {
+	if _, err := NewView(b); err != nil {
+		return nil, 0, nil, err
+	}
+	off := -1
+	for i := fixedLen; i < len(b); {
+		code := OptionCode(b[i])
+		if code == End {
+			break
+		} else if code == Pad {
+			i++
+			continue
+		}
+		if i+2 > len(b) || i+2+int(b[i+1]) > len(b) {
+			return nil, 0, nil, ErrInvalidOptions
+		}
+		if code == OptionAuthentication {
+			if off >= 0 {
+				return nil, 0, nil, errors.New("authentication option given more than once")
+			}
+			off = i + 2
+		}
+		i += 2 + int(b[i+1])
+	}
+	if off < 0 {
+		return nil, 0, nil, ErrNotAuthenticated
+	}
+
+	a, err := ParseAuthentication(b[off : off+int(b[off-1])])
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	id, ok := a.SecretID()
+	if !ok {
+		return nil, 0, nil, fmt.Errorf("authentication is not delayed HMAC-MD5 by a secret: %v", a)
+	}
+	key, ok := keys.Key(id)
+	if !ok {
+		return nil, 0, nil, fmt.Errorf("unknown secret ID %d", id)
+	}
+	return a, off + authFixedLen + 4, key, nil
+}
+
+// authHMAC returns the HMAC-MD5 of b keyed by key, computed as if the hops
+// and giaddr fields and the HMAC at offset mac were zero.
+func authHMAC(b []byte, mac int, key []byte) []byte {
+	var zero [md5.Size]byte
+	h := hmac.New(md5.New, key)
+	h.Write(b[:3])
+	h.Write(zero[:1]) // hops
+	h.Write(b[4:24])
+	h.Write(zero[:4]) // giaddr
+	h.Write(b[28:mac])
+	h.Write(zero[:])
+	h.Write(b[mac+md5.Size:])
+	return h.Sum(nil)
+}
@@ -0,0 +1,124 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestAuthenticationBinary(t *testing.T) {
+	for _, tt := range []struct {
+		desc string
+		a    *Authentication
+		b    []byte
+	}{
+		{
+			desc: "delayed",
+			a:    NewDelayedAuthentication(0x01020304, 5),
+			b: append([]byte{1, 1, 0, 0, 0, 0, 0, 0, 0, 0, 5, 1, 2, 3, 4},
+				make([]byte, 16)...),
+		},
+		{
+			desc: "delayed requested",
+			a:    &Authentication{Protocol: AuthDelayed, Algorithm: AuthHMACMD5, ReplayDetection: 1},
+			b:    []byte{1, 1, 0, 0, 0, 0, 0, 0, 0, 0, 1},
+		},
+		{
+			desc: "token",
+			a:    &Authentication{Protocol: AuthConfigurationToken, Info: []byte("token")},
+			b:    []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 't', 'o', 'k', 'e', 'n'},
+		},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			b, err := tt.a.MarshalBinary()
+			if err != nil || !bytes.Equal(b, tt.b) {
+				t.Errorf("MarshalBinary() = %v, %v, want %v", b, err, tt.b)
+			}
+			a, err := ParseAuthentication(tt.b)
+			if err != nil {
+				t.Fatalf("ParseAuthentication() = %v", err)
+			}
+			if !reflect.DeepEqual(a, tt.a) {
+				t.Errorf("ParseAuthentication() = %v, want %v", a, tt.a)
+			}
+		})
+	}
+
+	for _, b := range [][]byte{
+		{1, 1, 0},
+		// Delayed authentication information must be a secret ID and
+		// an HMAC.
+		{1, 1, 0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 2, 3, 4},
+	} {
+		if a, err := ParseAuthentication(b); err == nil {
+			t.Errorf("ParseAuthentication(%v) = %v, want error", b, a)
+		}
+	}
+}
+
+func TestSignVerifyPacket(t *testing.T) {
+	keys := Keys{7: []byte("secret")}
+	signed := func(p *Packet) []byte {
+		t.Helper()
+		b, err := p.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := SignPacket(b, keys); err != nil {
+			t.Fatalf("SignPacket() = %v", err)
+		}
+		return b
+	}
+
+	p := NewPacket(BootReply)
+	p.YIAddr = net.IP{192, 168, 0, 10}
+	p.Options.SetMessageType(DHCPOffer)
+	p.Options.SetAuthentication(NewDelayedAuthentication(7, 42))
+	p.Options.SetServerIdentifier(net.IP{192, 168, 0, 1})
+	b := signed(p)
+
+	a, err := VerifyPacket(b, keys)
+	if err != nil {
+		t.Fatalf("VerifyPacket() = %v", err)
+	}
+	if id, _ := a.SecretID(); id != 7 || a.ReplayDetection != 42 {
+		t.Errorf("VerifyPacket() = %v, want secret 7 and replay detection 42", a)
+	}
+
+	// Relay agents may change hops and giaddr.
+	relayed := append([]byte(nil), b...)
+	relayed[3] = 1
+	copy(relayed[24:28], []byte{10, 0, 0, 1})
+	if _, err := VerifyPacket(relayed, keys); err != nil {
+		t.Errorf("VerifyPacket() of relayed packet = %v", err)
+	}
+
+	tampered := append([]byte(nil), b...)
+	tampered[16] = 11 // yiaddr
+	if _, err := VerifyPacket(tampered, keys); err != ErrBadAuthentication {
+		t.Errorf("VerifyPacket() of tampered packet = %v, want %v", err, ErrBadAuthentication)
+	}
+	if _, err := VerifyPacket(b, Keys{7: []byte("other")}); err != ErrBadAuthentication {
+		t.Errorf("VerifyPacket() with other secret = %v, want %v", err, ErrBadAuthentication)
+	}
+	if _, err := VerifyPacket(b, Keys{8: []byte("secret")}); err == nil {
+		t.Errorf("VerifyPacket() with unknown secret ID succeeded")
+	}
+
+	p.Options.SetAuthentication(nil)
+	b, err = p.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyPacket(b, keys); err != ErrNotAuthenticated {
+		t.Errorf("VerifyPacket() without authentication = %v, want %v", err, ErrNotAuthenticated)
+	}
+	if err := SignPacket(b, keys); err != ErrNotAuthenticated {
+		t.Errorf("SignPacket() without authentication = %v, want %v", err, ErrNotAuthenticated)
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4
+
+import (
+	"fmt"
+	"net"
+)
+
+// BootInfo tells a client where to boot from. Servers send it in the sname,
+// file and siaddr header fields, or in the TFTP server name (66) and boot
+// file name (67) options, see RFC 2132, Section 9.4 and 9.5.
+type BootInfo struct {
+	// ServerName is the host name, or address, of the boot server.
+	ServerName string
+
+	// NextServer is the address of the boot server, or nil if it is only
+	// known by name.
+	NextServer net.IP
+
+	// BootFile is the name of the boot file.
+	BootFile string
+}
+
+// String implements fmt.Stringer.
+func (bi BootInfo) String() string {
+	server := bi.ServerName
+	if bi.NextServer != nil {
+		server = bi.NextServer.String()
+	}
+	return fmt.Sprintf("%q from %q", bi.BootFile, server)
+}
+
+// BootInfo returns the boot information of p, from wherever the server put
+// it: the file and sname fields take precedence over the boot file name and
+// TFTP server name options, which clients must look at when the fields are
+// empty or carry options, see Options.Overload. The next server is siaddr if
+// set, else the server name if it is an address.
+func (p *Packet) BootInfo() BootInfo {
+	bi := BootInfo{
+		ServerName: p.ServerName,
+		BootFile:   p.BootFile,
+	}
+	if bi.ServerName == "" {
+		bi.ServerName = p.Options.TFTPServerName()
+	}
+	if bi.BootFile == "" {
+		bi.BootFile = p.Options.BootFileName()
+	}
+	if p.SIAddr != nil && !p.SIAddr.IsUnspecified() {
+		bi.NextServer = p.SIAddr
+	} else if ip := net.ParseIP(bi.ServerName).To4(); ip != nil {
+		bi.NextServer = ip
+	}
+	return bi
+}
+
+// BootPlacement says where SetBootInfo puts the boot server name and file.
+type BootPlacement uint8
+
+const (
+	// BootFields puts them in the sname and file fields, as BOOTP and
+	// most PXE firmware expect. Values too long for the fields go into
+	// the options instead.
+	BootFields BootPlacement = iota
+
+	// BootOptions puts them in the TFTP server name and boot file name
+	// options, which leaves the fields free to carry options of large
+	// packets, see MarshalOptions.MaxSize.
+	BootOptions
+
+	// BootBoth puts them in the fields and the options, for networks
+	// with clients that look at only one of them.
+	BootBoth
+)
+
+// String implements fmt.Stringer.
+func (bp BootPlacement) String() string {
+	switch bp {
+	case BootFields:
+		return "fields"
+	case BootOptions:
+		return "options"
+	case BootBoth:
+		return "both"
+	}
+	return fmt.Sprintf("BootPlacement(%d)", uint8(bp))
+}
+
+// SetBootInfo sets the boot information of p, placing the server name and
+// boot file as place says. siaddr is set to bi.NextServer, if not nil. Empty
+// names clear the fields and options they would be put in.
+func (p *Packet) SetBootInfo(bi BootInfo, place BootPlacement) {
+	if bi.NextServer != nil {
+		p.SIAddr = bi.NextServer.To4()
+	}
+	p.ServerName, p.BootFile = "", ""
+	p.Options.SetTFTPServerName("")
+	p.Options.SetBootFileName("")
+
+	fields := place == BootFields || place == BootBoth
+	if fields && len(bi.ServerName) <= snameLen {
+		p.ServerName = bi.ServerName
+	}
+	if fields && len(bi.BootFile) <= fileLen {
+		p.BootFile = bi.BootFile
+	}
+	if p.ServerName != bi.ServerName || place == BootBoth {
+		p.Options.SetTFTPServerName(bi.ServerName)
+	}
+	if p.BootFile != bi.BootFile || place == BootBoth {
+		p.Options.SetBootFileName(bi.BootFile)
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4
+
+import (
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPacketBootInfo(t *testing.T) {
+	for _, tt := range []struct {
+		desc string
+		p    func(p *Packet)
+		want BootInfo
+	}{
+		{
+			desc: "nothing",
+		},
+		{
+			desc: "fields",
+			p: func(p *Packet) {
+				p.SIAddr = net.IP{10, 0, 0, 2}
+				p.ServerName = "boot"
+				p.BootFile = "pxelinux.0"
+				p.Options.SetBootFileName("ignored")
+			},
+			want: BootInfo{ServerName: "boot", NextServer: net.IP{10, 0, 0, 2}, BootFile: "pxelinux.0"},
+		},
+		{
+			desc: "options",
+			p: func(p *Packet) {
+				p.Options.SetTFTPServerName("10.0.0.3")
+				p.Options.SetBootFileName("undionly.kpxe")
+			},
+			want: BootInfo{ServerName: "10.0.0.3", NextServer: net.IP{10, 0, 0, 3}, BootFile: "undionly.kpxe"},
+		},
+		{
+			desc: "server name in sname",
+			p: func(p *Packet) {
+				p.ServerName = "10.0.0.4"
+				p.BootFile = "boot.img"
+			},
+			want: BootInfo{ServerName: "10.0.0.4", NextServer: net.IP{10, 0, 0, 4}, BootFile: "boot.img"},
+		},
+		{
+			desc: "host name only",
+			p: func(p *Packet) {
+				p.Options.SetTFTPServerName("tftp.example.com")
+			},
+			want: BootInfo{ServerName: "tftp.example.com"},
+		},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			p := NewPacket(BootReply)
+			if tt.p != nil {
+				tt.p(p)
+			}
+			if got := p.BootInfo(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("BootInfo() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetBootInfo(t *testing.T) {
+	bi := BootInfo{ServerName: "boot", NextServer: net.IP{10, 0, 0, 2}, BootFile: "pxelinux.0"}
+	long := BootInfo{ServerName: "boot", BootFile: "http://boot.example.com/" + strings.Repeat("x", fileLen)}
+
+	for _, tt := range []struct {
+		bi                  BootInfo
+		place               BootPlacement
+		wantSName, wantFile string
+		wantOptions         []OptionCode
+
+		// maxSize makes the options of small packets move to unused
+		// fields.
+		maxSize int
+	}{
+		{bi: bi, place: BootFields, wantSName: "boot", wantFile: "pxelinux.0"},
+		{bi: bi, place: BootOptions, wantOptions: []OptionCode{OptionTFTPServerName, OptionBootFileName}, maxSize: fixedLen + 10},
+		{bi: bi, place: BootBoth, wantSName: "boot", wantFile: "pxelinux.0", wantOptions: []OptionCode{OptionTFTPServerName, OptionBootFileName}},
+		{bi: long, place: BootFields, wantSName: "boot", wantOptions: []OptionCode{OptionBootFileName}},
+		{bi: BootInfo{}, place: BootBoth},
+	} {
+		t.Run(tt.place.String(), func(t *testing.T) {
+			p := NewPacket(BootReply)
+			p.ServerName, p.BootFile = "old", "old"
+			p.Options.SetBootFileName("old")
+			p.SetBootInfo(tt.bi, tt.place)
+
+			if p.ServerName != tt.wantSName || p.BootFile != tt.wantFile {
+				t.Errorf("sname, file = %q, %q, want %q, %q", p.ServerName, p.BootFile, tt.wantSName, tt.wantFile)
+			}
+			if got := p.OptionCodes(); len(got) != len(tt.wantOptions) {
+				t.Errorf("options = %v, want %v", got, tt.wantOptions)
+			}
+
+			// Clients find it wherever it was put.
+			b, err := MarshalOptions{MaxSize: tt.maxSize}.Marshal(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			q, err := ParsePacket(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := q.BootInfo()
+			if got.ServerName != tt.bi.ServerName || got.BootFile != tt.bi.BootFile {
+				t.Errorf("BootInfo() = %v, want %v", got, tt.bi)
+			}
+			if tt.bi.NextServer != nil && !got.NextServer.Equal(tt.bi.NextServer) {
+				t.Errorf("BootInfo().NextServer = %v, want %v", got.NextServer, tt.bi.NextServer)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4
+
+// IsBOOTP returns whether p is a plain BOOTP message (RFC 951) rather than a
+// DHCP message: one without a DHCP message type option.
+func (p *Packet) IsBOOTP() bool {
+	_, ok := p.Options[OptionDHCPMessageType]
+	return !ok
+}
+
+// bootpOnly lists the options that only make sense in DHCP messages, see RFC
+// 2132, Section 9, and which servers leave out of replies to BOOTP clients
+// (RFC 1534, Section 2).
+var bootpOnly = []OptionCode{
+	OptionRequestedIPAddress,
+	OptionIPAddressLeaseTime,
+	OptionOverload,
+	OptionDHCPMessageType,
+	OptionServerIdentifier,
+	OptionParameterRequestList,
+	OptionMessage,
+	OptionMaximumDHCPMessageSize,
+	OptionRenewalTimeValue,
+	OptionRebindingTimeValue,
+	OptionClientIdentifier,
+}
+
+// BOOTPReply turns p into a reply to the BOOTP request: the options only
+// DHCP clients understand are removed, and so are all options if the request
+// did not carry RFC 1497 vendor extensions, in which case the reply's vendor
+// area is empty.
+//
+// BOOTP messages are 300 bytes long (RFC 951), so replies should be
+// marshaled with a MaxSize of 300 and PadBOOTP.
+func (p *Packet) BOOTPReply(request *Packet) {
+	if request.VendorArea != nil {
+		p.Options = make(Options)
+		p.VendorArea = make([]byte, 0)
+		return
+	}
+	for _, code := range bootpOnly {
+		delete(p.Options, code)
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+)
+
+// rfc951Request returns a BOOTREQUEST of RFC 951 with the vendor area vend,
+// which does not start with the magic cookie.
+func rfc951Request(vend []byte) []byte {
+	b := make([]byte, bootpMinLen)
+	b[0], b[1], b[2] = byte(BootRequest), 1, 6
+	copy(b[4:8], []byte{1, 2, 3, 4})
+	copy(b[28:34], []byte{2, 0, 0, 0, 0, 1})
+	copy(b[minPacketLen:], vend)
+	return b
+}
+
+func TestUnmarshalBOOTP(t *testing.T) {
+	vend := []byte("CMU\x00vendor data")
+	for _, tt := range []struct {
+		name     string
+		b        []byte
+		wantErr  bool
+		wantVend []byte
+	}{
+		{
+			name:     "vendor area",
+			b:        rfc951Request(vend),
+			wantVend: rfc951Request(vend)[minPacketLen:],
+		},
+		{
+			name:     "empty vendor area",
+			b:        rfc951Request(nil),
+			wantVend: make([]byte, bootpMinLen-minPacketLen),
+		},
+		{
+			name:    "short",
+			b:       rfc951Request(vend)[:bootpMinLen-1],
+			wantErr: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := ParsePacket(tt.b)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParsePacket() = %v, want error", p)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !p.IsBOOTP() || len(p.Options) != 0 || !bytes.Equal(p.VendorArea, tt.wantVend) {
+				t.Errorf("ParsePacket() = options %v, vendor area %x, want a BOOTP message with vendor area %x", p.Options, p.VendorArea, tt.wantVend)
+			}
+			if err := p.Validate(); err != nil {
+				t.Errorf("Validate() = %v, want nil", err)
+			}
+			if want := (net.HardwareAddr{2, 0, 0, 0, 0, 1}); p.HardwareAddr().String() != want.String() {
+				t.Errorf("chaddr = %v, want %v", p.HardwareAddr(), want)
+			}
+
+			b, err := p.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(b, tt.b) {
+				t.Errorf("MarshalBinary() = %x, want %x", b, tt.b)
+			}
+		})
+	}
+}
+
+func TestBOOTPReply(t *testing.T) {
+	extensions := NewPacket(BootRequest)
+	extensions.Options.SetHostName("bootp")
+	plain, err := ParsePacket(rfc951Request(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name        string
+		request     *Packet
+		wantOptions []OptionCode
+	}{
+		{
+			name:        "vendor extensions",
+			request:     extensions,
+			wantOptions: []OptionCode{OptionSubnetMask, OptionRouters},
+		},
+		{
+			name:    "plain",
+			request: plain,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if !tt.request.IsBOOTP() {
+				t.Errorf("IsBOOTP() = false for a request without message type")
+			}
+
+			reply := NewPacket(BootReply)
+			reply.YIAddr = net.IP{192, 168, 0, 10}
+			reply.Options.SetMessageType(DHCPACK)
+			reply.Options.SetServerIdentifier(net.IP{192, 168, 0, 1})
+			reply.Options.SetLeaseTime(time.Hour)
+			reply.Options.SetSubnetMask(net.IPMask{255, 255, 255, 0})
+			reply.Options.SetRouters([]net.IP{{192, 168, 0, 1}})
+			reply.BOOTPReply(tt.request)
+
+			if got := reply.OptionCodes(); len(got) != len(tt.wantOptions) {
+				t.Errorf("options = %v, want %v", got, tt.wantOptions)
+			}
+			for _, code := range tt.wantOptions {
+				if reply.Options.Get(code) == nil {
+					t.Errorf("option %v missing", code)
+				}
+			}
+
+			b, err := MarshalOptions{Padding: PadBOOTP, MaxSize: bootpMinLen}.Marshal(reply)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(b) != bootpMinLen {
+				t.Errorf("reply is %d bytes, want %d", len(b), bootpMinLen)
+			}
+			got, err := ParsePacket(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.IsBOOTP() || !got.YIAddr.Equal(reply.YIAddr) || (got.VendorArea == nil) != (tt.request.VendorArea == nil) {
+				t.Errorf("reply = %v, vendor area %x", got, got.VendorArea)
+			}
+		})
+	}
+}
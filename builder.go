@@ -0,0 +1,209 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// BuildOpt sets part of a packet built by Build.
+type BuildOpt func(p *Packet) error
+
+// Build returns the packet set by opts, applied in order, after checking it
+// against the rules RFC 2131 lays down for its message type, see
+// CheckMessage. The first option should be the message type, e.g.
+// Discover():
+//
+//	p, err := dhcp4.Build(dhcp4.Discover(), dhcp4.WithCHAddr(mac), dhcp4.WithRequestedIP(ip))
+func Build(opts ...BuildOpt) (*Packet, error) {
+	p := NewPacket(BootRequest)
+	for _, opt := range opts {
+		if err := opt(p); err != nil {
+			return nil, err
+		}
+	}
+	if err := CheckMessage(p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// messageOpt returns a BuildOpt setting the message type typ of a message
+// sent with op.
+func messageOpt(op OpCode, typ MessageType) BuildOpt {
+	return func(p *Packet) error {
+		p.Op = op
+		p.Options.SetMessageType(typ)
+		return nil
+	}
+}
+
+// Discover builds a DHCPDISCOVER, which a client broadcasts to find servers.
+func Discover() BuildOpt {
+	return messageOpt(BootRequest, DHCPDiscover)
+}
+
+// Request builds a DHCPREQUEST, which a client sends to request an offered
+// address, to confirm its address after a reboot, or to extend its lease.
+func Request() BuildOpt {
+	return messageOpt(BootRequest, DHCPRequest)
+}
+
+// Decline builds a DHCPDECLINE, which a client sends when its assigned
+// address is already in use.
+func Decline() BuildOpt {
+	return messageOpt(BootRequest, DHCPDecline)
+}
+
+// Release builds a DHCPRELEASE, which a client sends to give up its lease.
+func Release() BuildOpt {
+	return messageOpt(BootRequest, DHCPRelease)
+}
+
+// Inform builds a DHCPINFORM, which a client with an address sends to ask
+// for its configuration.
+func Inform() BuildOpt {
+	return messageOpt(BootRequest, DHCPInform)
+}
+
+// Offer builds a DHCPOFFER, which a server sends to offer an address.
+func Offer() BuildOpt {
+	return messageOpt(BootReply, DHCPOffer)
+}
+
+// ACK builds a DHCPACK, which a server sends to assign an address or to
+// answer a DHCPINFORM.
+func ACK() BuildOpt {
+	return messageOpt(BootReply, DHCPACK)
+}
+
+// NAK builds a DHCPNAK, which a server sends to refuse a DHCPREQUEST.
+func NAK() BuildOpt {
+	return messageOpt(BootReply, DHCPNAK)
+}
+
+// WithCHAddr sets the client hardware address.
+func WithCHAddr(addr net.HardwareAddr) BuildOpt {
+	return func(p *Packet) error {
+		return p.SetHardwareAddr(addr)
+	}
+}
+
+// WithXID sets the transaction ID.
+func WithXID(xid [4]byte) BuildOpt {
+	return func(p *Packet) error {
+		p.TransactionID = xid
+		return nil
+	}
+}
+
+// WithBroadcast sets the broadcast flag, asking servers to broadcast their
+// replies.
+func WithBroadcast() BuildOpt {
+	return func(p *Packet) error {
+		p.Broadcast = true
+		return nil
+	}
+}
+
+// WithCIAddr sets the client's address, ciaddr.
+func WithCIAddr(ip net.IP) BuildOpt {
+	return withAddr("ciaddr", func(p *Packet) *net.IP { return &p.CIAddr }, ip)
+}
+
+// WithYIAddr sets the address offered or assigned to the client, yiaddr.
+func WithYIAddr(ip net.IP) BuildOpt {
+	return withAddr("yiaddr", func(p *Packet) *net.IP { return &p.YIAddr }, ip)
+}
+
+// WithSIAddr sets the address of the next server, siaddr.
+func WithSIAddr(ip net.IP) BuildOpt {
+	return withAddr("siaddr", func(p *Packet) *net.IP { return &p.SIAddr }, ip)
+}
+
+// WithGIAddr sets the address of the relay agent, giaddr.
+func WithGIAddr(ip net.IP) BuildOpt {
+	return withAddr("giaddr", func(p *Packet) *net.IP { return &p.GIAddr }, ip)
+}
+
+// withAddr returns a BuildOpt setting the IPv4 address field named field,
+// returned by addr, to ip.
+func withAddr(field string, addr func(p *Packet) *net.IP, ip net.IP) BuildOpt {
+	return func(p *Packet) error {
+		ip4 := ip.To4()
+		if ip4 == nil {
+			return fmt.Errorf("%s %v is not an IPv4 address", field, ip)
+		}
+		*addr(p) = ip4
+		return nil
+	}
+}
+
+// WithRequestedIP sets the requested IP address option.
+func WithRequestedIP(ip net.IP) BuildOpt {
+	return func(p *Packet) error {
+		if ip.To4() == nil {
+			return fmt.Errorf("requested IP address %v is not an IPv4 address", ip)
+		}
+		p.Options.SetRequestedIPAddress(ip)
+		return nil
+	}
+}
+
+// WithServerID sets the server identifier option.
+func WithServerID(ip net.IP) BuildOpt {
+	return func(p *Packet) error {
+		if ip.To4() == nil {
+			return fmt.Errorf("server identifier %v is not an IPv4 address", ip)
+		}
+		p.Options.SetServerIdentifier(ip)
+		return nil
+	}
+}
+
+// WithClientID sets the client identifier option.
+func WithClientID(id []byte) BuildOpt {
+	return func(p *Packet) error {
+		p.Options.SetClientIdentifier(id)
+		return nil
+	}
+}
+
+// WithLeaseTime sets the lease time option.
+func WithLeaseTime(d time.Duration) BuildOpt {
+	return func(p *Packet) error {
+		p.Options.SetLeaseTime(d)
+		return nil
+	}
+}
+
+// WithOptions copies opts into the packet, replacing options of the same
+// code. The message type cannot be changed this way.
+func WithOptions(opts Options) BuildOpt {
+	return func(p *Packet) error {
+		for code, v := range opts {
+			if code == OptionDHCPMessageType {
+				return errors.New("message type set with WithOptions")
+			}
+			p.Options[code] = append([]byte(nil), v...)
+		}
+		return nil
+	}
+}
+
+// CheckMessage checks p against the rules of RFC 2131 for its message type,
+// as sent by the client or server its message type implies, see
+// ValidateMessage.
+func CheckMessage(p *Packet) error {
+	role := RoleClient
+	switch p.Options.MessageType() {
+	case DHCPOffer, DHCPACK, DHCPNAK:
+		role = RoleServer
+	}
+	return p.ValidateMessage(role)
+}
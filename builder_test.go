@@ -0,0 +1,85 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuild(t *testing.T) {
+	mac := net.HardwareAddr{2, 0, 0, 0, 0, 1}
+	ip := net.IP{192, 168, 1, 10}
+	sid := net.IP{192, 168, 1, 1}
+
+	for _, tt := range []struct {
+		desc    string
+		opts    []BuildOpt
+		wantErr string
+	}{
+		{desc: "discover", opts: []BuildOpt{Discover(), WithCHAddr(mac), WithRequestedIP(ip), WithBroadcast()}},
+		{desc: "discover with ciaddr", opts: []BuildOpt{Discover(), WithCHAddr(mac), WithCIAddr(ip)}, wantErr: "ciaddr must be 0"},
+		{desc: "discover with server ID", opts: []BuildOpt{Discover(), WithCHAddr(mac), WithServerID(sid)}, wantErr: "server identifier"},
+		{desc: "no hardware address", opts: []BuildOpt{Discover()}, wantErr: "no client hardware address"},
+
+		{desc: "selecting", opts: []BuildOpt{Request(), WithCHAddr(mac), WithServerID(sid), WithRequestedIP(ip)}},
+		{desc: "selecting without address", opts: []BuildOpt{Request(), WithCHAddr(mac), WithServerID(sid)}, wantErr: "without a requested IP address"},
+		{desc: "selecting with ciaddr", opts: []BuildOpt{Request(), WithCHAddr(mac), WithServerID(sid), WithRequestedIP(ip), WithCIAddr(ip)}, wantErr: "ciaddr must be 0 when SELECTING"},
+		{desc: "init-reboot", opts: []BuildOpt{Request(), WithCHAddr(mac), WithRequestedIP(ip)}},
+		{desc: "renewing", opts: []BuildOpt{Request(), WithCHAddr(mac), WithCIAddr(ip)}},
+		{desc: "renewing with requested address", opts: []BuildOpt{Request(), WithCHAddr(mac), WithCIAddr(ip), WithRequestedIP(ip)}, wantErr: "requested IP address and ciaddr"},
+		{desc: "request for nothing", opts: []BuildOpt{Request(), WithCHAddr(mac)}, wantErr: "neither"},
+
+		{desc: "decline", opts: []BuildOpt{Decline(), WithCHAddr(mac), WithServerID(sid), WithRequestedIP(ip)}},
+		{desc: "decline without address", opts: []BuildOpt{Decline(), WithCHAddr(mac), WithServerID(sid)}, wantErr: "no requested IP address"},
+		{desc: "release", opts: []BuildOpt{Release(), WithCHAddr(mac), WithServerID(sid), WithCIAddr(ip)}},
+		{desc: "release without server ID", opts: []BuildOpt{Release(), WithCHAddr(mac), WithCIAddr(ip)}, wantErr: "no server identifier"},
+		{desc: "inform", opts: []BuildOpt{Inform(), WithCHAddr(mac), WithCIAddr(ip)}},
+		{desc: "inform without ciaddr", opts: []BuildOpt{Inform(), WithCHAddr(mac)}, wantErr: "ciaddr must be the client's address"},
+
+		{desc: "offer", opts: []BuildOpt{Offer(), WithCHAddr(mac), WithYIAddr(ip), WithServerID(sid), WithLeaseTime(time.Hour)}},
+		{desc: "offer without lease time", opts: []BuildOpt{Offer(), WithCHAddr(mac), WithYIAddr(ip), WithServerID(sid)}, wantErr: "no lease time"},
+		{desc: "ack", opts: []BuildOpt{ACK(), WithCHAddr(mac), WithYIAddr(ip), WithServerID(sid), WithLeaseTime(time.Hour)}},
+		{desc: "ack to inform", opts: []BuildOpt{ACK(), WithCHAddr(mac), WithServerID(sid)}},
+		{desc: "ack to inform with lease time", opts: []BuildOpt{ACK(), WithCHAddr(mac), WithServerID(sid), WithLeaseTime(time.Hour)}, wantErr: "lease time without an assigned address"},
+		{desc: "nak", opts: []BuildOpt{NAK(), WithCHAddr(mac), WithServerID(sid)}},
+		{desc: "nak with yiaddr", opts: []BuildOpt{NAK(), WithCHAddr(mac), WithServerID(sid), WithYIAddr(ip)}, wantErr: "must be 0"},
+
+		{desc: "IPv6 address", opts: []BuildOpt{Inform(), WithCHAddr(mac), WithCIAddr(net.ParseIP("2001:db8::1"))}, wantErr: "not an IPv4 address"},
+		{desc: "message type in options", opts: []BuildOpt{Discover(), WithCHAddr(mac), WithOptions(Options{OptionDHCPMessageType: {byte(DHCPInform)}})}, wantErr: "message type"},
+	} {
+		p, err := Build(tt.opts...)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: Build() = %v", tt.desc, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: Build() = %v, %v; want error containing %q", tt.desc, p, err, tt.wantErr)
+		}
+	}
+}
+
+func TestBuildFields(t *testing.T) {
+	mac := net.HardwareAddr{2, 0, 0, 0, 0, 1}
+	p, err := Build(Request(), WithCHAddr(mac), WithXID([4]byte{1, 2, 3, 4}), WithCIAddr(net.IP{10, 0, 0, 5}),
+		WithGIAddr(net.IP{10, 0, 0, 1}), WithClientID([]byte{1, 2, 0, 0, 0, 0, 1}),
+		WithOptions(Options{OptionHostName: []byte("node0")}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Op != BootRequest || p.Options.MessageType() != DHCPRequest || p.TransactionID != [4]byte{1, 2, 3, 4} {
+		t.Errorf("built %v, want a DHCPREQUEST with xid 01020304", p)
+	}
+	if p.HardwareAddr().String() != mac.String() || !p.CIAddr.Equal(net.IP{10, 0, 0, 5}) || !p.GIAddr.Equal(net.IP{10, 0, 0, 1}) {
+		t.Errorf("built chaddr %v, ciaddr %v, giaddr %v", p.HardwareAddr(), p.CIAddr, p.GIAddr)
+	}
+	if p.Options.HostName() != "node0" || len(p.Options.ClientIdentifier()) != 7 {
+		t.Errorf("built options %v", p.Options)
+	}
+}
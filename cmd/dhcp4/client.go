@@ -0,0 +1,67 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"net"
+	"os"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+	"github.com/mergetb/dhcp4/dhcp4client"
+)
+
+// leaseJSON is the form a lease is printed in. Times relative to the start
+// of the lease are numbers of seconds, as in the options.
+type leaseJSON struct {
+	IP            net.IP        `json:"ip"`
+	ServerID      net.IP        `json:"server_id,omitempty"`
+	Start         time.Time     `json:"start"`
+	LeaseTime     int64         `json:"lease_time,omitempty"`
+	RenewalTime   int64         `json:"renewal_time,omitempty"`
+	RebindingTime int64         `json:"rebinding_time,omitempty"`
+	LinkLocal     bool          `json:"link_local,omitempty"`
+	TimeToLease   string        `json:"time_to_lease,omitempty"`
+	Options       dhcp4.Options `json:"options,omitempty"`
+}
+
+// client acquires a lease and prints it.
+func client(args []string) error {
+	fs := flag.NewFlagSet("client", flag.ExitOnError)
+	iface := fs.String("i", "", "Interface to acquire a lease on")
+	timeout := fs.Duration("timeout", time.Minute, "Time to acquire a lease in")
+	fs.Parse(args)
+	if *iface == "" {
+		return errors.New("-i is required")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	lease, err := dhcp4client.Acquire(ctx, *iface)
+	if err != nil {
+		return err
+	}
+
+	l := leaseJSON{
+		IP:            lease.IP,
+		ServerID:      lease.ServerID,
+		Start:         lease.Start,
+		LeaseTime:     int64(lease.Duration / time.Second),
+		RenewalTime:   int64(lease.RenewalTime / time.Second),
+		RebindingTime: int64(lease.RebindingTime / time.Second),
+		LinkLocal:     lease.LinkLocal,
+		Options:       lease.Options,
+	}
+	if lease.TimeToLease != 0 {
+		l.TimeToLease = lease.TimeToLease.String()
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(l)
+}
@@ -0,0 +1,47 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// dhcp4 is a DHCP debugging tool built on this module's packages.
+//
+// Synopsis:
+//
+//	dhcp4 client [-timeout DURATION] -i IFACE
+//	dhcp4 sniff [-json] -i IFACE
+//	dhcp4 serve -config FILE [-self IP] [-addr ADDR]
+//
+// client acquires a lease on IFACE, without configuring it, and prints it
+// as JSON. sniff prints the DHCP messages sent to the server and client
+// ports on IFACE. serve runs a server with the pool, reservations and
+// options of a JSON config file, as read by dhcp4server.ReadConfig, until
+// interrupted.
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+var commands = map[string]func(args []string) error{
+	"client": client,
+	"sniff":  sniff,
+	"serve":  serve,
+}
+
+const usage = "usage: dhcp4 client|sniff|serve [flags]"
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "dhcp4: unknown command %q\n%s\n", os.Args[1], usage)
+		os.Exit(2)
+	}
+	if err := cmd(os.Args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "dhcp4 %s: %v\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/mergetb/dhcp4/dhcp4server"
+)
+
+// serve runs a server configured by a config file until interrupted.
+func serve(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	config := fs.String("config", "", "JSON config file with the pool, reservations and options to serve")
+	self := fs.String("self", "", "Address of this server, the server identifier of its pool if empty")
+	addr := fs.String("addr", ":67", "Address to listen on")
+	fs.Parse(args)
+	if *config == "" {
+		return errors.New("-config is required")
+	}
+
+	f, err := os.Open(*config)
+	if err != nil {
+		return err
+	}
+	cfg, err := dhcp4server.ReadConfig(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("%s: %v", *config, err)
+	}
+	if len(cfg.Pools) != 1 {
+		return fmt.Errorf("%s: the server serves one pool, got %d", *config, len(cfg.Pools))
+	}
+	ip := net.ParseIP(*self)
+	if *self == "" {
+		ip = net.ParseIP(cfg.Pools[0].ServerID)
+	}
+	if ip == nil {
+		return errors.New("-self is required if the pool has no server_id")
+	}
+
+	logger := log.New(os.Stdout, "", log.LstdFlags)
+	s, err := dhcp4server.NewFromConfig(ip, cfg, dhcp4server.WithLogger(logger))
+	if err != nil {
+		return fmt.Errorf("%s: %v", *config, err)
+	}
+	conn, err := net.ListenPacket("udp4", *addr)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sig
+		cancel()
+	}()
+
+	if err := s.Start(ctx, conn); err != nil {
+		return err
+	}
+	logger.Printf("Serving %s on %v", cfg.Pools[0].Subnet, conn.LocalAddr())
+	return s.Wait()
+}
@@ -0,0 +1,88 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+	"github.com/mergetb/dhcp4/dhcp4client"
+)
+
+// maxMessageSize is the largest DHCP message read.
+const maxMessageSize = 1500
+
+// sniffed is a message read by sniff.
+type sniffed struct {
+	t      time.Time
+	source net.Addr
+	b      []byte
+}
+
+// sniff prints the DHCP messages seen on an interface until reading fails.
+func sniff(args []string) error {
+	fs := flag.NewFlagSet("sniff", flag.ExitOnError)
+	iface := fs.String("i", "", "Interface to sniff")
+	asJSON := fs.Bool("json", false, "Print messages as JSON objects, one per line, instead of summaries")
+	fs.Parse(args)
+	if *iface == "" {
+		return errors.New("-i is required")
+	}
+
+	// Requests are sent to the server port and replies to the client
+	// port; broadcasts are received on both sockets of a port.
+	msgs := make(chan sniffed)
+	errs := make(chan error, 2)
+	for _, port := range []int{dhcp4client.ServerPort, dhcp4client.ClientPort} {
+		conn, err := dhcp4client.NewIPv4UDPConn(*iface, port)
+		if err != nil {
+			return fmt.Errorf("listen on port %d: %v", port, err)
+		}
+		defer conn.Close()
+		go read(conn, msgs, errs)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	for {
+		var m sniffed
+		select {
+		case m = <-msgs:
+		case err := <-errs:
+			return err
+		}
+		p, err := dhcp4.ParsePacket(m.b)
+		if err != nil {
+			fmt.Printf("%s %v: malformed: %v\n", m.t.Format(time.StampMicro), m.source, err)
+			continue
+		}
+		if *asJSON {
+			if err := enc.Encode(p); err != nil {
+				return err
+			}
+			continue
+		}
+		fmt.Printf("%s %v: %s\n", m.t.Format(time.StampMicro), m.source, p.Summary())
+	}
+}
+
+// read sends the messages read from conn to msgs, and the error it fails
+// with to errs.
+func read(conn net.PacketConn, msgs chan<- sniffed, errs chan<- error) {
+	for {
+		b := make([]byte, maxMessageSize)
+		n, source, err := conn.ReadFrom(b)
+		if err != nil {
+			errs <- err
+			return
+		}
+		msgs <- sniffed{t: time.Now(), source: source, b: b[:n]}
+	}
+}
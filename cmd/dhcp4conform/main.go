@@ -0,0 +1,70 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// dhcp4conform runs a battery of exchanges against a DHCP server on a
+// segment and prints a report of how it conforms to RFC 2131, e.g. to
+// qualify third-party lab infrastructure.
+//
+// Synopsis:
+//
+//	dhcp4conform [-server IP] IFACE
+//
+// dhcp4conform acquires, renews and releases a lease on IFACE without
+// configuring it. It exits with status 1 if any check failed.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"time"
+
+	"github.com/mergetb/dhcp4/dhcp4client"
+	"github.com/vishvananda/netlink"
+)
+
+var (
+	server  = flag.String("server", "", "Server identifier of the server to test (the first to answer if empty)")
+	timeout = flag.Duration("timeout", time.Minute, "Time the whole battery may take")
+)
+
+func main() {
+	flag.Parse()
+	if flag.NArg() != 1 {
+		log.Fatalf("usage: dhcp4conform [flags] IFACE")
+	}
+
+	var sid net.IP
+	if *server != "" {
+		if sid = net.ParseIP(*server).To4(); sid == nil {
+			log.Fatalf("Invalid server identifier %q", *server)
+		}
+	}
+
+	iface, err := netlink.LinkByName(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	c, err := dhcp4client.New(iface)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	r, err := c.Conformance(ctx, sid)
+	if r != nil {
+		fmt.Print(r)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if r.Failed() {
+		os.Exit(1)
+	}
+}
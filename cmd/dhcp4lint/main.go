@@ -0,0 +1,72 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// dhcp4lint reports problematic constructions in DHCPv4 packets.
+//
+// Synopsis:
+//
+//	dhcp4lint [-hex] FILE...
+//
+// Each file holds one packet, starting at the BOOTP op code, e.g. the UDP
+// payload exported from a packet capture. With -hex, files hold the packet
+// as hex text, which may contain white space.
+//
+// dhcp4lint exits with status 1 if any packet has findings.
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/mergetb/dhcp4"
+)
+
+var hexInput = flag.Bool("hex", false, "Read packets as hex text")
+
+func lintFile(name string) (int, error) {
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return 0, err
+	}
+	if *hexInput {
+		b, err = hex.DecodeString(strings.Join(strings.Fields(string(b)), ""))
+		if err != nil {
+			return 0, fmt.Errorf("%s: %v", name, err)
+		}
+	}
+
+	p, err := dhcp4.ParsePacket(b)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", name, err)
+	}
+	fs := dhcp4.Lint(p)
+	for _, f := range fs {
+		fmt.Printf("%s: %v\n", name, f)
+	}
+	return len(fs), nil
+}
+
+func main() {
+	flag.Parse()
+	if flag.NArg() == 0 {
+		log.Fatalf("usage: dhcp4lint [-hex] FILE...")
+	}
+
+	var findings int
+	for _, name := range flag.Args() {
+		n, err := lintFile(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		findings += n
+	}
+	if findings > 0 {
+		os.Exit(1)
+	}
+}
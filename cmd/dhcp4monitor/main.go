@@ -0,0 +1,50 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// dhcp4monitor watches the DHCP traffic on a segment and prints pathological
+// patterns, such as clients stuck retrying DORA.
+//
+// Synopsis:
+//
+//	dhcp4monitor [-window DURATION] IFACE
+//
+// It must not run on the same host as a DHCP server listening on IFACE.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"time"
+
+	"github.com/mergetb/dhcp4/dhcp4client"
+	"github.com/mergetb/dhcp4/dhcp4monitor"
+)
+
+var (
+	window = flag.Duration("window", time.Minute, "Window to detect patterns in")
+	retry  = flag.Int("retry-threshold", 10, "DHCPDISCOVERs per window that make a retry storm")
+	flap   = flag.Int("flap-threshold", 3, "Release/request cycles per window that make a client flapping")
+)
+
+func main() {
+	flag.Parse()
+	if flag.NArg() != 1 {
+		log.Fatalf("usage: dhcp4monitor [flags] IFACE")
+	}
+	iface := flag.Arg(0)
+
+	conn, err := dhcp4client.NewIPv4UDPConn(iface, dhcp4client.ServerPort)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Close()
+
+	m := dhcp4monitor.New(func(a dhcp4monitor.Anomaly) {
+		log.Print(a)
+	}, dhcp4monitor.WithWindow(*window), dhcp4monitor.WithRetryThreshold(*retry), dhcp4monitor.WithFlapThreshold(*flap))
+	if err := m.Run(context.Background(), conn); err != nil {
+		log.Fatalf("Monitoring %s failed: %v", iface, err)
+	}
+}
@@ -1,37 +1,278 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"flag"
+	"fmt"
+	"io/ioutil"
 	"log"
 	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/mergetb/dhcp4/dhcp4metrics"
 	"github.com/mergetb/dhcp4/dhcp4server"
+	"github.com/mergetb/dhcp4/internal/preflight"
 )
 
 var (
 	subnet = flag.String("subnet", "192.168.1.0/24", "IP subnet to use to allocate over DHCP (must be CIDR notation)")
 	self   = flag.String("self", "192.168.0.1", "My own IP")
+
+	serverID = flag.String("server-id", "", "Address to send clients as the server identifier (option 54), if not -self")
+
+	bootFile   = flag.String("bootfile", "", "Boot file to serve to clients")
+	ipxeScript = flag.String("ipxe-script", "", "Boot file (usually a script URL) to serve to iPXE clients instead of -bootfile")
+
+	workers      = flag.Int("workers", 1, "Number of requests handled concurrently")
+	queueSize    = flag.Int("queue-size", 64, "Number of requests waiting for a worker at most")
+	sockets      = flag.Int("sockets", 1, "Number of sockets reading requests, sharing port 67 with SO_REUSEPORT (Linux only)")
+	secsPriority = flag.Bool("secs-priority", false, "Serve clients that have been waiting longest first when busy")
+
+	config      = flag.String("config", "", "JSON config file with the pool, reservations and options to serve, instead of -subnet and -bootfile")
+	checkConfig = flag.String("check-config", "", "Validate the JSON config file at this path and exit")
+	selfTest    = flag.Bool("self-test", false, "Run a client through DISCOVER, OFFER, REQUEST, ACK before serving and exit if it fails")
+
+	leaseKey     = flag.String("lease-key", "mac", "How clients are told apart: mac, client-id, or client-id-then-mac")
+	allocation   = flag.String("allocation", "requested", "How addresses are chosen for clients without a reservation: requested, sequential, hash, or sticky")
+	offerHold    = flag.Duration("offer-hold", 30*time.Second, "How long an offered address is held for a client that has not requested it yet")
+	leaseFile    = flag.String("lease-file", "", "File to save bindings to, so they survive restarts (kept in memory only if empty)")
+	leaseKeyFile = flag.String("lease-key-file", "", "File holding a hex-encoded AES key to encrypt -lease-file with (unencrypted if empty)")
+
+	admin            = flag.String("admin", "", "Address to serve the HTTP admin API on (disabled if empty)")
+	metrics          = flag.String("metrics", "", "Address to serve Prometheus metrics on at /metrics (disabled if empty)")
+	historyRetention = flag.Duration("history-retention", 7*24*time.Hour, "How long to keep ended leases in the lease history (0 keeps them forever)")
+	historyFile      = flag.String("history-file", "", "File to save the lease history to, encrypted with -lease-key-file if set (kept in memory only if empty)")
+	stateFile        = flag.String("state-file", "", "File to write the runtime state to as JSON on SIGUSR1 (logged if empty)")
+
+	unsafeChaos   = flag.Bool("unsafe-chaos", false, "Inject faults into responses as configured by the -chaos flags; breaks clients, never use in production")
+	chaosDrop     = flag.Float64("chaos-drop", 0, "Fraction of responses to drop (requires -unsafe-chaos)")
+	chaosDelay    = flag.Float64("chaos-delay", 0, "Fraction of responses to delay by up to -chaos-max-delay (requires -unsafe-chaos)")
+	chaosMaxDelay = flag.Duration("chaos-max-delay", 2*time.Second, "Maximum delay of delayed responses")
+	chaosCorrupt  = flag.Float64("chaos-corrupt", 0, "Fraction of responses to corrupt (requires -unsafe-chaos)")
 )
 
+// startHooks are run before DHCP is served. Optional services built with
+// build tags add themselves here.
+var startHooks []func()
+
 func main() {
+	flag.Parse()
+
+	if *checkConfig != "" {
+		os.Exit(check(*checkConfig))
+	}
+
+	var cfg *dhcp4server.Config
+	if *config != "" {
+		var err error
+		if cfg, err = readConfig(*config); err != nil {
+			log.Fatal(err)
+		}
+		if len(cfg.Pools) != 1 {
+			log.Fatalf("%s: the server serves one pool, got %d", *config, len(cfg.Pools))
+		}
+		*subnet = cfg.Pools[0].Subnet
+	}
 	_, sn, err := net.ParseCIDR(*subnet)
 	if err != nil {
 		log.Fatalf("Could not parse CIDR for subnet %q: %v", *subnet, err)
 	}
 
-	l, err := net.ListenPacket("udp4", ":67")
+	keyPolicy, err := dhcp4server.ParseKeyPolicy(*leaseKey)
 	if err != nil {
-		log.Fatalf("Could not listen on udp port 67: %v", err)
+		log.Fatal(err)
+	}
+
+	allocationStrategy, err := dhcp4server.ParseAllocationStrategy(*allocation)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := preflight.Check(67); err != nil {
+		log.Fatal(err)
 	}
-	defer l.Close()
 
 	logger := log.New(os.Stdout, "", log.LstdFlags)
 
-	s := dhcp4server.New(net.ParseIP(*self), sn, "", "")
+	opts := []dhcp4server.ServerOpt{
+		dhcp4server.WithAllocationStrategy(allocationStrategy),
+		dhcp4server.WithHistoryRetention(*historyRetention),
+		dhcp4server.WithIPXE("", *ipxeScript),
+		dhcp4server.WithKeyPolicy(keyPolicy),
+		dhcp4server.WithOfferHold(*offerHold),
+		dhcp4server.WithWorkers(*workers),
+		dhcp4server.WithQueueSize(*queueSize),
+	}
+	if *metrics != "" {
+		registry := dhcp4metrics.NewRegistry("dhcp_server")
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", registry)
+		go func() {
+			log.Fatalf("Metrics server failed: %v", http.ListenAndServe(*metrics, mux))
+		}()
+		opts = append(opts, dhcp4server.WithMetrics(registry))
+	}
+	if *serverID != "" {
+		id := net.ParseIP(*serverID)
+		if err := dhcp4server.CheckServerID(id, sn); err != nil {
+			log.Fatal(err)
+		}
+		opts = append(opts, dhcp4server.WithServerID(id))
+	}
+	if *secsPriority {
+		opts = append(opts, dhcp4server.WithSecsPriority())
+	}
+	if *leaseFile != "" {
+		var lopts []dhcp4server.FileLeasesOpt
+		if *leaseKeyFile != "" {
+			lopts = append(lopts, dhcp4server.WithEncryption(dhcp4server.KeyFromFile(*leaseKeyFile)))
+		}
+		leases, err := dhcp4server.OpenFileLeases(*leaseFile, sn, lopts...)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts = append(opts, dhcp4server.WithLeases(leases))
+	}
+	if *historyFile != "" {
+		var key dhcp4server.KeyFunc
+		if *leaseKeyFile != "" {
+			key = dhcp4server.KeyFromFile(*leaseKeyFile)
+		}
+		history, err := dhcp4server.OpenFileHistory(*historyFile, *historyRetention, key)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer history.Close()
+		opts = append(opts, dhcp4server.WithHistory(history))
+	}
+	if *chaosDrop != 0 || *chaosDelay != 0 || *chaosCorrupt != 0 {
+		if !*unsafeChaos {
+			log.Fatal("-chaos flags require -unsafe-chaos")
+		}
+		logger.Printf("UNSAFE: injecting faults into responses")
+		opts = append(opts, dhcp4server.WithUnsafeChaos(dhcp4server.Chaos{
+			Drop:     *chaosDrop,
+			Delay:    *chaosDelay,
+			MaxDelay: *chaosMaxDelay,
+			Corrupt:  *chaosCorrupt,
+		}))
+	}
+	opts = append(opts, dhcp4server.WithRecoveryHandler(func(e dhcp4server.RecoveryEvent) {
+		if e.ReopenErr != nil {
+			logger.Printf("Could not reopen udp port 67 after %v: %v", e.Err, e.ReopenErr)
+		} else {
+			logger.Printf("Reopened udp port 67 after %v", e.Err)
+		}
+	}))
+	var s *dhcp4server.Server
+	if cfg != nil {
+		if s, err = dhcp4server.NewFromConfig(net.ParseIP(*self), cfg, opts...); err != nil {
+			log.Fatalf("%s: %v", *config, err)
+		}
+	} else {
+		s = dhcp4server.New(net.ParseIP(*self), sn, "", *bootFile, opts...)
+	}
 
-	// This should be an "infinite loop".
-	if err := s.Serve(logger, l); err != nil {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sig
+		cancel()
+	}()
+
+	go s.History().RunCompaction(ctx, logger, time.Hour)
+	go dumpStateOnSignal(logger, s)
+
+	for _, start := range startHooks {
+		start()
+	}
+
+	if *admin != "" {
+		go func() {
+			log.Fatalf("Admin API failed: %v", http.ListenAndServe(*admin, s.AdminHandler()))
+		}()
+	}
+
+	if *selfTest {
+		if err := s.SelfTest(ctx); err != nil {
+			log.Fatal(err)
+		}
+		logger.Printf("Self-test passed")
+	}
+
+	// This serves until SIGINT or SIGTERM.
+	listen := func() ([]net.PacketConn, error) {
+		return dhcp4server.ListenReusePort(":67", *sockets)
+	}
+	if err := s.ServeRecoveringConns(ctx, logger, listen); err != nil && ctx.Err() == nil {
 		log.Fatalf("Serve DHCP failed: %v", err)
 	}
 }
+
+// dumpStateOnSignal writes the runtime state of s to -state-file or logger
+// every time the process receives SIGUSR1, to debug a live server.
+func dumpStateOnSignal(logger *log.Logger, s *dhcp4server.Server) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGUSR1)
+	for range sig {
+		var b bytes.Buffer
+		if err := s.WriteState(&b); err != nil {
+			logger.Printf("Could not dump state: %v", err)
+			continue
+		}
+		if *stateFile == "" {
+			logger.Printf("State:\n%s", b.Bytes())
+			continue
+		}
+		if err := ioutil.WriteFile(*stateFile, b.Bytes(), 0600); err != nil {
+			logger.Printf("Could not dump state: %v", err)
+			continue
+		}
+		logger.Printf("Dumped state to %s", *stateFile)
+	}
+}
+
+// check validates the config file at path, prints any problems and returns
+// the exit code.
+func check(path string) int {
+	c, err := readConfig(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := c.Validate(); err != nil {
+		ce, ok := err.(*dhcp4server.ConfigError)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			return 1
+		}
+		for _, err := range ce.Errors {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+		}
+		return 1
+	}
+	fmt.Printf("%s: OK\n", path)
+	return 0
+}
+
+// readConfig reads the JSON config file at path.
+func readConfig(path string) (*dhcp4server.Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	c, err := dhcp4server.ReadConfig(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return c, nil
+}
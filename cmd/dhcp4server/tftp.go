@@ -0,0 +1,40 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build tftp
+// +build tftp
+
+package main
+
+import (
+	"flag"
+	"log"
+	"net"
+	"os"
+
+	"github.com/mergetb/dhcp4/tftpserver"
+)
+
+var tftpRoot = flag.String("tftp-root", "", "Directory to serve read-only over TFTP on port 69 (disabled if empty)")
+
+func init() {
+	startHooks = append(startHooks, startTFTP)
+}
+
+func startTFTP() {
+	if *tftpRoot == "" {
+		return
+	}
+
+	conn, err := net.ListenPacket("udp4", ":69")
+	if err != nil {
+		log.Fatalf("Could not listen on udp port 69: %v", err)
+	}
+
+	s := tftpserver.NewDir(*tftpRoot)
+	s.Logger = log.New(os.Stdout, "", log.LstdFlags)
+	go func() {
+		log.Fatalf("Serve TFTP failed: %v", s.Serve(conn))
+	}()
+}
@@ -0,0 +1,75 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4
+
+// Encoder writes packets in a wire encoding.
+type Encoder interface {
+	// Encode returns the encoding of p according to mo.
+	Encode(p *Packet, mo MarshalOptions) ([]byte, error)
+}
+
+// Decoder reads packets from a wire encoding.
+type Decoder interface {
+	// Decode returns the packet encoded in b.
+	Decode(b []byte) (*Packet, error)
+}
+
+// AppendEncoder is an Encoder that can append encodings to a buffer, which
+// saves allocating one for every packet.
+type AppendEncoder interface {
+	// AppendEncode appends the encoding of p according to mo to b and
+	// returns the extended buffer.
+	AppendEncode(b []byte, p *Packet, mo MarshalOptions) ([]byte, error)
+}
+
+// Codec is an Encoder and a Decoder.
+//
+// Clients and servers use WireCodec unless configured otherwise. Tests and
+// analysis tools can plug in their own codecs, e.g. ones wrapping WireCodec
+// to record what was encoded or to produce edge-case encodings.
+type Codec interface {
+	Encoder
+	Decoder
+}
+
+// WireCodec is the Codec of the wire format of RFC 2131, implemented by
+// MarshalOptions.Marshal and ParsePacket. It is an AppendEncoder too.
+var WireCodec Codec = wireCodec{}
+
+type wireCodec struct{}
+
+// Encode implements Encoder.
+func (wireCodec) Encode(p *Packet, mo MarshalOptions) ([]byte, error) {
+	return mo.Marshal(p)
+}
+
+// AppendEncode implements AppendEncoder.
+func (wireCodec) AppendEncode(b []byte, p *Packet, mo MarshalOptions) ([]byte, error) {
+	return mo.Append(b, p)
+}
+
+// Decode implements Decoder.
+func (wireCodec) Decode(b []byte) (*Packet, error) {
+	return ParsePacket(b)
+}
+
+// LenientCodec is WireCodec, but decodes packets with
+// UnmarshalOptions.Lenient set. Clients and servers configured with it
+// accept packets whose last option is cut short or that carry garbage after
+// the End option.
+var LenientCodec Codec = lenientCodec{}
+
+type lenientCodec struct {
+	wireCodec
+}
+
+// Decode implements Decoder.
+func (lenientCodec) Decode(b []byte) (*Packet, error) {
+	p := new(Packet)
+	if err := (UnmarshalOptions{Lenient: true}).Unmarshal(p, b); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
@@ -0,0 +1,52 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestWireCodec(t *testing.T) {
+	shared := EncodeOptions(Options{OptionServerIdentifier: []byte{192, 168, 0, 1}})
+
+	p := NewPacket(BootReply)
+	p.TransactionID = [4]byte{1, 2, 3, 4}
+	p.YIAddr = net.IP{192, 168, 0, 10}
+	p.CHAddr = net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0, 1}
+	p.Options.SetMessageType(DHCPOffer)
+
+	for _, mo := range []MarshalOptions{{}, {Shared: shared}} {
+		b, err := WireCodec.Encode(p, mo)
+		if err != nil {
+			t.Fatalf("Encode(%v) = %v", mo, err)
+		}
+		want, err := mo.Marshal(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, want) {
+			t.Errorf("Encode(%v) differs from Marshal", mo)
+		}
+
+		got, err := WireCodec.Decode(b)
+		if err != nil {
+			t.Fatalf("Decode() = %v", err)
+		}
+		wantP, err := ParsePacket(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, wantP) {
+			t.Errorf("Decode() = %v, want %v", got, wantP)
+		}
+	}
+
+	if _, err := WireCodec.Decode([]byte{1, 2, 3}); err == nil {
+		t.Errorf("Decode(short packet) = nil, want error")
+	}
+}
@@ -4,6 +4,8 @@
 
 package dhcp4
 
+import "fmt"
+
 // OpCode is the BOOTP message type as defined by RFC 2131, Section 2.
 //
 // Note that the DHCP message type is embedded via OptionDHCPMessageType.
@@ -15,6 +17,91 @@ const (
 	BootReply   OpCode = 2
 )
 
+// String implements fmt.Stringer.
+func (o OpCode) String() string {
+	switch o {
+	case BootRequest:
+		return "BOOTREQUEST"
+	case BootReply:
+		return "BOOTREPLY"
+	default:
+		return fmt.Sprintf("OpCode(%d)", uint8(o))
+	}
+}
+
+// MessageType is the DHCP message type carried by OptionDHCPMessageType, as
+// defined by RFC 2132, Section 9.6.
+type MessageType uint8
+
+// Legal values of DHCP message types as per RFC 2132, Section 9.6.
+const (
+	DHCPDiscover MessageType = 1
+	DHCPOffer    MessageType = 2
+	DHCPRequest  MessageType = 3
+	DHCPDecline  MessageType = 4
+	DHCPACK      MessageType = 5
+	DHCPNAK      MessageType = 6
+	DHCPRelease  MessageType = 7
+	DHCPInform   MessageType = 8
+
+	// DHCPForceRenew is defined by RFC 3203.
+	DHCPForceRenew MessageType = 9
+
+	// Leasequery message types as defined by RFC 4388.
+	DHCPLeaseQuery      MessageType = 10
+	DHCPLeaseUnassigned MessageType = 11
+	DHCPLeaseUnknown    MessageType = 12
+	DHCPLeaseActive     MessageType = 13
+)
+
+// String implements fmt.Stringer.
+func (t MessageType) String() string {
+	switch t {
+	case DHCPDiscover:
+		return "DHCPDISCOVER"
+	case DHCPOffer:
+		return "DHCPOFFER"
+	case DHCPRequest:
+		return "DHCPREQUEST"
+	case DHCPDecline:
+		return "DHCPDECLINE"
+	case DHCPACK:
+		return "DHCPACK"
+	case DHCPNAK:
+		return "DHCPNAK"
+	case DHCPRelease:
+		return "DHCPRELEASE"
+	case DHCPInform:
+		return "DHCPINFORM"
+	case DHCPForceRenew:
+		return "DHCPFORCERENEW"
+	case DHCPLeaseQuery:
+		return "DHCPLEASEQUERY"
+	case DHCPLeaseUnassigned:
+		return "DHCPLEASEUNASSIGNED"
+	case DHCPLeaseUnknown:
+		return "DHCPLEASEUNKNOWN"
+	case DHCPLeaseActive:
+		return "DHCPLEASEACTIVE"
+	default:
+		return fmt.Sprintf("MessageType(%d)", uint8(t))
+	}
+}
+
+// MarshalBinary marshals the DHCP message type option to binary.
+func (t MessageType) MarshalBinary() ([]byte, error) {
+	return []byte{byte(t)}, nil
+}
+
+// UnmarshalBinary unmarshals the DHCP message type option from binary.
+func (t *MessageType) UnmarshalBinary(p []byte) error {
+	if len(p) != 1 {
+		return ErrInvalidOptions
+	}
+	*t = MessageType(p[0])
+	return nil
+}
+
 // OptionCode is a DHCP option code as defined by RFC 2132.
 type OptionCode uint8
 
@@ -87,4 +174,135 @@ const (
 	OptionClientIdentifier       OptionCode = 61
 	OptionTFTPServerName         OptionCode = 66
 	OptionBootFileName           OptionCode = 67
+
+	// User class option as defined by RFC 3004.
+	OptionUserClass OptionCode = 77
+
+	// PXE client options as defined by RFC 4578.
+	OptionClientSystemArchitecture         OptionCode = 93
+	OptionClientNetworkInterfaceIdentifier OptionCode = 94
+	OptionClientMachineIdentifier          OptionCode = 97
+
+	// Rapid commit option as defined by RFC 4039.
+	OptionRapidCommit OptionCode = 80
+
+	// Client FQDN option as defined by RFC 4702.
+	OptionClientFQDN OptionCode = 81
+
+	// Relay agent information option as defined by RFC 3046.
+	OptionRelayAgentInformation OptionCode = 82
+
+	// Authentication option as defined by RFC 3118.
+	OptionAuthentication OptionCode = 90
+
+	// Leasequery options as defined by RFC 4388.
+	OptionClientLastTransactionTime OptionCode = 91
+	OptionAssociatedIP              OptionCode = 92
+
+	// Domain search option as defined by RFC 3397.
+	OptionDomainSearch OptionCode = 119
+
+	// Classless static route option as defined by RFC 3442.
+	OptionClasslessStaticRoute OptionCode = 121
+
+	// Vendor-identifying vendor options as defined by RFC 3925.
+	OptionVIVendorClass               OptionCode = 124
+	OptionVIVendorSpecificInformation OptionCode = 125
+
+	// iPXE encapsulated options, a site-specific option used by iPXE.
+	OptionIPXEEncapsulated OptionCode = 175
 )
+
+// optionNames are the names of the option codes above, as used by RFC 2132
+// and the RFCs that define later options.
+var optionNames = map[OptionCode]string{
+	End:                                              "End",
+	Pad:                                              "Pad",
+	OptionSubnetMask:                                 "Subnet Mask",
+	OptionTimeOffset:                                 "Time Offset",
+	OptionRouters:                                    "Router",
+	OptionTimeServers:                                "Time Server",
+	OptionNameServers:                                "Name Server",
+	OptionDomainNameServers:                          "Domain Name Server",
+	OptionLogServers:                                 "Log Server",
+	OptionCookieServers:                              "Cookie Server",
+	OptionLPRServers:                                 "LPR Server",
+	OptionImpressServers:                             "Impress Server",
+	OptionResourceLocationServers:                    "Resource Location Server",
+	OptionHostName:                                   "Host Name",
+	OptionBootFileSize:                               "Boot File Size",
+	OptionMeritDumpFile:                              "Merit Dump File",
+	OptionDomainName:                                 "Domain Name",
+	OptionSwapServer:                                 "Swap Server",
+	OptionRootPath:                                   "Root Path",
+	OptionExtensionsPath:                             "Extensions Path",
+	OptionIPForwardingEnableDisable:                  "IP Forwarding",
+	OptionNonLocalSourceRoutingEnableDisable:         "Non-Local Source Routing",
+	OptionPolicyFilter:                               "Policy Filter",
+	OptionMaximumDatagramReassemblySize:              "Maximum Datagram Reassembly Size",
+	OptionDefaultIPTimeToLive:                        "Default IP Time-to-live",
+	OptionPathMTUAgingTimeout:                        "Path MTU Aging Timeout",
+	OptionPathMTUPlateauTable:                        "Path MTU Plateau Table",
+	OptionInterfaceMTU:                               "Interface MTU",
+	OptionAllSubnetsAreLocal:                         "All Subnets Are Local",
+	OptionBroadcastAddress:                           "Broadcast Address",
+	OptionPerformMaskDiscovery:                       "Perform Mask Discovery",
+	OptionMaskSupplier:                               "Mask Supplier",
+	OptionPerformRouterDiscovery:                     "Perform Router Discovery",
+	OptionRouterSolicitationAddress:                  "Router Solicitation Address",
+	OptionStaticRoute:                                "Static Route",
+	OptionTrailerEncapsulation:                       "Trailer Encapsulation",
+	OptionARPCacheTimeout:                            "ARP Cache Timeout",
+	OptionEthernetEncapsulation:                      "Ethernet Encapsulation",
+	OptionTCPDefaultTTL:                              "TCP Default TTL",
+	OptionTCPKeepaliveInterval:                       "TCP Keepalive Interval",
+	OptionTCPKeepaliveGarbage:                        "TCP Keepalive Garbage",
+	OptionNetworkInformationServiceDomain:            "NIS Domain",
+	OptionNetworkInformationServers:                  "NIS Servers",
+	OptionNetworkTimeProtocolServers:                 "NTP Servers",
+	OptionVendorSpecificInformation:                  "Vendor-Specific Information",
+	OptionNetBIOSOverTCPIPNameServer:                 "NetBIOS over TCP/IP Name Server",
+	OptionNetBIOSOverTCPIPDatagramDistributionServer: "NetBIOS over TCP/IP Datagram Distribution Server",
+	OptionNetBIOSOverTCPIPNodeType:                   "NetBIOS over TCP/IP Node Type",
+	OptionNetBIOSOverTCPIPScope:                      "NetBIOS over TCP/IP Scope",
+	OptionXWindowSystemFontServer:                    "X Window System Font Server",
+	OptionXWindowSystemDisplayManager:                "X Window System Display Manager",
+	OptionRequestedIPAddress:                         "Requested IP Address",
+	OptionIPAddressLeaseTime:                         "IP Address Lease Time",
+	OptionOverload:                                   "Option Overload",
+	OptionDHCPMessageType:                            "DHCP Message Type",
+	OptionServerIdentifier:                           "Server Identifier",
+	OptionParameterRequestList:                       "Parameter Request List",
+	OptionMessage:                                    "Message",
+	OptionMaximumDHCPMessageSize:                     "Maximum DHCP Message Size",
+	OptionRenewalTimeValue:                           "Renewal Time",
+	OptionRebindingTimeValue:                         "Rebinding Time",
+	OptionVendorClassIdentifier:                      "Vendor Class Identifier",
+	OptionClientIdentifier:                           "Client Identifier",
+	OptionTFTPServerName:                             "TFTP Server Name",
+	OptionBootFileName:                               "Bootfile Name",
+	OptionUserClass:                                  "User Class",
+	OptionClientSystemArchitecture:                   "Client System Architecture",
+	OptionClientNetworkInterfaceIdentifier:           "Client Network Interface Identifier",
+	OptionClientMachineIdentifier:                    "Client Machine Identifier",
+	OptionRapidCommit:                                "Rapid Commit",
+	OptionClientFQDN:                                 "Client FQDN",
+	OptionRelayAgentInformation:                      "Relay Agent Information",
+	OptionAuthentication:                             "Authentication",
+	OptionClientLastTransactionTime:                  "Client Last Transaction Time",
+	OptionAssociatedIP:                               "Associated IP",
+	OptionDomainSearch:                               "Domain Search",
+	OptionClasslessStaticRoute:                       "Classless Static Route",
+	OptionVIVendorClass:                              "V-I Vendor Class",
+	OptionVIVendorSpecificInformation:                "V-I Vendor-Specific Information",
+	OptionIPXEEncapsulated:                           "iPXE Encapsulated Options",
+}
+
+// String implements fmt.Stringer. It returns the name of the option, or
+// "OptionCode(n)" if it is unknown.
+func (o OptionCode) String() string {
+	if name, ok := optionNames[o]; ok {
+		return name
+	}
+	return fmt.Sprintf("OptionCode(%d)", uint8(o))
+}
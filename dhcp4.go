@@ -8,6 +8,7 @@ package dhcp4
 
 import (
 	"errors"
+	"io"
 )
 
 var (
@@ -23,4 +24,34 @@ var (
 	// ErrOptionNotPresent is returned when a requested opcode is not in
 	// the packet.
 	ErrOptionNotPresent = errors.New("option code not present in packet")
+
+	// ErrMissingEnd is returned when options data is not terminated by
+	// an End option. It matches io.ErrUnexpectedEOF with errors.Is, the
+	// error returned for such data before.
+	ErrMissingEnd error = missingEndError{}
+
+	// ErrTruncatedOption is reported by Packet.Validate for packets
+	// unmarshaled leniently whose last option was cut short.
+	ErrTruncatedOption = errors.New("last option truncated")
+
+	// ErrTooLarge is returned by MarshalOptions.Marshal when the options
+	// do not fit into MaxSize, even with option overload.
+	ErrTooLarge = errors.New("options do not fit into maximum packet size")
+
+	// ErrHopLimit is returned by RelayRequest for requests that were
+	// already relayed MaxHops times.
+	ErrHopLimit = errors.New("request exceeded the relay hop limit")
 )
+
+// missingEndError is the type of ErrMissingEnd.
+type missingEndError struct{}
+
+// Error implements error.
+func (missingEndError) Error() string {
+	return "options not terminated by End option"
+}
+
+// Unwrap returns io.ErrUnexpectedEOF.
+func (missingEndError) Unwrap() error {
+	return io.ErrUnexpectedEOF
+}
@@ -0,0 +1,22 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import "context"
+
+// Acquire requests a lease on the interface named iface. On Linux, the
+// interface is brought up first if it is down; elsewhere it must be up.
+//
+// It is a shortcut for New, RequestLease and Close with the connection of
+// NewPacketUDPConn and default settings, which opts can override. The lease
+// is not configured on the interface; see AcquireAndConfigure on Linux.
+func Acquire(ctx context.Context, iface string, opts ...ClientOpt) (*Lease, error) {
+	c, err := newLinkClient(iface, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	return c.RequestLease(ctx)
+}
@@ -0,0 +1,180 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+	"github.com/vishvananda/netlink"
+)
+
+// newLinkClient returns a client on the interface named iface, bringing the
+// interface up first if it is down.
+func newLinkClient(iface string, opts ...ClientOpt) (*Client, error) {
+	link, err := netlink.LinkByName(iface)
+	if err != nil {
+		return nil, err
+	}
+	if link.Attrs().Flags&net.FlagUp == 0 {
+		if err := netlink.LinkSetUp(link); err != nil {
+			return nil, fmt.Errorf("bring up %s: %v", iface, err)
+		}
+	}
+	return New(link, opts...)
+}
+
+// AcquireAndConfigure requests a lease on the interface named iface like
+// Acquire and configures the interface with it, see Configure.
+//
+// The lease's TimeToLease includes configuring the interface, and is
+// reported to the Metrics configured by opts only if configuring succeeded.
+func AcquireAndConfigure(ctx context.Context, iface string, opts ...ClientOpt) (*Lease, error) {
+	c, err := newLinkClient(iface, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	lease, err := c.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	if err := Configure(iface, lease); err != nil {
+		return lease, err
+	}
+	lease.TimeToLease += time.Since(start)
+	c.metrics.TimeToLease(lease.TimeToLease)
+	return lease, nil
+}
+
+// netConfig is the interface configuration a lease calls for.
+type netConfig struct {
+	addr *netlink.Addr
+
+	// routes lists routes on the link before routes through routers,
+	// which may depend on them.
+	routes []dhcp4.Route
+
+	mtu int
+}
+
+// newNetConfig returns the configuration of lease at now.
+func newNetConfig(lease *Lease, now time.Time) netConfig {
+	mask := lease.Options.SubnetMask()
+	if mask == nil {
+		mask = lease.IP.DefaultMask()
+	}
+	nc := netConfig{
+		addr: &netlink.Addr{
+			IPNet: &net.IPNet{IP: lease.IP.To4(), Mask: mask},
+		},
+	}
+	if exp := lease.Expiry(); !exp.IsZero() {
+		// The kernel removes the address when the lease expires
+		// unless Configure is called again after a renewal.
+		left := int(exp.Sub(now) / time.Second)
+		if left < 1 {
+			left = 1
+		}
+		nc.addr.ValidLft = left
+		nc.addr.PreferedLft = left
+	}
+	// RFC 3442 Section 2: classless routes replace routers.
+	if routes := lease.Options.ClasslessStaticRoutes(); routes != nil {
+		for _, r := range routes {
+			if r.Router.IsUnspecified() {
+				nc.routes = append(nc.routes, r)
+			}
+		}
+		for _, r := range routes {
+			if !r.Router.IsUnspecified() {
+				nc.routes = append(nc.routes, r)
+			}
+		}
+	} else if routers := lease.Options.Routers(); len(routers) > 0 {
+		nc.routes = []dhcp4.Route{{
+			Dest:   &net.IPNet{IP: net.IPv4zero.To4(), Mask: net.CIDRMask(0, 32)},
+			Router: routers[0],
+		}}
+	}
+	// RFC 1122 Section 3.3.2: no link may have an MTU below 68.
+	if mtu := int(lease.Options.InterfaceMTU()); mtu >= 68 {
+		nc.mtu = mtu
+	}
+	return nc
+}
+
+// Configure configures the interface named iface with lease: the leased
+// address with the subnet mask sent by the server, the classless static
+// routes or else the default route through the first router, and the
+// interface MTU, if sent.
+//
+// The address expires with the lease; call Configure again after renewing
+// it, and Unconfigure to remove it. Name servers and other options are
+// left to the caller; package configure also writes /etc/resolv.conf.
+func Configure(iface string, lease *Lease) error {
+	link, err := netlink.LinkByName(iface)
+	if err != nil {
+		return err
+	}
+	nc := newNetConfig(lease, time.Now())
+
+	if nc.mtu != 0 && nc.mtu != link.Attrs().MTU {
+		if err := netlink.LinkSetMTU(link, nc.mtu); err != nil {
+			return fmt.Errorf("set MTU of %s to %d: %v", iface, nc.mtu, err)
+		}
+	}
+	if err := netlink.AddrReplace(link, nc.addr); err != nil {
+		return fmt.Errorf("add %v to %s: %v", nc.addr.IPNet, iface, err)
+	}
+	for _, r := range nc.routes {
+		if err := netlink.RouteReplace(netRoute(link, r)); err != nil {
+			return fmt.Errorf("add route %v on %s: %v", r, iface, err)
+		}
+	}
+	return nil
+}
+
+// Unconfigure removes the configuration of lease from the interface named
+// iface, undoing Configure: the routes are deleted, and then the leased
+// address. Routes and addresses already gone are skipped. The interface
+// MTU is left alone.
+func Unconfigure(iface string, lease *Lease) error {
+	link, err := netlink.LinkByName(iface)
+	if err != nil {
+		return err
+	}
+	nc := newNetConfig(lease, time.Now())
+
+	for i := len(nc.routes) - 1; i >= 0; i-- {
+		r := nc.routes[i]
+		if err := netlink.RouteDel(netRoute(link, r)); err != nil && err != syscall.ESRCH {
+			return fmt.Errorf("delete route %v on %s: %v", r, iface, err)
+		}
+	}
+	if err := netlink.AddrDel(link, nc.addr); err != nil && err != syscall.EADDRNOTAVAIL {
+		return fmt.Errorf("delete %v from %s: %v", nc.addr.IPNet, iface, err)
+	}
+	return nil
+}
+
+// netRoute returns the netlink route for r on link.
+func netRoute(link netlink.Link, r dhcp4.Route) *netlink.Route {
+	route := &netlink.Route{
+		LinkIndex: link.Attrs().Index,
+		Dst:       r.Dest,
+	}
+	if r.Router.IsUnspecified() {
+		route.Scope = netlink.SCOPE_LINK
+	} else {
+		route.Gw = r.Router
+	}
+	return route
+}
@@ -0,0 +1,127 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+	"github.com/vishvananda/netlink"
+)
+
+func TestNewNetConfig(t *testing.T) {
+	now := time.Now()
+	for _, tt := range []struct {
+		desc   string
+		opts   dhcp4.Options
+		d      time.Duration
+		addr   string
+		lft    int
+		routes string
+		mtu    int
+	}{
+		{
+			desc: "no options",
+			addr: "10.0.0.10/8",
+		},
+		{
+			desc: "mask, routers, MTU and lease time",
+			opts: dhcp4.Options{
+				dhcp4.OptionSubnetMask:   {255, 255, 255, 0},
+				dhcp4.OptionRouters:      {10, 0, 0, 1, 10, 0, 0, 2},
+				dhcp4.OptionInterfaceMTU: {0x23, 0x28},
+			},
+			d:      time.Hour,
+			addr:   "10.0.0.10/24",
+			lft:    3600,
+			routes: "[0.0.0.0/0 via 10.0.0.1]",
+			mtu:    9000,
+		},
+		{
+			desc: "classless routes replace routers",
+			opts: dhcp4.Options{
+				dhcp4.OptionRouters:              {10, 0, 0, 1},
+				dhcp4.OptionClasslessStaticRoute: {0, 10, 0, 0, 2, 16, 172, 16, 0, 0, 0, 0},
+			},
+			addr:   "10.0.0.10/8",
+			routes: "[172.16.0.0/16 via 0.0.0.0 0.0.0.0/0 via 10.0.0.2]",
+		},
+		{
+			desc: "MTU below minimum",
+			opts: dhcp4.Options{
+				dhcp4.OptionInterfaceMTU: {0, 67},
+			},
+			addr: "10.0.0.10/8",
+		},
+	} {
+		lease := &Lease{
+			IP:       net.IP{10, 0, 0, 10},
+			Start:    now,
+			Duration: tt.d,
+			Options:  tt.opts,
+		}
+		nc := newNetConfig(lease, now)
+		if got := nc.addr.IPNet.String(); got != tt.addr || nc.addr.ValidLft != tt.lft || nc.addr.PreferedLft != tt.lft {
+			t.Errorf("%s: address %v valid for %ds, want %v for %ds", tt.desc, got, nc.addr.ValidLft, tt.addr, tt.lft)
+		}
+		if tt.routes == "" {
+			tt.routes = "[]"
+		}
+		if got := fmt.Sprint(nc.routes); got != tt.routes {
+			t.Errorf("%s: routes %v, want %v", tt.desc, got, tt.routes)
+		}
+		if nc.mtu != tt.mtu {
+			t.Errorf("%s: MTU %d, want %d", tt.desc, nc.mtu, tt.mtu)
+		}
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	link := addPort(t, "dhcptest-conf")
+	defer netlink.LinkDel(link)
+	if err := netlink.LinkSetUp(link); err != nil {
+		t.Fatal(err)
+	}
+
+	lease := &Lease{
+		IP:       net.IP{192, 0, 2, 10},
+		Start:    time.Now(),
+		Duration: time.Hour,
+		Options: dhcp4.Options{
+			dhcp4.OptionSubnetMask:   {255, 255, 255, 0},
+			dhcp4.OptionRouters:      {192, 0, 2, 1},
+			dhcp4.OptionInterfaceMTU: {0x05, 0x78},
+		},
+	}
+	if err := Configure(link.Attrs().Name, lease); err != nil {
+		t.Fatalf("Configure() = %v", err)
+	}
+
+	addrs, err := netlink.AddrList(link, netlink.FAMILY_V4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 1 || addrs[0].IPNet.String() != "192.0.2.10/24" {
+		t.Errorf("addresses %v, want 192.0.2.10/24", addrs)
+	}
+	if l, err := netlink.LinkByIndex(link.Attrs().Index); err != nil || l.Attrs().MTU != 1400 {
+		t.Errorf("MTU not set to 1400: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := Unconfigure(link.Attrs().Name, lease); err != nil {
+			t.Fatalf("#%d: Unconfigure() = %v", i, err)
+		}
+	}
+	if addrs, err := netlink.AddrList(link, netlink.FAMILY_V4); err != nil || len(addrs) != 0 {
+		t.Errorf("addresses after Unconfigure %v, %v, want none", addrs, err)
+	}
+	if routes, err := netlink.RouteList(link, netlink.FAMILY_V4); err != nil || len(routes) != 0 {
+		t.Errorf("routes after Unconfigure %v, %v, want none", routes, err)
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/mdlayher/ethernet"
+	"github.com/mdlayher/raw"
+)
+
+// ARP operations and sizes for Ethernet and IPv4, as defined by RFC 826.
+const (
+	arpRequest = 1
+	arpReply   = 2
+
+	arpLen = 28
+)
+
+// ARPProber is an AddressProber sending ARP probes as described by RFC 5227
+// Section 2.1.1: requests for the address from the unspecified address, so
+// that hosts answer without learning the client's mapping.
+//
+// A host is using the address if it answers a probe, announces the address
+// or probes for it too.
+type ARPProber struct {
+	// Interface is the name of the interface to probe on.
+	Interface string
+
+	// Probes is the number of probes sent, and Interval the time between
+	// them and after the last before the address is assumed to be free.
+	// Zero values default to 3 probes 1 second apart, the PROBE_NUM and
+	// PROBE_MAX of RFC 5227.
+	Probes   int
+	Interval time.Duration
+}
+
+// Probe implements AddressProber.
+func (ap *ARPProber) Probe(ctx context.Context, ip net.IP) (net.HardwareAddr, error) {
+	if ip.To4() == nil {
+		return nil, fmt.Errorf("%v is not an IPv4 address", ip)
+	}
+	ip = ip.To4()
+	ifc, err := net.InterfaceByName(ap.Interface)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := raw.ListenPacket(ifc, uint16(ethernet.EtherTypeARP), &raw.Config{LinuxSockDGRAM: true})
+	if err != nil {
+		return nil, permissionErr(fmt.Sprintf("open ARP socket on %s", ap.Interface), CapNetRaw, err)
+	}
+	defer conn.Close()
+
+	probes, interval := ap.Probes, ap.Interval
+	if probes <= 0 {
+		probes = 3
+	}
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	probe := arpProbe(ifc.HardwareAddr, ip)
+	b := make([]byte, 1500)
+	for i := 0; i < probes; i++ {
+		if _, err := conn.WriteTo(probe, &raw.Addr{HardwareAddr: BroadcastMac}); err != nil {
+			return nil, err
+		}
+		deadline := time.Now().Add(interval)
+		for time.Now().Before(deadline) {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			// Check ctx every once in a while.
+			d := time.Now().Add(100 * time.Millisecond)
+			if d.After(deadline) {
+				d = deadline
+			}
+			conn.SetReadDeadline(d)
+			n, _, err := conn.ReadFrom(b)
+			if oerr, ok := err.(net.Error); ok && oerr.Timeout() {
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+			if hw := arpConflict(b[:n], ifc.HardwareAddr, ip); hw != nil {
+				return hw, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// arpProbe returns an ARP probe from hw for ip.
+func arpProbe(hw net.HardwareAddr, ip net.IP) []byte {
+	b := make([]byte, arpLen)
+	binary.BigEndian.PutUint16(b[0:2], 1) // Ethernet
+	binary.BigEndian.PutUint16(b[2:4], uint16(ethernet.EtherTypeIPv4))
+	b[4], b[5] = 6, 4
+	binary.BigEndian.PutUint16(b[6:8], arpRequest)
+	copy(b[8:14], hw)
+	// The sender protocol address stays unspecified, and so does the
+	// target hardware address.
+	copy(b[24:28], ip.To4())
+	return b
+}
+
+// arpConflict returns the sender hardware address of the ARP packet b if it
+// shows that a host other than hw uses or probes for ip, see RFC 5227
+// Section 2.1.1.
+func arpConflict(b []byte, hw net.HardwareAddr, ip net.IP) net.HardwareAddr {
+	if len(b) < arpLen || b[4] != 6 || b[5] != 4 ||
+		binary.BigEndian.Uint16(b[2:4]) != uint16(ethernet.EtherTypeIPv4) {
+		return nil
+	}
+	op := binary.BigEndian.Uint16(b[6:8])
+	sha, spa, tpa := net.HardwareAddr(b[8:14]), net.IP(b[14:18]), net.IP(b[24:28])
+	if (op != arpRequest && op != arpReply) || bytes.Equal(sha, hw) {
+		return nil
+	}
+	if spa.Equal(ip) || (op == arpRequest && spa.Equal(net.IPv4zero) && tpa.Equal(ip)) {
+		return append(net.HardwareAddr(nil), sha...)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+func TestARPConflict(t *testing.T) {
+	ip := net.IP{192, 168, 1, 10}
+	self := net.HardwareAddr{0x02, 0, 0, 0, 0, 1}
+	other := net.HardwareAddr{0x02, 0, 0, 0, 0, 2}
+
+	// arp returns an ARP packet of op from sha and spa for tpa.
+	arp := func(op uint16, sha net.HardwareAddr, spa, tpa net.IP) []byte {
+		b := arpProbe(sha, tpa)
+		binary.BigEndian.PutUint16(b[6:8], op)
+		copy(b[14:18], spa.To4())
+		return b
+	}
+
+	for _, tt := range []struct {
+		desc string
+		pkt  []byte
+		want net.HardwareAddr
+	}{
+		{
+			desc: "reply",
+			pkt:  arp(arpReply, other, ip, net.IPv4zero),
+			want: other,
+		},
+		{
+			desc: "announcement",
+			pkt:  arp(arpRequest, other, ip, ip),
+			want: other,
+		},
+		{
+			desc: "probe by other host",
+			pkt:  arp(arpRequest, other, net.IPv4zero, ip),
+			want: other,
+		},
+		{
+			desc: "own probe",
+			pkt:  arpProbe(self, ip),
+		},
+		{
+			desc: "other address",
+			pkt:  arp(arpReply, other, net.IP{192, 168, 1, 11}, net.IPv4zero),
+		},
+		{
+			desc: "request for other address",
+			pkt:  arp(arpRequest, other, net.IP{192, 168, 1, 11}, ip),
+		},
+		{
+			desc: "truncated",
+			pkt:  arp(arpReply, other, ip, net.IPv4zero)[:20],
+		},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			if got := arpConflict(tt.pkt, self, ip); got.String() != tt.want.String() {
+				t.Errorf("arpConflict() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+)
+
+// WithAuthentication makes the client use the delayed authentication of RFC
+// 3118, Section 5, with the secrets of keys, so that it rejects offers and
+// acknowledgements spoofed by hosts not knowing them.
+//
+// Discovers ask servers for delayed authentication, and the other messages
+// are signed with the secret with the ID. Responses are only accepted if
+// they are signed with a secret of keys and their replay detection value is
+// above the last one accepted from the same server.
+//
+// Default is no authentication.
+func WithAuthentication(keys dhcp4.KeyStore, id uint32) ClientOpt {
+	return func(c *Client) error {
+		if _, ok := keys.Key(id); !ok {
+			return fmt.Errorf("no secret with ID %d", id)
+		}
+		c.auth = &authenticator{
+			keys:     keys,
+			id:       id,
+			received: make(map[string]uint64),
+		}
+		return nil
+	}
+}
+
+// authenticator signs requests and verifies responses.
+type authenticator struct {
+	keys dhcp4.KeyStore
+	id   uint32
+
+	// mu protects sent and received.
+	mu sync.Mutex
+
+	// sent is the replay detection value of the last request, and
+	// received that of the last response accepted, by server
+	// identifier.
+	sent     uint64
+	received map[string]uint64
+}
+
+// options returns the options of p with an authentication option added.
+func (a *authenticator) options(p *dhcp4.Packet) dhcp4.Options {
+	o := make(dhcp4.Options, len(p.Options)+1)
+	for k, v := range p.Options {
+		o[k] = v
+	}
+
+	// The counter starts at the current time, so that it keeps
+	// increasing across restarts of the client.
+	a.mu.Lock()
+	replay := uint64(time.Now().UnixNano())
+	if replay <= a.sent {
+		replay = a.sent + 1
+	}
+	a.sent = replay
+	a.mu.Unlock()
+
+	if p.Options.MessageType() == dhcp4.DHCPDiscover {
+		o.SetAuthentication(&dhcp4.Authentication{
+			Protocol:        dhcp4.AuthDelayed,
+			Algorithm:       dhcp4.AuthHMACMD5,
+			RDM:             dhcp4.AuthRDMCounter,
+			ReplayDetection: replay,
+		})
+	} else {
+		o.SetAuthentication(dhcp4.NewDelayedAuthentication(a.id, replay))
+	}
+	return o
+}
+
+// verify returns why the response p, received as b, fails authentication,
+// or "" if it passes.
+func (a *authenticator) verify(b []byte, p *dhcp4.Packet) (RejectReason, error) {
+	auth, err := dhcp4.VerifyPacket(b, a.keys)
+	if err != nil {
+		return RejectAuthentication, err
+	}
+
+	server := string(p.Options.Get(dhcp4.OptionServerIdentifier))
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if last, ok := a.received[server]; ok && auth.RDM == dhcp4.AuthRDMCounter && auth.ReplayDetection <= last {
+		return RejectAuthentication, fmt.Errorf("replay detection value %d not above %d", auth.ReplayDetection, last)
+	}
+	a.received[server] = auth.ReplayDetection
+	return "", nil
+}
+
+// encode encodes p to be sent, authenticated if the client is configured
+// with WithAuthentication.
+func (c *Client) encode(p *dhcp4.Packet) ([]byte, error) {
+	if c.auth == nil {
+		return c.codec.Encode(p, c.marshalOptions())
+	}
+
+	q := *p
+	q.Options = c.auth.options(p)
+	b, err := c.codec.Encode(&q, c.marshalOptions())
+	if err != nil || q.Options.MessageType() == dhcp4.DHCPDiscover {
+		return b, err
+	}
+	if err := dhcp4.SignPacket(b, c.auth.keys); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
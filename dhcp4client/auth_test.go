@@ -0,0 +1,101 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+)
+
+func TestAuthentication(t *testing.T) {
+	keys := dhcp4.Keys{7: []byte("secret")}
+	if _, err := New(nil, WithConn(newMockUDPConn(nil, nil)), WithAuthentication(keys, 8)); err == nil {
+		t.Errorf("New with unknown secret ID succeeded")
+	}
+
+	in := make(chan udpPacket, 10)
+	out := make(chan udpPacket, 10)
+	c, err := New(nil, WithConn(newMockUDPConn(in, out)), WithRetry(1), WithTimeout(time.Second), WithAuthentication(keys, 7))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// Discovers ask for authentication without being signed.
+	b, err := c.encode(c.DiscoverPacket())
+	if err != nil {
+		t.Fatalf("encode(discover) = %v", err)
+	}
+	discover, err := dhcp4.ParsePacket(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a := discover.Options.Authentication(); a == nil || a.Protocol != dhcp4.AuthDelayed || len(a.Info) != 0 {
+		t.Errorf("discover authentication = %v, want delayed without information", a)
+	}
+
+	xid := [4]byte{1, 2, 3, 4}
+	request := newPacket(dhcp4.BootRequest, xid)
+	request.Options.SetMessageType(dhcp4.DHCPRequest)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	wg, responses, _ := c.SimpleSendAndRead(ctx, DefaultServers, request)
+
+	sent := <-out
+	if a, err := dhcp4.VerifyPacket(sent.payload, keys); err != nil {
+		t.Errorf("VerifyPacket(request) = %v", err)
+	} else if id, _ := a.SecretID(); id != 7 {
+		t.Errorf("request signed with secret %d, want 7", id)
+	}
+	if request.Options.Authentication() != nil {
+		t.Errorf("request given to SimpleSendAndRead was changed")
+	}
+
+	reply := func(key []byte, replay uint64) []byte {
+		p := newPacket(dhcp4.BootReply, xid)
+		p.Options.SetMessageType(dhcp4.DHCPACK)
+		p.Options.SetServerIdentifier(net.IP{192, 168, 0, 1})
+		if key != nil {
+			p.Options.SetAuthentication(dhcp4.NewDelayedAuthentication(7, replay))
+		}
+		b, err := p.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if key != nil {
+			if err := dhcp4.SignPacket(b, dhcp4.Keys{7: key}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return b
+	}
+	source := &net.UDPAddr{IP: net.IP{192, 168, 0, 1}, Port: ServerPort}
+	for _, b := range [][]byte{
+		reply(nil, 0),
+		reply([]byte("spoofed"), 1),
+		reply(keys[7], 2),
+		// Replayed.
+		reply(keys[7], 2),
+	} {
+		in <- udpPacket{source: source, payload: b}
+	}
+
+	var got []*dhcp4.Packet
+	for p := range responses {
+		got = append(got, p.Packet)
+	}
+	wg.Wait()
+	if len(got) != 1 {
+		t.Fatalf("got %d responses, want 1", len(got))
+	}
+	if a := got[0].Options.Authentication(); a == nil || a.ReplayDetection != 2 {
+		t.Errorf("accepted response with authentication %v, want replay detection 2", a)
+	}
+}
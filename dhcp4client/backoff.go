@@ -0,0 +1,85 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Backoff decides when the client retransmits a packet nobody answered.
+type Backoff interface {
+	// Timeout returns how long to wait for responses to transmission
+	// number attempt, counting from 0, before retransmitting. It returns
+	// false if the packet is not to be transmitted attempt+1 times.
+	Timeout(attempt int) (time.Duration, bool)
+}
+
+// ExponentialBackoff doubles the time waited for responses after every
+// transmission, as RFC 2131 Section 4.1 recommends.
+type ExponentialBackoff struct {
+	// Initial is the time waited after the first transmission.
+	Initial time.Duration
+
+	// Max caps the time waited; it is not capped if zero.
+	Max time.Duration
+
+	// Attempts is the number of transmissions; if negative, the client
+	// retransmits until the context is done.
+	Attempts int
+
+	// Jitter randomizes each time waited by up to Jitter either way, so
+	// that clients started together do not retransmit together.
+	Jitter time.Duration
+}
+
+// DefaultBackoff is the backoff RFC 2131 Section 4.1 recommends: waits of 4,
+// 8, 16, 32 and 64 seconds, each randomized by up to a second either way.
+var DefaultBackoff = ExponentialBackoff{
+	Initial:  4 * time.Second,
+	Max:      64 * time.Second,
+	Attempts: 5,
+	Jitter:   time.Second,
+}
+
+// Timeout implements Backoff.
+func (b ExponentialBackoff) Timeout(attempt int) (time.Duration, bool) {
+	if b.Attempts >= 0 && attempt >= b.Attempts {
+		return 0, false
+	}
+	d := b.Initial
+	for i := 0; i < attempt && d <= math.MaxInt64/2; i++ {
+		d *= 2
+		if b.Max > 0 && d >= b.Max {
+			break
+		}
+	}
+	if b.Max > 0 && d > b.Max {
+		d = b.Max
+	}
+	if b.Jitter > 0 {
+		d += time.Duration(rand.Int63n(int64(2*b.Jitter)+1)) - b.Jitter
+	}
+	return d, true
+}
+
+// FixedBackoff waits the same time after every transmission.
+type FixedBackoff struct {
+	// Wait is the time waited after each transmission.
+	Wait time.Duration
+
+	// Attempts is the number of transmissions; if negative, the client
+	// retransmits until the context is done.
+	Attempts int
+}
+
+// Timeout implements Backoff.
+func (b FixedBackoff) Timeout(attempt int) (time.Duration, bool) {
+	if b.Attempts >= 0 && attempt >= b.Attempts {
+		return 0, false
+	}
+	return b.Wait, true
+}
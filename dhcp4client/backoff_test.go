@@ -0,0 +1,95 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"testing"
+	"time"
+)
+
+// timeouts returns the times b waits, up to n of them.
+func timeouts(b Backoff, n int) []time.Duration {
+	var ds []time.Duration
+	for i := 0; i < n; i++ {
+		d, ok := b.Timeout(i)
+		if !ok {
+			break
+		}
+		ds = append(ds, d)
+	}
+	return ds
+}
+
+func TestBackoff(t *testing.T) {
+	for _, tt := range []struct {
+		desc string
+		b    Backoff
+		want []time.Duration
+	}{
+		{
+			desc: "exponential",
+			b:    ExponentialBackoff{Initial: time.Second, Max: 5 * time.Second, Attempts: 5},
+			want: []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second},
+		},
+		{
+			desc: "exponential forever",
+			b:    ExponentialBackoff{Initial: time.Second, Max: 2 * time.Second, Attempts: -1},
+			want: []time.Duration{time.Second, 2 * time.Second, 2 * time.Second, 2 * time.Second, 2 * time.Second, 2 * time.Second},
+		},
+		{
+			desc: "exponential uncapped",
+			b:    ExponentialBackoff{Initial: time.Second, Attempts: 3},
+			want: []time.Duration{time.Second, 2 * time.Second, 4 * time.Second},
+		},
+		{
+			desc: "fixed",
+			b:    FixedBackoff{Wait: time.Second, Attempts: 2},
+			want: []time.Duration{time.Second, time.Second},
+		},
+		{
+			desc: "fixed forever",
+			b:    FixedBackoff{Wait: time.Second, Attempts: -1},
+			want: []time.Duration{time.Second, time.Second, time.Second, time.Second, time.Second, time.Second},
+		},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			got := timeouts(tt.b, 6)
+			if len(got) != len(tt.want) {
+				t.Fatalf("Timeout() waits %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("Timeout() waits %v, want %v", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestDefaultBackoff(t *testing.T) {
+	got := timeouts(DefaultBackoff, 10)
+	if len(got) != 5 {
+		t.Fatalf("DefaultBackoff transmits %d times, want 5", len(got))
+	}
+	for i, d := range got {
+		want := 4 * time.Second << uint(i)
+		if d < want-time.Second || d > want+time.Second {
+			t.Errorf("DefaultBackoff waits %v after transmission %d, want %v ± 1s", d, i, want)
+		}
+	}
+}
+
+func TestWithTimeoutAndRetry(t *testing.T) {
+	c := &Client{backoff: DefaultBackoff}
+	for _, opt := range []ClientOpt{WithTimeout(time.Second), WithRetry(2)} {
+		if err := opt(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := (FixedBackoff{Wait: time.Second, Attempts: 2}); c.backoff != want {
+		t.Errorf("backoff = %+v, want %+v", c.backoff, want)
+	}
+}
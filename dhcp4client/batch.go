@@ -0,0 +1,134 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+	"golang.org/x/net/ipv4"
+)
+
+// batchConn reads and writes several packets per system call.
+type batchConn interface {
+	ReadBatch(ms []ipv4.Message, flags int) (int, error)
+	WriteBatch(ms []ipv4.Message, flags int) (int, error)
+}
+
+// SendBatch writes ps to dest and returns how many were written.
+//
+// SendBatch is meant for generating load: on Linux, packets are written to
+// UDP connections with as few sendmmsg calls as possible. On other platforms
+// and for other connections, such as raw sockets, they are written one at a
+// time. Unlike SendAndRead, SendBatch neither retransmits nor waits for
+// responses; use ReceiveBatch to read them.
+func (c *Client) SendBatch(ps []*dhcp4.Packet, dest net.Addr) (int, error) {
+	bufs := make([][]byte, 0, len(ps))
+	for _, p := range ps {
+		b, err := c.codec.Encode(p, c.marshalOptions())
+		if err != nil {
+			return 0, err
+		}
+		bufs = append(bufs, b)
+	}
+
+	conn := c.getConn()
+	bc, ok := newBatchConn(conn)
+	if !ok {
+		for i, b := range bufs {
+			if _, err := conn.WriteTo(b, dest); err != nil {
+				return i, fmt.Errorf("error writing packet to connection: %v", err)
+			}
+			c.captureSent(conn, b, dest)
+		}
+		return len(bufs), nil
+	}
+
+	ms := make([]ipv4.Message, len(bufs))
+	for i, b := range bufs {
+		ms[i] = ipv4.Message{Buffers: [][]byte{b}, Addr: dest}
+	}
+	var sent int
+	for sent < len(ms) {
+		n, err := bc.WriteBatch(ms[sent:], 0)
+		for _, b := range bufs[sent : sent+n] {
+			c.captureSent(conn, b, dest)
+		}
+		sent += n
+		if err != nil {
+			return sent, fmt.Errorf("error writing packets to connection: %v", err)
+		}
+	}
+	return sent, nil
+}
+
+// ReceiveBatch reads up to n packets, waiting until at least one arrives or
+// ctx is done. Packets that are not valid DHCP packets are skipped.
+//
+// On Linux, packets are read from UDP connections with one recvmmsg call.
+// On other platforms and for other connections, one packet is read.
+func (c *Client) ReceiveBatch(ctx context.Context, n int) ([]*dhcp4.Packet, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("batch size must be positive, got %d", n)
+	}
+	conn := c.getConn()
+	bc, batched := newBatchConn(conn)
+	if !batched {
+		n = 1
+	}
+	ms := make([]ipv4.Message, n)
+	for i := range ms {
+		ms[i].Buffers = [][]byte{make([]byte, c.maxSize)}
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		// Wake up now and then to check on ctx.
+		deadline := time.Now().Add(time.Second)
+		if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+			if !d.After(time.Now()) {
+				// ctx is about to be done.
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}
+			deadline = d
+		}
+		if err := conn.SetReadDeadline(deadline); err != nil {
+			return nil, err
+		}
+
+		var got int
+		var err error
+		if batched {
+			got, err = bc.ReadBatch(ms, 0)
+		} else {
+			ms[0].N, ms[0].Addr, err = conn.ReadFrom(ms[0].Buffers[0])
+			if err == nil {
+				got = 1
+			}
+		}
+		if err, ok := err.(net.Error); ok && err.Timeout() {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("error reading from connection: %v", err)
+		}
+
+		ps := make([]*dhcp4.Packet, 0, got)
+		for _, m := range ms[:got] {
+			c.captureReceived(conn, m.Buffers[0][:m.N], m.Addr, time.Time{})
+			if p, err := c.codec.Decode(m.Buffers[0][:m.N]); err == nil {
+				ps = append(ps, p)
+			}
+		}
+		if len(ps) > 0 {
+			return ps, nil
+		}
+	}
+}
@@ -0,0 +1,19 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"net"
+
+	"golang.org/x/net/ipv4"
+)
+
+// newBatchConn returns a batchConn for conn if conn supports batches.
+func newBatchConn(conn net.PacketConn) (batchConn, bool) {
+	if udp, ok := conn.(*net.UDPConn); ok {
+		return ipv4.NewPacketConn(udp), true
+	}
+	return nil, false
+}
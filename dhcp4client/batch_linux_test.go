@@ -0,0 +1,60 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+)
+
+func TestBatchUDP(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	listen := func() *net.UDPConn {
+		conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			t.Skipf("cannot listen on loopback: %v", err)
+		}
+		return conn
+	}
+	srcConn, dstConn := listen(), listen()
+	src, err := New(nil, WithConn(srcConn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	dst, err := New(nil, WithConn(dstConn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+
+	const count = 32
+	var ps []*dhcp4.Packet
+	for i := 0; i < count; i++ {
+		p := src.DiscoverPacket()
+		p.TransactionID = [4]byte{byte(i)}
+		ps = append(ps, p)
+	}
+	if n, err := src.SendBatch(ps, dstConn.LocalAddr()); n != count || err != nil {
+		t.Fatalf("SendBatch() = %d, %v, want %d, nil", n, err, count)
+	}
+
+	seen := make(map[[4]byte]bool)
+	for len(seen) < count {
+		got, err := dst.ReceiveBatch(ctx, count)
+		if err != nil {
+			t.Fatalf("ReceiveBatch() = %v after %d packets", err, len(seen))
+		}
+		for _, p := range got {
+			seen[p.TransactionID] = true
+		}
+	}
+}
@@ -0,0 +1,16 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux
+// +build !linux
+
+package dhcp4client
+
+import "net"
+
+// newBatchConn returns a batchConn for conn if conn supports batches. Only
+// Linux has system calls for batches.
+func newBatchConn(conn net.PacketConn) (batchConn, bool) {
+	return nil, false
+}
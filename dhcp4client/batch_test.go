@@ -0,0 +1,84 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+)
+
+func TestSendBatchUnbatched(t *testing.T) {
+	in := make(chan udpPacket, 10)
+	out := make(chan udpPacket, 10)
+	c, err := New(nil, WithConn(newMockUDPConn(in, out)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	var ps []*dhcp4.Packet
+	for i := byte(0); i < 3; i++ {
+		p := c.DiscoverPacket()
+		p.TransactionID = [4]byte{i}
+		ps = append(ps, p)
+	}
+	if n, err := c.SendBatch(ps, DefaultServers); n != len(ps) || err != nil {
+		t.Fatalf("SendBatch() = %d, %v, want %d, nil", n, err, len(ps))
+	}
+	for i := byte(0); i < 3; i++ {
+		sent := <-out
+		p, err := dhcp4.ParsePacket(sent.payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.TransactionID != [4]byte{i} || !sent.dest.IP.Equal(DefaultServers.IP) {
+			t.Errorf("packet %d: xid %v to %v, want %v to %v", i, p.TransactionID, sent.dest, [4]byte{i}, DefaultServers)
+		}
+	}
+}
+
+func TestReceiveBatchUnbatched(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	in := make(chan udpPacket, 10)
+	out := make(chan udpPacket, 10)
+	c, err := New(nil, WithConn(newMockUDPConn(in, out)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	offer := newLeaseReply(dhcp4.DHCPOffer, serverA, net.IP{192, 168, 1, 10}, time.Hour)
+	b, err := offer.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := &net.UDPAddr{IP: serverA, Port: ServerPort}
+	in <- udpPacket{source: src, payload: []byte{0x2, 0x1}}
+	in <- udpPacket{source: src, payload: b}
+
+	ps, err := c.ReceiveBatch(ctx, 10)
+	if err != nil {
+		t.Fatalf("ReceiveBatch() = %v", err)
+	}
+	if len(ps) != 1 || ps[0].Options.MessageType() != dhcp4.DHCPOffer {
+		t.Errorf("ReceiveBatch() = %v, want the OFFER", ps)
+	}
+
+	if _, err := c.ReceiveBatch(ctx, 0); err == nil {
+		t.Errorf("ReceiveBatch(0) = nil, want error")
+	}
+
+	short, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.ReceiveBatch(short, 10); err != context.DeadlineExceeded {
+		t.Errorf("ReceiveBatch() = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
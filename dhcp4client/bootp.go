@@ -0,0 +1,64 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"context"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+)
+
+// WithBOOTP makes RequestLease acquire the address with BOOTP (RFC 951) rather
+// than DHCP, for networks whose servers only speak BOOTP: a single
+// BOOTREQUEST without a DHCP message type, answered by a BOOTREPLY with the
+// address. BOOTP addresses never expire, so the lease does not either, and
+// the server address of the reply (siaddr) is its server identifier unless
+// the reply carries one.
+//
+// Default is DHCP.
+func WithBOOTP() ClientOpt {
+	return func(c *Client) error {
+		c.bootp = true
+		return nil
+	}
+}
+
+// bootpPacket returns a BOOTREQUEST carrying the vendor extensions of RFC
+// 1497, so that the server can send options such as the subnet mask. BOOTP
+// clients are known by their hardware address only.
+func (c *Client) bootpPacket() (*dhcp4.Packet, error) {
+	p := dhcp4.NewPacket(dhcp4.BootRequest)
+	if err := identify(p, c.Identity()); err != nil {
+		return nil, err
+	}
+	delete(p.Options, dhcp4.OptionClientIdentifier)
+	p.TransactionID = c.newXID()
+	p.Broadcast = c.broadcast
+	return p, nil
+}
+
+// bootpLease acquires an address with a BOOTP exchange.
+func (c *Client) bootpLease(ctx context.Context) (*Lease, error) {
+	request, err := c.bootpPacket()
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	reply, err := c.exchange(ctx, DefaultServers, request, func(p *dhcp4.Packet) bool {
+		return p.IsBOOTP() && !unspecified(p.YIAddr)
+	})
+	if err != nil {
+		return nil, err
+	}
+	lease, err := newLease(reply, start)
+	if err != nil {
+		return nil, err
+	}
+	if lease.ServerID == nil && !unspecified(reply.SIAddr) {
+		lease.ServerID = reply.SIAddr
+	}
+	return lease, nil
+}
@@ -0,0 +1,72 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+)
+
+func TestBOOTPLease(t *testing.T) {
+	ip := net.IP{192, 168, 1, 10}
+	bootpReply := func(vend []byte) *dhcp4.Packet {
+		p := newPacket(dhcp4.BootReply, [4]byte{})
+		p.YIAddr = ip
+		p.SIAddr = serverA
+		p.VendorArea = vend
+		if vend == nil {
+			p.Options.SetSubnetMask(net.IPMask{255, 255, 255, 0})
+		}
+		return p
+	}
+
+	for _, tt := range []struct {
+		name     string
+		response *dhcp4.Packet
+		wantErr  bool
+	}{
+		{
+			name:     "vendor extensions",
+			response: bootpReply(nil),
+		},
+		{
+			name:     "plain",
+			response: bootpReply([]byte{}),
+		},
+		{
+			name:     "DHCP ACK",
+			response: newLeaseReply(dhcp4.DHCPACK, serverA, ip, time.Hour),
+			wantErr:  true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			c, s := serveClient(ctx, t, [][]*dhcp4.Packet{{tt.response}}, WithBOOTP(), WithTimeout(100*time.Millisecond))
+			defer c.Close()
+
+			lease, err := c.RequestLease(ctx)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Request() = %v, want error", lease)
+				}
+			} else if err != nil || !lease.IP.Equal(ip) || !lease.ServerID.Equal(serverA) || lease.Duration != 0 {
+				t.Errorf("Request() = %v, %v, want %v from %v forever", lease, err, ip, serverA)
+			}
+
+			if len(s.packets()) != 1 {
+				t.Fatalf("client sent %d packets, want 1", len(s.packets()))
+			}
+			if p := s.packets()[0]; !p.IsBOOTP() || p.Options.ClientIdentifier() != nil {
+				t.Errorf("client sent %v, want a BOOTREQUEST without client identifier", p)
+			}
+		})
+	}
+}
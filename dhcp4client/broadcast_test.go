@@ -0,0 +1,46 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"net"
+	"testing"
+
+	"github.com/mergetb/dhcp4"
+)
+
+func TestBroadcastFlag(t *testing.T) {
+	offer := newLeaseReply(dhcp4.DHCPOffer, serverA, net.IP{192, 168, 1, 10}, 0)
+
+	for _, tt := range []struct {
+		desc string
+		opts []ClientOpt
+		want bool
+	}{
+		{desc: "default", want: true},
+		{desc: "set", opts: []ClientOpt{WithBroadcastFlag(true)}, want: true},
+		{desc: "cleared", opts: []ClientOpt{WithBroadcastFlag(false)}, want: false},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			opts := append([]ClientOpt{WithConn(newMockUDPConn(nil, nil))}, tt.opts...)
+			c, err := New(nil, opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := c.DiscoverPacket().Broadcast; got != tt.want {
+				t.Errorf("DiscoverPacket() broadcast flag %v, want %v", got, tt.want)
+			}
+			if got := c.RequestPacket(offer).Broadcast; got != tt.want {
+				t.Errorf("RequestPacket() broadcast flag %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPromiscuousUDPConn(t *testing.T) {
+	if _, err := New(nil, WithConn(newMockUDPConn(nil, nil)), WithPromiscuous()); err == nil {
+		t.Errorf("New(UDP socket, WithPromiscuous()) = nil, want error")
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"io"
+	"net"
+	"time"
+
+	"github.com/mergetb/dhcp4/dhcp4pcap"
+)
+
+// WithPacketCapture configures the client to write the packets it sends and
+// receives to w as a pcap capture, e.g. to analyze them with Wireshark after
+// a failed boot. Packets are captured as they are on the wire, including
+// those the client discards.
+//
+// Errors writing to w are ignored; the capture then lacks packets.
+func WithPacketCapture(w io.Writer) ClientOpt {
+	return func(c *Client) error {
+		pw, err := dhcp4pcap.NewWriter(w)
+		if err != nil {
+			return err
+		}
+		c.capture = pw
+		return nil
+	}
+}
+
+// captureSent captures b sent to dest.
+func (c *Client) captureSent(conn net.PacketConn, b []byte, dest net.Addr) {
+	if c.capture != nil {
+		c.capture.WritePacket(time.Now(), localAddr(conn), udpAddr(dest), b)
+	}
+}
+
+// captureReceived captures b received from source at t.
+func (c *Client) captureReceived(conn net.PacketConn, b []byte, source net.Addr, t time.Time) {
+	if c.capture != nil {
+		if t.IsZero() {
+			t = time.Now()
+		}
+		c.capture.WritePacket(t, udpAddr(source), localAddr(conn), b)
+	}
+}
+
+// localAddr returns the local address of conn, or 0.0.0.0 on the client
+// port if it is not a UDP address.
+func localAddr(conn net.PacketConn) *net.UDPAddr {
+	if a := udpAddr(conn.LocalAddr()); a != nil {
+		return a
+	}
+	return &net.UDPAddr{IP: net.IPv4zero, Port: ClientPort}
+}
+
+func udpAddr(a net.Addr) *net.UDPAddr {
+	ua, _ := a.(*net.UDPAddr)
+	return ua
+}
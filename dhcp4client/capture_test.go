@@ -0,0 +1,55 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+	"github.com/mergetb/dhcp4/dhcp4pcap"
+)
+
+func TestPacketCapture(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var buf bytes.Buffer
+	ip := net.IP{192, 168, 1, 10}
+	c, _ := serveClient(ctx, t, [][]*dhcp4.Packet{
+		{newLeaseReply(dhcp4.DHCPOffer, serverA, ip, time.Hour)},
+		{newLeaseReply(dhcp4.DHCPACK, serverA, ip, time.Hour)},
+	}, WithPacketCapture(&buf))
+	defer c.Close()
+
+	if _, err := c.RequestLease(ctx); err != nil {
+		t.Fatalf("Request() = %v", err)
+	}
+
+	records, err := dhcp4pcap.ReadAll(&buf)
+	if err != nil {
+		t.Fatalf("ReadAll = %v", err)
+	}
+	var got []dhcp4.MessageType
+	for _, r := range records {
+		got = append(got, r.Packet.Options.MessageType())
+	}
+	want := []dhcp4.MessageType{dhcp4.DHCPDiscover, dhcp4.DHCPOffer, dhcp4.DHCPRequest, dhcp4.DHCPACK}
+	if len(got) != len(want) {
+		t.Fatalf("captured %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("captured %v, want %v", got, want)
+			break
+		}
+	}
+	if dst := records[0].Dst; !dst.IP.Equal(net.IPv4bcast) || dst.Port != ServerPort {
+		t.Errorf("DISCOVER captured to %v, want %v", dst, DefaultServers)
+	}
+}
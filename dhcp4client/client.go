@@ -4,24 +4,30 @@
 
 // Package dhcp4client is a small, minimum-functionality client for DHCPv4.
 //
-// It only supports the 4-way DHCPv4 Discover-Offer-Request-Ack handshake as
-// well as the Request-Ack renewal process.
+// It supports acquiring a lease with the 4-way DHCPv4
+// Discover-Offer-Request-Ack handshake, renewing it with the Request-Ack
+// process, and releasing it.
 package dhcp4client
 
 import (
-	"bytes"
 	"context"
 	"fmt"
 	"net"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/mergetb/dhcp4"
+	"github.com/mergetb/dhcp4/dhcp4metrics"
+	"github.com/mergetb/dhcp4/dhcp4pcap"
 	"github.com/mergetb/dhcp4/dhcp4opts"
-	"github.com/vishvananda/netlink"
 )
 
 const (
+	// maxMessageSize is the Maximum DHCP Message Size advertised if the
+	// interface's MTU is not known.
 	maxMessageSize = 1500
 
 	// ClientPort is the port that DHCP clients listen on.
@@ -40,21 +46,163 @@ var (
 	}
 )
 
+// ResponsePolicy determines what SimpleSendAndRead does with a response when
+// the response channel is full.
+type ResponsePolicy int
+
+const (
+	// ResponseBlock stops reading from the connection until the consumer
+	// makes room in the response channel.
+	ResponseBlock ResponsePolicy = iota
+
+	// ResponseDropOldest discards the oldest unconsumed response to make
+	// room for the new one, so that a slow consumer never stalls reading.
+	ResponseDropOldest
+)
+
 // Client is an IPv4 DHCP client.
 type Client struct {
-	iface   netlink.Link
-	conn    net.PacketConn
-	timeout time.Duration
-	retry   int
+	iface Link
+
+	// connMu protects conn and closed.
+	connMu sync.Mutex
+	conn   net.PacketConn
+	closed bool
+
+	reopen     func() (net.PacketConn, error)
+	onRecovery func(RecoveryEvent)
+
+	// logger receives packet I/O if set, and metrics counts it.
+	logger  Logger
+	metrics dhcp4metrics.Metrics
+
+	// capture records packet I/O if set.
+	capture *dhcp4pcap.Writer
+
+	backoff Backoff
+
+	// codec encodes requests and decodes responses.
+	codec dhcp4.Codec
+
+	// broadcast is whether clients without an address ask servers to
+	// broadcast replies, and promiscuous whether the raw socket receives
+	// frames to any hardware address.
+	broadcast   bool
+	promiscuous bool
+
+	responseBuffer int
+	responsePolicy ResponsePolicy
+
+	// match is which fields of replies must match the request.
+	match ReplyMatch
+
+	// xid returns the transaction IDs of new exchanges, and demux routes
+	// replies to them.
+	xid   XIDGenerator
+	demux demux
+
+	// dropped is the number of responses dropped due to responsePolicy.
+	// Accessed atomically.
+	dropped uint64
+
+	naks nakTracker
+
+	// nakRestarts is how many NAKs in a row RequestLease restarts acquisition
+	// after, see WithNAKRestart.
+	nakRestarts int
+
+	// leaseFile caches the lease across restarts if set.
+	leaseFile string
+
+	offerWait     time.Duration
+	offerSelector OfferSelector
+
+	// rapidCommit is whether RequestLease asks for a lease in a two-message
+	// exchange.
+	rapidCommit bool
+
+	// bootp is whether RequestLease acquires the address with BOOTP instead
+	// of DHCP.
+	bootp bool
+
+	// renewRetry is the minimum time between retransmissions of renewals
+	// by Maintain.
+	renewRetry time.Duration
+
+	// releaseOnStop is whether Maintain releases its lease when stopped.
+	releaseOnStop bool
+
+	// forceRenew is whether Maintain obeys DHCPFORCERENEW messages.
+	forceRenew bool
+
+	// prober checks acquired addresses if set, and declineWait is how
+	// long RequestLease waits after declining one.
+	prober      AddressProber
+	declineWait time.Duration
+
+	// linkLocal probes link-local addresses if RequestLease falls back to
+	// them.
+	linkLocal AddressProber
+
+	// pxeArch and pxeUUID identify the client to PXE servers.
+	pxeArch dhcp4.Arch
+	pxeUUID dhcp4.UUID
+
+	// macPolicy is what Maintain does when the interface's hardware
+	// address changes, and watchMACs watches it.
+	macPolicy MACChangePolicy
+	watchMACs func(ctx context.Context) (<-chan macChange, error)
+
+	// maxSize is the Maximum DHCP Message Size advertised, and mtu that
+	// of the interface, or 0 if it is not known.
+	maxSize uint16
+	mtu     int
+
+	// requested are the options asked for in the parameter request
+	// list.
+	requested []dhcp4.OptionCode
+
+	// auth authenticates requests and responses if set.
+	auth *authenticator
+
+	// trusted are the networks of the servers whose responses are
+	// accepted, all if nil, and rogue reports the others instead of
+	// discarding them if set.
+	trusted []*net.IPNet
+	rogue   func(RogueServer)
+
+	// hostname and fqdn describe the client to servers if set.
+	hostname string
+	fqdn     *dhcp4.ClientFQDN
+
+	// state tracks exchanges and maintained leases for DumpState.
+	state stateTracker
+
+	// idMu protects id and maintainers.
+	idMu        sync.Mutex
+	id          Identity
+	maintainers map[*maintainer]struct{}
 }
 
 // New creates a new DHCP client that sends and receives packets on the given
 // interface.
-func New(iface netlink.Link, opts ...ClientOpt) (*Client, error) {
+func New(iface Link, opts ...ClientOpt) (*Client, error) {
 	c := &Client{
-		iface:   iface,
-		timeout: 10 * time.Second,
-		retry:   3,
+		iface:          iface,
+		backoff:        DefaultBackoff,
+		codec:          dhcp4.WireCodec,
+		broadcast:      true,
+		responseBuffer: 10,
+		responsePolicy: ResponseBlock,
+		naks: nakTracker{
+			base: 4 * time.Second,
+			max:  64 * time.Second,
+		},
+		offerSelector: FirstOffer,
+		renewRetry:    minRenewRetry,
+		declineWait:   minDeclineWait,
+		metrics:       dhcp4metrics.Discard,
+		xid:           RandomXID,
 	}
 
 	for _, opt := range opts {
@@ -63,12 +211,54 @@ func New(iface netlink.Link, opts ...ClientOpt) (*Client, error) {
 		}
 	}
 
+	if c.hostname != "" && c.fqdn != nil {
+		return nil, fmt.Errorf("host name and client FQDN cannot both be sent")
+	}
+	c.mtu = linkMTU(iface)
+	if c.maxSize == 0 {
+		c.maxSize = defaultMaxMessageSize(c.mtu)
+	}
+	if iface != nil {
+		if err := checkLink(iface); err != nil {
+			return nil, err
+		}
+	}
 	if c.conn == nil {
+		name := iface.Attrs().Name
 		var err error
-		c.conn, err = NewPacketUDPConn(iface.Attrs().Name, ClientPort)
+		c.conn, err = NewPacketUDPConn(name, ClientPort)
 		if err != nil {
 			return nil, err
 		}
+		if c.reopen == nil {
+			c.reopen = func() (net.PacketConn, error) {
+				return NewPacketUDPConn(name, ClientPort)
+			}
+		}
+	}
+	if c.iface != nil {
+		link := c.iface
+		c.watchMACs = func(ctx context.Context) (<-chan macChange, error) {
+			return watchHardwareAddr(ctx, link)
+		}
+	}
+	if c.promiscuous {
+		if err := setPromiscuous(c.conn); err != nil {
+			return nil, err
+		}
+		if reopen := c.reopen; reopen != nil {
+			c.reopen = func() (net.PacketConn, error) {
+				conn, err := reopen()
+				if err != nil {
+					return nil, err
+				}
+				if err := setPromiscuous(conn); err != nil {
+					conn.Close()
+					return nil, err
+				}
+				return conn, nil
+			}
+		}
 	}
 	return c, nil
 }
@@ -76,26 +266,112 @@ func New(iface netlink.Link, opts ...ClientOpt) (*Client, error) {
 // ClientOpt is a function that configures the Client.
 type ClientOpt func(*Client) error
 
-// WithTimeout configures the retransmission timeout.
+// WithBackoff configures when packets nobody answered are retransmitted.
 //
-// Default is 10 seconds.
-//
-// TODO(hugelgupf): Check RFC for retransmission behavior.
+// Default is DefaultBackoff.
+func WithBackoff(b Backoff) ClientOpt {
+	return func(c *Client) error {
+		c.backoff = b
+		return nil
+	}
+}
+
+// WithTimeout configures the client to wait d for responses after every
+// transmission, replacing the configured Backoff with a FixedBackoff of 3
+// transmissions unless it is one already.
 func WithTimeout(d time.Duration) ClientOpt {
 	return func(c *Client) error {
-		c.timeout = d
+		b := c.fixedBackoff()
+		b.Wait = d
+		c.backoff = b
 		return nil
 	}
 }
 
-// WithRetry configures the number of retransmissions to attempt.
+// WithRetry configures the client to transmit packets r times, replacing
+// the configured Backoff with a FixedBackoff waiting 10 seconds unless it is
+// one already.
+func WithRetry(r int) ClientOpt {
+	return func(c *Client) error {
+		b := c.fixedBackoff()
+		b.Attempts = r
+		c.backoff = b
+		return nil
+	}
+}
+
+// fixedBackoff returns the configured Backoff if it is a FixedBackoff, and
+// the FixedBackoff WithTimeout and WithRetry start from otherwise.
+func (c *Client) fixedBackoff() FixedBackoff {
+	if b, ok := c.backoff.(FixedBackoff); ok {
+		return b
+	}
+	return FixedBackoff{Wait: 10 * time.Second, Attempts: 3}
+}
+
+// WithCodec configures how packets are encoded and decoded.
 //
-// Default is 3.
+// Default is dhcp4.WireCodec.
+func WithCodec(codec dhcp4.Codec) ClientOpt {
+	return func(c *Client) error {
+		c.codec = codec
+		return nil
+	}
+}
+
+// WithBroadcastFlag configures whether DISCOVERs and REQUESTs set the BOOTP
+// broadcast flag, asking servers to broadcast their replies (RFC 2131
+// Section 4.1).
 //
-// TODO(hugelgupf): Check RFC for retransmission behavior.
-func WithRetry(r int) ClientOpt {
+// Without the flag, servers unicast replies to the offered address and the
+// client hardware address. The raw packet socket used by default receives
+// them before the interface is configured, but UDP sockets, e.g. from
+// NewIPv4UDPConn, do not. Some servers unicast OFFERs regardless of the
+// flag.
+//
+// Default is true.
+func WithBroadcastFlag(b bool) ClientOpt {
 	return func(c *Client) error {
-		c.retry = r
+		c.broadcast = b
+		return nil
+	}
+}
+
+// WithPromiscuous puts the raw packet socket into promiscuous mode, so that
+// the client receives unicast replies sent to a client hardware address
+// other than the interface's, e.g. one set with WithIdentity. New fails if
+// the connection is not a raw packet socket.
+//
+// Default is to receive only frames to the interface's hardware address
+// and broadcasts.
+func WithPromiscuous() ClientOpt {
+	return func(c *Client) error {
+		c.promiscuous = true
+		return nil
+	}
+}
+
+// WithResponseBuffer configures the size of the response channel returned by
+// SimpleSendAndRead.
+//
+// Default is 10.
+func WithResponseBuffer(n int) ClientOpt {
+	return func(c *Client) error {
+		if n < 0 {
+			return fmt.Errorf("response buffer size must not be negative, got %d", n)
+		}
+		c.responseBuffer = n
+		return nil
+	}
+}
+
+// WithResponsePolicy configures what SimpleSendAndRead does with responses
+// when its response channel is full.
+//
+// Default is ResponseBlock.
+func WithResponsePolicy(p ResponsePolicy) ClientOpt {
+	return func(c *Client) error {
+		c.responsePolicy = p
 		return nil
 	}
 }
@@ -108,11 +384,82 @@ func WithConn(conn net.PacketConn) ClientOpt {
 	}
 }
 
+// WithRawSocket configures the client to use a raw packet socket on the
+// interface named iface, see NewPacketUDPConn. Unlike UDP sockets, it works
+// before the interface has an IPv4 address. Windows has no raw packet
+// sockets; there, it is the socket of WithInterface.
+//
+// If New was not given an interface, the client identifies itself with the
+// hardware address of iface.
+//
+// Bonds, bridges and VLAN interfaces work like any other interface; ports of
+// a bond or bridge are refused with an EnslavedError.
+func WithRawSocket(iface string) ClientOpt {
+	return withLinkConn(iface, NewPacketUDPConn)
+}
+
+// WithInterface configures the client to use a socket bound to the
+// interface named iface, so that broadcasts only go out and replies only
+// come in on that link, even on hosts with several interfaces on one
+// network. VLAN interfaces are links of their own: a client on eth0.100
+// only sees VLAN 100.
+//
+// On Linux, the socket is a UDP socket bound with SO_BINDTODEVICE, see
+// NewIPv4UDPConn, which only receives replies broadcast or sent to
+// addresses of the host; the broadcast flag, set by default, asks servers
+// to broadcast. The BSDs use a BPF device on the interface. Windows uses a
+// UDP socket sending on the interface with IP_UNICAST_IF, see
+// NewPacketUDPConn.
+//
+// If New was not given an interface, the client identifies itself with the
+// hardware address of iface.
+func WithInterface(iface string) ClientOpt {
+	return withLinkConn(iface, newInterfaceConn)
+}
+
+// withLinkConn configures the client to use the connection open returns
+// for the interface named iface and the client port.
+func withLinkConn(iface string, open func(iface string, port int) (net.PacketConn, error)) ClientOpt {
+	return func(c *Client) error {
+		link, err := LinkByName(iface)
+		if err != nil {
+			return err
+		}
+		if err := checkLink(link); err != nil {
+			return err
+		}
+		conn, err := open(iface, ClientPort)
+		if err != nil {
+			return err
+		}
+		if c.iface == nil {
+			c.iface = link
+		}
+		c.conn = conn
+		if c.reopen == nil {
+			c.reopen = func() (net.PacketConn, error) {
+				return open(iface, ClientPort)
+			}
+		}
+		return nil
+	}
+}
+
 // DiscoverOffer sends a DHCPDiscover message and returns the first valid offer
 // received.
 func (c *Client) DiscoverOffer() (*dhcp4.Packet, error) {
-	ctx, cancel := context.WithCancel(context.Background())
-	wg, out, errCh := c.SimpleSendAndRead(ctx, DefaultServers, c.DiscoverPacket())
+	return c.DiscoverOfferContext(context.Background())
+}
+
+// DiscoverOfferContext is DiscoverOffer with a context: when ctx is done,
+// DiscoverOfferContext stops retransmitting and returns ctx.Err().
+func (c *Client) DiscoverOfferContext(ctx context.Context) (*dhcp4.Packet, error) {
+	discover, err := c.NewDiscoverPacket()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	wg, out, errCh := c.SimpleSendAndRead(ctx, DefaultServers, discover)
 	defer func() {
 		// Explicitly cancel first, then wait.
 		cancel()
@@ -133,23 +480,11 @@ func (c *Client) DiscoverOffer() (*dhcp4.Packet, error) {
 	return nil, fmt.Errorf("didn't get a packet")
 }
 
-// Request completes the 4-way Discover-Offer-Request-Ack handshake.
-func (c *Client) Request() (*dhcp4.Packet, error) {
-	offer, err := c.DiscoverOffer()
-	if err != nil {
-		return nil, err
-	}
-
-	return c.SendAndReadOne(c.RequestPacket(offer))
-}
-
-// Renew sends a renewal request packet and waits for the corresponding response.
-func (c *Client) Renew(ack *dhcp4.Packet) (*dhcp4.Packet, error) {
-	return c.SendAndReadOne(c.RequestPacket(ack))
-}
-
 // Close closes the client connection.
 func (c *Client) Close() error {
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+	c.closed = true
 	if c.conn != nil {
 		return c.conn.Close()
 	}
@@ -159,7 +494,14 @@ func (c *Client) Close() error {
 // SendAndReadOne sends one packet and returns the first response returned by
 // any server.
 func (c *Client) SendAndReadOne(packet *dhcp4.Packet) (*dhcp4.Packet, error) {
-	ctx, cancel := context.WithCancel(context.Background())
+	return c.SendAndReadOneContext(context.Background(), packet)
+}
+
+// SendAndReadOneContext is SendAndReadOne with a context, which bounds the
+// call independently of the configured Backoff: when ctx is done,
+// SendAndReadOneContext stops retransmitting and returns ctx.Err().
+func (c *Client) SendAndReadOneContext(ctx context.Context, packet *dhcp4.Packet) (*dhcp4.Packet, error) {
+	ctx, cancel := context.WithCancel(ctx)
 	wg, out, errCh := c.SimpleSendAndRead(ctx, DefaultServers, packet)
 	defer func() {
 		// Explicitly cancel first, then wait.
@@ -179,33 +521,77 @@ func (c *Client) SendAndReadOne(packet *dhcp4.Packet) (*dhcp4.Packet, error) {
 
 // DiscoverPacket returns a valid Discover packet for this client.
 //
+// A hardware address that does not fit into the packet is left out, so that
+// the client is only identified by its client identifier; NewDiscoverPacket
+// returns an error instead.
+//
 // TODO: Look at RFC and confirm.
 func (c *Client) DiscoverPacket() *dhcp4.Packet {
+	packet, _ := c.discoverPacket()
+	return packet
+}
+
+// NewDiscoverPacket is DiscoverPacket returning an error if the client's
+// hardware address does not fit into a packet.
+func (c *Client) NewDiscoverPacket() (*dhcp4.Packet, error) {
+	packet, err := c.discoverPacket()
+	if err != nil {
+		return nil, err
+	}
+	return packet, nil
+}
+
+// discoverPacket returns the Discover packet of DiscoverPacket, and the
+// error identifying the client in it.
+func (c *Client) discoverPacket() (*dhcp4.Packet, error) {
 	packet := dhcp4.NewPacket(dhcp4.BootRequest)
-	//rand.Read(packet.TransactionID[:])
-	packet.TransactionID = macToID(c.iface.Attrs().HardwareAddr)
-	packet.CHAddr = c.iface.Attrs().HardwareAddr
-	packet.Broadcast = true
+	err := identify(packet, c.Identity())
+	packet.TransactionID = c.newXID()
+	packet.Broadcast = c.broadcast
 
 	packet.Options.Add(dhcp4.OptionDHCPMessageType, dhcp4opts.DHCPDiscover)
-	packet.Options.Add(dhcp4.OptionMaximumDHCPMessageSize, dhcp4opts.Uint16(maxMessageSize))
-	return packet
+	packet.Options.Add(dhcp4.OptionMaximumDHCPMessageSize, dhcp4opts.Uint16(c.maxSize))
+	packet.Options.SetRapidCommit(c.rapidCommit)
+	c.describe(packet)
+	c.requestOptions(packet)
+	return packet, err
 }
 
 // RequestPacket returns a valid DHCPRequest packet for the given offer.
 //
+// A hardware address that does not fit into the packet is left out, so that
+// the client is only identified by its client identifier; NewRequestPacket
+// returns an error instead.
+//
 // TODO: Look at RFC and confirm.
 func (c *Client) RequestPacket(offer *dhcp4.Packet) *dhcp4.Packet {
+	packet, _ := c.requestPacket(offer)
+	return packet
+}
+
+// NewRequestPacket is RequestPacket returning an error if the client's
+// hardware address does not fit into a packet.
+func (c *Client) NewRequestPacket(offer *dhcp4.Packet) (*dhcp4.Packet, error) {
+	packet, err := c.requestPacket(offer)
+	if err != nil {
+		return nil, err
+	}
+	return packet, nil
+}
+
+// requestPacket returns the DHCPRequest packet of RequestPacket, and the
+// error identifying the client in it.
+func (c *Client) requestPacket(offer *dhcp4.Packet) (*dhcp4.Packet, error) {
 	packet := dhcp4.NewPacket(dhcp4.BootRequest)
 
-	packet.CHAddr = c.iface.Attrs().HardwareAddr
+	err := identify(packet, c.Identity())
 	packet.TransactionID = offer.TransactionID
 	packet.CIAddr = offer.CIAddr
 	packet.SIAddr = offer.SIAddr
-	packet.Broadcast = true
+	packet.Broadcast = c.broadcast
 
 	packet.Options.Add(dhcp4.OptionDHCPMessageType, dhcp4opts.DHCPRequest)
-	packet.Options.Add(dhcp4.OptionMaximumDHCPMessageSize, dhcp4opts.Uint16(maxMessageSize))
+	packet.Options.Add(dhcp4.OptionMaximumDHCPMessageSize, dhcp4opts.Uint16(c.maxSize))
 	// Request the offered IP address.
 	packet.Options.Add(dhcp4.OptionRequestedIPAddress, dhcp4opts.IP(offer.YIAddr))
 
@@ -213,27 +599,158 @@ func (c *Client) RequestPacket(offer *dhcp4.Packet) *dhcp4.Packet {
 	if sid != nil {
 		packet.Options.Add(dhcp4.OptionServerIdentifier, dhcp4opts.IP(sid))
 	}
-	return packet
+	c.describe(packet)
+	c.requestOptions(packet)
+	return packet, err
+}
+
+// hardwareAddr returns the link-layer address of the client's interface, if
+// it has one.
+//
+// The address of bonds, bridges and VLAN interfaces is looked up anew, as it
+// changes when their ports do.
+func (c *Client) hardwareAddr() net.HardwareAddr {
+	if c.iface == nil {
+		return nil
+	}
+	return currentHardwareAddr(c.iface)
+}
+
+// TimestampedPacketConn is a net.PacketConn that can report when a packet was
+// received.
+type TimestampedPacketConn interface {
+	net.PacketConn
+
+	// ReadFromTimestamped is like ReadFrom, but also returns the time
+	// the packet was received, preferably as recorded by the kernel.
+	ReadFromTimestamped(b []byte) (int, net.Addr, time.Time, error)
+}
+
+// readFrom reads a packet from conn and returns when it was received.
+func readFrom(conn net.PacketConn, b []byte) (int, net.Addr, time.Time, error) {
+	if tc, ok := conn.(TimestampedPacketConn); ok {
+		return tc.ReadFromTimestamped(b)
+	}
+	n, addr, err := conn.ReadFrom(b)
+	return n, addr, time.Now(), err
 }
 
 // ClientPacket is a DHCP packet and the interface it corresponds to.
 type ClientPacket struct {
-	Interface netlink.Link
+	Interface Link
 	Packet    *dhcp4.Packet
+
+	// Received is when the packet was received. If the connection
+	// supports it, this is the kernel's receive timestamp.
+	Received time.Time
+
+	// Source is the address the packet was received from.
+	Source net.Addr
+}
+
+// RejectReason is why a received packet was not considered a response.
+type RejectReason string
+
+// Reasons for rejecting received packets.
+const (
+	RejectMalformed RejectReason = "malformed"
+	RejectXID       RejectReason = "transaction ID mismatch"
+	RejectCHAddr    RejectReason = "client hardware address mismatch"
+	RejectClientID  RejectReason = "client identifier mismatch"
+
+	// RejectAuthentication is reported for responses that fail the
+	// authentication configured with WithAuthentication.
+	RejectAuthentication RejectReason = "authentication failed"
+
+	// RejectUnwanted is reported to the Logger for responses the
+	// exchange was not waiting for, e.g. offers of another server.
+	RejectUnwanted RejectReason = "unwanted"
+
+	// RejectUntrusted is reported to the Logger for responses of servers
+	// not trusted, see WithTrustedServers.
+	RejectUntrusted RejectReason = "untrusted server"
+
+	// RejectInvalid is reported to the Logger for offers breaking the
+	// rules of RFC 2131 for servers, see dhcp4.Packet.ValidateMessage.
+	// Err lists the rules broken.
+	RejectInvalid RejectReason = "invalid"
+
+	// RejectDeclined is reported to the Logger for offers of addresses
+	// the client declined, see WithAddressProber.
+	RejectDeclined RejectReason = "declined"
+)
+
+// Attempt describes one transmission of a packet and the packets read in
+// response to it.
+type Attempt struct {
+	// Duration is how long the client waited for responses.
+	Duration time.Duration
+
+	// Accepted is the number of responses accepted.
+	Accepted int
+
+	// Rejected counts packets that were received but not accepted as a
+	// response, by reason.
+	Rejected map[RejectReason]int
+}
+
+func (a Attempt) reject(reason RejectReason) Attempt {
+	if a.Rejected == nil {
+		a.Rejected = make(map[RejectReason]int)
+	}
+	a.Rejected[reason]++
+	return a
+}
+
+// String implements fmt.Stringer.
+func (a Attempt) String() string {
+	s := fmt.Sprintf("%v, %d accepted", a.Duration.Round(time.Millisecond), a.Accepted)
+
+	var reasons []string
+	for r, n := range a.Rejected {
+		reasons = append(reasons, fmt.Sprintf("%d %s", n, r))
+	}
+	sort.Strings(reasons)
+	if len(reasons) > 0 {
+		s += ", rejected " + strings.Join(reasons, ", ")
+	}
+	return s
+}
+
+// ExchangeStats is a breakdown of how the time of a packet exchange was
+// spent.
+type ExchangeStats struct {
+	Attempts []Attempt
+}
+
+// String implements fmt.Stringer.
+func (es *ExchangeStats) String() string {
+	s := make([]string, 0, len(es.Attempts))
+	for i, a := range es.Attempts {
+		s = append(s, fmt.Sprintf("attempt %d: %v", i+1, a))
+	}
+	return fmt.Sprintf("%d attempts (%s)", len(es.Attempts), strings.Join(s, "; "))
 }
 
 // ClientError is an error that occured on the associated interface.
 type ClientError struct {
-	Interface netlink.Link
+	Interface Link
 	Err       error
+
+	// Stats is set if the exchange timed out, to help diagnose why.
+	Stats *ExchangeStats
 }
 
 // Error implements error.
 func (ce *ClientError) Error() string {
+	err := ce.Err.Error()
+	if ce.Stats != nil {
+		err = fmt.Sprintf("%s after %v", err, ce.Stats)
+	}
 	if ce.Interface != nil {
-		return fmt.Sprintf("error on %q: %v", ce.Interface.Attrs().Name, ce.Err)
+		return fmt.Sprintf("error on %q: %s", ce.Interface.Attrs().Name, err)
 	}
-	return fmt.Sprintf("error without interface: %v", ce.Err)
+	return fmt.Sprintf("error without interface: %s", err)
 }
 
 func (c *Client) newClientErr(err error) *ClientError {
@@ -283,13 +800,24 @@ func (c *Client) newClientErr(err error) *ClientError {
 // TODO(hugelgupf): since the client only has one connection, maybe it should
 // just have one dedicated goroutine for reading from the UDP socket, and use a
 // request and response queue.
+//
+// If the response channel is full, responses are handled according to the
+// client's ResponsePolicy. Dropped responses are counted by DroppedResponses.
 func (c *Client) SimpleSendAndRead(ctx context.Context, dest *net.UDPAddr, p *dhcp4.Packet) (*sync.WaitGroup, <-chan *ClientPacket, <-chan *ClientError) {
-	out := make(chan *ClientPacket, 10)
+	out := make(chan *ClientPacket, c.responseBuffer)
 	errOut := make(chan *ClientError, 1)
+
+	deliver := blockingDeliver(ctx, out)
+	if c.responsePolicy == ResponseDropOldest {
+		deliver = c.dropOldestDeliver(out)
+	}
+
 	var wg sync.WaitGroup
 	wg.Add(1)
 	go func() {
-		c.SendAndRead(ctx, dest, p, out, errOut)
+		if err := c.sendAndRead(ctx, dest, p, deliver); err != nil {
+			errOut <- err
+		}
 		close(out)
 		close(errOut)
 		wg.Done()
@@ -304,8 +832,8 @@ func (c *Client) SimpleSendAndRead(ctx context.Context, dest *net.UDPAddr, p *dh
 // - `ctx` is canceled; or
 // - we have exhausted all configured retries and timeouts.
 //
-// SendAndRead retries sending the packet and receiving responses according to
-// the configured number of c.retry, using a response timeout of c.timeout.
+// SendAndRead retransmits the packet and waits for responses as the
+// configured Backoff decides.
 //
 // TODO(hugelgupf): Make this a little state machine of packet types. See RFC
 // 2131, Section 4.4, Figure 5.
@@ -314,107 +842,208 @@ func (c *Client) SendAndRead(ctx context.Context, dest *net.UDPAddr, p *dhcp4.Pa
 	// - we send at most one error on errCh; and
 	// - we don't forget to send err on errCh in the many return statements
 	//   of sendAndRead.
-	if err := c.sendAndRead(ctx, dest, p, out); err != nil {
+	if err := c.sendAndRead(ctx, dest, p, blockingDeliver(ctx, out)); err != nil {
 		errCh <- err
 	}
 }
 
-func (c *Client) sendAndRead(ctx context.Context, dest *net.UDPAddr, p *dhcp4.Packet, out chan<- *ClientPacket) *ClientError {
-	pkt, err := p.MarshalBinary()
-	if err != nil {
-		return c.newClientErr(err)
+// DroppedResponses returns the number of responses that were dropped because
+// the consumer did not keep up with the response channel.
+func (c *Client) DroppedResponses() uint64 {
+	return atomic.LoadUint64(&c.dropped)
+}
+
+// deliverFunc hands a received packet to the consumer.
+type deliverFunc func(*ClientPacket) error
+
+// blockingDeliver sends packets on out, blocking until there is room or ctx is
+// done.
+func blockingDeliver(ctx context.Context, out chan<- *ClientPacket) deliverFunc {
+	return func(clientPkt *ClientPacket) error {
+		// Make sure that sending the response has priority.
+		select {
+		case out <- clientPkt:
+			return nil
+		default:
+		}
+
+		// We deliberately only check the parent context here.
+		// The backoff should only apply to reading from the
+		// conn, not sending on out.
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case out <- clientPkt:
+			return nil
+		}
 	}
+}
+
+// dropOldestDeliver sends packets on out, discarding the oldest packet in out
+// if there is no room.
+func (c *Client) dropOldestDeliver(out chan *ClientPacket) deliverFunc {
+	return func(clientPkt *ClientPacket) error {
+		for {
+			select {
+			case out <- clientPkt:
+				return nil
+			default:
+			}
+
+			// The consumer may have made room in the meantime, in
+			// which case there's nothing to drop.
+			select {
+			case <-out:
+				atomic.AddUint64(&c.dropped, 1)
+			default:
+				if cap(out) == 0 {
+					// Nobody is listening and there is
+					// no buffer to drop from.
+					atomic.AddUint64(&c.dropped, 1)
+					return nil
+				}
+			}
+		}
+	}
+}
+
+func (c *Client) sendAndRead(ctx context.Context, dest *net.UDPAddr, p *dhcp4.Packet, deliver deliverFunc) *ClientError {
+	began := processStart(ctx, time.Now())
+
+	ex := c.state.startExchange(dest, p)
+	defer c.state.endExchange(ex)
+
+	// Register before sending, so that no reply is missed.
+	pe := c.register(p)
+	defer c.unregister(pe)
+
+	var stats ExchangeStats
+	var attempts int
+	err := c.retryFn(ctx, func(timeout time.Duration) error {
+		c.state.attempt(ex)
+		attempts++
 
-	return c.newClientErr(c.retryFn(func() error {
-		if _, err := c.conn.WriteTo(pkt, dest); err != nil {
+		// Every transmission is rebuilt to report the time elapsed
+		// since the process began, rather than replaying the first.
+		retransmit := *p
+		retransmit.Secs = elapsedSecs(began, time.Now())
+		pkt, err := c.encode(&retransmit)
+		if err != nil {
+			return err
+		}
+
+		conn := c.getConn()
+		if _, err := conn.WriteTo(pkt, dest); err != nil {
+			if c.recoverConn(conn, err) {
+				return errRecovered
+			}
 			return fmt.Errorf("error writing packet to connection: %v", err)
 		}
+		c.captureSent(conn, pkt, dest)
+		kind := PacketSent
+		if attempts > 1 {
+			kind = PacketRetransmitted
+		}
+		c.reportPacket(PacketEvent{Kind: kind, Packet: &retransmit, Addr: dest, Attempt: attempts, Timeout: timeout})
 
-		var numPackets int
-		timeoutCtx, cancel := context.WithTimeout(ctx, c.timeout)
+		var attempt Attempt
+		start := time.Now()
+		defer func() {
+			attempt.Duration = time.Since(start)
+			stats.Attempts = append(stats.Attempts, attempt)
+		}()
+
+		timeoutCtx, cancel := context.WithTimeout(ctx, timeout)
 		defer cancel()
 		for {
+			var dg datagram
 			select {
 			case <-timeoutCtx.Done():
-				if numPackets > 0 {
+				if attempt.Accepted > 0 {
 					return nil
 				}
 
 				// No packets received. Sadness.
+				if timeoutCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+					c.reportPacket(PacketEvent{Kind: PacketTimedOut, Packet: &retransmit, Addr: dest, Attempt: attempts, Timeout: timeout})
+				}
 				return timeoutCtx.Err()
-			default:
+			case dg = <-pe.in:
 			}
-
-			// Since a context can be canceled not just because of
-			// a deadline, we must check the context every once in
-			// a while. Use what is (hopefully) a small part of the
-			// context deadline rather than the context's deadline.
-			c.conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
-
-			// TODO: Clients can send a "max packet size" option in
-			// their packets, IIRC. Choose a reasonable size and
-			// set it.
-			b := make([]byte, 1500)
-			n, _, err := c.conn.ReadFrom(b)
-			if oerr, ok := err.(net.Error); ok && oerr.Timeout() {
-				// Continue to check ctx.Done() above and
-				// return the appropriate error.
-				continue
-			} else if err != nil {
-				return fmt.Errorf("error reading from UDP connection: %v", err)
+			if dg.err != nil {
+				return dg.err
 			}
 
-			pkt := &dhcp4.Packet{}
-			if err := pkt.UnmarshalBinary(b[:n]); err != nil {
+			pkt, source, received := dg.pkt, dg.source, dg.received
+			if dg.decodeErr != nil {
 				// Not a valid DHCP reply; keep listening.
+				attempt = attempt.reject(RejectMalformed)
+				c.reportPacket(PacketEvent{Kind: PacketDiscarded, Time: received, Addr: source, Reason: RejectMalformed, Err: dg.decodeErr})
 				continue
 			}
 
-			if pkt.TransactionID != p.TransactionID {
-				if pkt.CHAddr != nil && !bytes.Equal(c.iface.Attrs().HardwareAddr, pkt.CHAddr) {
+			if reason := matchReply(c.match, p, pkt); reason != "" {
+				// Not the right response packet.
+				attempt = attempt.reject(reason)
+				c.reportPacket(PacketEvent{Kind: PacketDiscarded, Time: received, Packet: pkt, Addr: source, Reason: reason})
+				continue
+			}
+			if c.auth != nil {
+				if reason, err := c.auth.verify(dg.b, pkt); reason != "" {
+					attempt = attempt.reject(reason)
+					c.reportPacket(PacketEvent{Kind: PacketDiscarded, Time: received, Packet: pkt, Addr: source, Reason: reason, Err: err})
 					continue
 				}
-				// Not the right response packet.
+			}
+			if !c.checkServer(pkt, source, received) {
+				attempt = attempt.reject(RejectUntrusted)
+				c.reportPacket(PacketEvent{Kind: PacketDiscarded, Time: received, Packet: pkt, Addr: source, Reason: RejectUntrusted})
 				continue
 			}
 
-			numPackets++
+			attempt.Accepted++
+			c.reportPacket(PacketEvent{Kind: PacketReceived, Time: received, Packet: pkt, Addr: source})
 
 			clientPkt := &ClientPacket{
 				Packet:    pkt,
 				Interface: c.iface,
+				Received:  received,
+				Source:    source,
 			}
-
-			// Make sure that sending the response has priority.
-			select {
-			case out <- clientPkt:
-				continue
-			default:
-			}
-
-			// We deliberately only check the parent context here.
-			// c.timeout should only apply to reading from the
-			// conn, not sending on out.
-			select {
-			case <-ctx.Done():
-				return ctx.Err()
-			case out <- clientPkt:
+			if err := deliver(clientPkt); err != nil {
+				return err
 			}
 		}
-	}))
+	})
+
+	cerr := c.newClientErr(err)
+	if err == context.DeadlineExceeded {
+		cerr.Stats = &stats
+	}
+	return cerr
 }
 
-func (c *Client) retryFn(fn func() error) error {
+// retryFn calls fn for every transmission the configured Backoff allows,
+// until fn succeeds or ctx is done.
+func (c *Client) retryFn(ctx context.Context, fn func(timeout time.Duration) error) error {
 	// Each retry takes the amount of timeout at worst.
-	for i := 0; i < c.retry || c.retry < 0; i++ {
-		switch err := fn(); err {
+	for i := 0; ; i++ {
+		// fn cannot tell whether its timeout or ctx expired, so make
+		// sure not to retransmit after ctx is done.
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		timeout, ok := c.backoff.Timeout(i)
+		if !ok {
+			break
+		}
+		switch err := fn(timeout); err {
 		case nil:
 			// Got it!
 			return nil
 
-		case context.DeadlineExceeded:
+		case context.DeadlineExceeded, errRecovered:
 			// Just retry.
-			// TODO(hugelgupf): Sleep here for some random amount of time.
 
 		default:
 			return err
@@ -423,12 +1052,3 @@ func (c *Client) retryFn(fn func() error) error {
 
 	return context.DeadlineExceeded
 }
-
-func macToID(mac []byte) [4]byte {
-	txid := [4]byte{0, 0, 0, 0}
-	txid[0] = mac[len(mac)-1]
-	txid[1] = mac[len(mac)-2]
-	txid[2] = mac[len(mac)-3]
-	txid[3] = mac[len(mac)-4]
-	return txid
-}
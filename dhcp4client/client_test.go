@@ -9,6 +9,7 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"sync"
 	"syscall"
 	"testing"
 	"time"
@@ -67,7 +68,7 @@ func (m *mockUDPConn) SetReadDeadline(t time.Time) error {
 }
 
 func (m *mockUDPConn) LocalAddr() net.Addr {
-	panic("unused")
+	return &net.UDPAddr{IP: net.IPv4zero, Port: ClientPort}
 }
 
 func (m *mockUDPConn) SetWriteDeadline(t time.Time) error {
@@ -127,20 +128,40 @@ type server struct {
 	in  chan udpPacket
 	out chan udpPacket
 
+	// mu protects received and dests, which tests read while serve
+	// appends to them.
+	mu       sync.Mutex
 	received []*dhcp4.Packet
+	dests    []*net.UDPAddr
 
 	// Each received packet can have more than one response (in theory,
 	// from different servers sending different Advertise, for example).
 	responses [][]*dhcp4.Packet
 }
 
+// packets returns the packets the server received so far.
+func (s *server) packets() []*dhcp4.Packet {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*dhcp4.Packet(nil), s.received...)
+}
+
+// destinations returns where the packets the server received so far were
+// sent to.
+func (s *server) destinations() []*net.UDPAddr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*net.UDPAddr(nil), s.dests...)
+}
+
 func (s *server) serve(ctx context.Context) {
 	go func() {
+	loop:
 		for len(s.responses) > 0 {
 			select {
 			case udpPkt, ok := <-s.in:
 				if !ok {
-					break
+					break loop
 				}
 
 				// What did we get?
@@ -148,7 +169,10 @@ func (s *server) serve(ctx context.Context) {
 				if err := (&pkt).UnmarshalBinary(udpPkt.payload); err != nil {
 					panic(fmt.Sprintf("invalid dhcp6 packet %q: %v", udpPkt.payload, err))
 				}
+				s.mu.Lock()
 				s.received = append(s.received, &pkt)
+				s.dests = append(s.dests, udpPkt.dest)
+				s.mu.Unlock()
 
 				if len(s.responses) > 0 {
 					resps := s.responses[0]
@@ -167,7 +191,7 @@ func (s *server) serve(ctx context.Context) {
 				}
 
 			case <-ctx.Done():
-				break
+				break loop
 			}
 		}
 
@@ -205,7 +229,7 @@ func pktsExpected(got []*dhcp4.Packet, want []*dhcp4.Packet) error {
 	return nil
 }
 
-func serveAndClient(ctx context.Context, responses [][]*dhcp4.Packet) (*Client, *mockUDPConn) {
+func serveAndClient(ctx context.Context, responses [][]*dhcp4.Packet, opts ...ClientOpt) (*Client, *mockUDPConn) {
 	// These are the client's channels.
 	in := make(chan udpPacket, 100)
 	out := make(chan udpPacket, 100)
@@ -215,7 +239,8 @@ func serveAndClient(ctx context.Context, responses [][]*dhcp4.Packet) (*Client,
 		out: out,
 	}
 
-	mc, err := New(nil, WithConn(mockConn), WithRetry(1), WithTimeout(time.Second))
+	opts = append([]ClientOpt{WithConn(mockConn), WithRetry(1), WithTimeout(time.Second), withZeroXID}, opts...)
+	mc, err := New(nil, opts...)
 	if err != nil {
 		panic(err)
 	}
@@ -231,6 +256,10 @@ func serveAndClient(ctx context.Context, responses [][]*dhcp4.Packet) (*Client,
 	return mc, mockConn
 }
 
+// withZeroXID makes the client use transaction ID 0, which the mock server
+// answers with.
+var withZeroXID = WithXIDGenerator(func() [4]byte { return [4]byte{} })
+
 func newPacket(op dhcp4.OpCode, xid [4]byte) *dhcp4.Packet {
 	p := dhcp4.NewPacket(op)
 	p.TransactionID = xid
@@ -484,3 +513,107 @@ func TestMultipleSendAndReadOne(t *testing.T) {
 		}
 	}
 }
+
+func TestSendAndReadOneContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Nobody answers.
+	responses := make([][]*dhcp4.Packet, 100)
+	mc, _ := serveClient(ctx, t, responses, WithBackoff(FixedBackoff{Wait: 50 * time.Millisecond, Attempts: -1}))
+	defer mc.Close()
+
+	callCtx, callCancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer callCancel()
+	done := make(chan error, 1)
+	go func() {
+		_, err := mc.SendAndReadOneContext(callCtx, newPacket(dhcp4.BootRequest, [4]byte{0x33, 0x33, 0x33, 0x33}))
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if cerr, ok := err.(*ClientError); !ok || cerr.Err != context.DeadlineExceeded {
+			t.Errorf("SendAndReadOneContext() = %v, want deadline exceeded", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("SendAndReadOneContext() still retransmitting after its context expired")
+	}
+}
+
+func TestSimpleSendAndReadDropOldest(t *testing.T) {
+	pkt := newPacket(dhcp4.BootRequest, [4]byte{0x33, 0x33, 0x33, 0x33})
+
+	responses := []*dhcp4.Packet{
+		newPacketHType(dhcp4.BootReply, [4]byte{0x33, 0x33, 0x33, 0x33}, 1),
+		newPacketHType(dhcp4.BootReply, [4]byte{0x33, 0x33, 0x33, 0x33}, 2),
+		newPacketHType(dhcp4.BootReply, [4]byte{0x33, 0x33, 0x33, 0x33}, 3),
+		newPacketHType(dhcp4.BootReply, [4]byte{0x33, 0x33, 0x33, 0x33}, 4),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	mc, _ := serveAndClient(ctx, [][]*dhcp4.Packet{responses})
+	defer mc.conn.Close()
+	WithResponseBuffer(1)(mc)
+	WithResponsePolicy(ResponseDropOldest)(mc)
+
+	wg, out, errCh := mc.SimpleSendAndRead(ctx, DefaultServers, pkt)
+
+	// Be a really slow consumer: only start reading once the reader is
+	// done.
+	wg.Wait()
+	var rcvd []*dhcp4.Packet
+	for packet := range out {
+		rcvd = append(rcvd, packet.Packet)
+	}
+	if err, ok := <-errCh; ok {
+		t.Errorf("got %v, want nil error", err)
+	}
+
+	if err := pktsExpected(rcvd, responses[3:]); err != nil {
+		t.Errorf("got unexpected packets: %v", err)
+	}
+	if got := mc.DroppedResponses(); got != 3 {
+		t.Errorf("DroppedResponses() = %d, want 3", got)
+	}
+}
+
+func TestSimpleSendAndReadTimeoutStats(t *testing.T) {
+	pkt := newPacket(dhcp4.BootRequest, [4]byte{0x33, 0x33, 0x33, 0x33})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	mc, udpConn := serveAndClient(ctx, [][]*dhcp4.Packet{{
+		newPacket(dhcp4.BootReply, [4]byte{0, 0, 0, 0}),
+	}})
+	defer mc.conn.Close()
+
+	udpConn.in <- udpPacket{
+		payload: []byte{0x01}, // Too short for valid DHCPv4 packet.
+	}
+
+	wg, out, errCh := mc.SimpleSendAndRead(ctx, DefaultServers, pkt)
+	for range out {
+		t.Errorf("got unexpected response")
+	}
+	wg.Wait()
+
+	err, ok := <-errCh
+	if !ok || err.Err != context.DeadlineExceeded {
+		t.Fatalf("SimpleSendAndRead(%v): got %v, want %v", pkt, err, context.DeadlineExceeded)
+	}
+	if err.Stats == nil || len(err.Stats.Attempts) != 1 {
+		t.Fatalf("got stats %v, want 1 attempt", err.Stats)
+	}
+	a := err.Stats.Attempts[0]
+	// The mock connection returns empty reads once the server is done,
+	// so there may be more than one malformed packet.
+	if a.Accepted != 0 || a.Rejected[RejectMalformed] < 1 || a.Rejected[RejectXID] != 1 {
+		t.Errorf("got attempt %v, want malformed packets and 1 XID mismatch", a)
+	}
+	if a.Duration < time.Second {
+		t.Errorf("got attempt duration %v, want at least the 1s timeout", a.Duration)
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+)
+
+// recordingCodec wraps dhcp4.WireCodec and records the message types it
+// encodes and decodes.
+type recordingCodec struct {
+	mu      sync.Mutex
+	encoded []dhcp4.MessageType
+	decoded []dhcp4.MessageType
+}
+
+func (rc *recordingCodec) Encode(p *dhcp4.Packet, mo dhcp4.MarshalOptions) ([]byte, error) {
+	rc.mu.Lock()
+	rc.encoded = append(rc.encoded, p.Options.MessageType())
+	rc.mu.Unlock()
+	return dhcp4.WireCodec.Encode(p, mo)
+}
+
+func (rc *recordingCodec) Decode(b []byte) (*dhcp4.Packet, error) {
+	p, err := dhcp4.WireCodec.Decode(b)
+	if err == nil {
+		rc.mu.Lock()
+		rc.decoded = append(rc.decoded, p.Options.MessageType())
+		rc.mu.Unlock()
+	}
+	return p, err
+}
+
+func TestWithCodec(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ip := net.IP{192, 168, 1, 10}
+	rc := &recordingCodec{}
+	c, _ := serveClient(ctx, t, [][]*dhcp4.Packet{
+		{newLeaseReply(dhcp4.DHCPOffer, serverA, ip, time.Hour)},
+		{newLeaseReply(dhcp4.DHCPACK, serverA, ip, time.Hour)},
+		{},
+	}, WithCodec(rc))
+	defer c.Close()
+
+	lease, err := c.RequestLease(ctx)
+	if err != nil {
+		t.Fatalf("Request() = %v", err)
+	}
+	if err := c.Release(ctx, lease); err != nil {
+		t.Fatalf("Release() = %v", err)
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	wantEncoded := []dhcp4.MessageType{dhcp4.DHCPDiscover, dhcp4.DHCPRequest, dhcp4.DHCPRelease}
+	if !equalTypes(rc.encoded, wantEncoded) {
+		t.Errorf("encoded %v, want %v", rc.encoded, wantEncoded)
+	}
+	wantDecoded := []dhcp4.MessageType{dhcp4.DHCPOffer, dhcp4.DHCPACK}
+	if !equalTypes(rc.decoded, wantDecoded) {
+		t.Errorf("decoded %v, want %v", rc.decoded, wantDecoded)
+	}
+}
+
+func equalTypes(a, b []dhcp4.MessageType) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
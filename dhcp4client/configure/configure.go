@@ -0,0 +1,159 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package configure applies DHCPv4 leases to Linux network interfaces and
+// undoes them again: the leased address, the routes, the interface MTU and
+// the resolver configuration.
+//
+// It is meant for initramfs and other minimal systems that want to acquire
+// and apply a lease in one call instead of running ip(8):
+//
+//	cfg, err := configure.Acquire(ctx, "eth0")
+//	...
+//	defer cfg.Undo()
+package configure
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/mergetb/dhcp4/dhcp4client"
+)
+
+// DefaultResolvConf is the resolver configuration file written unless
+// WithResolvConf says otherwise.
+const DefaultResolvConf = "/etc/resolv.conf"
+
+// maxNameServers is the number of name servers the resolver uses, MAXNS of
+// resolv.conf(5).
+const maxNameServers = 3
+
+// Config is a lease applied to an interface. It is not safe for concurrent
+// use.
+type Config struct {
+	iface      string
+	lease      *dhcp4client.Lease
+	clientOpts []dhcp4client.ClientOpt
+
+	// mtu is the MTU of the interface before the lease changed it, or 0.
+	mtu int
+
+	resolvPath    string
+	resolvSaved   bool
+	resolvExisted bool
+	resolvPrev    []byte
+}
+
+// Opt is an option of Apply and Acquire.
+type Opt func(*Config)
+
+// WithResolvConf sets the resolver configuration file written with the name
+// servers and domain search list of the lease. The empty path leaves the
+// resolver configuration alone.
+func WithResolvConf(path string) Opt {
+	return func(c *Config) {
+		c.resolvPath = path
+	}
+}
+
+// WithClientOpts sets the options of the client Acquire requests the lease
+// with.
+func WithClientOpts(opts ...dhcp4client.ClientOpt) Opt {
+	return func(c *Config) {
+		c.clientOpts = append(c.clientOpts, opts...)
+	}
+}
+
+func newConfig(iface string, opts []Opt) *Config {
+	c := &Config{
+		iface:      iface,
+		resolvPath: DefaultResolvConf,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Interface returns the name of the configured interface.
+func (c *Config) Interface() string {
+	return c.iface
+}
+
+// Lease returns the applied lease, or nil after Undo.
+func (c *Config) Lease() *dhcp4client.Lease {
+	return c.lease
+}
+
+// resolvConf returns the resolver configuration for lease, or nil if it has
+// no name servers.
+func resolvConf(lease *dhcp4client.Lease) []byte {
+	servers := lease.Options.DomainNameServers()
+	if len(servers) == 0 {
+		return nil
+	}
+	if len(servers) > maxNameServers {
+		servers = servers[:maxNameServers]
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# Generated for the DHCP lease of %v.\n", lease.IP)
+	search := lease.Options.DomainSearch()
+	if len(search) == 0 {
+		if name := lease.Options.DomainName(); name != "" {
+			search = []string{name}
+		}
+	}
+	if len(search) > 0 {
+		fmt.Fprint(&b, "search")
+		for _, name := range search {
+			fmt.Fprintf(&b, " %s", name)
+		}
+		fmt.Fprintln(&b)
+	}
+	for _, ip := range servers {
+		fmt.Fprintf(&b, "nameserver %v\n", ip)
+	}
+	return b.Bytes()
+}
+
+// applyResolv writes the resolver configuration of lease, saving the
+// previous contents of the file first. If lease has no name servers, the
+// previous contents are restored.
+func (c *Config) applyResolv(lease *dhcp4client.Lease) error {
+	if c.resolvPath == "" {
+		return nil
+	}
+	data := resolvConf(lease)
+	if data == nil {
+		return c.restoreResolv()
+	}
+	if !c.resolvSaved {
+		prev, err := ioutil.ReadFile(c.resolvPath)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		c.resolvSaved, c.resolvExisted, c.resolvPrev = true, err == nil, prev
+	}
+	return ioutil.WriteFile(c.resolvPath, data, 0644)
+}
+
+// restoreResolv restores the resolver configuration saved by applyResolv.
+func (c *Config) restoreResolv() error {
+	if !c.resolvSaved {
+		return nil
+	}
+	var err error
+	if c.resolvExisted {
+		err = ioutil.WriteFile(c.resolvPath, c.resolvPrev, 0644)
+	} else if err = os.Remove(c.resolvPath); os.IsNotExist(err) {
+		err = nil
+	}
+	if err == nil {
+		c.resolvSaved, c.resolvPrev = false, nil
+	}
+	return err
+}
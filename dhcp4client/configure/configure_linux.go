@@ -0,0 +1,117 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package configure
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mergetb/dhcp4/dhcp4client"
+	"github.com/vishvananda/netlink"
+)
+
+// Apply configures the interface named iface with lease, see
+// dhcp4client.Configure, and writes the resolver configuration. If this
+// fails, whatever was applied is undone.
+func Apply(iface string, lease *dhcp4client.Lease, opts ...Opt) (*Config, error) {
+	c := newConfig(iface, opts)
+	if err := c.Update(lease); err != nil {
+		c.Undo()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Acquire requests a lease on the interface named iface with
+// dhcp4client.Acquire and applies it.
+func Acquire(ctx context.Context, iface string, opts ...Opt) (*Config, error) {
+	c := newConfig(iface, opts)
+	lease, err := dhcp4client.Acquire(ctx, iface, c.clientOpts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Update(lease); err != nil {
+		c.Undo()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Update applies a renewed or new lease. The address of the previous lease
+// is removed if it changed, and the address lifetime is extended otherwise.
+func (c *Config) Update(lease *dhcp4client.Lease) error {
+	link, err := netlink.LinkByName(c.iface)
+	if err != nil {
+		return err
+	}
+	if c.lease != nil && !c.lease.IP.Equal(lease.IP) {
+		if err := dhcp4client.Unconfigure(c.iface, c.lease); err != nil {
+			return err
+		}
+		c.lease = nil
+	}
+	if mtu := int(lease.Options.InterfaceMTU()); c.mtu == 0 && mtu >= 68 && mtu != link.Attrs().MTU {
+		c.mtu = link.Attrs().MTU
+	}
+	if err := dhcp4client.Configure(c.iface, lease); err != nil {
+		return err
+	}
+	c.lease = lease
+	return c.applyResolv(lease)
+}
+
+// Undo removes the applied lease from the interface, restores its MTU and
+// restores the previous resolver configuration.
+func (c *Config) Undo() error {
+	var first error
+	if c.lease != nil {
+		if err := dhcp4client.Unconfigure(c.iface, c.lease); err != nil {
+			first = err
+		} else {
+			c.lease = nil
+		}
+	}
+	if c.mtu != 0 {
+		link, err := netlink.LinkByName(c.iface)
+		if err == nil {
+			err = netlink.LinkSetMTU(link, c.mtu)
+		}
+		if err != nil && first == nil {
+			first = fmt.Errorf("restore MTU of %s to %d: %v", c.iface, c.mtu, err)
+		} else if err == nil {
+			c.mtu = 0
+		}
+	}
+	if err := c.restoreResolv(); err != nil && first == nil {
+		first = err
+	}
+	return first
+}
+
+// Handle applies an event of dhcp4client.Client.Maintain: new and extended
+// leases are applied with Update, and lost and expired leases are undone.
+func (c *Config) Handle(ev dhcp4client.LeaseEvent) error {
+	switch ev.Kind {
+	case dhcp4client.LeaseLost, dhcp4client.LeaseExpired:
+		return c.Undo()
+	}
+	if ev.Lease == nil {
+		return nil
+	}
+	return c.Update(ev.Lease)
+}
+
+// Release releases the applied lease with client and undoes it, even if
+// releasing failed.
+func (c *Config) Release(ctx context.Context, client *dhcp4client.Client) error {
+	var err error
+	if c.lease != nil {
+		err = client.Release(ctx, c.lease)
+	}
+	if uerr := c.Undo(); err == nil {
+		err = uerr
+	}
+	return err
+}
@@ -0,0 +1,101 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package configure
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+	"github.com/mergetb/dhcp4/dhcp4client"
+	"github.com/vishvananda/netlink"
+)
+
+func TestApplyAndUndo(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("needs root")
+	}
+	veth := &netlink.Veth{
+		LinkAttrs: netlink.LinkAttrs{Name: "dhcptest-apply"},
+		PeerName:  "dhcptest-applyp",
+	}
+	if err := netlink.LinkAdd(veth); err != nil {
+		t.Skipf("cannot create veth: %v", err)
+	}
+	defer netlink.LinkDel(veth)
+	link, err := netlink.LinkByName(veth.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := netlink.LinkSetUp(link); err != nil {
+		t.Fatal(err)
+	}
+	mtu := link.Attrs().MTU
+
+	dir, err := ioutil.TempDir("", "resolv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	resolv := filepath.Join(dir, "resolv.conf")
+
+	lease := func(ip net.IP) *dhcp4client.Lease {
+		return &dhcp4client.Lease{
+			IP:       ip,
+			Start:    time.Now(),
+			Duration: time.Hour,
+			Options: dhcp4.Options{
+				dhcp4.OptionSubnetMask:        {255, 255, 255, 0},
+				dhcp4.OptionRouters:           {192, 0, 2, 1},
+				dhcp4.OptionInterfaceMTU:      {0x05, 0x78},
+				dhcp4.OptionDomainNameServers: {192, 0, 2, 1},
+			},
+		}
+	}
+	addrs := func() []string {
+		list, err := netlink.AddrList(link, netlink.FAMILY_V4)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var s []string
+		for _, a := range list {
+			s = append(s, a.IPNet.String())
+		}
+		return s
+	}
+
+	c, err := Apply(veth.Name, lease(net.IP{192, 0, 2, 10}), WithResolvConf(resolv))
+	if err != nil {
+		t.Fatalf("Apply() = %v", err)
+	}
+	if _, err := os.Stat(resolv); err != nil {
+		t.Errorf("resolv.conf not written: %v", err)
+	}
+
+	// A new address replaces the old one.
+	if err := c.Handle(dhcp4client.LeaseEvent{Kind: dhcp4client.LeaseReacquired, Lease: lease(net.IP{192, 0, 2, 11})}); err != nil {
+		t.Fatalf("Handle(reacquired) = %v", err)
+	}
+	if got := addrs(); len(got) != 1 || got[0] != "192.0.2.11/24" {
+		t.Errorf("addresses %v, want 192.0.2.11/24", got)
+	}
+
+	if err := c.Handle(dhcp4client.LeaseEvent{Kind: dhcp4client.LeaseExpired, Lease: c.Lease()}); err != nil {
+		t.Fatalf("Handle(expired) = %v", err)
+	}
+	if got := addrs(); len(got) != 0 {
+		t.Errorf("addresses after expiry %v, want none", got)
+	}
+	if l, err := netlink.LinkByIndex(link.Attrs().Index); err != nil || l.Attrs().MTU != mtu {
+		t.Errorf("MTU not restored to %d: %v", mtu, err)
+	}
+	if _, err := os.Stat(resolv); !os.IsNotExist(err) {
+		t.Errorf("resolv.conf after expiry: %v, want it removed", err)
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package configure
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mergetb/dhcp4"
+	"github.com/mergetb/dhcp4/dhcp4client"
+)
+
+func TestResolvConf(t *testing.T) {
+	for _, tt := range []struct {
+		desc string
+		opts dhcp4.Options
+		want string
+	}{
+		{
+			desc: "no name servers",
+			opts: dhcp4.Options{dhcp4.OptionDomainName: []byte("example.com")},
+		},
+		{
+			desc: "domain name",
+			opts: dhcp4.Options{
+				dhcp4.OptionDomainNameServers: {192, 168, 1, 1},
+				dhcp4.OptionDomainName:        []byte("example.com"),
+			},
+			want: "# Generated for the DHCP lease of 192.168.1.10.\nsearch example.com\nnameserver 192.168.1.1\n",
+		},
+		{
+			desc: "search list and too many servers",
+			opts: dhcp4.Options{
+				dhcp4.OptionDomainNameServers: {10, 0, 0, 1, 10, 0, 0, 2, 10, 0, 0, 3, 10, 0, 0, 4},
+				dhcp4.OptionDomainName:        []byte("example.com"),
+				dhcp4.OptionDomainSearch:      {1, 'a', 3, 'c', 'o', 'm', 0, 1, 'b', 0xc0, 2},
+			},
+			want: "# Generated for the DHCP lease of 192.168.1.10.\nsearch a.com b.com\nnameserver 10.0.0.1\nnameserver 10.0.0.2\nnameserver 10.0.0.3\n",
+		},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			got := resolvConf(&dhcp4client.Lease{IP: net.IP{192, 168, 1, 10}, Options: tt.opts})
+			if string(got) != tt.want {
+				t.Errorf("resolvConf() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolvConfRestore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "resolv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	lease := &dhcp4client.Lease{
+		IP:      net.IP{192, 168, 1, 10},
+		Options: dhcp4.Options{dhcp4.OptionDomainNameServers: {192, 168, 1, 1}},
+	}
+	for _, tt := range []struct {
+		desc string
+		prev []byte
+	}{
+		{desc: "existing", prev: []byte("nameserver 127.0.0.53\n")},
+		{desc: "missing"},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			path := filepath.Join(dir, tt.desc)
+			if tt.prev != nil {
+				if err := ioutil.WriteFile(path, tt.prev, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			c := newConfig("eth0", []Opt{WithResolvConf(path)})
+
+			// Applying twice must not save the written file.
+			for i := 0; i < 2; i++ {
+				if err := c.applyResolv(lease); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got, err := ioutil.ReadFile(path); err != nil || string(got) != string(resolvConf(lease)) {
+				t.Errorf("resolv.conf = %q, %v, want %q", got, err, resolvConf(lease))
+			}
+
+			if err := c.restoreResolv(); err != nil {
+				t.Fatal(err)
+			}
+			got, err := ioutil.ReadFile(path)
+			if tt.prev == nil {
+				if !os.IsNotExist(err) {
+					t.Errorf("restored resolv.conf = %q, %v, want it removed", got, err)
+				}
+			} else if err != nil || string(got) != string(tt.prev) {
+				t.Errorf("restored resolv.conf = %q, %v, want %q", got, err, tt.prev)
+			}
+		})
+	}
+}
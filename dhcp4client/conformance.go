@@ -0,0 +1,337 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+)
+
+// CheckResult is the result of a ConformanceCheck.
+type CheckResult int
+
+const (
+	// CheckPass means the server behaved as the RFC requires.
+	CheckPass CheckResult = iota
+
+	// CheckWarn means the server did not do what the RFC recommends
+	// (SHOULD), or what a later RFC added.
+	CheckWarn
+
+	// CheckFail means the server did not do what the RFC requires (MUST).
+	CheckFail
+)
+
+// String implements fmt.Stringer.
+func (r CheckResult) String() string {
+	switch r {
+	case CheckPass:
+		return "PASS"
+	case CheckWarn:
+		return "WARN"
+	case CheckFail:
+		return "FAIL"
+	default:
+		return fmt.Sprintf("CheckResult(%d)", int(r))
+	}
+}
+
+// ConformanceCheck is one check of a ConformanceReport.
+type ConformanceCheck struct {
+	// Name describes what was checked.
+	Name string
+
+	// Section is the RFC and section the check is based on.
+	Section string
+
+	Result CheckResult
+
+	// Detail explains why the check did not pass.
+	Detail string
+}
+
+// String implements fmt.Stringer.
+func (cc ConformanceCheck) String() string {
+	s := fmt.Sprintf("%v  %s (%s)", cc.Result, cc.Name, cc.Section)
+	if cc.Detail != "" {
+		s += ": " + cc.Detail
+	}
+	return s
+}
+
+// ConformanceReport describes how a server handled the exchanges of
+// Conformance.
+type ConformanceReport struct {
+	// ServerID is the server identifier of the server tested.
+	ServerID net.IP
+
+	// OfferTime, AckTime and RenewTime are how long the server took to
+	// answer the DISCOVER, the REQUEST and the renewal.
+	OfferTime time.Duration
+	AckTime   time.Duration
+	RenewTime time.Duration
+
+	// Options are the options the server sent in its ACK when asked for
+	// all of them.
+	Options []dhcp4.OptionCode
+
+	Checks []ConformanceCheck
+}
+
+// Failed returns whether any check failed.
+func (r *ConformanceReport) Failed() bool {
+	for _, c := range r.Checks {
+		if c.Result == CheckFail {
+			return true
+		}
+	}
+	return false
+}
+
+// String implements fmt.Stringer. It returns a human-readable report.
+func (r *ConformanceReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "DHCP server %v\n", r.ServerID)
+	fmt.Fprintf(&b, "Timing: OFFER after %v, ACK after %v, renewal ACK after %v\n", r.OfferTime, r.AckTime, r.RenewTime)
+	codes := make([]string, 0, len(r.Options))
+	for _, code := range r.Options {
+		codes = append(codes, fmt.Sprint(uint8(code)))
+	}
+	fmt.Fprintf(&b, "Supported options: %s\n", strings.Join(codes, " "))
+	for _, c := range r.Checks {
+		fmt.Fprintln(&b, c)
+	}
+	return b.String()
+}
+
+// check records a check that passed if problem is empty, and resulted in
+// otherwise.
+func (r *ConformanceReport) check(name, section, problem string, otherwise CheckResult) {
+	c := ConformanceCheck{Name: name, Section: section}
+	if problem != "" {
+		c.Result, c.Detail = otherwise, problem
+	}
+	r.Checks = append(r.Checks, c)
+}
+
+// conformanceAddr is the address Conformance requests to provoke a NAK. It
+// is from TEST-NET-1 (RFC 5737), so no server hands it out.
+var conformanceAddr = net.IP{192, 0, 2, 1}
+
+// Conformance runs a battery of exchanges against the server with
+// identifier server, or the first server to answer if server is nil, and
+// reports how the server conforms to RFC 2131 and RFC 6842: the options it
+// supports, how fast it answers, which request fields it repeats in
+// responses, and whether it NAKs requests for wrong addresses.
+//
+// Conformance acquires, renews and releases a lease. It returns an error
+// only if the server could not be tested at all, e.g. because no server
+// answered.
+func (c *Client) Conformance(ctx context.Context, server net.IP) (*ConformanceReport, error) {
+	r := &ConformanceReport{}
+	fromServer := func(typ dhcp4.MessageType) func(*dhcp4.Packet) bool {
+		return func(p *dhcp4.Packet) bool {
+			return p.Options.MessageType() == typ &&
+				(server == nil || p.Options.ServerIdentifier().Equal(server))
+		}
+	}
+
+	// Ask for every option to learn which ones the server supports.
+	all := make([]dhcp4.OptionCode, 0, 254)
+	for code := dhcp4.OptionCode(1); code < dhcp4.End; code++ {
+		all = append(all, code)
+	}
+	id := c.Identity()
+	if len(id.ClientID) == 0 {
+		// Check that the server echoes a client identifier.
+		id.ClientID = append([]byte{1}, id.HardwareAddr...)
+	}
+
+	discover, err := c.NewDiscoverPacket()
+	if err == nil {
+		err = identify(discover, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	discover.Options.SetParameterRequestList(all)
+	start := time.Now()
+	offer, err := c.exchange(ctx, DefaultServers, discover, fromServer(dhcp4.DHCPOffer))
+	if err != nil {
+		return nil, fmt.Errorf("no OFFER: %v", err)
+	}
+	r.OfferTime = time.Since(start)
+	r.ServerID = offer.Options.ServerIdentifier()
+	checkReply(r, "OFFER", discover, offer)
+	var problem string
+	switch {
+	case offer.YIAddr == nil || offer.YIAddr.IsUnspecified():
+		problem = "no address in yiaddr"
+	case r.ServerID == nil:
+		problem = "no server identifier"
+	case offer.Options.Get(dhcp4.OptionIPAddressLeaseTime) == nil:
+		problem = "no lease time"
+	}
+	r.check("OFFER has an address, server identifier and lease time", "RFC 2131 Section 4.3.1", problem, CheckFail)
+	if problem != "" {
+		return r, nil
+	}
+
+	request, err := c.NewRequestPacket(offer)
+	if err == nil {
+		err = identify(request, id)
+	}
+	if err != nil {
+		return r, err
+	}
+	request.Options.SetParameterRequestList(all)
+	start = time.Now()
+	ack, err := c.exchange(ctx, DefaultServers, request, func(p *dhcp4.Packet) bool {
+		return fromServer(dhcp4.DHCPACK)(p) || fromServer(dhcp4.DHCPNAK)(p)
+	})
+	if err != nil {
+		r.check("REQUEST for the offered address is ACKed", "RFC 2131 Section 4.3.2", err.Error(), CheckFail)
+		return r, nil
+	}
+	r.AckTime = time.Since(start)
+	problem = ""
+	switch {
+	case ack.Options.MessageType() != dhcp4.DHCPACK:
+		problem = fmt.Sprintf("got %v", ack.Options.MessageType())
+	case !ack.YIAddr.Equal(offer.YIAddr):
+		problem = fmt.Sprintf("ACKed %v, but offered %v", ack.YIAddr, offer.YIAddr)
+	}
+	r.check("REQUEST for the offered address is ACKed", "RFC 2131 Section 4.3.2", problem, CheckFail)
+	if problem != "" {
+		return r, nil
+	}
+	checkReply(r, "ACK", request, ack)
+	for code := range ack.Options {
+		if code != dhcp4.OptionDHCPMessageType {
+			r.Options = append(r.Options, code)
+		}
+	}
+	sort.Slice(r.Options, func(i, j int) bool { return r.Options[i] < r.Options[j] })
+	lease, err := newLease(ack, start)
+	if err != nil {
+		r.check("ACK grants a lease", "RFC 2131 Section 4.3.1", err.Error(), CheckFail)
+		return r, nil
+	}
+	checkLeaseTimes(r, ack)
+
+	// Renew the lease, as clients do at T1.
+	renew, err := c.renewPacket(lease)
+	if err == nil {
+		err = identify(renew, id)
+	}
+	if err != nil {
+		return r, err
+	}
+	start = time.Now()
+	renewed, err := c.exchange(ctx, &net.UDPAddr{IP: lease.ServerID, Port: ServerPort}, renew, fromServer(dhcp4.DHCPACK))
+	problem = ""
+	switch {
+	case err != nil:
+		problem = err.Error()
+	case !renewed.YIAddr.Equal(lease.IP):
+		problem = fmt.Sprintf("ACKed %v, but leased %v", renewed.YIAddr, lease.IP)
+	default:
+		r.RenewTime = time.Since(start)
+	}
+	r.check("unicast renewal is ACKed", "RFC 2131 Section 4.4.5", problem, CheckFail)
+
+	// Request an address the client does not have from INIT-REBOOT.
+	reboot, err := c.NewDiscoverPacket()
+	if err == nil {
+		err = identify(reboot, id)
+	}
+	if err != nil {
+		return r, err
+	}
+	reboot.Options.SetMessageType(dhcp4.DHCPRequest)
+	reboot.Options.SetRequestedIPAddress(conformanceAddr)
+	nak, err := c.exchange(ctx, DefaultServers, reboot, fromServer(dhcp4.DHCPNAK))
+	problem = ""
+	switch {
+	case err != nil:
+		problem = fmt.Sprintf("no NAK for %v: %v", conformanceAddr, err)
+	case nak.YIAddr != nil && !nak.YIAddr.IsUnspecified():
+		problem = fmt.Sprintf("NAK with yiaddr %v", nak.YIAddr)
+	case nak.Options.Get(dhcp4.OptionIPAddressLeaseTime) != nil:
+		problem = "NAK with a lease time"
+	case nak.Options.ServerIdentifier() == nil:
+		problem = "NAK without server identifier"
+	}
+	r.check("REQUEST for a wrong address is NAKed", "RFC 2131 Section 4.3.2", problem, CheckWarn)
+
+	if err := c.release(ctx, lease, id); err != nil {
+		return r, err
+	}
+	return r, nil
+}
+
+// checkReply adds the checks every reply to request must pass to r.
+func checkReply(r *ConformanceReport, typ string, request, reply *dhcp4.Packet) {
+	var problems []string
+	for _, f := range dhcp4.Lint(reply) {
+		problems = append(problems, f.String())
+	}
+	r.check(typ+" is well-formed", "RFC 2131 Section 4.3.1", strings.Join(problems, "; "), CheckFail)
+
+	problems = nil
+	if !bytes.Equal(reply.CHAddr, request.CHAddr) {
+		problems = append(problems, fmt.Sprintf("chaddr %v, want %v", reply.CHAddr, request.CHAddr))
+	}
+	if reply.Broadcast != request.Broadcast {
+		problems = append(problems, fmt.Sprintf("broadcast flag %v, want %v", reply.Broadcast, request.Broadcast))
+	}
+	if !sameAddr(reply.GIAddr, request.GIAddr) {
+		problems = append(problems, fmt.Sprintf("giaddr %v, want %v", reply.GIAddr, request.GIAddr))
+	}
+	r.check(typ+" repeats chaddr, flags and giaddr", "RFC 2131 Section 4.3.1, Table 3", strings.Join(problems, "; "), CheckFail)
+
+	var problem string
+	if got, want := reply.Options.ClientIdentifier(), request.Options.ClientIdentifier(); !bytes.Equal(got, want) {
+		problem = fmt.Sprintf("client identifier %x, want %x", got, want)
+	}
+	r.check(typ+" repeats the client identifier", "RFC 6842 Section 3", problem, CheckWarn)
+}
+
+// sameAddr returns whether a and b are the same address, with nil the same
+// as 0.0.0.0.
+func sameAddr(a, b net.IP) bool {
+	if a == nil {
+		a = net.IPv4zero
+	}
+	if b == nil {
+		b = net.IPv4zero
+	}
+	return a.Equal(b)
+}
+
+// checkLeaseTimes adds the check of the lease times in ack to r.
+func checkLeaseTimes(r *ConformanceReport, ack *dhcp4.Packet) {
+	lease := ack.Options.LeaseTime()
+	t1, t2 := ack.Options.RenewalTime(), ack.Options.RebindingTime()
+	var problem string
+	switch {
+	case lease == 0:
+		// Infinite or no lease time; nothing to compare to.
+	case t1 != 0 && t1 >= lease:
+		problem = fmt.Sprintf("T1 %v is not before the lease time %v", t1, lease)
+	case t2 != 0 && t2 >= lease:
+		problem = fmt.Sprintf("T2 %v is not before the lease time %v", t2, lease)
+	case t1 != 0 && t2 != 0 && t1 >= t2:
+		problem = fmt.Sprintf("T1 %v is not before T2 %v", t1, t2)
+	}
+	r.check("T1 < T2 < lease time", "RFC 2131 Section 4.4.5", problem, CheckWarn)
+}
@@ -0,0 +1,105 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+)
+
+func TestConformance(t *testing.T) {
+	id := Identity{
+		HardwareAddr: net.HardwareAddr{0x02, 0, 0, 0, 0, 1},
+		ClientID:     []byte{1, 0x02, 0, 0, 0, 0, 1},
+	}
+	ip := net.IP{192, 168, 1, 10}
+	// conformant returns a reply of type typ repeating everything it must.
+	conformant := func(typ dhcp4.MessageType, ip net.IP) *dhcp4.Packet {
+		p := identityReply(typ, ip, id)
+		p.CHAddr = id.HardwareAddr
+		p.Broadcast = true
+		p.Options.SetClientIdentifier(id.ClientID)
+		return p
+	}
+	nak := conformant(dhcp4.DHCPNAK, nil)
+	delete(nak.Options, dhcp4.OptionIPAddressLeaseTime)
+	sloppyOffer := identityReply(dhcp4.DHCPOffer, ip, id)
+	sloppyOffer.CHAddr = id.HardwareAddr
+
+	for _, tt := range []struct {
+		desc      string
+		responses [][]*dhcp4.Packet
+		// want are the results of checks by name prefix; all others
+		// must pass.
+		want   map[string]CheckResult
+		failed bool
+	}{
+		{
+			desc: "conformant",
+			responses: [][]*dhcp4.Packet{
+				{conformant(dhcp4.DHCPOffer, ip)},
+				{conformant(dhcp4.DHCPACK, ip)},
+				{conformant(dhcp4.DHCPACK, ip)},
+				{nak},
+				// The release is not answered.
+				{},
+			},
+		},
+		{
+			desc: "sloppy",
+			responses: [][]*dhcp4.Packet{
+				{sloppyOffer},
+				{conformant(dhcp4.DHCPACK, ip)},
+				{conformant(dhcp4.DHCPACK, ip)},
+				// No NAK.
+				{},
+				{},
+			},
+			want: map[string]CheckResult{
+				"OFFER repeats chaddr":                 CheckFail,
+				"OFFER repeats the client identifier":  CheckWarn,
+				"REQUEST for a wrong address is NAKed": CheckWarn,
+			},
+			failed: true,
+		},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			c, _ := serveClient(ctx, t, tt.responses, WithIdentity(id))
+			defer c.Close()
+
+			r, err := c.Conformance(ctx, nil)
+			if err != nil {
+				t.Fatalf("Conformance() = %v", err)
+			}
+			if !r.ServerID.Equal(serverA) {
+				t.Errorf("report for server %v, want %v", r.ServerID, serverA)
+			}
+			if len(r.Checks) != 11 {
+				t.Errorf("report has %d checks, want 11:\n%v", len(r.Checks), r)
+			}
+			for _, cc := range r.Checks {
+				want := CheckPass
+				for prefix, result := range tt.want {
+					if strings.HasPrefix(cc.Name, prefix) {
+						want = result
+					}
+				}
+				if cc.Result != want {
+					t.Errorf("check %q = %v (%s), want %v", cc.Name, cc.Result, cc.Detail, want)
+				}
+			}
+			if r.Failed() != tt.failed {
+				t.Errorf("Failed() = %v, want %v", r.Failed(), tt.failed)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/u-root/u-root/pkg/uio"
+	"golang.org/x/net/bpf"
+)
+
+var (
+	BroadcastMac = net.HardwareAddr([]byte{255, 255, 255, 255, 255, 255})
+)
+
+// udpFilter returns a BPF program accepting IPv4 packets, without link-layer
+// header, that carry the first fragment of a UDP datagram to port.
+func udpFilter(port int) []bpf.Instruction {
+	return udpFilterAt(0, port)
+}
+
+// udpFilterAt is udpFilter for packets whose IPv4 header starts at off, after
+// a link-layer header.
+func udpFilterAt(off uint32, port int) []bpf.Instruction {
+	return []bpf.Instruction{
+		// Protocol.
+		bpf.LoadAbsolute{Off: off + 9, Size: 1},
+		bpf.JumpIf{Cond: bpf.JumpNotEqual, Val: uint32(UDPProtocolNumber), SkipTrue: 6},
+		// Fragment offset.
+		bpf.LoadAbsolute{Off: off + 6, Size: 2},
+		bpf.JumpIf{Cond: bpf.JumpBitsSet, Val: 0x1fff, SkipTrue: 4},
+		// X = IP header length.
+		bpf.LoadMemShift{Off: off},
+		// UDP destination port.
+		bpf.LoadIndirect{Off: off + 2, Size: 2},
+		bpf.JumpIf{Cond: bpf.JumpNotEqual, Val: uint32(port), SkipTrue: 1},
+		bpf.RetConstant{Val: 0xffff},
+		bpf.RetConstant{Val: 0},
+	}
+}
+
+// UDPPacketConn implements net.PacketConn and marshals and unmarshals UDP
+// packets.
+type UDPPacketConn struct {
+	net.PacketConn
+
+	// boundAddr is the address this UDPPacketConn is "bound" to.
+	//
+	// Calls to ReadFrom will only return packets destined to this address.
+	boundAddr *net.UDPAddr
+}
+
+// NewBroadcastUDPConn returns a PacketConn that marshals and unmarshals UDP
+// packets, sending them to the broadcast MAC at on rawPacketConn.
+//
+// Calls to ReadFrom will only return packets destined to boundAddr.
+func NewBroadcastUDPConn(rawPacketConn net.PacketConn, boundAddr *net.UDPAddr) net.PacketConn {
+	return &UDPPacketConn{
+		PacketConn: rawPacketConn,
+		boundAddr:  boundAddr,
+	}
+}
+
+func udpMatch(addr *net.UDPAddr, bound *net.UDPAddr) bool {
+	if bound == nil {
+		return true
+	}
+	if bound.IP != nil && !bound.IP.Equal(addr.IP) {
+		return false
+	}
+	return bound.Port == addr.Port
+}
+
+// ReadFrom implements net.PacketConn.ReadFrom.
+//
+// ReadFrom reads raw IP packets and will try to match them against
+// upc.boundAddr. Any matching packets are returned via the given buffer.
+func (upc *UDPPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	ipLen := IPv4MaximumHeaderSize
+	udpLen := UDPMinimumSize
+
+	for {
+		pkt := make([]byte, ipLen+udpLen+len(b))
+		n, _, err := upc.PacketConn.ReadFrom(pkt)
+		if err != nil {
+			return 0, nil, err
+		}
+		pkt = pkt[:n]
+		buf := uio.NewBigEndianBuffer(pkt)
+
+		// To read the header length, access data directly.
+		ipHdr := IPv4(buf.Data())
+		ipHdr = IPv4(buf.Consume(int(ipHdr.HeaderLength())))
+
+		if ipHdr.TransportProtocol() != UDPProtocolNumber {
+			continue
+		}
+		udpHdr := UDP(buf.Consume(udpLen))
+
+		addr := &net.UDPAddr{
+			IP:   net.IP(ipHdr.DestinationAddress()),
+			Port: int(udpHdr.DestinationPort()),
+		}
+		if !udpMatch(addr, upc.boundAddr) {
+			continue
+		}
+		return copy(b, buf.ReadAll()), addr, nil
+	}
+}
+
+// ReadFromTimestamped implements TimestampedPacketConn.
+//
+// The raw socket does not expose kernel timestamps, so the time is taken
+// right after the packet was read.
+func (upc *UDPPacketConn) ReadFromTimestamped(b []byte) (int, net.Addr, time.Time, error) {
+	n, addr, err := upc.ReadFrom(b)
+	return n, addr, time.Now(), err
+}
+
+// WriteTo implements net.PacketConn.WriteTo and broadcasts all packets at the
+// raw socket level.
+//
+// WriteTo wraps the given packet in the appropriate UDP and IP header before
+// sending it on the packet conn.
+func (upc *UDPPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	udpAddr, ok := addr.(*net.UDPAddr)
+	if !ok {
+		return 0, fmt.Errorf("must supply UDPAddr")
+	}
+
+	// Using the boundAddr is not quite right here, but it works.
+	packet := udp4pkt(b, udpAddr, upc.boundAddr)
+	return upc.PacketConn.WriteTo(packet, linkAddr(BroadcastMac))
+}
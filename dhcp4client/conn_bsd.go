@@ -0,0 +1,320 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build dragonfly || freebsd || netbsd || openbsd
+// +build dragonfly freebsd netbsd openbsd
+
+package dhcp4client
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/mdlayher/ethernet"
+	"golang.org/x/net/bpf"
+	"golang.org/x/sys/unix"
+)
+
+// etherHeaderLen is the length of an untagged Ethernet header.
+const etherHeaderLen = 14
+
+// maxBPFDevices is the number of numbered BPF devices, /dev/bpf0 and up,
+// tried on systems without the cloning /dev/bpf.
+const maxBPFDevices = 256
+
+// NewPacketUDPConn returns a UDP connection bound to the interface and port
+// given based on a BPF device. All packets are broadcasted.
+//
+// The connection works on interfaces without an IPv4 address. A BPF filter
+// makes the kernel deliver only untagged UDP packets destined to port.
+// Opening BPF devices usually requires root.
+func NewPacketUDPConn(iface string, port int) (net.PacketConn, error) {
+	ifc, err := net.InterfaceByName(iface)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := bpf.Assemble(etherUDPFilter(port))
+	if err != nil {
+		return nil, err
+	}
+	bc, err := listenBPF(ifc, filter)
+	if err != nil {
+		return nil, err
+	}
+	return NewBroadcastUDPConn(bc, &net.UDPAddr{Port: port}), nil
+}
+
+// NewIPv4UDPConn returns NewPacketUDPConn(iface, port): the BSDs have no
+// socket option binding a UDP socket to an interface, so replies to
+// clients on several interfaces could not be told apart.
+func NewIPv4UDPConn(iface string, port int) (net.PacketConn, error) {
+	return NewPacketUDPConn(iface, port)
+}
+
+// newInterfaceConn returns the connection of WithInterface: BPF devices are
+// bound to one interface.
+func newInterfaceConn(iface string, port int) (net.PacketConn, error) {
+	return NewPacketUDPConn(iface, port)
+}
+
+// etherUDPFilter is udpFilter for Ethernet frames: BPF devices, unlike
+// Linux packet sockets, deliver the link-layer header.
+func etherUDPFilter(port int) []bpf.Instruction {
+	prog := udpFilterAt(etherHeaderLen, port)
+	return append([]bpf.Instruction{
+		// EtherType.
+		bpf.LoadAbsolute{Off: 12, Size: 2},
+		bpf.JumpIf{Cond: bpf.JumpNotEqual, Val: uint32(ethernet.EtherTypeIPv4), SkipTrue: uint8(len(prog) - 1)},
+	}, prog...)
+}
+
+// linkAddr returns the address UDPPacketConn.WriteTo sends frames for mac
+// to.
+func linkAddr(mac net.HardwareAddr) net.Addr {
+	return &bpfAddr{HardwareAddr: mac}
+}
+
+// bpfAddr is the hardware address of the peer of a BPF device.
+type bpfAddr struct {
+	HardwareAddr net.HardwareAddr
+}
+
+// Network implements net.Addr.Network.
+func (a *bpfAddr) Network() string {
+	return "bpf"
+}
+
+// String implements net.Addr.String.
+func (a *bpfAddr) String() string {
+	return a.HardwareAddr.String()
+}
+
+// bpfConn is a net.PacketConn sending and receiving IPv4 packets in
+// Ethernet frames on a BPF device.
+type bpfConn struct {
+	f *os.File
+
+	// src is the hardware address of the interface.
+	src net.HardwareAddr
+
+	// mu guards buf and pending.
+	mu sync.Mutex
+
+	// buf is the read buffer, as large as the device's.
+	buf []byte
+
+	// pending is the part of buf holding frames read but not yet
+	// returned.
+	pending []byte
+}
+
+// listenBPF opens a BPF device on ifc that delivers the frames filter
+// accepts as soon as they arrive.
+func listenBPF(ifc *net.Interface, filter []bpf.RawInstruction) (*bpfConn, error) {
+	fd, err := openBPFDevice()
+	if err != nil {
+		return nil, fmt.Errorf("open BPF device for %s: %v", ifc.Name, err)
+	}
+	bc, err := setupBPF(fd, ifc, filter)
+	if err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("set up BPF device for %s: %v", ifc.Name, err)
+	}
+	return bc, nil
+}
+
+// openBPFDevice opens the cloning /dev/bpf, or the first free numbered
+// device on systems without one.
+func openBPFDevice() (int, error) {
+	fd, err := unix.Open("/dev/bpf", unix.O_RDWR, 0)
+	if err == nil {
+		return fd, nil
+	}
+	for i := 0; i < maxBPFDevices; i++ {
+		fd, err = unix.Open(fmt.Sprintf("/dev/bpf%d", i), unix.O_RDWR, 0)
+		if err != unix.EBUSY {
+			return fd, err
+		}
+	}
+	return -1, err
+}
+
+// setupBPF attaches the BPF device fd to ifc and installs filter.
+func setupBPF(fd int, ifc *net.Interface, filter []bpf.RawInstruction) (*bpfConn, error) {
+	// Return packets as they arrive rather than when the buffer is full.
+	one := uint32(1)
+	if err := ioctl(fd, unix.BIOCIMMEDIATE, unsafe.Pointer(&one)); err != nil {
+		return nil, fmt.Errorf("BIOCIMMEDIATE: %v", err)
+	}
+	// Keep the source address of the frames written.
+	if err := ioctl(fd, unix.BIOCSHDRCMPLT, unsafe.Pointer(&one)); err != nil {
+		return nil, fmt.Errorf("BIOCSHDRCMPLT: %v", err)
+	}
+	// struct ifreq is the interface name followed by a 16-byte union.
+	var ifr [unix.IFNAMSIZ + 16]byte
+	copy(ifr[:unix.IFNAMSIZ-1], ifc.Name)
+	if err := ioctl(fd, unix.BIOCSETIF, unsafe.Pointer(&ifr[0])); err != nil {
+		return nil, fmt.Errorf("BIOCSETIF: %v", err)
+	}
+	insns := make([]unix.BpfInsn, len(filter))
+	for i, ri := range filter {
+		insns[i] = unix.BpfInsn{Code: ri.Op, Jt: ri.Jt, Jf: ri.Jf, K: ri.K}
+	}
+	prog := unix.BpfProgram{Len: uint32(len(insns)), Insns: &insns[0]}
+	if err := ioctl(fd, unix.BIOCSETF, unsafe.Pointer(&prog)); err != nil {
+		return nil, fmt.Errorf("BIOCSETF: %v", err)
+	}
+	// Reads must use a buffer of exactly the device's size.
+	var blen uint32
+	if err := ioctl(fd, unix.BIOCGBLEN, unsafe.Pointer(&blen)); err != nil {
+		return nil, fmt.Errorf("BIOCGBLEN: %v", err)
+	}
+	// A non-blocking descriptor makes the file pollable, so deadlines
+	// work.
+	if err := unix.SetNonblock(fd, true); err != nil {
+		return nil, err
+	}
+	return &bpfConn{
+		f:   os.NewFile(uintptr(fd), "/dev/bpf"),
+		src: ifc.HardwareAddr,
+		buf: make([]byte, blen),
+	}, nil
+}
+
+// ioctl calls ioctl(2) on fd with a pointer argument.
+func ioctl(fd int, req uint, arg unsafe.Pointer) error {
+	if _, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(fd), uintptr(req), uintptr(arg)); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// bpfWordAlign rounds n up to the alignment of the headers in a BPF read
+// buffer.
+func bpfWordAlign(n int) int {
+	return (n + unix.BPF_ALIGNMENT - 1) &^ (unix.BPF_ALIGNMENT - 1)
+}
+
+// ReadFrom implements net.PacketConn.ReadFrom, returning the payload of the
+// next Ethernet frame and its source address, a *bpfAddr.
+func (bc *bpfConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	for {
+		for len(bc.pending) > 0 {
+			hdr := (*unix.BpfHdr)(unsafe.Pointer(&bc.pending[0]))
+			start := int(hdr.Hdrlen)
+			end := start + int(hdr.Caplen)
+			if end > len(bc.pending) {
+				bc.pending = nil
+				break
+			}
+			frame := bc.pending[start:end]
+			if next := bpfWordAlign(end); next < len(bc.pending) {
+				bc.pending = bc.pending[next:]
+			} else {
+				bc.pending = nil
+			}
+			if len(frame) <= etherHeaderLen {
+				continue
+			}
+			src := make(net.HardwareAddr, 6)
+			copy(src, frame[6:12])
+			return copy(b, frame[etherHeaderLen:]), &bpfAddr{HardwareAddr: src}, nil
+		}
+		n, err := bc.f.Read(bc.buf)
+		if err != nil {
+			return 0, nil, err
+		}
+		bc.pending = bc.buf[:n]
+	}
+}
+
+// WriteTo implements net.PacketConn.WriteTo, sending b in an Ethernet frame
+// to the hardware address of addr, a *bpfAddr.
+func (bc *bpfConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	ba, ok := addr.(*bpfAddr)
+	if !ok {
+		return 0, fmt.Errorf("must supply bpfAddr")
+	}
+	f := &ethernet.Frame{
+		Destination: ba.HardwareAddr,
+		Source:      bc.src,
+		EtherType:   ethernet.EtherTypeIPv4,
+		Payload:     b,
+	}
+	frame, err := f.MarshalBinary()
+	if err != nil {
+		return 0, err
+	}
+	if _, err := bc.f.Write(frame); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Close implements net.PacketConn.Close.
+func (bc *bpfConn) Close() error {
+	return bc.f.Close()
+}
+
+// LocalAddr implements net.PacketConn.LocalAddr.
+func (bc *bpfConn) LocalAddr() net.Addr {
+	return &bpfAddr{HardwareAddr: bc.src}
+}
+
+// SetDeadline implements net.PacketConn.SetDeadline.
+func (bc *bpfConn) SetDeadline(t time.Time) error {
+	return bc.f.SetDeadline(t)
+}
+
+// SetReadDeadline implements net.PacketConn.SetReadDeadline.
+func (bc *bpfConn) SetReadDeadline(t time.Time) error {
+	return bc.f.SetReadDeadline(t)
+}
+
+// SetWriteDeadline implements net.PacketConn.SetWriteDeadline.
+func (bc *bpfConn) SetWriteDeadline(t time.Time) error {
+	return bc.f.SetWriteDeadline(t)
+}
+
+// SetPromiscuous puts the interface of the device in promiscuous mode. BPF
+// devices cannot leave it: it ends when the device is closed.
+func (bc *bpfConn) SetPromiscuous(b bool) error {
+	if !b {
+		return errors.New("BPF devices cannot leave promiscuous mode")
+	}
+	rc, err := bc.f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var serr error
+	if err := rc.Control(func(fd uintptr) {
+		if _, _, errno := unix.Syscall(unix.SYS_IOCTL, fd, uintptr(unix.BIOCPROMISC), 0); errno != 0 {
+			serr = errno
+		}
+	}); err != nil {
+		return err
+	}
+	return serr
+}
+
+// setPromiscuous enables promiscuous mode on the BPF device underlying
+// conn.
+func setPromiscuous(conn net.PacketConn) error {
+	if upc, ok := conn.(*UDPPacketConn); ok {
+		conn = upc.PacketConn
+	}
+	bc, ok := conn.(*bpfConn)
+	if !ok {
+		return fmt.Errorf("connection %T is not a BPF device and cannot be promiscuous", conn)
+	}
+	return bc.SetPromiscuous(true)
+}
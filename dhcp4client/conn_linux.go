@@ -8,17 +8,15 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"time"
+	"unsafe"
 
 	"github.com/mdlayher/ethernet"
 	"github.com/mdlayher/raw"
-	"github.com/u-root/u-root/pkg/uio"
+	"golang.org/x/net/bpf"
 	"golang.org/x/sys/unix"
 )
 
-var (
-	BroadcastMac = net.HardwareAddr([]byte{255, 255, 255, 255, 255, 255})
-)
-
 // NewIPv4UDPConn returns a UDP connection bound to both the interface and port
 // given based on a IPv4 DGRAM socket. The UDP connection allows broadcasting.
 func NewIPv4UDPConn(iface string, port int) (net.PacketConn, error) {
@@ -38,113 +36,124 @@ func NewIPv4UDPConn(iface string, port int) (net.PacketConn, error) {
 	if err := unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_REUSEADDR, 1); err != nil {
 		return nil, err
 	}
-	// Bind directly to the interface.
+	// Bind directly to the interface. Kernels before 5.7 require
+	// CAP_NET_RAW for this.
 	if err := unix.BindToDevice(fd, iface); err != nil {
-		return nil, err
+		return nil, permissionErr(fmt.Sprintf("bind to device %s", iface), CapNetRaw, err)
 	}
 	// Bind to the port.
 	if err := unix.Bind(fd, &unix.SockaddrInet4{Port: port}); err != nil {
+		return nil, bindErr(port, err)
+	}
+
+	conn, err := net.FilePacketConn(f)
+	if err != nil {
 		return nil, err
 	}
+	return newTimestampConn(conn.(*net.UDPConn))
+}
 
-	return net.FilePacketConn(f)
+// newInterfaceConn returns the connection of WithInterface.
+func newInterfaceConn(iface string, port int) (net.PacketConn, error) {
+	return NewIPv4UDPConn(iface, port)
 }
 
-// NewPacketUDPConn returns a UDP connection bound to the interface and port
-// given based on a raw packet socket. All packets are broadcasted.
-func NewPacketUDPConn(iface string, port int) (net.PacketConn, error) {
-	ifc, err := net.InterfaceByName(iface)
+// timestampConn is a UDP connection that reports kernel receive timestamps.
+type timestampConn struct {
+	*net.UDPConn
+}
+
+// newTimestampConn enables kernel receive timestamps (SO_TIMESTAMPNS) on conn.
+func newTimestampConn(conn *net.UDPConn) (*timestampConn, error) {
+	rc, err := conn.SyscallConn()
 	if err != nil {
 		return nil, err
 	}
-	rawConn, err := raw.ListenPacket(ifc, uint16(ethernet.EtherTypeIPv4), &raw.Config{LinuxSockDGRAM: true})
-	if err != nil {
+	var serr error
+	if err := rc.Control(func(fd uintptr) {
+		serr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_TIMESTAMPNS, 1)
+	}); err != nil {
 		return nil, err
 	}
-	return NewBroadcastUDPConn(rawConn, &net.UDPAddr{Port: port}), nil
+	if serr != nil {
+		return nil, serr
+	}
+	return &timestampConn{conn}, nil
 }
 
-// UDPPacketConn implements net.PacketConn and marshals and unmarshals UDP
-// packets.
-type UDPPacketConn struct {
-	net.PacketConn
-
-	// boundAddr is the address this UDPPacketConn is "bound" to.
-	//
-	// Calls to ReadFrom will only return packets destined to this address.
-	boundAddr *net.UDPAddr
+// ReadFromTimestamped implements TimestampedPacketConn.
+func (tc *timestampConn) ReadFromTimestamped(b []byte) (int, net.Addr, time.Time, error) {
+	var ts unix.Timespec
+	oob := make([]byte, unix.CmsgSpace(int(unsafe.Sizeof(ts))))
+	n, oobn, _, addr, err := tc.ReadMsgUDP(b, oob)
+	if err != nil {
+		return n, addr, time.Time{}, err
+	}
+	return n, addr, parseTimestamp(oob[:oobn]), nil
 }
 
-// NewBroadcastUDPConn returns a PacketConn that marshals and unmarshals UDP
-// packets, sending them to the broadcast MAC at on rawPacketConn.
+// parseTimestamp returns the SCM_TIMESTAMPNS time in the control messages oob.
 //
-// Calls to ReadFrom will only return packets destined to boundAddr.
-func NewBroadcastUDPConn(rawPacketConn net.PacketConn, boundAddr *net.UDPAddr) net.PacketConn {
-	return &UDPPacketConn{
-		PacketConn: rawPacketConn,
-		boundAddr:  boundAddr,
+// It returns the current time if there is no timestamp.
+func parseTimestamp(oob []byte) time.Time {
+	msgs, err := unix.ParseSocketControlMessage(oob)
+	if err != nil {
+		return time.Now()
+	}
+	for _, m := range msgs {
+		var ts unix.Timespec
+		if m.Header.Level == unix.SOL_SOCKET && m.Header.Type == unix.SCM_TIMESTAMPNS && len(m.Data) >= int(unsafe.Sizeof(ts)) {
+			ts = *(*unix.Timespec)(unsafe.Pointer(&m.Data[0]))
+			return time.Unix(ts.Unix())
+		}
 	}
+	return time.Now()
 }
 
-func udpMatch(addr *net.UDPAddr, bound *net.UDPAddr) bool {
-	if bound == nil {
-		return true
+// NewPacketUDPConn returns a UDP connection bound to the interface and port
+// given based on a raw packet socket. All packets are broadcasted.
+//
+// The connection works on interfaces without an IPv4 address. A BPF filter
+// makes the kernel deliver only untagged UDP packets destined to port.
+func NewPacketUDPConn(iface string, port int) (net.PacketConn, error) {
+	ifc, err := net.InterfaceByName(iface)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := bpf.Assemble(untagged(udpFilter(port)))
+	if err != nil {
+		return nil, err
 	}
-	if bound.IP != nil && !bound.IP.Equal(addr.IP) {
-		return false
+	rawConn, err := raw.ListenPacket(ifc, uint16(ethernet.EtherTypeIPv4), &raw.Config{
+		LinuxSockDGRAM: true,
+		Filter:         filter,
+	})
+	if err != nil {
+		return nil, permissionErr(fmt.Sprintf("open packet socket on %s", iface), CapNetRaw, err)
 	}
-	return bound.Port == addr.Port
+	return NewBroadcastUDPConn(rawConn, &net.UDPAddr{Port: port}), nil
 }
 
-// ReadFrom implements net.PacketConn.ReadFrom.
-//
-// ReadFrom reads raw IP packets and will try to match them against
-// upc.boundAddr. Any matching packets are returned via the given buffer.
-func (upc *UDPPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
-	ipLen := IPv4MaximumHeaderSize
-	udpLen := UDPMinimumSize
-
-	for {
-		pkt := make([]byte, ipLen+udpLen+len(b))
-		n, _, err := upc.PacketConn.ReadFrom(pkt)
-		if err != nil {
-			return 0, nil, err
-		}
-		pkt = pkt[:n]
-		buf := uio.NewBigEndianBuffer(pkt)
-
-		// To read the header length, access data directly.
-		ipHdr := IPv4(buf.Data())
-		ipHdr = IPv4(buf.Consume(int(ipHdr.HeaderLength())))
-
-		if ipHdr.TransportProtocol() != UDPProtocolNumber {
-			continue
-		}
-		udpHdr := UDP(buf.Consume(udpLen))
-
-		addr := &net.UDPAddr{
-			IP:   net.IP(ipHdr.DestinationAddress()),
-			Port: int(udpHdr.DestinationPort()),
-		}
-		if !udpMatch(addr, upc.boundAddr) {
-			continue
-		}
-		return copy(b, buf.ReadAll()), addr, nil
-	}
+// linkAddr returns the address UDPPacketConn.WriteTo sends frames for mac
+// to.
+func linkAddr(mac net.HardwareAddr) net.Addr {
+	return &raw.Addr{HardwareAddr: mac}
 }
 
-// WriteTo implements net.PacketConn.WriteTo and broadcasts all packets at the
-// raw socket level.
-//
-// WriteTo wraps the given packet in the appropriate UDP and IP header before
-// sending it on the packet conn.
-func (upc *UDPPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
-	udpAddr, ok := addr.(*net.UDPAddr)
+// setPromiscuous enables promiscuous mode on the packet socket underlying
+// conn.
+func setPromiscuous(conn net.PacketConn) error {
+	if upc, ok := conn.(*UDPPacketConn); ok {
+		conn = upc.PacketConn
+	}
+	pc, ok := conn.(interface {
+		SetPromiscuous(bool) error
+	})
 	if !ok {
-		return 0, fmt.Errorf("must supply UDPAddr")
+		return fmt.Errorf("connection %T is not a packet socket and cannot be promiscuous", conn)
 	}
-
-	// Using the boundAddr is not quite right here, but it works.
-	packet := udp4pkt(b, udpAddr, upc.boundAddr)
-	return upc.PacketConn.WriteTo(packet, &raw.Addr{HardwareAddr: BroadcastMac})
+	if err := pc.SetPromiscuous(true); err != nil {
+		return permissionErr("enable promiscuous mode", CapNetRaw, err)
+	}
+	return nil
 }
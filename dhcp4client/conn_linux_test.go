@@ -0,0 +1,67 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestTimestampConn(t *testing.T) {
+	uc, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Skipf("no loopback UDP: %v", err)
+	}
+	defer uc.Close()
+
+	tc, err := newTimestampConn(uc)
+	if err != nil {
+		t.Fatalf("newTimestampConn() = %v", err)
+	}
+
+	before := time.Now()
+	if _, err := uc.WriteTo([]byte("hello"), uc.LocalAddr()); err != nil {
+		t.Fatal(err)
+	}
+
+	var b [16]byte
+	uc.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, ts, err := readFrom(tc, b[:])
+	if err != nil {
+		t.Fatalf("readFrom() = %v", err)
+	}
+	if string(b[:n]) != "hello" {
+		t.Errorf("readFrom() read %q, want %q", b[:n], "hello")
+	}
+	if ts.Before(before.Add(-time.Second)) || ts.After(time.Now()) {
+		t.Errorf("readFrom() timestamp %v not between %v and now", ts, before)
+	}
+}
+
+// promiscConn is a packet socket recording whether it is promiscuous.
+type promiscConn struct {
+	net.PacketConn
+	promiscuous bool
+}
+
+func (pc *promiscConn) SetPromiscuous(b bool) error {
+	pc.promiscuous = b
+	return nil
+}
+
+func TestSetPromiscuous(t *testing.T) {
+	pc := &promiscConn{}
+	if err := setPromiscuous(NewBroadcastUDPConn(pc, &net.UDPAddr{Port: ClientPort})); err != nil {
+		t.Fatalf("setPromiscuous(packet socket) = %v", err)
+	}
+	if !pc.promiscuous {
+		t.Errorf("setPromiscuous(packet socket) did not enable promiscuous mode")
+	}
+
+	if err := setPromiscuous(newMockUDPConn(nil, nil)); err == nil {
+		t.Errorf("setPromiscuous(UDP socket) = nil, want error")
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"net"
+	"testing"
+
+	"golang.org/x/net/bpf"
+)
+
+func TestUDPFilter(t *testing.T) {
+	payload := []byte("payload")
+	src := &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: ServerPort}
+	toClient := udp4pkt(payload, &net.UDPAddr{IP: net.IPv4bcast, Port: ClientPort}, src)
+	toServer := udp4pkt(payload, &net.UDPAddr{IP: net.IPv4bcast, Port: ServerPort}, src)
+
+	tcp := append([]byte(nil), toClient...)
+	tcp[9] = 6
+	fragment := append([]byte(nil), toClient...)
+	fragment[7] = 1
+
+	// Filters for Ethernet frames skip the Ethernet header.
+	for _, off := range []uint32{0, 14} {
+		vm, err := bpf.NewVM(udpFilterAt(off, ClientPort))
+		if err != nil {
+			t.Fatalf("NewVM() = %v", err)
+		}
+		for _, tt := range []struct {
+			desc string
+			pkt  []byte
+			want bool
+		}{
+			{desc: "UDP to client port", pkt: toClient, want: true},
+			{desc: "UDP to server port", pkt: toServer},
+			{desc: "TCP", pkt: tcp},
+			{desc: "later fragment", pkt: fragment},
+		} {
+			pkt := append(make([]byte, off), tt.pkt...)
+			n, err := vm.Run(pkt)
+			if err != nil {
+				t.Fatalf("%s at %d: Run() = %v", tt.desc, off, err)
+			}
+			if got := n > 0; got != tt.want {
+				t.Errorf("%s at %d: filter accepted %d bytes, want accepted = %v", tt.desc, off, n, tt.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// ipUnicastIf is IP_UNICAST_IF, the socket option selecting the interface
+// broadcasts and unicasts leave on, missing from package syscall.
+const ipUnicastIf = 31
+
+// NewPacketUDPConn returns a UDP connection bound to 0.0.0.0 and port that
+// sends on the interface given. The UDP connection allows broadcasting.
+//
+// Windows has no raw packet sockets: the connection is a UDP socket, which
+// receives replies broadcast or sent to addresses of the host, on any
+// interface. The broadcast flag, set by default, asks servers to
+// broadcast.
+func NewPacketUDPConn(iface string, port int) (net.PacketConn, error) {
+	ifc, err := net.InterfaceByName(iface)
+	if err != nil {
+		return nil, err
+	}
+	lc := net.ListenConfig{
+		Control: func(network, address string, c syscall.RawConn) error {
+			var serr error
+			if err := c.Control(func(fd uintptr) {
+				serr = setUDPSockopts(syscall.Handle(fd), ifc.Index)
+			}); err != nil {
+				return err
+			}
+			return serr
+		},
+	}
+	conn, err := lc.ListenPacket(context.Background(), "udp4", fmt.Sprintf("0.0.0.0:%d", port))
+	if err != nil {
+		return nil, fmt.Errorf("bind to port %d: %v", port, err)
+	}
+	return conn, nil
+}
+
+// setUDPSockopts allows broadcasting on fd and makes its packets leave on
+// the interface with the index given.
+func setUDPSockopts(fd syscall.Handle, index int) error {
+	if err := syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_BROADCAST, 1); err != nil {
+		return fmt.Errorf("SO_BROADCAST: %v", err)
+	}
+	// IP_UNICAST_IF takes the index in network byte order. Windows only
+	// runs on little-endian machines.
+	i := uint32(index)
+	be := i>>24 | i>>8&0xff00 | i<<8&0xff0000 | i<<24
+	if err := syscall.SetsockoptInt(fd, syscall.IPPROTO_IP, ipUnicastIf, int(be)); err != nil {
+		return fmt.Errorf("IP_UNICAST_IF: %v", err)
+	}
+	return nil
+}
+
+// NewIPv4UDPConn returns NewPacketUDPConn(iface, port): on Windows, both
+// are UDP sockets.
+func NewIPv4UDPConn(iface string, port int) (net.PacketConn, error) {
+	return NewPacketUDPConn(iface, port)
+}
+
+// newInterfaceConn returns the connection of WithInterface.
+func newInterfaceConn(iface string, port int) (net.PacketConn, error) {
+	return NewPacketUDPConn(iface, port)
+}
+
+// linkAddr returns the address UDPPacketConn.WriteTo sends frames for mac
+// to.
+func linkAddr(mac net.HardwareAddr) net.Addr {
+	return &hardwareAddr{HardwareAddr: mac}
+}
+
+// hardwareAddr is a hardware address as a net.Addr.
+type hardwareAddr struct {
+	HardwareAddr net.HardwareAddr
+}
+
+// Network implements net.Addr.Network.
+func (a *hardwareAddr) Network() string {
+	return "ethernet"
+}
+
+// String implements net.Addr.String.
+func (a *hardwareAddr) String() string {
+	return a.HardwareAddr.String()
+}
+
+// setPromiscuous fails: Windows has no raw packet sockets.
+func setPromiscuous(conn net.PacketConn) error {
+	return fmt.Errorf("connection %T is not a packet socket and cannot be promiscuous", conn)
+}
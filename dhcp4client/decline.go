@@ -0,0 +1,131 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+)
+
+// AddressProber detects whether an address is already in use on the link,
+// e.g. with ARP as ARPProber does.
+type AddressProber interface {
+	// Probe returns the hardware address of a host using ip, or nil if
+	// none was found.
+	Probe(ctx context.Context, ip net.IP) (net.HardwareAddr, error)
+}
+
+// WithAddressProber makes RequestLease check each address it acquires with p
+// before returning it, as RFC 2131 Section 4.4.1 recommends. Addresses in
+// use are declined and acquisition restarts.
+//
+// Default is no probing.
+func WithAddressProber(p AddressProber) ClientOpt {
+	return func(c *Client) error {
+		c.prober = p
+		return nil
+	}
+}
+
+const (
+	// minDeclineWait is how long RequestLease waits after declining an
+	// address before restarting acquisition, as RFC 2131 Section 3.1
+	// requires.
+	minDeclineWait = 10 * time.Second
+
+	// maxDeclines is how many addresses RequestLease declines before giving
+	// up.
+	maxDeclines = 3
+)
+
+// ConflictError is returned by RequestLease if every address acquired was in
+// use by another host, and was declined.
+type ConflictError struct {
+	// IP is the last address declined, and HardwareAddr the address of the
+	// host using it.
+	IP           net.IP
+	HardwareAddr net.HardwareAddr
+
+	// Declined is the number of addresses declined.
+	Declined int
+}
+
+// Error implements error.
+func (ce *ConflictError) Error() string {
+	return fmt.Sprintf("declined %d addresses in use, last %v by %v", ce.Declined, ce.IP, ce.HardwareAddr)
+}
+
+// probe checks lease with the address prober. If the address is in use, it
+// declines the lease and returns a *ConflictError for it.
+func (c *Client) probe(ctx context.Context, lease *Lease) error {
+	if c.prober == nil {
+		return nil
+	}
+	hw, err := c.prober.Probe(ctx, lease.IP)
+	if err != nil {
+		return fmt.Errorf("probe %v: %v", lease.IP, err)
+	}
+	if hw == nil {
+		return nil
+	}
+	if err := c.Decline(ctx, lease); err != nil {
+		return err
+	}
+	// The address is not to be requested again after a restart either.
+	c.forgetLease()
+	return &ConflictError{IP: lease.IP, HardwareAddr: hw, Declined: 1}
+}
+
+// Decline tells the server that granted lease that its address is already in
+// use, as described by RFC 2131 Section 4.4.1. Servers do not answer
+// declines.
+func (c *Client) Decline(ctx context.Context, lease *Lease) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if lease.ServerID == nil {
+		return fmt.Errorf("lease %v has no server identifier to decline to", lease)
+	}
+
+	// The client has no usable address, so it broadcasts the decline
+	// with the address in the options rather than in ciaddr.
+	p := dhcp4.NewPacket(dhcp4.BootRequest)
+	if err := identify(p, c.Identity()); err != nil {
+		return err
+	}
+	p.TransactionID = c.newXID()
+	p.Options.SetMessageType(dhcp4.DHCPDecline)
+	p.Options.SetRequestedIPAddress(lease.IP)
+	p.Options.SetServerIdentifier(lease.ServerID)
+
+	b, err := c.encode(p)
+	if err != nil {
+		return err
+	}
+	conn := c.getConn()
+	if _, err = conn.WriteTo(b, DefaultServers); err != nil && c.recoverConn(conn, err) {
+		conn = c.getConn()
+		_, err = conn.WriteTo(b, DefaultServers)
+	}
+	if err == nil {
+		c.captureSent(conn, b, DefaultServers)
+		c.reportPacket(PacketEvent{Kind: PacketSent, Packet: p, Addr: DefaultServers, Attempt: 1})
+	}
+	return err
+}
+
+// containsIP returns whether ips contains ip.
+func containsIP(ips []net.IP, ip net.IP) bool {
+	for _, i := range ips {
+		if i.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,212 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+	"github.com/mergetb/dhcp4/dhcp4server"
+	"github.com/mergetb/dhcp4/dhcp4test"
+)
+
+// fakeProber finds the addresses in inUse in use by the host at hw.
+type fakeProber struct {
+	hw     net.HardwareAddr
+	inUse  map[string]bool
+	probed []net.IP
+}
+
+func (fp *fakeProber) Probe(ctx context.Context, ip net.IP) (net.HardwareAddr, error) {
+	fp.probed = append(fp.probed, ip)
+	if fp.inUse[ip.String()] {
+		return fp.hw, nil
+	}
+	return nil, nil
+}
+
+func TestRequestDecline(t *testing.T) {
+	taken, free := net.IP{192, 168, 1, 10}, net.IP{192, 168, 1, 11}
+	// Servers offer other addresses after declines, which may be taken
+	// too.
+	taken2, taken3 := net.IP{192, 168, 1, 12}, net.IP{192, 168, 1, 13}
+	hw := net.HardwareAddr{0x02, 0, 0, 0, 0, 0x99}
+	handshake := func(ip net.IP) [][]*dhcp4.Packet {
+		return [][]*dhcp4.Packet{
+			{newLeaseReply(dhcp4.DHCPOffer, serverA, ip, time.Hour)},
+			{newLeaseReply(dhcp4.DHCPACK, serverA, ip, time.Hour)},
+		}
+	}
+
+	for _, tt := range []struct {
+		desc      string
+		responses [][]*dhcp4.Packet
+		want      net.IP
+
+		// declined are the addresses the client declined, or wantConflict
+		// the number of declines returned by RequestLease.
+		declined     []net.IP
+		wantConflict int
+	}{
+		{
+			desc:      "free",
+			responses: handshake(free),
+			want:      free,
+		},
+		{
+			desc: "taken once",
+			responses: append(append(handshake(taken),
+				// Servers do not answer declines.
+				[]*dhcp4.Packet{}),
+				handshake(free)...),
+			want:     free,
+			declined: []net.IP{taken},
+		},
+		{
+			desc: "declined address offered again",
+			responses: append(append(handshake(taken),
+				[]*dhcp4.Packet{},
+				[]*dhcp4.Packet{
+					newLeaseReply(dhcp4.DHCPOffer, serverA, taken, time.Hour),
+					newLeaseReply(dhcp4.DHCPOffer, serverB, free, time.Hour),
+				}),
+				[]*dhcp4.Packet{newLeaseReply(dhcp4.DHCPACK, serverB, free, time.Hour)}),
+			want:     free,
+			declined: []net.IP{taken},
+		},
+		{
+			desc: "always taken",
+			responses: append(append(append(append(append(handshake(taken),
+				[]*dhcp4.Packet{}),
+				handshake(taken2)...),
+				[]*dhcp4.Packet{}),
+				handshake(taken3)...),
+				// The last decline keeps the server running.
+				[]*dhcp4.Packet{}, []*dhcp4.Packet{}),
+			wantConflict: maxDeclines,
+		},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			p := &fakeProber{hw: hw, inUse: map[string]bool{taken.String(): true, taken2.String(): true, taken3.String(): true}}
+			c, s := serveClient(ctx, t, tt.responses, WithAddressProber(p))
+			defer c.Close()
+			c.declineWait = 10 * time.Millisecond
+
+			lease, err := c.RequestLease(ctx)
+			if tt.wantConflict > 0 {
+				// The last decline may not have reached the server
+				// yet, so only the error is checked.
+				ce, ok := err.(*ConflictError)
+				if !ok {
+					t.Fatalf("Request() = %v, want *ConflictError", err)
+				}
+				if !ce.IP.Equal(taken3) || ce.HardwareAddr.String() != hw.String() || ce.Declined != tt.wantConflict {
+					t.Errorf("Request() = %v, want %v declined last of %d for %v", ce, taken3, tt.wantConflict, hw)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Request() = %v", err)
+			} else if !lease.IP.Equal(tt.want) {
+				t.Errorf("Request() = %v, want %v", lease, tt.want)
+			}
+
+			var declined []net.IP
+			for i, pkt := range s.packets() {
+				if pkt.Options.MessageType() != dhcp4.DHCPDecline {
+					continue
+				}
+				declined = append(declined, pkt.Options.RequestedIPAddress())
+				if sid := pkt.Options.ServerIdentifier(); !sid.Equal(serverA) {
+					t.Errorf("decline sent with server identifier %v, want %v", sid, serverA)
+				}
+				if !s.destinations()[i].IP.Equal(net.IPv4bcast) {
+					t.Errorf("decline sent to %v, want broadcast", s.destinations()[i].IP)
+				}
+			}
+			if len(declined) != len(tt.declined) {
+				t.Fatalf("client declined %v, want %v", declined, tt.declined)
+			}
+			for i, ip := range declined {
+				if !ip.Equal(tt.declined[i]) {
+					t.Errorf("decline %d of %v, want %v", i, ip, tt.declined[i])
+				}
+			}
+		})
+	}
+}
+
+// firstInUse is an AddressProber finding the first address it probes in
+// use.
+type firstInUse struct {
+	probed []net.IP
+}
+
+func (fp *firstInUse) Probe(ctx context.Context, ip net.IP) (net.HardwareAddr, error) {
+	fp.probed = append(fp.probed, ip)
+	if len(fp.probed) == 1 {
+		return net.HardwareAddr{0x02, 0, 0, 0, 0, 0x99}, nil
+	}
+	return nil, nil
+}
+
+func TestRequestDeclineServer(t *testing.T) {
+	_, pool, _ := net.ParseCIDR("192.168.1.0/24")
+	for _, tt := range []struct {
+		desc     string
+		strategy dhcp4server.AllocationStrategy
+	}{
+		{desc: "requested", strategy: dhcp4server.AllocateRequested},
+		{desc: "sequential", strategy: dhcp4server.AllocateSequential},
+		{desc: "hash", strategy: dhcp4server.AllocateHash},
+		{desc: "sticky", strategy: dhcp4server.AllocateSticky},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			s := dhcp4server.New(serverA, pool, "", "",
+				dhcp4server.WithAllocationStrategy(tt.strategy),
+				dhcp4server.WithLogger(log.New(ioutil.Discard, "", 0)),
+			)
+			clientConn, serverConn := dhcp4test.Pipe()
+			if err := s.Start(ctx, serverConn); err != nil {
+				t.Fatal(err)
+			}
+			defer s.Stop()
+
+			p := &firstInUse{}
+			c, err := New(nil,
+				WithConn(clientConn),
+				WithIdentity(Identity{HardwareAddr: net.HardwareAddr{2, 0, 0, 0, 0, 1}}),
+				WithAddressProber(p),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+			c.declineWait = 10 * time.Millisecond
+
+			lease, err := c.RequestLease(ctx)
+			if err != nil {
+				t.Fatalf("Request() = %v", err)
+			}
+			if len(p.probed) != 2 {
+				t.Fatalf("probed %v, want the declined and the leased address", p.probed)
+			}
+			if declined := p.probed[0]; lease.IP.Equal(declined) {
+				t.Errorf("Request() = %v, want an address other than declined %v", lease, declined)
+			}
+		})
+	}
+}
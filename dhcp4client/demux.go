@@ -0,0 +1,206 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+)
+
+// datagram is a packet read from the client's connection, or the error that
+// ended reading.
+type datagram struct {
+	b        []byte
+	source   net.Addr
+	received time.Time
+
+	// pkt is b decoded, or decodeErr why b is not a DHCP packet.
+	pkt       *dhcp4.Packet
+	decodeErr error
+
+	// err is errRecovered if the connection was replaced, or why it
+	// cannot be read anymore.
+	err error
+}
+
+// pendingExchange is an exchange waiting for replies to a request, a
+// listener for packets that answer no request, or a monitor of all packets.
+type pendingExchange struct {
+	xid      [4]byte
+	chaddr   net.HardwareAddr
+	listener bool
+	monitor  bool
+
+	in   chan datagram
+	done chan struct{}
+}
+
+// demux reads the client's connection while exchanges are pending, and
+// routes each packet to the exchanges whose request it answers, so that
+// several exchanges can share one connection.
+type demux struct {
+	mu      sync.Mutex
+	pending map[*pendingExchange]struct{}
+	reading bool
+}
+
+// register adds an exchange waiting for replies to request, or a listener
+// if request is nil, and starts reading the connection if nobody is.
+func (c *Client) register(request *dhcp4.Packet) *pendingExchange {
+	pe := &pendingExchange{
+		listener: request == nil,
+		in:       make(chan datagram, 16),
+		done:     make(chan struct{}),
+	}
+	if request != nil {
+		pe.xid, pe.chaddr = request.TransactionID, request.HardwareAddr()
+	}
+	c.addPending(pe)
+	return pe
+}
+
+// registerMonitor adds a monitor, which gets every packet read along with
+// the exchanges it is for, and starts reading the connection if nobody is.
+func (c *Client) registerMonitor() *pendingExchange {
+	pe := &pendingExchange{
+		listener: true,
+		monitor:  true,
+		in:       make(chan datagram, 16),
+		done:     make(chan struct{}),
+	}
+	c.addPending(pe)
+	return pe
+}
+
+// addPending adds pe and starts reading the connection if nobody is.
+func (c *Client) addPending(pe *pendingExchange) {
+	d := &c.demux
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.pending == nil {
+		d.pending = make(map[*pendingExchange]struct{})
+	}
+	d.pending[pe] = struct{}{}
+	if !d.reading {
+		d.reading = true
+		go c.readLoop()
+	}
+}
+
+// unregister ends waiting for replies to pe.
+func (c *Client) unregister(pe *pendingExchange) {
+	d := &c.demux
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.pending, pe)
+	close(pe.done)
+}
+
+// idle stops reading and returns true if no exchange is pending.
+func (d *demux) idle() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.pending) > 0 {
+		return false
+	}
+	d.reading = false
+	return true
+}
+
+// targets returns the exchanges dg is for: one with the transaction ID and
+// client hardware address of the packet, else those with its transaction
+// ID, else all exchanges and listeners, so that they account for packets
+// they reject. Monitors are always targets.
+func (d *demux) targets(dg datagram) []*pendingExchange {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var exact, xid, all, monitors []*pendingExchange
+	for pe := range d.pending {
+		all = append(all, pe)
+		switch {
+		case pe.monitor:
+			monitors = append(monitors, pe)
+		case pe.listener || dg.pkt == nil || pe.xid != dg.pkt.TransactionID:
+		case exact == nil && bytes.Equal(pe.chaddr, dg.pkt.HardwareAddr()):
+			exact = []*pendingExchange{pe}
+		default:
+			xid = append(xid, pe)
+		}
+	}
+	switch {
+	case exact != nil:
+		return append(exact, monitors...)
+	case len(xid) > 0:
+		return append(xid, monitors...)
+	}
+	return all
+}
+
+// dispatch sends dg to its exchanges.
+func (d *demux) dispatch(dg datagram) {
+	for _, pe := range d.targets(dg) {
+		select {
+		case pe.in <- dg:
+		case <-pe.done:
+		}
+	}
+}
+
+// readLoop reads the client's connection and dispatches what it reads
+// until no exchange is pending or the connection fails.
+func (c *Client) readLoop() {
+	for {
+		conn := c.getConn()
+		// Check for pending exchanges every once in a while.
+		conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+
+		b := make([]byte, c.maxSize)
+		n, source, received, err := readFrom(conn, b)
+		if oerr, ok := err.(net.Error); ok && oerr.Timeout() {
+			if c.demux.idle() {
+				return
+			}
+			continue
+		} else if err != nil {
+			if c.recoverConn(conn, err) {
+				c.demux.dispatch(datagram{err: errRecovered})
+				continue
+			}
+			c.demux.fail(fmt.Errorf("error reading from UDP connection: %v", err))
+			return
+		}
+
+		c.captureReceived(conn, b[:n], source, received)
+		dg := datagram{b: b[:n], source: source, received: received}
+		dg.pkt, dg.decodeErr = c.codec.Decode(dg.b)
+		c.demux.dispatch(dg)
+		if c.demux.idle() {
+			return
+		}
+	}
+}
+
+// fail stops reading and sends err to all pending exchanges.
+func (d *demux) fail(err error) {
+	d.mu.Lock()
+	d.reading = false
+	var all []*pendingExchange
+	for pe := range d.pending {
+		all = append(all, pe)
+	}
+	d.mu.Unlock()
+
+	for _, pe := range all {
+		select {
+		case pe.in <- datagram{err: err}:
+		case <-pe.done:
+		}
+	}
+}
@@ -0,0 +1,45 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/mergetb/dhcp4/dhcp4client"
+	"github.com/mergetb/dhcp4/dhcp4test"
+)
+
+// A client requests a lease. It talks to the fake server of dhcp4test here;
+// on a real interface, pass its link to New instead of WithConn, or call
+// Acquire. See examples/client and examples/leased for complete programs.
+func ExampleClient_Request() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	clientConn, serverConn := dhcp4test.Pipe()
+	s := dhcp4test.NewServer(net.IP{192, 168, 0, 1}, dhcp4test.WithLeaseTime(time.Hour))
+	go s.Serve(ctx, serverConn)
+
+	c, err := dhcp4client.New(nil,
+		dhcp4client.WithConn(clientConn),
+		dhcp4client.WithIdentity(dhcp4client.Identity{HardwareAddr: net.HardwareAddr{2, 0, 0, 0, 0, 1}}),
+	)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer c.Close()
+
+	lease, err := c.RequestLease(ctx)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("leased %v from %v for %v\n", lease.IP, lease.ServerID, lease.Duration)
+	// Output: leased 192.168.0.2 from 192.168.0.1 for 1h0m0s
+}
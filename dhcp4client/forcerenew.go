@@ -0,0 +1,91 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"context"
+	"sync"
+
+	"github.com/mergetb/dhcp4"
+)
+
+// WithForceRenew makes Maintain listen for DHCPFORCERENEW messages (RFC
+// 3203) from the server of its lease while the lease is bound, and renew the
+// lease as soon as one arrives rather than waiting for T1, so that servers
+// can push new parameters to clients. The renewal is sent as a LeaseRenewed
+// event.
+//
+// RFC 3203 requires FORCERENEW messages to be authenticated. With
+// WithAuthentication, only messages signed with a secret of the client are
+// obeyed; without, any host that can send to the client can make it renew.
+//
+// Default is to ignore FORCERENEW messages.
+func WithForceRenew() ClientOpt {
+	return func(c *Client) error {
+		c.forceRenew = true
+		return nil
+	}
+}
+
+// listenForceRenew listens for a DHCPFORCERENEW message for lease until
+// stop is called, and closes forced when one is accepted. The message is
+// read from the client's connection along with the replies to concurrent
+// exchanges.
+func (c *Client) listenForceRenew(ctx context.Context, lease *Lease) (forced <-chan struct{}, stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	ch := make(chan struct{})
+	pe := c.register(nil)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer c.unregister(pe)
+		for {
+			var dg datagram
+			select {
+			case dg = <-pe.in:
+			case <-ctx.Done():
+				return
+			}
+			if dg.err == errRecovered {
+				continue
+			} else if dg.err != nil {
+				return
+			}
+
+			if dg.decodeErr != nil {
+				c.reportPacket(PacketEvent{Kind: PacketDiscarded, Time: dg.received, Addr: dg.source, Reason: RejectMalformed, Err: dg.decodeErr})
+				continue
+			}
+			pkt := dg.pkt
+			if reason, err := c.acceptForceRenew(dg.b, pkt, lease); reason != "" {
+				c.reportPacket(PacketEvent{Kind: PacketDiscarded, Time: dg.received, Packet: pkt, Addr: dg.source, Reason: reason, Err: err})
+				continue
+			}
+			c.reportPacket(PacketEvent{Kind: PacketReceived, Time: dg.received, Packet: pkt, Addr: dg.source})
+			close(ch)
+			return
+		}
+	}()
+	return ch, func() {
+		cancel()
+		wg.Wait()
+	}
+}
+
+// acceptForceRenew returns why pkt, received as b, does not force lease to
+// be renewed, or "" if it does.
+func (c *Client) acceptForceRenew(b []byte, pkt *dhcp4.Packet, lease *Lease) (RejectReason, error) {
+	if pkt.Op != dhcp4.BootReply || pkt.Options.MessageType() != dhcp4.DHCPForceRenew {
+		return RejectUnwanted, nil
+	}
+	if sid := pkt.Options.ServerIdentifier(); lease.ServerID != nil && !lease.ServerID.Equal(sid) {
+		return RejectUnwanted, nil
+	}
+	if c.auth != nil {
+		return c.auth.verify(b, pkt)
+	}
+	return "", nil
+}
@@ -0,0 +1,87 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+)
+
+func TestMaintainForceRenew(t *testing.T) {
+	ip := net.IP{192, 168, 1, 10}
+	keys := dhcp4.Keys{7: []byte("secret")}
+
+	for _, authenticated := range []bool{false, true} {
+		in := make(chan udpPacket, 10)
+		out := make(chan udpPacket, 10)
+		opts := []ClientOpt{WithConn(newMockUDPConn(in, out)), WithRetry(1), WithTimeout(time.Second), WithForceRenew()}
+		if authenticated {
+			opts = append(opts, WithAuthentication(keys, 7))
+		}
+		c, err := New(nil, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var replay uint64
+		send := func(p *dhcp4.Packet, sign bool) {
+			t.Helper()
+			if sign {
+				replay++
+				p.Options.SetAuthentication(dhcp4.NewDelayedAuthentication(7, replay))
+			}
+			b, err := p.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sign {
+				if err := dhcp4.SignPacket(b, keys); err != nil {
+					t.Fatal(err)
+				}
+			}
+			in <- udpPacket{source: &net.UDPAddr{IP: serverA, Port: ServerPort}, payload: b}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		lease := &Lease{IP: ip, ServerID: serverA, Start: time.Now(), Duration: time.Hour, RenewalTime: 30 * time.Minute, RebindingTime: 45 * time.Minute}
+		events := c.Maintain(ctx, lease)
+
+		// Ignored: from another server, and unauthenticated if
+		// authentication is configured.
+		send(newLeaseReply(dhcp4.DHCPForceRenew, serverB, nil, 0), authenticated)
+		if authenticated {
+			send(newLeaseReply(dhcp4.DHCPForceRenew, serverA, nil, 0), false)
+		}
+		send(newLeaseReply(dhcp4.DHCPForceRenew, serverA, nil, 0), authenticated)
+
+		var request *dhcp4.Packet
+		select {
+		case sent := <-out:
+			if request, err = dhcp4.ParsePacket(sent.payload); err != nil {
+				t.Fatal(err)
+			}
+			if typ := request.Options.MessageType(); typ != dhcp4.DHCPRequest || !request.CIAddr.Equal(ip) || !sent.dest.IP.Equal(serverA) {
+				t.Errorf("sent %v of %v to %v, want DHCPREQUEST of %v to %v", typ, request.CIAddr, sent.dest.IP, ip, serverA)
+			}
+		case <-ctx.Done():
+			t.Fatalf("authenticated %t: no renewal sent after DHCPFORCERENEW", authenticated)
+		}
+
+		ack := newLeaseReply(dhcp4.DHCPACK, serverA, ip, 2*time.Hour)
+		ack.TransactionID = request.TransactionID
+		send(ack, authenticated)
+		if ev := <-events; ev.Kind != LeaseRenewed || ev.Lease.Duration != 2*time.Hour {
+			t.Errorf("authenticated %t: Maintain() sent %v event of %v, want renewed lease of 2h", authenticated, ev.Kind, ev.Lease)
+		}
+		cancel()
+		for range events {
+		}
+		c.Close()
+	}
+}
@@ -0,0 +1,223 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/mergetb/dhcp4"
+)
+
+// Identity is what a client identifies itself to servers with. Servers
+// bind addresses to it.
+type Identity struct {
+	// HardwareAddr is sent as the client hardware address (chaddr). If
+	// nil, the address of the client's interface is sent.
+	HardwareAddr net.HardwareAddr
+
+	// ClientID is sent as the client identifier (option 61) unless it is
+	// empty.
+	ClientID []byte
+}
+
+// WithIdentity configures the identity the client starts with.
+//
+// Default is the hardware address of the interface and no client
+// identifier.
+func WithIdentity(id Identity) ClientOpt {
+	return func(c *Client) error {
+		c.id = id
+		return nil
+	}
+}
+
+// WithClientID configures the client identifier (option 61) sent with every
+// request, replacing that of the identity configured with WithIdentity.
+// Servers bind addresses to the client identifier rather than the hardware
+// address if one is sent.
+//
+// An empty id sends none, which is the default.
+func WithClientID(id []byte) ClientOpt {
+	return func(c *Client) error {
+		if len(id) == 1 {
+			return fmt.Errorf("client identifier must be at least 2 bytes, got %x", id)
+		}
+		c.id.ClientID = id
+		return nil
+	}
+}
+
+// WithHostname configures the host name (option 12) sent with DISCOVERs,
+// REQUESTs and renewals, as RFC 2132 Section 3.14 describes.
+//
+// Default is no host name. It cannot be combined with WithFQDN, as RFC 4702
+// Section 3.1 forbids sending both.
+func WithHostname(name string) ClientOpt {
+	return func(c *Client) error {
+		if err := dhcp4.ValidateString(dhcp4.OptionHostName, name); err != nil {
+			return err
+		}
+		c.hostname = name
+		return nil
+	}
+}
+
+// WithFQDN configures the client FQDN (option 81) sent with DISCOVERs,
+// REQUESTs and renewals, which asks servers to update DNS for the client as
+// described by RFC 4702. flags is a combination of dhcp4.FQDNServerUpdate
+// and dhcp4.FQDNNoUpdate; a name not ending in a dot is completed by the
+// server.
+//
+// Default is no client FQDN. It cannot be combined with WithHostname.
+func WithFQDN(name string, flags uint8) ClientOpt {
+	return func(c *Client) error {
+		f := &dhcp4.ClientFQDN{Flags: flags, Name: name}
+		if _, err := f.MarshalBinary(); err != nil {
+			return err
+		}
+		c.fqdn = f
+		return nil
+	}
+}
+
+// describe adds the host name or client FQDN configured to p.
+func (c *Client) describe(p *dhcp4.Packet) {
+	if c.hostname != "" {
+		p.Options.SetHostName(c.hostname)
+	}
+	if c.fqdn != nil {
+		p.Options.SetClientFQDN(c.fqdn)
+	}
+}
+
+// Identity returns the identity the client uses, with the hardware address
+// of the interface filled in if none is configured.
+func (c *Client) Identity() Identity {
+	c.idMu.Lock()
+	id := c.id
+	c.idMu.Unlock()
+	if id.HardwareAddr == nil {
+		id.HardwareAddr = c.hardwareAddr()
+	}
+	return id
+}
+
+func (c *Client) setIdentity(id Identity) {
+	c.idMu.Lock()
+	defer c.idMu.Unlock()
+	c.id = id
+}
+
+// identify sets the client hardware address and client identifier of p to
+// those of id. It returns an error if the hardware address does not fit
+// into p.
+func identify(p *dhcp4.Packet, id Identity) error {
+	if err := p.SetHardwareAddr(id.HardwareAddr); err != nil {
+		return err
+	}
+	p.Options.SetClientIdentifier(id.ClientID)
+	return nil
+}
+
+// rotation asks a Maintain loop to move its lease from identity old to new.
+type rotation struct {
+	old, new Identity
+	done     chan error
+}
+
+// maintainer is a running Maintain loop.
+type maintainer struct {
+	rotations chan *rotation
+
+	// macs receives the changes of the interface's hardware address, if
+	// watched.
+	macs <-chan macChange
+
+	// done is closed when the loop ends.
+	done chan struct{}
+}
+
+func (c *Client) startMaintainer() *maintainer {
+	c.idMu.Lock()
+	defer c.idMu.Unlock()
+	m := &maintainer{
+		rotations: make(chan *rotation),
+		done:      make(chan struct{}),
+	}
+	if c.maintainers == nil {
+		c.maintainers = make(map[*maintainer]struct{})
+	}
+	c.maintainers[m] = struct{}{}
+	return m
+}
+
+func (c *Client) stopMaintainer(m *maintainer) {
+	c.idMu.Lock()
+	defer c.idMu.Unlock()
+	delete(c.maintainers, m)
+	close(m.done)
+}
+
+// RotateIdentity switches the client to identity id, e.g. to re-enroll a
+// machine or for privacy.
+//
+// Leases kept alive by Maintain are moved gracefully: the next time
+// Maintain waits, it releases its lease under the old identity, acquires a
+// new lease under id and sends it as a LeaseRotated event. If acquiring
+// fails, it sends a LeaseLost event with the error instead, which
+// RotateIdentity returns too. If releasing fails, the old lease is kept and
+// the client keeps its old identity.
+//
+// Without Maintain, the client simply uses id from now on. Callers should
+// Release their lease before and RequestLease a new one after.
+func (c *Client) RotateIdentity(ctx context.Context, id Identity) error {
+	old := c.Identity()
+	c.idMu.Lock()
+	ms := make([]*maintainer, 0, len(c.maintainers))
+	for m := range c.maintainers {
+		ms = append(ms, m)
+	}
+	c.idMu.Unlock()
+
+	for _, m := range ms {
+		r := &rotation{old: old, new: id, done: make(chan error, 1)}
+		select {
+		case m.rotations <- r:
+		case <-m.done:
+			// The loop ended in the meantime.
+			continue
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		select {
+		case err := <-r.done:
+			if err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	c.setIdentity(id)
+	return nil
+}
+
+// rotate carries out r for lease, kept alive by Maintain. It returns false
+// if the lease was kept because releasing it failed.
+func (c *Client) rotate(ctx context.Context, r *rotation, lease *Lease) (LeaseEvent, bool) {
+	if err := c.release(ctx, lease, r.old); err != nil {
+		r.done <- err
+		return LeaseEvent{}, false
+	}
+	c.setIdentity(r.new)
+	renewed, err := c.RequestLease(ctx)
+	r.done <- err
+	if err != nil {
+		return LeaseEvent{Kind: LeaseLost, Lease: lease, Err: err}, true
+	}
+	return LeaseEvent{Kind: LeaseRotated, Lease: renewed}, true
+}
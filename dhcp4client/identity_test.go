@@ -0,0 +1,225 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+)
+
+// identityReply returns a lease reply to a client with identity id.
+func identityReply(typ dhcp4.MessageType, ip net.IP, id Identity) *dhcp4.Packet {
+	p := newLeaseReply(typ, serverA, ip, time.Hour)
+	p.CHAddr = id.HardwareAddr
+	return p
+}
+
+func TestWithIdentity(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	id := Identity{
+		HardwareAddr: net.HardwareAddr{0x02, 0, 0, 0, 0, 1},
+		ClientID:     []byte{1, 2, 3},
+	}
+	ip := net.IP{192, 168, 1, 10}
+	c, s := serveClient(ctx, t, [][]*dhcp4.Packet{
+		{identityReply(dhcp4.DHCPOffer, ip, id)},
+		{identityReply(dhcp4.DHCPACK, ip, id)},
+	}, WithIdentity(id))
+	defer c.Close()
+
+	if _, err := c.RequestLease(ctx); err != nil {
+		t.Fatalf("Request() = %v", err)
+	}
+	if len(s.packets()) != 2 {
+		t.Fatalf("client sent %d packets, want 2", len(s.packets()))
+	}
+	for _, p := range s.packets() {
+		if got := p.HardwareAddr(); !bytes.Equal(got, id.HardwareAddr) {
+			t.Errorf("%v sent with chaddr %v, want %v", p.Options.MessageType(), got, id.HardwareAddr)
+		}
+		if got := p.Options.ClientIdentifier(); !bytes.Equal(got, id.ClientID) {
+			t.Errorf("%v sent with client identifier %x, want %x", p.Options.MessageType(), got, id.ClientID)
+		}
+	}
+}
+
+func TestIdentityTooLong(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// 17 bytes do not fit into chaddr.
+	id := Identity{HardwareAddr: make(net.HardwareAddr, 17)}
+	c, s := serveClient(ctx, t, nil, WithIdentity(id))
+	defer c.Close()
+
+	offer := newLeaseReply(dhcp4.DHCPOffer, serverA, net.IP{192, 168, 1, 10}, time.Hour)
+	if p, err := c.NewDiscoverPacket(); err == nil {
+		t.Errorf("NewDiscoverPacket() = %v, want error", p)
+	}
+	if p, err := c.NewRequestPacket(offer); err == nil {
+		t.Errorf("NewRequestPacket() = %v, want error", p)
+	}
+	// The original builders leave the address out.
+	if p := c.DiscoverPacket(); p == nil || len(p.CHAddr) != 0 {
+		t.Errorf("DiscoverPacket() = %v, want packet without hardware address", p)
+	}
+	if p := c.RequestPacket(offer); p == nil || len(p.CHAddr) != 0 {
+		t.Errorf("RequestPacket() = %v, want packet without hardware address", p)
+	}
+	if _, err := c.RequestLease(ctx); err == nil {
+		t.Errorf("RequestLease() = nil, want error")
+	}
+	if n := len(s.packets()); n != 0 {
+		t.Errorf("client sent %d packets, want none", n)
+	}
+}
+
+func TestRotateIdentityWithoutMaintain(t *testing.T) {
+	c, err := New(nil, WithConn(newMockUDPConn(nil, make(chan udpPacket))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	id := Identity{HardwareAddr: net.HardwareAddr{0x02, 0, 0, 0, 0, 2}}
+	if err := c.RotateIdentity(context.Background(), id); err != nil {
+		t.Fatalf("RotateIdentity() = %v", err)
+	}
+	if got := c.Identity().HardwareAddr; !bytes.Equal(got, id.HardwareAddr) {
+		t.Errorf("Identity() = %v, want %v", got, id.HardwareAddr)
+	}
+}
+
+func TestRotateIdentity(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	old := Identity{HardwareAddr: net.HardwareAddr{0x02, 0, 0, 0, 0, 1}}
+	id := Identity{
+		HardwareAddr: net.HardwareAddr{0x02, 0, 0, 0, 0, 2},
+		ClientID:     []byte("re-enrolled"),
+	}
+	oldIP, ip := net.IP{192, 168, 1, 10}, net.IP{192, 168, 1, 11}
+	c, s := serveClient(ctx, t, [][]*dhcp4.Packet{
+		// Servers do not answer releases.
+		{},
+		{identityReply(dhcp4.DHCPOffer, ip, id)},
+		{identityReply(dhcp4.DHCPACK, ip, id)},
+	}, WithIdentity(old))
+	defer c.Close()
+
+	lease := &Lease{
+		IP:            oldIP,
+		ServerID:      serverA,
+		Start:         time.Now(),
+		Duration:      time.Hour,
+		RenewalTime:   30 * time.Minute,
+		RebindingTime: 45 * time.Minute,
+	}
+	events := c.Maintain(ctx, lease)
+	if err := c.RotateIdentity(ctx, id); err != nil {
+		t.Fatalf("RotateIdentity() = %v", err)
+	}
+	ev, ok := <-events
+	if !ok {
+		t.Fatalf("Maintain() sent no event")
+	}
+	if ev.Kind != LeaseRotated || !ev.Lease.IP.Equal(ip) {
+		t.Errorf("Maintain() sent %v event for %v, want %v for %v", ev.Kind, ev.Lease, LeaseRotated, ip)
+	}
+	if got := c.Identity().HardwareAddr; !bytes.Equal(got, id.HardwareAddr) {
+		t.Errorf("Identity() = %v, want %v", got, id.HardwareAddr)
+	}
+
+	for i, want := range []struct {
+		typ dhcp4.MessageType
+		id  Identity
+	}{
+		{dhcp4.DHCPRelease, old},
+		{dhcp4.DHCPDiscover, id},
+		{dhcp4.DHCPRequest, id},
+	} {
+		if i >= len(s.packets()) {
+			t.Fatalf("client sent %d packets, want 3", len(s.packets()))
+		}
+		p := s.packets()[i]
+		if typ := p.Options.MessageType(); typ != want.typ {
+			t.Errorf("packet %d is a %v, want %v", i, typ, want.typ)
+		}
+		if got := p.HardwareAddr(); !bytes.Equal(got, want.id.HardwareAddr) {
+			t.Errorf("%v sent with chaddr %v, want %v", want.typ, got, want.id.HardwareAddr)
+		}
+		if got := p.Options.ClientIdentifier(); !bytes.Equal(got, want.id.ClientID) {
+			t.Errorf("%v sent with client identifier %q, want %q", want.typ, got, want.id.ClientID)
+		}
+	}
+	if len(s.packets()) > 0 && !s.packets()[0].CIAddr.Equal(oldIP) {
+		t.Errorf("release of %v, want %v", s.packets()[0].CIAddr, oldIP)
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	fqdn := &dhcp4.ClientFQDN{Flags: dhcp4.FQDNServerUpdate | dhcp4.FQDNEncoded, Name: "node1.example.com."}
+	clientID := []byte{0, 'n', 'o', 'd', 'e', '1'}
+
+	for _, tt := range []struct {
+		desc     string
+		opts     []ClientOpt
+		hostname string
+		fqdn     *dhcp4.ClientFQDN
+		clientID []byte
+		wantErr  bool
+	}{
+		{desc: "nothing"},
+		{desc: "host name", opts: []ClientOpt{WithHostname("node1")}, hostname: "node1"},
+		{desc: "FQDN", opts: []ClientOpt{WithFQDN("node1.example.com.", dhcp4.FQDNServerUpdate)}, fqdn: fqdn},
+		{desc: "client identifier", opts: []ClientOpt{WithClientID(clientID)}, clientID: clientID},
+		{
+			desc:     "all",
+			opts:     []ClientOpt{WithClientID(clientID), WithHostname("node1")},
+			hostname: "node1",
+			clientID: clientID,
+		},
+		{desc: "host name and FQDN", opts: []ClientOpt{WithHostname("node1"), WithFQDN("node1", 0)}, wantErr: true},
+		{desc: "invalid host name", opts: []ClientOpt{WithHostname("node 1")}, wantErr: true},
+		{desc: "invalid FQDN", opts: []ClientOpt{WithFQDN("node..1", 0)}, wantErr: true},
+		{desc: "short client identifier", opts: []ClientOpt{WithClientID([]byte{1})}, wantErr: true},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			c, err := New(nil, append([]ClientOpt{WithConn(newMockUDPConn(nil, nil))}, tt.opts...)...)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("New() = nil, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			offer := newLeaseReply(dhcp4.DHCPOffer, serverA, net.IP{192, 168, 1, 10}, time.Hour)
+			lease := shortLease(net.IP{192, 168, 1, 10})
+			must := mustPacket(t)
+			for _, p := range []*dhcp4.Packet{c.DiscoverPacket(), c.RequestPacket(offer), must(c.renewPacket(lease))} {
+				typ := p.Options.MessageType()
+				if got := p.Options.HostName(); got != tt.hostname {
+					t.Errorf("%v host name %q, want %q", typ, got, tt.hostname)
+				}
+				if got := p.Options.ClientFQDN(); (got == nil) != (tt.fqdn == nil) || got != nil && *got != *tt.fqdn {
+					t.Errorf("%v client FQDN %v, want %v", typ, got, tt.fqdn)
+				}
+				if got := p.Options.ClientIdentifier(); !bytes.Equal(got, tt.clientID) {
+					t.Errorf("%v client identifier %x, want %x", typ, got, tt.clientID)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"github.com/mergetb/dhcp4"
+	"github.com/mergetb/dhcp4/dhcp4opts"
+)
+
+// ErrNoInformResponse is returned by Inform if no server answered. RFC 2131
+// Section 4.4.3 lets the client proceed with its own configuration then.
+var ErrNoInformResponse = errors.New("no server answered DHCPINFORM")
+
+// Inform asks servers for configuration, e.g. DNS servers and routes, for
+// the address the client's interface already has, as described by RFC 2131
+// Section 4.4.3. It is meant for hosts with static addresses and does not
+// allocate a lease.
+//
+// Inform broadcasts a DHCPINFORM with the address in ciaddr, retransmitting
+// it as configured by WithBackoff, and returns the options of
+// the first ACK. Servers answer the address directly, so it must already be
+// configured on the interface.
+func (c *Client) Inform(ctx context.Context) (dhcp4.Options, error) {
+	if c.iface == nil {
+		return nil, errors.New("client has no interface to take the address from")
+	}
+	ip, err := currentIPv4Addr(c.iface)
+	if err != nil {
+		return nil, err
+	}
+	return c.inform(ctx, ip)
+}
+
+// inform asks servers for configuration for ip.
+func (c *Client) inform(ctx context.Context, ip net.IP) (dhcp4.Options, error) {
+	inform, err := c.informPacket(ip)
+	if err != nil {
+		return nil, err
+	}
+	ack, err := c.exchange(ctx, DefaultServers, inform, func(p *dhcp4.Packet) bool {
+		// Servers must not NAK a DHCPINFORM, see RFC 2131 Section
+		// 4.3.5, and there is no lease to lose.
+		return p.Options.MessageType() == dhcp4.DHCPACK
+	})
+	if err != nil {
+		if ctx.Err() == nil {
+			if cerr, ok := err.(*ClientError); ok && cerr.Err == context.DeadlineExceeded {
+				return nil, ErrNoInformResponse
+			}
+		}
+		return nil, err
+	}
+	return ack.Options, nil
+}
+
+// informPacket returns a DHCPINFORM for ip. Unlike in requests, ciaddr is
+// set and the broadcast flag is not, as the client can receive unicast on
+// ip, and the packet carries neither a requested address nor a server
+// identifier, see RFC 2131 Section 4.4.3.
+func (c *Client) informPacket(ip net.IP) (*dhcp4.Packet, error) {
+	p := dhcp4.NewPacket(dhcp4.BootRequest)
+	if err := identify(p, c.Identity()); err != nil {
+		return nil, err
+	}
+	p.TransactionID = c.newXID()
+	p.CIAddr = ip
+
+	p.Options.SetMessageType(dhcp4.DHCPInform)
+	p.Options.Add(dhcp4.OptionMaximumDHCPMessageSize, dhcp4opts.Uint16(c.maxSize))
+	c.requestOptions(p)
+	return p, nil
+}
@@ -0,0 +1,83 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+)
+
+func TestInform(t *testing.T) {
+	ip := net.IP{192, 168, 1, 10}
+	dns := net.IP{192, 168, 0, 53}
+
+	ack := newReply(dhcp4.DHCPACK, nil)
+	ack.Options.SetServerIdentifier(serverA)
+	ack.Options.SetDomainNameServers([]net.IP{dns})
+
+	for _, tt := range []struct {
+		desc      string
+		responses [][]*dhcp4.Packet
+		wantErr   error
+	}{
+		{
+			desc:      "ack",
+			responses: [][]*dhcp4.Packet{{ack}},
+		},
+		{
+			desc: "nak ignored",
+			responses: [][]*dhcp4.Packet{
+				{newReply(dhcp4.DHCPNAK, nil), ack},
+			},
+		},
+		{
+			desc:      "no response",
+			responses: [][]*dhcp4.Packet{{}, {}},
+			wantErr:   ErrNoInformResponse,
+		},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			c, s := serveClient(ctx, t, tt.responses, WithTimeout(100*time.Millisecond))
+			defer c.Close()
+
+			opts, err := c.inform(ctx, ip)
+			if err != tt.wantErr {
+				t.Fatalf("inform() = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil {
+				if got := opts.DomainNameServers(); len(got) != 1 || !got[0].Equal(dns) {
+					t.Errorf("inform() DNS servers = %v, want %v", got, dns)
+				}
+			}
+
+			if len(s.packets()) != 1 {
+				t.Fatalf("client sent %d packets, want 1", len(s.packets()))
+			}
+			p := s.packets()[0]
+			if typ := p.Options.MessageType(); typ != dhcp4.DHCPInform {
+				t.Errorf("client sent %v, want %v", typ, dhcp4.DHCPInform)
+			}
+			if !p.CIAddr.Equal(ip) {
+				t.Errorf("DHCPINFORM ciaddr = %v, want %v", p.CIAddr, ip)
+			}
+			if p.Broadcast {
+				t.Errorf("DHCPINFORM has the broadcast flag set")
+			}
+			if p.Options.Get(dhcp4.OptionRequestedIPAddress) != nil || p.Options.Get(dhcp4.OptionServerIdentifier) != nil {
+				t.Errorf("DHCPINFORM has options %v, want no requested address or server identifier", p.Options)
+			}
+			if !s.destinations()[0].IP.Equal(net.IPv4bcast) {
+				t.Errorf("DHCPINFORM sent to %v, want broadcast", s.destinations()[0].IP)
+			}
+		})
+	}
+}
@@ -0,0 +1,622 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+	"github.com/mergetb/dhcp4/dhcp4opts"
+)
+
+// Lease is an address leased to the client by a server.
+type Lease struct {
+	// IP is the leased address.
+	IP net.IP
+
+	// ServerID identifies the server that granted the lease.
+	ServerID net.IP
+
+	// Start is when the request for the lease was sent. Lease times are
+	// relative to it, as RFC 2131 Section 4.4.1 requires.
+	Start time.Time
+
+	// Duration is the lease time. It is 0 for leases that never expire.
+	Duration time.Duration
+
+	// RenewalTime (T1) and RebindingTime (T2) are when the client should
+	// renew the lease with its server and rebind it with any server,
+	// relative to Start. They are 0 for leases that never expire.
+	RenewalTime   time.Duration
+	RebindingTime time.Duration
+
+	// Options are the options the server sent with the lease.
+	Options dhcp4.Options
+
+	// ACK is the server's acknowledgement of the lease.
+	ACK *dhcp4.Packet
+
+	// LinkLocal is whether IP is an IPv4 link-local address the client
+	// chose itself because no server answered, see
+	// WithLinkLocalFallback. Such leases have neither a server nor an
+	// ACK, and never expire.
+	LinkLocal bool
+
+	// TimeToLease is how long it took to get the lease, from the first
+	// DISCOVER sent by RequestLease until the lease was acquired, including
+	// retransmissions, NAKs and declined addresses. For leases returned by
+	// AcquireAndConfigure, it includes configuring the interface. It is 0
+	// for renewed and rebound leases.
+	TimeToLease time.Duration
+}
+
+// Expiry returns when the lease expires, or the zero time if it never does.
+func (l *Lease) Expiry() time.Time {
+	if l.Duration == 0 {
+		return time.Time{}
+	}
+	return l.Start.Add(l.Duration)
+}
+
+// String implements fmt.Stringer.
+func (l *Lease) String() string {
+	if l.LinkLocal {
+		return fmt.Sprintf("%v link-local", l.IP)
+	}
+	if l.Duration == 0 {
+		return fmt.Sprintf("%v from %v forever", l.IP, l.ServerID)
+	}
+	return fmt.Sprintf("%v from %v for %v", l.IP, l.ServerID, l.Duration)
+}
+
+// BootInfo returns where the server told the client to boot from, wherever
+// in the ACK it put it, see dhcp4.Packet.BootInfo. If the ACK names no boot
+// server, the next server is the server that granted the lease, as network
+// boot firmware assumes.
+func (l *Lease) BootInfo() dhcp4.BootInfo {
+	if l.ACK == nil {
+		return dhcp4.BootInfo{}
+	}
+	bi := l.ACK.BootInfo()
+	if bi.NextServer == nil && bi.ServerName == "" {
+		bi.NextServer = l.ServerID
+	}
+	return bi
+}
+
+// infiniteLeaseTime is the encoded lease time of leases that never expire,
+// as defined by RFC 2131 Section 3.3.
+var infiniteLeaseTime = []byte{0xff, 0xff, 0xff, 0xff}
+
+// newLease returns the lease granted by ack to a request sent at start.
+func newLease(ack *dhcp4.Packet, start time.Time) (*Lease, error) {
+	if ack.YIAddr == nil || ack.YIAddr.Equal(net.IPv4zero) {
+		return nil, fmt.Errorf("ACK without an address")
+	}
+	l := &Lease{
+		IP:       ack.YIAddr,
+		ServerID: ack.Options.ServerIdentifier(),
+		Start:    start,
+		Options:  ack.Options,
+		ACK:      ack,
+	}
+	if ack.Options.Get(dhcp4.OptionIPAddressLeaseTime) == nil || bytes.Equal(ack.Options.Get(dhcp4.OptionIPAddressLeaseTime), infiniteLeaseTime) {
+		// Servers not sending a lease time are most likely not
+		// expiring leases either.
+		return l, nil
+	}
+
+	l.Duration = ack.Options.LeaseTime()
+	if l.Duration == 0 {
+		return nil, fmt.Errorf("ACK with malformed lease time %v", ack.Options.Get(dhcp4.OptionIPAddressLeaseTime))
+	}
+	// Defaults of RFC 2131 Section 4.4.5.
+	l.RenewalTime = ack.Options.RenewalTime()
+	if l.RenewalTime == 0 || l.RenewalTime >= l.Duration {
+		l.RenewalTime = l.Duration / 2
+	}
+	l.RebindingTime = ack.Options.RebindingTime()
+	if l.RebindingTime <= l.RenewalTime || l.RebindingTime >= l.Duration {
+		l.RebindingTime = l.Duration * 7 / 8
+	}
+	return l, nil
+}
+
+// OfferSelector chooses the offer to request among the offers received
+// during the offer wait, one per server, or returns nil to request none of
+// them.
+type OfferSelector func(offers []*dhcp4.Packet) *dhcp4.Packet
+
+// ErrNoAcceptableOffer is returned by RequestLease if the offer selector chose
+// none of the offers received.
+var ErrNoAcceptableOffer = errors.New("no acceptable offer")
+
+// FirstOffer is an OfferSelector choosing the first offer received.
+func FirstOffer(offers []*dhcp4.Packet) *dhcp4.Packet {
+	return offers[0]
+}
+
+// LongestLease is an OfferSelector choosing the offer with the longest lease
+// time, and the first such offer if several are equally long.
+func LongestLease(offers []*dhcp4.Packet) *dhcp4.Packet {
+	best := offers[0]
+	for _, o := range offers[1:] {
+		if o.Options.LeaseTime() > best.Options.LeaseTime() {
+			best = o
+		}
+	}
+	return best
+}
+
+// PreferServer returns an OfferSelector choosing the first offer from the
+// server with identifier id, e.g. to pick a server in a multi-homed network.
+// If there is none, it chooses as fallback does, or none if fallback is nil.
+func PreferServer(id net.IP, fallback OfferSelector) OfferSelector {
+	return preferOffer(func(o *dhcp4.Packet) bool {
+		return o.Options.ServerIdentifier().Equal(id)
+	}, fallback)
+}
+
+// PreferBootOffer returns an OfferSelector choosing the first offer with a
+// boot file, in the file field or the boot file name option. If there is
+// none, it chooses as fallback does, or none if fallback is nil.
+func PreferBootOffer(fallback OfferSelector) OfferSelector {
+	return preferOffer(func(o *dhcp4.Packet) bool {
+		return o.BootFile != "" || o.Options.BootFileName() != ""
+	}, fallback)
+}
+
+// preferOffer returns an OfferSelector choosing the first offer preferred,
+// or as fallback does if there is none.
+func preferOffer(preferred func(*dhcp4.Packet) bool, fallback OfferSelector) OfferSelector {
+	return func(offers []*dhcp4.Packet) *dhcp4.Packet {
+		for _, o := range offers {
+			if preferred(o) {
+				return o
+			}
+		}
+		if fallback == nil {
+			return nil
+		}
+		return fallback(offers)
+	}
+}
+
+// WithOfferWait configures how long RequestLease collects offers after the
+// first one arrived, for the offer selector to choose from.
+//
+// Default is 0, i.e. the first offer is requested right away.
+func WithOfferWait(d time.Duration) ClientOpt {
+	return func(c *Client) error {
+		c.offerWait = d
+		return nil
+	}
+}
+
+// WithOfferSelector configures how RequestLease chooses among several offers.
+// It only sees more than one offer with WithOfferWait.
+//
+// Default is FirstOffer.
+func WithOfferSelector(s OfferSelector) ClientOpt {
+	return func(c *Client) error {
+		c.offerSelector = s
+		return nil
+	}
+}
+
+// Request completes the 4-way Discover-Offer-Request-Ack handshake and
+// returns the server's response to the request, as the original u-root
+// client does: an ACK, or the NAK of a server refusing the request, with a
+// nil error either way. The request is broadcast, and the first response
+// taken.
+//
+// RequestLease selects among offers, returns a *NAKError for NAKs and
+// returns a Lease.
+func (c *Client) Request() (*dhcp4.Packet, error) {
+	offer, err := c.DiscoverOffer()
+	if err != nil {
+		return nil, err
+	}
+	request, err := c.NewRequestPacket(offer)
+	if err != nil {
+		return nil, err
+	}
+	return c.SendAndReadOne(request)
+}
+
+// RequestLease acquires a lease by running the Discover-Offer-Request-Ack
+// handshake of RFC 2131 Section 4.4.1.
+//
+// RequestLease collects offers as configured by WithOfferWait, lets the
+// offer selector choose one, and requests it from its server. If the server
+// answers with a NAK, RequestLease returns a *NAKError; calling RequestLease
+// again restarts acquisition, after the hold-off configured with
+// WithNAKHoldOff if NAKs keep coming. WithNAKRestart makes RequestLease
+// restart by itself.
+//
+// With WithAddressProber, RequestLease declines addresses in use and
+// restarts acquisition after 10 seconds, as RFC 2131 Section 3.1 requires,
+// ignoring offers of the addresses it declined. After 3 declines it returns
+// a *ConflictError.
+//
+// With WithLinkLocalFallback, RequestLease returns a link-local lease if no
+// server answers.
+//
+// With WithLeaseFile, RequestLease first asks for the lease cached before
+// the client restarted.
+//
+// The lease's TimeToLease is reported to the client's Metrics.
+func (c *Client) RequestLease(ctx context.Context) (*Lease, error) {
+	lease, err := c.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.metrics.TimeToLease(lease.TimeToLease)
+	return lease, nil
+}
+
+// acquire is RequestLease without reporting the time to lease.
+func (c *Client) acquire(ctx context.Context) (*Lease, error) {
+	// began is when the first DISCOVER was sent.
+	var began time.Time
+	cached := c.cachedLease(time.Now())
+	// declined are the addresses found in use, which are not requested
+	// again.
+	var declined []net.IP
+	for naked := 0; ; {
+		lease, err := c.requestOnce(ctx, &began, cached, declined)
+		cached = nil
+		if _, ok := err.(*NAKError); ok && naked < c.nakRestarts {
+			// Back to INIT, see RFC 2131, Section 3.1.
+			naked++
+			continue
+		}
+		if err != nil {
+			if c.linkLocal != nil && ctx.Err() == nil && noAnswer(err) {
+				lease, err = c.linkLocalLease(ctx)
+				if err != nil {
+					return nil, err
+				}
+				lease.TimeToLease = time.Since(began)
+				return lease, nil
+			}
+			return nil, err
+		}
+		err = c.probe(ctx, lease)
+		ce, ok := err.(*ConflictError)
+		if !ok {
+			if err != nil {
+				return nil, err
+			}
+			lease.TimeToLease = time.Since(began)
+			return lease, nil
+		}
+		declined = append(declined, ce.IP)
+		if len(declined) >= maxDeclines {
+			ce.Declined = len(declined)
+			return nil, ce
+		}
+		if !sleep(ctx, c.declineWait) {
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// requestOnce runs the handshake once, recording when it began in began if
+// it is zero. If cached is not nil, it is requested first. Offers of the
+// declined addresses are discarded.
+func (c *Client) requestOnce(ctx context.Context, began *time.Time, cached *Lease, declined []net.IP) (*Lease, error) {
+	if !sleep(ctx, c.naks.holdOff(time.Now())) {
+		return nil, ctx.Err()
+	}
+	now := time.Now()
+	if began.IsZero() {
+		*began = now
+	}
+	ctx = withStart(ctx, now)
+
+	if c.bootp {
+		return c.bootpLease(ctx)
+	}
+	if cached != nil {
+		// Fall back to discovery on NAKs and timeouts.
+		lease, err := c.reboot(ctx, cached)
+		if err == nil || ctx.Err() != nil {
+			return lease, err
+		}
+	}
+
+	offer, err := c.selectOffer(ctx, declined)
+	if err != nil {
+		return nil, err
+	}
+	if c.rapidACK(offer) {
+		return c.rapidLease(offer, now)
+	}
+	request, err := c.NewRequestPacket(offer)
+	if err != nil {
+		return nil, err
+	}
+	return c.requestLease(ctx, DefaultServers, request, offer.YIAddr)
+}
+
+// sleep waits for d and returns true, or returns false if ctx is canceled
+// first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Renew broadcasts a renewal request for the lease granted by ack and
+// returns the first response, an ACK or a NAK, as the original u-root client
+// does.
+//
+// RenewLease unicasts the renewal to the server that granted the lease, as
+// RFC 2131 Section 4.4.5 requires, and returns a *NAKError for NAKs.
+func (c *Client) Renew(ack *dhcp4.Packet) (*dhcp4.Packet, error) {
+	request, err := c.NewRequestPacket(ack)
+	if err != nil {
+		return nil, err
+	}
+	return c.SendAndReadOne(request)
+}
+
+// RenewLease renews lease with the server that granted it, as described by
+// RFC 2131 Section 4.4.5, and returns the renewed lease.
+//
+// If the server answers with a NAK, RenewLease returns a *NAKError and the
+// lease must not be used anymore.
+func (c *Client) RenewLease(ctx context.Context, lease *Lease) (*Lease, error) {
+	if lease.ServerID == nil {
+		return nil, fmt.Errorf("lease %v has no server identifier to renew with", lease)
+	}
+	renew, err := c.renewPacket(lease)
+	if err != nil {
+		return nil, err
+	}
+	dest := &net.UDPAddr{IP: lease.ServerID, Port: ServerPort}
+	return c.requestLease(ctx, dest, renew, lease.IP)
+}
+
+// Release gives lease back to the server that granted it, as described by
+// RFC 2131 Section 4.4.6: the release is unicast to the lease's server
+// identifier, with the address in ciaddr and without the broadcast flag.
+// Servers do not answer releases.
+func (c *Client) Release(ctx context.Context, lease *Lease) error {
+	return c.release(ctx, lease, c.Identity())
+}
+
+// release gives lease back under identity id.
+func (c *Client) release(ctx context.Context, lease *Lease, id Identity) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if lease.ServerID == nil {
+		return fmt.Errorf("lease %v has no server identifier to release to", lease)
+	}
+
+	p := dhcp4.NewPacket(dhcp4.BootRequest)
+	if err := identify(p, id); err != nil {
+		return err
+	}
+	c.forgetLease()
+
+	p.TransactionID = c.newXID()
+	p.CIAddr = lease.IP
+	p.Options.SetMessageType(dhcp4.DHCPRelease)
+	p.Options.SetServerIdentifier(lease.ServerID)
+
+	b, err := c.encode(p)
+	if err != nil {
+		return err
+	}
+	dest := &net.UDPAddr{IP: lease.ServerID, Port: ServerPort}
+	conn := c.getConn()
+	if _, err = conn.WriteTo(b, dest); err != nil && c.recoverConn(conn, err) {
+		conn = c.getConn()
+		_, err = conn.WriteTo(b, dest)
+	}
+	if err == nil {
+		c.captureSent(conn, b, dest)
+		c.reportPacket(PacketEvent{Kind: PacketSent, Packet: p, Addr: dest, Attempt: 1})
+	}
+	return err
+}
+
+// renewPacket returns a DHCPREQUEST renewing lease, as described by RFC 2131
+// Section 4.3.2 for the RENEWING and REBINDING states.
+func (c *Client) renewPacket(lease *Lease) (*dhcp4.Packet, error) {
+	p := dhcp4.NewPacket(dhcp4.BootRequest)
+	if err := identify(p, c.Identity()); err != nil {
+		return nil, err
+	}
+	p.TransactionID = c.newXID()
+	p.CIAddr = lease.IP
+
+	p.Options.Add(dhcp4.OptionDHCPMessageType, dhcp4opts.DHCPRequest)
+	p.Options.Add(dhcp4.OptionMaximumDHCPMessageSize, dhcp4opts.Uint16(c.maxSize))
+	c.describe(p)
+	c.requestOptions(p)
+	return p, nil
+}
+
+// selectOffer sends a Discover and returns the offer chosen by the offer
+// selector among the offers received, or the first rapid commit ACK if the
+// client asked for one. Offers of the declined addresses are discarded.
+func (c *Client) selectOffer(ctx context.Context, declined []net.IP) (*dhcp4.Packet, error) {
+	discover, err := c.NewDiscoverPacket()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	wg, out, errCh := c.SimpleSendAndRead(ctx, DefaultServers, discover)
+	defer func() {
+		// Explicitly cancel first, then wait.
+		cancel()
+		wg.Wait()
+	}()
+
+	var offers []*Offer
+	var wait <-chan time.Time
+collect:
+	for {
+		select {
+		case packet, ok := <-out:
+			if !ok {
+				break collect
+			}
+			if containsIP(declined, packet.Packet.YIAddr) {
+				// Servers should not offer declined addresses
+				// again, but may not know they were declined.
+				c.reportPacket(PacketEvent{Kind: PacketDiscarded, Time: packet.Received, Packet: packet.Packet, Addr: packet.Source, Reason: RejectDeclined})
+				continue
+			}
+			if c.rapidACK(packet.Packet) {
+				return packet.Packet, nil
+			}
+			if c.discardOffer(packet) {
+				continue
+			}
+			var added bool
+			if offers, added = addOffer(offers, packet); !added {
+				continue
+			}
+			if c.offerWait <= 0 {
+				break collect
+			}
+			if wait == nil {
+				wait = time.After(c.offerWait)
+			}
+
+		case <-wait:
+			break collect
+		}
+	}
+
+	if len(offers) > 0 {
+		packets := make([]*dhcp4.Packet, 0, len(offers))
+		for _, o := range offers {
+			packets = append(packets, o.Packet)
+		}
+		if offer := c.offerSelector(packets); offer != nil {
+			return offer, nil
+		}
+		return nil, ErrNoAcceptableOffer
+	}
+	if err, ok := <-errCh; ok && err != nil {
+		return nil, err
+	}
+	return nil, errors.New("no offers received")
+}
+
+// validOffer returns whether offer can be requested.
+func validOffer(offer *dhcp4.Packet) bool {
+	return offer.Options.MessageType() == dhcp4.DHCPOffer && checkOffer(offer) == nil
+}
+
+// checkOffer returns the rules of RFC 2131 for servers that offer breaks, or
+// nil. Offers without a lease time are taken for an infinite lease, as
+// servers such as dhcp4server send none unless configured to.
+func checkOffer(offer *dhcp4.Packet) error {
+	errs, ok := offer.ValidateMessage(dhcp4.RoleServer).(dhcp4.ValidationErrors)
+	if !ok {
+		return nil
+	}
+	var broken dhcp4.ValidationErrors
+	for _, err := range errs {
+		if err.Option != dhcp4.OptionIPAddressLeaseTime {
+			broken = append(broken, err)
+		}
+	}
+	if len(broken) == 0 {
+		return nil
+	}
+	return broken
+}
+
+// discardOffer returns whether p, received while collecting offers, cannot
+// be requested, and reports why to the Logger: it is not an offer, or it
+// breaks the rules for offers.
+func (c *Client) discardOffer(p *ClientPacket) bool {
+	ev := PacketEvent{Kind: PacketDiscarded, Time: p.Received, Packet: p.Packet, Addr: p.Source, Reason: RejectUnwanted}
+	if p.Packet.Options.MessageType() == dhcp4.DHCPOffer {
+		if ev.Err = checkOffer(p.Packet); ev.Err == nil {
+			return false
+		}
+		ev.Reason = RejectInvalid
+	}
+	c.reportPacket(ev)
+	return true
+}
+
+// requestLease sends request for ip to dest and returns the lease granted.
+func (c *Client) requestLease(ctx context.Context, dest *net.UDPAddr, request *dhcp4.Packet, ip net.IP) (*Lease, error) {
+	sid := request.Options.ServerIdentifier()
+	start := time.Now()
+	response, err := c.exchange(ctx, dest, request, func(p *dhcp4.Packet) bool {
+		switch p.Options.MessageType() {
+		case dhcp4.DHCPACK, dhcp4.DHCPNAK:
+			// Other servers may see the request, but only the
+			// selected one answers it.
+			psid := p.Options.ServerIdentifier()
+			return sid == nil || psid == nil || psid.Equal(sid)
+		default:
+			return false
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := c.naks.observe(time.Now(), ip, response); err != nil {
+		c.forgetLease()
+		return nil, err
+	}
+	lease, err := newLease(response, start)
+	if err != nil {
+		return nil, err
+	}
+	if lease.Duration > 0 {
+		c.metrics.Lease(lease.Duration)
+	}
+	c.saveLease(lease)
+	return lease, nil
+}
+
+// exchange sends p to dest and returns the first response accepted by
+// accept.
+func (c *Client) exchange(ctx context.Context, dest *net.UDPAddr, p *dhcp4.Packet, accept func(*dhcp4.Packet) bool) (*dhcp4.Packet, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	wg, out, errCh := c.SimpleSendAndRead(ctx, dest, p)
+	defer func() {
+		// Explicitly cancel first, then wait.
+		cancel()
+		wg.Wait()
+	}()
+
+	for response := range out {
+		if accept(response.Packet) {
+			return response.Packet, nil
+		}
+		c.reportPacket(PacketEvent{Kind: PacketDiscarded, Time: response.Received, Packet: response.Packet, Addr: response.Source, Reason: RejectUnwanted})
+	}
+	if err, ok := <-errCh; ok && err != nil {
+		return nil, err
+	}
+	return nil, errors.New("no acceptable response received")
+}
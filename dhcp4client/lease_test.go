@@ -0,0 +1,332 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+)
+
+var (
+	serverA = net.IP{192, 168, 0, 1}
+	serverB = net.IP{192, 168, 0, 2}
+)
+
+// newLeaseReply returns a response of type typ from server sid, leasing ip
+// for d.
+func newLeaseReply(typ dhcp4.MessageType, sid, ip net.IP, d time.Duration) *dhcp4.Packet {
+	p := newReply(typ, ip)
+	p.Options.SetServerIdentifier(sid)
+	if d > 0 {
+		p.Options.SetLeaseTime(d)
+	}
+	return p
+}
+
+// mustPacket returns a function returning the packet a packet builder
+// returned, failing t if it returned an error.
+func mustPacket(t *testing.T) func(*dhcp4.Packet, error) *dhcp4.Packet {
+	return func(p *dhcp4.Packet, err error) *dhcp4.Packet {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+}
+
+// serveClient returns a client talking to a server sending responses.
+func serveClient(ctx context.Context, t *testing.T, responses [][]*dhcp4.Packet, opts ...ClientOpt) (*Client, *server) {
+	in := make(chan udpPacket, 100)
+	out := make(chan udpPacket, 100)
+
+	opts = append([]ClientOpt{WithConn(newMockUDPConn(in, out)), WithRetry(1), WithTimeout(time.Second), withZeroXID}, opts...)
+	c, err := New(nil, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &server{
+		in:        out,
+		out:       in,
+		responses: responses,
+	}
+	go s.serve(ctx)
+	return c, s
+}
+
+func TestRequestLease(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ip := net.IP{192, 168, 1, 10}
+	c, s := serveClient(ctx, t, [][]*dhcp4.Packet{
+		{newLeaseReply(dhcp4.DHCPOffer, serverA, ip, time.Hour)},
+		{newLeaseReply(dhcp4.DHCPACK, serverA, ip, time.Hour)},
+	})
+	defer c.Close()
+
+	start := time.Now()
+	lease, err := c.RequestLease(ctx)
+	if err != nil {
+		t.Fatalf("Request() = %v", err)
+	}
+	if !lease.IP.Equal(ip) || !lease.ServerID.Equal(serverA) {
+		t.Errorf("Request() = %v, want %v from %v", lease, ip, serverA)
+	}
+	if lease.Duration != time.Hour || lease.RenewalTime != 30*time.Minute || lease.RebindingTime != 52*time.Minute+30*time.Second {
+		t.Errorf("lease times %v, %v, %v, want 1h, T1 30m, T2 52m30s", lease.Duration, lease.RenewalTime, lease.RebindingTime)
+	}
+	if lease.Start.Before(start) || lease.Expiry() != lease.Start.Add(time.Hour) {
+		t.Errorf("lease started %v expiring %v, want after %v for 1h", lease.Start, lease.Expiry(), start)
+	}
+
+	if len(s.packets()) != 2 {
+		t.Fatalf("server received %d packets, want DISCOVER and REQUEST", len(s.packets()))
+	}
+	req := s.packets()[1]
+	if typ := req.Options.MessageType(); typ != dhcp4.DHCPRequest {
+		t.Errorf("second packet is %v, want DHCPREQUEST", typ)
+	}
+	if sid := req.Options.ServerIdentifier(); !sid.Equal(serverA) {
+		t.Errorf("REQUEST for server %v, want %v", sid, serverA)
+	}
+	if rip := req.Options.RequestedIPAddress(); !rip.Equal(ip) {
+		t.Errorf("REQUEST for %v, want %v", rip, ip)
+	}
+}
+
+func TestRequestOfferSelection(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ipA := net.IP{192, 168, 1, 10}
+	ipB := net.IP{192, 168, 2, 10}
+	c, s := serveClient(ctx, t, [][]*dhcp4.Packet{
+		{
+			newLeaseReply(dhcp4.DHCPOffer, serverA, ipA, time.Minute),
+			newLeaseReply(dhcp4.DHCPOffer, serverB, ipB, time.Hour),
+		},
+		{
+			// Server A does not see its offer declined in this
+			// test, but must be ignored anyway.
+			newLeaseReply(dhcp4.DHCPACK, serverA, ipA, time.Minute),
+			newLeaseReply(dhcp4.DHCPACK, serverB, ipB, time.Hour),
+		},
+	}, WithOfferWait(50*time.Millisecond), WithOfferSelector(LongestLease))
+	defer c.Close()
+
+	lease, err := c.RequestLease(ctx)
+	if err != nil {
+		t.Fatalf("Request() = %v", err)
+	}
+	if !lease.IP.Equal(ipB) || !lease.ServerID.Equal(serverB) {
+		t.Errorf("Request() = %v, want %v from %v", lease, ipB, serverB)
+	}
+	if sid := s.packets()[1].Options.ServerIdentifier(); !sid.Equal(serverB) {
+		t.Errorf("REQUEST for server %v, want %v", sid, serverB)
+	}
+}
+
+func TestOfferSelectors(t *testing.T) {
+	ip := net.IP{192, 168, 1, 10}
+	short := newLeaseReply(dhcp4.DHCPOffer, serverA, ip, time.Minute)
+	long := newLeaseReply(dhcp4.DHCPOffer, serverA, ip, time.Hour)
+	fromB := newLeaseReply(dhcp4.DHCPOffer, serverB, ip, time.Minute)
+	boot := newLeaseReply(dhcp4.DHCPOffer, serverA, ip, time.Minute)
+	boot.BootFile = "pxelinux.0"
+	bootOption := newLeaseReply(dhcp4.DHCPOffer, serverA, ip, time.Minute)
+	bootOption.Options.SetBootFileName("ipxe.efi")
+
+	for _, tt := range []struct {
+		desc   string
+		s      OfferSelector
+		offers []*dhcp4.Packet
+		want   *dhcp4.Packet
+	}{
+		{desc: "first", s: FirstOffer, offers: []*dhcp4.Packet{short, long}, want: short},
+		{desc: "longest", s: LongestLease, offers: []*dhcp4.Packet{short, long}, want: long},
+		{desc: "server", s: PreferServer(serverB, FirstOffer), offers: []*dhcp4.Packet{short, fromB}, want: fromB},
+		{desc: "server fallback", s: PreferServer(serverB, LongestLease), offers: []*dhcp4.Packet{short, long}, want: long},
+		{desc: "server only", s: PreferServer(serverB, nil), offers: []*dhcp4.Packet{short, long}, want: nil},
+		{desc: "boot file", s: PreferBootOffer(FirstOffer), offers: []*dhcp4.Packet{short, boot}, want: boot},
+		{desc: "boot file option", s: PreferBootOffer(FirstOffer), offers: []*dhcp4.Packet{short, bootOption}, want: bootOption},
+		{desc: "boot fallback", s: PreferBootOffer(FirstOffer), offers: []*dhcp4.Packet{short, long}, want: short},
+	} {
+		if got := tt.s(tt.offers); got != tt.want {
+			t.Errorf("%s: selected %v, want %v", tt.desc, got, tt.want)
+		}
+	}
+}
+
+func TestRequestNoAcceptableOffer(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	c, _ := serveClient(ctx, t, [][]*dhcp4.Packet{
+		{newLeaseReply(dhcp4.DHCPOffer, serverA, net.IP{192, 168, 1, 10}, time.Hour)},
+	}, WithOfferSelector(PreferServer(serverB, nil)))
+	defer c.Close()
+
+	if _, err := c.RequestLease(ctx); err != ErrNoAcceptableOffer {
+		t.Errorf("Request() = %v, want %v", err, ErrNoAcceptableOffer)
+	}
+}
+
+func TestRenewLease(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ip := net.IP{192, 168, 1, 10}
+	c, s := serveClient(ctx, t, [][]*dhcp4.Packet{
+		{newLeaseReply(dhcp4.DHCPACK, serverA, ip, 2*time.Hour)},
+	})
+	defer c.Close()
+
+	lease := &Lease{IP: ip, ServerID: serverA, Duration: time.Hour}
+	renewed, err := c.RenewLease(ctx, lease)
+	if err != nil {
+		t.Fatalf("Renew() = %v", err)
+	}
+	if !renewed.IP.Equal(ip) || renewed.Duration != 2*time.Hour {
+		t.Errorf("Renew() = %v, want %v for 2h", renewed, ip)
+	}
+	if renewed.TimeToLease != 0 {
+		t.Errorf("Renew() time to lease = %v, want 0", renewed.TimeToLease)
+	}
+
+	req := s.packets()[0]
+	if !req.CIAddr.Equal(ip) {
+		t.Errorf("renewal ciaddr = %v, want %v", req.CIAddr, ip)
+	}
+	for _, code := range []dhcp4.OptionCode{dhcp4.OptionServerIdentifier, dhcp4.OptionRequestedIPAddress} {
+		if v := req.Options.Get(code); v != nil {
+			t.Errorf("renewal has option %d = %v, want none", code, v)
+		}
+	}
+}
+
+func TestRequestRenewNAK(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ip := net.IP{192, 168, 1, 10}
+	c, s := serveClient(ctx, t, [][]*dhcp4.Packet{
+		{newLeaseReply(dhcp4.DHCPOffer, serverA, ip, time.Hour)},
+		{newLeaseReply(dhcp4.DHCPNAK, serverA, nil, 0)},
+		{newLeaseReply(dhcp4.DHCPNAK, serverA, nil, 0)},
+	})
+	defer c.Close()
+
+	// Request and Renew return NAKs as the original client does.
+	nak, err := c.Request()
+	if err != nil || nak.Options.MessageType() != dhcp4.DHCPNAK {
+		t.Fatalf("Request() = %v, %v, want the NAK", nak, err)
+	}
+	nak, err = c.Renew(newLeaseReply(dhcp4.DHCPACK, serverA, ip, time.Hour))
+	if err != nil || nak.Options.MessageType() != dhcp4.DHCPNAK {
+		t.Errorf("Renew() = %v, %v, want the NAK", nak, err)
+	}
+	for i, dest := range s.destinations() {
+		if !dest.IP.Equal(DefaultServers.IP) {
+			t.Errorf("packet %d sent to %v, want broadcast", i, dest)
+		}
+	}
+}
+
+func TestRelease(t *testing.T) {
+	in := make(chan udpPacket, 1)
+	out := make(chan udpPacket, 1)
+	c, err := New(nil, WithConn(newMockUDPConn(in, out)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	ip := net.IP{192, 168, 1, 10}
+	if err := c.Release(context.Background(), &Lease{IP: ip, ServerID: serverA}); err != nil {
+		t.Fatalf("Release() = %v", err)
+	}
+
+	sent := <-out
+	if !sent.dest.IP.Equal(serverA) || sent.dest.Port != ServerPort {
+		t.Errorf("release sent to %v, want %v:%d", sent.dest, serverA, ServerPort)
+	}
+	p, err := dhcp4.ParsePacket(sent.payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typ := p.Options.MessageType(); typ != dhcp4.DHCPRelease || !p.CIAddr.Equal(ip) || !p.Options.ServerIdentifier().Equal(serverA) {
+		t.Errorf("sent %v with ciaddr %v, server %v; want DHCPRELEASE of %v to %v", typ, p.CIAddr, p.Options.ServerIdentifier(), ip, serverA)
+	}
+}
+
+func TestNewLeaseInfinite(t *testing.T) {
+	ack := newLeaseReply(dhcp4.DHCPACK, serverA, net.IP{192, 168, 1, 10}, 0)
+	ack.Options[dhcp4.OptionIPAddressLeaseTime] = []byte{0xff, 0xff, 0xff, 0xff}
+	lease, err := newLease(ack, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lease.Duration != 0 || !lease.Expiry().IsZero() {
+		t.Errorf("infinite lease has duration %v expiring %v, want 0 and never", lease.Duration, lease.Expiry())
+	}
+}
+
+func TestLeaseBootInfo(t *testing.T) {
+	ip := net.IP{192, 168, 1, 10}
+	tftp := net.IP{10, 0, 0, 5}
+
+	for _, tt := range []struct {
+		desc  string
+		setup func(ack *dhcp4.Packet)
+		want  dhcp4.BootInfo
+	}{
+		{
+			desc: "fields",
+			setup: func(ack *dhcp4.Packet) {
+				ack.SIAddr = tftp
+				ack.ServerName = "tftp"
+				ack.BootFile = "pxelinux.0"
+			},
+			want: dhcp4.BootInfo{ServerName: "tftp", NextServer: tftp, BootFile: "pxelinux.0"},
+		},
+		{
+			desc: "options",
+			setup: func(ack *dhcp4.Packet) {
+				ack.Options.SetTFTPServerName("10.0.0.5")
+				ack.Options.SetBootFileName("pxelinux.0")
+			},
+			want: dhcp4.BootInfo{ServerName: "10.0.0.5", NextServer: tftp, BootFile: "pxelinux.0"},
+		},
+		{
+			desc: "lease server",
+			setup: func(ack *dhcp4.Packet) {
+				ack.BootFile = "pxelinux.0"
+			},
+			want: dhcp4.BootInfo{NextServer: serverA, BootFile: "pxelinux.0"},
+		},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			ack := newLeaseReply(dhcp4.DHCPACK, serverA, ip, time.Hour)
+			tt.setup(ack)
+			lease, err := newLease(ack, time.Now())
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := lease.BootInfo()
+			if got.ServerName != tt.want.ServerName || !got.NextServer.Equal(tt.want.NextServer) || got.BootFile != tt.want.BootFile {
+				t.Errorf("BootInfo() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if got := (&Lease{}).BootInfo(); got.NextServer != nil || got.BootFile != "" {
+		t.Errorf("BootInfo() without ACK = %v, want nothing", got)
+	}
+}
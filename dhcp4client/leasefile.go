@@ -0,0 +1,134 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+	"github.com/mergetb/dhcp4/dhcp4opts"
+)
+
+// WithLeaseFile makes the client cache its lease in the file at path, so
+// that RequestLease after a restart first asks for the cached address again
+// with the INIT-REBOOT exchange of RFC 2131 Section 3.2, a single REQUEST,
+// rather than with a full discovery. If the cached lease expired or is for
+// another hardware address, or no server acknowledges the address in time,
+// RequestLease falls back to discovery.
+//
+// The file is written whenever a lease is acquired, renewed or rebound, and
+// removed when the lease is NAKed or released. Errors writing it are
+// ignored: the client merely discovers after its next restart.
+func WithLeaseFile(path string) ClientOpt {
+	return func(c *Client) error {
+		c.leaseFile = path
+		return nil
+	}
+}
+
+// leaseFileJSON is the contents of the lease file.
+type leaseFileJSON struct {
+	HardwareAddr string        `json:"hardware_addr"`
+	Start        time.Time     `json:"start"`
+	ACK          *dhcp4.Packet `json:"ack"`
+}
+
+// cachedLease returns the lease in the lease file if it is still valid at
+// now for the client's hardware address, or nil.
+func (c *Client) cachedLease(now time.Time) *Lease {
+	if c.leaseFile == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(c.leaseFile)
+	if err != nil {
+		return nil
+	}
+	var lf leaseFileJSON
+	if err := json.Unmarshal(data, &lf); err != nil || lf.ACK == nil {
+		return nil
+	}
+	if lf.HardwareAddr != c.Identity().HardwareAddr.String() {
+		return nil
+	}
+	lease, err := newLease(lf.ACK, lf.Start)
+	if err != nil {
+		return nil
+	}
+	if exp := lease.Expiry(); !exp.IsZero() && !now.Before(exp) {
+		return nil
+	}
+	return lease
+}
+
+// saveLease writes lease to the lease file, if configured.
+func (c *Client) saveLease(lease *Lease) {
+	if c.leaseFile == "" || lease.ACK == nil {
+		return
+	}
+	data, err := json.MarshalIndent(leaseFileJSON{
+		HardwareAddr: c.Identity().HardwareAddr.String(),
+		Start:        lease.Start,
+		ACK:          lease.ACK,
+	}, "", "\t")
+	if err != nil {
+		return
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(c.leaseFile), filepath.Base(c.leaseFile)+".tmp")
+	if err != nil {
+		return
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return
+	}
+	os.Rename(f.Name(), c.leaseFile)
+}
+
+// forgetLease removes the lease file, if configured.
+func (c *Client) forgetLease() {
+	if c.leaseFile != "" {
+		os.Remove(c.leaseFile)
+	}
+}
+
+// reboot asks any server to confirm the cached lease, as a client in the
+// INIT-REBOOT state does.
+func (c *Client) reboot(ctx context.Context, cached *Lease) (*Lease, error) {
+	reboot, err := c.rebootPacket(cached)
+	if err != nil {
+		return nil, err
+	}
+	return c.requestLease(ctx, DefaultServers, reboot, cached.IP)
+}
+
+// rebootPacket returns the REQUEST for the cached lease, see RFC 2131,
+// Section 4.3.2: the address is requested, but neither ciaddr nor the
+// server identifier are set.
+func (c *Client) rebootPacket(cached *Lease) (*dhcp4.Packet, error) {
+	p := dhcp4.NewPacket(dhcp4.BootRequest)
+	if err := identify(p, c.Identity()); err != nil {
+		return nil, err
+	}
+	p.TransactionID = c.newXID()
+	p.Broadcast = c.broadcast
+
+	p.Options.Add(dhcp4.OptionDHCPMessageType, dhcp4opts.DHCPRequest)
+	p.Options.Add(dhcp4.OptionMaximumDHCPMessageSize, dhcp4opts.Uint16(c.maxSize))
+	p.Options.Add(dhcp4.OptionRequestedIPAddress, dhcp4opts.IP(cached.IP))
+	c.describe(p)
+	c.requestOptions(p)
+	return p, nil
+}
@@ -0,0 +1,143 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+)
+
+func TestLeaseFileReboot(t *testing.T) {
+	ip, newIP := net.IP{192, 168, 1, 10}, net.IP{192, 168, 1, 11}
+	offer := newLeaseReply(dhcp4.DHCPOffer, serverA, newIP, time.Hour)
+	ack := newLeaseReply(dhcp4.DHCPACK, serverA, newIP, time.Hour)
+
+	for _, tt := range []struct {
+		desc      string
+		cached    time.Duration
+		responses [][]*dhcp4.Packet
+		want      net.IP
+		wantTypes []dhcp4.MessageType
+	}{
+		{
+			desc:      "rebooted",
+			cached:    time.Hour,
+			responses: [][]*dhcp4.Packet{{newLeaseReply(dhcp4.DHCPACK, serverA, ip, time.Hour)}},
+			want:      ip,
+			wantTypes: []dhcp4.MessageType{dhcp4.DHCPRequest},
+		},
+		{
+			desc:      "NAKed",
+			cached:    time.Hour,
+			responses: [][]*dhcp4.Packet{{newLeaseReply(dhcp4.DHCPNAK, serverA, nil, 0)}, {offer}, {ack}},
+			want:      newIP,
+			wantTypes: []dhcp4.MessageType{dhcp4.DHCPRequest, dhcp4.DHCPDiscover, dhcp4.DHCPRequest},
+		},
+		{
+			desc:      "no answer",
+			cached:    time.Hour,
+			responses: [][]*dhcp4.Packet{{}, {offer}, {ack}},
+			want:      newIP,
+			wantTypes: []dhcp4.MessageType{dhcp4.DHCPRequest, dhcp4.DHCPDiscover, dhcp4.DHCPRequest},
+		},
+		{
+			desc:      "expired",
+			cached:    -time.Minute,
+			responses: [][]*dhcp4.Packet{{offer}, {ack}},
+			want:      newIP,
+			wantTypes: []dhcp4.MessageType{dhcp4.DHCPDiscover, dhcp4.DHCPRequest},
+		},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "lease")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			path := filepath.Join(dir, "lease.json")
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			c, s := serveClient(ctx, t, tt.responses, WithLeaseFile(path), WithTimeout(100*time.Millisecond))
+			defer c.Close()
+
+			// Cache a lease on ip that started an hour ago.
+			cached := newLeaseReply(dhcp4.DHCPACK, serverA, ip, time.Hour+tt.cached)
+			lease, err := newLease(cached, time.Now().Add(-time.Hour))
+			if err != nil {
+				t.Fatal(err)
+			}
+			c.saveLease(lease)
+
+			lease, err = c.RequestLease(ctx)
+			if err != nil || !lease.IP.Equal(tt.want) {
+				t.Fatalf("Request() = %v, %v, want %v", lease, err, tt.want)
+			}
+			if len(s.packets()) != len(tt.wantTypes) {
+				t.Fatalf("client sent %d packets, want %v", len(s.packets()), tt.wantTypes)
+			}
+			for i, p := range s.packets() {
+				if got := p.Options.MessageType(); got != tt.wantTypes[i] {
+					t.Errorf("packet %d is %v, want %v", i, got, tt.wantTypes[i])
+				}
+			}
+			if tt.cached > 0 {
+				reboot := s.packets()[0]
+				if got := reboot.Options.RequestedIPAddress(); !got.Equal(ip) {
+					t.Errorf("INIT-REBOOT requested %v, want %v", got, ip)
+				}
+				if reboot.Options.ServerIdentifier() != nil || !reboot.CIAddr.Equal(net.IPv4zero) {
+					t.Errorf("INIT-REBOOT REQUEST has server identifier %v and ciaddr %v, want neither", reboot.Options.ServerIdentifier(), reboot.CIAddr)
+				}
+			}
+
+			// The new lease is cached for the next restart.
+			if got := c.cachedLease(time.Now()); got == nil || !got.IP.Equal(tt.want) {
+				t.Errorf("cached lease = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLeaseFileRelease(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lease")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "lease.json")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ip := net.IP{192, 168, 1, 10}
+	c, _ := serveClient(ctx, t, [][]*dhcp4.Packet{
+		{newLeaseReply(dhcp4.DHCPOffer, serverA, ip, time.Hour)},
+		{newLeaseReply(dhcp4.DHCPACK, serverA, ip, time.Hour)},
+	}, WithLeaseFile(path))
+	defer c.Close()
+
+	lease, err := c.RequestLease(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("lease file not written: %v", err)
+	}
+	if err := c.Release(ctx, lease); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("lease file after Release: %v, want it removed", err)
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+)
+
+// LeaseQuery selects the client a DHCPLEASEQUERY asks about. Exactly one of
+// the fields must be set.
+type LeaseQuery struct {
+	// IP asks which client holds the address.
+	IP net.IP
+
+	// HardwareAddr asks which address the client with the hardware
+	// address holds.
+	HardwareAddr net.HardwareAddr
+
+	// ClientID asks which address the client with the client identifier
+	// holds.
+	ClientID []byte
+}
+
+// LeaseInfo is a server's answer to a DHCPLEASEQUERY, see RFC 4388, Section
+// 6.4.
+type LeaseInfo struct {
+	// Status is DHCPLeaseActive if a client holds the address,
+	// DHCPLeaseUnassigned if the server manages the address but nobody
+	// holds it, and DHCPLeaseUnknown if the server knows nothing about
+	// the address or client.
+	Status dhcp4.MessageType
+
+	// IP is the address queried or held by the client queried.
+	IP net.IP
+
+	// HardwareAddr and ClientID identify the client holding IP.
+	HardwareAddr net.HardwareAddr
+	ClientID     []byte
+
+	// LeaseTime is the time left on the lease.
+	LeaseTime time.Duration
+
+	// LastTransaction is how long ago the client last talked to the
+	// server, or 0 if the server did not say.
+	LastTransaction time.Duration
+
+	// AssociatedIPs are all the addresses the client queried holds, if
+	// it holds several.
+	AssociatedIPs []net.IP
+}
+
+// LeaseQuery asks server which client holds an address, or which address a
+// client holds, as described by RFC 4388. It is meant for operator tools and
+// access concentrators, not for clients configuring themselves.
+//
+// The query is sent from the client's connection directly to server,
+// retransmitted as configured by WithBackoff, and the first answer is
+// returned. Servers only answer requesters they are configured to trust.
+func (c *Client) LeaseQuery(ctx context.Context, server net.IP, q LeaseQuery) (*LeaseInfo, error) {
+	p, err := c.leaseQueryPacket(q)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := c.exchange(ctx, &net.UDPAddr{IP: server, Port: ServerPort}, p, func(p *dhcp4.Packet) bool {
+		switch p.Options.MessageType() {
+		case dhcp4.DHCPLeaseActive, dhcp4.DHCPLeaseUnassigned, dhcp4.DHCPLeaseUnknown:
+			return true
+		}
+		return false
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	info := &LeaseInfo{
+		Status:          reply.Options.MessageType(),
+		IP:              reply.CIAddr,
+		ClientID:        reply.Options.ClientIdentifier(),
+		LeaseTime:       reply.Options.LeaseTime(),
+		LastTransaction: reply.Options.ClientLastTransactionTime(),
+		AssociatedIPs:   reply.Options.AssociatedIPs(),
+	}
+	if len(reply.CHAddr) > 0 {
+		info.HardwareAddr = reply.HardwareAddr()
+	}
+	if unspecified(info.IP) {
+		info.IP = q.IP
+	}
+	return info, nil
+}
+
+// leaseQueryPacket returns the DHCPLEASEQUERY for q, see RFC 4388, Section
+// 6.3.
+func (c *Client) leaseQueryPacket(q LeaseQuery) (*dhcp4.Packet, error) {
+	var n int
+	for _, set := range []bool{q.IP != nil, q.HardwareAddr != nil, q.ClientID != nil} {
+		if set {
+			n++
+		}
+	}
+	if n != 1 {
+		return nil, errors.New("lease query must give exactly one of IP, hardware address and client identifier")
+	}
+
+	// The client's own hardware address is not sent, but still picks the
+	// transaction ID.
+	p := dhcp4.NewPacket(dhcp4.BootRequest)
+	p.TransactionID = c.newXID()
+	p.Options.SetMessageType(dhcp4.DHCPLeaseQuery)
+	switch {
+	case q.IP != nil:
+		p.CIAddr = q.IP
+	case q.HardwareAddr != nil:
+		if err := p.SetHardwareAddr(q.HardwareAddr); err != nil {
+			return nil, err
+		}
+	default:
+		p.Options.SetClientIdentifier(q.ClientID)
+	}
+	return p, nil
+}
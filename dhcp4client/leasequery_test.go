@@ -0,0 +1,88 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+)
+
+func TestLeaseQuery(t *testing.T) {
+	ip := net.IP{192, 168, 1, 10}
+	mac := net.HardwareAddr{2, 0, 0, 0, 0, 1}
+
+	active := newReply(dhcp4.DHCPLeaseActive, nil)
+	active.CIAddr = ip
+	active.SetHardwareAddr(mac)
+	active.Options.SetServerIdentifier(serverA)
+	active.Options.SetLeaseTime(time.Hour)
+	active.Options.SetClientLastTransactionTime(time.Minute)
+
+	for _, tt := range []struct {
+		desc       string
+		query      LeaseQuery
+		responses  [][]*dhcp4.Packet
+		wantStatus dhcp4.MessageType
+		wantMAC    net.HardwareAddr
+		wantErr    bool
+	}{
+		{
+			desc:       "by IP",
+			query:      LeaseQuery{IP: ip},
+			responses:  [][]*dhcp4.Packet{{active}},
+			wantStatus: dhcp4.DHCPLeaseActive,
+			wantMAC:    mac,
+		},
+		{
+			desc:       "by hardware address, ACK ignored",
+			query:      LeaseQuery{HardwareAddr: mac},
+			responses:  [][]*dhcp4.Packet{{newReply(dhcp4.DHCPACK, ip), active}},
+			wantStatus: dhcp4.DHCPLeaseActive,
+			wantMAC:    mac,
+		},
+		{
+			desc:       "unassigned",
+			query:      LeaseQuery{IP: ip},
+			responses:  [][]*dhcp4.Packet{{newReply(dhcp4.DHCPLeaseUnassigned, nil)}},
+			wantStatus: dhcp4.DHCPLeaseUnassigned,
+		},
+		{
+			desc:    "several criteria",
+			query:   LeaseQuery{IP: ip, HardwareAddr: mac},
+			wantErr: true,
+		},
+		{
+			desc:    "no criteria",
+			wantErr: true,
+		},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			c, _ := serveClient(ctx, t, tt.responses)
+			defer c.Close()
+
+			info, err := c.LeaseQuery(ctx, serverA, tt.query)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LeaseQuery() = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if info.Status != tt.wantStatus || !info.IP.Equal(ip) || !bytes.Equal(info.HardwareAddr, tt.wantMAC) {
+				t.Errorf("LeaseQuery() = %+v, want %v of %v to %v", info, tt.wantStatus, ip, tt.wantMAC)
+			}
+			if tt.wantStatus == dhcp4.DHCPLeaseActive && (info.LeaseTime != time.Hour || info.LastTransaction != time.Minute) {
+				t.Errorf("LeaseQuery() lease time %v, last transaction %v, want 1h, 1m", info.LeaseTime, info.LastTransaction)
+			}
+		})
+	}
+}
@@ -0,0 +1,19 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !windows
+// +build !windows
+
+package dhcp4client
+
+import "github.com/vishvananda/netlink"
+
+// Link is a network interface a client runs on.
+type Link = netlink.Link
+
+// LinkAttrs are the attributes of a Link.
+type LinkAttrs = netlink.LinkAttrs
+
+// Device is a Link of no particular type.
+type Device = netlink.Device
@@ -0,0 +1,149 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/net/bpf"
+)
+
+// EnslavedError is returned for interfaces that are ports of a bond, bridge
+// or team. The kernel hands their traffic to the master, so a client on the
+// port never sees replies; leases must be acquired on the master instead.
+type EnslavedError struct {
+	// Link is the name of the port.
+	Link string
+
+	// Master is the name of the bond, bridge or team.
+	Master string
+}
+
+// Error implements error.
+func (ee *EnslavedError) Error() string {
+	return fmt.Sprintf("%s is a port of %s; acquire a lease on %s instead", ee.Link, ee.Master, ee.Master)
+}
+
+// LinkByName returns the interface named name, to be passed to New.
+func LinkByName(name string) (Link, error) {
+	return netlink.LinkByName(name)
+}
+
+// checkLink returns an EnslavedError if link is a port of another interface.
+// Interfaces enslaved to a VRF keep their own traffic and are fine.
+func checkLink(link Link) error {
+	attrs := link.Attrs()
+	if attrs.MasterIndex == 0 {
+		return nil
+	}
+	master := fmt.Sprintf("interface %d", attrs.MasterIndex)
+	if m, err := netlink.LinkByIndex(attrs.MasterIndex); err == nil {
+		if m.Type() == "vrf" {
+			return nil
+		}
+		master = m.Attrs().Name
+	}
+	return &EnslavedError{Link: attrs.Name, Master: master}
+}
+
+// inheritsHardwareAddr returns whether link takes its hardware address from
+// other interfaces.
+//
+// Bonds, bridges and teams use the address of one of their ports unless it
+// was set explicitly, so it changes as ports come and go. VLAN interfaces use
+// the address of their parent, which may be any of those.
+func inheritsHardwareAddr(link Link) bool {
+	switch link.Type() {
+	case "bond", "bridge", "team", "vlan":
+		return true
+	}
+	return false
+}
+
+// currentHardwareAddr returns the hardware address link has now, which may
+// differ from link.Attrs() if it is inherited.
+func currentHardwareAddr(link Link) net.HardwareAddr {
+	attrs := link.Attrs()
+	if attrs.Index != 0 && inheritsHardwareAddr(link) {
+		if l, err := netlink.LinkByIndex(attrs.Index); err == nil {
+			return l.Attrs().HardwareAddr
+		}
+	}
+	return attrs.HardwareAddr
+}
+
+// watchHardwareAddr sends the changes of the hardware address of link until
+// ctx is done.
+func watchHardwareAddr(ctx context.Context, link Link) (<-chan macChange, error) {
+	updates := make(chan netlink.LinkUpdate)
+	done := make(chan struct{})
+	if err := netlink.LinkSubscribe(updates, done); err != nil {
+		return nil, err
+	}
+	changes := make(chan macChange)
+	index := link.Attrs().Index
+	last := currentHardwareAddr(link)
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case u, ok := <-updates:
+				if !ok {
+					return
+				}
+				if u.Attrs().Index != index {
+					continue
+				}
+				hw := u.Attrs().HardwareAddr
+				if len(hw) == 0 || bytes.Equal(hw, last) {
+					continue
+				}
+				mc := macChange{old: last, new: hw}
+				last = hw
+				select {
+				case changes <- mc:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return changes, nil
+}
+
+// untagged returns a BPF program dropping VLAN-tagged packets and running
+// prog on all others.
+//
+// With VLAN offload, packet sockets on the parent of a VLAN interface also
+// see the traffic of the VLAN, with the tag kept out of band. The VLAN
+// interface uses the hardware address of its parent, so without this filter
+// a client on the parent would take the VLAN's replies for its own.
+func untagged(prog []bpf.Instruction) []bpf.Instruction {
+	return append([]bpf.Instruction{
+		bpf.LoadExtension{Num: bpf.ExtVLANTagPresent},
+		bpf.JumpIf{Cond: bpf.JumpEqual, Val: 0, SkipTrue: 1},
+		bpf.RetConstant{Val: 0},
+	}, prog...)
+}
+
+// currentIPv4Addr returns the first global IPv4 address of link.
+func currentIPv4Addr(link Link) (net.IP, error) {
+	addrs, err := netlink.AddrList(link, netlink.FAMILY_V4)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range addrs {
+		if a.IP.IsGlobalUnicast() {
+			return a.IP, nil
+		}
+	}
+	return nil, fmt.Errorf("%s has no IPv4 address", link.Attrs().Name)
+}
@@ -0,0 +1,219 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/net/bpf"
+)
+
+// addLink creates link, skipping the test if that is not possible.
+func addLink(t *testing.T, link netlink.Link) netlink.Link {
+	if os.Geteuid() != 0 {
+		t.Skip("needs root")
+	}
+	if err := netlink.LinkAdd(link); err != nil {
+		t.Skipf("cannot create %s %s: %v", link.Type(), link.Attrs().Name, err)
+	}
+	l, err := netlink.LinkByName(link.Attrs().Name)
+	if err != nil {
+		netlink.LinkDel(link)
+		t.Fatal(err)
+	}
+	return l
+}
+
+// addPort creates a veth pair and returns the end named name.
+func addPort(t *testing.T, name string) netlink.Link {
+	return addLink(t, &netlink.Veth{
+		LinkAttrs: netlink.LinkAttrs{Name: name},
+		PeerName:  name + "p",
+	})
+}
+
+func TestCheckLink(t *testing.T) {
+	if err := checkLink(&netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: "eth0"}}); err != nil {
+		t.Errorf("checkLink(eth0) = %v, want nil", err)
+	}
+
+	err := checkLink(&netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: "eth0", MasterIndex: 1 << 30}})
+	var ee *EnslavedError
+	if !errors.As(err, &ee) || ee.Link != "eth0" {
+		t.Errorf("checkLink(enslaved eth0) = %v, want EnslavedError for eth0", err)
+	}
+}
+
+func TestMasterLinks(t *testing.T) {
+	for _, master := range []netlink.Link{
+		&netlink.Bridge{LinkAttrs: netlink.LinkAttrs{Name: "dhcptest-br"}},
+		netlink.NewLinkBond(netlink.LinkAttrs{Name: "dhcptest-bond"}),
+	} {
+		t.Run(master.Type(), func(t *testing.T) {
+			m := addLink(t, master)
+			defer netlink.LinkDel(m)
+			port := addPort(t, "dhcptest-port")
+			defer netlink.LinkDel(port)
+
+			if err := netlink.LinkSetMasterByIndex(port, m.Attrs().Index); err != nil {
+				t.Fatalf("LinkSetMasterByIndex() = %v", err)
+			}
+			port, _ = netlink.LinkByIndex(port.Attrs().Index)
+			fresh, err := netlink.LinkByIndex(m.Attrs().Index)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var ee *EnslavedError
+			if _, err := New(port); !errors.As(err, &ee) || ee.Master != m.Attrs().Name {
+				t.Errorf("New(port) = %v, want EnslavedError naming %s", err, m.Attrs().Name)
+			}
+
+			// m was looked up before the port was added, which
+			// may have changed the address.
+			c, err := New(m)
+			if err != nil {
+				t.Fatalf("New(%s) = %v", m.Attrs().Name, err)
+			}
+			defer c.Close()
+			if got, want := c.hardwareAddr(), fresh.Attrs().HardwareAddr; got.String() != want.String() {
+				t.Errorf("hardwareAddr() = %v, want current address %v", got, want)
+			}
+		})
+	}
+}
+
+func TestVLANLink(t *testing.T) {
+	parent := addPort(t, "dhcptest-vp")
+	defer netlink.LinkDel(parent)
+	vlan := addLink(t, &netlink.Vlan{
+		LinkAttrs: netlink.LinkAttrs{Name: "dhcptest-vp.5", ParentIndex: parent.Attrs().Index},
+		VlanId:    5,
+	})
+	defer netlink.LinkDel(vlan)
+
+	c, err := New(vlan)
+	if err != nil {
+		t.Fatalf("New(vlan) = %v", err)
+	}
+	defer c.Close()
+	if got, want := c.hardwareAddr(), parent.Attrs().HardwareAddr; got.String() != want.String() {
+		t.Errorf("hardwareAddr() = %v, want parent's %v", got, want)
+	}
+}
+
+func TestUntagged(t *testing.T) {
+	prog := untagged(udpFilter(ClientPort))
+	if _, err := bpf.Assemble(prog); err != nil {
+		t.Fatalf("Assemble() = %v", err)
+	}
+	if ext, ok := prog[0].(bpf.LoadExtension); !ok || ext.Num != bpf.ExtVLANTagPresent {
+		t.Errorf("filter starts with %v, want VLAN tag check", prog[0])
+	}
+}
+
+// waitUp waits for links to come up.
+func waitUp(t *testing.T, links ...netlink.Link) {
+	for _, l := range links {
+		if err := netlink.LinkSetUp(l); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for _, l := range links {
+		for {
+			l, err := netlink.LinkByIndex(l.Attrs().Index)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if l.Attrs().OperState == netlink.OperUp {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("%s did not come up", l.Attrs().Name)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+func TestWithInterface(t *testing.T) {
+	for _, tt := range []struct {
+		desc string
+		// links returns the link of the client and another link, and
+		// the peers of both receiving what is sent on them. They are
+		// deleted when the test ends.
+		links func(t *testing.T) (link, other, peer, otherPeer netlink.Link)
+	}{
+		{
+			desc: "veth",
+			links: func(t *testing.T) (link, other, peer, otherPeer netlink.Link) {
+				link = addPort(t, "dhcptest-ia")
+				t.Cleanup(func() { netlink.LinkDel(link) })
+				other = addPort(t, "dhcptest-ib")
+				t.Cleanup(func() { netlink.LinkDel(other) })
+				peer, _ = netlink.LinkByName("dhcptest-iap")
+				otherPeer, _ = netlink.LinkByName("dhcptest-ibp")
+				return link, other, peer, otherPeer
+			},
+		},
+		{
+			desc: "VLAN",
+			links: func(t *testing.T) (link, other, peer, otherPeer netlink.Link) {
+				other = addPort(t, "dhcptest-iv")
+				t.Cleanup(func() { netlink.LinkDel(other) })
+				otherPeer, _ = netlink.LinkByName("dhcptest-ivp")
+				link = addLink(t, &netlink.Vlan{
+					LinkAttrs: netlink.LinkAttrs{Name: "dhcptest-iv.5", ParentIndex: other.Attrs().Index},
+					VlanId:    5,
+				})
+				peer = addLink(t, &netlink.Vlan{
+					LinkAttrs: netlink.LinkAttrs{Name: "dhcptest-ivp.5", ParentIndex: otherPeer.Attrs().Index},
+					VlanId:    5,
+				})
+				return link, other, peer, otherPeer
+			},
+		},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			link, other, peer, otherPeer := tt.links(t)
+			waitUp(t, link, other, peer, otherPeer)
+
+			c, err := New(nil, WithInterface(link.Attrs().Name))
+			if err != nil {
+				t.Fatalf("New(WithInterface) = %v", err)
+			}
+			defer c.Close()
+
+			// Only the broadcast on the client's link reaches it.
+			bcast := &net.UDPAddr{IP: net.IPv4bcast, Port: ClientPort}
+			for _, l := range []netlink.Link{otherPeer, peer} {
+				conn, err := NewPacketUDPConn(l.Attrs().Name, ServerPort)
+				if err != nil {
+					t.Fatal(err)
+				}
+				_, err = conn.WriteTo([]byte(l.Attrs().Name), bcast)
+				conn.Close()
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			b := make([]byte, 100)
+			c.conn.SetReadDeadline(time.Now().Add(time.Second))
+			n, _, err := c.conn.ReadFrom(b)
+			if err != nil {
+				t.Fatalf("ReadFrom() = %v", err)
+			}
+			if got := string(b[:n]); got != peer.Attrs().Name {
+				t.Errorf("client received broadcast from %s, want only %s", got, peer.Attrs().Name)
+			}
+		})
+	}
+}
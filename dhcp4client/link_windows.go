@@ -0,0 +1,113 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// Link is a network interface a client runs on.
+//
+// It has the methods of netlink.Link, which does not build on Windows.
+type Link interface {
+	Attrs() *LinkAttrs
+	Type() string
+}
+
+// LinkAttrs are the attributes of a Link, those of netlink.LinkAttrs that
+// package net reports.
+type LinkAttrs struct {
+	Index        int
+	MTU          int
+	Name         string
+	HardwareAddr net.HardwareAddr
+	Flags        net.Flags
+}
+
+// Device is a Link of no particular type.
+type Device struct {
+	LinkAttrs
+}
+
+// Attrs implements Link.Attrs.
+func (d *Device) Attrs() *LinkAttrs {
+	return &d.LinkAttrs
+}
+
+// Type implements Link.Type.
+func (d *Device) Type() string {
+	return "device"
+}
+
+// LinkByName returns the interface named name, to be passed to New.
+func LinkByName(name string) (Link, error) {
+	ifc, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, err
+	}
+	return &Device{
+		LinkAttrs: LinkAttrs{
+			Name:         ifc.Name,
+			Index:        ifc.Index,
+			HardwareAddr: ifc.HardwareAddr,
+			MTU:          ifc.MTU,
+			Flags:        ifc.Flags,
+		},
+	}, nil
+}
+
+// newLinkClient returns a client on the interface named iface, which must
+// be up: without netlink it cannot be brought up.
+func newLinkClient(iface string, opts ...ClientOpt) (*Client, error) {
+	link, err := LinkByName(iface)
+	if err != nil {
+		return nil, err
+	}
+	if link.Attrs().Flags&net.FlagUp == 0 {
+		return nil, fmt.Errorf("%s is down", iface)
+	}
+	return New(link, opts...)
+}
+
+// checkLink accepts any link: ports of bridges cannot be told apart
+// without netlink.
+func checkLink(link Link) error {
+	return nil
+}
+
+// currentHardwareAddr returns the hardware address link has now.
+func currentHardwareAddr(link Link) net.HardwareAddr {
+	if ifc, err := net.InterfaceByName(link.Attrs().Name); err == nil {
+		return ifc.HardwareAddr
+	}
+	return link.Attrs().HardwareAddr
+}
+
+// watchHardwareAddr fails: changes of the hardware address are only
+// reported by netlink.
+func watchHardwareAddr(ctx context.Context, link Link) (<-chan macChange, error) {
+	return nil, errors.New("watching hardware addresses needs netlink")
+}
+
+// currentIPv4Addr returns the first global IPv4 address of link.
+func currentIPv4Addr(link Link) (net.IP, error) {
+	ifc, err := net.InterfaceByName(link.Attrs().Name)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := ifc.Addrs()
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range addrs {
+		if n, ok := a.(*net.IPNet); ok && n.IP.To4() != nil && n.IP.IsGlobalUnicast() {
+			return n.IP.To4(), nil
+		}
+	}
+	return nil, fmt.Errorf("%s has no IPv4 address", link.Attrs().Name)
+}
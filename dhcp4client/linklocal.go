@@ -0,0 +1,94 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"net"
+
+	"github.com/mergetb/dhcp4"
+)
+
+// maxLinkLocalConflicts is how many link-local addresses in use RequestLease
+// tries before giving up, the MAX_CONFLICTS of RFC 3927 Section 9.
+const maxLinkLocalConflicts = 10
+
+// linkLocalMask is the mask of the IPv4 link-local network 169.254.0.0/16.
+var linkLocalMask = net.CIDRMask(16, 32)
+
+// WithLinkLocalFallback makes RequestLease choose an IPv4 link-local address as
+// described by RFC 3927 if no server answers within the configured
+// retransmissions. Candidate addresses are checked with p, and the first
+// one not in use is returned as a lease with LinkLocal set.
+//
+// The address is derived from the client's hardware address, so the same
+// client picks the same address every time unless it is in use. Announcing
+// the address once configured is left to the caller.
+//
+// Default is no fallback.
+func WithLinkLocalFallback(p AddressProber) ClientOpt {
+	return func(c *Client) error {
+		c.linkLocal = p
+		return nil
+	}
+}
+
+// LinkLocalConflictError is returned by RequestLease if every link-local
+// address it tried was in use.
+type LinkLocalConflictError struct {
+	// Tried is the number of addresses tried.
+	Tried int
+}
+
+// Error implements error.
+func (le *LinkLocalConflictError) Error() string {
+	return fmt.Sprintf("no DHCP server answered, and all %d link-local addresses tried are in use", le.Tried)
+}
+
+// noAnswer returns whether err means no server answered.
+func noAnswer(err error) bool {
+	ce, ok := err.(*ClientError)
+	return ok && ce.Stats != nil
+}
+
+// linkLocalLease probes link-local addresses until it finds one not in use,
+// and returns a lease of it.
+func (c *Client) linkLocalLease(ctx context.Context) (*Lease, error) {
+	h := fnv.New64a()
+	h.Write(c.Identity().HardwareAddr)
+	rnd := rand.New(rand.NewSource(int64(h.Sum64())))
+
+	for i := 0; i < maxLinkLocalConflicts; i++ {
+		ip := linkLocalAddr(rnd)
+		hw, err := c.linkLocal.Probe(ctx, ip)
+		if err != nil {
+			return nil, fmt.Errorf("probe %v: %v", ip, err)
+		}
+		if hw != nil {
+			continue
+		}
+		opts := make(dhcp4.Options)
+		opts.SetSubnetMask(linkLocalMask)
+		return &Lease{
+			IP:        ip,
+			Options:   opts,
+			LinkLocal: true,
+		}, nil
+	}
+	return nil, &LinkLocalConflictError{Tried: maxLinkLocalConflicts}
+}
+
+// linkLocalAddr returns a pseudo-random address of 169.254.1.0 to
+// 169.254.254.255, the range RFC 3927 Section 2.1 allows hosts to choose
+// from.
+func linkLocalAddr(rnd *rand.Rand) net.IP {
+	ip := make(net.IP, 4)
+	binary.BigEndian.PutUint32(ip, 0xa9fe0100+uint32(rnd.Intn(0xfe00)))
+	return ip
+}
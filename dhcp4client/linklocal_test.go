@@ -0,0 +1,135 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+)
+
+// busyProber finds the first busy addresses it probes in use.
+type busyProber struct {
+	busy   int
+	probed []net.IP
+}
+
+func (bp *busyProber) Probe(ctx context.Context, ip net.IP) (net.HardwareAddr, error) {
+	bp.probed = append(bp.probed, ip)
+	if len(bp.probed) <= bp.busy {
+		return net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0, 1}, nil
+	}
+	return nil, nil
+}
+
+func TestLinkLocalFallback(t *testing.T) {
+	ip := net.IP{192, 168, 1, 10}
+	linkLocal := &net.IPNet{IP: net.IP{169, 254, 0, 0}, Mask: linkLocalMask}
+
+	for _, tt := range []struct {
+		desc      string
+		responses [][]*dhcp4.Packet
+		busy      int
+
+		want      net.IP
+		linkLocal bool
+		wantErr   bool
+		probes    int
+	}{
+		{
+			desc:      "no server",
+			responses: [][]*dhcp4.Packet{{}},
+			linkLocal: true,
+			probes:    1,
+		},
+		{
+			desc:      "first addresses in use",
+			responses: [][]*dhcp4.Packet{{}},
+			busy:      2,
+			linkLocal: true,
+			probes:    3,
+		},
+		{
+			desc:      "all addresses in use",
+			responses: [][]*dhcp4.Packet{{}},
+			busy:      maxLinkLocalConflicts,
+			wantErr:   true,
+			probes:    maxLinkLocalConflicts,
+		},
+		{
+			desc: "server answers",
+			responses: [][]*dhcp4.Packet{
+				{newLeaseReply(dhcp4.DHCPOffer, serverA, ip, time.Hour)},
+				{newLeaseReply(dhcp4.DHCPACK, serverA, ip, time.Hour)},
+			},
+			want: ip,
+		},
+		{
+			desc: "server refuses",
+			responses: [][]*dhcp4.Packet{
+				{newLeaseReply(dhcp4.DHCPOffer, serverA, ip, time.Hour)},
+				{newLeaseReply(dhcp4.DHCPNAK, serverA, nil, 0)},
+			},
+			wantErr: true,
+		},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			p := &busyProber{busy: tt.busy}
+			c, _ := serveClient(ctx, t, tt.responses, WithTimeout(50*time.Millisecond), WithLinkLocalFallback(p))
+			defer c.Close()
+
+			lease, err := c.RequestLease(ctx)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Request() = %v, want error", lease)
+				}
+			} else if err != nil {
+				t.Fatalf("Request() = %v", err)
+			} else if lease.LinkLocal != tt.linkLocal {
+				t.Errorf("Request() = %v, want link-local %v", lease, tt.linkLocal)
+			} else if tt.linkLocal {
+				if !linkLocal.Contains(lease.IP) || lease.IP[2] == 0 || lease.IP[2] == 255 {
+					t.Errorf("Request() = %v, want an address of 169.254.1.0 to 169.254.254.255", lease)
+				}
+				if !lease.IP.Equal(p.probed[len(p.probed)-1]) {
+					t.Errorf("Request() = %v, want the last address probed, %v", lease, p.probed[len(p.probed)-1])
+				}
+			} else if !lease.IP.Equal(tt.want) {
+				t.Errorf("Request() = %v, want %v", lease, tt.want)
+			}
+			if len(p.probed) != tt.probes {
+				t.Errorf("probed %v, want %d probes", p.probed, tt.probes)
+			}
+			if ce, ok := err.(*LinkLocalConflictError); tt.busy >= maxLinkLocalConflicts && (!ok || ce.Tried != maxLinkLocalConflicts) {
+				t.Errorf("Request() = %v, want *LinkLocalConflictError", err)
+			}
+		})
+	}
+}
+
+func TestLinkLocalAddrStable(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var addrs []net.IP
+	for i := 0; i < 2; i++ {
+		c, _ := serveClient(ctx, t, nil, WithLinkLocalFallback(&busyProber{}))
+		lease, err := c.linkLocalLease(ctx)
+		c.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		addrs = append(addrs, lease.IP)
+	}
+	if !addrs[0].Equal(addrs[1]) {
+		t.Errorf("link-local addresses %v, want the same address every time", addrs)
+	}
+}
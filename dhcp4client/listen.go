@@ -0,0 +1,48 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"context"
+	"net"
+
+	"github.com/mergetb/dhcp4"
+)
+
+// Listen reads the client's connection until ctx is done or reading fails,
+// and calls fn with every DHCP packet filter accepts and the address it came
+// from. A nil filter accepts all packets.
+//
+// Packets are read along with the replies to concurrent exchanges, which
+// still get them, whether or not they answer one, e.g. to monitor a network
+// passively or to build relay agents and other tools on the connection the
+// client owns. Malformed packets are skipped.
+//
+// fn is called synchronously and must not modify the packet, which
+// exchanges share; a slow fn delays them. Listen returns ctx.Err() once ctx
+// is done, or the error reading failed with.
+func (c *Client) Listen(ctx context.Context, filter func(*dhcp4.Packet) bool, fn func(*dhcp4.Packet, net.Addr)) error {
+	pe := c.registerMonitor()
+	defer c.unregister(pe)
+	for {
+		var dg datagram
+		select {
+		case dg = <-pe.in:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if dg.err == errRecovered {
+			continue
+		} else if dg.err != nil {
+			return dg.err
+		}
+		if dg.decodeErr != nil {
+			continue
+		}
+		if filter == nil || filter(dg.pkt) {
+			fn(dg.pkt, dg.source)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+)
+
+func TestListen(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ip := net.IP{192, 168, 1, 10}
+	c, _ := serveClient(ctx, t, [][]*dhcp4.Packet{
+		{newLeaseReply(dhcp4.DHCPOffer, serverA, ip, time.Hour)},
+		{newLeaseReply(dhcp4.DHCPACK, serverA, ip, time.Hour)},
+		{},
+	})
+	defer c.Close()
+
+	listenCtx, stop := context.WithCancel(ctx)
+	seen := make(chan *dhcp4.Packet, 10)
+	done := make(chan error)
+	go func() {
+		done <- c.Listen(listenCtx, func(p *dhcp4.Packet) bool {
+			return p.Options.MessageType() == dhcp4.DHCPOffer
+		}, func(p *dhcp4.Packet, source net.Addr) {
+			seen <- p
+		})
+	}()
+	// Wait for Listen to be reading, so that it sees the offer.
+	for {
+		c.demux.mu.Lock()
+		n := len(c.demux.pending)
+		c.demux.mu.Unlock()
+		if n > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// Exchanges still get the packets Listen sees.
+	if lease, err := c.RequestLease(ctx); err != nil || !lease.IP.Equal(ip) {
+		t.Fatalf("Request() = %v, %v; want a lease of %v", lease, err, ip)
+	}
+
+	stop()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Listen() = %v, want %v", err, context.Canceled)
+	}
+	close(seen)
+	var got []dhcp4.MessageType
+	for p := range seen {
+		got = append(got, p.Options.MessageType())
+	}
+	if len(got) != 1 || got[0] != dhcp4.DHCPOffer {
+		t.Errorf("Listen() saw %v, want the offer only", got)
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+)
+
+// PacketEventKind is the kind of a PacketEvent.
+type PacketEventKind uint8
+
+// Packet events sent to a Logger.
+const (
+	// PacketSent means that a packet was sent for the first time.
+	PacketSent PacketEventKind = iota
+
+	// PacketRetransmitted means that a packet was sent again because no
+	// response arrived in time.
+	PacketRetransmitted
+
+	// PacketReceived means that a response to a sent packet was received.
+	PacketReceived
+
+	// PacketDiscarded means that a received packet was not a response to
+	// the packet sent, or not one the client was waiting for.
+	PacketDiscarded
+
+	// PacketTimedOut means that no response arrived before the timeout of
+	// a transmission.
+	PacketTimedOut
+)
+
+// String implements fmt.Stringer.
+func (k PacketEventKind) String() string {
+	switch k {
+	case PacketSent:
+		return "sent"
+	case PacketRetransmitted:
+		return "retransmitted"
+	case PacketReceived:
+		return "received"
+	case PacketDiscarded:
+		return "discarded"
+	case PacketTimedOut:
+		return "timed out"
+	}
+	return fmt.Sprintf("unknown (%d)", uint8(k))
+}
+
+// PacketEvent reports packet I/O of a client.
+type PacketEvent struct {
+	Kind PacketEventKind
+
+	// Time is when the event happened.
+	Time time.Time
+
+	// Packet is the packet sent or received, or the packet whose
+	// transmission timed out. It is nil for malformed packets.
+	Packet *dhcp4.Packet
+
+	// Addr is the destination of sent packets and the source of received
+	// packets.
+	Addr net.Addr
+
+	// Attempt is the number of the transmission, starting at 1, and
+	// Timeout how long the client waits for responses to it.
+	Attempt int
+	Timeout time.Duration
+
+	// Reason is why a packet was discarded, and Err why it was malformed.
+	Reason RejectReason
+	Err    error
+}
+
+// String implements fmt.Stringer. It returns a one-line summary of the
+// event and the decoded packet.
+func (e PacketEvent) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%v", e.Kind)
+	if e.Packet != nil {
+		fmt.Fprintf(&b, " %s", summarize(e.Packet))
+	}
+	switch e.Kind {
+	case PacketSent, PacketRetransmitted:
+		fmt.Fprintf(&b, " to %v (attempt %d", e.Addr, e.Attempt)
+		if e.Timeout > 0 {
+			fmt.Fprintf(&b, ", waiting %v", e.Timeout)
+		}
+		b.WriteString(")")
+	case PacketReceived:
+		fmt.Fprintf(&b, " from %v", e.Addr)
+	case PacketDiscarded:
+		fmt.Fprintf(&b, " from %v: %s", e.Addr, e.Reason)
+		if e.Err != nil {
+			fmt.Fprintf(&b, ": %v", e.Err)
+		}
+	case PacketTimedOut:
+		fmt.Fprintf(&b, " after %v (attempt %d)", e.Timeout, e.Attempt)
+	}
+	return b.String()
+}
+
+// summarize returns the message type and the fields of p that tell
+// exchanges apart.
+func summarize(p *dhcp4.Packet) string {
+	s := fmt.Sprintf("%v xid %x chaddr %v", p.Options.MessageType(), p.TransactionID, p.CHAddr)
+	if !unspecified(p.CIAddr) {
+		s += fmt.Sprintf(" ciaddr %v", p.CIAddr)
+	}
+	if !unspecified(p.YIAddr) {
+		s += fmt.Sprintf(" yiaddr %v", p.YIAddr)
+	}
+	if ip := p.Options.RequestedIPAddress(); ip != nil {
+		s += fmt.Sprintf(" requested %v", ip)
+	}
+	if sid := p.Options.ServerIdentifier(); sid != nil {
+		s += fmt.Sprintf(" server %v", sid)
+	}
+	return s
+}
+
+func unspecified(ip net.IP) bool {
+	return ip == nil || ip.IsUnspecified()
+}
+
+// Logger receives the packet I/O of a client, to debug why a client did not
+// get a lease.
+type Logger interface {
+	// LogPacket is called for every event. It must not block, and may be
+	// called concurrently.
+	LogPacket(e PacketEvent)
+}
+
+// LoggerFunc is a function implementing Logger.
+type LoggerFunc func(e PacketEvent)
+
+// LogPacket implements Logger.
+func (f LoggerFunc) LogPacket(e PacketEvent) {
+	f(e)
+}
+
+// StdLogger returns a Logger printing every event to l.
+func StdLogger(l *log.Logger) Logger {
+	return LoggerFunc(func(e PacketEvent) {
+		l.Printf("DHCP %v", e)
+	})
+}
+
+// WithLogger configures a Logger receiving every packet the client sends,
+// receives and discards, retransmissions and timeouts.
+func WithLogger(l Logger) ClientOpt {
+	return func(c *Client) error {
+		c.logger = l
+		return nil
+	}
+}
+
+// reportPacket counts e in the client's Metrics and sends it to the
+// client's Logger, if any.
+func (c *Client) reportPacket(e PacketEvent) {
+	if e.Packet != nil {
+		typ := e.Packet.Options.MessageType()
+		switch e.Kind {
+		case PacketSent:
+			c.metrics.MessageSent(typ)
+		case PacketRetransmitted:
+			c.metrics.MessageSent(typ)
+			c.metrics.Retransmission(typ)
+		case PacketReceived:
+			c.metrics.MessageReceived(typ)
+		}
+	}
+	if c.logger == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	c.logger.LogPacket(e)
+}
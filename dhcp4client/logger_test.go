@@ -0,0 +1,153 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+)
+
+// eventLog is a Logger recording events.
+type eventLog struct {
+	mu     sync.Mutex
+	events []PacketEvent
+}
+
+func (l *eventLog) LogPacket(e PacketEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, e)
+}
+
+// summary returns the kind and message type or discard reason of every
+// event.
+func (l *eventLog) summary() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var s []string
+	for _, e := range l.events {
+		switch {
+		case e.Kind == PacketDiscarded:
+			s = append(s, e.Kind.String()+" "+string(e.Reason))
+		case e.Packet != nil:
+			s = append(s, e.Kind.String()+" "+e.Packet.Options.MessageType().String())
+		default:
+			s = append(s, e.Kind.String())
+		}
+	}
+	return s
+}
+
+func TestLogger(t *testing.T) {
+	ip := net.IP{192, 168, 1, 10}
+	wrongXID := newLeaseReply(dhcp4.DHCPOffer, serverA, ip, time.Hour)
+	wrongXID.TransactionID = [4]byte{1, 2, 3, 4}
+
+	for _, tt := range []struct {
+		desc      string
+		responses [][]*dhcp4.Packet
+		want      []string
+		wantErr   bool
+	}{
+		{
+			desc: "lease",
+			responses: [][]*dhcp4.Packet{
+				{wrongXID, newLeaseReply(dhcp4.DHCPOffer, serverA, ip, time.Hour)},
+				{newLeaseReply(dhcp4.DHCPACK, serverA, ip, time.Hour)},
+				// Keep the connection open.
+				{},
+			},
+			want: []string{
+				"sent DHCPDISCOVER",
+				"discarded transaction ID mismatch",
+				"received DHCPOFFER",
+				"sent DHCPREQUEST",
+				"received DHCPACK",
+			},
+		},
+		{
+			desc: "other server",
+			responses: [][]*dhcp4.Packet{
+				{newLeaseReply(dhcp4.DHCPOffer, serverA, ip, time.Hour)},
+				{newLeaseReply(dhcp4.DHCPACK, serverB, ip, time.Hour)},
+				{},
+			},
+			want: []string{
+				"sent DHCPDISCOVER",
+				"received DHCPOFFER",
+				"sent DHCPREQUEST",
+				"received DHCPACK",
+				"discarded unwanted",
+			},
+			wantErr: true,
+		},
+		{
+			desc: "retransmission",
+			responses: [][]*dhcp4.Packet{
+				{},
+				{newLeaseReply(dhcp4.DHCPOffer, serverA, ip, time.Hour)},
+				{newLeaseReply(dhcp4.DHCPACK, serverA, ip, time.Hour)},
+				{},
+			},
+			want: []string{
+				"sent DHCPDISCOVER",
+				"timed out DHCPDISCOVER",
+				"retransmitted DHCPDISCOVER",
+				"received DHCPOFFER",
+				"sent DHCPREQUEST",
+				"received DHCPACK",
+			},
+		},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			l := &eventLog{}
+			c, _ := serveClient(ctx, t, tt.responses, WithLogger(l), WithRetry(2), WithTimeout(200*time.Millisecond))
+			if _, err := c.RequestLease(ctx); (err != nil) != tt.wantErr {
+				t.Fatalf("Request = %v, want error: %t", err, tt.wantErr)
+			}
+			if got := l.summary(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("events =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestPacketEventString(t *testing.T) {
+	p := newLeaseReply(dhcp4.DHCPOffer, serverA, net.IP{192, 168, 1, 10}, time.Hour)
+	p.TransactionID = [4]byte{1, 2, 3, 4}
+	p.CHAddr = net.HardwareAddr{2, 0, 0, 0, 0, 1}
+	from := &net.UDPAddr{IP: serverA, Port: ServerPort}
+	for _, tt := range []struct {
+		e    PacketEvent
+		want string
+	}{
+		{
+			e:    PacketEvent{Kind: PacketRetransmitted, Packet: p, Addr: DefaultServers, Attempt: 2, Timeout: 8 * time.Second},
+			want: "retransmitted DHCPOFFER xid 01020304 chaddr 02:00:00:00:00:01 yiaddr 192.168.1.10 server " + serverA.String() + " to 255.255.255.255:67 (attempt 2, waiting 8s)",
+		},
+		{
+			e:    PacketEvent{Kind: PacketDiscarded, Addr: from, Reason: RejectMalformed, Err: dhcp4.ErrInvalidPacket},
+			want: "discarded from " + from.String() + ": malformed: not enough bytes for valid packet",
+		},
+		{
+			e:    PacketEvent{Kind: PacketTimedOut, Packet: p, Attempt: 1, Timeout: 4 * time.Second},
+			want: "timed out DHCPOFFER xid 01020304 chaddr 02:00:00:00:00:01 yiaddr 192.168.1.10 server " + serverA.String() + " after 4s (attempt 1)",
+		},
+	} {
+		if got := tt.e.String(); got != tt.want {
+			t.Errorf("String() =\n%s\nwant\n%s", got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"context"
+	"fmt"
+	"net"
+)
+
+// MACChangePolicy is what Maintain does when the hardware address of the
+// client's interface changes during a lease, e.g. when a bond fails over to
+// another port or an administrator changes it.
+//
+// Without a policy, renewals keep the old address in chaddr, which the
+// server may no longer accept from the new one, or send the new one, which
+// the server does not know the lease by.
+type MACChangePolicy int
+
+const (
+	// MACIgnore does not watch the hardware address.
+	MACIgnore MACChangePolicy = iota
+
+	// MACReacquire releases the lease under the old hardware address and
+	// requests a new one under the new address.
+	MACReacquire
+
+	// MACKeepLease keeps the lease, and keeps the client recognizable by
+	// sending a client identifier (option 61) derived from the old
+	// hardware address if none is configured. Servers binding leases to
+	// client identifiers keep renewing the lease.
+	MACKeepLease
+
+	// MACAlert only reports the change; the caller decides what to do.
+	MACAlert
+)
+
+// String implements fmt.Stringer.
+func (p MACChangePolicy) String() string {
+	switch p {
+	case MACIgnore:
+		return "ignore"
+	case MACReacquire:
+		return "reacquire"
+	case MACKeepLease:
+		return "keep lease"
+	case MACAlert:
+		return "alert"
+	}
+	return fmt.Sprintf("unknown (%d)", int(p))
+}
+
+// WithMACChangePolicy makes Maintain watch the hardware address of the
+// client's interface via netlink and handle changes according to p. Each
+// change is sent as a LeaseHardwareAddrChanged event, or a LeaseLost event
+// if reacquiring failed.
+//
+// Clients with a hardware address configured by WithIdentity do not use
+// the interface's and are not affected.
+//
+// Default is MACIgnore.
+func WithMACChangePolicy(p MACChangePolicy) ClientOpt {
+	return func(c *Client) error {
+		if p < MACIgnore || p > MACAlert {
+			return fmt.Errorf("unknown MAC change policy %d", int(p))
+		}
+		c.macPolicy = p
+		return nil
+	}
+}
+
+// macChange is a change of the interface's hardware address.
+type macChange struct {
+	old, new net.HardwareAddr
+}
+
+// watchMACChanges returns the changes of the interface's hardware address
+// until ctx is done, or nil if they are not to be watched.
+func (c *Client) watchMACChanges(ctx context.Context) <-chan macChange {
+	c.idMu.Lock()
+	explicit := c.id.HardwareAddr != nil
+	c.idMu.Unlock()
+	if c.macPolicy == MACIgnore || c.watchMACs == nil || explicit {
+		return nil
+	}
+	macs, err := c.watchMACs(ctx)
+	if err != nil {
+		// Maintain keeps the lease without watching.
+		return nil
+	}
+	return macs
+}
+
+// macChanged handles mc for lease according to the policy.
+func (c *Client) macChanged(ctx context.Context, mc macChange, lease *Lease) LeaseEvent {
+	ev := LeaseEvent{Kind: LeaseHardwareAddrChanged, Lease: lease, HardwareAddr: mc.new}
+	switch c.macPolicy {
+	case MACKeepLease:
+		c.idMu.Lock()
+		if len(c.id.ClientID) == 0 {
+			c.id.ClientID = append([]byte{1}, mc.old...)
+		}
+		c.idMu.Unlock()
+
+	case MACReacquire:
+		old := c.Identity()
+		old.HardwareAddr = mc.old
+		// The address may be gone from the link already; the server
+		// will expire the lease if the release is lost.
+		c.release(ctx, lease, old)
+		renewed, err := c.RequestLease(ctx)
+		if err != nil {
+			return LeaseEvent{Kind: LeaseLost, Lease: lease, Err: err}
+		}
+		ev.Lease = renewed
+	}
+	return ev
+}
@@ -0,0 +1,109 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+)
+
+func TestMACChange(t *testing.T) {
+	ip := net.IP{192, 168, 1, 10}
+	newIP := net.IP{192, 168, 1, 11}
+	oldMAC := net.HardwareAddr{0x02, 0, 0, 0, 0, 1}
+	newMAC := net.HardwareAddr{0x02, 0, 0, 0, 0, 2}
+	for _, tt := range []struct {
+		policy    MACChangePolicy
+		responses [][]*dhcp4.Packet
+		want      LeaseEventKind
+		wantIP    net.IP
+		wantID    []byte
+	}{
+		{
+			policy: MACAlert,
+			want:   LeaseHardwareAddrChanged,
+			wantIP: ip,
+		},
+		{
+			policy: MACKeepLease,
+			want:   LeaseHardwareAddrChanged,
+			wantIP: ip,
+			wantID: append([]byte{1}, oldMAC...),
+		},
+		{
+			policy: MACReacquire,
+			responses: [][]*dhcp4.Packet{
+				{},
+				{newLeaseReply(dhcp4.DHCPOffer, serverA, newIP, time.Hour)},
+				{newLeaseReply(dhcp4.DHCPACK, serverA, newIP, time.Hour)},
+			},
+			want:   LeaseHardwareAddrChanged,
+			wantIP: newIP,
+		},
+		{
+			policy: MACReacquire,
+			responses: [][]*dhcp4.Packet{
+				{},
+				{},
+			},
+			want:   LeaseLost,
+			wantIP: ip,
+		},
+	} {
+		t.Run(tt.policy.String(), func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			c, s := serveClient(ctx, t, tt.responses, WithMACChangePolicy(tt.policy), WithTimeout(50*time.Millisecond))
+			defer c.Close()
+			changes := make(chan macChange, 1)
+			c.watchMACs = func(context.Context) (<-chan macChange, error) {
+				return changes, nil
+			}
+
+			lease := &Lease{IP: ip, ServerID: serverA, Start: time.Now(), Duration: time.Hour, RenewalTime: 30 * time.Minute, RebindingTime: 45 * time.Minute}
+			events := c.Maintain(ctx, lease)
+			changes <- macChange{old: oldMAC, new: newMAC}
+			ev, ok := <-events
+			if !ok {
+				t.Fatalf("Maintain() sent no event")
+			}
+			if ev.Kind != tt.want {
+				t.Fatalf("Maintain() sent %v event (%v), want %v", ev.Kind, ev.Err, tt.want)
+			}
+			if ev.Kind == LeaseHardwareAddrChanged && !bytes.Equal(ev.HardwareAddr, newMAC) {
+				t.Errorf("event hardware address %v, want %v", ev.HardwareAddr, newMAC)
+			}
+			if !ev.Lease.IP.Equal(tt.wantIP) {
+				t.Errorf("event lease %v, want %v", ev.Lease, tt.wantIP)
+			}
+			if id := c.Identity().ClientID; !bytes.Equal(id, tt.wantID) {
+				t.Errorf("client identifier %x, want %x", id, tt.wantID)
+			}
+
+			if tt.policy != MACReacquire {
+				return
+			}
+			if len(s.packets()) == 0 {
+				t.Fatalf("client sent nothing, want a release")
+			}
+			release := s.packets()[0]
+			if typ := release.Options.MessageType(); typ != dhcp4.DHCPRelease || !bytes.Equal(release.CHAddr, oldMAC) {
+				t.Errorf("client sent %v for %v, want DHCPRELEASE for %v", typ, release.CHAddr, oldMAC)
+			}
+		})
+	}
+}
+
+func TestWithMACChangePolicy(t *testing.T) {
+	if _, err := New(nil, WithConn(newMockUDPConn(nil, nil)), WithMACChangePolicy(MACAlert+1)); err == nil {
+		t.Errorf("New(WithMACChangePolicy(%d)) = nil, want error", MACAlert+1)
+	}
+}
@@ -0,0 +1,328 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+)
+
+// LeaseEventKind is the kind of a LeaseEvent.
+type LeaseEventKind uint8
+
+// Lease events sent by Maintain.
+const (
+	// LeaseRenewed means that the lease was renewed with the server that
+	// granted it.
+	LeaseRenewed LeaseEventKind = iota
+
+	// LeaseRebound means that the lease was extended by any server after
+	// renewing it failed until T2.
+	LeaseRebound
+
+	// LeaseLost means that a server answered with a NAK. The lease must
+	// not be used anymore.
+	LeaseLost
+
+	// LeaseExpired means that the lease expired before it could be
+	// renewed or rebound. The lease must not be used anymore.
+	LeaseExpired
+
+	// LeaseRotated means that the lease was released and replaced by a new
+	// lease for the identity passed to RotateIdentity.
+	LeaseRotated
+
+	// LeaseHardwareAddrChanged means that the hardware address of the
+	// interface changed, and the lease was handled according to the
+	// MACChangePolicy.
+	LeaseHardwareAddrChanged
+
+	// LeaseReacquired means that a server answered with a NAK and a new
+	// lease was acquired, see WithNAKRestart.
+	LeaseReacquired
+)
+
+// String implements fmt.Stringer.
+func (k LeaseEventKind) String() string {
+	switch k {
+	case LeaseRenewed:
+		return "renewed"
+	case LeaseRebound:
+		return "rebound"
+	case LeaseLost:
+		return "lost"
+	case LeaseExpired:
+		return "expired"
+	case LeaseRotated:
+		return "rotated"
+	case LeaseHardwareAddrChanged:
+		return "hardware address changed"
+	case LeaseReacquired:
+		return "reacquired"
+	}
+	return fmt.Sprintf("unknown (%d)", uint8(k))
+}
+
+// LeaseEvent reports a change of a lease maintained by Maintain.
+type LeaseEvent struct {
+	Kind LeaseEventKind
+
+	// Lease is the renewed, rebound, rotated or reacquired lease, or the
+	// lease that was lost or expired.
+	Lease *Lease
+
+	// Err is the *NAKError of a lost or reacquired lease, or why acquiring
+	// a lease under a rotated identity or new hardware address or after a
+	// NAK failed.
+	Err error
+
+	// HardwareAddr is the new hardware address of the interface for
+	// LeaseHardwareAddrChanged events.
+	HardwareAddr net.HardwareAddr
+}
+
+// minRenewRetry is the minimum time between retransmissions of a renewal,
+// as recommended by RFC 2131 Section 4.4.5.
+const minRenewRetry = 60 * time.Second
+
+// Rebind extends lease with any server, as described by RFC 2131 Section
+// 4.4.5 for clients whose server did not answer renewals until T2, and
+// returns the extended lease.
+//
+// If a server answers with a NAK, Rebind returns a *NAKError and the lease
+// must not be used anymore.
+func (c *Client) Rebind(ctx context.Context, lease *Lease) (*Lease, error) {
+	rebind, err := c.renewPacket(lease)
+	if err != nil {
+		return nil, err
+	}
+	return c.requestLease(ctx, DefaultServers, rebind, lease.IP)
+}
+
+// Maintain keeps lease alive in the background until ctx is canceled.
+//
+// Maintain renews the lease with its server at T1, retrying until T2, and
+// from T2 on rebinds it with any server until it expires. Retransmissions
+// are spaced by half the time remaining until T2 or expiry, but at least a
+// minute, as RFC 2131 Section 4.4.5 recommends.
+//
+// Every change of the lease is sent on the returned channel, which must be
+// drained. The channel is closed when ctx is canceled or after the lease was
+// lost or expired. Leases that never expire are not renewed.
+//
+// Maintain also carries out RotateIdentity for the lease, handles changes
+// of the interface's hardware address as configured with
+// WithMACChangePolicy, renews the lease when its server sends a
+// DHCPFORCERENEW if configured with WithForceRenew, acquires a new lease
+// when the lease is NAKed if configured with WithNAKRestart, and releases
+// the lease when ctx is canceled if configured with WithReleaseOnStop.
+func (c *Client) Maintain(ctx context.Context, lease *Lease) <-chan LeaseEvent {
+	events := make(chan LeaseEvent)
+	// Registered before returning, so that RotateIdentity covers the lease
+	// right away.
+	mt := c.startMaintainer()
+	mt.macs = c.watchMACChanges(ctx)
+	go func() {
+		defer close(events)
+		defer c.stopMaintainer(mt)
+		m := c.state.maintain()
+		defer c.state.endMaintain(m)
+		for {
+			ev, ok := c.maintainOnce(ctx, m, mt, lease)
+			if !ok {
+				c.releaseStopped(lease)
+				return
+			}
+			ended := ev.Kind == LeaseLost || ev.Kind == LeaseExpired
+			if !ended {
+				lease = ev.Lease
+			}
+			select {
+			case events <- ev:
+			case <-ctx.Done():
+				if !ended {
+					c.releaseStopped(lease)
+				}
+				return
+			}
+			if ended {
+				return
+			}
+		}
+	}()
+	return events
+}
+
+// WithReleaseOnStop configures whether Maintain releases its lease when its
+// context is canceled, e.g. when the client shuts down, so that the server
+// can hand out the address again right away.
+//
+// Default is false: the address stays bound to the client until the lease
+// expires, and the client can request it again after a restart.
+func WithReleaseOnStop(release bool) ClientOpt {
+	return func(c *Client) error {
+		c.releaseOnStop = release
+		return nil
+	}
+}
+
+// releaseStopped releases lease when Maintain stops, if configured.
+func (c *Client) releaseStopped(lease *Lease) {
+	if !c.releaseOnStop {
+		return
+	}
+	// The context of Maintain is canceled already, and releases are not
+	// answered anyway.
+	c.Release(context.Background(), lease)
+}
+
+// maintainOnce waits for the next change of lease and returns it, or false
+// if ctx was canceled first. It records its progress in m and carries out
+// the rotations sent to mt.
+func (c *Client) maintainOnce(ctx context.Context, m *MaintainState, mt *maintainer, lease *Lease) (LeaseEvent, bool) {
+	t1 := lease.Start.Add(lease.RenewalTime)
+	t2 := lease.Start.Add(lease.RebindingTime)
+	expiry := lease.Expiry()
+	next := t1
+	c.state.update(m, func(m *MaintainState) {
+		*m = MaintainState{
+			IP:       lease.IP.String(),
+			ServerID: lease.ServerID.String(),
+			Phase:    PhaseBound,
+		}
+		if lease.Duration != 0 {
+			m.T1, m.T2, m.Expiry, m.Next = t1, t2, expiry, next
+		}
+	})
+	if lease.Duration == 0 {
+		// Wait for rotations and hardware address changes only.
+		next = time.Time{}
+	}
+
+	var renewing bool
+	for {
+		// FORCERENEW messages are only obeyed while bound (RFC 3203,
+		// Section 4).
+		var forced <-chan struct{}
+		stop := func() {}
+		if c.forceRenew && !renewing {
+			forced, stop = c.listenForceRenew(ctx, lease)
+		}
+		r, mc, force, ok := waitUntil(ctx, mt, next, forced)
+		stop()
+		if !ok {
+			return LeaseEvent{}, false
+		}
+		if r != nil {
+			if ev, ok := c.rotate(ctx, r, lease); ok {
+				return ev, true
+			}
+			continue
+		}
+		if mc != nil {
+			return c.macChanged(ctx, *mc, lease), true
+		}
+
+		now := time.Now()
+		var (
+			kind     LeaseEventKind
+			deadline time.Time
+			renewed  *Lease
+			err      error
+		)
+		// Renewal began at T1, even if it is retried, or when the
+		// server forced it.
+		start := t1
+		if force {
+			start = now
+		}
+		rctx := withStart(ctx, start)
+		renewing = true
+		switch {
+		case force || now.Before(t2):
+			kind, deadline = LeaseRenewed, t2
+			c.state.update(m, func(m *MaintainState) { m.Phase, m.Next = PhaseRenewing, time.Time{} })
+			renewed, err = c.RenewLease(rctx, lease)
+		case now.Before(expiry):
+			kind, deadline = LeaseRebound, expiry
+			c.state.update(m, func(m *MaintainState) { m.Phase, m.Next = PhaseRebinding, time.Time{} })
+			renewed, err = c.Rebind(rctx, lease)
+		default:
+			return LeaseEvent{Kind: LeaseExpired, Lease: lease}, true
+		}
+
+		if _, ok := err.(*NAKError); ok && c.nakRestarts > 0 {
+			return c.reacquire(ctx, m, lease, err), true
+		} else if ok {
+			return LeaseEvent{Kind: LeaseLost, Lease: lease, Err: err}, true
+		} else if err == nil {
+			return LeaseEvent{Kind: kind, Lease: renewed}, true
+		} else if ctx.Err() != nil {
+			return LeaseEvent{}, false
+		}
+
+		if lease.Duration == 0 {
+			// A forced renewal of a lease that never expires
+			// failed; keep the lease as it is.
+			next, renewing = time.Time{}, false
+			c.state.update(m, func(m *MaintainState) { m.Phase = PhaseBound })
+			continue
+		}
+		next = now.Add(c.retryWait(now, deadline))
+		if next.After(deadline) {
+			next = deadline
+		}
+		c.state.update(m, func(m *MaintainState) { m.Next = next })
+	}
+}
+
+// reacquire goes back to INIT after lease was NAKed with nak and acquires a
+// new lease.
+func (c *Client) reacquire(ctx context.Context, m *MaintainState, lease *Lease, nak error) LeaseEvent {
+	// The NAKed lease must not be used anymore.
+	c.state.update(m, func(m *MaintainState) { *m = MaintainState{Phase: PhaseInit} })
+	renewed, err := c.RequestLease(ctx)
+	if err != nil {
+		return LeaseEvent{Kind: LeaseLost, Lease: lease, Err: err}
+	}
+	return LeaseEvent{Kind: LeaseReacquired, Lease: renewed, Err: nak}
+}
+
+// retryWait returns how long to wait at now before retransmitting a renewal
+// or rebinding that has to succeed by deadline.
+func (c *Client) retryWait(now, deadline time.Time) time.Duration {
+	d := deadline.Sub(now) / 2
+	if d < c.renewRetry {
+		d = c.renewRetry
+	}
+	return d
+}
+
+// waitUntil waits until t, or forever if t is zero, and returns true. If a
+// rotation or hardware address change is sent to mt first, it returns it,
+// and if forced is closed first, it returns force. It returns false if ctx
+// is canceled first.
+func waitUntil(ctx context.Context, mt *maintainer, t time.Time, forced <-chan struct{}) (r *rotation, mc *macChange, force, ok bool) {
+	var expired <-chan time.Time
+	if !t.IsZero() {
+		timer := time.NewTimer(time.Until(t))
+		defer timer.Stop()
+		expired = timer.C
+	}
+	select {
+	case <-expired:
+		return nil, nil, false, true
+	case r := <-mt.rotations:
+		return r, nil, false, true
+	case mc := <-mt.macs:
+		return nil, &mc, false, true
+	case <-forced:
+		return nil, nil, true, true
+	case <-ctx.Done():
+		return nil, nil, false, false
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+)
+
+// shortLease returns a lease of ip from serverA started now, with T1 after
+// 100ms, T2 after 300ms and expiring after 500ms.
+func shortLease(ip net.IP) *Lease {
+	return &Lease{
+		IP:            ip,
+		ServerID:      serverA,
+		Start:         time.Now(),
+		Duration:      500 * time.Millisecond,
+		RenewalTime:   100 * time.Millisecond,
+		RebindingTime: 300 * time.Millisecond,
+	}
+}
+
+func TestMaintain(t *testing.T) {
+	ip := net.IP{192, 168, 1, 10}
+	for _, tt := range []struct {
+		desc      string
+		responses [][]*dhcp4.Packet
+		want      LeaseEventKind
+		dests     []net.IP
+	}{
+		{
+			desc: "renewed",
+			responses: [][]*dhcp4.Packet{
+				{newLeaseReply(dhcp4.DHCPACK, serverA, ip, time.Hour)},
+			},
+			want:  LeaseRenewed,
+			dests: []net.IP{serverA},
+		},
+		{
+			desc: "rebound",
+			responses: [][]*dhcp4.Packet{
+				{},
+				{newLeaseReply(dhcp4.DHCPACK, serverB, ip, time.Hour)},
+			},
+			want:  LeaseRebound,
+			dests: []net.IP{serverA, net.IPv4bcast},
+		},
+		{
+			desc: "lost",
+			responses: [][]*dhcp4.Packet{
+				{newLeaseReply(dhcp4.DHCPNAK, serverA, nil, 0)},
+			},
+			want:  LeaseLost,
+			dests: []net.IP{serverA},
+		},
+		{
+			desc: "expired",
+			responses: [][]*dhcp4.Packet{
+				{},
+				{},
+			},
+			want:  LeaseExpired,
+			dests: []net.IP{serverA, net.IPv4bcast},
+		},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			c, s := serveClient(ctx, t, tt.responses, WithTimeout(50*time.Millisecond))
+			defer c.Close()
+			c.renewRetry = 250 * time.Millisecond
+
+			ev, ok := <-c.Maintain(ctx, shortLease(ip))
+			if !ok {
+				t.Fatalf("Maintain() sent no event")
+			}
+			if ev.Kind != tt.want {
+				t.Errorf("Maintain() sent %v event, want %v", ev.Kind, tt.want)
+			}
+			if (ev.Kind == LeaseLost) != (ev.Err != nil) {
+				t.Errorf("Maintain() sent %v event with error %v", ev.Kind, ev.Err)
+			}
+			if ev.Kind == LeaseRenewed || ev.Kind == LeaseRebound {
+				if ev.Lease.Duration != time.Hour {
+					t.Errorf("Maintain() sent lease %v, want 1h", ev.Lease)
+				}
+			}
+
+			if len(s.destinations()) != len(tt.dests) {
+				t.Fatalf("client sent %d requests, want %d", len(s.destinations()), len(tt.dests))
+			}
+			for i, dest := range s.destinations() {
+				if !dest.IP.Equal(tt.dests[i]) {
+					t.Errorf("request %d sent to %v, want %v", i, dest.IP, tt.dests[i])
+				}
+			}
+		})
+	}
+}
+
+func TestMaintainReleaseOnStop(t *testing.T) {
+	ip := net.IP{192, 168, 1, 10}
+	for _, release := range []bool{false, true} {
+		in := make(chan udpPacket, 1)
+		out := make(chan udpPacket, 1)
+		c, err := New(nil, WithConn(newMockUDPConn(in, out)), WithReleaseOnStop(release))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		lease := &Lease{IP: ip, ServerID: serverA, Start: time.Now(), Duration: time.Hour, RenewalTime: 30 * time.Minute, RebindingTime: 45 * time.Minute}
+		events := c.Maintain(ctx, lease)
+		cancel()
+		if _, ok := <-events; ok {
+			t.Errorf("Maintain() sent an event, want none")
+		}
+
+		select {
+		case sent := <-out:
+			if !release {
+				t.Errorf("release sent without WithReleaseOnStop")
+				break
+			}
+			p, err := dhcp4.ParsePacket(sent.payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if typ := p.Options.MessageType(); typ != dhcp4.DHCPRelease || !p.CIAddr.Equal(ip) || p.Broadcast || !sent.dest.IP.Equal(serverA) {
+				t.Errorf("sent %v of %v to %v, broadcast %t; want unicast DHCPRELEASE of %v to %v", typ, p.CIAddr, sent.dest.IP, p.Broadcast, ip, serverA)
+			}
+		default:
+			if release {
+				t.Errorf("no release sent with WithReleaseOnStop")
+			}
+		}
+		c.Close()
+	}
+}
@@ -0,0 +1,325 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ManagedState is the state of a lease managed by a LeaseManager.
+type ManagedState uint8
+
+// States of managed leases.
+const (
+	// ManagedAcquiring means that the client is requesting a lease.
+	ManagedAcquiring ManagedState = iota
+
+	// ManagedBound means that the lease is being maintained.
+	ManagedBound
+
+	// ManagedRestarting means that acquiring a lease failed and the
+	// manager waits before trying again.
+	ManagedRestarting
+
+	// ManagedFailed means that the lease was lost, expired or could not be
+	// acquired, and the restart policy gave up on it.
+	ManagedFailed
+
+	// ManagedStopped means that the lease was removed or the manager shut
+	// down.
+	ManagedStopped
+)
+
+// String implements fmt.Stringer.
+func (s ManagedState) String() string {
+	switch s {
+	case ManagedAcquiring:
+		return "acquiring"
+	case ManagedBound:
+		return "bound"
+	case ManagedRestarting:
+		return "restarting"
+	case ManagedFailed:
+		return "failed"
+	case ManagedStopped:
+		return "stopped"
+	}
+	return fmt.Sprintf("unknown (%d)", uint8(s))
+}
+
+// LeaseStatus describes a lease managed by a LeaseManager.
+type LeaseStatus struct {
+	// Name is the name the lease was added under.
+	Name string
+
+	State ManagedState
+
+	// Since is when the lease entered State.
+	Since time.Time
+
+	// Lease is the current lease, or the last one if the lease is not
+	// bound.
+	Lease *Lease
+
+	// Restarts is the number of times acquisition restarted after a lease
+	// was lost or expired.
+	Restarts int
+
+	// Err is why the last lease was lost or the last acquisition failed.
+	Err error
+}
+
+// ErrManagerShutdown is returned by LeaseManager.Add after Shutdown.
+var ErrManagerShutdown = errors.New("lease manager is shut down")
+
+// LeaseManager maintains many leases, e.g. of the interfaces of a host or of
+// a farm of virtual clients, under one context: Shutdown stops all of them
+// at once, Status reports on each, and a restart policy reacquires leases
+// that were lost.
+type LeaseManager struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	restart Backoff
+	onEvent func(name string, ev LeaseEvent)
+
+	// mu protects leases and shutdown.
+	mu       sync.Mutex
+	leases   map[string]*managedLease
+	shutdown bool
+}
+
+// managedLease is a lease maintained by a LeaseManager.
+type managedLease struct {
+	client *Client
+	cancel context.CancelFunc
+	done   chan struct{}
+	status LeaseStatus
+}
+
+// ManagerOpt is a function that configures the LeaseManager.
+type ManagerOpt func(*LeaseManager)
+
+// WithRestart makes the manager acquire a new lease when one is lost or
+// expires, or when acquiring it fails. Failed acquisitions are retried after
+// the timeouts of b, attempt 0 being the first retry; when b gives up, the
+// lease is failed.
+//
+// Default is no restarts: leases that are lost, expire or cannot be acquired
+// are failed.
+func WithRestart(b Backoff) ManagerOpt {
+	return func(m *LeaseManager) {
+		m.restart = b
+	}
+}
+
+// WithEventHandler configures a callback receiving the events of every
+// managed lease, see Maintain. It is called from the goroutine maintaining
+// the lease and must not block.
+func WithEventHandler(f func(name string, ev LeaseEvent)) ManagerOpt {
+	return func(m *LeaseManager) {
+		m.onEvent = f
+	}
+}
+
+// NewLeaseManager returns a LeaseManager whose leases are maintained until
+// ctx is canceled or Shutdown is called.
+func NewLeaseManager(ctx context.Context, opts ...ManagerOpt) *LeaseManager {
+	ctx, cancel := context.WithCancel(ctx)
+	m := &LeaseManager{
+		ctx:    ctx,
+		cancel: cancel,
+		leases: make(map[string]*managedLease),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Add maintains lease with c under name. If lease is nil, c requests one
+// first.
+//
+// Clients configured WithReleaseOnStop release their lease when it is
+// removed or the manager shuts down.
+func (m *LeaseManager) Add(name string, c *Client, lease *Lease) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.shutdown {
+		return ErrManagerShutdown
+	}
+	if _, ok := m.leases[name]; ok {
+		return fmt.Errorf("lease %q is managed already", name)
+	}
+	ctx, cancel := context.WithCancel(m.ctx)
+	ml := &managedLease{
+		client: c,
+		cancel: cancel,
+		done:   make(chan struct{}),
+		status: LeaseStatus{Name: name, Since: time.Now(), Lease: lease},
+	}
+	m.leases[name] = ml
+	m.wg.Add(1)
+	go m.run(ctx, name, ml, lease)
+	return nil
+}
+
+// Remove stops maintaining the lease added under name and waits until it
+// stopped.
+func (m *LeaseManager) Remove(name string) error {
+	m.mu.Lock()
+	ml, ok := m.leases[name]
+	if ok {
+		delete(m.leases, name)
+	}
+	m.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("no lease %q", name)
+	}
+	ml.cancel()
+	<-ml.done
+	return nil
+}
+
+// Status returns the status of the lease added under name.
+func (m *LeaseManager) Status(name string) (LeaseStatus, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ml, ok := m.leases[name]
+	if !ok {
+		return LeaseStatus{}, false
+	}
+	return ml.status, true
+}
+
+// Statuses returns the status of every lease, sorted by name.
+func (m *LeaseManager) Statuses() []LeaseStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := make([]LeaseStatus, 0, len(m.leases))
+	for _, ml := range m.leases {
+		s = append(s, ml.status)
+	}
+	sort.Slice(s, func(i, j int) bool { return s[i].Name < s[j].Name })
+	return s
+}
+
+// Shutdown stops maintaining all leases and waits until they stopped or ctx
+// is done. Leases cannot be added afterwards.
+func (m *LeaseManager) Shutdown(ctx context.Context) error {
+	m.mu.Lock()
+	m.shutdown = true
+	m.mu.Unlock()
+	m.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// update sets the state of ml, and the lease and error unless nil.
+func (m *LeaseManager) update(ml *managedLease, state ManagedState, lease *Lease, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if ml.status.State != state {
+		ml.status.State = state
+		ml.status.Since = time.Now()
+	}
+	if lease != nil {
+		ml.status.Lease = lease
+	}
+	if err != nil {
+		ml.status.Err = err
+	}
+}
+
+// run maintains the lease of ml until ctx is canceled or the restart policy
+// gives up on it.
+func (m *LeaseManager) run(ctx context.Context, name string, ml *managedLease, lease *Lease) {
+	defer m.wg.Done()
+	defer close(ml.done)
+
+	for failures := 0; ; {
+		if lease == nil {
+			m.update(ml, ManagedAcquiring, nil, nil)
+			var err error
+			lease, err = ml.client.RequestLease(ctx)
+			if ctx.Err() != nil {
+				m.update(ml, ManagedStopped, nil, nil)
+				return
+			}
+			if err != nil {
+				wait, ok := m.restartAfter(failures)
+				failures++
+				if !ok {
+					m.update(ml, ManagedFailed, nil, err)
+					return
+				}
+				m.update(ml, ManagedRestarting, nil, err)
+				if !sleep(ctx, wait) {
+					m.update(ml, ManagedStopped, nil, nil)
+					return
+				}
+				continue
+			}
+			failures = 0
+		}
+
+		m.update(ml, ManagedBound, lease, nil)
+		var ended LeaseEvent
+		for ev := range ml.client.Maintain(ctx, lease) {
+			if m.onEvent != nil {
+				m.onEvent(name, ev)
+			}
+			if ev.Kind == LeaseLost || ev.Kind == LeaseExpired {
+				ended = ev
+				continue
+			}
+			lease = ev.Lease
+			m.update(ml, ManagedBound, lease, nil)
+		}
+		if ctx.Err() != nil {
+			m.update(ml, ManagedStopped, nil, nil)
+			return
+		}
+
+		err := ended.Err
+		if err == nil {
+			err = fmt.Errorf("lease %v %v", ended.Lease, ended.Kind)
+		}
+		if m.restart == nil {
+			m.update(ml, ManagedFailed, nil, err)
+			return
+		}
+		m.update(ml, ManagedAcquiring, nil, err)
+		m.mu.Lock()
+		ml.status.Restarts++
+		m.mu.Unlock()
+		lease = nil
+	}
+}
+
+// restartAfter returns how long to wait before retrying after failures
+// failed acquisitions, or false to give up.
+func (m *LeaseManager) restartAfter(failures int) (time.Duration, bool) {
+	if m.restart == nil {
+		return 0, false
+	}
+	return m.restart.Timeout(failures)
+}
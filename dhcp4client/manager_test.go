@@ -0,0 +1,224 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+)
+
+// waitStatus waits until the lease name of m is in state, and returns its
+// status.
+func waitStatus(t *testing.T, m *LeaseManager, name string, state ManagedState) LeaseStatus {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		s, ok := m.Status(name)
+		if ok && s.State == state {
+			return s
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Status(%q) = %+v, %v, want state %v", name, s, ok, state)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestLeaseManager(t *testing.T) {
+	ip := net.IP{192, 168, 1, 10}
+	ip2 := net.IP{192, 168, 1, 11}
+	restart := WithRestart(FixedBackoff{Wait: 10 * time.Millisecond, Attempts: 1})
+
+	for _, tt := range []struct {
+		desc      string
+		responses [][]*dhcp4.Packet
+		lease     *Lease
+		opts      []ManagerOpt
+
+		want     ManagedState
+		wantIP   net.IP
+		restarts int
+		events   []LeaseEventKind
+	}{
+		{
+			desc: "acquired",
+			responses: [][]*dhcp4.Packet{
+				{newLeaseReply(dhcp4.DHCPOffer, serverA, ip, time.Hour)},
+				{newLeaseReply(dhcp4.DHCPACK, serverA, ip, time.Hour)},
+			},
+			want:   ManagedBound,
+			wantIP: ip,
+		},
+		{
+			desc: "renewed",
+			responses: [][]*dhcp4.Packet{
+				{newLeaseReply(dhcp4.DHCPACK, serverA, ip, time.Hour)},
+			},
+			lease:  shortLease(ip),
+			want:   ManagedBound,
+			wantIP: ip,
+			events: []LeaseEventKind{LeaseRenewed},
+		},
+		{
+			desc: "lost",
+			responses: [][]*dhcp4.Packet{
+				{newLeaseReply(dhcp4.DHCPNAK, serverA, nil, 0)},
+			},
+			lease:  shortLease(ip),
+			want:   ManagedFailed,
+			wantIP: ip,
+			events: []LeaseEventKind{LeaseLost},
+		},
+		{
+			desc: "lost and restarted",
+			responses: [][]*dhcp4.Packet{
+				{newLeaseReply(dhcp4.DHCPNAK, serverA, nil, 0)},
+				{newLeaseReply(dhcp4.DHCPOffer, serverA, ip2, time.Hour)},
+				{newLeaseReply(dhcp4.DHCPACK, serverA, ip2, time.Hour)},
+			},
+			lease:    shortLease(ip),
+			opts:     []ManagerOpt{restart},
+			want:     ManagedBound,
+			wantIP:   ip2,
+			restarts: 1,
+			events:   []LeaseEventKind{LeaseLost},
+		},
+		{
+			desc:      "no server",
+			responses: [][]*dhcp4.Packet{{}},
+			want:      ManagedFailed,
+		},
+		{
+			desc: "no server at first",
+			responses: [][]*dhcp4.Packet{
+				{},
+				{newLeaseReply(dhcp4.DHCPOffer, serverA, ip, time.Hour)},
+				{newLeaseReply(dhcp4.DHCPACK, serverA, ip, time.Hour)},
+			},
+			opts:   []ManagerOpt{restart},
+			want:   ManagedBound,
+			wantIP: ip,
+		},
+		{
+			desc:      "restarts exhausted",
+			responses: [][]*dhcp4.Packet{{}, {}},
+			opts:      []ManagerOpt{restart},
+			want:      ManagedFailed,
+		},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			c, _ := serveClient(ctx, t, tt.responses, WithTimeout(50*time.Millisecond))
+			defer c.Close()
+			c.renewRetry = 250 * time.Millisecond
+
+			var mu sync.Mutex
+			var events []LeaseEventKind
+			opts := append([]ManagerOpt{WithEventHandler(func(name string, ev LeaseEvent) {
+				mu.Lock()
+				defer mu.Unlock()
+				events = append(events, ev.Kind)
+			})}, tt.opts...)
+			m := NewLeaseManager(ctx, opts...)
+			if err := m.Add("eth0", c, tt.lease); err != nil {
+				t.Fatalf("Add() = %v", err)
+			}
+
+			s := waitStatus(t, m, "eth0", tt.want)
+			if tt.want == ManagedBound && len(tt.events) > 0 {
+				// Wait for the lease to be maintained.
+				deadline := time.Now().Add(3 * time.Second)
+				for s.Lease == tt.lease && time.Now().Before(deadline) {
+					time.Sleep(10 * time.Millisecond)
+					s, _ = m.Status("eth0")
+				}
+			}
+			if tt.wantIP == nil {
+				if s.Lease != nil {
+					t.Errorf("Status() lease %v, want none", s.Lease)
+				}
+			} else if s.Lease == nil || !s.Lease.IP.Equal(tt.wantIP) {
+				t.Errorf("Status() lease %v, want %v", s.Lease, tt.wantIP)
+			}
+			if s.Restarts != tt.restarts {
+				t.Errorf("Status() restarts %d, want %d", s.Restarts, tt.restarts)
+			}
+			if tt.want == ManagedFailed && s.Err == nil {
+				t.Errorf("Status() of failed lease has no error")
+			}
+
+			if err := m.Shutdown(ctx); err != nil {
+				t.Fatalf("Shutdown() = %v", err)
+			}
+			if s, _ := m.Status("eth0"); s.State != ManagedStopped && s.State != ManagedFailed {
+				t.Errorf("Status() after Shutdown() = %v, want stopped", s.State)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if len(events) != len(tt.events) {
+				t.Fatalf("events %v, want %v", events, tt.events)
+			}
+			for i := range events {
+				if events[i] != tt.events[i] {
+					t.Errorf("events %v, want %v", events, tt.events)
+				}
+			}
+		})
+	}
+}
+
+func TestLeaseManagerAddRemove(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	m := NewLeaseManager(ctx)
+	var clients []*Client
+	for _, name := range []string{"eth1", "eth0"} {
+		c, _ := serveClient(ctx, t, nil)
+		defer c.Close()
+		clients = append(clients, c)
+		lease := &Lease{IP: net.IP{192, 168, 1, 10}, ServerID: serverA, Start: time.Now()}
+		if err := m.Add(name, c, lease); err != nil {
+			t.Fatalf("Add(%q) = %v", name, err)
+		}
+	}
+	if err := m.Add("eth0", clients[0], nil); err == nil {
+		t.Errorf("Add(eth0) again = nil, want error")
+	}
+	waitStatus(t, m, "eth0", ManagedBound)
+	waitStatus(t, m, "eth1", ManagedBound)
+
+	if got := m.Statuses(); len(got) != 2 || got[0].Name != "eth0" || got[1].Name != "eth1" {
+		t.Errorf("Statuses() = %+v, want eth0 and eth1", got)
+	}
+
+	if err := m.Remove("eth0"); err != nil {
+		t.Fatalf("Remove(eth0) = %v", err)
+	}
+	if _, ok := m.Status("eth0"); ok {
+		t.Errorf("Status(eth0) after Remove() found the lease")
+	}
+	if err := m.Remove("eth0"); err == nil {
+		t.Errorf("Remove(eth0) again = nil, want error")
+	}
+
+	if err := m.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown() = %v", err)
+	}
+	if s, _ := m.Status("eth1"); s.State != ManagedStopped {
+		t.Errorf("Status(eth1) after Shutdown() = %v, want %v", s.State, ManagedStopped)
+	}
+	if err := m.Add("eth2", clients[0], nil); err != ErrManagerShutdown {
+		t.Errorf("Add() after Shutdown() = %v, want %v", err, ErrManagerShutdown)
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"bytes"
+
+	"github.com/mergetb/dhcp4"
+)
+
+// ReplyMatch determines which fields of a reply must match the request for
+// the client to accept it.
+type ReplyMatch int
+
+const (
+	// MatchXID accepts replies with the transaction ID of the request.
+	MatchXID ReplyMatch = iota
+
+	// MatchCHAddr additionally requires the client hardware address of
+	// the request, so that clients that happen to pick the same
+	// transaction ID, e.g. many clients behind one relay agent, do not
+	// accept each other's replies.
+	MatchCHAddr
+
+	// MatchClientID additionally requires the client identifier (option
+	// 61) of the request, if it sent one. Servers must echo it (RFC 6842),
+	// but older servers do not, and their replies are rejected.
+	MatchClientID
+)
+
+// WithReplyMatch configures which fields of replies must match the request.
+//
+// Default is MatchXID.
+func WithReplyMatch(m ReplyMatch) ClientOpt {
+	return func(c *Client) error {
+		c.match = m
+		return nil
+	}
+}
+
+// matchReply returns why reply does not answer request under m, or "" if
+// it does.
+func matchReply(m ReplyMatch, request, reply *dhcp4.Packet) RejectReason {
+	if reply.TransactionID != request.TransactionID {
+		return RejectXID
+	}
+	if request.Options.MessageType() == dhcp4.DHCPLeaseQuery {
+		// Lease query replies identify the client queried, not the
+		// requester.
+		return ""
+	}
+	if m >= MatchCHAddr && !bytes.Equal(reply.HardwareAddr(), request.HardwareAddr()) {
+		return RejectCHAddr
+	}
+	if m >= MatchClientID {
+		if id := request.Options.ClientIdentifier(); id != nil && !bytes.Equal(reply.Options.ClientIdentifier(), id) {
+			return RejectClientID
+		}
+	}
+	return ""
+}
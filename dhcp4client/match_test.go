@@ -0,0 +1,87 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+)
+
+func TestMatchReply(t *testing.T) {
+	xid := [4]byte{1, 2, 3, 4}
+	mac := net.HardwareAddr{2, 0, 0, 0, 0, 1}
+	packet := func(xid [4]byte, mac net.HardwareAddr, clientID []byte) *dhcp4.Packet {
+		p := newPacket(dhcp4.BootRequest, xid)
+		p.CHAddr = mac
+		if clientID != nil {
+			p.Options.SetClientIdentifier(clientID)
+		}
+		return p
+	}
+	request := packet(xid, mac, []byte("id"))
+
+	for _, tt := range []struct {
+		desc  string
+		match ReplyMatch
+		reply *dhcp4.Packet
+		want  RejectReason
+	}{
+		{"xid", MatchXID, packet(xid, nil, nil), ""},
+		{"wrong xid", MatchXID, packet([4]byte{}, mac, []byte("id")), RejectXID},
+		{"chaddr", MatchCHAddr, packet(xid, mac, nil), ""},
+		{"wrong chaddr", MatchCHAddr, packet(xid, net.HardwareAddr{2, 0, 0, 0, 0, 2}, []byte("id")), RejectCHAddr},
+		{"wrong xid and chaddr", MatchCHAddr, packet([4]byte{}, nil, nil), RejectXID},
+		{"client ID", MatchClientID, packet(xid, mac, []byte("id")), ""},
+		{"wrong client ID", MatchClientID, packet(xid, mac, []byte("other")), RejectClientID},
+		{"no client ID", MatchClientID, packet(xid, mac, nil), RejectClientID},
+		{"wrong chaddr and client ID", MatchClientID, packet(xid, nil, nil), RejectCHAddr},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			if got := matchReply(tt.match, request, tt.reply); got != tt.want {
+				t.Errorf("matchReply = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// Without a client identifier in the request there is nothing to
+	// match.
+	if got := matchReply(MatchClientID, packet(xid, mac, nil), packet(xid, mac, []byte("id"))); got != "" {
+		t.Errorf("matchReply without client identifier = %q, want none", got)
+	}
+}
+
+func TestSimpleSendAndReadMatchCHAddr(t *testing.T) {
+	xid := [4]byte{0x33, 0x33, 0x33, 0x33}
+	pkt := newPacket(dhcp4.BootRequest, xid)
+	pkt.CHAddr = net.HardwareAddr{2, 0, 0, 0, 0, 1}
+
+	ours := newPacket(dhcp4.BootReply, xid)
+	ours.CHAddr = pkt.CHAddr
+	theirs := newPacket(dhcp4.BootReply, xid)
+	theirs.CHAddr = net.HardwareAddr{2, 0, 0, 0, 0, 2}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	mc, _ := serveAndClient(ctx, [][]*dhcp4.Packet{{theirs, ours}}, WithReplyMatch(MatchCHAddr))
+	defer mc.conn.Close()
+
+	var got []*dhcp4.Packet
+	wg, out, errCh := mc.SimpleSendAndRead(ctx, DefaultServers, pkt)
+	for p := range out {
+		got = append(got, p.Packet)
+	}
+	wg.Wait()
+	if err, ok := <-errCh; ok {
+		t.Errorf("SimpleSendAndRead = %v, want no error", err)
+	}
+	if err := pktsExpected(got, []*dhcp4.Packet{ours}); err != nil {
+		t.Error(err)
+	}
+}
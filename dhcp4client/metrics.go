@@ -0,0 +1,23 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"github.com/mergetb/dhcp4/dhcp4metrics"
+)
+
+// WithMetrics configures where the client reports the messages it sends
+// and receives, retransmissions, and the durations of the leases it
+// acquires, renews and rebinds. dhcp4metrics.Registry exposes them to
+// Prometheus. A nil m reports nothing.
+func WithMetrics(m dhcp4metrics.Metrics) ClientOpt {
+	return func(c *Client) error {
+		if m == nil {
+			m = dhcp4metrics.Discard
+		}
+		c.metrics = m
+		return nil
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+	"github.com/mergetb/dhcp4/dhcp4metrics"
+)
+
+// countingMetrics is a dhcp4metrics.Metrics recording measurements.
+type countingMetrics struct {
+	mu              sync.Mutex
+	sent, received  map[dhcp4.MessageType]int
+	retransmissions map[dhcp4.MessageType]int
+	leases          []time.Duration
+	timesToLease    []time.Duration
+}
+
+func newCountingMetrics() *countingMetrics {
+	return &countingMetrics{
+		sent:            make(map[dhcp4.MessageType]int),
+		received:        make(map[dhcp4.MessageType]int),
+		retransmissions: make(map[dhcp4.MessageType]int),
+	}
+}
+
+func (m *countingMetrics) MessageSent(typ dhcp4.MessageType) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent[typ]++
+}
+
+func (m *countingMetrics) MessageReceived(typ dhcp4.MessageType) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.received[typ]++
+}
+
+func (m *countingMetrics) Retransmission(typ dhcp4.MessageType) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.retransmissions[typ]++
+}
+
+func (m *countingMetrics) Lease(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.leases = append(m.leases, d)
+}
+
+func (m *countingMetrics) TimeToLease(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.timesToLease = append(m.timesToLease, d)
+}
+
+// Clients do not relay.
+func (m *countingMetrics) RelayForwarded(string, net.IP, dhcp4.OpCode)         {}
+func (m *countingMetrics) RelayDropped(string, net.IP, dhcp4metrics.RelayDrop) {}
+
+func TestMetrics(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ip := net.IP{192, 168, 1, 10}
+	m := newCountingMetrics()
+	c, _ := serveClient(ctx, t, [][]*dhcp4.Packet{
+		{},
+		{newLeaseReply(dhcp4.DHCPOffer, serverA, ip, time.Hour)},
+		{newLeaseReply(dhcp4.DHCPACK, serverA, ip, time.Hour)},
+		{},
+	}, WithMetrics(m), WithRetry(2), WithTimeout(200*time.Millisecond))
+	lease, err := c.RequestLease(ctx)
+	if err != nil {
+		t.Fatalf("Request() = %v", err)
+	}
+	if err := c.Release(ctx, lease); err != nil {
+		t.Fatalf("Release() = %v", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if want := map[dhcp4.MessageType]int{dhcp4.DHCPDiscover: 2, dhcp4.DHCPRequest: 1, dhcp4.DHCPRelease: 1}; !reflect.DeepEqual(m.sent, want) {
+		t.Errorf("sent %v, want %v", m.sent, want)
+	}
+	if want := map[dhcp4.MessageType]int{dhcp4.DHCPOffer: 1, dhcp4.DHCPACK: 1}; !reflect.DeepEqual(m.received, want) {
+		t.Errorf("received %v, want %v", m.received, want)
+	}
+	if want := map[dhcp4.MessageType]int{dhcp4.DHCPDiscover: 1}; !reflect.DeepEqual(m.retransmissions, want) {
+		t.Errorf("retransmissions %v, want %v", m.retransmissions, want)
+	}
+	if want := []time.Duration{time.Hour}; !reflect.DeepEqual(m.leases, want) {
+		t.Errorf("leases %v, want %v", m.leases, want)
+	}
+	// The first DISCOVER timed out.
+	if len(m.timesToLease) != 1 || m.timesToLease[0] != lease.TimeToLease || lease.TimeToLease < 200*time.Millisecond {
+		t.Errorf("times to lease %v, want the lease's %v of at least the 200ms timeout", m.timesToLease, lease.TimeToLease)
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"fmt"
+
+	"github.com/mergetb/dhcp4"
+)
+
+const (
+	// minMaxMessageSize is the smallest Maximum DHCP Message Size, which
+	// every client must accept, see RFC 2132, Section 9.10.
+	minMaxMessageSize = 576
+
+	// ipUDPLen is the length of the IPv4 and UDP headers of a DHCP
+	// message without IP options.
+	ipUDPLen = 20 + 8
+)
+
+// WithMaxMessageSize configures the Maximum DHCP Message Size (option 57)
+// the client advertises, which is the largest IP datagram carrying a DHCP
+// message it accepts. Servers overload or trim larger responses, so they
+// are not dropped on the wire. It is at least 576 bytes.
+//
+// Default is the MTU of the interface, or 1500 bytes if it is not known.
+func WithMaxMessageSize(n uint16) ClientOpt {
+	return func(c *Client) error {
+		if n < minMaxMessageSize {
+			return fmt.Errorf("maximum message size must be at least %d bytes, got %d", minMaxMessageSize, n)
+		}
+		c.maxSize = n
+		return nil
+	}
+}
+
+// linkMTU returns the MTU of link, or 0 if it is not known.
+func linkMTU(link Link) int {
+	if link == nil {
+		return 0
+	}
+	return link.Attrs().MTU
+}
+
+// defaultMaxMessageSize returns the Maximum DHCP Message Size of a client
+// on an interface with the MTU mtu.
+func defaultMaxMessageSize(mtu int) uint16 {
+	if mtu < minMaxMessageSize || mtu > 0xffff {
+		return maxMessageSize
+	}
+	return uint16(mtu)
+}
+
+// marshalOptions returns how the client encodes packets: overloaded to fit
+// into the interface's MTU, if it is known, and padded to the length BOOTP
+// servers expect in BOOTP mode.
+func (c *Client) marshalOptions() dhcp4.MarshalOptions {
+	var mo dhcp4.MarshalOptions
+	if c.mtu >= minMaxMessageSize {
+		mo.MaxSize = c.mtu - ipUDPLen
+	}
+	if c.bootp {
+		mo.Padding = dhcp4.PadBOOTP
+	}
+	return mo
+}
@@ -0,0 +1,102 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+)
+
+func TestMaxMessageSize(t *testing.T) {
+	for _, tt := range []struct {
+		desc    string
+		opts    []ClientOpt
+		want    uint16
+		wantErr bool
+	}{
+		{desc: "default", want: 1500},
+		{desc: "configured", opts: []ClientOpt{WithMaxMessageSize(9000)}, want: 9000},
+		{desc: "minimum", opts: []ClientOpt{WithMaxMessageSize(576)}, want: 576},
+		{desc: "too small", opts: []ClientOpt{WithMaxMessageSize(575)}, wantErr: true},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			c, err := New(nil, append([]ClientOpt{WithConn(newMockUDPConn(nil, nil))}, tt.opts...)...)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("New() = nil, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ip := net.IP{192, 168, 1, 10}
+			offer := newLeaseReply(dhcp4.DHCPOffer, serverA, ip, time.Hour)
+			must := mustPacket(t)
+			for _, p := range []*dhcp4.Packet{c.DiscoverPacket(), c.RequestPacket(offer), must(c.renewPacket(shortLease(ip))), must(c.informPacket(ip))} {
+				if got := p.Options.MaximumDHCPMessageSize(); got != tt.want {
+					t.Errorf("%v maximum message size %d, want %d", p.Options.MessageType(), got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestDefaultMaxMessageSize(t *testing.T) {
+	for _, tt := range []struct {
+		mtu  int
+		want uint16
+	}{
+		{mtu: 0, want: 1500},
+		{mtu: 68, want: 1500},
+		{mtu: 576, want: 576},
+		{mtu: 1400, want: 1400},
+		{mtu: 9000, want: 9000},
+		{mtu: 65536, want: 1500},
+	} {
+		if got := defaultMaxMessageSize(tt.mtu); got != tt.want {
+			t.Errorf("defaultMaxMessageSize(%d) = %d, want %d", tt.mtu, got, tt.want)
+		}
+	}
+}
+
+func TestMarshalToMTU(t *testing.T) {
+	link := &Device{LinkAttrs: LinkAttrs{Name: "dummy0", MTU: 576}}
+	in := make(chan udpPacket, 1)
+	out := make(chan udpPacket, 1)
+	c, err := New(link, WithConn(newMockUDPConn(in, out)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if c.maxSize != 576 {
+		t.Errorf("maximum message size %d, want the MTU 576", c.maxSize)
+	}
+
+	// A discover with a long host name and vendor class must be
+	// overloaded to fit.
+	p := c.DiscoverPacket()
+	p.Options.SetVendorClassIdentifier(string(bytes.Repeat([]byte{'v'}, 100)))
+	p.Options.SetHostName(string(bytes.Repeat([]byte{'h'}, 200)))
+	b, err := c.codec.Encode(p, c.marshalOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) > 576-ipUDPLen {
+		t.Errorf("encoded %d bytes, want at most %d", len(b), 576-ipUDPLen)
+	}
+	got, err := dhcp4.ParsePacket(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Options.VendorClassIdentifier()) != 100 || len(got.Options.HostName()) != 200 {
+		t.Errorf("options lost in overloading: %v", got.Options)
+	}
+}
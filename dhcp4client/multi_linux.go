@@ -0,0 +1,146 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// MultiClient acquires leases on several interfaces concurrently, e.g. to
+// get an address on whichever NIC of a PXE node is cabled.
+//
+// Every interface gets its own Client with its own raw packet socket.
+type MultiClient struct {
+	ifaces []string
+	opts   []ClientOpt
+
+	// newClient returns the client for an interface.
+	newClient func(iface string, opts ...ClientOpt) (*Client, error)
+}
+
+// NewMultiClient returns a MultiClient acquiring leases on the interfaces
+// named ifaces, or on all interfaces but loopback ones if ifaces is empty.
+// Interfaces that are down are brought up, as by Acquire. The clients are
+// configured with opts.
+func NewMultiClient(ifaces []string, opts ...ClientOpt) (*MultiClient, error) {
+	if len(ifaces) == 0 {
+		all, err := net.Interfaces()
+		if err != nil {
+			return nil, err
+		}
+		for _, iface := range all {
+			if iface.Flags&net.FlagLoopback == 0 {
+				ifaces = append(ifaces, iface.Name)
+			}
+		}
+		if len(ifaces) == 0 {
+			return nil, fmt.Errorf("no interfaces to acquire leases on")
+		}
+	}
+	return &MultiClient{
+		ifaces:    ifaces,
+		opts:      opts,
+		newClient: newLinkClient,
+	}, nil
+}
+
+// InterfaceResult is the outcome of acquiring a lease on one interface.
+type InterfaceResult struct {
+	Interface string
+	Lease     *Lease
+	Err       error
+}
+
+// MultiError is returned by MultiClient.First if no interface got a lease.
+type MultiError struct {
+	// Results are the failures of all interfaces, in the order the
+	// interfaces were given.
+	Results []InterfaceResult
+}
+
+// Error implements error.
+func (me *MultiError) Error() string {
+	s := make([]string, 0, len(me.Results))
+	for _, r := range me.Results {
+		s = append(s, fmt.Sprintf("%s: %v", r.Interface, r.Err))
+	}
+	return "no lease on any interface: " + strings.Join(s, "; ")
+}
+
+// acquired is a result with the client that got it.
+type acquired struct {
+	InterfaceResult
+	index  int
+	client *Client
+}
+
+// acquire requests a lease on every interface concurrently and sends the
+// results on the returned channel, which gets exactly one result per
+// interface. Callers must close the clients of the results.
+func (mc *MultiClient) acquire(ctx context.Context) <-chan acquired {
+	results := make(chan acquired, len(mc.ifaces))
+	for i, iface := range mc.ifaces {
+		go func(i int, iface string) {
+			r := acquired{InterfaceResult: InterfaceResult{Interface: iface}, index: i}
+			r.client, r.Err = mc.newClient(iface, mc.opts...)
+			if r.Err == nil {
+				r.Lease, r.Err = r.client.RequestLease(ctx)
+			}
+			results <- r
+		}(i, iface)
+	}
+	return results
+}
+
+// First returns the first lease acquired on any interface and stops
+// acquiring on the others. Leases acquired on other interfaces before they
+// stopped are released. If no interface got a lease, First returns a
+// *MultiError.
+func (mc *MultiClient) First(ctx context.Context) (InterfaceResult, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var winner *InterfaceResult
+	failed := make([]InterfaceResult, len(mc.ifaces))
+	results := mc.acquire(ctx)
+	for range mc.ifaces {
+		r := <-results
+		switch {
+		case r.Err == nil && winner == nil:
+			winner = &r.InterfaceResult
+			cancel()
+		case r.Err == nil:
+			// Lost the race; give the address back.
+			r.client.Release(context.Background(), r.Lease)
+		default:
+			failed[r.index] = r.InterfaceResult
+		}
+		if r.client != nil {
+			r.client.Close()
+		}
+	}
+	if winner == nil {
+		return InterfaceResult{}, &MultiError{Results: failed}
+	}
+	return *winner, nil
+}
+
+// All acquires a lease on every interface and returns the results, in the
+// order the interfaces were given.
+func (mc *MultiClient) All(ctx context.Context) []InterfaceResult {
+	rs := make([]InterfaceResult, len(mc.ifaces))
+	results := mc.acquire(ctx)
+	for range mc.ifaces {
+		r := <-results
+		rs[r.index] = r.InterfaceResult
+		if r.client != nil {
+			r.client.Close()
+		}
+	}
+	return rs
+}
@@ -0,0 +1,90 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+)
+
+// newTestMultiClient returns a MultiClient on interfaces served by mock
+// servers sending the given responses.
+func newTestMultiClient(ctx context.Context, t *testing.T, responses map[string][][]*dhcp4.Packet) *MultiClient {
+	var ifaces []string
+	for iface := range responses {
+		ifaces = append(ifaces, iface)
+	}
+	return &MultiClient{
+		ifaces: ifaces,
+		newClient: func(iface string, opts ...ClientOpt) (*Client, error) {
+			c, _ := serveClient(ctx, t, responses[iface], WithBackoff(FixedBackoff{Wait: 200 * time.Millisecond, Attempts: 1}))
+			return c, nil
+		},
+	}
+}
+
+func TestMultiClient(t *testing.T) {
+	ip := net.IP{192, 168, 1, 10}
+	lease := [][]*dhcp4.Packet{
+		{newLeaseReply(dhcp4.DHCPOffer, serverA, ip, time.Hour)},
+		{newLeaseReply(dhcp4.DHCPACK, serverA, ip, time.Hour)},
+	}
+	// Nobody answers.
+	silence := [][]*dhcp4.Packet{{}, {}}
+
+	t.Run("first", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		mc := newTestMultiClient(ctx, t, map[string][][]*dhcp4.Packet{"eth0": silence, "eth1": lease})
+
+		r, err := mc.First(ctx)
+		if err != nil {
+			t.Fatalf("First() = %v", err)
+		}
+		if r.Interface != "eth1" || !r.Lease.IP.Equal(ip) {
+			t.Errorf("First() = %s: %v, want eth1: %v", r.Interface, r.Lease, ip)
+		}
+	})
+
+	t.Run("none", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		mc := newTestMultiClient(ctx, t, map[string][][]*dhcp4.Packet{"eth0": silence, "eth1": silence})
+
+		_, err := mc.First(ctx)
+		me, ok := err.(*MultiError)
+		if !ok || len(me.Results) != 2 {
+			t.Fatalf("First() = %v, want *MultiError for 2 interfaces", err)
+		}
+		for i, r := range me.Results {
+			if r.Interface != mc.ifaces[i] || r.Err == nil {
+				t.Errorf("result %d = %+v, want error for %s", i, r, mc.ifaces[i])
+			}
+		}
+	})
+
+	t.Run("all", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		mc := newTestMultiClient(ctx, t, map[string][][]*dhcp4.Packet{"eth0": silence, "eth1": lease})
+
+		rs := mc.All(ctx)
+		if len(rs) != 2 {
+			t.Fatalf("All() returned %d results, want 2", len(rs))
+		}
+		for i, r := range rs {
+			if r.Interface != mc.ifaces[i] {
+				t.Errorf("result %d is for %s, want %s", i, r.Interface, mc.ifaces[i])
+			}
+			if got := r.Err == nil; got != (r.Interface == "eth1") {
+				t.Errorf("result for %s = %v, %v", r.Interface, r.Lease, r.Err)
+			}
+		}
+	})
+}
@@ -0,0 +1,149 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+	"github.com/mergetb/dhcp4/dhcp4opts"
+)
+
+// NAKError is returned when a server answers a request with a DHCPNAK.
+type NAKError struct {
+	// NAK is the server's response.
+	NAK *dhcp4.Packet
+
+	// IP is the address that was refused.
+	IP net.IP
+
+	// Count is the number of consecutive NAKs received for IP.
+	Count int
+
+	// HoldOff is how long the client waits before the next RequestLease.
+	HoldOff time.Duration
+}
+
+// Error implements error.
+func (ne *NAKError) Error() string {
+	s := fmt.Sprintf("server refused %v (NAK %d in a row)", ne.IP, ne.Count)
+	if msg := ne.NAK.Options.Get(dhcp4.OptionMessage); len(msg) > 0 {
+		s += fmt.Sprintf(": %q", msg)
+	}
+	if ne.HoldOff > 0 {
+		s += fmt.Sprintf(", holding off for %v", ne.HoldOff)
+	}
+	return s
+}
+
+// WithNAKHoldOff configures the hold-off applied to re-acquisition after
+// repeated NAKs for the same address.
+//
+// As RFC 2131 Section 3.1 requires, the client restarts the configuration
+// process immediately after the first NAK. Each further consecutive NAK for
+// the same address doubles the time RequestLease waits before sending a
+// Discover, starting at base and capped at max. A base of 0 disables the
+// hold-off.
+//
+// Default is 4 seconds, capped at 64 seconds, following the retransmission
+// delays of RFC 2131 Section 4.1.
+func WithNAKHoldOff(base, max time.Duration) ClientOpt {
+	return func(c *Client) error {
+		if base < 0 || max < base {
+			return fmt.Errorf("invalid NAK hold-off %v up to %v", base, max)
+		}
+		c.naks.base = base
+		c.naks.max = max
+		return nil
+	}
+}
+
+// WithNAKRestart makes the client go back to INIT when a server answers with
+// a NAK, as RFC 2131 Section 3.1 describes, rather than returning the NAK to
+// the caller. RequestLease restarts discovery after up to restarts NAKs in a
+// row before it returns a *NAKError, and Maintain acquires a new lease when
+// the renewal or rebinding of its lease is NAKed, sending it as a
+// LeaseReacquired event. Each restart waits out the hold-off configured by
+// WithNAKHoldOff.
+//
+// Default is 0: RequestLease returns the first NAK, and Maintain ends with a
+// LeaseLost event.
+func WithNAKRestart(restarts int) ClientOpt {
+	return func(c *Client) error {
+		if restarts < 0 {
+			return fmt.Errorf("invalid number of NAK restarts %d", restarts)
+		}
+		c.nakRestarts = restarts
+		return nil
+	}
+}
+
+// nakTracker tracks consecutive NAKs for the same address.
+type nakTracker struct {
+	base, max time.Duration
+
+	mu    sync.Mutex
+	ip    net.IP
+	count int
+	until time.Time
+}
+
+// holdOff returns the time left until the next RequestLease may be sent.
+func (nt *nakTracker) holdOff(now time.Time) time.Duration {
+	nt.mu.Lock()
+	defer nt.mu.Unlock()
+	if d := nt.until.Sub(now); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// observe records response to a request for ip, and returns a NAKError if
+// response is a NAK.
+func (nt *nakTracker) observe(now time.Time, ip net.IP, response *dhcp4.Packet) error {
+	nt.mu.Lock()
+	defer nt.mu.Unlock()
+
+	switch dhcp4opts.GetDHCPMessageType(response.Options) {
+	case dhcp4opts.DHCPNAK:
+		if !nt.ip.Equal(ip) {
+			nt.ip = ip
+			nt.count = 0
+		}
+		nt.count++
+		d := nt.backoff(nt.count)
+		nt.until = now.Add(d)
+		return &NAKError{
+			NAK:     response,
+			IP:      ip,
+			Count:   nt.count,
+			HoldOff: d,
+		}
+
+	case dhcp4opts.DHCPACK:
+		nt.ip = nil
+		nt.count = 0
+		nt.until = time.Time{}
+	}
+	return nil
+}
+
+// backoff returns the hold-off after the count'th consecutive NAK.
+func (nt *nakTracker) backoff(count int) time.Duration {
+	if count <= 1 || nt.base == 0 {
+		return 0
+	}
+	d := nt.base
+	for i := 2; i < count && d < nt.max; i++ {
+		d *= 2
+	}
+	if d > nt.max {
+		d = nt.max
+	}
+	return d
+}
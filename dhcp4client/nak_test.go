@@ -0,0 +1,201 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+	"github.com/mergetb/dhcp4/dhcp4opts"
+)
+
+func newReply(typ dhcp4opts.DHCPMessageType, yiaddr net.IP) *dhcp4.Packet {
+	p := newPacket(dhcp4.BootReply, [4]byte{})
+	p.YIAddr = yiaddr
+	p.Options.Add(dhcp4.OptionDHCPMessageType, typ)
+	return p
+}
+
+func TestNAKTrackerBackoff(t *testing.T) {
+	nt := nakTracker{base: time.Second, max: 5 * time.Second}
+	for _, tt := range []struct {
+		count int
+		want  time.Duration
+	}{
+		{count: 1, want: 0},
+		{count: 2, want: time.Second},
+		{count: 3, want: 2 * time.Second},
+		{count: 4, want: 4 * time.Second},
+		{count: 5, want: 5 * time.Second},
+		{count: 100, want: 5 * time.Second},
+	} {
+		if got := nt.backoff(tt.count); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.count, got, tt.want)
+		}
+	}
+}
+
+func TestNAKTrackerObserve(t *testing.T) {
+	ip1 := net.IP{192, 168, 0, 10}
+	ip2 := net.IP{192, 168, 0, 11}
+	now := time.Now()
+
+	nt := nakTracker{base: time.Second, max: time.Minute}
+	for i, tt := range []struct {
+		ip        net.IP
+		response  *dhcp4.Packet
+		wantCount int
+		wantHold  time.Duration
+	}{
+		{ip: ip1, response: newReply(dhcp4opts.DHCPNAK, nil), wantCount: 1},
+		{ip: ip1, response: newReply(dhcp4opts.DHCPNAK, nil), wantCount: 2, wantHold: time.Second},
+		{ip: ip1, response: newReply(dhcp4opts.DHCPNAK, nil), wantCount: 3, wantHold: 2 * time.Second},
+		// A NAK for another address starts over.
+		{ip: ip2, response: newReply(dhcp4opts.DHCPNAK, nil), wantCount: 1},
+		{ip: ip2, response: newReply(dhcp4opts.DHCPNAK, nil), wantCount: 2, wantHold: time.Second},
+		// An ACK resets the hold-off.
+		{ip: ip2, response: newReply(dhcp4opts.DHCPACK, ip2)},
+		{ip: ip2, response: newReply(dhcp4opts.DHCPNAK, nil), wantCount: 1},
+	} {
+		err := nt.observe(now, tt.ip, tt.response)
+		if tt.wantCount == 0 {
+			if err != nil {
+				t.Errorf("#%d: observe = %v, want nil", i, err)
+			}
+		} else if ne, ok := err.(*NAKError); !ok {
+			t.Errorf("#%d: observe = %v, want *NAKError", i, err)
+		} else if ne.Count != tt.wantCount || ne.HoldOff != tt.wantHold {
+			t.Errorf("#%d: observe = NAK %d holding off %v, want NAK %d holding off %v", i, ne.Count, ne.HoldOff, tt.wantCount, tt.wantHold)
+		}
+		if got := nt.holdOff(now); got != tt.wantHold {
+			t.Errorf("#%d: holdOff = %v, want %v", i, got, tt.wantHold)
+		}
+	}
+}
+
+func TestRequestNAKHoldOff(t *testing.T) {
+	ip := net.IP{192, 168, 0, 10}
+	offer := newReply(dhcp4opts.DHCPOffer, ip)
+	offer.Options.SetServerIdentifier(net.IP{192, 168, 0, 1})
+	nak := newReply(dhcp4opts.DHCPNAK, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	mc, _ := serveAndClient(ctx, [][]*dhcp4.Packet{
+		{offer}, {nak},
+		{offer}, {nak},
+		{offer}, {nak},
+	})
+	defer mc.conn.Close()
+	const base = 100 * time.Millisecond
+	if err := WithNAKHoldOff(base, time.Second)(mc); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, wantHold := range []time.Duration{0, base, 2 * base} {
+		start := time.Now()
+		_, err := mc.RequestLease(ctx)
+		ne, ok := err.(*NAKError)
+		if !ok {
+			t.Fatalf("#%d: Request = %v, want *NAKError", i, err)
+		}
+		if ne.HoldOff != wantHold {
+			t.Errorf("#%d: HoldOff = %v, want %v", i, ne.HoldOff, wantHold)
+		}
+		if i == 2 {
+			if elapsed := time.Since(start); elapsed < base {
+				t.Errorf("#%d: Request took %v, want it to wait out the %v hold-off", i, elapsed, base)
+			}
+		}
+	}
+}
+
+func TestRequestNAKRestart(t *testing.T) {
+	ip := net.IP{192, 168, 1, 10}
+	offer := newLeaseReply(dhcp4.DHCPOffer, serverA, ip, time.Hour)
+	ack := newLeaseReply(dhcp4.DHCPACK, serverA, ip, time.Hour)
+	nak := newLeaseReply(dhcp4.DHCPNAK, serverA, nil, 0)
+
+	for _, tt := range []struct {
+		desc      string
+		restarts  int
+		responses [][]*dhcp4.Packet
+		wantNAKs  int
+	}{
+		{
+			desc:      "restarted",
+			restarts:  1,
+			responses: [][]*dhcp4.Packet{{offer}, {nak}, {offer}, {ack}},
+		},
+		{
+			desc:      "too many NAKs",
+			restarts:  1,
+			responses: [][]*dhcp4.Packet{{offer}, {nak}, {offer}, {nak}},
+			wantNAKs:  2,
+		},
+		{
+			desc:      "no restarts",
+			responses: [][]*dhcp4.Packet{{offer}, {nak}, {offer}, {ack}},
+			wantNAKs:  1,
+		},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			c, s := serveClient(ctx, t, tt.responses, WithNAKRestart(tt.restarts), WithNAKHoldOff(0, 0))
+			defer c.Close()
+
+			lease, err := c.RequestLease(ctx)
+			if tt.wantNAKs == 0 {
+				if err != nil || !lease.IP.Equal(ip) {
+					t.Fatalf("Request() = %v, %v, want %v", lease, err, ip)
+				}
+				if len(s.packets()) != 4 {
+					t.Errorf("server received %d packets, want 2 DISCOVERs and REQUESTs", len(s.packets()))
+				}
+				return
+			}
+			ne, ok := err.(*NAKError)
+			if !ok {
+				t.Fatalf("Request() = %v, want *NAKError", err)
+			}
+			if ne.Count != tt.wantNAKs {
+				t.Errorf("NAK count = %d, want %d", ne.Count, tt.wantNAKs)
+			}
+		})
+	}
+}
+
+func TestMaintainNAKRestart(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ip, newIP := net.IP{192, 168, 1, 10}, net.IP{192, 168, 1, 11}
+	c, _ := serveClient(ctx, t, [][]*dhcp4.Packet{
+		{newLeaseReply(dhcp4.DHCPNAK, serverA, nil, 0)},
+		{newLeaseReply(dhcp4.DHCPOffer, serverA, newIP, time.Hour)},
+		{newLeaseReply(dhcp4.DHCPACK, serverA, newIP, time.Hour)},
+	}, WithNAKRestart(1), WithTimeout(50*time.Millisecond))
+	defer c.Close()
+
+	ev, ok := <-c.Maintain(ctx, shortLease(ip))
+	if !ok {
+		t.Fatal("Maintain() sent no event")
+	}
+	if ev.Kind != LeaseReacquired {
+		t.Fatalf("Maintain() sent %v event (%v), want %v", ev.Kind, ev.Err, LeaseReacquired)
+	}
+	if !ev.Lease.IP.Equal(newIP) {
+		t.Errorf("reacquired lease %v, want %v", ev.Lease, newIP)
+	}
+	if _, ok := ev.Err.(*NAKError); !ok {
+		t.Errorf("event error = %v, want *NAKError", ev.Err)
+	}
+}
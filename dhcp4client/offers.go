@@ -0,0 +1,177 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+)
+
+// Offer is an offer collected by Offers.
+type Offer struct {
+	Packet *dhcp4.Packet
+
+	// Source is the address the offer was received from.
+	Source net.Addr
+
+	// Received is when the offer was received.
+	Received time.Time
+
+	// Duplicates is the number of further offers received from the same
+	// server, e.g. answering retransmissions of the Discover, and
+	// dropped.
+	Duplicates int
+}
+
+// ServerID returns the server identifier of the offer.
+func (o *Offer) ServerID() net.IP {
+	return o.Packet.Options.ServerIdentifier()
+}
+
+// addOffer adds the offer in p to offers, unless a server already offered:
+// a server answers every retransmission of the Discover, and the first offer
+// of each server is kept. It returns whether the offer was added.
+func addOffer(offers []*Offer, p *ClientPacket) ([]*Offer, bool) {
+	sid := p.Packet.Options.ServerIdentifier()
+	for _, o := range offers {
+		if o.ServerID().Equal(sid) {
+			o.Duplicates++
+			return offers, false
+		}
+	}
+	return append(offers, &Offer{Packet: p.Packet, Source: p.Source, Received: p.Received}), true
+}
+
+// Offers collects the offers of the servers answering a Discover, one per
+// server, see Client.DiscoverOffers.
+type Offers struct {
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu     sync.Mutex
+	offers []*Offer
+	done   bool
+	err    error
+
+	// changed is closed and replaced when an offer is added or
+	// collecting ends.
+	changed chan struct{}
+}
+
+// DiscoverOffers broadcasts a Discover and collects the offers received
+// until ctx is done, the configured retries are exhausted or Close is
+// called.
+//
+// Unlike the channel of SimpleSendAndRead, which delivers every response,
+// the collector drops offers that are not valid and repeated offers of a
+// server, and keeps when and where each offer was received.
+func (c *Client) DiscoverOffers(ctx context.Context) *Offers {
+	ctx, cancel := context.WithCancel(ctx)
+	o := &Offers{
+		cancel:  cancel,
+		changed: make(chan struct{}),
+	}
+	discover, err := c.NewDiscoverPacket()
+	if err != nil {
+		cancel()
+		o.err, o.done = err, true
+		return o
+	}
+	wg, out, errCh := c.SimpleSendAndRead(ctx, DefaultServers, discover)
+
+	o.wg.Add(1)
+	go func() {
+		defer o.wg.Done()
+		for p := range out {
+			if c.discardOffer(p) {
+				continue
+			}
+			o.mu.Lock()
+			var added bool
+			if o.offers, added = addOffer(o.offers, p); added {
+				o.notify()
+			}
+			o.mu.Unlock()
+		}
+		wg.Wait()
+
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		if err, ok := <-errCh; ok && err != nil {
+			o.err = err
+		}
+		o.done = true
+		o.notify()
+	}()
+	return o
+}
+
+// notify wakes up the callers of Wait. o.mu must be held.
+func (o *Offers) notify() {
+	close(o.changed)
+	o.changed = make(chan struct{})
+}
+
+// List returns the offers collected so far, in the order they were
+// received.
+func (o *Offers) List() []*Offer {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.list()
+}
+
+// list copies the offers, so that callers do not see Duplicates change. o.mu
+// must be held.
+func (o *Offers) list() []*Offer {
+	offers := make([]*Offer, 0, len(o.offers))
+	for _, off := range o.offers {
+		cp := *off
+		offers = append(offers, &cp)
+	}
+	return offers
+}
+
+// Wait waits until n offers have been collected, ctx is done or collecting
+// ended, and returns the offers collected. n <= 0 returns the offers
+// collected so far.
+//
+// It returns an error only if there are no offers: the error of the
+// exchange, or ctx.Err().
+func (o *Offers) Wait(ctx context.Context, n int) ([]*Offer, error) {
+	for {
+		o.mu.Lock()
+		offers, done, err, changed := o.list(), o.done, o.err, o.changed
+		o.mu.Unlock()
+
+		switch {
+		case len(offers) >= n || (done && len(offers) > 0):
+			return offers, nil
+		case done && err != nil:
+			return nil, err
+		case done:
+			return nil, errors.New("no offers received")
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			if len(offers) > 0 {
+				return o.List(), nil
+			}
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Close stops collecting offers. The offers collected remain available.
+func (o *Offers) Close() {
+	o.cancel()
+	o.wg.Wait()
+}
@@ -0,0 +1,163 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+)
+
+func TestDiscoverOffers(t *testing.T) {
+	ipA := net.IP{192, 168, 1, 10}
+	ipB := net.IP{192, 168, 2, 10}
+	offerA := newLeaseReply(dhcp4.DHCPOffer, serverA, ipA, time.Hour)
+	offerB := newLeaseReply(dhcp4.DHCPOffer, serverB, ipB, time.Hour)
+	ack := newLeaseReply(dhcp4.DHCPACK, serverA, ipA, time.Hour)
+
+	for _, tt := range []struct {
+		desc           string
+		responses      [][]*dhcp4.Packet
+		n              int
+		want           []net.IP
+		wantDuplicates []int
+		wantErr        bool
+	}{
+		{
+			desc:           "retransmissions dropped",
+			responses:      [][]*dhcp4.Packet{{offerA, offerA, ack, offerB}},
+			n:              2,
+			want:           []net.IP{serverA, serverB},
+			wantDuplicates: []int{1, 0},
+		},
+		{
+			desc:           "fewer than n",
+			responses:      [][]*dhcp4.Packet{{offerA}},
+			n:              2,
+			want:           []net.IP{serverA},
+			wantDuplicates: []int{0},
+		},
+		{
+			desc:      "none",
+			responses: [][]*dhcp4.Packet{{ack}},
+			n:         1,
+			wantErr:   true,
+		},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			c, _ := serveClient(ctx, t, tt.responses, WithTimeout(100*time.Millisecond))
+			defer c.Close()
+
+			start := time.Now()
+			offers := c.DiscoverOffers(ctx)
+			defer offers.Close()
+
+			got, err := offers.Wait(ctx, tt.n)
+			if (err != nil) != tt.wantErr || len(got) != len(tt.want) {
+				t.Fatalf("Wait(%d) = %v, %v; want offers of %v", tt.n, got, err, tt.want)
+			}
+			for i, o := range got {
+				if !o.ServerID().Equal(tt.want[i]) || o.Duplicates != tt.wantDuplicates[i] {
+					t.Errorf("offer %d from %v with %d duplicates, want %v with %d", i, o.ServerID(), o.Duplicates, tt.want[i], tt.wantDuplicates[i])
+				}
+				if o.Source == nil || o.Received.Before(start) {
+					t.Errorf("offer %d received from %v at %v, want a source and a time after %v", i, o.Source, o.Received, start)
+				}
+			}
+		})
+	}
+}
+
+func TestDiscoverOffersDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	c, _ := serveClient(ctx, t, [][]*dhcp4.Packet{
+		{newLeaseReply(dhcp4.DHCPOffer, serverA, net.IP{192, 168, 1, 10}, time.Hour)},
+		// Keep the server from closing the connection.
+		{},
+	})
+	defer c.Close()
+
+	offers := c.DiscoverOffers(ctx)
+	defer offers.Close()
+
+	// The exchange keeps listening for a second, but the caller only
+	// waits for 100ms.
+	wctx, wcancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer wcancel()
+	got, err := offers.Wait(wctx, 2)
+	if err != nil || len(got) != 1 {
+		t.Errorf("Wait(2) = %v, %v; want the one offer", got, err)
+	}
+}
+
+func TestDiscoverOffersInvalid(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ip := net.IP{192, 168, 1, 10}
+	invalid := newLeaseReply(dhcp4.DHCPOffer, serverA, ip, time.Hour)
+	invalid.CIAddr = ip
+	l := &eventLog{}
+	c, _ := serveClient(ctx, t, [][]*dhcp4.Packet{
+		{invalid, newLeaseReply(dhcp4.DHCPOffer, serverB, ip, time.Hour)},
+		{},
+	}, WithLogger(l), WithTimeout(100*time.Millisecond))
+	defer c.Close()
+
+	offers := c.DiscoverOffers(ctx)
+	defer offers.Close()
+
+	got, err := offers.Wait(ctx, 2)
+	if err != nil || len(got) != 1 || !got[0].ServerID().Equal(serverB) {
+		t.Fatalf("Wait(2) = %v, %v; want the offer of %v", got, err, serverB)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var invalids []PacketEvent
+	for _, e := range l.events {
+		if e.Kind == PacketDiscarded && e.Reason == RejectInvalid {
+			invalids = append(invalids, e)
+		}
+	}
+	if len(invalids) != 1 {
+		t.Fatalf("discarded %d invalid offers, want 1", len(invalids))
+	}
+	if errs, ok := invalids[0].Err.(dhcp4.ValidationErrors); !ok || len(errs) != 1 || errs[0].Field != "ciaddr" {
+		t.Errorf("discarded for %v, want ciaddr set", invalids[0].Err)
+	}
+}
+
+func TestRequestDuplicateOffers(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ip := net.IP{192, 168, 1, 10}
+	offer := newLeaseReply(dhcp4.DHCPOffer, serverA, ip, time.Hour)
+	var seen int
+	c, _ := serveClient(ctx, t, [][]*dhcp4.Packet{
+		{offer, offer},
+		{newLeaseReply(dhcp4.DHCPACK, serverA, ip, time.Hour)},
+	}, WithOfferWait(50*time.Millisecond), WithOfferSelector(func(offers []*dhcp4.Packet) *dhcp4.Packet {
+		seen = len(offers)
+		return FirstOffer(offers)
+	}))
+	defer c.Close()
+
+	if _, err := c.RequestLease(ctx); err != nil {
+		t.Fatalf("Request() = %v", err)
+	}
+	if seen != 1 {
+		t.Errorf("offer selector saw %d offers, want 1", seen)
+	}
+}
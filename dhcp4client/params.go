@@ -0,0 +1,61 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"fmt"
+
+	"github.com/mergetb/dhcp4"
+)
+
+// WithRequestedOptions configures the options the client asks servers for
+// in the parameter request list (option 55) of DISCOVERs, REQUESTs,
+// renewals and INFORMs. Servers only send a few default options to clients
+// that ask for none, see RFC 2132 Section 9.8. Duplicate codes are sent
+// once; the order of codes is kept, as it is the client's preference.
+//
+// MissingOptions reports which of them a server did not send.
+//
+// Default is no parameter request list.
+func WithRequestedOptions(codes ...dhcp4.OptionCode) ClientOpt {
+	return func(c *Client) error {
+		seen := make(map[dhcp4.OptionCode]bool, len(codes))
+		var requested []dhcp4.OptionCode
+		for _, code := range codes {
+			if code == dhcp4.Pad || code == dhcp4.End {
+				return fmt.Errorf("cannot request option %d", uint8(code))
+			}
+			if !seen[code] {
+				seen[code] = true
+				requested = append(requested, code)
+			}
+		}
+		c.requested = requested
+		return nil
+	}
+}
+
+// requestOptions adds the parameter request list configured to p.
+func (c *Client) requestOptions(p *dhcp4.Packet) {
+	if len(c.requested) > 0 {
+		p.Options.SetParameterRequestList(c.requested)
+	}
+}
+
+// MissingOptions returns the options configured with WithRequestedOptions
+// that o, e.g. the options of a lease's ACK or those returned by Inform,
+// does not have, in the order they were requested.
+//
+// Servers need not send every option requested, but a missing option often
+// means the server's configuration lacks it.
+func (c *Client) MissingOptions(o dhcp4.Options) []dhcp4.OptionCode {
+	var missing []dhcp4.OptionCode
+	for _, code := range c.requested {
+		if _, ok := o[code]; !ok {
+			missing = append(missing, code)
+		}
+	}
+	return missing
+}
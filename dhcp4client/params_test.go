@@ -0,0 +1,69 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+)
+
+func TestRequestedOptions(t *testing.T) {
+	for _, tt := range []struct {
+		desc    string
+		codes   []dhcp4.OptionCode
+		want    []dhcp4.OptionCode
+		missing []dhcp4.OptionCode
+		wantErr bool
+	}{
+		{desc: "none"},
+		{
+			desc:    "some",
+			codes:   []dhcp4.OptionCode{dhcp4.OptionRouters, dhcp4.OptionSubnetMask, dhcp4.OptionDomainNameServers},
+			want:    []dhcp4.OptionCode{dhcp4.OptionRouters, dhcp4.OptionSubnetMask, dhcp4.OptionDomainNameServers},
+			missing: []dhcp4.OptionCode{dhcp4.OptionDomainNameServers},
+		},
+		{
+			desc:    "duplicates",
+			codes:   []dhcp4.OptionCode{dhcp4.OptionSubnetMask, dhcp4.OptionNetworkTimeProtocolServers, dhcp4.OptionSubnetMask},
+			want:    []dhcp4.OptionCode{dhcp4.OptionSubnetMask, dhcp4.OptionNetworkTimeProtocolServers},
+			missing: []dhcp4.OptionCode{dhcp4.OptionNetworkTimeProtocolServers},
+		},
+		{desc: "pad", codes: []dhcp4.OptionCode{dhcp4.Pad}, wantErr: true},
+		{desc: "end", codes: []dhcp4.OptionCode{dhcp4.OptionRouters, dhcp4.End}, wantErr: true},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			c, err := New(nil, WithConn(newMockUDPConn(nil, nil)), WithRequestedOptions(tt.codes...))
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("New() = nil, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ip := net.IP{192, 168, 1, 10}
+			offer := newLeaseReply(dhcp4.DHCPOffer, serverA, ip, time.Hour)
+			must := mustPacket(t)
+			for _, p := range []*dhcp4.Packet{c.DiscoverPacket(), c.RequestPacket(offer), must(c.renewPacket(shortLease(ip))), must(c.informPacket(ip))} {
+				if got := p.Options.ParameterRequestList(); !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("%v parameter request list %v, want %v", p.Options.MessageType(), got, tt.want)
+				}
+			}
+
+			ack := newLeaseReply(dhcp4.DHCPACK, serverA, ip, time.Hour)
+			ack.Options.SetSubnetMask(net.IPMask{255, 255, 255, 0})
+			ack.Options.SetRouters([]net.IP{serverA})
+			if got := c.MissingOptions(ack.Options); !reflect.DeepEqual(got, tt.missing) {
+				t.Errorf("MissingOptions() = %v, want %v", got, tt.missing)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"net"
+
+	"github.com/mergetb/dhcp4/internal/preflight"
+)
+
+// Capability is a Linux capability, as listed in capabilities(7).
+type Capability = preflight.Capability
+
+// Capabilities needed to run DHCP clients and servers.
+const (
+	CapNetBindService = preflight.CapNetBindService
+	CapNetRaw         = preflight.CapNetRaw
+)
+
+// PermissionError is returned when the kernel refuses to set up a socket
+// for lack of privilege.
+type PermissionError = preflight.PermissionError
+
+// PreflightError lists the problems found by Preflight.
+type PreflightError = preflight.Error
+
+// Preflight checks that the process may open the sockets used to speak DHCP
+// on UDP port port, so that missing permissions are reported before a
+// client or server is started rather than on first use.
+//
+// If iface is not empty, Preflight checks the sockets bound to iface
+// instead: the raw packet socket clients use by default, and the datagram
+// socket NewIPv4UDPConn returns.
+//
+// Permission problems are reported as *PermissionError.
+func Preflight(iface string, port int) error {
+	if iface == "" {
+		return preflight.Check(port)
+	}
+	return preflight.Check(port,
+		func() (net.PacketConn, error) { return NewPacketUDPConn(iface, port) },
+		func() (net.PacketConn, error) { return NewIPv4UDPConn(iface, port) },
+	)
+}
+
+// permissionErr wraps err in a *PermissionError if the kernel refused op for
+// lack of privilege.
+func permissionErr(op string, c Capability, err error) error {
+	return preflight.PermissionErr(op, c, err)
+}
+
+// bindErr wraps an error binding to port.
+func bindErr(port int, err error) error {
+	return preflight.BindErr(port, err)
+}
@@ -0,0 +1,19 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"os"
+	"testing"
+)
+
+func TestPreflight(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("needs root")
+	}
+	if err := Preflight("lo", 0); err != nil {
+		t.Errorf("Preflight(lo) = %v", err)
+	}
+}
@@ -0,0 +1,256 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+	"github.com/mergetb/dhcp4/dhcp4opts"
+)
+
+// PXEServerPort is the port PXE boot servers listen on.
+const PXEServerPort = 4011
+
+// proxyOfferWait is how long PXEBoot waits for a ProxyDHCP offer after the
+// first offer arrived.
+const proxyOfferWait = 2 * time.Second
+
+// WithPXEClient configures the system architecture and machine UUID PXEBoot
+// identifies the client with, see RFC 4578.
+//
+// Default is ArchX86BIOS and the all-zero UUID.
+func WithPXEClient(arch dhcp4.Arch, uuid dhcp4.UUID) ClientOpt {
+	return func(c *Client) error {
+		c.pxeArch = arch
+		c.pxeUUID = uuid
+		return nil
+	}
+}
+
+// PXEBootInfo is the outcome of PXEBoot.
+type PXEBootInfo struct {
+	// Lease is the address leased to the client.
+	Lease *Lease
+
+	// TFTPServer is the server to download BootFile from.
+	TFTPServer net.IP
+
+	// BootFile is the name of the boot file.
+	BootFile string
+
+	// Response is the packet the boot file was found in: the DHCP
+	// server's ACK or offer, a ProxyDHCP offer, or a boot server's ACK.
+	Response *dhcp4.Packet
+}
+
+// String implements fmt.Stringer.
+func (b *PXEBootInfo) String() string {
+	return fmt.Sprintf("%s from %v, address %v", b.BootFile, b.TFTPServer, b.Lease)
+}
+
+// PXEBoot acquires a lease and finds the boot file like a PXE client does,
+// as described by the PXE Specification 2.1, Section 2.2.
+//
+// It sends a Discover with the PXE client options, see WithPXEClient, and
+// waits for an offer with an address and for boot information, which is in
+// that offer if the DHCP server is the PXE server too, or in a separate
+// ProxyDHCP offer. It requests the address and, if the boot information came
+// from a ProxyDHCP server, asks that server for the boot file on
+// PXEServerPort unless its offer tells the client to skip discovery.
+func (c *Client) PXEBoot(ctx context.Context) (*PXEBootInfo, error) {
+	offer, proxy, err := c.pxeOffers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := c.NewRequestPacket(offer)
+	if err != nil {
+		return nil, err
+	}
+	dhcp4opts.SetPXEClientOptions(request.Options, c.pxeArch, c.pxeUUID)
+	lease, err := c.requestLease(ctx, DefaultServers, request, offer.YIAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	if proxy == nil {
+		// The DHCP server is the PXE server. Its ACK should repeat
+		// the boot information of the offer, but may not.
+		for _, p := range []*dhcp4.Packet{lease.ACK, offer} {
+			if info := pxeBootInfo(lease, p); info != nil {
+				return info, nil
+			}
+		}
+		return nil, fmt.Errorf("PXE offer from %v without boot file", offer.Options.ServerIdentifier())
+	}
+
+	proxyInfo := pxeBootInfo(lease, proxy)
+	if proxyInfo != nil && skipsDiscovery(proxy) {
+		return proxyInfo, nil
+	}
+	bootRequest, err := c.bootRequestPacket(lease, proxy)
+	if err != nil {
+		return nil, err
+	}
+	ack, err := c.exchange(ctx, &net.UDPAddr{IP: proxy.Options.ServerIdentifier(), Port: PXEServerPort}, bootRequest, func(p *dhcp4.Packet) bool {
+		return p.Options.MessageType() == dhcp4.DHCPACK
+	})
+	if err != nil {
+		if proxyInfo != nil {
+			// Not all ProxyDHCP servers are boot servers.
+			return proxyInfo, nil
+		}
+		return nil, fmt.Errorf("boot server %v: %v", proxy.Options.ServerIdentifier(), err)
+	}
+	if info := pxeBootInfo(lease, ack); info != nil {
+		return info, nil
+	}
+	return nil, fmt.Errorf("boot server %v sent no boot file", proxy.Options.ServerIdentifier())
+}
+
+// isPXE returns whether p is a reply of a PXE server.
+func isPXE(p *dhcp4.Packet) bool {
+	return strings.HasPrefix(p.Options.VendorClassIdentifier(), dhcp4opts.PXEProfile.ClassPrefix)
+}
+
+// isProxyOffer returns whether p is an offer of a ProxyDHCP server, which
+// carries boot information but no address.
+func isProxyOffer(p *dhcp4.Packet) bool {
+	return p.Options.MessageType() == dhcp4.DHCPOffer && isPXE(p) &&
+		(p.YIAddr == nil || p.YIAddr.Equal(net.IPv4zero)) &&
+		p.Options.ServerIdentifier() != nil
+}
+
+// pxeOffers sends a PXE Discover and returns the first offer with an address
+// and, unless that offer is from a PXE server, the first ProxyDHCP offer.
+func (c *Client) pxeOffers(ctx context.Context) (offer, proxy *dhcp4.Packet, err error) {
+	discover, err := c.NewDiscoverPacket()
+	if err != nil {
+		return nil, nil, err
+	}
+	dhcp4opts.SetPXEClientOptions(discover.Options, c.pxeArch, c.pxeUUID)
+
+	ctx, cancel := context.WithCancel(ctx)
+	wg, out, errCh := c.SimpleSendAndRead(ctx, DefaultServers, discover)
+	defer func() {
+		// Explicitly cancel first, then wait.
+		cancel()
+		wg.Wait()
+	}()
+
+	var wait <-chan time.Time
+collect:
+	for {
+		select {
+		case packet, ok := <-out:
+			if !ok {
+				break collect
+			}
+			switch p := packet.Packet; {
+			case validOffer(p):
+				if offer == nil {
+					offer = p
+				}
+			case isProxyOffer(p):
+				if proxy == nil {
+					proxy = p
+				}
+			default:
+				continue
+			}
+			if offer != nil && (isPXE(offer) || proxy != nil) {
+				break collect
+			}
+			if wait == nil {
+				wait = time.After(proxyOfferWait)
+			}
+
+		case <-wait:
+			break collect
+		}
+	}
+
+	switch {
+	case offer != nil && isPXE(offer):
+		return offer, nil, nil
+	case offer != nil && proxy != nil:
+		return offer, proxy, nil
+	case offer != nil:
+		return nil, nil, errors.New("no PXE server answered")
+	}
+	if err, ok := <-errCh; ok && err != nil {
+		return nil, nil, err
+	}
+	return nil, nil, errors.New("no offers received")
+}
+
+// skipsDiscovery returns whether the ProxyDHCP offer p tells the client to
+// download its boot file without boot server discovery.
+func skipsDiscovery(p *dhcp4.Packet) bool {
+	_, sub, err := dhcp4opts.GetVendorInfo(p.Options)
+	if err != nil {
+		return false
+	}
+	dc := sub[dhcp4opts.PXEDiscoveryControl]
+	return len(dc) == 1 && dc[0]&dhcp4opts.PXESkipDiscovery != 0
+}
+
+// bootRequestPacket returns the DHCPREQUEST asking the boot server of the
+// ProxyDHCP offer proxy for the boot file of the first item of its boot menu,
+// or of boot server type 0 if it has none.
+func (c *Client) bootRequestPacket(lease *Lease, proxy *dhcp4.Packet) (*dhcp4.Packet, error) {
+	p := dhcp4.NewPacket(dhcp4.BootRequest)
+	if err := identify(p, c.Identity()); err != nil {
+		return nil, err
+	}
+	p.TransactionID = c.newXID()
+	p.CIAddr = lease.IP
+
+	p.Options.SetMessageType(dhcp4.DHCPRequest)
+	p.Options.Add(dhcp4.OptionMaximumDHCPMessageSize, dhcp4opts.Uint16(c.maxSize))
+	dhcp4opts.SetPXEClientOptions(p.Options, c.pxeArch, c.pxeUUID)
+
+	var item dhcp4opts.PXEItem
+	if _, sub, err := dhcp4opts.GetVendorInfo(proxy.Options); err == nil {
+		if menu, err := dhcp4opts.ParsePXEMenu(sub[dhcp4opts.PXEBootMenu]); err == nil && len(menu) > 0 {
+			item.Type = menu[0].Type
+		}
+	}
+	// Neither can fail.
+	v, _ := item.MarshalBinary()
+	vendor, _ := dhcp4opts.SubOptions{dhcp4opts.PXEBootItem: v}.MarshalBinary()
+	p.Options.SetVendorSpecificInformation(vendor)
+	return p, nil
+}
+
+// pxeBootInfo returns the boot information in p, or nil if there is none.
+//
+// The boot file and TFTP server are found as dhcp4.Packet.BootInfo does;
+// the TFTP server is the server that sent p if it names none.
+func pxeBootInfo(lease *Lease, p *dhcp4.Packet) *PXEBootInfo {
+	bi := p.BootInfo()
+	if bi.BootFile == "" {
+		return nil
+	}
+	server := bi.NextServer
+	if server == nil {
+		server = p.Options.ServerIdentifier()
+	}
+	if server == nil {
+		return nil
+	}
+	return &PXEBootInfo{
+		Lease:      lease,
+		TFTPServer: server,
+		BootFile:   bi.BootFile,
+		Response:   p,
+	}
+}
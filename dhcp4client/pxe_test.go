@@ -0,0 +1,162 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+	"github.com/mergetb/dhcp4/dhcp4opts"
+)
+
+// newProxyOffer returns a ProxyDHCP offer from server sid with the PXE
+// sub-options sub.
+func newProxyOffer(t *testing.T, sid net.IP, sub dhcp4opts.SubOptions) *dhcp4.Packet {
+	p := newLeaseReply(dhcp4.DHCPOffer, sid, nil, 0)
+	if err := dhcp4opts.SetVendorInfo(p.Options, "PXEClient", sub); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// withBoot sets the boot file and next server of p.
+func withBoot(p *dhcp4.Packet, file string, next net.IP) *dhcp4.Packet {
+	p.BootFile = file
+	p.SIAddr = next
+	return p
+}
+
+func TestPXEBoot(t *testing.T) {
+	ip := net.IP{192, 168, 1, 10}
+	tftp := net.IP{192, 168, 0, 9}
+	menu, err := dhcp4opts.PXEMenu{{Type: 0x8000, Description: "Install"}}.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pxeOffer := newLeaseReply(dhcp4.DHCPOffer, serverA, ip, time.Hour)
+	pxeOffer.Options.SetVendorClassIdentifier("PXEClient")
+	withBoot(pxeOffer, "pxelinux.0", tftp)
+
+	for _, tt := range []struct {
+		desc      string
+		responses [][]*dhcp4.Packet
+		want      string
+		tftp      net.IP
+		// bootItem is the boot item requested from the boot server,
+		// if any.
+		bootItem *dhcp4opts.PXEItem
+	}{
+		{
+			desc: "DHCP server is PXE server",
+			responses: [][]*dhcp4.Packet{
+				{pxeOffer},
+				{withBoot(newLeaseReply(dhcp4.DHCPACK, serverA, ip, time.Hour), "pxelinux.0", tftp)},
+			},
+			want: "pxelinux.0",
+			tftp: tftp,
+		},
+		{
+			desc: "boot file only in offer",
+			responses: [][]*dhcp4.Packet{
+				{pxeOffer},
+				{newLeaseReply(dhcp4.DHCPACK, serverA, ip, time.Hour)},
+			},
+			want: "pxelinux.0",
+			tftp: tftp,
+		},
+		{
+			desc: "ProxyDHCP skipping discovery",
+			responses: [][]*dhcp4.Packet{
+				{
+					newLeaseReply(dhcp4.DHCPOffer, serverA, ip, time.Hour),
+					withBoot(newProxyOffer(t, serverB, dhcp4opts.SubOptions{dhcp4opts.PXEDiscoveryControl: {dhcp4opts.PXESkipDiscovery}}), "undionly.kpxe", nil),
+				},
+				{newLeaseReply(dhcp4.DHCPACK, serverA, ip, time.Hour)},
+			},
+			want: "undionly.kpxe",
+			tftp: serverB,
+		},
+		{
+			desc: "ProxyDHCP with boot server",
+			responses: [][]*dhcp4.Packet{
+				{
+					newLeaseReply(dhcp4.DHCPOffer, serverA, ip, time.Hour),
+					newProxyOffer(t, serverB, dhcp4opts.SubOptions{dhcp4opts.PXEBootMenu: menu}),
+				},
+				{newLeaseReply(dhcp4.DHCPACK, serverA, ip, time.Hour)},
+				{withBoot(newLeaseReply(dhcp4.DHCPACK, serverB, nil, 0), "install.efi", tftp)},
+			},
+			want:     "install.efi",
+			tftp:     tftp,
+			bootItem: &dhcp4opts.PXEItem{Type: 0x8000},
+		},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			c, s := serveClient(ctx, t, tt.responses, WithPXEClient(dhcp4.ArchX64UEFI, dhcp4.UUID{1}))
+			defer c.Close()
+
+			info, err := c.PXEBoot(ctx)
+			if err != nil {
+				t.Fatalf("PXEBoot() = %v", err)
+			}
+			if info.BootFile != tt.want || !info.TFTPServer.Equal(tt.tftp) || !info.Lease.IP.Equal(ip) {
+				t.Errorf("PXEBoot() = %v, want %s from %v, address %v", info, tt.want, tt.tftp, ip)
+			}
+
+			discover := s.packets()[0]
+			if got := discover.Options.VendorClassIdentifier(); got != "PXEClient:Arch:00007:UNDI:002001" {
+				t.Errorf("Discover vendor class %q, want PXEClient:Arch:00007:UNDI:002001", got)
+			}
+			if got, ok := discover.Options.ClientMachineID(); !ok || got != (dhcp4.UUID{1}) {
+				t.Errorf("Discover machine ID %v, want %v", got, dhcp4.UUID{1})
+			}
+
+			if tt.bootItem == nil {
+				if len(s.packets()) != 2 {
+					t.Errorf("client sent %d packets, want 2", len(s.packets()))
+				}
+				return
+			}
+			if len(s.packets()) != 3 {
+				t.Fatalf("client sent %d packets, want 3", len(s.packets()))
+			}
+			if dest := s.destinations()[2]; !dest.IP.Equal(serverB) || dest.Port != PXEServerPort {
+				t.Errorf("boot server request sent to %v, want %v:%d", dest, serverB, PXEServerPort)
+			}
+			req := s.packets()[2]
+			_, sub, err := dhcp4opts.GetVendorInfo(req.Options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if item, err := dhcp4opts.ParsePXEItem(sub[dhcp4opts.PXEBootItem]); err != nil || item != *tt.bootItem || !req.CIAddr.Equal(ip) {
+				t.Errorf("boot server request for item %v, %v from %v; want %v from %v", item, err, req.CIAddr, *tt.bootItem, ip)
+			}
+		})
+	}
+}
+
+func TestPXEBootNoPXEServer(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	c, s := serveClient(ctx, t, [][]*dhcp4.Packet{
+		{newLeaseReply(dhcp4.DHCPOffer, serverA, net.IP{192, 168, 1, 10}, time.Hour)},
+	})
+	defer c.Close()
+
+	if info, err := c.PXEBoot(ctx); err == nil {
+		t.Errorf("PXEBoot() = %v, want error", info)
+	}
+	if len(s.packets()) != 1 {
+		t.Errorf("client sent %d packets, want only the Discover", len(s.packets()))
+	}
+}
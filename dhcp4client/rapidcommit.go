@@ -0,0 +1,55 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"time"
+
+	"github.com/mergetb/dhcp4"
+)
+
+// WithRapidCommit makes RequestLease ask for a lease with the two-message
+// exchange of RFC 4039: the DHCPDISCOVER carries the rapid commit option,
+// and servers supporting it answer with a DHCPACK right away rather than
+// with an offer to be requested.
+//
+// The first rapid commit ACK is accepted as soon as it arrives, regardless
+// of WithOfferWait and the offer selector. Offers of servers not supporting
+// rapid commit are requested as usual.
+//
+// Default is the four-message exchange.
+func WithRapidCommit() ClientOpt {
+	return func(c *Client) error {
+		c.rapidCommit = true
+		return nil
+	}
+}
+
+// rapidACK returns whether p is a rapid commit ACK the client may accept in
+// response to its DHCPDISCOVER.
+func (c *Client) rapidACK(p *dhcp4.Packet) bool {
+	return c.rapidCommit &&
+		p.Options.MessageType() == dhcp4.DHCPACK &&
+		p.Options.RapidCommit() &&
+		p.YIAddr != nil && !p.YIAddr.IsUnspecified() &&
+		p.Options.ServerIdentifier() != nil
+}
+
+// rapidLease returns the lease granted by the rapid commit ACK to the
+// DHCPDISCOVER sent at start.
+func (c *Client) rapidLease(ack *dhcp4.Packet, start time.Time) (*Lease, error) {
+	if err := c.naks.observe(time.Now(), ack.YIAddr, ack); err != nil {
+		return nil, err
+	}
+	lease, err := newLease(ack, start)
+	if err != nil {
+		return nil, err
+	}
+	if lease.Duration > 0 {
+		c.metrics.Lease(lease.Duration)
+	}
+	c.saveLease(lease)
+	return lease, nil
+}
@@ -0,0 +1,73 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+)
+
+func TestRapidCommit(t *testing.T) {
+	ip := net.IP{192, 168, 1, 10}
+	rapidACK := newLeaseReply(dhcp4.DHCPACK, serverA, ip, time.Hour)
+	rapidACK.Options.SetRapidCommit(true)
+
+	for _, tt := range []struct {
+		desc      string
+		opts      []ClientOpt
+		responses [][]*dhcp4.Packet
+		wantSent  int
+	}{
+		{
+			desc:      "rapid commit ACK",
+			opts:      []ClientOpt{WithRapidCommit()},
+			responses: [][]*dhcp4.Packet{{rapidACK}},
+			wantSent:  1,
+		},
+		{
+			desc: "server without rapid commit",
+			opts: []ClientOpt{WithRapidCommit()},
+			responses: [][]*dhcp4.Packet{
+				{newLeaseReply(dhcp4.DHCPOffer, serverA, ip, time.Hour)},
+				{newLeaseReply(dhcp4.DHCPACK, serverA, ip, time.Hour)},
+			},
+			wantSent: 2,
+		},
+		{
+			desc: "client without rapid commit",
+			responses: [][]*dhcp4.Packet{
+				{rapidACK, newLeaseReply(dhcp4.DHCPOffer, serverA, ip, time.Hour)},
+				{newLeaseReply(dhcp4.DHCPACK, serverA, ip, time.Hour)},
+			},
+			wantSent: 2,
+		},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			c, s := serveClient(ctx, t, tt.responses, tt.opts...)
+			defer c.Close()
+
+			lease, err := c.RequestLease(ctx)
+			if err != nil {
+				t.Fatalf("Request() = %v", err)
+			}
+			if !lease.IP.Equal(ip) || lease.Duration != time.Hour {
+				t.Errorf("Request() = %v, want %v for 1h", lease, ip)
+			}
+			if len(s.packets()) != tt.wantSent {
+				t.Fatalf("client sent %d messages, want %d", len(s.packets()), tt.wantSent)
+			}
+			if got, want := s.packets()[0].Options.RapidCommit(), len(tt.opts) > 0; got != want {
+				t.Errorf("DHCPDISCOVER rapid commit = %v, want %v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"errors"
+	"net"
+	"syscall"
+	"time"
+)
+
+// RecoveryEvent reports the client replacing its connection after a socket
+// error.
+type RecoveryEvent struct {
+	// Time is when the connection was replaced.
+	Time time.Time
+
+	// Err is the socket error that triggered recovery.
+	Err error
+
+	// ReopenErr is the error opening a new connection, or nil if the
+	// client recovered.
+	ReopenErr error
+}
+
+// WithReopen configures how the client opens a new connection when its
+// connection fails because the interface went down or away, e.g. because it
+// was deleted and recreated.
+//
+// Clients created without WithConn reopen a packet socket on their interface,
+// looking the interface up by name again. Clients created with WithConn do
+// not recover unless configured with WithReopen.
+func WithReopen(reopen func() (net.PacketConn, error)) ClientOpt {
+	return func(c *Client) error {
+		c.reopen = reopen
+		return nil
+	}
+}
+
+// WithRecoveryHandler configures a function called whenever the client
+// replaced, or failed to replace, its connection.
+func WithRecoveryHandler(fn func(RecoveryEvent)) ClientOpt {
+	return func(c *Client) error {
+		c.onRecovery = fn
+		return nil
+	}
+}
+
+// errRecovered is returned by an exchange attempt that failed because of a
+// socket error the client recovered from.
+var errRecovered = errors.New("connection replaced after socket error")
+
+// socketGone returns whether err means that the socket can no longer be used
+// and must be replaced.
+func socketGone(err error) bool {
+	for _, errno := range []syscall.Errno{syscall.ENETDOWN, syscall.ENODEV, syscall.ENXIO} {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	// A connection closed by an earlier failed recovery.
+	return errors.Is(err, net.ErrClosed)
+}
+
+// getConn returns the client's current connection.
+func (c *Client) getConn() net.PacketConn {
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+	return c.conn
+}
+
+// recoverConn replaces conn if err means that it can no longer be used, and
+// returns whether the client has a working connection again.
+func (c *Client) recoverConn(conn net.PacketConn, err error) bool {
+	if c.reopen == nil || !socketGone(err) {
+		return false
+	}
+
+	c.connMu.Lock()
+	if c.closed {
+		c.connMu.Unlock()
+		return false
+	}
+	if c.conn != conn {
+		// Another exchange replaced it already.
+		c.connMu.Unlock()
+		return true
+	}
+	conn.Close()
+	newConn, rerr := c.reopen()
+	if rerr == nil {
+		c.conn = newConn
+	}
+	c.connMu.Unlock()
+
+	if c.onRecovery != nil {
+		c.onRecovery(RecoveryEvent{
+			Time:      time.Now(),
+			Err:       err,
+			ReopenErr: rerr,
+		})
+	}
+	return rerr == nil
+}
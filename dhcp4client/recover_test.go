@@ -0,0 +1,131 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"context"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+)
+
+// goneConn is a connection whose interface went away.
+type goneConn struct {
+	net.PacketConn
+	closed bool
+}
+
+func (g *goneConn) WriteTo(b []byte, dest net.Addr) (int, error) {
+	return 0, &net.OpError{Op: "write", Err: os.NewSyscallError("sendto", syscall.ENETDOWN)}
+}
+
+func (g *goneConn) Close() error {
+	g.closed = true
+	return nil
+}
+
+func TestRequestRecovers(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	in := make(chan udpPacket, 100)
+	out := make(chan udpPacket, 100)
+	gone := &goneConn{}
+	var events []RecoveryEvent
+	c, err := New(nil,
+		WithConn(gone),
+		WithReopen(func() (net.PacketConn, error) {
+			return newMockUDPConn(in, out), nil
+		}),
+		WithRecoveryHandler(func(e RecoveryEvent) {
+			events = append(events, e)
+		}),
+		WithRetry(2),
+		WithTimeout(time.Second),
+		withZeroXID,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	ip := net.IP{192, 168, 1, 10}
+	s := &server{
+		in:  out,
+		out: in,
+		responses: [][]*dhcp4.Packet{
+			{newLeaseReply(dhcp4.DHCPOffer, serverA, ip, time.Hour)},
+			{newLeaseReply(dhcp4.DHCPACK, serverA, ip, time.Hour)},
+		},
+	}
+	go s.serve(ctx)
+
+	lease, err := c.RequestLease(ctx)
+	if err != nil {
+		t.Fatalf("Request() = %v", err)
+	}
+	if !lease.IP.Equal(ip) {
+		t.Errorf("Request() = %v, want %v", lease, ip)
+	}
+	if !gone.closed {
+		t.Errorf("failed connection was not closed")
+	}
+	if len(events) != 1 || events[0].ReopenErr != nil || !socketGone(events[0].Err) {
+		t.Errorf("recovery events = %v, want one successful recovery from ENETDOWN", events)
+	}
+}
+
+func TestRecoverConn(t *testing.T) {
+	enetdown := &net.OpError{Op: "write", Err: os.NewSyscallError("sendto", syscall.ENETDOWN)}
+	for _, tt := range []struct {
+		desc   string
+		reopen func() (net.PacketConn, error)
+		err    error
+		closed bool
+		want   bool
+	}{
+		{
+			desc: "no reopen",
+			err:  enetdown,
+		},
+		{
+			desc:   "other error",
+			reopen: func() (net.PacketConn, error) { return &goneConn{}, nil },
+			err:    syscall.EINVAL,
+		},
+		{
+			desc:   "reopen fails",
+			reopen: func() (net.PacketConn, error) { return nil, syscall.ENODEV },
+			err:    enetdown,
+		},
+		{
+			desc:   "client closed",
+			reopen: func() (net.PacketConn, error) { return &goneConn{}, nil },
+			err:    net.ErrClosed,
+			closed: true,
+		},
+		{
+			desc:   "recovered",
+			reopen: func() (net.PacketConn, error) { return &goneConn{}, nil },
+			err:    enetdown,
+			want:   true,
+		},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			conn := &goneConn{}
+			c := &Client{conn: conn, reopen: tt.reopen, closed: tt.closed}
+			if got := c.recoverConn(conn, tt.err); got != tt.want {
+				t.Errorf("recoverConn(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+			if replaced := c.getConn() != net.PacketConn(conn); replaced != tt.want {
+				t.Errorf("connection replaced = %v, want %v", replaced, tt.want)
+			}
+		})
+	}
+}
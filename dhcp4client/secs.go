@@ -0,0 +1,45 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// startKey is the context key of the time the client began acquiring or
+// renewing an address.
+type startKey struct{}
+
+// withStart returns a copy of ctx recording that the client began
+// acquiring or renewing an address at t. Packets sent with it report the
+// seconds elapsed since t in secs, as RFC 2131 Section 2 describes, so that
+// servers and relays can favor clients that have been waiting long.
+func withStart(ctx context.Context, t time.Time) context.Context {
+	return context.WithValue(ctx, startKey{}, t)
+}
+
+// processStart returns the time recorded by withStart, or now if there is
+// none.
+func processStart(ctx context.Context, now time.Time) time.Time {
+	if t, ok := ctx.Value(startKey{}).(time.Time); ok {
+		return t
+	}
+	return now
+}
+
+// elapsedSecs returns the whole seconds elapsed from start to now as sent in
+// secs, which saturates at its maximum.
+func elapsedSecs(start, now time.Time) uint16 {
+	d := now.Sub(start)
+	if d < 0 {
+		return 0
+	}
+	if s := d / time.Second; s < math.MaxUint16 {
+		return uint16(s)
+	}
+	return math.MaxUint16
+}
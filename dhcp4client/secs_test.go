@@ -0,0 +1,59 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"context"
+	"math"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+)
+
+func TestElapsedSecs(t *testing.T) {
+	start := time.Now()
+	for _, tt := range []struct {
+		d    time.Duration
+		want uint16
+	}{
+		{d: -time.Second, want: 0},
+		{d: 0, want: 0},
+		{d: 1999 * time.Millisecond, want: 1},
+		{d: time.Minute, want: 60},
+		{d: 24 * time.Hour, want: math.MaxUint16},
+	} {
+		if got := elapsedSecs(start, start.Add(tt.d)); got != tt.want {
+			t.Errorf("elapsedSecs() after %v = %d, want %d", tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestRequestSecs(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ip := net.IP{192, 168, 1, 10}
+	c, s := serveClient(ctx, t, [][]*dhcp4.Packet{
+		// The first DISCOVER goes unanswered.
+		{},
+		{newLeaseReply(dhcp4.DHCPOffer, serverA, ip, time.Hour)},
+		{newLeaseReply(dhcp4.DHCPACK, serverA, ip, time.Hour)},
+	}, WithBackoff(FixedBackoff{Wait: 1100 * time.Millisecond, Attempts: 2}))
+	defer c.Close()
+
+	if _, err := c.RequestLease(ctx); err != nil {
+		t.Fatalf("Request() = %v", err)
+	}
+	if len(s.packets()) != 3 {
+		t.Fatalf("server received %d packets, want 2 DISCOVERs and a REQUEST", len(s.packets()))
+	}
+	for i, want := range []uint16{0, 1, 1} {
+		if got := s.packets()[i].Secs; got != want {
+			t.Errorf("%v %d sent with secs %d, want %d", s.packets()[i].Options.MessageType(), i, got, want)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+)
+
+// ClientState is a snapshot of the runtime state of a client, see
+// Client.DumpState.
+type ClientState struct {
+	Time         time.Time `json:"time"`
+	Interface    string    `json:"interface,omitempty"`
+	HardwareAddr string    `json:"hardware_addr,omitempty"`
+	ClientID     string    `json:"client_id,omitempty"`
+
+	// ConnOpen is whether the client has a connection, and Closed whether
+	// Close was called.
+	ConnOpen bool `json:"conn_open"`
+	Closed   bool `json:"closed"`
+
+	Backoff string `json:"backoff"`
+
+	DroppedResponses uint64 `json:"dropped_responses"`
+
+	// Exchanges are the packets sent whose responses are being read, the
+	// oldest first.
+	Exchanges []ExchangeState `json:"exchanges"`
+
+	// NAK is the state of the NAK hold-off, or nil if the last response
+	// was not a NAK.
+	NAK *NAKState `json:"nak,omitempty"`
+
+	// Leases are the leases kept alive by Maintain.
+	Leases []MaintainState `json:"leases"`
+}
+
+// ExchangeState describes a packet sent whose responses are being read.
+type ExchangeState struct {
+	XID         string    `json:"xid"`
+	MessageType string    `json:"message_type"`
+	Dest        string    `json:"dest"`
+	Start       time.Time `json:"start"`
+
+	// Attempt is the number of the current transmission, starting at 1,
+	// and AttemptStart when it was sent.
+	Attempt      int       `json:"attempt"`
+	AttemptStart time.Time `json:"attempt_start"`
+}
+
+// NAKState describes consecutive NAKs for the same address.
+type NAKState struct {
+	IP    string `json:"ip"`
+	Count int    `json:"count"`
+
+	// HoldOffUntil is when the next RequestLease may be sent.
+	HoldOffUntil time.Time `json:"hold_off_until"`
+}
+
+// Maintain phases, the values of MaintainState.Phase.
+const (
+	// PhaseBound waits for T1.
+	PhaseBound = "bound"
+
+	// PhaseRenewing renews the lease with its server until T2.
+	PhaseRenewing = "renewing"
+
+	// PhaseRebinding rebinds the lease with any server until it expires.
+	PhaseRebinding = "rebinding"
+
+	// PhaseInit acquires a new lease after the lease was NAKed, see
+	// WithNAKRestart.
+	PhaseInit = "init"
+)
+
+// MaintainState describes a lease kept alive by Maintain.
+type MaintainState struct {
+	IP       string `json:"ip"`
+	ServerID string `json:"server_id"`
+
+	Phase string `json:"phase"`
+
+	T1     time.Time `json:"t1"`
+	T2     time.Time `json:"t2"`
+	Expiry time.Time `json:"expiry"`
+
+	// Next is when the next renewal or rebinding is sent, if Maintain is
+	// waiting.
+	Next time.Time `json:"next"`
+}
+
+// stateTracker tracks the exchanges and maintained leases of a client for
+// DumpState.
+type stateTracker struct {
+	mu        sync.Mutex
+	exchanges map[*ExchangeState]struct{}
+	leases    map[*MaintainState]struct{}
+}
+
+// startExchange records that p is sent to dest.
+func (st *stateTracker) startExchange(dest net.Addr, p *dhcp4.Packet) *ExchangeState {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	ex := &ExchangeState{
+		XID:         fmt.Sprintf("%x", p.TransactionID),
+		MessageType: p.Options.MessageType().String(),
+		Dest:        dest.String(),
+		Start:       time.Now(),
+	}
+	if st.exchanges == nil {
+		st.exchanges = make(map[*ExchangeState]struct{})
+	}
+	st.exchanges[ex] = struct{}{}
+	return ex
+}
+
+// attempt records that ex is transmitted again.
+func (st *stateTracker) attempt(ex *ExchangeState) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	ex.Attempt++
+	ex.AttemptStart = time.Now()
+}
+
+func (st *stateTracker) endExchange(ex *ExchangeState) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	delete(st.exchanges, ex)
+}
+
+// maintain records that Maintain keeps a lease alive.
+func (st *stateTracker) maintain() *MaintainState {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	m := &MaintainState{}
+	if st.leases == nil {
+		st.leases = make(map[*MaintainState]struct{})
+	}
+	st.leases[m] = struct{}{}
+	return m
+}
+
+// update sets the state of the maintained lease m.
+func (st *stateTracker) update(m *MaintainState, fn func(m *MaintainState)) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	fn(m)
+}
+
+func (st *stateTracker) endMaintain(m *MaintainState) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	delete(st.leases, m)
+}
+
+// DumpState returns a snapshot of the runtime state of c, for debugging a
+// live client.
+func (c *Client) DumpState() *ClientState {
+	cs := &ClientState{
+		Time:             time.Now(),
+		Backoff:          fmt.Sprintf("%+v", c.backoff),
+		DroppedResponses: atomic.LoadUint64(&c.dropped),
+		Exchanges:        []ExchangeState{},
+		Leases:           []MaintainState{},
+	}
+	if c.iface != nil {
+		cs.Interface = c.iface.Attrs().Name
+	}
+	id := c.Identity()
+	if id.HardwareAddr != nil {
+		cs.HardwareAddr = id.HardwareAddr.String()
+	}
+	if len(id.ClientID) > 0 {
+		cs.ClientID = fmt.Sprintf("%x", id.ClientID)
+	}
+
+	c.connMu.Lock()
+	cs.ConnOpen = c.conn != nil
+	cs.Closed = c.closed
+	c.connMu.Unlock()
+
+	c.naks.mu.Lock()
+	if c.naks.count > 0 {
+		cs.NAK = &NAKState{
+			IP:           c.naks.ip.String(),
+			Count:        c.naks.count,
+			HoldOffUntil: c.naks.until,
+		}
+	}
+	c.naks.mu.Unlock()
+
+	c.state.mu.Lock()
+	for ex := range c.state.exchanges {
+		cs.Exchanges = append(cs.Exchanges, *ex)
+	}
+	for m := range c.state.leases {
+		cs.Leases = append(cs.Leases, *m)
+	}
+	c.state.mu.Unlock()
+	sort.Slice(cs.Exchanges, func(i, j int) bool { return cs.Exchanges[i].Start.Before(cs.Exchanges[j].Start) })
+	sort.Slice(cs.Leases, func(i, j int) bool { return cs.Leases[i].IP < cs.Leases[j].IP })
+	return cs
+}
+
+// WriteState writes the runtime state of c, see DumpState, to w as indented
+// JSON.
+func (c *Client) WriteState(w io.Writer) error {
+	b, err := json.MarshalIndent(c.DumpState(), "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
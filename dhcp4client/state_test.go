@@ -0,0 +1,74 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+)
+
+// waitState waits until DumpState of c satisfies ok and returns it.
+func waitState(t *testing.T, c *Client, ok func(*ClientState) bool) *ClientState {
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		st := c.DumpState()
+		if ok(st) {
+			return st
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("DumpState() = %+v, never reached the wanted state", st)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDumpState(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// The server never answers the renewal.
+	c, _ := serveClient(ctx, t, [][]*dhcp4.Packet{{}})
+	defer c.Close()
+
+	st := c.DumpState()
+	if len(st.Exchanges) != 0 || len(st.Leases) != 0 || st.NAK != nil {
+		t.Errorf("DumpState() of idle client = %+v, want nothing going on", st)
+	}
+
+	ip := net.IP{192, 168, 1, 10}
+	lease := &Lease{
+		IP:            ip,
+		ServerID:      serverA,
+		Start:         time.Now(),
+		Duration:      time.Hour,
+		RenewalTime:   200 * time.Millisecond,
+		RebindingTime: 30 * time.Minute,
+	}
+	mctx, mcancel := context.WithCancel(ctx)
+	events := c.Maintain(mctx, lease)
+
+	st = waitState(t, c, func(st *ClientState) bool { return len(st.Leases) == 1 })
+	m := st.Leases[0]
+	if m.IP != ip.String() || m.Phase != PhaseBound || !m.Next.Equal(lease.Start.Add(lease.RenewalTime)) {
+		t.Errorf("DumpState().Leases[0] = %+v, want %v bound until T1", m, ip)
+	}
+
+	st = waitState(t, c, func(st *ClientState) bool { return len(st.Exchanges) == 1 })
+	if ex := st.Exchanges[0]; ex.MessageType != "DHCPREQUEST" || ex.Dest != (&net.UDPAddr{IP: serverA, Port: ServerPort}).String() || ex.Attempt != 1 {
+		t.Errorf("DumpState().Exchanges[0] = %+v, want renewal sent to %v", ex, serverA)
+	}
+	if m := st.Leases[0]; m.Phase != PhaseRenewing {
+		t.Errorf("DumpState().Leases[0].Phase = %q, want %q", m.Phase, PhaseRenewing)
+	}
+
+	mcancel()
+	for range events {
+	}
+	waitState(t, c, func(st *ClientState) bool { return len(st.Exchanges) == 0 && len(st.Leases) == 0 })
+}
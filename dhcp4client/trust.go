@@ -0,0 +1,138 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+)
+
+// WithTrustedServers configures the client to discard responses, such as
+// offers, ACKs and NAKs, of servers other than servers, to protect it from
+// rogue servers on shared networks. servers are server identifiers, e.g.
+// "192.168.0.1", or networks in CIDR notation, e.g. "192.168.0.0/24".
+//
+// A response is trusted if its server identifier (option 54), if any, and
+// the unicast address it was sent from, if known, are trusted. Responses forwarded by relay
+// agents are sent from the agent's address, which must be trusted too.
+// Discarded responses are reported to the Logger with RejectUntrusted.
+//
+// Default is trusting every server.
+func WithTrustedServers(servers ...string) ClientOpt {
+	return func(c *Client) error {
+		trusted := make([]*net.IPNet, 0, len(servers))
+		for _, s := range servers {
+			n, err := parseTrusted(s)
+			if err != nil {
+				return err
+			}
+			trusted = append(trusted, n)
+		}
+		c.trusted = trusted
+		return nil
+	}
+}
+
+// RogueServer is a response of a server that is not trusted, see
+// WithRogueServerMonitor.
+type RogueServer struct {
+	// ServerID is the server identifier of the response, or nil if it
+	// has none.
+	ServerID net.IP
+
+	// Source is the address the response was sent from.
+	Source net.Addr
+
+	// Time is when the response was received.
+	Time time.Time
+
+	// Packet is the response.
+	Packet *dhcp4.Packet
+}
+
+// String implements fmt.Stringer.
+func (r RogueServer) String() string {
+	return fmt.Sprintf("untrusted server %v (from %v): %s", r.ServerID, r.Source, summarize(r.Packet))
+}
+
+// WithRogueServerMonitor configures the client to report every response of
+// a server that WithTrustedServers does not trust to report, instead of
+// discarding it, e.g. to find rogue servers on a network before enforcing
+// the trusted servers.
+//
+// report is called synchronously, and must not block.
+func WithRogueServerMonitor(report func(RogueServer)) ClientOpt {
+	return func(c *Client) error {
+		c.rogue = report
+		return nil
+	}
+}
+
+// parseTrusted parses a server identifier or a network in CIDR notation.
+func parseTrusted(s string) (*net.IPNet, error) {
+	if strings.Contains(s, "/") {
+		_, n, err := net.ParseCIDR(s)
+		if err != nil || n.IP.To4() == nil {
+			return nil, fmt.Errorf("invalid trusted server network %q", s)
+		}
+		return n, nil
+	}
+	ip := net.ParseIP(s).To4()
+	if ip == nil {
+		return nil, fmt.Errorf("invalid trusted server %q", s)
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(32, 32)}, nil
+}
+
+// trustedServer returns whether the client trusts the server of pkt, sent
+// from source.
+func (c *Client) trustedServer(pkt *dhcp4.Packet, source net.Addr) bool {
+	if c.trusted == nil {
+		return true
+	}
+	if sid := pkt.Options.ServerIdentifier(); sid != nil && !c.trustedAddr(sid) {
+		return false
+	}
+	if a := udpAddr(source); a != nil && isUnicast(a.IP) && !c.trustedAddr(a.IP) {
+		return false
+	}
+	return true
+}
+
+// isUnicast returns whether ip is a unicast address.
+func isUnicast(ip net.IP) bool {
+	return !ip.IsUnspecified() && !ip.Equal(net.IPv4bcast) && !ip.IsMulticast()
+}
+
+func (c *Client) trustedAddr(ip net.IP) bool {
+	for _, n := range c.trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkServer returns whether to accept pkt, received from source at t,
+// given the trusted servers, reporting it if it is from a rogue server.
+func (c *Client) checkServer(pkt *dhcp4.Packet, source net.Addr, t time.Time) bool {
+	if c.trustedServer(pkt, source) {
+		return true
+	}
+	if c.rogue == nil {
+		return false
+	}
+	c.rogue(RogueServer{
+		ServerID: pkt.Options.ServerIdentifier(),
+		Source:   source,
+		Time:     t,
+		Packet:   pkt,
+	})
+	return true
+}
@@ -0,0 +1,118 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+)
+
+func TestTrustedServers(t *testing.T) {
+	ip := net.IP{192, 168, 1, 10}
+	for _, tt := range []struct {
+		name    string
+		trusted []string
+		want    net.IP
+	}{
+		{name: "server identifier", trusted: []string{"192.168.0.1"}, want: serverA},
+		{name: "network", trusted: []string{"10.0.0.0/8", "192.168.0.2/31"}, want: serverB},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			l := &eventLog{}
+			c, _ := serveClient(ctx, t, [][]*dhcp4.Packet{
+				{newLeaseReply(dhcp4.DHCPOffer, serverA, ip, time.Hour), newLeaseReply(dhcp4.DHCPOffer, serverB, ip, time.Hour)},
+				{},
+			}, WithLogger(l), WithTrustedServers(tt.trusted...), WithTimeout(100*time.Millisecond))
+			defer c.Close()
+
+			offers := c.DiscoverOffers(ctx)
+			defer offers.Close()
+			got, err := offers.Wait(ctx, 2)
+			if err != nil || len(got) != 1 || !got[0].ServerID().Equal(tt.want) {
+				t.Fatalf("Wait(2) = %v, %v; want the offer of %v", got, err, tt.want)
+			}
+
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			var untrusted int
+			for _, e := range l.events {
+				if e.Kind == PacketDiscarded && e.Reason == RejectUntrusted {
+					untrusted++
+				}
+			}
+			if untrusted != 1 {
+				t.Errorf("discarded %d untrusted offers, want 1", untrusted)
+			}
+		})
+	}
+}
+
+func TestRogueServerMonitor(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ip := net.IP{192, 168, 1, 10}
+	var (
+		mu     sync.Mutex
+		rogues []RogueServer
+	)
+	c, _ := serveClient(ctx, t, [][]*dhcp4.Packet{
+		{newLeaseReply(dhcp4.DHCPOffer, serverA, ip, time.Hour), newLeaseReply(dhcp4.DHCPOffer, serverB, ip, time.Hour)},
+		{},
+	}, WithTrustedServers("192.168.0.1"), WithRogueServerMonitor(func(r RogueServer) {
+		mu.Lock()
+		defer mu.Unlock()
+		rogues = append(rogues, r)
+	}), WithTimeout(100*time.Millisecond))
+	defer c.Close()
+
+	offers := c.DiscoverOffers(ctx)
+	defer offers.Close()
+	if got, err := offers.Wait(ctx, 2); err != nil || len(got) != 2 {
+		t.Fatalf("Wait(2) = %v, %v; want both offers", got, err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(rogues) != 1 || !rogues[0].ServerID.Equal(serverB) {
+		t.Errorf("reported %v, want %v", rogues, serverB)
+	}
+}
+
+func TestWithTrustedServersInvalid(t *testing.T) {
+	for _, s := range []string{"", "server", "192.168.0.0/33", "2001:db8::1", "2001:db8::/32"} {
+		if _, err := New(nil, WithConn(newMockUDPConn(nil, nil)), WithTrustedServers(s)); err == nil {
+			t.Errorf("WithTrustedServers(%q) succeeded", s)
+		}
+	}
+}
+
+func TestTrustedServerSource(t *testing.T) {
+	c := &Client{}
+	if err := WithTrustedServers("192.168.0.0/24")(c); err != nil {
+		t.Fatal(err)
+	}
+	offer := newLeaseReply(dhcp4.DHCPOffer, serverA, net.IP{192, 168, 1, 10}, time.Hour)
+	for _, tt := range []struct {
+		source net.IP
+		want   bool
+	}{
+		{source: serverA, want: true},
+		{source: net.IPv4bcast, want: true},
+		{source: net.IP{192, 168, 1, 1}, want: false},
+	} {
+		if got := c.trustedServer(offer, &net.UDPAddr{IP: tt.source, Port: ServerPort}); got != tt.want {
+			t.Errorf("trustedServer(from %v) = %v, want %v", tt.source, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"sync/atomic"
+	"time"
+)
+
+// XIDGenerator returns the transaction IDs of new exchanges. It must be safe
+// for concurrent use.
+type XIDGenerator func() [4]byte
+
+// RandomXID returns a random transaction ID, as RFC 2131 Section 4.1 asks
+// clients to choose them. If the system's secure random number generator
+// fails, it falls back to the current time.
+func RandomXID() [4]byte {
+	var xid [4]byte
+	if _, err := rand.Read(xid[:]); err != nil {
+		binary.BigEndian.PutUint32(xid[:], uint32(time.Now().UnixNano()))
+	}
+	return xid
+}
+
+// SequentialXID returns a generator counting up from first, which makes
+// captures of load tests easy to follow. Clients sharing a network must not
+// use the same sequence.
+func SequentialXID(first uint32) XIDGenerator {
+	next := first - 1
+	return func() [4]byte {
+		var xid [4]byte
+		binary.BigEndian.PutUint32(xid[:], atomic.AddUint32(&next, 1))
+		return xid
+	}
+}
+
+// WithXIDGenerator configures how transaction IDs are chosen.
+//
+// Default is RandomXID.
+func WithXIDGenerator(g XIDGenerator) ClientOpt {
+	return func(c *Client) error {
+		c.xid = g
+		return nil
+	}
+}
+
+// newXID returns the transaction ID of a new exchange.
+func (c *Client) newXID() [4]byte {
+	return c.xid()
+}
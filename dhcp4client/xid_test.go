@@ -0,0 +1,102 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+)
+
+func TestRandomXID(t *testing.T) {
+	seen := make(map[[4]byte]bool)
+	for i := 0; i < 10; i++ {
+		seen[RandomXID()] = true
+	}
+	if len(seen) < 2 {
+		t.Errorf("RandomXID() returned %d different IDs in 10 calls", len(seen))
+	}
+}
+
+func TestSequentialXID(t *testing.T) {
+	g := SequentialXID(0xfffffffe)
+	for _, want := range [][4]byte{{0xff, 0xff, 0xff, 0xfe}, {0xff, 0xff, 0xff, 0xff}, {0, 0, 0, 0}} {
+		if got := g(); got != want {
+			t.Errorf("SequentialXID() = %x, want %x", got, want)
+		}
+	}
+}
+
+// TestConcurrentExchanges renews a lease and informs at the same time on
+// one connection, with the server answering in reverse order.
+func TestConcurrentExchanges(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	in := make(chan udpPacket, 100)
+	out := make(chan udpPacket, 100)
+	c, err := New(nil, WithConn(newMockUDPConn(in, out)), WithRetry(1), WithTimeout(2*time.Second), WithXIDGenerator(SequentialXID(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	ip := net.IP{192, 168, 1, 10}
+	go func() {
+		var requests []*dhcp4.Packet
+		for len(requests) < 2 {
+			select {
+			case u := <-out:
+				var p dhcp4.Packet
+				if err := p.UnmarshalBinary(u.payload); err != nil {
+					t.Error(err)
+					return
+				}
+				requests = append(requests, &p)
+			case <-ctx.Done():
+				return
+			}
+		}
+		for i := len(requests) - 1; i >= 0; i-- {
+			ack := newLeaseReply(dhcp4.DHCPACK, serverA, ip, time.Hour)
+			ack.TransactionID = requests[i].TransactionID
+			// Tell the replies apart by the exchange they answer.
+			ack.Options.SetHostName(requests[i].Options.MessageType().String())
+			b, err := ack.MarshalBinary()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			in <- udpPacket{source: &net.UDPAddr{IP: serverA, Port: ServerPort}, payload: b}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	var lease *Lease
+	var renewErr error
+	go func() {
+		defer wg.Done()
+		lease, renewErr = c.RenewLease(ctx, shortLease(ip))
+	}()
+	var options dhcp4.Options
+	var informErr error
+	go func() {
+		defer wg.Done()
+		options, informErr = c.inform(ctx, ip)
+	}()
+	wg.Wait()
+
+	if renewErr != nil || lease.Options.HostName() != dhcp4.DHCPRequest.String() {
+		t.Errorf("Renew() = %v, %v, want the ACK of the REQUEST", lease, renewErr)
+	}
+	if informErr != nil || options.HostName() != dhcp4.DHCPInform.String() {
+		t.Errorf("inform() = %v, %v, want the ACK of the INFORM", options, informErr)
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package dhcp4metrics defines the metrics reported by the DHCP client,
+// server and relay agents, and a Registry exposing them in the Prometheus
+// text format.
+//
+// A client or server reports to a Metrics configured with its WithMetrics
+// option:
+//
+//	r := dhcp4metrics.NewRegistry("dhcp_client")
+//	http.Handle("/metrics", r)
+//	c, err := dhcp4client.New(link, dhcp4client.WithMetrics(r))
+package dhcp4metrics
+
+import (
+	"net"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+)
+
+// Metrics receives the measurements of a DHCP client, server or relay agent.
+//
+// Implementations usually wrap a metrics library. Methods may be called
+// concurrently and must not block.
+type Metrics interface {
+	// MessageSent counts a message of type typ sent, including
+	// retransmissions.
+	MessageSent(typ dhcp4.MessageType)
+
+	// MessageReceived counts a message of type typ received. Clients
+	// count only responses to their requests.
+	MessageReceived(typ dhcp4.MessageType)
+
+	// Retransmission counts a message of type typ sent again because no
+	// response arrived in time.
+	Retransmission(typ dhcp4.MessageType)
+
+	// Lease observes the duration of a lease granted by a server or
+	// acquired, renewed or rebound by a client. Leases that never expire
+	// are not observed.
+	Lease(d time.Duration)
+
+	// TimeToLease observes how long a client took to get a lease, from
+	// its first DISCOVER until it acquired the lease or, if it configures
+	// its interface, until the interface was configured. Servers do not
+	// report it.
+	TimeToLease(d time.Duration)
+
+	// RelayForwarded counts a message of op code op forwarded by a relay
+	// agent between clients on the interface iface and the server at
+	// server. Clients and servers do not report it.
+	RelayForwarded(iface string, server net.IP, op dhcp4.OpCode)
+
+	// RelayDropped counts a message a relay agent dropped for reason,
+	// received from a client on the interface iface or from the server
+	// at server. server is nil for requests dropped before they were
+	// forwarded. Clients and servers do not report it.
+	RelayDropped(iface string, server net.IP, reason RelayDrop)
+}
+
+// RelayDrop is why a relay agent dropped a message.
+type RelayDrop string
+
+// Reasons for relay agents to drop messages.
+const (
+	// RelayHopLimit is reported for requests that passed through
+	// dhcp4.MaxHops relay agents already.
+	RelayHopLimit RelayDrop = "hop_limit"
+
+	// RelayAgentInfoPolicy is reported for requests whose relay agent
+	// information option the relay agent's policy rejects, e.g. one sent
+	// by a client on an untrusted circuit, see RFC 3046 Section 2.1.
+	RelayAgentInfoPolicy RelayDrop = "relay_agent_info"
+
+	// RelayReplyMismatch is reported for replies not meant for the relay
+	// agent, e.g. with another giaddr or from an unknown server.
+	RelayReplyMismatch RelayDrop = "reply_mismatch"
+)
+
+type discard struct{}
+
+func (discard) MessageSent(dhcp4.MessageType)     {}
+func (discard) MessageReceived(dhcp4.MessageType) {}
+func (discard) Retransmission(dhcp4.MessageType)  {}
+func (discard) Lease(time.Duration)               {}
+func (discard) TimeToLease(time.Duration)         {}
+
+func (discard) RelayForwarded(string, net.IP, dhcp4.OpCode) {}
+func (discard) RelayDropped(string, net.IP, RelayDrop)      {}
+
+// Discard is a Metrics that drops all measurements.
+var Discard Metrics = discard{}
@@ -0,0 +1,274 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+)
+
+// DefaultLeaseBuckets are the upper bounds in seconds of the lease duration
+// histogram buckets of NewRegistry: a minute, 10 minutes, an hour, 12 hours,
+// a day and a week.
+var DefaultLeaseBuckets = []float64{60, 600, 3600, 43200, 86400, 604800}
+
+// TimeToLeaseBuckets are the upper bounds in seconds of the time to lease
+// histogram buckets of a Registry.
+var TimeToLeaseBuckets = []float64{0.1, 0.5, 1, 2, 5, 10, 30, 60, 120, 300}
+
+// histogram counts observations in buckets with upper bounds.
+type histogram struct {
+	bounds []float64
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	bounds = append([]float64(nil), bounds...)
+	sort.Float64s(bounds)
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds))}
+}
+
+func (h *histogram) observe(v float64) {
+	for i, le := range h.bounds {
+		if v <= le {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+// write writes the histogram as the metric name.
+func (h *histogram) write(b *bytes.Buffer, name, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(b, "# TYPE %s histogram\n", name)
+	for i, le := range h.bounds {
+		fmt.Fprintf(b, "%s_bucket{le=%q} %d\n", name, formatFloat(le), h.counts[i])
+	}
+	fmt.Fprintf(b, "%s_bucket{le=\"+Inf\"} %d\n", name, h.count)
+	fmt.Fprintf(b, "%s_sum %s\n", name, formatFloat(h.sum))
+	fmt.Fprintf(b, "%s_count %d\n", name, h.count)
+}
+
+// Registry is a Metrics keeping counters and histograms of lease durations
+// and times to lease in memory, and serving them over HTTP in the
+// Prometheus text exposition format.
+//
+// The counters start at zero whenever a program creates its Registry, e.g.
+// when a server restarts. The start_time_seconds gauge tells when they
+// started, so that rates are computed correctly across restarts and Reset.
+type Registry struct {
+	namespace string
+
+	mu              sync.Mutex
+	start           time.Time
+	sent            map[dhcp4.MessageType]uint64
+	received        map[dhcp4.MessageType]uint64
+	retransmissions map[dhcp4.MessageType]uint64
+	leases          *histogram
+	timeToLease     *histogram
+	relayForwarded  map[relayKey]uint64
+	relayDropped    map[relayKey]uint64
+}
+
+// relayKey are the labels of a relay agent counter: the client interface,
+// the server, and the op code or drop reason.
+type relayKey struct {
+	iface, server, label string
+}
+
+func newRelayKey(iface string, server net.IP, label string) relayKey {
+	k := relayKey{iface: iface, label: label}
+	if server != nil {
+		k.server = server.String()
+	}
+	return k
+}
+
+var _ Metrics = &Registry{}
+
+// NewRegistry returns a Registry whose metric names start with namespace,
+// e.g. "dhcp_client", and whose lease duration histogram has buckets, or
+// DefaultLeaseBuckets if none are given. Buckets are upper bounds in
+// seconds.
+func NewRegistry(namespace string, buckets ...float64) *Registry {
+	if len(buckets) == 0 {
+		buckets = DefaultLeaseBuckets
+	}
+	return &Registry{
+		namespace:       namespace,
+		start:           time.Now(),
+		sent:            make(map[dhcp4.MessageType]uint64),
+		received:        make(map[dhcp4.MessageType]uint64),
+		retransmissions: make(map[dhcp4.MessageType]uint64),
+		leases:          newHistogram(buckets),
+		timeToLease:     newHistogram(TimeToLeaseBuckets),
+		relayForwarded:  make(map[relayKey]uint64),
+		relayDropped:    make(map[relayKey]uint64),
+	}
+}
+
+// Reset sets all counters and histograms back to zero and the start time to
+// now.
+func (r *Registry) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fresh := NewRegistry(r.namespace, r.leases.bounds...)
+	r.start = fresh.start
+	r.sent = fresh.sent
+	r.received = fresh.received
+	r.retransmissions = fresh.retransmissions
+	r.leases = fresh.leases
+	r.timeToLease = fresh.timeToLease
+	r.relayForwarded = fresh.relayForwarded
+	r.relayDropped = fresh.relayDropped
+}
+
+// MessageSent implements Metrics.
+func (r *Registry) MessageSent(typ dhcp4.MessageType) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sent[typ]++
+}
+
+// MessageReceived implements Metrics.
+func (r *Registry) MessageReceived(typ dhcp4.MessageType) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.received[typ]++
+}
+
+// Retransmission implements Metrics.
+func (r *Registry) Retransmission(typ dhcp4.MessageType) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.retransmissions[typ]++
+}
+
+// Lease implements Metrics.
+func (r *Registry) Lease(d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.leases.observe(d.Seconds())
+}
+
+// TimeToLease implements Metrics.
+func (r *Registry) TimeToLease(d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.timeToLease.observe(d.Seconds())
+}
+
+// RelayForwarded implements Metrics.
+func (r *Registry) RelayForwarded(iface string, server net.IP, op dhcp4.OpCode) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.relayForwarded[newRelayKey(iface, server, op.String())]++
+}
+
+// RelayDropped implements Metrics.
+func (r *Registry) RelayDropped(iface string, server net.IP, reason RelayDrop) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.relayDropped[newRelayKey(iface, server, string(reason))]++
+}
+
+// WriteTo writes the metrics to w in the Prometheus text exposition format,
+// version 0.0.4.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	var b bytes.Buffer
+	start := r.name("start_time_seconds")
+	fmt.Fprintf(&b, "# HELP %s Time the counters started at, in seconds since the Unix epoch.\n", start)
+	fmt.Fprintf(&b, "# TYPE %s gauge\n", start)
+	fmt.Fprintf(&b, "%s %s\n", start, formatFloat(float64(r.start.UnixNano())/1e9))
+	r.writeCounter(&b, "messages_sent_total", "DHCP messages sent, by type.", r.sent)
+	r.writeCounter(&b, "messages_received_total", "DHCP messages received, by type.", r.received)
+	r.writeCounter(&b, "retransmissions_total", "DHCP messages retransmitted, by type.", r.retransmissions)
+
+	r.leases.write(&b, r.name("lease_duration_seconds"), "Durations of leases granted or acquired.")
+	r.timeToLease.write(&b, r.name("time_to_lease_seconds"), "Times from the first DISCOVER until a lease was acquired and configured.")
+	r.writeRelayCounter(&b, "relay_forwarded_total", "DHCP messages forwarded by the relay agent, by client interface, server and op code.", "op", r.relayForwarded)
+	r.writeRelayCounter(&b, "relay_dropped_total", "DHCP messages dropped by the relay agent, by client interface, server and reason.", "reason", r.relayDropped)
+	r.mu.Unlock()
+
+	return b.WriteTo(w)
+}
+
+// ServeHTTP implements http.Handler, serving the metrics for Prometheus to
+// scrape.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.WriteTo(w)
+}
+
+// name returns the full name of metric.
+func (r *Registry) name(metric string) string {
+	if r.namespace == "" {
+		return metric
+	}
+	return r.namespace + "_" + metric
+}
+
+// writeCounter writes the counter metric with a sample for every message
+// type, sorted by type.
+func (r *Registry) writeCounter(b *bytes.Buffer, metric, help string, counts map[dhcp4.MessageType]uint64) {
+	name := r.name(metric)
+	fmt.Fprintf(b, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(b, "# TYPE %s counter\n", name)
+	types := make([]int, 0, len(counts))
+	for typ := range counts {
+		types = append(types, int(typ))
+	}
+	sort.Ints(types)
+	for _, typ := range types {
+		fmt.Fprintf(b, "%s{type=%q} %d\n", name, dhcp4.MessageType(typ), counts[dhcp4.MessageType(typ)])
+	}
+}
+
+// writeRelayCounter writes the relay agent counter metric with a sample for
+// every interface, server and label, the latter named label, sorted.
+func (r *Registry) writeRelayCounter(b *bytes.Buffer, metric, help, label string, counts map[relayKey]uint64) {
+	name := r.name(metric)
+	fmt.Fprintf(b, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(b, "# TYPE %s counter\n", name)
+	keys := make([]relayKey, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		x, y := keys[i], keys[j]
+		if x.iface != y.iface {
+			return x.iface < y.iface
+		}
+		if x.server != y.server {
+			return x.server < y.server
+		}
+		return x.label < y.label
+	})
+	for _, k := range keys {
+		fmt.Fprintf(b, "%s{interface=%q,server=%q,%s=%q} %d\n", name, k.iface, k.server, label, k.label, counts[k])
+	}
+}
+
+// formatFloat formats f as Prometheus does.
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
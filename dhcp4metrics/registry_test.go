@@ -0,0 +1,158 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4metrics
+
+import (
+	"bytes"
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry("dhcp_client", 3600, 60)
+	r.start = time.Unix(1500000000, 500000000)
+	r.MessageSent(dhcp4.DHCPRequest)
+	r.MessageSent(dhcp4.DHCPDiscover)
+	r.MessageSent(dhcp4.DHCPDiscover)
+	r.Retransmission(dhcp4.DHCPDiscover)
+	r.MessageReceived(dhcp4.DHCPOffer)
+	r.MessageReceived(dhcp4.DHCPNAK)
+	r.Lease(30 * time.Second)
+	r.Lease(2 * time.Hour)
+	r.TimeToLease(1500 * time.Millisecond)
+
+	want := `# HELP dhcp_client_start_time_seconds Time the counters started at, in seconds since the Unix epoch.
+# TYPE dhcp_client_start_time_seconds gauge
+dhcp_client_start_time_seconds 1.5000000005e+09
+# HELP dhcp_client_messages_sent_total DHCP messages sent, by type.
+# TYPE dhcp_client_messages_sent_total counter
+dhcp_client_messages_sent_total{type="DHCPDISCOVER"} 2
+dhcp_client_messages_sent_total{type="DHCPREQUEST"} 1
+# HELP dhcp_client_messages_received_total DHCP messages received, by type.
+# TYPE dhcp_client_messages_received_total counter
+dhcp_client_messages_received_total{type="DHCPOFFER"} 1
+dhcp_client_messages_received_total{type="DHCPNAK"} 1
+# HELP dhcp_client_retransmissions_total DHCP messages retransmitted, by type.
+# TYPE dhcp_client_retransmissions_total counter
+dhcp_client_retransmissions_total{type="DHCPDISCOVER"} 1
+# HELP dhcp_client_lease_duration_seconds Durations of leases granted or acquired.
+# TYPE dhcp_client_lease_duration_seconds histogram
+dhcp_client_lease_duration_seconds_bucket{le="60"} 1
+dhcp_client_lease_duration_seconds_bucket{le="3600"} 1
+dhcp_client_lease_duration_seconds_bucket{le="+Inf"} 2
+dhcp_client_lease_duration_seconds_sum 7230
+dhcp_client_lease_duration_seconds_count 2
+# HELP dhcp_client_time_to_lease_seconds Times from the first DISCOVER until a lease was acquired and configured.
+# TYPE dhcp_client_time_to_lease_seconds histogram
+dhcp_client_time_to_lease_seconds_bucket{le="0.1"} 0
+dhcp_client_time_to_lease_seconds_bucket{le="0.5"} 0
+dhcp_client_time_to_lease_seconds_bucket{le="1"} 0
+dhcp_client_time_to_lease_seconds_bucket{le="2"} 1
+dhcp_client_time_to_lease_seconds_bucket{le="5"} 1
+dhcp_client_time_to_lease_seconds_bucket{le="10"} 1
+dhcp_client_time_to_lease_seconds_bucket{le="30"} 1
+dhcp_client_time_to_lease_seconds_bucket{le="60"} 1
+dhcp_client_time_to_lease_seconds_bucket{le="120"} 1
+dhcp_client_time_to_lease_seconds_bucket{le="300"} 1
+dhcp_client_time_to_lease_seconds_bucket{le="+Inf"} 1
+dhcp_client_time_to_lease_seconds_sum 1.5
+dhcp_client_time_to_lease_seconds_count 1
+# HELP dhcp_client_relay_forwarded_total DHCP messages forwarded by the relay agent, by client interface, server and op code.
+# TYPE dhcp_client_relay_forwarded_total counter
+# HELP dhcp_client_relay_dropped_total DHCP messages dropped by the relay agent, by client interface, server and reason.
+# TYPE dhcp_client_relay_dropped_total counter
+`
+	var b bytes.Buffer
+	if _, err := r.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.String(); got != want {
+		t.Errorf("WriteTo() =\n%s\nwant\n%s", got, want)
+	}
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if got := rec.Body.String(); got != want {
+		t.Errorf("ServeHTTP() =\n%s\nwant\n%s", got, want)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+}
+
+func TestRegistryEmpty(t *testing.T) {
+	var b bytes.Buffer
+	if _, err := NewRegistry("").WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(b.Bytes(), []byte("\nlease_duration_seconds_bucket{le=\"604800\"} 0\n")) {
+		t.Errorf("WriteTo() =\n%s\nwant default buckets without namespace", b.Bytes())
+	}
+}
+
+func TestRegistryRelay(t *testing.T) {
+	r := NewRegistry("dhcp")
+	server := net.IP{10, 0, 0, 1}
+	r.RelayForwarded("eth1", server, dhcp4.BootRequest)
+	r.RelayForwarded("eth1", server, dhcp4.BootRequest)
+	r.RelayForwarded("eth1", server, dhcp4.BootReply)
+	r.RelayForwarded("eth2", server, dhcp4.BootRequest)
+	r.RelayDropped("eth1", nil, RelayHopLimit)
+	r.RelayDropped("eth1", nil, RelayAgentInfoPolicy)
+	r.RelayDropped("eth1", net.IP{10, 0, 0, 2}, RelayReplyMismatch)
+
+	var b bytes.Buffer
+	if _, err := r.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP dhcp_relay_forwarded_total DHCP messages forwarded by the relay agent, by client interface, server and op code.
+# TYPE dhcp_relay_forwarded_total counter
+dhcp_relay_forwarded_total{interface="eth1",server="10.0.0.1",op="BOOTREPLY"} 1
+dhcp_relay_forwarded_total{interface="eth1",server="10.0.0.1",op="BOOTREQUEST"} 2
+dhcp_relay_forwarded_total{interface="eth2",server="10.0.0.1",op="BOOTREQUEST"} 1
+# HELP dhcp_relay_dropped_total DHCP messages dropped by the relay agent, by client interface, server and reason.
+# TYPE dhcp_relay_dropped_total counter
+dhcp_relay_dropped_total{interface="eth1",server="",reason="hop_limit"} 1
+dhcp_relay_dropped_total{interface="eth1",server="",reason="relay_agent_info"} 1
+dhcp_relay_dropped_total{interface="eth1",server="10.0.0.2",reason="reply_mismatch"} 1
+`
+	if got := b.String(); !bytes.HasSuffix(b.Bytes(), []byte(want)) {
+		t.Errorf("WriteTo() =\n%s\nwant to end with\n%s", got, want)
+	}
+}
+
+func TestRegistryReset(t *testing.T) {
+	r := NewRegistry("dhcp_server")
+	r.start = time.Unix(1500000000, 0)
+	r.MessageSent(dhcp4.DHCPOffer)
+	r.Lease(time.Hour)
+	r.RelayDropped("eth1", nil, RelayHopLimit)
+	before := time.Now()
+	r.Reset()
+
+	var b bytes.Buffer
+	if _, err := r.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	for _, unwanted := range []string{
+		`dhcp_server_messages_sent_total{type="DHCPOFFER"}`,
+		`dhcp_server_relay_dropped_total{`,
+		"dhcp_server_start_time_seconds 1.5e+09\n",
+	} {
+		if bytes.Contains(b.Bytes(), []byte(unwanted)) {
+			t.Errorf("WriteTo() after Reset =\n%s\nwant no %q", b.Bytes(), unwanted)
+		}
+	}
+	if !bytes.Contains(b.Bytes(), []byte("\ndhcp_server_lease_duration_seconds_count 0\n")) {
+		t.Errorf("WriteTo() after Reset =\n%s\nwant empty lease histogram", b.Bytes())
+	}
+	if r.start.Before(before) {
+		t.Errorf("start time after Reset = %v, want after %v", r.start, before)
+	}
+}
@@ -0,0 +1,341 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package dhcp4monitor passively observes DHCPv4 traffic on a segment and
+// reports pathological patterns that indicate sick clients or networks.
+package dhcp4monitor
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+	"github.com/mergetb/dhcp4/dhcp4client"
+	"github.com/mergetb/dhcp4/dhcp4opts"
+)
+
+const maxMessageSize = 1500
+
+// AnomalyKind classifies an Anomaly.
+type AnomalyKind int
+
+const (
+	// AnomalyRetryStorm is a client sending DHCPDISCOVERs continuously,
+	// e.g. because it never gets or never accepts an offer.
+	AnomalyRetryStorm AnomalyKind = iota
+
+	// AnomalyFlapping is a client repeatedly releasing its lease and
+	// requesting a new one.
+	AnomalyFlapping
+
+	// AnomalyDuplicateXID is the same transaction ID used by different
+	// clients, e.g. because of cloned VMs with a poorly seeded RNG.
+	AnomalyDuplicateXID
+)
+
+// String implements fmt.Stringer.
+func (k AnomalyKind) String() string {
+	switch k {
+	case AnomalyRetryStorm:
+		return "retry storm"
+	case AnomalyFlapping:
+		return "release/request flapping"
+	case AnomalyDuplicateXID:
+		return "duplicate XID"
+	default:
+		return fmt.Sprintf("AnomalyKind(%d)", int(k))
+	}
+}
+
+// Anomaly is a pathological traffic pattern seen by the Monitor.
+type Anomaly struct {
+	Kind AnomalyKind
+
+	// Time is when the packet completing the pattern was received.
+	Time time.Time
+
+	// HardwareAddr is the client showing the pattern. For
+	// AnomalyDuplicateXID, it is the second client using the XID.
+	HardwareAddr net.HardwareAddr
+
+	// XID is the transaction ID of the packet completing the pattern.
+	XID [4]byte
+
+	// Count is the number of occurrences within the monitor's window:
+	// DHCPDISCOVERs for AnomalyRetryStorm, release/request cycles for
+	// AnomalyFlapping, and clients for AnomalyDuplicateXID.
+	Count int
+
+	// Others are the other clients using XID, for AnomalyDuplicateXID.
+	Others []net.HardwareAddr
+}
+
+// String implements fmt.Stringer.
+func (a Anomaly) String() string {
+	s := fmt.Sprintf("%v: %v from %v (xid %x, %d in window)", a.Time.Format(time.RFC3339), a.Kind, a.HardwareAddr, a.XID, a.Count)
+	if len(a.Others) > 0 {
+		s += fmt.Sprintf(", also used by %v", a.Others)
+	}
+	return s
+}
+
+// MonitorOpt is a function that configures the Monitor.
+type MonitorOpt func(*Monitor)
+
+// WithWindow configures the sliding window patterns are detected in.
+//
+// Default is 1 minute.
+func WithWindow(d time.Duration) MonitorOpt {
+	return func(m *Monitor) {
+		m.window = d
+	}
+}
+
+// WithRetryThreshold configures how many DHCPDISCOVERs from one client
+// within the window make a retry storm.
+//
+// Default is 10.
+func WithRetryThreshold(n int) MonitorOpt {
+	return func(m *Monitor) {
+		m.retryThreshold = n
+	}
+}
+
+// WithFlapThreshold configures how many release/request cycles of one client
+// within the window make it flapping.
+//
+// Default is 3.
+func WithFlapThreshold(n int) MonitorOpt {
+	return func(m *Monitor) {
+		m.flapThreshold = n
+	}
+}
+
+// clientState is what the Monitor remembers about a client.
+type clientState struct {
+	discovers []time.Time
+	flaps     []time.Time
+	released  bool
+}
+
+// xidUse is a client seen using a transaction ID.
+type xidUse struct {
+	haddr string
+	seen  time.Time
+}
+
+// Monitor detects pathological patterns in observed DHCP traffic.
+type Monitor struct {
+	window         time.Duration
+	retryThreshold int
+	flapThreshold  int
+
+	handler func(Anomaly)
+
+	mu        sync.Mutex
+	clients   map[string]*clientState
+	xids      map[[4]byte][]xidUse
+	lastPrune time.Time
+}
+
+// New returns a Monitor that calls handler for every detected anomaly.
+//
+// A pattern is reported once when it reaches its threshold; it is reported
+// again only if it reaches the threshold again afterwards.
+func New(handler func(Anomaly), opts ...MonitorOpt) *Monitor {
+	m := &Monitor{
+		window:         time.Minute,
+		retryThreshold: 10,
+		flapThreshold:  3,
+		handler:        handler,
+		clients:        make(map[string]*clientState),
+		xids:           make(map[[4]byte][]xidUse),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Observe feeds a packet received at t to the monitor.
+//
+// Packets must be observed in order of t.
+func (m *Monitor) Observe(t time.Time, p *dhcp4.Packet) {
+	if p.Op != dhcp4.BootRequest {
+		return
+	}
+
+	m.mu.Lock()
+	var as []Anomaly
+	m.prune(t)
+	haddr := string(p.CHAddr)
+	cs, ok := m.clients[haddr]
+	if !ok {
+		cs = &clientState{}
+		m.clients[haddr] = cs
+	}
+	anomaly := func(kind AnomalyKind, count int) Anomaly {
+		return Anomaly{
+			Kind:         kind,
+			Time:         t,
+			HardwareAddr: append(net.HardwareAddr(nil), p.CHAddr...),
+			XID:          p.TransactionID,
+			Count:        count,
+		}
+	}
+
+	switch dhcp4opts.GetDHCPMessageType(p.Options) {
+	case dhcp4opts.DHCPDiscover:
+		cs.discovers = append(m.inWindow(t, cs.discovers), t)
+		if len(cs.discovers) >= m.retryThreshold {
+			as = append(as, anomaly(AnomalyRetryStorm, len(cs.discovers)))
+			cs.discovers = nil
+		}
+		as = append(as, m.reacquire(t, cs, anomaly)...)
+
+	case dhcp4opts.DHCPRequest:
+		as = append(as, m.reacquire(t, cs, anomaly)...)
+
+	case dhcp4opts.DHCPRelease:
+		cs.released = true
+	}
+
+	if a, ok := m.checkXID(t, p, haddr); ok {
+		as = append(as, a)
+	}
+	m.mu.Unlock()
+
+	for _, a := range as {
+		m.handler(a)
+	}
+}
+
+// reacquire records a client acquiring a lease, which completes a
+// release/request cycle if the client released its lease before.
+func (m *Monitor) reacquire(t time.Time, cs *clientState, anomaly func(AnomalyKind, int) Anomaly) []Anomaly {
+	if !cs.released {
+		return nil
+	}
+	cs.released = false
+	cs.flaps = append(m.inWindow(t, cs.flaps), t)
+	if len(cs.flaps) >= m.flapThreshold {
+		a := anomaly(AnomalyFlapping, len(cs.flaps))
+		cs.flaps = nil
+		return []Anomaly{a}
+	}
+	return nil
+}
+
+// checkXID records the use of p's transaction ID by haddr and reports it if
+// another client used it within the window.
+func (m *Monitor) checkXID(t time.Time, p *dhcp4.Packet, haddr string) (Anomaly, bool) {
+	uses := m.xids[p.TransactionID]
+	var others []net.HardwareAddr
+	for i := range uses {
+		if uses[i].haddr == haddr {
+			uses[i].seen = t
+			// Already known: reported when it was first seen.
+			return Anomaly{}, false
+		}
+		others = append(others, net.HardwareAddr(uses[i].haddr))
+	}
+	m.xids[p.TransactionID] = append(uses, xidUse{haddr: haddr, seen: t})
+	if len(others) == 0 {
+		return Anomaly{}, false
+	}
+	return Anomaly{
+		Kind:         AnomalyDuplicateXID,
+		Time:         t,
+		HardwareAddr: append(net.HardwareAddr(nil), p.CHAddr...),
+		XID:          p.TransactionID,
+		Count:        len(others) + 1,
+		Others:       others,
+	}, true
+}
+
+// inWindow returns the times in ts within the window ending at t.
+func (m *Monitor) inWindow(t time.Time, ts []time.Time) []time.Time {
+	i := 0
+	for i < len(ts) && t.Sub(ts[i]) > m.window {
+		i++
+	}
+	return ts[i:]
+}
+
+// prune forgets clients and transaction IDs not seen within the window. It
+// runs at most once per window.
+func (m *Monitor) prune(t time.Time) {
+	if t.Sub(m.lastPrune) < m.window {
+		return
+	}
+	m.lastPrune = t
+
+	for haddr, cs := range m.clients {
+		cs.discovers = m.inWindow(t, cs.discovers)
+		cs.flaps = m.inWindow(t, cs.flaps)
+		if len(cs.discovers) == 0 && len(cs.flaps) == 0 && !cs.released {
+			delete(m.clients, haddr)
+		}
+	}
+	for xid, uses := range m.xids {
+		kept := uses[:0]
+		for _, u := range uses {
+			if t.Sub(u.seen) <= m.window {
+				kept = append(kept, u)
+			}
+		}
+		if len(kept) == 0 {
+			delete(m.xids, xid)
+		} else {
+			m.xids[xid] = kept
+		}
+	}
+}
+
+// Run observes the DHCP packets read from conn until reading fails or ctx is
+// canceled.
+//
+// conn is usually a connection listening on the server port. If conn
+// implements dhcp4client.TimestampedPacketConn, packets are observed with
+// their receive timestamps.
+func (m *Monitor) Run(ctx context.Context, conn net.PacketConn) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		// Unblock reads.
+		<-ctx.Done()
+		conn.SetReadDeadline(time.Now())
+	}()
+
+	tconn, timestamped := conn.(dhcp4client.TimestampedPacketConn)
+	var buf [maxMessageSize]byte
+	for {
+		var (
+			n   int
+			t   time.Time
+			err error
+		)
+		if timestamped {
+			n, _, t, err = tconn.ReadFromTimestamped(buf[:])
+		} else {
+			n, _, err = conn.ReadFrom(buf[:])
+			t = time.Now()
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			return err
+		}
+
+		p, err := dhcp4.ParsePacket(buf[:n])
+		if err != nil {
+			continue
+		}
+		m.Observe(t, p)
+	}
+}
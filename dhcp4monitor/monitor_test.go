@@ -0,0 +1,126 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4monitor
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+	"github.com/mergetb/dhcp4/dhcp4opts"
+)
+
+var (
+	mac1 = net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 1}
+	mac2 = net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 2}
+)
+
+type observation struct {
+	at   time.Duration
+	typ  dhcp4opts.DHCPMessageType
+	mac  net.HardwareAddr
+	xid  byte
+	want []AnomalyKind
+}
+
+func newPacket(typ dhcp4opts.DHCPMessageType, mac net.HardwareAddr, xid byte) *dhcp4.Packet {
+	p := dhcp4.NewPacket(dhcp4.BootRequest)
+	p.CHAddr = mac
+	p.TransactionID = [4]byte{0, 0, 0, xid}
+	p.Options.Add(dhcp4.OptionDHCPMessageType, typ)
+	return p
+}
+
+func TestMonitor(t *testing.T) {
+	for _, tt := range []struct {
+		desc string
+		obs  []observation
+	}{
+		{
+			desc: "retry storm",
+			obs: []observation{
+				{at: 0, typ: dhcp4opts.DHCPDiscover, mac: mac1, xid: 1},
+				{at: time.Second, typ: dhcp4opts.DHCPDiscover, mac: mac1, xid: 1},
+				{at: 2 * time.Second, typ: dhcp4opts.DHCPDiscover, mac: mac1, xid: 1, want: []AnomalyKind{AnomalyRetryStorm}},
+				// Reported once per threshold.
+				{at: 3 * time.Second, typ: dhcp4opts.DHCPDiscover, mac: mac1, xid: 1},
+			},
+		},
+		{
+			desc: "slow retries are not a storm",
+			obs: []observation{
+				{at: 0, typ: dhcp4opts.DHCPDiscover, mac: mac1, xid: 1},
+				{at: time.Minute, typ: dhcp4opts.DHCPDiscover, mac: mac1, xid: 1},
+				{at: 2 * time.Minute, typ: dhcp4opts.DHCPDiscover, mac: mac1, xid: 1},
+			},
+		},
+		{
+			desc: "flapping",
+			obs: []observation{
+				{at: 0, typ: dhcp4opts.DHCPRequest, mac: mac1, xid: 1},
+				{at: time.Second, typ: dhcp4opts.DHCPRelease, mac: mac1, xid: 2},
+				{at: 2 * time.Second, typ: dhcp4opts.DHCPRequest, mac: mac1, xid: 3},
+				{at: 3 * time.Second, typ: dhcp4opts.DHCPRelease, mac: mac1, xid: 4},
+				{at: 4 * time.Second, typ: dhcp4opts.DHCPRequest, mac: mac1, xid: 5, want: []AnomalyKind{AnomalyFlapping}},
+			},
+		},
+		{
+			desc: "duplicate XID",
+			obs: []observation{
+				{at: 0, typ: dhcp4opts.DHCPDiscover, mac: mac1, xid: 1},
+				{at: time.Second, typ: dhcp4opts.DHCPDiscover, mac: mac2, xid: 1, want: []AnomalyKind{AnomalyDuplicateXID}},
+				{at: 2 * time.Second, typ: dhcp4opts.DHCPRequest, mac: mac2, xid: 1},
+			},
+		},
+		{
+			desc: "XID reused after window",
+			obs: []observation{
+				{at: 0, typ: dhcp4opts.DHCPDiscover, mac: mac1, xid: 1},
+				{at: 2 * time.Minute, typ: dhcp4opts.DHCPDiscover, mac: mac2, xid: 1},
+			},
+		},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			var got []Anomaly
+			m := New(func(a Anomaly) {
+				got = append(got, a)
+			}, WithWindow(time.Minute), WithRetryThreshold(3), WithFlapThreshold(2))
+
+			start := time.Now()
+			for i, o := range tt.obs {
+				got = nil
+				m.Observe(start.Add(o.at), newPacket(o.typ, o.mac, o.xid))
+
+				var kinds []AnomalyKind
+				for _, a := range got {
+					kinds = append(kinds, a.Kind)
+				}
+				if !reflect.DeepEqual(kinds, o.want) {
+					t.Errorf("observation %d: got anomalies %v, want %v", i, got, o.want)
+				}
+			}
+		})
+	}
+}
+
+func TestMonitorDuplicateXIDClients(t *testing.T) {
+	var got []Anomaly
+	m := New(func(a Anomaly) {
+		got = append(got, a)
+	})
+	now := time.Now()
+	m.Observe(now, newPacket(dhcp4opts.DHCPDiscover, mac1, 7))
+	m.Observe(now, newPacket(dhcp4opts.DHCPDiscover, mac2, 7))
+
+	if len(got) != 1 {
+		t.Fatalf("got anomalies %v, want 1", got)
+	}
+	a := got[0]
+	if a.Count != 2 || !reflect.DeepEqual(a.HardwareAddr, mac2) || len(a.Others) != 1 || !reflect.DeepEqual(a.Others[0], mac1) {
+		t.Errorf("got %v, want duplicate XID from %v also used by %v", a, mac2, mac1)
+	}
+}
@@ -0,0 +1,28 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4opts
+
+import (
+	"testing"
+
+	"github.com/mergetb/dhcp4"
+)
+
+// FuzzVendorInfo checks that parsing vendor-specific information never
+// panics.
+func FuzzVendorInfo(f *testing.F) {
+	f.Add([]byte{6, 1, 8, 8, 4, 0, 1, 1, 0, 255})
+	f.Add([]byte{10, 4, 0, 'b', 'o', 'o'})
+	f.Add([]byte{71, 4, 0x80, 0, 0, 0, 0})
+	f.Fuzz(func(t *testing.T, b []byte) {
+		ParsePXEMenu(b)
+		ParsePXEPrompt(b)
+		ParsePXEItem(b)
+		DecodeVendorInfo("PXEClient", dhcp4.Options{dhcp4.OptionVendorSpecificInformation: b})
+		if s, err := ParseSubOptions(b); err == nil {
+			s.MarshalBinary()
+		}
+	})
+}
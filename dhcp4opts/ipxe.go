@@ -0,0 +1,156 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4opts
+
+import (
+	"fmt"
+
+	"github.com/mergetb/dhcp4"
+)
+
+// IPXEUserClass is the user class iPXE sends in option 77.
+const IPXEUserClass = "iPXE"
+
+// iPXE encapsulated options (option 175), as defined by iPXE's
+// include/ipxe/dhcp.h.
+const (
+	// IPXEPriority is the priority of the DHCP server, a signed byte.
+	IPXEPriority uint8 = 0x01
+
+	// IPXEKeepSAN and IPXESkipSANBoot tell iPXE to keep SAN devices
+	// attached after booting and to attach them without booting.
+	IPXEKeepSAN     uint8 = 0x08
+	IPXESkipSANBoot uint8 = 0x09
+
+	// The feature indicators iPXE sends: a sub-option with value 1 for
+	// every protocol or image format it was built with.
+	IPXEFeaturePXEExt    uint8 = 0x10
+	IPXEFeatureISCSI     uint8 = 0x11
+	IPXEFeatureAoE       uint8 = 0x12
+	IPXEFeatureHTTP      uint8 = 0x13
+	IPXEFeatureHTTPS     uint8 = 0x14
+	IPXEFeatureTFTP      uint8 = 0x15
+	IPXEFeatureFTP       uint8 = 0x16
+	IPXEFeatureDNS       uint8 = 0x17
+	IPXEFeatureBzImage   uint8 = 0x18
+	IPXEFeatureMultiboot uint8 = 0x19
+	IPXEFeatureSLAM      uint8 = 0x1a
+	IPXEFeatureSRP       uint8 = 0x1b
+	IPXEFeatureNBI       uint8 = 0x20
+	IPXEFeaturePXE       uint8 = 0x21
+	IPXEFeatureELF       uint8 = 0x22
+	IPXEFeatureCOMBOOT   uint8 = 0x23
+	IPXEFeatureEFI       uint8 = 0x24
+	IPXEFeatureFCoE      uint8 = 0x25
+	IPXEFeatureVLAN      uint8 = 0x26
+	IPXEFeatureMenu      uint8 = 0x27
+	IPXEFeatureSDI       uint8 = 0x28
+	IPXEFeatureNFS       uint8 = 0x29
+
+	// IPXENoPXEDHCP, sent by servers, tells iPXE not to wait for
+	// ProxyDHCP offers.
+	IPXENoPXEDHCP uint8 = 0xb0
+
+	// IPXEBusID is the bus type and location of the client's network
+	// card.
+	IPXEBusID uint8 = 0xb1
+
+	// IPXEUsername and IPXEPassword are credentials for the boot
+	// server.
+	IPXEUsername uint8 = 0xbe
+	IPXEPassword uint8 = 0xbf
+
+	// IPXEVersion is the iPXE version, three bytes of major, minor and
+	// patch level.
+	IPXEVersion uint8 = 0xeb
+)
+
+// IsIPXE returns true if the options were sent by an iPXE client.
+//
+// iPXE identifies itself with the user class "iPXE" (option 77) and with
+// its encapsulated options (option 175). Older iPXE versions send the user
+// class as a plain string rather than in the RFC 3004 format, so both are
+// recognized.
+func IsIPXE(o dhcp4.Options) bool {
+	if o.Get(dhcp4.OptionIPXEEncapsulated) != nil {
+		return true
+	}
+	return o.HasUserClass(IPXEUserClass)
+}
+
+// GetIPXEOptions returns the iPXE encapsulated options (option 175) of o.
+//
+// It returns nil sub-options if the option is not present and an error if
+// it is malformed.
+func GetIPXEOptions(o dhcp4.Options) (SubOptions, error) {
+	v := o.Get(dhcp4.OptionIPXEEncapsulated)
+	if v == nil {
+		return nil, nil
+	}
+	sub, err := ParseSubOptions(v)
+	if err != nil {
+		return nil, fmt.Errorf("option %d: %v", dhcp4.OptionIPXEEncapsulated, err)
+	}
+	return sub, nil
+}
+
+// SetIPXEOptions sets the iPXE encapsulated options (option 175) of o to
+// sub. Empty sub-options remove the option.
+func SetIPXEOptions(o dhcp4.Options, sub SubOptions) error {
+	if len(sub) == 0 {
+		delete(o, dhcp4.OptionIPXEEncapsulated)
+		return nil
+	}
+	v, err := sub.MarshalBinary()
+	if err != nil {
+		return fmt.Errorf("option %d: %v", dhcp4.OptionIPXEEncapsulated, err)
+	}
+	o[dhcp4.OptionIPXEEncapsulated] = v
+	return nil
+}
+
+// IPXEHasFeature returns whether the iPXE client that sent o was built with
+// feature, one of the IPXEFeature sub-options, e.g. IPXEFeatureHTTPS before
+// handing it an https:// script.
+func IPXEHasFeature(o dhcp4.Options, feature uint8) bool {
+	sub, err := GetIPXEOptions(o)
+	if err != nil {
+		return false
+	}
+	v := sub[feature]
+	return len(v) > 0 && v[0] != 0
+}
+
+// GetIPXEVersion returns the version of the iPXE client that sent o, and
+// whether it sent one.
+func GetIPXEVersion(o dhcp4.Options) (major, minor, patch uint8, ok bool) {
+	sub, err := GetIPXEOptions(o)
+	if err != nil || len(sub[IPXEVersion]) != 3 {
+		return 0, 0, 0, false
+	}
+	v := sub[IPXEVersion]
+	return v[0], v[1], v[2], true
+}
+
+// SetIPXEClient marks o as sent by an iPXE client built with features: it
+// adds the user class "iPXE" and the feature indicators to the encapsulated
+// options, as iPXE does. Tests of servers and clients booting like iPXE use
+// it.
+func SetIPXEClient(o dhcp4.Options, features ...uint8) error {
+	if !o.HasUserClass(IPXEUserClass) {
+		o.SetUserClasses(append(o.UserClasses(), IPXEUserClass))
+	}
+	sub, err := GetIPXEOptions(o)
+	if err != nil {
+		return err
+	}
+	if sub == nil {
+		sub = make(SubOptions)
+	}
+	for _, f := range features {
+		sub[f] = []byte{1}
+	}
+	return SetIPXEOptions(o, sub)
+}
@@ -0,0 +1,90 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4opts
+
+import (
+	"testing"
+
+	"github.com/mergetb/dhcp4"
+)
+
+func TestIsIPXE(t *testing.T) {
+	for _, tt := range []struct {
+		desc string
+		opts dhcp4.Options
+		want bool
+	}{
+		{desc: "no options", opts: dhcp4.Options{}},
+		{
+			desc: "plain user class",
+			opts: dhcp4.Options{dhcp4.OptionUserClass: []byte("iPXE")},
+			want: true,
+		},
+		{
+			desc: "RFC 3004 user class",
+			opts: dhcp4.Options{dhcp4.OptionUserClass: []byte("\x03foo\x04iPXE")},
+			want: true,
+		},
+		{
+			desc: "other user class",
+			opts: dhcp4.Options{dhcp4.OptionUserClass: []byte("\x03foo")},
+		},
+		{
+			desc: "malformed user class",
+			opts: dhcp4.Options{dhcp4.OptionUserClass: []byte("\x09iPXE")},
+		},
+		{
+			desc: "encapsulated options",
+			opts: dhcp4.Options{dhcp4.OptionIPXEEncapsulated: []byte{19, 1, 1}},
+			want: true,
+		},
+	} {
+		if got := IsIPXE(tt.opts); got != tt.want {
+			t.Errorf("%s: IsIPXE() = %t, want %t", tt.desc, got, tt.want)
+		}
+	}
+}
+
+func TestIPXEOptions(t *testing.T) {
+	o := make(dhcp4.Options)
+	if err := SetIPXEClient(o, IPXEFeatureHTTP, IPXEFeatureEFI); err != nil {
+		t.Fatal(err)
+	}
+	if !IsIPXE(o) || !o.HasUserClass(IPXEUserClass) {
+		t.Errorf("IsIPXE() = false after SetIPXEClient")
+	}
+	for _, tt := range []struct {
+		feature uint8
+		want    bool
+	}{
+		{IPXEFeatureHTTP, true},
+		{IPXEFeatureEFI, true},
+		{IPXEFeatureHTTPS, false},
+	} {
+		if got := IPXEHasFeature(o, tt.feature); got != tt.want {
+			t.Errorf("IPXEHasFeature(%#x) = %t, want %t", tt.feature, got, tt.want)
+		}
+	}
+	if _, _, _, ok := GetIPXEVersion(o); ok {
+		t.Errorf("GetIPXEVersion() = ok without version")
+	}
+
+	// As sent by iPXE 1.21.1.
+	o[dhcp4.OptionIPXEEncapsulated] = []byte{IPXEVersion, 3, 1, 21, 1, IPXEFeatureHTTPS, 1, 1, 0, 255}
+	if major, minor, patch, ok := GetIPXEVersion(o); !ok || major != 1 || minor != 21 || patch != 1 {
+		t.Errorf("GetIPXEVersion() = %d.%d.%d, %t, want 1.21.1", major, minor, patch, ok)
+	}
+	if !IPXEHasFeature(o, IPXEFeatureHTTPS) || IPXEHasFeature(o, IPXEFeatureHTTP) {
+		t.Errorf("IPXEHasFeature() does not match the encapsulated options %x", o[dhcp4.OptionIPXEEncapsulated])
+	}
+
+	o[dhcp4.OptionIPXEEncapsulated] = []byte{IPXEFeatureHTTP, 5, 1}
+	if _, err := GetIPXEOptions(o); err == nil {
+		t.Errorf("GetIPXEOptions(truncated) = nil error")
+	}
+	if err := SetIPXEClient(o); err == nil {
+		t.Errorf("SetIPXEClient() on malformed options = nil error")
+	}
+}
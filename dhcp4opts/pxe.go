@@ -0,0 +1,68 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4opts
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net"
+
+	"github.com/mergetb/dhcp4"
+)
+
+// PXEUNDI is the network interface identifier PXE 2.1 clients send.
+var PXEUNDI = dhcp4.NetworkInterfaceID{Type: dhcp4.NetworkInterfaceUNDI, Major: 2, Minor: 1}
+
+// PXEVendorClass returns the vendor class identifier a PXE client of
+// architecture arch with network interface nic sends, e.g.
+// "PXEClient:Arch:00000:UNDI:002001".
+func PXEVendorClass(arch dhcp4.Arch, nic dhcp4.NetworkInterfaceID) string {
+	return fmt.Sprintf("%s:Arch:%05d:UNDI:%03d%03d", PXEProfile.ClassPrefix, uint16(arch), nic.Major, nic.Minor)
+}
+
+// pxeParameters are the options PXE clients request.
+var pxeParameters = []dhcp4.OptionCode{
+	dhcp4.OptionSubnetMask,
+	dhcp4.OptionRouters,
+	dhcp4.OptionDomainNameServers,
+	dhcp4.OptionHostName,
+	dhcp4.OptionDomainName,
+	dhcp4.OptionVendorSpecificInformation,
+	dhcp4.OptionVendorClassIdentifier,
+	dhcp4.OptionTFTPServerName,
+	dhcp4.OptionBootFileName,
+}
+
+// NewPXEDiscover returns a DHCPDISCOVER as sent by a PXE 2.1 client with
+// hardware address mac, system architecture arch and machine UUID uuid.
+//
+// It carries the options of SetPXEClientOptions. The transaction ID is
+// random.
+func NewPXEDiscover(mac net.HardwareAddr, arch dhcp4.Arch, uuid dhcp4.UUID) (*dhcp4.Packet, error) {
+	p := dhcp4.NewPacket(dhcp4.BootRequest)
+	if err := p.SetHardwareAddr(mac); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(p.TransactionID[:]); err != nil {
+		return nil, err
+	}
+	p.Broadcast = true
+
+	p.Options.SetMessageType(dhcp4.DHCPDiscover)
+	SetPXEClientOptions(p.Options, arch, uuid)
+	return p, nil
+}
+
+// SetPXEClientOptions sets the options a PXE 2.1 client of system
+// architecture arch and machine UUID uuid sends with every request: options
+// 93, 94 and 97, the PXE vendor class identifier and a parameter request
+// list asking for the boot options.
+func SetPXEClientOptions(o dhcp4.Options, arch dhcp4.Arch, uuid dhcp4.UUID) {
+	o.SetParameterRequestList(pxeParameters)
+	o.SetClientSystemArchitectures([]dhcp4.Arch{arch})
+	o.SetClientNetworkInterfaceID(PXEUNDI)
+	o.SetClientMachineID(uuid)
+	o.SetVendorClassIdentifier(PXEVendorClass(arch, PXEUNDI))
+}
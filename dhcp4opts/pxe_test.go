@@ -0,0 +1,59 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4opts
+
+import (
+	"net"
+	"testing"
+
+	"github.com/mergetb/dhcp4"
+)
+
+func TestNewPXEDiscover(t *testing.T) {
+	mac := net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 1}
+	uuid := dhcp4.UUID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+	p, err := NewPXEDiscover(mac, dhcp4.ArchX64UEFI, uuid)
+	if err != nil {
+		t.Fatalf("NewPXEDiscover() = %v", err)
+	}
+
+	// Round trip through the wire format.
+	b, err := p.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p, err = dhcp4.ParsePacket(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Validate(); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+	if findings := dhcp4.Lint(p); len(findings) != 0 {
+		t.Errorf("Lint() = %v", findings)
+	}
+
+	if p.Op != dhcp4.BootRequest || p.Options.MessageType() != dhcp4.DHCPDiscover || p.HardwareAddr().String() != mac.String() {
+		t.Errorf("got %v %v from %v, want a DHCPDISCOVER from %v", p.Op, p.Options.MessageType(), p.HardwareAddr(), mac)
+	}
+	if got := p.Options.VendorClassIdentifier(); got != "PXEClient:Arch:00007:UNDI:002001" {
+		t.Errorf("vendor class %q, want PXEClient:Arch:00007:UNDI:002001", got)
+	}
+	if LookupVendorProfile(p.Options.VendorClassIdentifier()) != PXEProfile {
+		t.Errorf("vendor class %q does not select the PXE profile", p.Options.VendorClassIdentifier())
+	}
+	if got := p.Options.ClientSystemArchitectures(); len(got) != 1 || got[0] != dhcp4.ArchX64UEFI {
+		t.Errorf("architectures %v, want [x64 UEFI]", got)
+	}
+	if got, ok := p.Options.ClientNetworkInterfaceID(); !ok || got != PXEUNDI {
+		t.Errorf("network interface %v, want %v", got, PXEUNDI)
+	}
+	if got, ok := p.Options.ClientMachineID(); !ok || got != uuid {
+		t.Errorf("machine ID %v, want %v", got, uuid)
+	}
+
+	if _, err := NewPXEDiscover(make(net.HardwareAddr, 17), dhcp4.ArchX86BIOS, uuid); err == nil {
+		t.Errorf("NewPXEDiscover() with a 17-byte hardware address succeeded")
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4opts
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mergetb/dhcp4"
+)
+
+func TestGetIP(t *testing.T) {
+	o := dhcp4.Options{
+		dhcp4.OptionRouters:          {192, 168, 0, 1, 0xff},
+		dhcp4.OptionServerIdentifier: {192, 168},
+	}
+	if got, want := GetIP(dhcp4.OptionRouters, o), (IP{192, 168, 0, 1}); !reflect.DeepEqual(got, want) {
+		t.Errorf("GetIP(5 bytes) = %v, want %v", got, want)
+	}
+	if got := GetIP(dhcp4.OptionServerIdentifier, o); got != nil {
+		t.Errorf("GetIP(2 bytes) = %v, want nil", got)
+	}
+}
+
+func TestGetIPs(t *testing.T) {
+	for _, tt := range []struct {
+		v    []byte
+		want IPs
+	}{
+		{v: nil},
+		{v: []byte{}, want: IPs{}},
+		{v: []byte{10, 0, 0, 1, 10, 0, 0, 2}, want: IPs{{10, 0, 0, 1}, {10, 0, 0, 2}}},
+		{v: []byte{10, 0, 0, 1, 10}},
+	} {
+		o := dhcp4.Options{}
+		if tt.v != nil {
+			o[dhcp4.OptionDomainNameServers] = tt.v
+		}
+		got := GetIPs(dhcp4.OptionDomainNameServers, o)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("GetIPs(%v) = %#v, want %#v", tt.v, got, tt.want)
+		}
+	}
+}
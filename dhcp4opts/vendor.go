@@ -0,0 +1,438 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4opts
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/mergetb/dhcp4"
+)
+
+// SubOptions are options encapsulated in another option, such as the
+// vendor-specific information option (43), keyed by their code.
+//
+// They use the code, length and value format of DHCP options, as RFC 2132,
+// Section 8.4 recommends: codes 0 and 255 are pad and end.
+type SubOptions map[uint8][]byte
+
+// Sub-option codes with the meaning of DHCP option codes.
+const (
+	subOptionPad uint8 = 0
+	subOptionEnd uint8 = 255
+)
+
+// ParseSubOptions parses encapsulated options. Values of a code that appears
+// more than once are concatenated.
+func ParseSubOptions(b []byte) (SubOptions, error) {
+	s := make(SubOptions)
+	for len(b) > 0 {
+		code := b[0]
+		switch code {
+		case subOptionPad:
+			b = b[1:]
+			continue
+		case subOptionEnd:
+			return s, nil
+		}
+		if len(b) < 2 || len(b) < 2+int(b[1]) {
+			return nil, fmt.Errorf("sub-option %d truncated", code)
+		}
+		n := int(b[1])
+		s[code] = append(s[code], b[2:2+n]...)
+		b = b[2+n:]
+	}
+	return s, nil
+}
+
+// MarshalBinary encodes the sub-options sorted by code, followed by end.
+//
+// Values must be at most 255 bytes long.
+func (s SubOptions) MarshalBinary() ([]byte, error) {
+	codes := make([]int, 0, len(s))
+	for c := range s {
+		if c != subOptionPad && c != subOptionEnd {
+			codes = append(codes, int(c))
+		}
+	}
+	sort.Ints(codes)
+
+	var b []byte
+	for _, c := range codes {
+		v := s[uint8(c)]
+		if len(v) > math.MaxUint8 {
+			return nil, fmt.Errorf("sub-option %d: value of %d bytes is longer than 255 bytes", c, len(v))
+		}
+		b = append(b, uint8(c), uint8(len(v)))
+		b = append(b, v...)
+	}
+	return append(b, subOptionEnd), nil
+}
+
+// GetVendorInfo returns the vendor class identifier (option 60) of o and the
+// sub-options of its vendor-specific information (option 43), which are
+// defined by the vendor class.
+//
+// Clients send the vendor class they belong to. Servers send the
+// sub-options for the client's class and, for some classes such as PXE,
+// the class itself too.
+//
+// It returns nil sub-options if option 43 is not present and an error if it
+// is malformed. Vendor classes that do not encapsulate options in option 43
+// are decoded by DecodeVendorInfo instead.
+func GetVendorInfo(o dhcp4.Options) (string, SubOptions, error) {
+	class := o.VendorClassIdentifier()
+	v := o.Get(dhcp4.OptionVendorSpecificInformation)
+	if v == nil {
+		return class, nil, nil
+	}
+	sub, err := ParseSubOptions(v)
+	if err != nil {
+		return class, nil, fmt.Errorf("option %d: %v", dhcp4.OptionVendorSpecificInformation, err)
+	}
+	return class, sub, nil
+}
+
+// SetVendorInfo sets the vendor class identifier (option 60) of o to class
+// and its vendor-specific information (option 43) to sub. An empty class or
+// sub removes the respective option.
+func SetVendorInfo(o dhcp4.Options, class string, sub SubOptions) error {
+	var v []byte
+	if len(sub) > 0 {
+		var err error
+		if v, err = sub.MarshalBinary(); err != nil {
+			return fmt.Errorf("option %d: %v", dhcp4.OptionVendorSpecificInformation, err)
+		}
+	}
+	o.SetVendorClassIdentifier(class)
+	o.SetVendorSpecificInformation(v)
+	return nil
+}
+
+// GetVIVendorInfo returns the sub-options of enterprise in the
+// vendor-identifying vendor-specific information (option 125) of o, as
+// defined by RFC 3925. Vendors such as Cisco and Juniper use it for
+// zero-touch provisioning instead of option 43, which cannot tell the
+// options of several vendors apart.
+//
+// It returns nil sub-options if option 125 is not present or carries none
+// for enterprise, and an error if it is malformed.
+func GetVIVendorInfo(o dhcp4.Options, enterprise uint32) (SubOptions, error) {
+	v := o.Get(dhcp4.OptionVIVendorSpecificInformation)
+	if v == nil {
+		return nil, nil
+	}
+	info, err := dhcp4.ParseVIVendorInfo(v)
+	if err != nil {
+		return nil, fmt.Errorf("option %d: %v", dhcp4.OptionVIVendorSpecificInformation, err)
+	}
+	return info[enterprise], nil
+}
+
+// SetVIVendorInfo sets the sub-options of enterprise in the
+// vendor-identifying vendor-specific information (option 125) of o to sub,
+// keeping those of other enterprises. An empty sub removes the enterprise,
+// and a malformed option 125 is replaced.
+func SetVIVendorInfo(o dhcp4.Options, enterprise uint32, sub SubOptions) error {
+	info := o.VIVendorInfo()
+	if info == nil {
+		info = make(dhcp4.VIVendorInfo)
+	}
+	if len(sub) > 0 {
+		info[enterprise] = sub
+	} else {
+		delete(info, enterprise)
+	}
+	v, err := info.MarshalBinary()
+	if err != nil {
+		return fmt.Errorf("option %d: %v", dhcp4.OptionVIVendorSpecificInformation, err)
+	}
+	if len(v) == 0 {
+		delete(o, dhcp4.OptionVIVendorSpecificInformation)
+		return nil
+	}
+	o[dhcp4.OptionVIVendorSpecificInformation] = v
+	return nil
+}
+
+// VendorProfile describes the vendor-specific information of a vendor
+// class.
+type VendorProfile struct {
+	// Name is the name of the vendor class.
+	Name string
+
+	// ClassPrefix is the prefix of the vendor class identifiers of the
+	// class, e.g. "PXEClient", which PXE clients follow by their
+	// architecture and UNDI version.
+	ClassPrefix string
+
+	// SubOptions names the sub-options the class defines.
+	SubOptions map[uint8]string
+}
+
+// SubOptionName returns the name of sub-option code, or its number if the
+// profile does not define it.
+func (p *VendorProfile) SubOptionName(code uint8) string {
+	if name, ok := p.SubOptions[code]; ok {
+		return name
+	}
+	return fmt.Sprintf("sub-option %d", code)
+}
+
+// PXE vendor sub-options, as defined by the PXE Specification 2.1, Section
+// 2.4.
+const (
+	PXEMTFTPIP            uint8 = 1
+	PXEMTFTPClientPort    uint8 = 2
+	PXEMTFTPServerPort    uint8 = 3
+	PXEMTFTPTimeout       uint8 = 4
+	PXEMTFTPDelay         uint8 = 5
+	PXEDiscoveryControl   uint8 = 6
+	PXEDiscoveryMulticast uint8 = 7
+	PXEBootServers        uint8 = 8
+	PXEBootMenu           uint8 = 9
+	PXEMenuPrompt         uint8 = 10
+	PXEMulticastAddrAlloc uint8 = 11
+	PXECredentialTypes    uint8 = 12
+	PXEBootItem           uint8 = 71
+)
+
+// PXEProfile is the vendor profile of PXE clients.
+//
+// Servers answering PXE clients send the vendor class identifier
+// "PXEClient" back with the sub-options, see SetVendorInfo.
+var PXEProfile = &VendorProfile{
+	Name:        "PXE",
+	ClassPrefix: "PXEClient",
+	SubOptions: map[uint8]string{
+		PXEMTFTPIP:            "MTFTP IP address",
+		PXEMTFTPClientPort:    "MTFTP client port",
+		PXEMTFTPServerPort:    "MTFTP server port",
+		PXEMTFTPTimeout:       "MTFTP timeout",
+		PXEMTFTPDelay:         "MTFTP delay",
+		PXEDiscoveryControl:   "discovery control",
+		PXEDiscoveryMulticast: "discovery multicast address",
+		PXEBootServers:        "boot servers",
+		PXEBootMenu:           "boot menu",
+		PXEMenuPrompt:         "menu prompt",
+		PXEMulticastAddrAlloc: "multicast address allocation",
+		PXECredentialTypes:    "credential types",
+		PXEBootItem:           "boot item",
+	},
+}
+
+// VendorProfiles are the known vendor profiles, see LookupVendorProfile.
+var VendorProfiles = []*VendorProfile{PXEProfile}
+
+// LookupVendorProfile returns the profile in VendorProfiles of the vendor
+// class identifier class, or nil if there is none.
+func LookupVendorProfile(class string) *VendorProfile {
+	for _, p := range VendorProfiles {
+		if strings.HasPrefix(class, p.ClassPrefix) {
+			return p
+		}
+	}
+	return nil
+}
+
+// VendorDecoder decodes the vendor-specific information (option 43) of a
+// vendor class.
+type VendorDecoder func(b []byte) (interface{}, error)
+
+// RawVendorInfo is vendor-specific information no VendorDecoder is
+// registered for, as sent.
+type RawVendorInfo []byte
+
+var (
+	vendorDecodersMu sync.RWMutex
+
+	// vendorDecoders are the decoders registered by class prefix.
+	vendorDecoders = map[string]VendorDecoder{
+		PXEProfile.ClassPrefix: func(b []byte) (interface{}, error) {
+			return ParseSubOptions(b)
+		},
+	}
+)
+
+// RegisterVendorDecoder registers dec to decode the vendor-specific
+// information of vendor classes starting with prefix, replacing the decoder
+// registered for prefix before, if any. A nil dec removes the decoder.
+//
+// Vendors reuse option 43 with incompatible layouts, so the decoder is
+// chosen by the vendor class the option was sent to or by. The PXE vendor
+// class "PXEClient" is registered to decode SubOptions.
+func RegisterVendorDecoder(prefix string, dec VendorDecoder) {
+	vendorDecodersMu.Lock()
+	defer vendorDecodersMu.Unlock()
+	if dec == nil {
+		delete(vendorDecoders, prefix)
+		return
+	}
+	vendorDecoders[prefix] = dec
+}
+
+// lookupVendorDecoder returns the decoder registered for the longest prefix
+// of class, or nil if there is none.
+func lookupVendorDecoder(class string) VendorDecoder {
+	vendorDecodersMu.RLock()
+	defer vendorDecodersMu.RUnlock()
+	var dec VendorDecoder
+	longest := -1
+	for prefix, d := range vendorDecoders {
+		if strings.HasPrefix(class, prefix) && len(prefix) > longest {
+			dec, longest = d, len(prefix)
+		}
+	}
+	return dec
+}
+
+// DecodeVendorInfo decodes the vendor-specific information (option 43) of
+// o with the decoder registered for class, see RegisterVendorDecoder.
+// Without a decoder, it returns the option as RawVendorInfo.
+//
+// class is the vendor class identifier (option 60) the client sent: in
+// requests, that of the request itself, and in replies, that of the request
+// answered, as servers need not send it back. An empty class uses that of
+// o.
+//
+// It returns nil if option 43 is not present, and an error if the decoder
+// failed.
+func DecodeVendorInfo(class string, o dhcp4.Options) (interface{}, error) {
+	v := o.Get(dhcp4.OptionVendorSpecificInformation)
+	if v == nil {
+		return nil, nil
+	}
+	if class == "" {
+		class = o.VendorClassIdentifier()
+	}
+	dec := lookupVendorDecoder(class)
+	if dec == nil {
+		return RawVendorInfo(append([]byte(nil), v...)), nil
+	}
+	info, err := dec(v)
+	if err != nil {
+		return nil, fmt.Errorf("option %d for vendor class %q: %v", dhcp4.OptionVendorSpecificInformation, class, err)
+	}
+	return info, nil
+}
+
+// PXE discovery control bits, the value of PXEDiscoveryControl.
+const (
+	// PXEDisableBroadcast disables broadcast discovery of boot servers.
+	PXEDisableBroadcast uint8 = 1 << 0
+
+	// PXEDisableMulticast disables multicast discovery of boot servers.
+	PXEDisableMulticast uint8 = 1 << 1
+
+	// PXEOnlyBootServers accepts only the servers in PXEBootServers.
+	PXEOnlyBootServers uint8 = 1 << 2
+
+	// PXESkipDiscovery downloads the boot file of the offer, if there is
+	// one, without prompting, showing the menu or discovering boot
+	// servers.
+	PXESkipDiscovery uint8 = 1 << 3
+)
+
+// PXEMenu is the value of PXEBootMenu.
+type PXEMenu []PXEMenuItem
+
+// PXEMenuItem is an entry of PXEBootMenu.
+type PXEMenuItem struct {
+	// Type is the boot server type the item selects. 0 is the local
+	// boot.
+	Type uint16
+
+	// Description is shown in the menu.
+	Description string
+}
+
+// ParsePXEMenu parses the value of PXEBootMenu.
+func ParsePXEMenu(b []byte) (PXEMenu, error) {
+	var items PXEMenu
+	for len(b) > 0 {
+		if len(b) < 3 || len(b) < 3+int(b[2]) {
+			return nil, errors.New("malformed PXE boot menu")
+		}
+		n := int(b[2])
+		items = append(items, PXEMenuItem{
+			Type:        binary.BigEndian.Uint16(b),
+			Description: dhcp4.SanitizeString(b[3 : 3+n]),
+		})
+		b = b[3+n:]
+	}
+	return items, nil
+}
+
+// MarshalBinary encodes the menu as the value of PXEBootMenu.
+func (m PXEMenu) MarshalBinary() ([]byte, error) {
+	var b []byte
+	for _, it := range m {
+		if len(it.Description) > math.MaxUint8 {
+			return nil, fmt.Errorf("PXE menu item %q is longer than 255 bytes", it.Description)
+		}
+		b = append(b, uint8(it.Type>>8), uint8(it.Type), uint8(len(it.Description)))
+		b = append(b, it.Description...)
+	}
+	return b, nil
+}
+
+// PXEPrompt is the value of PXEMenuPrompt.
+type PXEPrompt struct {
+	// Timeout is the number of seconds the prompt is shown before the
+	// first menu item is booted. 0 boots it right away, and 255 waits
+	// for a key press.
+	Timeout uint8
+
+	// Prompt is the text shown.
+	Prompt string
+}
+
+// ParsePXEPrompt parses the value of PXEMenuPrompt.
+func ParsePXEPrompt(b []byte) (PXEPrompt, error) {
+	if len(b) < 1 {
+		return PXEPrompt{}, errors.New("malformed PXE menu prompt")
+	}
+	return PXEPrompt{Timeout: b[0], Prompt: dhcp4.SanitizeString(b[1:])}, nil
+}
+
+// MarshalBinary encodes the prompt as the value of PXEMenuPrompt.
+func (p PXEPrompt) MarshalBinary() ([]byte, error) {
+	if len(p.Prompt) > math.MaxUint8-1 {
+		return nil, fmt.Errorf("PXE prompt %q is longer than 254 bytes", p.Prompt)
+	}
+	return append([]byte{p.Timeout}, p.Prompt...), nil
+}
+
+// PXEItem is the value of PXEBootItem, which clients send to boot servers
+// to request the boot file of a menu item.
+type PXEItem struct {
+	// Type is the boot server type of the menu item.
+	Type uint16
+
+	// Layer is the layer of the boot file requested. Layer 0 is the
+	// first file to download.
+	Layer uint16
+}
+
+// ParsePXEItem parses the value of PXEBootItem.
+func ParsePXEItem(b []byte) (PXEItem, error) {
+	if len(b) != 4 {
+		return PXEItem{}, errors.New("malformed PXE boot item")
+	}
+	return PXEItem{Type: binary.BigEndian.Uint16(b), Layer: binary.BigEndian.Uint16(b[2:])}, nil
+}
+
+// MarshalBinary encodes the item as the value of PXEBootItem.
+func (i PXEItem) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint16(b, i.Type)
+	binary.BigEndian.PutUint16(b[2:], i.Layer)
+	return b, nil
+}
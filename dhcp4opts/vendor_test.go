@@ -0,0 +1,257 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4opts
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mergetb/dhcp4"
+)
+
+func TestSubOptions(t *testing.T) {
+	sub := SubOptions{
+		PXEDiscoveryControl: {PXESkipDiscovery},
+		PXEMenuPrompt:       []byte("\x05Boot"),
+	}
+	wire := []byte{6, 1, 8, 10, 5, 5, 'B', 'o', 'o', 't', 255}
+	if got, err := sub.MarshalBinary(); err != nil || !bytes.Equal(got, wire) {
+		t.Errorf("MarshalBinary() = %v, %v; want %v", got, err, wire)
+	}
+	if got, err := ParseSubOptions(wire); err != nil || !reflect.DeepEqual(got, sub) {
+		t.Errorf("ParseSubOptions(%v) = %v, %v; want %v", wire, got, err, sub)
+	}
+
+	if _, err := (SubOptions{1: make([]byte, 256)}).MarshalBinary(); err == nil {
+		t.Errorf("MarshalBinary() of a 256-byte value succeeded")
+	}
+}
+
+func TestParseSubOptions(t *testing.T) {
+	for _, tt := range []struct {
+		desc string
+		b    []byte
+		want SubOptions
+	}{
+		{desc: "empty", b: []byte{}, want: SubOptions{}},
+		{desc: "no end", b: []byte{1, 1, 7}, want: SubOptions{1: {7}}},
+		{desc: "pad", b: []byte{0, 1, 1, 7, 0, 255}, want: SubOptions{1: {7}}},
+		{desc: "data after end", b: []byte{1, 1, 7, 255, 2, 1}, want: SubOptions{1: {7}}},
+		{desc: "repeated code", b: []byte{1, 1, 7, 1, 2, 8, 9}, want: SubOptions{1: {7, 8, 9}}},
+		{desc: "truncated length", b: []byte{1}},
+		{desc: "truncated value", b: []byte{1, 3, 7}},
+	} {
+		got, err := ParseSubOptions(tt.b)
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("%s: ParseSubOptions(%v) = %v, want error", tt.desc, tt.b, got)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: ParseSubOptions(%v) = %v, %v; want %v", tt.desc, tt.b, got, err, tt.want)
+		}
+	}
+}
+
+func TestVendorInfo(t *testing.T) {
+	o := make(dhcp4.Options)
+	sub := SubOptions{PXEDiscoveryControl: {PXESkipDiscovery}}
+	if err := SetVendorInfo(o, "PXEClient", sub); err != nil {
+		t.Fatalf("SetVendorInfo() = %v", err)
+	}
+	want := dhcp4.Options{
+		dhcp4.OptionVendorClassIdentifier:     []byte("PXEClient"),
+		dhcp4.OptionVendorSpecificInformation: {6, 1, 8, 255},
+	}
+	if !reflect.DeepEqual(o, want) {
+		t.Errorf("SetVendorInfo() set %v, want %v", o, want)
+	}
+	class, got, err := GetVendorInfo(o)
+	if class != "PXEClient" || !reflect.DeepEqual(got, sub) || err != nil {
+		t.Errorf("GetVendorInfo() = %q, %v, %v; want PXEClient, %v", class, got, err, sub)
+	}
+
+	o[dhcp4.OptionVendorSpecificInformation] = []byte{6, 2, 8}
+	if _, _, err := GetVendorInfo(o); err == nil {
+		t.Errorf("GetVendorInfo() of malformed option succeeded")
+	}
+
+	if err := SetVendorInfo(o, "", nil); err != nil || len(o) != 0 {
+		t.Errorf("SetVendorInfo(\"\", nil) = %v, left %v", err, o)
+	}
+}
+
+func TestVIVendorInfo(t *testing.T) {
+	o := make(dhcp4.Options)
+	cisco := SubOptions{1: []byte("ztp")}
+	juniper := SubOptions{0: []byte("junos.tgz"), 3: []byte("http")}
+	if err := SetVIVendorInfo(o, dhcp4.EnterpriseCisco, cisco); err != nil {
+		t.Fatalf("SetVIVendorInfo() = %v", err)
+	}
+	if err := SetVIVendorInfo(o, dhcp4.EnterpriseJuniper, juniper); err != nil {
+		t.Fatalf("SetVIVendorInfo() = %v", err)
+	}
+	for ent, want := range map[uint32]SubOptions{
+		dhcp4.EnterpriseCisco:   cisco,
+		dhcp4.EnterpriseJuniper: juniper,
+		1:                       nil,
+	} {
+		if got, err := GetVIVendorInfo(o, ent); !reflect.DeepEqual(got, want) || err != nil {
+			t.Errorf("GetVIVendorInfo(%d) = %v, %v; want %v", ent, got, err, want)
+		}
+	}
+
+	if err := SetVIVendorInfo(o, dhcp4.EnterpriseCisco, nil); err != nil {
+		t.Fatalf("SetVIVendorInfo(nil) = %v", err)
+	}
+	if got, _ := GetVIVendorInfo(o, dhcp4.EnterpriseCisco); got != nil {
+		t.Errorf("GetVIVendorInfo() after removal = %v, want nil", got)
+	}
+	if err := SetVIVendorInfo(o, dhcp4.EnterpriseJuniper, nil); err != nil || len(o) != 0 {
+		t.Errorf("SetVIVendorInfo(nil) = %v, left %v", err, o)
+	}
+
+	o[dhcp4.OptionVIVendorSpecificInformation] = []byte{0, 0, 0, 9, 3, 1}
+	if _, err := GetVIVendorInfo(o, dhcp4.EnterpriseCisco); err == nil {
+		t.Errorf("GetVIVendorInfo() of malformed option succeeded")
+	}
+}
+
+func TestLookupVendorProfile(t *testing.T) {
+	for _, tt := range []struct {
+		class string
+		want  *VendorProfile
+	}{
+		{"PXEClient", PXEProfile},
+		{"PXEClient:Arch:00007:UNDI:003016", PXEProfile},
+		{"MSFT 5.0", nil},
+		{"", nil},
+	} {
+		if got := LookupVendorProfile(tt.class); got != tt.want {
+			t.Errorf("LookupVendorProfile(%q) = %v, want %v", tt.class, got, tt.want)
+		}
+	}
+	if got := PXEProfile.SubOptionName(PXEBootMenu); got != "boot menu" {
+		t.Errorf("SubOptionName(%d) = %q, want boot menu", PXEBootMenu, got)
+	}
+	if got := PXEProfile.SubOptionName(200); got != "sub-option 200" {
+		t.Errorf("SubOptionName(200) = %q, want sub-option 200", got)
+	}
+}
+
+func TestPXEMenu(t *testing.T) {
+	menu := PXEMenu{
+		{Type: 0, Description: "Local"},
+		{Type: 0x8000, Description: "Install"},
+	}
+	wire := []byte("\x00\x00\x05Local\x80\x00\x07Install")
+	if got, err := menu.MarshalBinary(); err != nil || !bytes.Equal(got, wire) {
+		t.Errorf("MarshalBinary() = %q, %v; want %q", got, err, wire)
+	}
+	if got, err := ParsePXEMenu(wire); err != nil || !reflect.DeepEqual(got, menu) {
+		t.Errorf("ParsePXEMenu(%q) = %v, %v; want %v", wire, got, err, menu)
+	}
+	if got, err := ParsePXEMenu(wire[:len(wire)-1]); err == nil {
+		t.Errorf("ParsePXEMenu() of truncated menu = %v, want error", got)
+	}
+	if _, err := (PXEMenu{{Description: strings.Repeat("x", 256)}}).MarshalBinary(); err == nil {
+		t.Errorf("MarshalBinary() of a 256-byte description succeeded")
+	}
+}
+
+func TestPXEPrompt(t *testing.T) {
+	p := PXEPrompt{Timeout: 10, Prompt: "Press F8"}
+	wire := []byte("\x0aPress F8")
+	if got, err := p.MarshalBinary(); err != nil || !bytes.Equal(got, wire) {
+		t.Errorf("MarshalBinary() = %q, %v; want %q", got, err, wire)
+	}
+	if got, err := ParsePXEPrompt(wire); err != nil || got != p {
+		t.Errorf("ParsePXEPrompt(%q) = %v, %v; want %v", wire, got, err, p)
+	}
+	if got, err := ParsePXEPrompt(nil); err == nil {
+		t.Errorf("ParsePXEPrompt(nil) = %v, want error", got)
+	}
+}
+
+func TestPXEItem(t *testing.T) {
+	i := PXEItem{Type: 0x8001, Layer: 2}
+	wire := []byte{0x80, 0x01, 0, 2}
+	if got, err := i.MarshalBinary(); err != nil || !bytes.Equal(got, wire) {
+		t.Errorf("MarshalBinary() = %v, %v; want %v", got, err, wire)
+	}
+	if got, err := ParsePXEItem(wire); err != nil || got != i {
+		t.Errorf("ParsePXEItem(%v) = %v, %v; want %v", wire, got, err, i)
+	}
+	if got, err := ParsePXEItem(wire[:3]); err == nil {
+		t.Errorf("ParsePXEItem() of 3 bytes = %v, want error", got)
+	}
+}
+
+func TestDecodeVendorInfo(t *testing.T) {
+	// A vendor encoding option 43 as a plain string.
+	RegisterVendorDecoder("acme", func(b []byte) (interface{}, error) {
+		if len(b) == 0 {
+			return nil, errors.New("empty")
+		}
+		return string(b), nil
+	})
+	defer RegisterVendorDecoder("acme", nil)
+
+	pxe := []byte{6, 1, 8, 255}
+	for _, tt := range []struct {
+		desc    string
+		class   string
+		sent    string
+		v       []byte
+		want    interface{}
+		wantErr bool
+	}{
+		{desc: "absent", class: "PXEClient"},
+		{desc: "PXE", class: "PXEClient:Arch:00000:UNDI:002001", v: pxe, want: SubOptions{PXEDiscoveryControl: {PXESkipDiscovery}}},
+		{desc: "class of the options", sent: "PXEClient", v: pxe, want: SubOptions{PXEDiscoveryControl: {PXESkipDiscovery}}},
+		{desc: "malformed PXE", class: "PXEClient", v: []byte{6, 5, 1}, wantErr: true},
+		{desc: "registered", class: "acme-router", v: []byte("hello"), want: "hello"},
+		{desc: "registered fails", class: "acme-router", v: []byte{}, wantErr: true},
+		{desc: "unknown class", class: "MSFT 5.0", v: []byte{6, 5, 1}, want: RawVendorInfo{6, 5, 1}},
+		{desc: "no class", v: []byte{6, 5, 1}, want: RawVendorInfo{6, 5, 1}},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			o := make(dhcp4.Options)
+			o.SetVendorClassIdentifier(tt.sent)
+			if tt.v != nil {
+				o.AddRaw(dhcp4.OptionVendorSpecificInformation, tt.v)
+			}
+			got, err := DecodeVendorInfo(tt.class, o)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DecodeVendorInfo() = %v, want error: %t", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DecodeVendorInfo() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegisterVendorDecoderOverride(t *testing.T) {
+	// A vendor whose class starts with "PXEClient" but whose option 43 is
+	// not encapsulated options.
+	RegisterVendorDecoder("PXEClient:Arch:00099", func(b []byte) (interface{}, error) {
+		return RawVendorInfo(b), nil
+	})
+	defer RegisterVendorDecoder("PXEClient:Arch:00099", nil)
+
+	o := make(dhcp4.Options)
+	o.AddRaw(dhcp4.OptionVendorSpecificInformation, []byte{6, 5, 1})
+	if got, err := DecodeVendorInfo("PXEClient:Arch:00099:UNDI:003016", o); err != nil || !reflect.DeepEqual(got, RawVendorInfo{6, 5, 1}) {
+		t.Errorf("DecodeVendorInfo() = %v, %v; want raw bytes", got, err)
+	}
+	if _, err := DecodeVendorInfo("PXEClient:Arch:00007:UNDI:003016", o); err == nil {
+		t.Errorf("DecodeVendorInfo() of other PXE clients did not use the PXE decoder")
+	}
+}
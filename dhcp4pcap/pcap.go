@@ -0,0 +1,161 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package dhcp4pcap reads DHCPv4 packets from pcap and pcapng captures, such
+// as those of tcpdump, and writes DHCPv4 traffic to pcap captures for
+// analysis with tools like Wireshark.
+package dhcp4pcap
+
+import (
+	"encoding/binary"
+	"net"
+)
+
+// Link types of captures, as listed in the tcpdump.org link-layer header
+// types.
+const (
+	LinkTypeEthernet = 1
+	LinkTypeRaw      = 101
+	LinkTypeLinuxSLL = 113
+	LinkTypeIPv4     = 228
+)
+
+// DHCP ports. Frames to or from other ports are not DHCP traffic.
+const (
+	serverPort = 67
+	clientPort = 68
+)
+
+const (
+	ethernetHeaderLen = 14
+	sllHeaderLen      = 16
+	ipv4HeaderLen     = 20
+	udpHeaderLen      = 8
+
+	etherTypeIPv4 = 0x0800
+	etherTypeVLAN = 0x8100
+	etherTypeQinQ = 0x88a8
+
+	protocolUDP = 17
+)
+
+// decodeFrame returns the addresses and UDP payload of a frame of linkType,
+// or false if the frame is not an unfragmented IPv4 UDP datagram.
+func decodeFrame(linkType int, frame []byte) (src, dst *net.UDPAddr, payload []byte, ok bool) {
+	switch linkType {
+	case LinkTypeEthernet:
+		if len(frame) < ethernetHeaderLen {
+			return nil, nil, nil, false
+		}
+		etherType := binary.BigEndian.Uint16(frame[12:])
+		frame = frame[ethernetHeaderLen:]
+		for etherType == etherTypeVLAN || etherType == etherTypeQinQ {
+			if len(frame) < 4 {
+				return nil, nil, nil, false
+			}
+			etherType = binary.BigEndian.Uint16(frame[2:])
+			frame = frame[4:]
+		}
+		if etherType != etherTypeIPv4 {
+			return nil, nil, nil, false
+		}
+
+	case LinkTypeLinuxSLL:
+		if len(frame) < sllHeaderLen || binary.BigEndian.Uint16(frame[14:]) != etherTypeIPv4 {
+			return nil, nil, nil, false
+		}
+		frame = frame[sllHeaderLen:]
+
+	case LinkTypeRaw, LinkTypeIPv4:
+
+	default:
+		return nil, nil, nil, false
+	}
+	return decodeIPv4(frame)
+}
+
+// decodeIPv4 returns the addresses and UDP payload of the IPv4 packet b.
+func decodeIPv4(b []byte) (src, dst *net.UDPAddr, payload []byte, ok bool) {
+	if len(b) < ipv4HeaderLen || b[0]>>4 != 4 {
+		return nil, nil, nil, false
+	}
+	ihl := int(b[0]&0xf) * 4
+	total := int(binary.BigEndian.Uint16(b[2:]))
+	// Fragments carry no or only part of the UDP datagram.
+	fragmented := binary.BigEndian.Uint16(b[6:])&0x3fff != 0
+	if ihl < ipv4HeaderLen || total < ihl+udpHeaderLen || total > len(b) || fragmented || b[9] != protocolUDP {
+		return nil, nil, nil, false
+	}
+	udp := b[ihl:total]
+	length := int(binary.BigEndian.Uint16(udp[4:]))
+	if length < udpHeaderLen || length > len(udp) {
+		return nil, nil, nil, false
+	}
+	src = &net.UDPAddr{IP: net.IP(append([]byte(nil), b[12:16]...)), Port: int(binary.BigEndian.Uint16(udp[0:]))}
+	dst = &net.UDPAddr{IP: net.IP(append([]byte(nil), b[16:20]...)), Port: int(binary.BigEndian.Uint16(udp[2:]))}
+	return src, dst, udp[udpHeaderLen:length], true
+}
+
+// isDHCP returns whether a datagram from src to dst is DHCP traffic.
+func isDHCP(src, dst *net.UDPAddr) bool {
+	for _, port := range []int{src.Port, dst.Port} {
+		if port == serverPort || port == clientPort {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeIPv4 returns an IPv4 packet carrying payload in a UDP datagram from
+// src to dst.
+func encodeIPv4(src, dst *net.UDPAddr, payload []byte) []byte {
+	b := make([]byte, ipv4HeaderLen+udpHeaderLen+len(payload))
+	b[0] = 4<<4 | ipv4HeaderLen/4
+	binary.BigEndian.PutUint16(b[2:], uint16(len(b)))
+	b[8] = 64 // TTL
+	b[9] = protocolUDP
+	copy(b[12:16], addrIP(src))
+	copy(b[16:20], addrIP(dst))
+	binary.BigEndian.PutUint16(b[10:], checksum(b[:ipv4HeaderLen]))
+
+	// The UDP checksum is optional in IPv4 and left 0.
+	udp := b[ipv4HeaderLen:]
+	binary.BigEndian.PutUint16(udp[0:], uint16(addrPort(src)))
+	binary.BigEndian.PutUint16(udp[2:], uint16(addrPort(dst)))
+	binary.BigEndian.PutUint16(udp[4:], uint16(len(udp)))
+	copy(udp[udpHeaderLen:], payload)
+	return b
+}
+
+// checksum returns the Internet checksum of b as defined by RFC 1071.
+func checksum(b []byte) uint16 {
+	var sum uint32
+	for ; len(b) >= 2; b = b[2:] {
+		sum += uint32(binary.BigEndian.Uint16(b))
+	}
+	if len(b) == 1 {
+		sum += uint32(b[0]) << 8
+	}
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum)
+}
+
+// addrIP returns the IPv4 address of a, or 0.0.0.0 if it has none.
+func addrIP(a *net.UDPAddr) net.IP {
+	if a != nil {
+		if ip := a.IP.To4(); ip != nil {
+			return ip
+		}
+	}
+	return net.IPv4zero.To4()
+}
+
+func addrPort(a *net.UDPAddr) int {
+	if a == nil {
+		return 0
+	}
+	return a.Port
+}
@@ -0,0 +1,211 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4pcap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+)
+
+var (
+	clientAddr = &net.UDPAddr{IP: net.IPv4zero.To4(), Port: clientPort}
+	serverAddr = &net.UDPAddr{IP: net.IP{192, 168, 0, 1}, Port: serverPort}
+	bcastAddr  = &net.UDPAddr{IP: net.IPv4bcast.To4(), Port: serverPort}
+)
+
+func newPacket(t *testing.T, typ dhcp4.MessageType) []byte {
+	p := dhcp4.NewPacket(dhcp4.BootRequest)
+	p.TransactionID = [4]byte{1, 2, 3, 4}
+	p.CHAddr = net.HardwareAddr{2, 0, 0, 0, 0, 1}
+	p.Options.SetMessageType(typ)
+	b, err := p.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestWriterReader(t *testing.T) {
+	discover, request := newPacket(t, dhcp4.DHCPDiscover), newPacket(t, dhcp4.DHCPRequest)
+	start := time.Date(2018, 6, 1, 12, 0, 0, 123456789, time.UTC)
+
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, rec := range []struct {
+		src, dst *net.UDPAddr
+		payload  []byte
+	}{
+		{clientAddr, bcastAddr, discover},
+		// Not DHCP.
+		{&net.UDPAddr{IP: net.IP{10, 0, 0, 1}, Port: 53}, &net.UDPAddr{IP: net.IP{10, 0, 0, 2}, Port: 53}, discover},
+		// Not a DHCP packet.
+		{clientAddr, bcastAddr, []byte("garbage")},
+		{clientAddr, serverAddr, request},
+	} {
+		if err := w.WritePacket(start.Add(time.Duration(i)*time.Second), rec.src, rec.dst, rec.payload); err != nil {
+			t.Fatalf("WritePacket = %v", err)
+		}
+	}
+
+	records, err := ReadAll(&buf)
+	if err != nil {
+		t.Fatalf("ReadAll = %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("ReadAll returned %d records, want 2", len(records))
+	}
+	for i, want := range []struct {
+		time     time.Time
+		src, dst *net.UDPAddr
+		typ      dhcp4.MessageType
+	}{
+		{start, clientAddr, bcastAddr, dhcp4.DHCPDiscover},
+		{start.Add(3 * time.Second), clientAddr, serverAddr, dhcp4.DHCPRequest},
+	} {
+		got := records[i]
+		if !got.Time.Equal(want.time) {
+			t.Errorf("record %d: time %v, want %v", i, got.Time, want.time)
+		}
+		if !reflect.DeepEqual(got.Src, want.src) || !reflect.DeepEqual(got.Dst, want.dst) {
+			t.Errorf("record %d: %v -> %v, want %v -> %v", i, got.Src, got.Dst, want.src, want.dst)
+		}
+		if typ := got.Packet.Options.MessageType(); typ != want.typ {
+			t.Errorf("record %d: message type %v, want %v", i, typ, want.typ)
+		}
+	}
+}
+
+// ethernetFrame returns payload in an Ethernet frame with an 802.1Q tag.
+func ethernetFrame(src, dst *net.UDPAddr, payload []byte) []byte {
+	b := make([]byte, 18)
+	copy(b[0:], net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+	copy(b[6:], net.HardwareAddr{2, 0, 0, 0, 0, 1})
+	binary.BigEndian.PutUint16(b[12:], etherTypeVLAN)
+	binary.BigEndian.PutUint16(b[14:], 100)
+	binary.BigEndian.PutUint16(b[16:], etherTypeIPv4)
+	return append(b, encodeIPv4(src, dst, payload)...)
+}
+
+// pcapngBlock returns a pcapng block of typ with body.
+func pcapngBlock(order binary.ByteOrder, typ uint32, body []byte) []byte {
+	for len(body)%4 != 0 {
+		body = append(body, 0)
+	}
+	n := uint32(12 + len(body))
+	b := make([]byte, 8, n)
+	order.PutUint32(b[0:], typ)
+	order.PutUint32(b[4:], n)
+	b = append(b, body...)
+	b = append(b, 0, 0, 0, 0)
+	order.PutUint32(b[n-4:], n)
+	return b
+}
+
+func TestReaderPcapng(t *testing.T) {
+	offer := newPacket(t, dhcp4.DHCPOffer)
+	frame := ethernetFrame(serverAddr, bcastAddr, offer)
+
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		t.Run(order.String(), func(t *testing.T) {
+			var capture []byte
+			block := func(typ uint32, body []byte) {
+				capture = append(capture, pcapngBlock(order, typ, body)...)
+			}
+
+			shb := make([]byte, 16)
+			order.PutUint32(shb[0:], byteOrderMagic)
+			order.PutUint16(shb[4:], 1)
+			binary.LittleEndian.PutUint64(shb[8:], ^uint64(0))
+			block(blockSectionHeader, shb)
+
+			// An interface with timestamps in nanoseconds.
+			idb := make([]byte, 8, 16)
+			order.PutUint16(idb[0:], LinkTypeEthernet)
+			opt := make([]byte, 8)
+			order.PutUint16(opt[0:], optionIfTSResol)
+			order.PutUint16(opt[2:], 1)
+			opt[4] = 9
+			block(blockInterface, append(idb, opt...))
+
+			ts := uint64(time.Date(2018, 6, 1, 12, 0, 0, 5, time.UTC).UnixNano())
+			epb := make([]byte, 20)
+			order.PutUint32(epb[4:], uint32(ts>>32))
+			order.PutUint32(epb[8:], uint32(ts))
+			order.PutUint32(epb[12:], uint32(len(frame)))
+			order.PutUint32(epb[16:], uint32(len(frame)))
+			block(blockEnhancedPacket, append(epb, frame...))
+
+			// Some other block.
+			block(0x00000004, make([]byte, 8))
+
+			spb := make([]byte, 4)
+			order.PutUint32(spb[0:], uint32(len(frame)))
+			block(blockSimplePacket, append(spb, frame...))
+
+			records, err := ReadAll(bytes.NewReader(capture))
+			if err != nil {
+				t.Fatalf("ReadAll = %v", err)
+			}
+			if len(records) != 2 {
+				t.Fatalf("ReadAll returned %d records, want 2", len(records))
+			}
+			if want := time.Unix(0, int64(ts)); !records[0].Time.Equal(want) {
+				t.Errorf("time %v, want %v", records[0].Time, want)
+			}
+			if !records[1].Time.IsZero() {
+				t.Errorf("time of simple packet %v, want zero", records[1].Time)
+			}
+			for _, rec := range records {
+				if !reflect.DeepEqual(rec.Src, serverAddr) || rec.Packet.Options.MessageType() != dhcp4.DHCPOffer {
+					t.Errorf("got %v from %v, want DHCPOFFER from %v", rec.Packet, rec.Src, serverAddr)
+				}
+			}
+		})
+	}
+}
+
+func TestReaderPcapBigEndian(t *testing.T) {
+	frame := encodeIPv4(clientAddr, bcastAddr, newPacket(t, dhcp4.DHCPDiscover))
+	var b bytes.Buffer
+	h := make([]byte, pcapHeaderLen)
+	binary.BigEndian.PutUint32(h[0:], pcapMagic)
+	binary.BigEndian.PutUint32(h[20:], LinkTypeIPv4)
+	b.Write(h)
+	r := make([]byte, pcapRecordHeaderLen)
+	binary.BigEndian.PutUint32(r[0:], 1000)
+	binary.BigEndian.PutUint32(r[4:], 250000)
+	binary.BigEndian.PutUint32(r[8:], uint32(len(frame)))
+	binary.BigEndian.PutUint32(r[12:], uint32(len(frame)))
+	b.Write(r)
+	b.Write(frame)
+
+	records, err := ReadAll(&b)
+	if err != nil {
+		t.Fatalf("ReadAll = %v", err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("ReadAll returned %d records, want 1", len(records))
+	}
+	if want := time.Unix(1000, 250000000); !records[0].Time.Equal(want) {
+		t.Errorf("time %v, want %v", records[0].Time, want)
+	}
+}
+
+func TestNewReaderInvalid(t *testing.T) {
+	for _, b := range [][]byte{nil, []byte("not a capture at all, really not")} {
+		if _, err := NewReader(bytes.NewReader(b)); err == nil {
+			t.Errorf("NewReader(%q) = nil, want error", b)
+		}
+	}
+}
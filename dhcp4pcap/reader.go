@@ -0,0 +1,278 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4pcap
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+)
+
+// pcapng block types, see draft-ietf-opsawg-pcapng.
+const (
+	blockSectionHeader   = 0x0a0d0d0a
+	blockInterface       = 0x00000001
+	blockSimplePacket    = 0x00000003
+	blockEnhancedPacket  = 0x00000006
+	byteOrderMagic       = 0x1a2b3c4d
+	optionEndOfOpt       = 0
+	optionIfTSResol      = 9
+	defaultTSResol       = 6
+	maxBlockLen          = 16 << 20
+	blockHeaderLen       = 8
+	sectionHeaderBodyLen = 16
+)
+
+// Record is a DHCP packet read from a capture.
+type Record struct {
+	// Time is when the packet was captured. It is zero if the capture
+	// does not record it.
+	Time time.Time
+
+	// Src and Dst are the addresses the packet was sent from and to.
+	Src, Dst *net.UDPAddr
+
+	Packet *dhcp4.Packet
+}
+
+// interfaceInfo describes a pcapng interface.
+type interfaceInfo struct {
+	linkType int
+
+	// perSecond is the number of timestamp units per second.
+	perSecond uint64
+}
+
+// Reader reads DHCP packets from a pcap or pcapng capture.
+type Reader struct {
+	r     *bufio.Reader
+	order binary.ByteOrder
+
+	// ng is whether the capture is pcapng. For pcap captures, ifaces
+	// holds the only interface.
+	ng     bool
+	ifaces []interfaceInfo
+}
+
+// NewReader reads the file header of the pcap or pcapng capture r and
+// returns a Reader of its DHCP packets.
+func NewReader(r io.Reader) (*Reader, error) {
+	pr := &Reader{r: bufio.NewReader(r)}
+	magic, err := pr.r.Peek(4)
+	if err != nil {
+		return nil, fmt.Errorf("reading capture header: %v", err)
+	}
+	if binary.LittleEndian.Uint32(magic) == blockSectionHeader {
+		pr.ng = true
+		return pr, nil
+	}
+
+	var h [pcapHeaderLen]byte
+	if _, err := io.ReadFull(pr.r, h[:]); err != nil {
+		return nil, fmt.Errorf("reading capture header: %v", err)
+	}
+	perSecond := uint64(1e6)
+	switch {
+	case binary.LittleEndian.Uint32(h[:]) == pcapMagic:
+		pr.order = binary.LittleEndian
+	case binary.BigEndian.Uint32(h[:]) == pcapMagic:
+		pr.order = binary.BigEndian
+	case binary.LittleEndian.Uint32(h[:]) == pcapNanoMagic:
+		pr.order, perSecond = binary.LittleEndian, 1e9
+	case binary.BigEndian.Uint32(h[:]) == pcapNanoMagic:
+		pr.order, perSecond = binary.BigEndian, 1e9
+	default:
+		return nil, fmt.Errorf("not a pcap or pcapng capture (magic %x)", h[:4])
+	}
+	pr.ifaces = []interfaceInfo{{linkType: int(pr.order.Uint32(h[20:]) & 0xffff), perSecond: perSecond}}
+	return pr, nil
+}
+
+// Next returns the next DHCP packet of the capture, or io.EOF at its end.
+// Frames that are not DHCP over IPv4 and UDP, or do not parse as DHCP, are
+// skipped.
+func (pr *Reader) Next() (*Record, error) {
+	for {
+		t, linkType, frame, err := pr.nextFrame()
+		if err != nil {
+			return nil, err
+		}
+		src, dst, payload, ok := decodeFrame(linkType, frame)
+		if !ok || !isDHCP(src, dst) {
+			continue
+		}
+		p, err := dhcp4.ParsePacket(payload)
+		if err != nil {
+			continue
+		}
+		return &Record{Time: t, Src: src, Dst: dst, Packet: p}, nil
+	}
+}
+
+// ReadAll returns all DHCP packets of the capture r.
+func ReadAll(r io.Reader) ([]*Record, error) {
+	pr, err := NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	var records []*Record
+	for {
+		rec, err := pr.Next()
+		if err == io.EOF {
+			return records, nil
+		} else if err != nil {
+			return records, err
+		}
+		records = append(records, rec)
+	}
+}
+
+// nextFrame returns the next captured frame, or io.EOF at the end of the
+// capture.
+func (pr *Reader) nextFrame() (time.Time, int, []byte, error) {
+	if pr.ng {
+		return pr.nextBlock()
+	}
+	var h [pcapRecordHeaderLen]byte
+	if _, err := io.ReadFull(pr.r, h[:]); err == io.EOF {
+		return time.Time{}, 0, nil, io.EOF
+	} else if err != nil {
+		return time.Time{}, 0, nil, fmt.Errorf("reading record header: %v", err)
+	}
+	n := pr.order.Uint32(h[8:])
+	if n > maxBlockLen {
+		return time.Time{}, 0, nil, fmt.Errorf("record of %d bytes is too large", n)
+	}
+	frame := make([]byte, n)
+	if _, err := io.ReadFull(pr.r, frame); err != nil {
+		return time.Time{}, 0, nil, fmt.Errorf("reading record: %v", err)
+	}
+	iface := pr.ifaces[0]
+	sec, frac := pr.order.Uint32(h[0:]), pr.order.Uint32(h[4:])
+	t := time.Unix(int64(sec), int64(uint64(frac)*uint64(time.Second)/iface.perSecond))
+	return t, iface.linkType, frame, nil
+}
+
+// nextBlock returns the frame of the next pcapng packet block.
+func (pr *Reader) nextBlock() (time.Time, int, []byte, error) {
+	for {
+		typ, body, err := pr.readBlock()
+		if err != nil {
+			return time.Time{}, 0, nil, err
+		}
+		switch typ {
+		case blockInterface:
+			if len(body) < 8 {
+				return time.Time{}, 0, nil, errors.New("short interface description block")
+			}
+			pr.ifaces = append(pr.ifaces, interfaceInfo{
+				linkType:  int(pr.order.Uint16(body[0:])),
+				perSecond: pr.perSecond(body[8:]),
+			})
+
+		case blockEnhancedPacket:
+			if len(body) < 20 {
+				return time.Time{}, 0, nil, errors.New("short enhanced packet block")
+			}
+			id := pr.order.Uint32(body[0:])
+			n := pr.order.Uint32(body[12:])
+			if int(id) >= len(pr.ifaces) || int(n) > len(body)-20 {
+				return time.Time{}, 0, nil, errors.New("invalid enhanced packet block")
+			}
+			iface := pr.ifaces[id]
+			ts := uint64(pr.order.Uint32(body[4:]))<<32 | uint64(pr.order.Uint32(body[8:]))
+			t := time.Unix(int64(ts/iface.perSecond), int64(ts%iface.perSecond*uint64(time.Second)/iface.perSecond))
+			return t, iface.linkType, body[20 : 20+n], nil
+
+		case blockSimplePacket:
+			if len(body) < 4 || len(pr.ifaces) == 0 {
+				return time.Time{}, 0, nil, errors.New("invalid simple packet block")
+			}
+			n := int(pr.order.Uint32(body[0:]))
+			if n > len(body)-4 {
+				n = len(body) - 4
+			}
+			return time.Time{}, pr.ifaces[0].linkType, body[4 : 4+n], nil
+		}
+	}
+}
+
+// readBlock reads a pcapng block and returns its type and body. Section
+// header blocks are handled here, as they set the byte order.
+func (pr *Reader) readBlock() (uint32, []byte, error) {
+	var h [blockHeaderLen]byte
+	if _, err := io.ReadFull(pr.r, h[:]); err == io.EOF {
+		return 0, nil, io.EOF
+	} else if err != nil {
+		return 0, nil, fmt.Errorf("reading block header: %v", err)
+	}
+	typ := binary.LittleEndian.Uint32(h[0:])
+	if typ == blockSectionHeader {
+		// A new section, possibly of another byte order.
+		bom, err := pr.r.Peek(4)
+		if err != nil {
+			return 0, nil, fmt.Errorf("reading section header: %v", err)
+		}
+		switch {
+		case binary.LittleEndian.Uint32(bom) == byteOrderMagic:
+			pr.order = binary.LittleEndian
+		case binary.BigEndian.Uint32(bom) == byteOrderMagic:
+			pr.order = binary.BigEndian
+		default:
+			return 0, nil, fmt.Errorf("invalid byte-order magic %x", bom)
+		}
+		pr.ifaces = nil
+	} else if pr.order == nil {
+		return 0, nil, errors.New("pcapng capture does not start with a section header")
+	}
+	typ = pr.order.Uint32(h[0:])
+	n := pr.order.Uint32(h[4:])
+	if n < blockHeaderLen+4 || n%4 != 0 || n > maxBlockLen {
+		return 0, nil, fmt.Errorf("invalid block length %d", n)
+	}
+	b := make([]byte, n-blockHeaderLen)
+	if _, err := io.ReadFull(pr.r, b); err != nil {
+		return 0, nil, fmt.Errorf("reading block: %v", err)
+	}
+	if typ == blockSectionHeader && len(b) < sectionHeaderBodyLen+4 {
+		return 0, nil, errors.New("short section header block")
+	}
+	// Leave out the trailing copy of the length.
+	return typ, b[:len(b)-4], nil
+}
+
+// perSecond returns the number of timestamp units per second given by the
+// if_tsresol option of the interface description block options opts.
+func (pr *Reader) perSecond(opts []byte) uint64 {
+	resol := byte(defaultTSResol)
+	for len(opts) >= 4 {
+		code, n := pr.order.Uint16(opts[0:]), int(pr.order.Uint16(opts[2:]))
+		padded := (n + 3) &^ 3
+		if code == optionEndOfOpt || 4+padded > len(opts) {
+			break
+		}
+		if code == optionIfTSResol && n == 1 {
+			resol = opts[4]
+		}
+		opts = opts[4+padded:]
+	}
+	if resol&0x80 != 0 {
+		if resol&0x7f > 63 {
+			return 1 << 63
+		}
+		return 1 << (resol & 0x7f)
+	}
+	perSecond := uint64(1)
+	for i := byte(0); i < resol && i < 19; i++ {
+		perSecond *= 10
+	}
+	return perSecond
+}
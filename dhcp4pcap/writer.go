@@ -0,0 +1,67 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4pcap
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// pcapMagic is the magic number of pcap files with timestamps in
+	// microseconds, and pcapNanoMagic that of files with timestamps in
+	// nanoseconds.
+	pcapMagic     = 0xa1b2c3d4
+	pcapNanoMagic = 0xa1b23c4d
+
+	pcapHeaderLen       = 24
+	pcapRecordHeaderLen = 16
+
+	snapLen = 65535
+)
+
+// Writer writes UDP datagrams to a pcap capture of link type LinkTypeRaw,
+// with IPv4 and UDP headers made up from their addresses.
+//
+// A Writer is safe for concurrent use.
+type Writer struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriter writes the pcap file header to w and returns a Writer writing
+// datagrams to it.
+func NewWriter(w io.Writer) (*Writer, error) {
+	var h [pcapHeaderLen]byte
+	binary.LittleEndian.PutUint32(h[0:], pcapNanoMagic)
+	binary.LittleEndian.PutUint16(h[4:], 2)
+	binary.LittleEndian.PutUint16(h[6:], 4)
+	binary.LittleEndian.PutUint32(h[16:], snapLen)
+	binary.LittleEndian.PutUint32(h[20:], LinkTypeRaw)
+	if _, err := w.Write(h[:]); err != nil {
+		return nil, err
+	}
+	return &Writer{w: w}, nil
+}
+
+// WritePacket writes payload, a datagram sent from src to dst at t. Nil
+// addresses are written as 0.0.0.0 port 0.
+func (w *Writer) WritePacket(t time.Time, src, dst *net.UDPAddr, payload []byte) error {
+	frame := encodeIPv4(src, dst, payload)
+	b := make([]byte, pcapRecordHeaderLen+len(frame))
+	binary.LittleEndian.PutUint32(b[0:], uint32(t.Unix()))
+	binary.LittleEndian.PutUint32(b[4:], uint32(t.Nanosecond()))
+	binary.LittleEndian.PutUint32(b[8:], uint32(len(frame)))
+	binary.LittleEndian.PutUint32(b[12:], uint32(len(frame)))
+	copy(b[pcapRecordHeaderLen:], frame)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, err := w.w.Write(b)
+	return err
+}
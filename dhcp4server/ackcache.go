@@ -0,0 +1,90 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4server
+
+import (
+	"net"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+)
+
+// WithACKCache configures the server to remember the last ACK sent to each
+// client for window, and to send it again when the client retransmits its
+// REQUEST (same transaction ID, requested address and ciaddr) in that
+// window, instead of handling the REQUEST again. Lease schedulers, boot
+// deciders and lease renewals then run once per REQUEST however often the
+// client retransmits it.
+//
+// Default is 0, which disables the cache.
+func WithACKCache(window time.Duration) ServerOpt {
+	return func(s *Server) {
+		s.ackWindow = window
+	}
+}
+
+// cachedACK is the last ACK sent to a client.
+type cachedACK struct {
+	xid               [4]byte
+	requested, ciaddr net.IP
+	ack               *dhcp4.Packet
+	expires           time.Time
+}
+
+// matches returns whether request is a retransmission of the REQUEST ACKed
+// by c.
+func (c *cachedACK) matches(request *dhcp4.Packet) bool {
+	return request.TransactionID == c.xid &&
+		request.Options.RequestedIPAddress().Equal(c.requested) &&
+		request.CIAddr.Equal(c.ciaddr)
+}
+
+// cachedResponse returns the ACK to send again in response to request, or
+// nil if request is not a retransmission of a recently ACKed REQUEST.
+//
+// s.mu must be held.
+func (s *Server) cachedResponse(request *dhcp4.Packet, now time.Time) *dhcp4.Packet {
+	if s.ackWindow <= 0 || request.Options.MessageType() != dhcp4.DHCPRequest {
+		return nil
+	}
+	key, ok := s.keyPolicy.requestKey(request)
+	if !ok {
+		return nil
+	}
+	c, ok := s.acks[key]
+	if !ok || !now.Before(c.expires) || !c.matches(request) {
+		return nil
+	}
+	return c.ack
+}
+
+// cacheResponse remembers response if it is an ACK of the REQUEST request.
+//
+// s.mu must be held.
+func (s *Server) cacheResponse(request, response *dhcp4.Packet, now time.Time) {
+	if s.ackWindow <= 0 || response.Options.MessageType() != dhcp4.DHCPACK ||
+		request.Options.MessageType() != dhcp4.DHCPRequest {
+		return
+	}
+	key, ok := s.keyPolicy.requestKey(request)
+	if !ok {
+		return
+	}
+	for k, c := range s.acks {
+		if !now.Before(c.expires) {
+			delete(s.acks, k)
+		}
+	}
+	if s.acks == nil {
+		s.acks = make(map[bindingKey]*cachedACK)
+	}
+	s.acks[key] = &cachedACK{
+		xid:       request.TransactionID,
+		requested: request.Options.RequestedIPAddress(),
+		ciaddr:    request.CIAddr,
+		ack:       response,
+		expires:   now.Add(s.ackWindow),
+	}
+}
@@ -0,0 +1,103 @@
+package dhcp4server
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+	"github.com/mergetb/dhcp4/dhcp4opts"
+)
+
+func TestACKCache(t *testing.T) {
+	for _, tt := range []struct {
+		desc string
+		opts []ServerOpt
+
+		// retransmit changes the retransmitted REQUEST.
+		retransmit func(*dhcp4.Packet)
+
+		// wantCalls is how often the lease scheduler runs for the
+		// DISCOVER and both REQUESTs.
+		wantCalls int
+	}{
+		{desc: "disabled", wantCalls: 3},
+		{desc: "retransmission", opts: []ServerOpt{WithACKCache(time.Minute)}, wantCalls: 2},
+		{
+			desc:       "new transaction",
+			opts:       []ServerOpt{WithACKCache(time.Minute)},
+			retransmit: func(p *dhcp4.Packet) { p.TransactionID = [4]byte{5, 6, 7, 8} },
+			wantCalls:  3,
+		},
+		{
+			desc: "renewal",
+			opts: []ServerOpt{WithACKCache(time.Minute)},
+			retransmit: func(p *dhcp4.Packet) {
+				p.CIAddr = p.Options.RequestedIPAddress()
+				delete(p.Options, dhcp4.OptionRequestedIPAddress)
+				delete(p.Options, dhcp4.OptionServerIdentifier)
+			},
+			wantCalls: 3,
+		},
+		{desc: "expired", opts: []ServerOpt{WithACKCache(time.Nanosecond)}, wantCalls: 3},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			var calls int
+			opts := append(tt.opts, WithLeaseScheduler(func(context.Context, time.Time, Classification) LeaseDecision {
+				calls++
+				return LeaseDecision{LeaseTime: time.Hour}
+			}))
+			s := newTestServer(t, opts...)
+			mac := net.HardwareAddr{2, 0, 0, 0, 0, 1}
+
+			offer := exchange(t, s, newRequest(dhcp4opts.DHCPDiscover, mac))
+			if offer == nil {
+				t.Fatal("no offer")
+			}
+			request := newRequest(dhcp4opts.DHCPRequest, mac)
+			request.Options.SetRequestedIPAddress(offer.YIAddr)
+			request.Options.SetServerIdentifier(s.ServerID())
+			ack := exchange(t, s, request)
+			if ack == nil || ack.Options.MessageType() != dhcp4.DHCPACK {
+				t.Fatalf("response to REQUEST = %v, want ACK", ack)
+			}
+
+			if tt.retransmit != nil {
+				tt.retransmit(request)
+			}
+			again := exchange(t, s, request)
+			if again == nil || again.Options.MessageType() != dhcp4.DHCPACK {
+				t.Fatalf("response to retransmitted REQUEST = %v, want ACK", again)
+			}
+			if tt.retransmit == nil && !reflect.DeepEqual(again, ack) {
+				t.Errorf("response to retransmitted REQUEST = %v, want %v", again, ack)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("lease scheduler ran %d times, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestACKCacheRelease(t *testing.T) {
+	s := newTestServer(t, WithACKCache(time.Minute))
+	mac := net.HardwareAddr{2, 0, 0, 0, 0, 1}
+
+	offer := exchange(t, s, newRequest(dhcp4opts.DHCPDiscover, mac))
+	if offer == nil {
+		t.Fatal("no offer")
+	}
+	request := newRequest(dhcp4opts.DHCPRequest, mac)
+	request.Options.SetRequestedIPAddress(offer.YIAddr)
+	if ack := exchange(t, s, request); ack == nil || ack.Options.MessageType() != dhcp4.DHCPACK {
+		t.Fatalf("response to REQUEST = %v, want ACK", ack)
+	}
+	exchange(t, s, newRelease(s, mac, offer.YIAddr))
+
+	// The address is released, so the REQUEST is not ACKed again.
+	if resp := exchange(t, s, request); resp != nil && resp.Options.MessageType() == dhcp4.DHCPACK {
+		t.Errorf("response to REQUEST after RELEASE = %v, want no ACK", resp)
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+)
+
+// AdminHandler returns an HTTP handler for the server's admin API.
+//
+// The handler serves:
+//
+//	GET /leases?ip=IP&mac=MAC&from=TIME&to=TIME&at=TIME
+//
+// which returns the active and retained ended leases matching all given
+// filters as a JSON array. Times are in RFC 3339 format; at=TIME is
+// shorthand for from=TIME&to=TIME.
+//
+//	POST /explain?peer=ADDR
+//
+// which takes a DHCP packet in binary as body and returns how the server
+// would handle it if received from UDP address ADDR (default 0.0.0.0:68) as
+// JSON, see Server.Explain.
+//
+//	GET /pool
+//	POST /pool?subnet=CIDR&drain=BOOL
+//
+// which return the pool addresses are allocated from and the bindings
+// outside of it as JSON, and change the pool to subnet CIDR, see
+// Server.ResizePool. If drain is false (the default), shrinking the pool
+// with bindings outside the new pool is refused with status 409 Conflict.
+//
+//	GET /state
+//
+// which returns the runtime state of the server as JSON, see
+// Server.DumpState.
+func (s *Server) AdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/leases", s.serveLeases)
+	mux.HandleFunc("/explain", s.serveExplain)
+	mux.HandleFunc("/pool", s.servePool)
+	mux.HandleFunc("/state", s.serveState)
+	return mux
+}
+
+// leaseJSON is the admin API representation of a LeaseRecord.
+type leaseJSON struct {
+	IP           string     `json:"ip"`
+	HardwareAddr string     `json:"hardware_addr"`
+	Start        time.Time  `json:"start"`
+	End          *time.Time `json:"end,omitempty"`
+}
+
+func newLeaseJSON(r LeaseRecord) leaseJSON {
+	l := leaseJSON{
+		IP:           r.IP.String(),
+		HardwareAddr: r.HardwareAddr.String(),
+		Start:        r.Start,
+	}
+	if !r.Active() {
+		end := r.End
+		l.End = &end
+	}
+	return l
+}
+
+func parseHistoryQuery(v url.Values) (HistoryQuery, error) {
+	var q HistoryQuery
+	if ip := v.Get("ip"); ip != "" {
+		q.IP = net.ParseIP(ip)
+		if q.IP == nil {
+			return q, fmt.Errorf("invalid IP %q", ip)
+		}
+	}
+	if mac := v.Get("mac"); mac != "" {
+		var err error
+		if q.HardwareAddr, err = dhcp4.ParseHardwareAddr(mac); err != nil {
+			return q, err
+		}
+	}
+
+	for _, t := range []struct {
+		key  string
+		dest []*time.Time
+	}{
+		{"at", []*time.Time{&q.From, &q.To}},
+		{"from", []*time.Time{&q.From}},
+		{"to", []*time.Time{&q.To}},
+	} {
+		s := v.Get(t.key)
+		if s == "" {
+			continue
+		}
+		tm, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return q, fmt.Errorf("invalid %s time %q: %v", t.key, s, err)
+		}
+		for _, d := range t.dest {
+			*d = tm
+		}
+	}
+	return q, nil
+}
+
+func (s *Server) serveLeases(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q, err := parseHistoryQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	leases := []leaseJSON{}
+	for _, rec := range s.Leases(q) {
+		leases = append(leases, newLeaseJSON(rec))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(leases)
+}
+
+// explanationJSON is the admin API representation of an Explanation.
+type explanationJSON struct {
+	Decisions []decisionJSON `json:"decisions"`
+	Response  *responseJSON  `json:"response"`
+}
+
+type decisionJSON struct {
+	Stage  string `json:"stage"`
+	Reason string `json:"reason"`
+}
+
+type responseJSON struct {
+	MessageType string `json:"message_type"`
+	YIAddr      string `json:"yiaddr"`
+	SIAddr      string `json:"siaddr"`
+	ServerName  string `json:"server_name,omitempty"`
+	BootFile    string `json:"boot_file,omitempty"`
+}
+
+func newExplanationJSON(e *Explanation) explanationJSON {
+	ej := explanationJSON{Decisions: []decisionJSON{}}
+	for _, d := range e.Decisions {
+		ej.Decisions = append(ej.Decisions, decisionJSON{Stage: d.Stage, Reason: d.Reason})
+	}
+	if p := e.Response; p != nil {
+		ej.Response = &responseJSON{
+			MessageType: p.Options.MessageType().String(),
+			YIAddr:      p.YIAddr.String(),
+			SIAddr:      p.SIAddr.String(),
+			ServerName:  p.ServerName,
+			BootFile:    p.BootFile,
+		}
+	}
+	return ej
+}
+
+func (s *Server) serveExplain(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	peer := &net.UDPAddr{IP: net.IPv4zero, Port: clientPort}
+	if p := r.URL.Query().Get("peer"); p != "" {
+		var err error
+		if peer, err = net.ResolveUDPAddr("udp4", p); err != nil {
+			http.Error(w, fmt.Sprintf("invalid peer %q: %v", p, err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	b, err := ioutil.ReadAll(io.LimitReader(r.Body, maxMessageSize+1))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	pkt, err := dhcp4.ParsePacket(b)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid DHCP packet: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newExplanationJSON(s.Explain(r.Context(), pkt, peer)))
+}
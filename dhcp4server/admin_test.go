@@ -0,0 +1,57 @@
+package dhcp4server
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAdminLeases(t *testing.T) {
+	_, subnet, err := net.ParseCIDR("192.168.1.0/24")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := New(net.IP{192, 168, 0, 1}, subnet, "", "")
+
+	start := time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC)
+	s.history.Add(LeaseRecord{
+		IP:           net.IP{192, 168, 1, 5},
+		HardwareAddr: net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 1},
+		Start:        start,
+		End:          start.Add(2 * time.Hour),
+	})
+
+	for _, tt := range []struct {
+		query      string
+		wantStatus int
+		wantLeases int
+	}{
+		{query: "", wantStatus: http.StatusOK, wantLeases: 1},
+		{query: "?ip=192.168.1.5&at=2018-06-01T13:00:00Z", wantStatus: http.StatusOK, wantLeases: 1},
+		{query: "?mac=0000.5e00.5301&from=2018-06-01T15:00:00Z", wantStatus: http.StatusOK, wantLeases: 0},
+		{query: "?ip=192.168.1.6", wantStatus: http.StatusOK, wantLeases: 0},
+		{query: "?ip=foo", wantStatus: http.StatusBadRequest},
+		{query: "?at=yesterday", wantStatus: http.StatusBadRequest},
+	} {
+		rec := httptest.NewRecorder()
+		s.AdminHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/leases"+tt.query, nil))
+		if rec.Code != tt.wantStatus {
+			t.Errorf("GET /leases%s = %d, want %d", tt.query, rec.Code, tt.wantStatus)
+			continue
+		}
+		if rec.Code != http.StatusOK {
+			continue
+		}
+
+		var leases []leaseJSON
+		if err := json.Unmarshal(rec.Body.Bytes(), &leases); err != nil {
+			t.Fatalf("GET /leases%s returned invalid JSON: %v", tt.query, err)
+		}
+		if len(leases) != tt.wantLeases {
+			t.Errorf("GET /leases%s returned %d leases, want %d", tt.query, len(leases), tt.wantLeases)
+		}
+	}
+}
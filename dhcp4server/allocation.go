@@ -0,0 +1,192 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4server
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"sort"
+)
+
+// AllocationRequest is a client to be bound an address, as passed to an
+// AllocationStrategy.
+type AllocationRequest struct {
+	// Key identifies the client, see KeyPolicy.
+	Key string
+
+	// HardwareAddr is the client's hardware address.
+	HardwareAddr net.HardwareAddr
+
+	// Requested is the address the client asked for, or nil.
+	Requested net.IP
+
+	// Pool is the subnet addresses are allocated from, or nil if its
+	// Leases are not ResizableLeases.
+	Pool *net.IPNet
+
+	leases Leases
+
+	// previous looks up the address last bound to the client.
+	previous func() net.IP
+}
+
+// availableLeases are Leases that tell whether an address is free without
+// looking for another one, as Leases.Free does when it is not.
+type availableLeases interface {
+	available(ip net.IP) bool
+}
+
+var (
+	_ availableLeases = &MemoryLeases{}
+	_ availableLeases = &FileLeases{}
+)
+
+// Free returns whether ip can be bound to the client.
+func (r AllocationRequest) Free(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	if al, ok := r.leases.(availableLeases); ok {
+		return al.available(ip)
+	}
+	return r.leases.Free(ip).Equal(ip)
+}
+
+// Previous returns the address last bound to the client according to the
+// lease history, or nil. It is only looked up when called.
+func (r AllocationRequest) Previous() net.IP {
+	if r.previous == nil {
+		return nil
+	}
+	return r.previous()
+}
+
+// FirstFree returns the address the Leases bind when they are free to
+// choose, the lowest free address of MemoryLeases, or nil if none is free.
+func (r AllocationRequest) FirstFree() net.IP {
+	return r.leases.Free(nil)
+}
+
+// AllocationStrategy chooses the address bound to a client without a
+// binding or a reserved address. If the address returned is not free, or
+// nil, the Leases bind any free address.
+type AllocationStrategy func(r AllocationRequest) net.IP
+
+// WithAllocationStrategy configures how the addresses of clients without a
+// binding or a reserved address are chosen.
+//
+// Default is AllocateRequested.
+func WithAllocationStrategy(st AllocationStrategy) ServerOpt {
+	return func(s *Server) {
+		if st != nil {
+			s.allocation = st
+		}
+	}
+}
+
+// AllocateRequested binds the address the client requested if it is free,
+// and the first free address otherwise: clients that remember their last
+// address, e.g. in the requested IP address option of a DISCOVER, tend to
+// get it back.
+func AllocateRequested(r AllocationRequest) net.IP {
+	return r.Requested
+}
+
+// AllocateSequential binds the first free address, whatever the client
+// requested: clients booting one after another get consecutive addresses.
+func AllocateSequential(r AllocationRequest) net.IP {
+	return r.FirstFree()
+}
+
+// AllocateHash binds an address derived from a hash of the client's key:
+// the client's hardware address or client identifier, depending on the
+// KeyPolicy. Without reservations, a client gets the same address whenever
+// it is free, across server restarts and from every server with the same
+// pool. If it is taken, the next free address after it is bound. The
+// network and broadcast addresses of the pool are never bound.
+//
+// The pool must be known, see AllocationRequest.Pool; otherwise the
+// requested address is bound as with AllocateRequested.
+func AllocateHash(r AllocationRequest) net.IP {
+	if r.Pool == nil || r.Pool.IP.To4() == nil {
+		return r.Requested
+	}
+	ones, bits := r.Pool.Mask.Size()
+	size := uint64(1) << uint(bits-ones)
+	base := uint64(binary.BigEndian.Uint32(r.Pool.IP.To4().Mask(r.Pool.Mask)))
+	if size > 2 {
+		// Only /31 and /32 pools have no network and broadcast
+		// addresses, see RFC 3021.
+		base++
+		size -= 2
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(r.Key))
+	start := h.Sum64() % size
+	for i := uint64(0); i < size; i++ {
+		ip := make(net.IP, net.IPv4len)
+		binary.BigEndian.PutUint32(ip, uint32(base+(start+i)%size))
+		if r.Free(ip) {
+			return ip
+		}
+	}
+	return nil
+}
+
+// AllocateSticky binds the address the client was last bound, if it is
+// free, even after its lease expired or was released, and the requested
+// address otherwise: clients keep their addresses across experiments that
+// let leases lapse. Clients are told apart by their key, see KeyPolicy, and
+// previous addresses are known as long as the lease history retains them,
+// see WithHistoryRetention.
+func AllocateSticky(r AllocationRequest) net.IP {
+	if prev := r.Previous(); prev != nil && r.Free(prev) {
+		return prev
+	}
+	return r.Requested
+}
+
+var allocationStrategies = map[string]AllocationStrategy{
+	"requested":  AllocateRequested,
+	"sequential": AllocateSequential,
+	"hash":       AllocateHash,
+	"sticky":     AllocateSticky,
+}
+
+// ParseAllocationStrategy parses "requested", "sequential", "hash" or
+// "sticky".
+func ParseAllocationStrategy(s string) (AllocationStrategy, error) {
+	if st, ok := allocationStrategies[s]; ok {
+		return st, nil
+	}
+	names := make([]string, 0, len(allocationStrategies))
+	for name := range allocationStrategies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return nil, fmt.Errorf("unknown allocation strategy %q, want one of %v", s, names)
+}
+
+// allocationRequest returns the allocation request of the client key with
+// hardware address haddr, requesting rip, to be bound from pool.
+func (s *Server) allocationRequest(key bindingKey, haddr net.HardwareAddr, rip net.IP, pool Leases) AllocationRequest {
+	r := AllocationRequest{
+		Key:          string(key),
+		HardwareAddr: haddr,
+		Requested:    rip,
+		leases:       pool,
+	}
+	if rl, ok := pool.(ResizableLeases); ok {
+		r.Pool = rl.Pool()
+	}
+	history := s.history
+	r.previous = func() net.IP {
+		return history.previous(string(key))
+	}
+	return r
+}
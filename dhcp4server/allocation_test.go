@@ -0,0 +1,213 @@
+package dhcp4server
+
+import (
+	"net"
+	"testing"
+
+	"github.com/mergetb/dhcp4"
+	"github.com/mergetb/dhcp4/dhcp4opts"
+)
+
+func discoverRequesting(mac net.HardwareAddr, ip net.IP) *dhcp4.Packet {
+	p := newRequest(dhcp4opts.DHCPDiscover, mac)
+	if ip != nil {
+		p.Options.SetRequestedIPAddress(ip)
+	}
+	return p
+}
+
+func TestAllocationStrategy(t *testing.T) {
+	mac1 := net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 1}
+	mac2 := net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 2}
+	requested := net.IP{192, 168, 1, 50}
+
+	// hashed is where AllocateHash puts mac1 in an empty pool.
+	hashed := exchange(t, newTestServer(t, WithAllocationStrategy(AllocateHash)), discoverRequesting(mac1, nil)).YIAddr
+	afterHashed := append(net.IP(nil), hashed.To4()...)
+	nextIP(afterHashed)
+
+	for _, tt := range []struct {
+		name     string
+		strategy AllocationStrategy
+		// setup runs before mac1 sends a DISCOVER requesting requested.
+		setup func(t *testing.T, s *Server)
+		want  net.IP
+	}{
+		{
+			name:     "requested",
+			strategy: AllocateRequested,
+			want:     requested,
+		},
+		{
+			name:     "requested taken",
+			strategy: AllocateRequested,
+			setup: func(t *testing.T, s *Server) {
+				exchange(t, s, discoverRequesting(mac2, requested))
+			},
+			want: net.IP{192, 168, 1, 1},
+		},
+		{
+			name:     "sequential",
+			strategy: AllocateSequential,
+			want:     net.IP{192, 168, 1, 1},
+		},
+		{
+			name:     "sequential after binding",
+			strategy: AllocateSequential,
+			setup: func(t *testing.T, s *Server) {
+				bind(t, s, mac2, "")
+			},
+			want: net.IP{192, 168, 1, 2},
+		},
+		{
+			name:     "hash",
+			strategy: AllocateHash,
+			want:     hashed,
+		},
+		{
+			name:     "hash taken",
+			strategy: AllocateHash,
+			setup: func(t *testing.T, s *Server) {
+				if _, err := s.local.Allocate(Binding{Key: "other"}, hashed); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: afterHashed,
+		},
+		{
+			name:     "sticky without history",
+			strategy: AllocateSticky,
+			want:     requested,
+		},
+		{
+			name:     "sticky after release",
+			strategy: AllocateSticky,
+			setup: func(t *testing.T, s *Server) {
+				ip := bind(t, s, mac1, "")
+				exchange(t, s, newRelease(s, mac1, ip))
+			},
+			want: net.IP{192, 168, 1, 1},
+		},
+		{
+			name:     "sticky previous taken",
+			strategy: AllocateSticky,
+			setup: func(t *testing.T, s *Server) {
+				ip := bind(t, s, mac1, "")
+				exchange(t, s, newRelease(s, mac1, ip))
+				bind(t, s, mac2, "")
+			},
+			want: requested,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, WithAllocationStrategy(tt.strategy))
+			if tt.setup != nil {
+				tt.setup(t, s)
+			}
+			offer := exchange(t, s, discoverRequesting(mac1, requested))
+			if offer == nil {
+				t.Fatal("no offer")
+			}
+			if !offer.YIAddr.Equal(tt.want) {
+				t.Errorf("offered %v, want %v", offer.YIAddr, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllocateHashStable(t *testing.T) {
+	// Servers with the same pool hash clients to the same addresses,
+	// whatever order they come in.
+	a := newTestServer(t, WithAllocationStrategy(AllocateHash))
+	b := newTestServer(t, WithAllocationStrategy(AllocateHash))
+	var macs []net.HardwareAddr
+	for i := byte(1); i <= 8; i++ {
+		macs = append(macs, net.HardwareAddr{0, 0, 0x5e, 0, 0x53, i})
+	}
+	got := make(map[string]net.IP)
+	for _, mac := range macs {
+		got[mac.String()] = bind(t, a, mac, "")
+	}
+	for i := len(macs) - 1; i >= 0; i-- {
+		mac := macs[i]
+		if ip := bind(t, b, mac, ""); !ip.Equal(got[mac.String()]) {
+			t.Errorf("%v bound %v, then %v", mac, got[mac.String()], ip)
+		}
+	}
+}
+
+func TestAllocateHashHosts(t *testing.T) {
+	_, pool, err := net.ParseCIDR("10.0.0.0/29")
+	if err != nil {
+		t.Fatal(err)
+	}
+	leases := NewMemoryLeases(pool)
+	network, broadcast := net.IP{10, 0, 0, 0}, net.IP{10, 0, 0, 7}
+
+	// The hashes of the keys cover the whole pool, and the pool fills up.
+	bound := make(map[string]bool)
+	for i := 0; i < 64; i++ {
+		key := string([]byte{byte(i)})
+		ip := AllocateHash(AllocationRequest{Key: key, Pool: pool, leases: leases})
+		if ip == nil {
+			break
+		}
+		if ip.Equal(network) || ip.Equal(broadcast) {
+			t.Fatalf("AllocateHash(%q) = %v, the network or broadcast address", key, ip)
+		}
+		if _, err := leases.Allocate(Binding{Key: key}, ip); err != nil {
+			t.Fatal(err)
+		}
+		bound[ip.String()] = true
+	}
+	if len(bound) != 6 {
+		t.Errorf("bound %v, want the 6 host addresses", bound)
+	}
+}
+
+func TestParseAllocationStrategy(t *testing.T) {
+	for _, name := range []string{"requested", "sequential", "hash", "sticky"} {
+		if _, err := ParseAllocationStrategy(name); err != nil {
+			t.Errorf("ParseAllocationStrategy(%q) = %v", name, err)
+		}
+	}
+	if _, err := ParseAllocationStrategy("random"); err == nil {
+		t.Error("ParseAllocationStrategy(\"random\") succeeded")
+	}
+}
+
+func TestAllocateStickyClientID(t *testing.T) {
+	mac1 := net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 1}
+	mac2 := net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 2}
+	s := newTestServer(t, WithKeyPolicy(KeyClientID), WithAllocationStrategy(AllocateSticky))
+
+	bindID := func(mac net.HardwareAddr, id string) net.IP {
+		offer := exchange(t, s, newIDRequest(dhcp4opts.DHCPDiscover, mac, id))
+		if offer == nil {
+			t.Fatalf("no offer to %q", id)
+		}
+		request := newIDRequest(dhcp4opts.DHCPRequest, mac, id)
+		request.Options.SetRequestedIPAddress(offer.YIAddr)
+		if ack := exchange(t, s, request); ack == nil || ack.Options.MessageType() != dhcp4.DHCPACK {
+			t.Fatalf("response to REQUEST of %q = %v, want ACK", id, ack)
+		}
+		return offer.YIAddr
+	}
+	releaseID := func(mac net.HardwareAddr, id string, ip net.IP) {
+		release := newRelease(s, mac, ip)
+		release.Options[dhcp4.OptionClientIdentifier] = []byte(id)
+		exchange(t, s, release)
+	}
+
+	other := bindID(mac2, "other")
+	node := bindID(mac1, "node")
+	releaseID(mac1, "node", node)
+	releaseID(mac2, "other", other)
+
+	// The client comes back with another NIC, and gets its address back
+	// rather than the first free one.
+	offer := exchange(t, s, newIDRequest(dhcp4opts.DHCPDiscover, mac2, "node"))
+	if offer == nil || !offer.YIAddr.Equal(node) {
+		t.Errorf("offer = %v, want the previous address %v of the client", offer, node)
+	}
+}
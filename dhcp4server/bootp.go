@@ -0,0 +1,87 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4server
+
+import (
+	"context"
+	"net"
+
+	"github.com/mergetb/dhcp4"
+)
+
+// bootpMessageSize is the length of a BOOTP message, RFC 951.
+const bootpMessageSize = 300
+
+// WithBOOTP makes the server answer BOOTP requests (RFC 951), those without
+// a DHCP message type, of clients with a reserved address, as legacy
+// hardware and some IPMI controllers send. The client is bound to its
+// reserved address without a lease time, since BOOTP clients never renew,
+// and the reply carries its boot parameters and its options without those
+// only DHCP clients understand, see dhcp4.Packet.BOOTPReply.
+//
+// Default is to ignore BOOTP requests.
+func WithBOOTP() ServerOpt {
+	return func(s *Server) {
+		s.bootp = true
+	}
+}
+
+// answerBOOTP returns the reply to the BOOTP request pkt received from addr,
+// or nil if there is none, or the work it waits for.
+//
+// s.mu must be held.
+func (s *Server) answerBOOTP(ctx context.Context, d *decisions, addr net.Addr, pkt *dhcp4.Packet, class Classification) (*dhcp4.Packet, *pending) {
+	if !s.bootp {
+		d.add("classify", "BOOTP request from %v is ignored", addr)
+		return nil, nil
+	}
+	key, keyed := s.keyPolicy.requestKey(pkt)
+	if !keyed {
+		d.log("key", "Ignoring BOOTP request from %v: no client identifier", addr)
+		return nil, nil
+	}
+	reserved := s.reservedIP(pkt.CHAddr)
+	if reserved == nil {
+		d.log("allocate", "Ignoring BOOTP request from %v: no address reserved for %v", addr, pkt.HardwareAddr())
+		return nil, nil
+	}
+	sub, ok := s.subnetFor(d, pkt)
+	if !ok {
+		d.log("subnet", "Ignoring BOOTP request from %v: no subnet for link %v", addr, linkAddr(pkt))
+		return nil, nil
+	}
+	if !s.onLink(reserved, sub) {
+		d.log("allocate", "Ignoring BOOTP request from %v: reserved address %v is not on its link", addr, reserved)
+		return nil, nil
+	}
+	if lease := s.schedule(ctx, d, class); lease.Refuse {
+		d.log("schedule", "Refusing BOOTP reply to %v: not scheduled", addr)
+		return nil, nil
+	}
+
+	replyIP := func(ip net.IP) (*dhcp4.Packet, *pending) {
+		if !ip.Equal(reserved) {
+			d.log("allocate", "Ignoring BOOTP request from %v: reserved address %v is not free", addr, reserved)
+			return nil, nil
+		}
+		reply := dhcp4.NewPacket(dhcp4.BootReply)
+		prepareReply(pkt, reply)
+		reply.CIAddr = pkt.CIAddr
+		reply.YIAddr = ip
+		reply.SIAddr = s.ip
+		return nil, s.decideBoot(d, key, reply, class, func() *dhcp4.Packet {
+			d.add("allocate", "%v: bound to the BOOTP client", ip)
+			s.renew(d, key, pkt, 0)
+			s.setOptions(d, reply, class, sub)
+			reply.BOOTPReply(pkt)
+			return reply
+		})
+	}
+	ip, probe := s.allocate(ctx, d, key, pkt, sub)
+	if probe {
+		return s.probeOffer(d, key, pkt, sub, ip, 1, replyIP)
+	}
+	return replyIP(ip)
+}
@@ -0,0 +1,88 @@
+package dhcp4server
+
+import (
+	"net"
+	"testing"
+
+	"github.com/mergetb/dhcp4"
+)
+
+func TestBOOTP(t *testing.T) {
+	mac := net.HardwareAddr{2, 0, 0, 0, 0, 1}
+	ip := net.IP{192, 168, 1, 50}
+	reserve := WithReservations(Reservation{HardwareAddr: mac, IP: ip})
+
+	// extensions is a BOOTP request with RFC 1497 vendor extensions, and
+	// plain one with an RFC 951 vendor area.
+	extensions := dhcp4.NewPacket(dhcp4.BootRequest)
+	extensions.SetHardwareAddr(mac)
+	extensions.TransactionID = [4]byte{1, 2, 3, 4}
+	plain := extensions.Clone()
+	plain.VendorArea = []byte("CMU")
+
+	for _, tt := range []struct {
+		name    string
+		opts    []ServerOpt
+		request *dhcp4.Packet
+		want    net.IP
+	}{
+		{
+			name:    "vendor extensions",
+			opts:    []ServerOpt{WithBOOTP(), reserve},
+			request: extensions,
+			want:    ip,
+		},
+		{
+			name:    "plain",
+			opts:    []ServerOpt{WithBOOTP(), reserve},
+			request: plain,
+			want:    ip,
+		},
+		{
+			name:    "not reserved",
+			opts:    []ServerOpt{WithBOOTP()},
+			request: extensions,
+		},
+		{
+			name:    "disabled",
+			opts:    []ServerOpt{reserve},
+			request: extensions,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, tt.opts...)
+			reply := exchange(t, s, tt.request)
+			if tt.want == nil {
+				if reply != nil {
+					t.Errorf("reply = %v, want none", reply)
+				}
+				return
+			}
+			if reply == nil {
+				t.Fatal("no reply")
+			}
+			if !reply.IsBOOTP() || !reply.YIAddr.Equal(tt.want) || reply.BootFile != "boot.img" {
+				t.Errorf("reply = %v with file %q, want BOOTP reply of %v with file boot.img", reply, reply.BootFile, tt.want)
+			}
+			if sid := reply.Options.ServerIdentifier(); sid != nil {
+				t.Errorf("reply has server identifier %v, want none", sid)
+			}
+			if (reply.VendorArea == nil) != (tt.request.VendorArea == nil) {
+				t.Errorf("reply vendor area = %x, request's = %x", reply.VendorArea, tt.request.VendorArea)
+			}
+
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			key, _ := s.keyPolicy.requestKey(tt.request)
+			if b, ok := s.leases.Lookup(string(key)); !ok || !b.IP.Equal(tt.want) {
+				t.Errorf("binding = %v, %v, want %v", b, ok, tt.want)
+			}
+			if end, ok := s.leaseEnds[key]; ok {
+				t.Errorf("binding ends at %v, want never", end)
+			}
+			if _, pending := s.offers[key]; pending {
+				t.Errorf("binding is only offered")
+			}
+		})
+	}
+}
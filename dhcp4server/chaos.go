@@ -0,0 +1,117 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4server
+
+import (
+	"math/rand"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Chaos configures faults injected into responses, for testing how clients
+// and monitoring cope with a misbehaving server.
+//
+// Fractions are probabilities between 0 and 1 applied to each response
+// independently.
+type Chaos struct {
+	// Drop is the fraction of responses not sent.
+	Drop float64
+
+	// Delay is the fraction of responses sent after a random delay of up
+	// to MaxDelay.
+	Delay    float64
+	MaxDelay time.Duration
+
+	// Corrupt is the fraction of responses sent with a random byte
+	// changed.
+	Corrupt float64
+
+	// Seed seeds the random choices, to make runs reproducible. If 0, the
+	// current time is used.
+	Seed int64
+}
+
+// ChaosStats counts the faults injected into responses.
+type ChaosStats struct {
+	Dropped   uint64
+	Delayed   uint64
+	Corrupted uint64
+}
+
+// WithUnsafeChaos configures the server to inject faults into its responses.
+//
+// This breaks clients on purpose and must never be used outside of test
+// networks.
+func WithUnsafeChaos(c Chaos) ServerOpt {
+	return func(s *Server) {
+		seed := c.Seed
+		if seed == 0 {
+			seed = time.Now().UnixNano()
+		}
+		s.chaos = &chaosInjector{
+			cfg:  c,
+			rand: rand.New(rand.NewSource(seed)),
+		}
+	}
+}
+
+// ChaosStats returns the number of faults injected so far.
+func (s *Server) ChaosStats() ChaosStats {
+	if s.chaos == nil {
+		return ChaosStats{}
+	}
+	return ChaosStats{
+		Dropped:   atomic.LoadUint64(&s.chaos.dropped),
+		Delayed:   atomic.LoadUint64(&s.chaos.delayed),
+		Corrupted: atomic.LoadUint64(&s.chaos.corrupted),
+	}
+}
+
+// chaosInjector injects faults into responses.
+type chaosInjector struct {
+	cfg Chaos
+
+	// mu protects rand.
+	mu   sync.Mutex
+	rand *rand.Rand
+
+	// Accessed atomically.
+	dropped, delayed, corrupted uint64
+}
+
+// writeTo writes b to dest on conn, with faults injected.
+func (ci *chaosInjector) writeTo(conn net.PacketConn, b []byte, dest net.Addr) error {
+	ci.mu.Lock()
+	drop := ci.rand.Float64() < ci.cfg.Drop
+	corrupt := ci.rand.Float64() < ci.cfg.Corrupt
+	var delay time.Duration
+	if ci.rand.Float64() < ci.cfg.Delay && ci.cfg.MaxDelay > 0 {
+		delay = time.Duration(ci.rand.Int63n(int64(ci.cfg.MaxDelay)))
+	}
+	pos, flip := ci.rand.Intn(len(b)), byte(1+ci.rand.Intn(255))
+	ci.mu.Unlock()
+
+	if drop {
+		atomic.AddUint64(&ci.dropped, 1)
+		return nil
+	}
+	if corrupt {
+		atomic.AddUint64(&ci.corrupted, 1)
+		b[pos] ^= flip
+	}
+	if delay > 0 {
+		// Do not hold up the handler, the delay is the client's
+		// problem only.
+		atomic.AddUint64(&ci.delayed, 1)
+		time.AfterFunc(delay, func() {
+			conn.WriteTo(b, dest)
+		})
+		return nil
+	}
+	_, err := conn.WriteTo(b, dest)
+	return err
+}
@@ -0,0 +1,76 @@
+package dhcp4server
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mergetb/dhcp4/dhcp4opts"
+)
+
+// bytesConn is a net.PacketConn recording the bytes written to it.
+type bytesConn struct {
+	net.PacketConn
+	sent chan []byte
+}
+
+func (bc *bytesConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	bc.sent <- append([]byte(nil), b...)
+	return len(b), nil
+}
+
+func TestChaos(t *testing.T) {
+	mac := net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 1}
+	for _, tt := range []struct {
+		desc  string
+		chaos Chaos
+		want  ChaosStats
+	}{
+		{desc: "none"},
+		{desc: "drop", chaos: Chaos{Drop: 1}, want: ChaosStats{Dropped: 1}},
+		{desc: "delay", chaos: Chaos{Delay: 1, MaxDelay: 10 * time.Millisecond}, want: ChaosStats{Delayed: 1}},
+		{desc: "corrupt", chaos: Chaos{Corrupt: 1}, want: ChaosStats{Corrupted: 1}},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			// The offer without faults.
+			want := exchange(t, newTestServer(t), newRequest(dhcp4opts.DHCPDiscover, mac))
+
+			s := newTestServer(t, WithUnsafeChaos(tt.chaos))
+			conn := &bytesConn{sent: make(chan []byte, 1)}
+			ctx, cancel := s.requestContext(context.Background(), testPeer)
+			defer cancel()
+			if err := s.handle(ctx, testLogger, conn, testPeer, newRequest(dhcp4opts.DHCPDiscover, mac)); err != nil {
+				t.Fatalf("handle() = %v", err)
+			}
+
+			var got []byte
+			select {
+			case got = <-conn.sent:
+			case <-time.After(100 * time.Millisecond):
+			}
+			wantb, err := want.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			switch {
+			case tt.want.Dropped > 0:
+				if got != nil {
+					t.Errorf("response sent, want it dropped")
+				}
+			case tt.want.Corrupted > 0:
+				if got == nil || bytes.Equal(got, wantb) {
+					t.Errorf("response %v, want it corrupted", got)
+				}
+			default:
+				if !bytes.Equal(got, wantb) {
+					t.Errorf("response %v, want %v", got, wantb)
+				}
+			}
+			if stats := s.ChaosStats(); stats != tt.want {
+				t.Errorf("ChaosStats() = %+v, want %+v", stats, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4server
+
+import (
+	"context"
+	"net"
+
+	"github.com/mergetb/dhcp4"
+	"github.com/mergetb/dhcp4/dhcp4opts"
+	"github.com/mergetb/dhcp4/fingerprint"
+)
+
+// Classification describes a client request, for use by policy callbacks.
+type Classification struct {
+	// Request is the request packet. Callbacks must not modify it.
+	Request *dhcp4.Packet
+
+	// Peer is the address the request was received from.
+	Peer net.Addr
+
+	// MessageType is the DHCP message type of the request.
+	MessageType dhcp4opts.DHCPMessageType
+
+	// HardwareAddr is the client hardware address.
+	HardwareAddr net.HardwareAddr
+
+	// ClientID is the client identifier (option 61), if sent.
+	ClientID []byte
+
+	// VendorClass is the vendor class identifier (option 60), if sent.
+	VendorClass string
+
+	// UserClasses are the user classes (option 77) the client belongs
+	// to, if sent.
+	UserClasses []string
+
+	// IPXE is true if the client is iPXE.
+	IPXE bool
+
+	// Fingerprint identifies the client's DHCP software, see
+	// fingerprint.Database to tell the kind of device from it.
+	Fingerprint fingerprint.Fingerprint
+
+	// Relayed is true if the request was forwarded by a relay agent.
+	Relayed bool
+
+	// RelayAgentInfo is the relay agent information (option 82) of a
+	// relayed request, e.g. the switch port the client is on, if sent.
+	RelayAgentInfo *dhcp4.RelayAgentInfo
+
+	// IP is the address the server is about to offer or acknowledge.
+	IP net.IP
+}
+
+// classify returns the classification of request received from peer.
+func classify(ctx context.Context, tracer Tracer, request *dhcp4.Packet, peer net.Addr) Classification {
+	_, end := tracer.StartSpan(ctx, "dhcp4server.classify")
+	defer end()
+
+	c := Classification{
+		Request:      request,
+		Peer:         peer,
+		MessageType:  dhcp4opts.GetDHCPMessageType(request.Options),
+		HardwareAddr: request.HardwareAddr(),
+		ClientID:     request.Options.Get(dhcp4.OptionClientIdentifier),
+		VendorClass:  dhcp4opts.GetString(dhcp4.OptionVendorClassIdentifier, request.Options),
+		UserClasses:  request.Options.UserClasses(),
+		IPXE:         dhcp4opts.IsIPXE(request.Options),
+		Fingerprint:  fingerprint.Of(request),
+		Relayed:      request.GIAddr != nil && !request.GIAddr.IsUnspecified(),
+	}
+	if c.Relayed {
+		c.RelayAgentInfo = request.Options.RelayAgentInfo()
+	}
+	return c
+}
+
+// BootParams tells a client where to boot from.
+type BootParams struct {
+	// ServerName is the boot server host name (sname).
+	ServerName string
+
+	// BootFile is the boot file name (file).
+	BootFile string
+
+	// NextServer is the address of the boot server (siaddr). If nil, the
+	// server's own address is used.
+	NextServer net.IP
+}
+
+// BootDecider decides the boot parameters for a request.
+//
+// It is called for every OFFER and ACK with the request's context. Deciders
+// consulting external state (e.g. whether a node should boot an installer or
+// its disk) must respect the context's deadline; responses are dropped once
+// it passes.
+type BootDecider func(ctx context.Context, req Classification) BootParams
+
+// defaultBoot serves the statically configured boot parameters.
+func (s *Server) defaultBoot(ctx context.Context, req Classification) BootParams {
+	bp := BootParams{
+		ServerName: s.sname,
+		BootFile:   s.filename,
+	}
+	if s.ipxeScript != "" && req.IPXE {
+		bp.BootFile = s.ipxeScript
+	}
+	return bp
+}
+
+// decideBoot returns the call of the boot decider for response to req, to
+// run without s.mu so that a decider consulting slow external state does not
+// hold up other requests. Once it returned, the boot parameters are filled
+// in and next completes the response, unless the client key is not bound to
+// response.YIAddr anymore, e.g. because the client released it meanwhile, in
+// which case the request is dropped.
+//
+// s.mu must be held.
+func (s *Server) decideBoot(d *decisions, key bindingKey, response *dhcp4.Packet, req Classification, next func() *dhcp4.Packet) *pending {
+	req.IP = response.YIAddr
+	var bp BootParams
+	return &pending{
+		run: func(ctx context.Context) {
+			ctx, end := s.tracer.StartSpan(ctx, "dhcp4server.boot")
+			defer end()
+			bp = s.bootDecider(ctx, req)
+		},
+		resume: func(ctx context.Context) (*dhcp4.Packet, *pending) {
+			if !d.dryRun && !s.getIP(key).Equal(req.IP) {
+				d.log("boot", "Dropping response to %v: %v was released while the boot decider ran", req.HardwareAddr, req.IP)
+				return nil, nil
+			}
+			s.setBoot(d, response, req, bp)
+			return next(), nil
+		},
+	}
+}
+
+// setBoot fills in the boot parameters bp decided for response to req.
+//
+// s.mu must be held.
+func (s *Server) setBoot(d *decisions, response *dhcp4.Packet, req Classification, bp BootParams) {
+	s.overrideBoot(&bp, req)
+	place := s.bootPlacement
+	if req.Request != nil && req.Request.IsBOOTP() {
+		// BOOTP clients only look at the fields.
+		place = dhcp4.BootFields
+	}
+	response.SetBootInfo(dhcp4.BootInfo{
+		ServerName: bp.ServerName,
+		NextServer: bp.NextServer,
+		BootFile:   bp.BootFile,
+	}, place)
+	d.add("boot", "boot file %q from %v (server name %q) in the %v", bp.BootFile, response.SIAddr, bp.ServerName, place)
+}
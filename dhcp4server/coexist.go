@@ -0,0 +1,261 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4server
+
+import (
+	"context"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+)
+
+// IPRange is an inclusive range of IPv4 addresses.
+type IPRange struct {
+	First, Last net.IP
+}
+
+// Contains returns whether ip is in r.
+func (r IPRange) Contains(ip net.IP) bool {
+	if ip.To4() == nil || r.First.To4() == nil || r.Last.To4() == nil {
+		return false
+	}
+	n := beUint32(ip)
+	return beUint32(r.First) <= n && n <= beUint32(r.Last)
+}
+
+// String implements fmt.Stringer.
+func (r IPRange) String() string {
+	return r.First.String() + "-" + r.Last.String()
+}
+
+// Prober checks whether an address is in use before it is offered, e.g. by
+// ARP or ICMP echo.
+type Prober interface {
+	// Probe returns whether some host answers at ip. It must return
+	// before ctx, which has the deadline of the request, is done.
+	Probe(ctx context.Context, ip net.IP) (bool, error)
+}
+
+// ProberFunc is a function implementing Prober.
+type ProberFunc func(ctx context.Context, ip net.IP) (bool, error)
+
+// Probe implements Prober.
+func (f ProberFunc) Probe(ctx context.Context, ip net.IP) (bool, error) {
+	return f(ctx, ip)
+}
+
+// Conflict is an address found in use that the server did not hand out,
+// e.g. because another server leased it or a host was configured with it.
+type Conflict struct {
+	IP net.IP `json:"ip"`
+
+	// Source is how the conflict was learned: "probe" if the address
+	// answered a probe, "decline" if a client declined it.
+	Source string `json:"source"`
+
+	Detected time.Time `json:"detected"`
+
+	// Expires is when the address is offered again, after another probe.
+	Expires time.Time `json:"expires"`
+}
+
+// maxProbes is how many addresses are probed for one offer before the
+// server gives up.
+const maxProbes = 8
+
+// coexistence is the state of coexistence mode, see WithCoexistence.
+type coexistence struct {
+	ranges []IPRange
+	prober Prober
+}
+
+// WithCoexistence makes the server share its subnet with another DHCP
+// server, e.g. a legacy server during a migration.
+//
+// The server only hands out addresses in ranges; the other server is
+// configured with the rest of the subnet. Every address is probed with p
+// before it is offered to a new client; addresses found in use, and those
+// declined by clients, are learned as conflicts and not offered again until
+// their quarantine ends, see WithConflictQuarantine. If p is nil or fails,
+// no address is offered. Probes run without the server's lock, so a slow
+// probe only delays its own offer; the client's retransmissions are not
+// answered meanwhile, and the offer is dropped if the client released the
+// address.
+//
+// The server also stays silent towards every client it has no binding for,
+// rather than NAKing the requests of those whose offer expired, since the
+// other server may have answered them.
+//
+// Ranges are only enforced when allocating from MemoryLeases or
+// FileLeases; with other Leases, addresses outside ranges are not offered.
+func WithCoexistence(ranges []IPRange, p Prober) ServerOpt {
+	return func(s *Server) {
+		s.coexist = &coexistence{ranges: ranges, prober: p}
+	}
+}
+
+// WithConflictQuarantine configures how long an address learned as a
+// conflict is not offered: an address declined by a client, or found in use
+// by a probe in coexistence mode.
+//
+// Default is 1 hour.
+func WithConflictQuarantine(d time.Duration) ServerOpt {
+	return func(s *Server) {
+		s.conflictQuarantine = d
+	}
+}
+
+// excluded returns whether ip must not be allocated: it is outside the
+// ranges.
+func (co *coexistence) excluded(ip net.IP) bool {
+	for _, r := range co.ranges {
+		if r.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// learnConflict records that ip was found in use, so that it is not offered
+// until its quarantine ends.
+//
+// s.mu must be held.
+func (s *Server) learnConflict(ip net.IP, source string, now time.Time) {
+	if s.quarantined == nil {
+		s.quarantined = make(map[uint32]Conflict)
+	}
+	s.quarantined[beUint32(ip)] = Conflict{
+		IP:       append(net.IP(nil), ip.To4()...),
+		Source:   source,
+		Detected: now,
+		Expires:  now.Add(s.conflictQuarantine),
+	}
+}
+
+// inQuarantine returns whether ip is a conflict whose quarantine has not
+// ended.
+//
+// s.mu must be held.
+func (s *Server) inQuarantine(ip net.IP) bool {
+	c, ok := s.quarantined[beUint32(ip)]
+	return ok && time.Now().Before(c.Expires)
+}
+
+// excluder are Leases that can skip addresses when allocating.
+type excluder interface {
+	setExclude(exclude func(net.IP) bool)
+}
+
+// probeOffer returns the probe of ip, just bound to the client key to offer
+// it to the client of request on sub, to run without s.mu. Once it returned,
+// next completes the response with ip if it may be offered, or with nil if
+// not, unless the client key is not bound to ip anymore, in which case the
+// request is dropped. Addresses found in use are learned as conflicts, their
+// binding released and another address probed, up to maxProbes.
+//
+// s.mu must be held.
+func (s *Server) probeOffer(d *decisions, key bindingKey, request *dhcp4.Packet, sub *Subnet, ip net.IP, probes int, next func(net.IP) (*dhcp4.Packet, *pending)) (*dhcp4.Packet, *pending) {
+	co := s.coexist
+	if co.excluded(ip) || s.inQuarantine(ip) {
+		// Leases that cannot skip addresses allocated one they may
+		// not hand out.
+		d.log("coexist", "Not offering %v: outside the ranges or in quarantine", ip)
+		s.unbind(key)
+		return next(nil)
+	}
+	if co.prober == nil {
+		d.log("coexist", "Not offering %v: no prober", ip)
+		s.unbind(key)
+		return next(nil)
+	}
+	if s.probing == nil {
+		s.probing = make(map[bindingKey]bool)
+	}
+	s.probing[key] = true
+	var (
+		inUse bool
+		err   error
+	)
+	return nil, &pending{
+		run: func(ctx context.Context) {
+			inUse, err = co.prober.Probe(ctx, ip)
+		},
+		resume: func(ctx context.Context) (*dhcp4.Packet, *pending) {
+			delete(s.probing, key)
+			if !s.getIP(key).Equal(ip) {
+				d.log("coexist", "Not offering %v: released while it was probed", ip)
+				return nil, nil
+			}
+			switch {
+			case err != nil:
+				d.log("coexist", "Not offering %v: probe failed: %v", ip, err)
+				s.unbind(key)
+				return next(nil)
+			case inUse:
+				d.log("coexist", "Conflict: %v is in use", ip)
+				s.learnConflict(ip, "probe", time.Now())
+				s.unbind(key)
+				if probes == maxProbes {
+					return next(nil)
+				}
+				ip, probe := s.allocate(ctx, d, key, request, sub)
+				if !probe {
+					return next(ip)
+				}
+				return s.probeOffer(d, key, request, sub, ip, probes+1, next)
+			}
+			d.add("coexist", "%v: probed, not in use", ip)
+			s.holdOffer(key, ip, request.CHAddr, time.Now())
+			return next(ip)
+		},
+	}
+}
+
+// unbind ends the binding of the client key made to offer an address,
+// without recording it in the history as it was never offered.
+//
+// s.mu must be held.
+func (s *Server) unbind(key bindingKey) {
+	delete(s.offers, key)
+	s.leases.Release(string(key))
+}
+
+// foreignRequest returns whether a REQUEST of the client key is for the
+// other server in coexistence mode: the client has no binding here.
+//
+// s.mu must be held.
+func (s *Server) foreignRequest(key bindingKey) bool {
+	if s.coexist == nil {
+		return false
+	}
+	_, ok := s.leases.Lookup(string(key))
+	return !ok
+}
+
+// Conflicts returns the addresses learned in use, declined by clients or
+// found by probes in coexistence mode, whose quarantine has not ended, in
+// address order.
+func (s *Server) Conflicts() []Conflict {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conflicts()
+}
+
+// conflicts implements Conflicts.
+//
+// s.mu must be held.
+func (s *Server) conflicts() []Conflict {
+	now := time.Now()
+	var cs []Conflict
+	for _, c := range s.quarantined {
+		if now.Before(c.Expires) {
+			cs = append(cs, c)
+		}
+	}
+	sort.Slice(cs, func(i, j int) bool { return beUint32(cs[i].IP) < beUint32(cs[j].IP) })
+	return cs
+}
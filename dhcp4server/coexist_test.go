@@ -0,0 +1,245 @@
+package dhcp4server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+	"github.com/mergetb/dhcp4/dhcp4opts"
+)
+
+// busyProber is a Prober finding the addresses in busy in use.
+type busyProber struct {
+	busy map[string]bool
+	err  error
+}
+
+func (p *busyProber) Probe(ctx context.Context, ip net.IP) (bool, error) {
+	return p.busy[ip.String()], p.err
+}
+
+var coexistRange = IPRange{First: net.IP{192, 168, 1, 100}, Last: net.IP{192, 168, 1, 199}}
+
+func TestCoexistenceOffer(t *testing.T) {
+	for _, tt := range []struct {
+		desc      string
+		requested net.IP
+		busy      []string
+		err       error
+		noProber  bool
+		want      net.IP
+		conflicts []string
+	}{
+		{desc: "first in range", want: net.IP{192, 168, 1, 100}},
+		{desc: "requested in range", requested: net.IP{192, 168, 1, 150}, want: net.IP{192, 168, 1, 150}},
+		{desc: "requested outside range", requested: net.IP{192, 168, 1, 10}, want: net.IP{192, 168, 1, 100}},
+		{
+			desc:      "conflict",
+			busy:      []string{"192.168.1.100", "192.168.1.101"},
+			want:      net.IP{192, 168, 1, 102},
+			conflicts: []string{"192.168.1.100", "192.168.1.101"},
+		},
+		{
+			desc:      "requested conflict",
+			requested: net.IP{192, 168, 1, 150},
+			busy:      []string{"192.168.1.150"},
+			want:      net.IP{192, 168, 1, 100},
+			conflicts: []string{"192.168.1.150"},
+		},
+		{
+			desc: "too many conflicts",
+			busy: []string{
+				"192.168.1.100", "192.168.1.101", "192.168.1.102", "192.168.1.103",
+				"192.168.1.104", "192.168.1.105", "192.168.1.106", "192.168.1.107",
+			},
+			conflicts: []string{
+				"192.168.1.100", "192.168.1.101", "192.168.1.102", "192.168.1.103",
+				"192.168.1.104", "192.168.1.105", "192.168.1.106", "192.168.1.107",
+			},
+		},
+		{desc: "probe fails", err: errors.New("no route")},
+		{desc: "no prober", noProber: true},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			p := &busyProber{busy: make(map[string]bool), err: tt.err}
+			for _, ip := range tt.busy {
+				p.busy[ip] = true
+			}
+			var prober Prober = p
+			if tt.noProber {
+				prober = nil
+			}
+			s := newTestServer(t, WithCoexistence([]IPRange{coexistRange}, prober))
+
+			mac := net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 1}
+			req := newRequest(dhcp4opts.DHCPDiscover, mac)
+			if tt.requested != nil {
+				req.Options.SetRequestedIPAddress(tt.requested)
+			}
+			offer := exchange(t, s, req)
+			if tt.want == nil {
+				if offer != nil {
+					t.Errorf("offered %v, want no offer", offer.YIAddr)
+				}
+				if _, ok := s.leases.Lookup(string(keyOf(t, s, mac))); ok {
+					t.Errorf("client bound without an offer")
+				}
+			} else if offer == nil || !offer.YIAddr.Equal(tt.want) {
+				t.Errorf("got offer %v, want %v", offer, tt.want)
+			}
+
+			var conflicts []string
+			for _, c := range s.Conflicts() {
+				if c.Source != "probe" {
+					t.Errorf("conflict %v learned by %q, want probe", c.IP, c.Source)
+				}
+				conflicts = append(conflicts, c.IP.String())
+			}
+			if len(conflicts) != len(tt.conflicts) {
+				t.Fatalf("conflicts %v, want %v", conflicts, tt.conflicts)
+			}
+			for i := range conflicts {
+				if conflicts[i] != tt.conflicts[i] {
+					t.Errorf("conflicts %v, want %v", conflicts, tt.conflicts)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestCoexistenceRequest(t *testing.T) {
+	s := newTestServer(t, WithCoexistence([]IPRange{coexistRange}, &busyProber{}))
+	a := net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 1}
+	b := net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 2}
+
+	// A chooses the other server's offer.
+	if offer := exchange(t, s, newRequest(dhcp4opts.DHCPDiscover, a)); offer == nil {
+		t.Fatalf("got no offer")
+	}
+	req := newRequest(dhcp4opts.DHCPRequest, a)
+	req.Options.SetRequestedIPAddress(net.IP{192, 168, 1, 10})
+	req.Options.SetServerIdentifier(net.IP{192, 168, 0, 2})
+	if resp := exchange(t, s, req); resp != nil {
+		t.Errorf("REQUEST for another server got %v, want no response", dhcp4opts.GetDHCPMessageType(resp.Options))
+	}
+	if _, ok := s.leases.Lookup(string(keyOf(t, s, a))); ok {
+		t.Errorf("A is still bound after choosing another server")
+	}
+
+	// B reboots with an address of the other server.
+	req = newRequest(dhcp4opts.DHCPRequest, b)
+	req.Options.SetRequestedIPAddress(net.IP{192, 168, 1, 20})
+	if resp := exchange(t, s, req); resp != nil {
+		t.Errorf("INIT-REBOOT of an unknown client got %v, want no response", dhcp4opts.GetDHCPMessageType(resp.Options))
+	}
+}
+
+func TestCoexistenceSlowProbe(t *testing.T) {
+	probing := make(chan net.IP)
+	release := make(chan struct{})
+	first := true
+	s := newTestServer(t, WithCoexistence([]IPRange{coexistRange}, ProberFunc(func(ctx context.Context, ip net.IP) (bool, error) {
+		// Only the first probe blocks; the others start once it does.
+		if first {
+			first = false
+			probing <- ip
+			<-release
+		}
+		return false, nil
+	})))
+	a := net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 1}
+	b := net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 2}
+
+	done := make(chan *dhcp4.Packet)
+	go func() {
+		done <- exchange(t, s, newRequest(dhcp4opts.DHCPDiscover, a))
+	}()
+	ip := <-probing
+
+	// Other clients are served while the probe is busy, but not the
+	// retransmissions of the probed client.
+	if offer := exchange(t, s, newRequest(dhcp4opts.DHCPDiscover, b)); offer == nil || offer.YIAddr.Equal(ip) {
+		t.Errorf("other client got offer %v while %v is probed, want another address", offer, ip)
+	}
+	if offer := exchange(t, s, newRequest(dhcp4opts.DHCPDiscover, a)); offer != nil {
+		t.Errorf("retransmission got offer of %v while it is probed, want none", offer.YIAddr)
+	}
+
+	// A releases the address before the probe returns.
+	exchange(t, s, newRelease(s, a, ip))
+	close(release)
+	if offer := <-done; offer != nil {
+		t.Errorf("got offer of %v after releasing it, want none", offer.YIAddr)
+	}
+	if _, ok := s.leases.Lookup(string(keyOf(t, s, a))); ok {
+		t.Errorf("client bound after releasing the probed address")
+	}
+}
+
+func TestCoexistenceDecline(t *testing.T) {
+	s := newTestServer(t, WithCoexistence([]IPRange{coexistRange}, &busyProber{}), WithConflictQuarantine(time.Minute))
+	a := net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 1}
+	b := net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 2}
+
+	offer := exchange(t, s, newRequest(dhcp4opts.DHCPDiscover, a))
+	if offer == nil {
+		t.Fatalf("got no offer")
+	}
+	req := newRequest(dhcp4opts.DHCPRequest, a)
+	req.Options.Add(dhcp4.OptionRequestedIPAddress, dhcp4opts.IP(offer.YIAddr))
+	if ack := exchange(t, s, req); ack == nil || dhcp4opts.GetDHCPMessageType(ack.Options) != dhcp4opts.DHCPACK {
+		t.Fatalf("REQUEST of %v got %v, want ACK", offer.YIAddr, ack)
+	}
+	decline := newRequest(dhcp4opts.DHCPDecline, a)
+	decline.Options.Add(dhcp4.OptionRequestedIPAddress, dhcp4opts.IP(offer.YIAddr))
+	decline.Options.SetServerIdentifier(s.ServerID())
+	exchange(t, s, decline)
+
+	cs := s.Conflicts()
+	if len(cs) != 1 || !cs[0].IP.Equal(offer.YIAddr) || cs[0].Source != "decline" {
+		t.Fatalf("conflicts %+v, want %v declined", cs, offer.YIAddr)
+	}
+	if d := cs[0].Expires.Sub(cs[0].Detected); d != time.Minute {
+		t.Errorf("quarantine %v, want 1m", d)
+	}
+	if got := s.DumpState().Leases.Conflicts; len(got) != 1 {
+		t.Errorf("state has conflicts %+v, want 1", got)
+	}
+	if offerB := exchange(t, s, newRequest(dhcp4opts.DHCPDiscover, b)); offerB == nil || offerB.YIAddr.Equal(offer.YIAddr) {
+		t.Errorf("B was offered %v, want an address other than the declined %v", offerB, offer.YIAddr)
+	}
+
+	// Once the quarantine ends, the address is offered again.
+	s.mu.Lock()
+	c := s.quarantined[beUint32(offer.YIAddr)]
+	c.Expires = time.Now()
+	s.quarantined[beUint32(offer.YIAddr)] = c
+	s.mu.Unlock()
+	if cs := s.Conflicts(); len(cs) != 0 {
+		t.Errorf("conflicts %+v after quarantine, want none", cs)
+	}
+	if offerA := exchange(t, s, newRequest(dhcp4opts.DHCPDiscover, a)); offerA == nil || !offerA.YIAddr.Equal(offer.YIAddr) {
+		t.Errorf("A was offered %v, want %v again", offerA, offer.YIAddr)
+	}
+}
+
+func TestIPRange(t *testing.T) {
+	for _, tt := range []struct {
+		ip   net.IP
+		want bool
+	}{
+		{net.IP{192, 168, 1, 99}, false},
+		{net.IP{192, 168, 1, 100}, true},
+		{net.IP{192, 168, 1, 199}, true},
+		{net.IP{192, 168, 1, 200}, false},
+		{net.ParseIP("::1"), false},
+	} {
+		if got := coexistRange.Contains(tt.ip); got != tt.want {
+			t.Errorf("%v.Contains(%v) = %t, want %t", coexistRange, tt.ip, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,534 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/mergetb/dhcp4"
+)
+
+// Config is the declarative configuration of a server, usually read from a
+// JSON file with ReadConfig and served with NewFromConfig.
+type Config struct {
+	// Pools are the address pools clients are served from.
+	Pools []PoolConfig `json:"pools"`
+
+	// Reservations are addresses reserved for specific clients.
+	Reservations []ReservationConfig `json:"reservations,omitempty"`
+
+	// Classes assign clients to pools and boot files by what they send.
+	// A client belongs to the first class matching it.
+	Classes []ClassConfig `json:"classes,omitempty"`
+
+	// Options are sent to all clients.
+	Options []OptionConfig `json:"options,omitempty"`
+}
+
+// PoolConfig is an address pool.
+type PoolConfig struct {
+	// Name identifies the pool in classes.
+	Name string `json:"name"`
+
+	// Subnet is the subnet of the pool in CIDR notation.
+	Subnet string `json:"subnet"`
+
+	// Start and End are the first and last address handed out. If empty,
+	// the pool spans the whole subnet.
+	Start string `json:"start,omitempty"`
+	End   string `json:"end,omitempty"`
+
+	// ServerID is the address sent to clients of the pool as the server
+	// identifier (option 54). If empty, the server's own address is sent.
+	ServerID string `json:"server_id,omitempty"`
+
+	// Options are sent to clients served from the pool.
+	Options []OptionConfig `json:"options,omitempty"`
+}
+
+// ReservationConfig reserves an address for a client.
+type ReservationConfig struct {
+	// HardwareAddr is the client's hardware address.
+	HardwareAddr string `json:"mac"`
+
+	// IP is the reserved address. It must be in the subnet of a pool.
+	IP string `json:"ip"`
+
+	// Options are sent to the client.
+	Options []OptionConfig `json:"options,omitempty"`
+
+	// BootFile, ServerName and NextServer override the boot parameters
+	// served to the client, if set.
+	BootFile   string `json:"boot_file,omitempty"`
+	ServerName string `json:"server_name,omitempty"`
+	NextServer string `json:"next_server,omitempty"`
+}
+
+// ClassConfig is a class of clients. Clients are in the class if they match
+// all of its criteria; a class without criteria matches all clients.
+type ClassConfig struct {
+	Name string `json:"name"`
+
+	// VendorClass matches clients whose vendor class identifier (option
+	// 60) starts with it, e.g. "PXEClient".
+	VendorClass string `json:"vendor_class,omitempty"`
+
+	// UserClass matches clients sending it as user class (option 77),
+	// e.g. "iPXE".
+	UserClass string `json:"user_class,omitempty"`
+
+	// HardwareAddrPrefix matches clients whose hardware address starts
+	// with it, e.g. the OUI "00:00:5e".
+	HardwareAddrPrefix string `json:"mac_prefix,omitempty"`
+
+	// Pool is the name of the pool the class is served from. If empty,
+	// any pool is used.
+	Pool string `json:"pool,omitempty"`
+
+	// BootFile is the boot file served to the class.
+	BootFile string `json:"boot_file,omitempty"`
+
+	// Options are sent to clients in the class.
+	Options []OptionConfig `json:"options,omitempty"`
+}
+
+// OptionConfig is an option value.
+//
+// Value is written as the JSON form of the option's dhcp4.OptionValue type,
+// see dhcp4.NewOptionValue: a string for addresses ("10.0.0.1") and text, an
+// array of strings for address lists, networks in CIDR notation and the
+// domain search list (option 119), a number for integers and times in
+// seconds, a boolean for flags, and a hex string for all other options.
+type OptionConfig struct {
+	Code  dhcp4.OptionCode `json:"code"`
+	Value json.RawMessage  `json:"value"`
+}
+
+// ReadConfig reads a JSON config from r. It does not validate the config.
+func ReadConfig(r io.Reader) (*Config, error) {
+	d := json.NewDecoder(r)
+	d.DisallowUnknownFields()
+	var c Config
+	if err := d.Decode(&c); err != nil {
+		return nil, fmt.Errorf("invalid config: %v", err)
+	}
+	return &c, nil
+}
+
+// ConfigError lists the problems found by Config.Validate.
+type ConfigError struct {
+	Errors []error
+}
+
+// Error implements error.
+func (ce *ConfigError) Error() string {
+	s := make([]string, 0, len(ce.Errors))
+	for _, err := range ce.Errors {
+		s = append(s, err.Error())
+	}
+	return "invalid config: " + strings.Join(s, "; ")
+}
+
+// Validate checks c for problems that would otherwise only show when
+// serving clients: malformed or overlapping pools, reservations outside of
+// all pools or for the same client or address, options whose values do not
+// fit their type, and classes that can never match because an earlier class
+// matches all their clients.
+//
+// All problems found are returned as a *ConfigError.
+func (c *Config) Validate() error {
+	var errs []error
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+	checkOptions := func(where string, opts []OptionConfig) {
+		for _, o := range opts {
+			if _, err := o.Encode(); err != nil {
+				fail("%s: %v", where, err)
+			}
+		}
+	}
+
+	checkOptions("options", c.Options)
+
+	pools := make(map[string]bool)
+	var ranges []poolRange
+	for i, p := range c.Pools {
+		where := fmt.Sprintf("pool %d (%q)", i, p.Name)
+		if p.Name == "" {
+			fail("%s: no name", where)
+		} else if pools[p.Name] {
+			fail("%s: duplicate name", where)
+		}
+		pools[p.Name] = true
+		checkOptions(where, p.Options)
+
+		r, err := p.addrRange()
+		if err != nil {
+			fail("%s: %v", where, err)
+			continue
+		}
+		for _, other := range ranges {
+			if r.first <= other.last && other.first <= r.last {
+				fail("%s: overlaps pool %q", where, other.name)
+			}
+		}
+		ranges = append(ranges, r)
+	}
+	for i, p := range c.Pools {
+		if p.ServerID == "" {
+			continue
+		}
+		where := fmt.Sprintf("pool %d (%q)", i, p.Name)
+		id := net.ParseIP(p.ServerID).To4()
+		if id == nil {
+			fail("%s: invalid server identifier %q", where, p.ServerID)
+			continue
+		}
+		for _, r := range ranges {
+			if r.name == p.Name {
+				if err := checkServerIDFormat(id, r.subnet); err != nil {
+					fail("%s: %v", where, err)
+				}
+			}
+			if ip := beUint32(id); r.first <= ip && ip <= r.last {
+				fail("%s: server identifier %v is handed out by pool %q", where, id, r.name)
+			}
+		}
+	}
+
+	macs := make(map[string]bool)
+	ips := make(map[string]bool)
+	for i, r := range c.Reservations {
+		where := fmt.Sprintf("reservation %d (%s)", i, r.HardwareAddr)
+		checkOptions(where, r.Options)
+
+		if mac, err := net.ParseMAC(r.HardwareAddr); err != nil {
+			fail("%s: %v", where, err)
+		} else if macs[mac.String()] {
+			fail("%s: duplicate hardware address", where)
+		} else {
+			macs[mac.String()] = true
+		}
+
+		if r.NextServer != "" && net.ParseIP(r.NextServer).To4() == nil {
+			fail("%s: invalid next server %q", where, r.NextServer)
+		}
+
+		ip := net.ParseIP(r.IP).To4()
+		if ip == nil {
+			fail("%s: invalid IPv4 address %q", where, r.IP)
+			continue
+		}
+		if ips[ip.String()] {
+			fail("%s: address %v reserved more than once", where, ip)
+		}
+		ips[ip.String()] = true
+
+		var inPool bool
+		for _, pr := range ranges {
+			inPool = inPool || pr.subnet.Contains(ip)
+		}
+		if !inPool {
+			fail("%s: address %v is not in any pool", where, ip)
+		}
+	}
+
+	for i, cl := range c.Classes {
+		where := fmt.Sprintf("class %d (%q)", i, cl.Name)
+		checkOptions(where, cl.Options)
+		if cl.Pool != "" && !pools[cl.Pool] {
+			fail("%s: unknown pool %q", where, cl.Pool)
+		}
+		if cl.HardwareAddrPrefix != "" {
+			if _, err := parseHardwareAddrPrefix(cl.HardwareAddrPrefix); err != nil {
+				fail("%s: %v", where, err)
+			}
+		}
+		for _, earlier := range c.Classes[:i] {
+			if earlier.covers(cl) {
+				fail("%s: unreachable, all its clients match class %q first", where, earlier.Name)
+				break
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return &ConfigError{Errors: errs}
+	}
+	return nil
+}
+
+// NewFromConfig returns a server at ip serving the validated config c,
+// configured further by opts, which take precedence over c.
+//
+// The server hands out addresses from a single pool, so c must have exactly
+// one. Options of the config and of the pool are sent to all clients, and
+// classes and reservations override them and the boot file for their
+// clients.
+func NewFromConfig(ip net.IP, c *Config, opts ...ServerOpt) (*Server, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	if len(c.Pools) != 1 {
+		return nil, fmt.Errorf("invalid config: the server serves one pool, got %d", len(c.Pools))
+	}
+	pool := c.Pools[0]
+	r, err := pool.addrRange()
+	if err != nil {
+		return nil, err
+	}
+	var first, last [4]byte
+	binary.BigEndian.PutUint32(first[:], r.first)
+	binary.BigEndian.PutUint32(last[:], r.last)
+
+	// Options were validated, so they encode.
+	options := make(dhcp4.Options)
+	addOptions(options, c.Options)
+	addOptions(options, pool.Options)
+	copts := []ServerOpt{
+		WithOptions(options),
+		WithAddressRange(net.IP(first[:]), net.IP(last[:])),
+	}
+	if pool.ServerID != "" {
+		copts = append(copts, WithServerID(net.ParseIP(pool.ServerID)))
+	}
+
+	var reservations []Reservation
+	var hosts []Host
+	for _, rc := range c.Reservations {
+		mac, _ := net.ParseMAC(rc.HardwareAddr)
+		reservations = append(reservations, Reservation{HardwareAddr: mac, IP: net.ParseIP(rc.IP).To4()})
+		h := Host{
+			HardwareAddr: mac,
+			Boot: BootParams{
+				ServerName: rc.ServerName,
+				BootFile:   rc.BootFile,
+			},
+			Options: make(dhcp4.Options),
+		}
+		if rc.NextServer != "" {
+			h.Boot.NextServer = net.ParseIP(rc.NextServer).To4()
+		}
+		addOptions(h.Options, rc.Options)
+		hosts = append(hosts, h)
+	}
+	copts = append(copts, WithReservations(reservations...), WithHosts(hosts...))
+
+	var classes []ClientClass
+	for _, cc := range c.Classes {
+		cl := ClientClass{
+			Name:     cc.Name,
+			Match:    cc.match,
+			BootFile: cc.BootFile,
+			Options:  make(dhcp4.Options),
+		}
+		addOptions(cl.Options, cc.Options)
+		classes = append(classes, cl)
+	}
+	copts = append(copts, WithClasses(classes...))
+
+	return New(ip, r.subnet, "", "", append(copts, opts...)...), nil
+}
+
+// addOptions adds the validated options of oc to o, replacing options with
+// the same codes.
+func addOptions(o dhcp4.Options, oc []OptionConfig) {
+	for _, c := range oc {
+		b, _ := c.Encode()
+		o[c.Code] = b
+	}
+}
+
+// match returns whether the client of req is in cl.
+func (cl ClassConfig) match(req Classification) bool {
+	if cl.VendorClass != "" && !strings.HasPrefix(req.VendorClass, cl.VendorClass) {
+		return false
+	}
+	if cl.UserClass != "" && !req.Request.Options.HasUserClass(cl.UserClass) {
+		return false
+	}
+	if cl.HardwareAddrPrefix != "" {
+		prefix, err := parseHardwareAddrPrefix(cl.HardwareAddrPrefix)
+		if err != nil || !bytes.HasPrefix(req.HardwareAddr, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// poolRange is the range of addresses of a pool, as big-endian integers.
+type poolRange struct {
+	name        string
+	subnet      *net.IPNet
+	first, last uint32
+}
+
+func beUint32(ip net.IP) uint32 {
+	return binary.BigEndian.Uint32(ip.To4())
+}
+
+// addrRange returns the range of addresses of p.
+func (p PoolConfig) addrRange() (poolRange, error) {
+	_, subnet, err := net.ParseCIDR(p.Subnet)
+	if err != nil {
+		return poolRange{}, err
+	}
+	if subnet.IP.To4() == nil {
+		return poolRange{}, fmt.Errorf("subnet %v is not IPv4", subnet)
+	}
+	r := poolRange{
+		name:   p.Name,
+		subnet: subnet,
+		first:  beUint32(subnet.IP),
+		last:   beUint32(subnet.IP) | ^binary.BigEndian.Uint32(net.IP(subnet.Mask).To4()),
+	}
+	for _, bound := range []struct {
+		s   string
+		val *uint32
+	}{
+		{p.Start, &r.first},
+		{p.End, &r.last},
+	} {
+		if bound.s == "" {
+			continue
+		}
+		ip := net.ParseIP(bound.s).To4()
+		if ip == nil {
+			return poolRange{}, fmt.Errorf("invalid IPv4 address %q", bound.s)
+		}
+		if !subnet.Contains(ip) {
+			return poolRange{}, fmt.Errorf("address %v is not in subnet %v", ip, subnet)
+		}
+		*bound.val = beUint32(ip)
+	}
+	if r.first > r.last {
+		return poolRange{}, fmt.Errorf("start %s is after end %s", p.Start, p.End)
+	}
+	return r, nil
+}
+
+// parseHardwareAddrPrefix parses a colon-separated hardware address prefix.
+func parseHardwareAddrPrefix(s string) (net.HardwareAddr, error) {
+	b, err := hex.DecodeString(strings.Replace(s, ":", "", -1))
+	if err != nil || len(b) == 0 {
+		return nil, fmt.Errorf("invalid hardware address prefix %q", s)
+	}
+	return net.HardwareAddr(b), nil
+}
+
+// covers returns whether cl matches all clients other matches.
+func (cl ClassConfig) covers(other ClassConfig) bool {
+	if cl.VendorClass != "" && !strings.HasPrefix(other.VendorClass, cl.VendorClass) {
+		return false
+	}
+	if cl.UserClass != "" && cl.UserClass != other.UserClass {
+		return false
+	}
+	if cl.HardwareAddrPrefix != "" {
+		prefix, err := parseHardwareAddrPrefix(cl.HardwareAddrPrefix)
+		if err != nil {
+			return false
+		}
+		otherPrefix, err := parseHardwareAddrPrefix(other.HardwareAddrPrefix)
+		if err != nil || !bytes.HasPrefix(otherPrefix, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// serverManagedOptions are set by the server for every response and must not
+// be configured.
+var serverManagedOptions = map[dhcp4.OptionCode]bool{
+	dhcp4.OptionRequestedIPAddress:     true,
+	dhcp4.OptionOverload:               true,
+	dhcp4.OptionDHCPMessageType:        true,
+	dhcp4.OptionServerIdentifier:       true,
+	dhcp4.OptionParameterRequestList:   true,
+	dhcp4.OptionMaximumDHCPMessageSize: true,
+	dhcp4.OptionClientIdentifier:       true,
+	dhcp4.OptionVendorClassIdentifier:  true,
+	dhcp4.OptionRelayAgentInformation:  true,
+}
+
+// Encode returns the option value in wire format.
+func (oc OptionConfig) Encode() ([]byte, error) {
+	if oc.Code == dhcp4.Pad || oc.Code == dhcp4.End {
+		return nil, fmt.Errorf("option %d cannot be configured", oc.Code)
+	}
+	if serverManagedOptions[oc.Code] {
+		return nil, fmt.Errorf("option %d is set by the server and cannot be configured", oc.Code)
+	}
+
+	v := dhcp4.NewOptionValue(oc.Code)
+	if v == nil {
+		var s string
+		if err := json.Unmarshal(oc.Value, &s); err != nil {
+			return nil, fmt.Errorf("option %d: value %s is not a hex string", oc.Code, oc.Value)
+		}
+		b, err := hex.DecodeString(s)
+		if err != nil {
+			return nil, fmt.Errorf("option %d: value %s is not a hex string", oc.Code, oc.Value)
+		}
+		return b, nil
+	}
+
+	mismatch := fmt.Errorf("option %d: value %s is not %s", oc.Code, oc.Value, describeValue(v))
+	if err := json.Unmarshal(oc.Value, v); err != nil {
+		return nil, mismatch
+	}
+	b, err := v.MarshalBinary()
+	if err != nil {
+		return nil, fmt.Errorf("option %d: %v", oc.Code, err)
+	}
+	if len(b) == 0 {
+		return nil, mismatch
+	}
+	if _, ok := v.(*dhcp4.String); ok {
+		if err := dhcp4.ValidateString(oc.Code, string(b)); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// describeValue returns how values of the type of v are written in a config.
+func describeValue(v dhcp4.OptionValue) string {
+	switch v.(type) {
+	case *dhcp4.IP:
+		return "an IPv4 address"
+	case *dhcp4.IPList:
+		return "a list of IPv4 addresses"
+	case *dhcp4.IPNetList:
+		return "a list of IPv4 networks"
+	case *dhcp4.StaticRouteList:
+		return "a list of static routes"
+	case *dhcp4.String:
+		return "a non-empty string"
+	case *dhcp4.DomainList:
+		return "a list of domain names"
+	case *dhcp4.Bool:
+		return "a boolean"
+	case *dhcp4.U8, *dhcp4.U16, *dhcp4.U32:
+		return "an unsigned integer in range"
+	case *dhcp4.I32:
+		return "a 32-bit integer"
+	case *dhcp4.Duration:
+		return "a number of seconds"
+	case *dhcp4.U16List:
+		return "a list of unsigned integers"
+	case *dhcp4.CodeList:
+		return "a list of option codes"
+	}
+	return fmt.Sprintf("a %T", v)
+}
@@ -0,0 +1,310 @@
+package dhcp4server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/mergetb/dhcp4"
+	"github.com/mergetb/dhcp4/dhcp4opts"
+)
+
+const testConfig = `{
+	"pools": [
+		{"name": "nodes", "subnet": "10.0.0.0/24", "start": "10.0.0.100", "end": "10.0.0.199"},
+		{"name": "bmcs", "subnet": "10.0.1.0/24", "options": [{"code": 3, "value": ["10.0.1.1"]}]}
+	],
+	"reservations": [
+		{"mac": "00:00:5e:00:53:01", "ip": "10.0.0.10"}
+	],
+	"classes": [
+		{"name": "ipxe", "user_class": "iPXE", "boot_file": "http://boot/script.ipxe"},
+		{"name": "bmc", "mac_prefix": "00:00:5f", "pool": "bmcs"},
+		{"name": "pxe", "vendor_class": "PXEClient", "boot_file": "undionly.kpxe"}
+	],
+	"options": [
+		{"code": 6, "value": ["10.0.0.53", "10.0.0.54"]},
+		{"code": 15, "value": "testbed.example.net"},
+		{"code": 2, "value": -3600},
+		{"code": 26, "value": 9000},
+		{"code": 19, "value": false},
+		{"code": 43, "value": "0102ff"}
+	]
+}`
+
+func TestReadConfig(t *testing.T) {
+	c, err := ReadConfig(strings.NewReader(testConfig))
+	if err != nil {
+		t.Fatalf("ReadConfig() = %v", err)
+	}
+	if err := c.Validate(); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+
+	if _, err := ReadConfig(strings.NewReader(`{"pool": []}`)); err == nil {
+		t.Errorf("ReadConfig() with unknown field = nil, want error")
+	}
+}
+
+func TestOptionConfigEncode(t *testing.T) {
+	for _, tt := range []struct {
+		code  dhcp4.OptionCode
+		value string
+		want  []byte
+	}{
+		{code: dhcp4.OptionSubnetMask, value: `"255.255.255.0"`, want: []byte{255, 255, 255, 0}},
+		{code: dhcp4.OptionRouters, value: `["10.0.0.1", "10.0.0.2"]`, want: []byte{10, 0, 0, 1, 10, 0, 0, 2}},
+		{code: dhcp4.OptionDomainName, value: `"example.net"`, want: []byte("example.net")},
+		{code: dhcp4.OptionMessage, value: `"Grüße"`, want: []byte("Grüße")},
+		{code: dhcp4.OptionIPForwardingEnableDisable, value: `true`, want: []byte{1}},
+		{code: dhcp4.OptionDefaultIPTimeToLive, value: `64`, want: []byte{64}},
+		{code: dhcp4.OptionInterfaceMTU, value: `1500`, want: []byte{0x05, 0xdc}},
+		{code: dhcp4.OptionIPAddressLeaseTime, value: `3600`, want: []byte{0, 0, 0x0e, 0x10}},
+		{code: dhcp4.OptionTimeOffset, value: `-1`, want: []byte{0xff, 0xff, 0xff, 0xff}},
+		{code: dhcp4.OptionVendorSpecificInformation, value: `"01020304"`, want: []byte{1, 2, 3, 4}},
+		{code: dhcp4.OptionDomainSearch, value: `["a.example", "example"]`, want: []byte("\x01a\x07example\x00\xc0\x02")},
+		{code: dhcp4.OptionPolicyFilter, value: `["10.0.0.0/8"]`, want: []byte{10, 0, 0, 0, 255, 0, 0, 0}},
+		{code: dhcp4.OptionStaticRoute, value: `[{"destination": "10.0.0.0", "router": "10.0.1.1"}]`, want: []byte{10, 0, 0, 0, 10, 0, 1, 1}},
+		{code: dhcp4.OptionPathMTUPlateauTable, value: `[1500, 9000]`, want: []byte{0x05, 0xdc, 0x23, 0x28}},
+		// Type mismatches.
+		{code: dhcp4.OptionSubnetMask, value: `["255.255.255.0"]`},
+		{code: dhcp4.OptionRouters, value: `"10.0.0.1"`},
+		{code: dhcp4.OptionRouters, value: `["router"]`},
+		{code: dhcp4.OptionDomainName, value: `42`},
+		{code: dhcp4.OptionIPForwardingEnableDisable, value: `1`},
+		{code: dhcp4.OptionDefaultIPTimeToLive, value: `256`},
+		{code: dhcp4.OptionInterfaceMTU, value: `-1`},
+		{code: dhcp4.OptionVendorSpecificInformation, value: `"xyz"`},
+		{code: dhcp4.OptionDomainSearch, value: `"example.com"`},
+		{code: dhcp4.OptionDomainSearch, value: `["example..com"]`},
+		{code: dhcp4.OptionPolicyFilter, value: `["10.0.0.0"]`},
+		{code: dhcp4.OptionStaticRoute, value: `[{"destination": "10.0.0.0"}]`},
+		// Strings that would not be sent unchanged.
+		{code: dhcp4.OptionDomainName, value: `"bücher.example"`},
+		{code: dhcp4.OptionMessage, value: `"line\nbreak"`},
+		// Set by the server.
+		{code: dhcp4.OptionServerIdentifier, value: `"10.0.0.1"`},
+		{code: dhcp4.End, value: `""`},
+	} {
+		oc := OptionConfig{Code: tt.code, Value: json.RawMessage(tt.value)}
+		got, err := oc.Encode()
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("option %d value %s: Encode() = %v, want error", tt.code, tt.value, got)
+			}
+			continue
+		}
+		if err != nil || !bytes.Equal(got, tt.want) {
+			t.Errorf("option %d value %s: Encode() = %v, %v, want %v", tt.code, tt.value, got, err, tt.want)
+		}
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	pool := func(name, subnet, start, end string) PoolConfig {
+		return PoolConfig{Name: name, Subnet: subnet, Start: start, End: end}
+	}
+	for _, tt := range []struct {
+		desc string
+		c    Config
+		want []string
+	}{
+		{
+			desc: "valid",
+			c: Config{
+				Pools: []PoolConfig{
+					pool("a", "10.0.0.0/24", "10.0.0.10", "10.0.0.99"),
+					pool("b", "10.0.0.0/24", "10.0.0.100", "10.0.0.199"),
+				},
+			},
+		},
+		{
+			desc: "overlapping pools",
+			c: Config{
+				Pools: []PoolConfig{
+					pool("a", "10.0.0.0/24", "", ""),
+					pool("b", "10.0.0.128/25", "", ""),
+					pool("c", "10.0.1.0/24", "10.0.1.10", "10.0.1.99"),
+					pool("d", "10.0.1.0/24", "10.0.1.99", "10.0.1.110"),
+				},
+			},
+			want: []string{`pool 1 ("b"): overlaps pool "a"`, `pool 3 ("d"): overlaps pool "c"`},
+		},
+		{
+			desc: "malformed pools",
+			c: Config{
+				Pools: []PoolConfig{
+					pool("", "10.0.0.0/24", "", ""),
+					pool("b", "10.0.1.0", "", ""),
+					pool("c", "10.0.2.0/24", "10.0.3.1", ""),
+					pool("d", "10.0.4.0/24", "10.0.4.20", "10.0.4.10"),
+					pool("d", "10.0.5.0/24", "", ""),
+				},
+			},
+			want: []string{
+				`pool 0 (""): no name`,
+				`pool 1 ("b"): invalid CIDR address`,
+				`pool 2 ("c"): address 10.0.3.1 is not in subnet`,
+				`pool 3 ("d"): start 10.0.4.20 is after end`,
+				`pool 4 ("d"): duplicate name`,
+			},
+		},
+		{
+			desc: "reservations",
+			c: Config{
+				Pools: []PoolConfig{pool("a", "10.0.0.0/24", "10.0.0.100", "")},
+				Reservations: []ReservationConfig{
+					{HardwareAddr: "00:00:5e:00:53:01", IP: "10.0.0.10"},
+					{HardwareAddr: "00:00:5E:00:53:01", IP: "10.0.0.11"},
+					{HardwareAddr: "00:00:5e:00:53:02", IP: "10.0.0.10"},
+					{HardwareAddr: "00:00:5e:00:53:03", IP: "10.0.1.10"},
+					{HardwareAddr: "nic", IP: "10.0.0.12"},
+				},
+			},
+			want: []string{
+				`reservation 1 (00:00:5E:00:53:01): duplicate hardware address`,
+				`reservation 2 (00:00:5e:00:53:02): address 10.0.0.10 reserved more than once`,
+				`reservation 3 (00:00:5e:00:53:03): address 10.0.1.10 is not in any pool`,
+				`reservation 4 (nic): address nic: invalid MAC address`,
+			},
+		},
+		{
+			desc: "classes",
+			c: Config{
+				Pools: []PoolConfig{pool("a", "10.0.0.0/24", "", "")},
+				Classes: []ClassConfig{
+					{Name: "pxe", VendorClass: "PXEClient"},
+					{Name: "pxe-x86", VendorClass: "PXEClient:Arch:00000"},
+					{Name: "oui", HardwareAddrPrefix: "00:00:5e", Pool: "b"},
+					{Name: "oui-ipxe", HardwareAddrPrefix: "00:00:5e:00", UserClass: "iPXE"},
+					{Name: "other-oui", HardwareAddrPrefix: "00:00:5f"},
+					{Name: "all"},
+					{Name: "never", UserClass: "iPXE"},
+				},
+			},
+			want: []string{
+				`class 1 ("pxe-x86"): unreachable, all its clients match class "pxe" first`,
+				`class 2 ("oui"): unknown pool "b"`,
+				`class 3 ("oui-ipxe"): unreachable, all its clients match class "oui" first`,
+				`class 6 ("never"): unreachable, all its clients match class "all" first`,
+			},
+		},
+		{
+			desc: "server identifiers",
+			c: Config{
+				Pools: []PoolConfig{
+					{Name: "a", Subnet: "10.0.0.0/24", Start: "10.0.0.100", ServerID: "10.0.0.1"},
+					{Name: "b", Subnet: "10.0.1.0/24", ServerID: "10.0.0.150"},
+					{Name: "c", Subnet: "10.0.2.0/24", Start: "10.0.2.10", End: "10.0.2.20", ServerID: "10.0.2.255"},
+					{Name: "d", Subnet: "10.0.3.0/24", Start: "10.0.3.10", End: "10.0.3.20", ServerID: "224.0.0.1"},
+					{Name: "e", Subnet: "10.0.4.0/24", ServerID: "server"},
+				},
+			},
+			want: []string{
+				`pool 1 ("b"): server identifier 10.0.0.150 is handed out by pool "a"`,
+				`pool 2 ("c"): server identifier 10.0.2.255 is the network or broadcast address`,
+				`pool 3 ("d"): server identifier 224.0.0.1 is not a unicast IPv4 address`,
+				`pool 4 ("e"): invalid server identifier "server"`,
+			},
+		},
+		{
+			desc: "options",
+			c: Config{
+				Pools: []PoolConfig{{
+					Name:    "a",
+					Subnet:  "10.0.0.0/24",
+					Options: []OptionConfig{{Code: dhcp4.OptionRouters, Value: json.RawMessage(`"10.0.0.1"`)}},
+				}},
+				Options: []OptionConfig{{Code: dhcp4.OptionDHCPMessageType, Value: json.RawMessage(`2`)}},
+			},
+			want: []string{
+				`options: option 53 is set by the server`,
+				`pool 0 ("a"): option 3: value "10.0.0.1" is not a list of IPv4 addresses`,
+			},
+		},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			err := tt.c.Validate()
+			if tt.want == nil {
+				if err != nil {
+					t.Errorf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			ce, ok := err.(*ConfigError)
+			if !ok {
+				t.Fatalf("Validate() = %v, want *ConfigError", err)
+			}
+			if len(ce.Errors) != len(tt.want) {
+				t.Fatalf("Validate() = %v, want %d problems", err, len(tt.want))
+			}
+			for i, want := range tt.want {
+				if got := ce.Errors[i].Error(); !strings.HasPrefix(got, want) {
+					t.Errorf("problem %d = %q, want prefix %q", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestNewFromConfig(t *testing.T) {
+	c, err := ReadConfig(strings.NewReader(`{
+		"pools": [
+			{"name": "nodes", "subnet": "10.0.0.0/24", "start": "10.0.0.100", "end": "10.0.0.199",
+			 "options": [{"code": 3, "value": ["10.0.0.1"]}]}
+		],
+		"reservations": [
+			{"mac": "00:00:5e:00:53:01", "ip": "10.0.0.10", "boot_file": "node1.efi", "next_server": "10.0.0.2",
+			 "options": [{"code": 12, "value": "node1"}]}
+		],
+		"classes": [
+			{"name": "pxe", "vendor_class": "PXEClient", "boot_file": "undionly.kpxe"}
+		],
+		"options": [
+			{"code": 6, "value": ["10.0.0.53"]},
+			{"code": 12, "value": "unnamed"}
+		]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewFromConfig(net.IP{10, 0, 0, 1}, c)
+	if err != nil {
+		t.Fatalf("NewFromConfig() = %v", err)
+	}
+
+	reserved := newRequest(dhcp4opts.DHCPDiscover, net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 1})
+	offer := exchange(t, s, reserved)
+	if offer == nil {
+		t.Fatal("reserved client got no offer")
+	}
+	if !offer.YIAddr.Equal(net.IP{10, 0, 0, 10}) || offer.BootFile != "node1.efi" || !offer.SIAddr.Equal(net.IP{10, 0, 0, 2}) {
+		t.Errorf("reserved client got %v with boot file %q from %v, want 10.0.0.10 with node1.efi from 10.0.0.2", offer.YIAddr, offer.BootFile, offer.SIAddr)
+	}
+	if got := offer.Options.HostName(); got != "node1" {
+		t.Errorf("reserved client got host name %q, want node1", got)
+	}
+
+	pxe := newRequest(dhcp4opts.DHCPDiscover, net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 2})
+	pxe.Options.SetVendorClassIdentifier("PXEClient:Arch:00000")
+	offer = exchange(t, s, pxe)
+	if offer == nil {
+		t.Fatal("PXE client got no offer")
+	}
+	if ip := beUint32(offer.YIAddr); ip < beUint32(net.IP{10, 0, 0, 100}) || ip > beUint32(net.IP{10, 0, 0, 199}) || offer.BootFile != "undionly.kpxe" {
+		t.Errorf("PXE client got %v with boot file %q, want an address in the pool range with undionly.kpxe", offer.YIAddr, offer.BootFile)
+	}
+	if got := offer.Options.HostName(); got != "unnamed" {
+		t.Errorf("PXE client got host name %q, want unnamed", got)
+	}
+	if got := offer.Options.Routers(); len(got) != 1 || !got[0].Equal(net.IP{10, 0, 0, 1}) {
+		t.Errorf("PXE client got routers %v, want 10.0.0.1", got)
+	}
+
+	c.Pools = append(c.Pools, PoolConfig{Name: "bmcs", Subnet: "10.0.1.0/24"})
+	if _, err := NewFromConfig(net.IP{10, 0, 0, 1}, c); err == nil {
+		t.Errorf("NewFromConfig() with two pools = nil, want error")
+	}
+}
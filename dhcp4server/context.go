@@ -0,0 +1,72 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4server
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// RequestInfo is ingress metadata of a request being handled.
+type RequestInfo struct {
+	// Peer is the address the request was received from.
+	Peer net.Addr
+
+	// Received is when the request was read from the connection.
+	Received time.Time
+}
+
+type requestInfoKey struct{}
+
+// RequestInfoFromContext returns the metadata of the request ctx was created
+// for by the server.
+func RequestInfoFromContext(ctx context.Context) (RequestInfo, bool) {
+	ri, ok := ctx.Value(requestInfoKey{}).(RequestInfo)
+	return ri, ok
+}
+
+// Tracer creates trace spans for the stages of handling a request.
+//
+// Implementations usually wrap a tracing library.
+type Tracer interface {
+	// StartSpan starts a span named name as a child of any span in ctx.
+	// It returns a context carrying the new span and a function that
+	// ends it.
+	StartSpan(ctx context.Context, name string) (context.Context, func())
+}
+
+type nopTracer struct{}
+
+func (nopTracer) StartSpan(ctx context.Context, name string) (context.Context, func()) {
+	return ctx, func() {}
+}
+
+// WithTracer configures the tracer used to trace requests.
+func WithTracer(t Tracer) ServerOpt {
+	return func(s *Server) {
+		s.tracer = t
+	}
+}
+
+// WithRequestTimeout configures how long the server may spend handling a
+// single request, including calls to callbacks. Responses not ready within
+// the timeout are dropped.
+//
+// Default is 5 seconds.
+func WithRequestTimeout(d time.Duration) ServerOpt {
+	return func(s *Server) {
+		s.requestTimeout = d
+	}
+}
+
+// requestContext returns the context for handling a request from peer.
+func (s *Server) requestContext(ctx context.Context, peer net.Addr) (context.Context, context.CancelFunc) {
+	ctx = context.WithValue(ctx, requestInfoKey{}, RequestInfo{
+		Peer:     peer,
+		Received: time.Now(),
+	})
+	return context.WithTimeout(ctx, s.requestTimeout)
+}
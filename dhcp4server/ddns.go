@@ -0,0 +1,334 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DNSUpdater registers the addresses of clients in DNS with dynamic updates
+// (RFC 2136): an A record for the name a client asks for in its Client FQDN
+// or Host Name option, and the matching PTR record, for as long as it holds
+// its lease. Feed it the events of Server.Subscribe with Run.
+//
+// Updates are not signed, so the DNS server must accept updates from the
+// updater's address. A name is taken over by the last client claiming it;
+// the conflict detection of RFC 4703 is not implemented.
+type DNSUpdater struct {
+	// Server is the address of the primary DNS server of the zones, as
+	// host:port.
+	Server string
+
+	// Zone is the forward zone, e.g. "example.com.". Host names that are
+	// not fully qualified are completed with it, and fully qualified names
+	// outside it are not registered.
+	Zone string
+
+	// ReverseZone is the zone of the PTR records, e.g.
+	// "1.168.192.in-addr.arpa.". If empty, PTR records are not updated.
+	ReverseZone string
+
+	// TTL is the time to live of the records. Default is 5 minutes.
+	TTL time.Duration
+
+	// Timeout is how long to wait for the DNS server to answer an update.
+	// Default is 5 seconds.
+	Timeout time.Duration
+
+	// Logger logs failed updates of Run. Default logs to stderr.
+	Logger *log.Logger
+
+	// mu protects names, the name registered for each address.
+	mu    sync.Mutex
+	names map[string]string
+}
+
+// Run updates DNS for each event until ctx is done or events is closed.
+// Failed updates are logged and not retried.
+func (u *DNSUpdater) Run(ctx context.Context, events <-chan LeaseEvent) {
+	logger := u.Logger
+	if logger == nil {
+		logger = defaultLogger()
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			if err := u.Update(ctx, ev); err != nil {
+				logger.Printf("DNS update for %v %v: %v", ev.IP, ev.Kind, err)
+			}
+		}
+	}
+}
+
+// Update updates DNS for ev: it registers the host name of allocated and
+// renewed leases, replacing the records of a name registered before for the
+// address, and removes the records of released and expired leases.
+//
+// Clients without a host name, or asking servers not to update DNS with the
+// N flag of their Client FQDN option, are not registered.
+func (u *DNSUpdater) Update(ctx context.Context, ev LeaseEvent) error {
+	ip := ev.IP.To4()
+	if ip == nil {
+		return fmt.Errorf("%v is not an IPv4 address", ev.IP)
+	}
+	key := ip.String()
+
+	u.mu.Lock()
+	old, registered := u.names[key]
+	u.mu.Unlock()
+
+	switch ev.Kind {
+	case LeaseAllocated, LeaseRenewed:
+		if ev.NoUpdate || ev.HostName == "" {
+			return nil
+		}
+		name, err := u.qualify(ev.HostName)
+		if err != nil {
+			return err
+		}
+		if registered && old != name {
+			if err := u.deregister(ctx, old, ip); err != nil {
+				return err
+			}
+		}
+		if err := u.register(ctx, name, ip); err != nil {
+			return err
+		}
+		u.mu.Lock()
+		if u.names == nil {
+			u.names = make(map[string]string)
+		}
+		u.names[key] = name
+		u.mu.Unlock()
+
+	case LeaseReleased, LeaseExpired:
+		if !registered {
+			return nil
+		}
+		if err := u.deregister(ctx, old, ip); err != nil {
+			return err
+		}
+		u.mu.Lock()
+		delete(u.names, key)
+		u.mu.Unlock()
+	}
+	return nil
+}
+
+// qualify returns the fully qualified name of host, without the trailing
+// dot.
+func (u *DNSUpdater) qualify(host string) (string, error) {
+	zone := strings.ToLower(strings.TrimSuffix(u.Zone, "."))
+	host = strings.ToLower(host)
+	if !strings.HasSuffix(host, ".") {
+		return host + "." + zone, nil
+	}
+	name := strings.TrimSuffix(host, ".")
+	if name != zone && !strings.HasSuffix(name, "."+zone) {
+		return "", fmt.Errorf("%s is outside zone %s", host, u.Zone)
+	}
+	return name, nil
+}
+
+// register replaces the A record of name and the PTR record of ip.
+func (u *DNSUpdater) register(ctx context.Context, name string, ip net.IP) error {
+	ttl := u.ttl()
+	err := u.send(ctx, u.Zone, []dnsRR{
+		{name: name, typ: dnsTypeA, class: dnsClassAny},
+		{name: name, typ: dnsTypeA, class: dnsClassIN, ttl: ttl, rdata: ip},
+	})
+	if err != nil || u.ReverseZone == "" {
+		return err
+	}
+	target, err := appendDNSName(nil, name)
+	if err != nil {
+		return err
+	}
+	return u.send(ctx, u.ReverseZone, []dnsRR{
+		{name: reverseName(ip), typ: dnsTypePTR, class: dnsClassAny},
+		{name: reverseName(ip), typ: dnsTypePTR, class: dnsClassIN, ttl: ttl, rdata: target},
+	})
+}
+
+// deregister removes the A record of name for ip, and the PTR record of ip.
+// Other addresses of name are kept.
+func (u *DNSUpdater) deregister(ctx context.Context, name string, ip net.IP) error {
+	err := u.send(ctx, u.Zone, []dnsRR{
+		{name: name, typ: dnsTypeA, class: dnsClassNone, rdata: ip},
+	})
+	if err != nil || u.ReverseZone == "" {
+		return err
+	}
+	return u.send(ctx, u.ReverseZone, []dnsRR{
+		{name: reverseName(ip), typ: dnsTypePTR, class: dnsClassAny},
+	})
+}
+
+func (u *DNSUpdater) ttl() uint32 {
+	if u.TTL <= 0 {
+		return uint32((5 * time.Minute).Seconds())
+	}
+	return uint32(u.TTL.Seconds())
+}
+
+// send sends an update of zone with the update section rrs to the DNS server
+// and waits for its answer.
+func (u *DNSUpdater) send(ctx context.Context, zone string, rrs []dnsRR) error {
+	var idb [2]byte
+	if _, err := rand.Read(idb[:]); err != nil {
+		return err
+	}
+	id := binary.BigEndian.Uint16(idb[:])
+	msg, err := marshalDNSUpdate(id, zone, rrs)
+	if err != nil {
+		return err
+	}
+
+	timeout := u.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", u.Server)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		return err
+	}
+	if _, err := conn.Write(msg); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 512)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return fmt.Errorf("update of zone %s: %v", zone, err)
+		}
+		// Skip answers to other messages.
+		if n < 12 || binary.BigEndian.Uint16(buf) != id || buf[2]&0x80 == 0 {
+			continue
+		}
+		if rcode := buf[3] & 0x0f; rcode != 0 {
+			return fmt.Errorf("update of zone %s: %s", zone, dnsRcodeName(rcode))
+		}
+		return nil
+	}
+}
+
+// DNS constants used by updates, see RFC 1035 and RFC 2136.
+const (
+	dnsOpcodeUpdate = 5
+
+	dnsTypeA   = 1
+	dnsTypeSOA = 6
+	dnsTypePTR = 12
+
+	dnsClassIN   = 1
+	dnsClassNone = 254
+	dnsClassAny  = 255
+)
+
+// dnsRR is a resource record of the update section of an update.
+type dnsRR struct {
+	name       string
+	typ, class uint16
+	ttl        uint32
+	rdata      []byte
+}
+
+// marshalDNSUpdate returns the update message id of zone with the update
+// section rrs, see RFC 2136, Section 2.
+func marshalDNSUpdate(id uint16, zone string, rrs []dnsRR) ([]byte, error) {
+	b := make([]byte, 12, 512)
+	binary.BigEndian.PutUint16(b[0:], id)
+	binary.BigEndian.PutUint16(b[2:], dnsOpcodeUpdate<<11)
+	binary.BigEndian.PutUint16(b[4:], 1) // ZOCOUNT
+	binary.BigEndian.PutUint16(b[8:], uint16(len(rrs)))
+
+	var err error
+	if b, err = appendDNSName(b, zone); err != nil {
+		return nil, err
+	}
+	b = appendUint16s(b, dnsTypeSOA, dnsClassIN)
+	for _, rr := range rrs {
+		if b, err = appendDNSName(b, rr.name); err != nil {
+			return nil, err
+		}
+		b = appendUint16s(b, rr.typ, rr.class, uint16(rr.ttl>>16), uint16(rr.ttl), uint16(len(rr.rdata)))
+		b = append(b, rr.rdata...)
+	}
+	return b, nil
+}
+
+func appendUint16s(b []byte, vs ...uint16) []byte {
+	for _, v := range vs {
+		b = append(b, byte(v>>8), byte(v))
+	}
+	return b
+}
+
+// appendDNSName appends the uncompressed wire format of the fully qualified
+// name, with or without a trailing dot, to b.
+func appendDNSName(b []byte, name string) ([]byte, error) {
+	name = strings.TrimSuffix(name, ".")
+	if len(name)+2 > 255 {
+		return nil, fmt.Errorf("DNS name %q is too long", name)
+	}
+	if name != "" {
+		for _, label := range strings.Split(name, ".") {
+			if len(label) == 0 || len(label) > 63 {
+				return nil, fmt.Errorf("DNS name %q has an invalid label", name)
+			}
+			b = append(b, byte(len(label)))
+			b = append(b, label...)
+		}
+	}
+	return append(b, 0), nil
+}
+
+// reverseName returns the in-addr.arpa name of the IPv4 address ip.
+func reverseName(ip net.IP) string {
+	return fmt.Sprintf("%d.%d.%d.%d.in-addr.arpa", ip[3], ip[2], ip[1], ip[0])
+}
+
+var dnsRcodeNames = []string{
+	1:  "FORMERR",
+	2:  "SERVFAIL",
+	3:  "NXDOMAIN",
+	4:  "NOTIMP",
+	5:  "REFUSED",
+	6:  "YXDOMAIN",
+	7:  "YXRRSET",
+	8:  "NXRRSET",
+	9:  "NOTAUTH",
+	10: "NOTZONE",
+}
+
+func dnsRcodeName(rcode byte) string {
+	if int(rcode) < len(dnsRcodeNames) && dnsRcodeNames[rcode] != "" {
+		return dnsRcodeNames[rcode]
+	}
+	return fmt.Sprintf("RCODE %d", rcode)
+}
@@ -0,0 +1,178 @@
+package dhcp4server
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// dnsServer answers DNS updates with rcode and sends them to updates,
+// decoded as "zone: rr, rr".
+func dnsServer(t *testing.T, rcode byte) (string, <-chan string) {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	updates := make(chan string, 10)
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			updates <- decodeDNSUpdate(buf[:n])
+			reply := append([]byte(nil), buf[:12]...)
+			reply[2] |= 0x80
+			reply[3] = rcode
+			conn.WriteTo(reply, addr)
+		}
+	}()
+	return conn.LocalAddr().String(), updates
+}
+
+func decodeDNSUpdate(b []byte) string {
+	name := func() string {
+		var labels []string
+		for b[0] != 0 {
+			labels = append(labels, string(b[1:1+b[0]]))
+			b = b[1+b[0]:]
+		}
+		b = b[1:]
+		return strings.Join(labels, ".")
+	}
+	if b[2]>>3 != dnsOpcodeUpdate {
+		return "not an update"
+	}
+	n := int(binary.BigEndian.Uint16(b[8:]))
+	b = b[12:]
+	zone := name()
+	b = b[4:]
+	var rrs []string
+	for i := 0; i < n; i++ {
+		rr := name()
+		typ, class := binary.BigEndian.Uint16(b), binary.BigEndian.Uint16(b[2:])
+		ttl, rdlen := binary.BigEndian.Uint32(b[4:]), int(binary.BigEndian.Uint16(b[8:]))
+		rdata := b[10 : 10+rdlen]
+		b = b[10+rdlen:]
+		rrs = append(rrs, fmt.Sprintf("%s %d %d %d %x", rr, typ, class, ttl, rdata))
+	}
+	return zone + ": " + strings.Join(rrs, ", ")
+}
+
+func TestDNSUpdater(t *testing.T) {
+	addr, updates := dnsServer(t, 0)
+	u := &DNSUpdater{
+		Server:      addr,
+		Zone:        "example.com.",
+		ReverseZone: "1.168.192.in-addr.arpa.",
+		TTL:         time.Minute,
+		Timeout:     time.Second,
+	}
+	ip := net.IP{192, 168, 1, 10}
+	ctx := context.Background()
+
+	for _, tt := range []struct {
+		name string
+		ev   LeaseEvent
+		want []string
+	}{
+		{
+			name: "allocated",
+			ev:   LeaseEvent{Kind: LeaseAllocated, IP: ip, HostName: "PC1"},
+			want: []string{
+				"example.com: pc1.example.com 1 255 0 , pc1.example.com 1 1 60 c0a8010a",
+				"1.168.192.in-addr.arpa: 10.1.168.192.in-addr.arpa 12 255 0 , 10.1.168.192.in-addr.arpa 12 1 60 03706331076578616d706c6503636f6d00",
+			},
+		},
+		{
+			name: "renamed",
+			ev:   LeaseEvent{Kind: LeaseRenewed, IP: ip, HostName: "pc2.example.com."},
+			want: []string{
+				"example.com: pc1.example.com 1 254 0 c0a8010a",
+				"1.168.192.in-addr.arpa: 10.1.168.192.in-addr.arpa 12 255 0 ",
+				"example.com: pc2.example.com 1 255 0 , pc2.example.com 1 1 60 c0a8010a",
+				"1.168.192.in-addr.arpa: 10.1.168.192.in-addr.arpa 12 255 0 , 10.1.168.192.in-addr.arpa 12 1 60 03706332076578616d706c6503636f6d00",
+			},
+		},
+		{
+			name: "released",
+			ev:   LeaseEvent{Kind: LeaseReleased, IP: ip},
+			want: []string{
+				"example.com: pc2.example.com 1 254 0 c0a8010a",
+				"1.168.192.in-addr.arpa: 10.1.168.192.in-addr.arpa 12 255 0 ",
+			},
+		},
+		{
+			name: "released again",
+			ev:   LeaseEvent{Kind: LeaseReleased, IP: ip},
+		},
+		{
+			name: "no update",
+			ev:   LeaseEvent{Kind: LeaseAllocated, IP: ip, HostName: "pc1", NoUpdate: true},
+		},
+		{
+			name: "no host name",
+			ev:   LeaseEvent{Kind: LeaseAllocated, IP: ip},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := u.Update(ctx, tt.ev); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for len(updates) > 0 {
+				got = append(got, <-updates)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("updates = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if err := u.Update(ctx, LeaseEvent{Kind: LeaseAllocated, IP: ip, HostName: "pc1.example.org."}); err == nil {
+		t.Error("Update of a name outside the zone succeeded")
+	}
+}
+
+func TestDNSUpdaterRefused(t *testing.T) {
+	addr, _ := dnsServer(t, 5)
+	u := &DNSUpdater{Server: addr, Zone: "example.com.", Timeout: time.Second}
+	err := u.Update(context.Background(), LeaseEvent{Kind: LeaseAllocated, IP: net.IP{192, 168, 1, 10}, HostName: "pc1"})
+	if err == nil || !strings.Contains(err.Error(), "REFUSED") {
+		t.Errorf("Update = %v, want REFUSED", err)
+	}
+}
+
+func TestDNSUpdaterRun(t *testing.T) {
+	addr, updates := dnsServer(t, 0)
+	s := newTestServer(t)
+	events, cancel := s.Subscribe(10)
+	u := &DNSUpdater{Server: addr, Zone: "example.com.", Timeout: time.Second}
+	done := make(chan struct{})
+	go func() {
+		u.Run(context.Background(), events)
+		close(done)
+	}()
+
+	mac := net.HardwareAddr{2, 0, 0, 0, 0, 1}
+	ip := bind(t, s, mac, "pc1")
+	select {
+	case got := <-updates:
+		want := fmt.Sprintf("example.com: pc1.example.com 1 255 0 , pc1.example.com 1 1 300 %x", []byte(ip.To4()))
+		if got != want {
+			t.Errorf("update = %q, want %q", got, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no update")
+	}
+	cancel()
+	<-done
+}
@@ -0,0 +1,51 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4server
+
+import (
+	"github.com/mergetb/dhcp4"
+)
+
+// echoPolicy selects the request options that replies repeat.
+type echoPolicy struct {
+	noRelayAgentInfo bool
+	noClientID       bool
+}
+
+// WithoutRelayAgentInfoEcho stops the server from echoing the relay agent
+// information option (82) of relayed requests in its replies.
+//
+// RFC 3046, Section 2.2 requires the echo, and relay agents commonly drop
+// replies without it or use it to forward them, so this is only useful with
+// relay agents that misbehave when they get the option back.
+func WithoutRelayAgentInfoEcho() ServerOpt {
+	return func(s *Server) {
+		s.echo.noRelayAgentInfo = true
+	}
+}
+
+// WithoutClientIDEcho stops the server from echoing the client identifier
+// option (61) in its replies.
+//
+// RFC 6842 requires the echo, and clients implementing it drop replies with
+// a different or missing client identifier, so this is only useful for
+// clients that predate it and choke on the option.
+func WithoutClientIDEcho() ServerOpt {
+	return func(s *Server) {
+		s.echo.noClientID = true
+	}
+}
+
+// echoOptions copies the options of req that reply must repeat unchanged
+// into reply: the relay agent information option if req was relayed (RFC
+// 3046, Section 2.2) and the client identifier (RFC 6842).
+func (e echoPolicy) echoOptions(req, reply *dhcp4.Packet) {
+	if v := req.Options.Get(dhcp4.OptionRelayAgentInformation); !e.noRelayAgentInfo && v != nil && !unspecified(req.GIAddr) {
+		reply.Options[dhcp4.OptionRelayAgentInformation] = v
+	}
+	if v := req.Options.Get(dhcp4.OptionClientIdentifier); !e.noClientID && v != nil {
+		reply.Options[dhcp4.OptionClientIdentifier] = v
+	}
+}
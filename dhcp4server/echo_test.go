@@ -0,0 +1,65 @@
+package dhcp4server
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/mergetb/dhcp4"
+	"github.com/mergetb/dhcp4/dhcp4opts"
+)
+
+func TestEchoOptions(t *testing.T) {
+	relayInfo := []byte{1, 4, 'e', 't', 'h', '0'}
+	clientID := []byte{1, 0, 0, 0x5e, 0, 0x53, 1}
+	for _, tt := range []struct {
+		desc          string
+		opts          []ServerOpt
+		relayed       bool
+		wantRelayInfo bool
+		wantClientID  bool
+	}{
+		{desc: "relayed", relayed: true, wantRelayInfo: true, wantClientID: true},
+		// Only relay agents add option 82; clients must not.
+		{desc: "not relayed", wantClientID: true},
+		{desc: "relay agent info echo disabled", opts: []ServerOpt{WithoutRelayAgentInfoEcho()}, relayed: true, wantClientID: true},
+		{desc: "client ID echo disabled", opts: []ServerOpt{WithoutClientIDEcho()}, relayed: true, wantRelayInfo: true},
+	} {
+		s := newTestServer(t, tt.opts...)
+		req := newRequest(dhcp4opts.DHCPDiscover, net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 1})
+		req.Options[dhcp4.OptionRelayAgentInformation] = relayInfo
+		req.Options[dhcp4.OptionClientIdentifier] = clientID
+		if tt.relayed {
+			req.GIAddr = net.IP{192, 168, 1, 254}
+		}
+		offer := exchange(t, s, req)
+		if offer == nil {
+			t.Fatalf("%s: no offer", tt.desc)
+		}
+
+		got, ok := offer.Options[dhcp4.OptionRelayAgentInformation]
+		if ok != tt.wantRelayInfo || (ok && !bytes.Equal(got, relayInfo)) {
+			t.Errorf("%s: relay agent information %v (present %v), want present %v", tt.desc, got, ok, tt.wantRelayInfo)
+		}
+		got, ok = offer.Options[dhcp4.OptionClientIdentifier]
+		if ok != tt.wantClientID || (ok && !bytes.Equal(got, clientID)) {
+			t.Errorf("%s: client identifier %v (present %v), want present %v", tt.desc, got, ok, tt.wantClientID)
+		}
+	}
+}
+
+func TestEchoOptionsNAK(t *testing.T) {
+	s := newTestServer(t)
+	req := newRequest(dhcp4opts.DHCPRequest, net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 1})
+	req.GIAddr = net.IP{192, 168, 1, 254}
+	req.Options[dhcp4.OptionRequestedIPAddress] = []byte{192, 168, 1, 10}
+	req.Options[dhcp4.OptionRelayAgentInformation] = []byte{2, 1, 7}
+	req.Options.SetServerIdentifier(s.ServerID())
+	nak := exchange(t, s, req)
+	if nak == nil || nak.Options.MessageType() != dhcp4.DHCPNAK {
+		t.Fatalf("got %v, want NAK", nak)
+	}
+	if got := nak.Options[dhcp4.OptionRelayAgentInformation]; !bytes.Equal(got, []byte{2, 1, 7}) {
+		t.Errorf("NAK relay agent information %v, want [2 1 7]", got)
+	}
+}
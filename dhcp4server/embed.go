@@ -0,0 +1,105 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4server
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"os"
+)
+
+// ErrRunning is returned by Start if the server is already serving.
+var ErrRunning = errors.New("server is already running")
+
+// WithLogger configures the logger of a server started with Start.
+//
+// Default is a logger writing to standard error.
+func WithLogger(l *log.Logger) ServerOpt {
+	return func(s *Server) {
+		s.logger = l
+	}
+}
+
+// serveRun is a ServeContext run started by Start.
+type serveRun struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	// err is the error serving ended with. It is set before done is
+	// closed.
+	err error
+}
+
+// Start serves DHCP requests on conn in the background, like ServeContext
+// with the logger configured by WithLogger, until ctx is canceled, Stop is
+// called or serving fails. It lets a server run inside another daemon.
+//
+// The caller keeps owning conn and closes it after serving ended. A stopped
+// server can be started again; its bindings and history are kept.
+func (s *Server) Start(ctx context.Context, conn net.PacketConn) error {
+	s.runMu.Lock()
+	defer s.runMu.Unlock()
+	if s.run != nil {
+		select {
+		case <-s.run.done:
+		default:
+			return ErrRunning
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	r := &serveRun{cancel: cancel, done: make(chan struct{})}
+	s.run = r
+	go func() {
+		err := s.ServeContext(ctx, s.logger, conn)
+		if ctx.Err() != nil {
+			// Stopped rather than failed.
+			err = nil
+		}
+		r.err = err
+		cancel()
+		close(r.done)
+	}()
+	return nil
+}
+
+// Stop stops serving started by Start and waits for the requests being
+// handled. It returns the error serving failed with, if it failed before it
+// was stopped.
+//
+// Stop does nothing if the server was not started.
+func (s *Server) Stop() error {
+	s.runMu.Lock()
+	r := s.run
+	s.runMu.Unlock()
+	if r == nil {
+		return nil
+	}
+	r.cancel()
+	<-r.done
+	return r.err
+}
+
+// Wait waits until serving started by Start ends and returns the error it
+// failed with, or nil if it was stopped by ctx or Stop.
+//
+// Wait returns nil at once if the server was not started.
+func (s *Server) Wait() error {
+	s.runMu.Lock()
+	r := s.run
+	s.runMu.Unlock()
+	if r == nil {
+		return nil
+	}
+	<-r.done
+	return r.err
+}
+
+// defaultLogger is the logger of a server not configured with WithLogger.
+func defaultLogger() *log.Logger {
+	return log.New(os.Stderr, "", log.LstdFlags)
+}
@@ -0,0 +1,76 @@
+package dhcp4server
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mergetb/dhcp4/dhcp4opts"
+)
+
+func TestStartStop(t *testing.T) {
+	s := newTestServer(t, WithLogger(testLogger))
+	if err := s.Stop(); err != nil {
+		t.Errorf("Stop() before Start = %v, want nil", err)
+	}
+
+	for i, mac := range []net.HardwareAddr{{0, 0, 0x5e, 0, 0x53, 1}, {0, 0, 0x5e, 0, 0x53, 2}} {
+		conn := &chanConn{
+			in:       make(chan packet),
+			deadline: make(chan struct{}),
+		}
+		if err := s.Start(context.Background(), conn); err != nil {
+			t.Fatalf("Start() = %v", err)
+		}
+		if err := s.Start(context.Background(), conn); err != ErrRunning {
+			t.Errorf("Start() while running = %v, want %v", err, ErrRunning)
+		}
+
+		b, err := newRequest(dhcp4opts.DHCPDiscover, mac).MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.in <- packet{b: b, addr: testPeer}
+		deadline := time.Now().Add(5 * time.Second)
+		for len(s.Leases(HistoryQuery{})) != i+1 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		if err := s.Stop(); err != nil {
+			t.Errorf("Stop() = %v, want nil", err)
+		}
+		// Bindings survive restarts.
+		if got := len(s.Leases(HistoryQuery{})); got != i+1 {
+			t.Errorf("got %d leases, want %d", got, i+1)
+		}
+	}
+}
+
+func TestStartFails(t *testing.T) {
+	s := newTestServer(t, WithLogger(testLogger))
+	if err := s.Start(context.Background(), goneConn{}); err != nil {
+		t.Fatalf("Start() = %v", err)
+	}
+	if err := s.Wait(); !socketGone(err) {
+		t.Errorf("Wait() = %v, want ENETDOWN", err)
+	}
+	if err := s.Stop(); !socketGone(err) {
+		t.Errorf("Stop() = %v, want ENETDOWN", err)
+	}
+}
+
+func TestStartContextCanceled(t *testing.T) {
+	s := newTestServer(t, WithLogger(testLogger))
+	conn := &chanConn{
+		in:       make(chan packet),
+		deadline: make(chan struct{}),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := s.Start(ctx, conn); err != nil {
+		t.Fatalf("Start() = %v", err)
+	}
+	cancel()
+	if err := s.Wait(); err != nil {
+		t.Errorf("Wait() = %v, want nil", err)
+	}
+}
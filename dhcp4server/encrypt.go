@@ -0,0 +1,105 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4server
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+// KeyFunc returns the key encrypting a lease store: 16, 24 or 32 bytes for
+// AES-128, AES-192 or AES-256. It may fetch the key from a key management
+// service.
+type KeyFunc func() ([]byte, error)
+
+// KeyFromFile returns a KeyFunc reading the key from the file at path, which
+// holds it hex-encoded, e.g. as written by "openssl rand -hex 32".
+func KeyFromFile(path string) KeyFunc {
+	return func() ([]byte, error) {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		key, err := hex.DecodeString(string(bytes.TrimSpace(b)))
+		if err != nil {
+			return nil, fmt.Errorf("key file %s: %v", path, err)
+		}
+		return key, nil
+	}
+}
+
+// FileLeasesOpt is a function that configures FileLeases.
+type FileLeasesOpt func(*FileLeases) error
+
+// WithEncryption encrypts the lease file with AES-GCM under the key returned
+// by key, which is called once when the file is opened.
+//
+// Unencrypted lease files are read and encrypted the next time they are
+// saved, so that encryption can be turned on for an existing file.
+func WithEncryption(key KeyFunc) FileLeasesOpt {
+	return func(fl *FileLeases) error {
+		k, err := key()
+		if err != nil {
+			return fmt.Errorf("lease file key: %v", err)
+		}
+		aead, err := newAEAD(k)
+		if err != nil {
+			return fmt.Errorf("lease file key: %v", err)
+		}
+		fl.aead = aead
+		return nil
+	}
+}
+
+// encryptedMagic starts encrypted files. It is authenticated along with the
+// contents.
+var encryptedMagic = []byte("dhcp4-aes-gcm-v1\n")
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// isEncrypted returns whether data was written by seal.
+func isEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, encryptedMagic)
+}
+
+// seal encrypts data with aead under a random nonce.
+func seal(aead cipher.AEAD, data []byte) ([]byte, error) {
+	b := make([]byte, len(encryptedMagic)+aead.NonceSize(), len(encryptedMagic)+aead.NonceSize()+len(data)+aead.Overhead())
+	copy(b, encryptedMagic)
+	nonce := b[len(encryptedMagic):]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(b, nonce, data, encryptedMagic), nil
+}
+
+// errDecrypt is returned for encrypted data that cannot be decrypted.
+var errDecrypt = errors.New("cannot decrypt: wrong key or corrupted file")
+
+// unseal decrypts data written by seal.
+func unseal(aead cipher.AEAD, data []byte) ([]byte, error) {
+	data = data[len(encryptedMagic):]
+	if len(data) < aead.NonceSize() {
+		return nil, errDecrypt
+	}
+	nonce, ciphertext := data[:aead.NonceSize()], data[aead.NonceSize():]
+	plain, err := aead.Open(nil, nonce, ciphertext, encryptedMagic)
+	if err != nil {
+		return nil, errDecrypt
+	}
+	return plain, nil
+}
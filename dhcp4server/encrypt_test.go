@@ -0,0 +1,108 @@
+package dhcp4server
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func staticKey(key []byte) KeyFunc {
+	return func() ([]byte, error) { return key, nil }
+}
+
+func TestFileLeasesEncrypted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "leases")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "leases.json")
+	_, subnet, _ := net.ParseCIDR("192.168.1.0/24")
+	key := bytes.Repeat([]byte{7}, 32)
+	mac := net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 1}
+
+	// Start unencrypted, then turn encryption on.
+	l, err := OpenFileLeases(path, subnet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Allocate(Binding{Key: "a", HardwareAddr: mac}, net.IP{192, 168, 1, 20}); err != nil {
+		t.Fatal(err)
+	}
+	l, err = OpenFileLeases(path, subnet, WithEncryption(staticKey(key)))
+	if err != nil {
+		t.Fatalf("OpenFileLeases() of an unencrypted file with a key = %v", err)
+	}
+	if _, err := l.Allocate(Binding{Key: "b", HardwareAddr: mac}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isEncrypted(data) || bytes.Contains(data, []byte(mac.String())) || bytes.Contains(data, []byte("192.168.1.20")) {
+		t.Errorf("lease file is not encrypted: %q", data)
+	}
+
+	reopened, err := OpenFileLeases(path, subnet, WithEncryption(staticKey(key)))
+	if err != nil {
+		t.Fatalf("OpenFileLeases() of the encrypted file = %v", err)
+	}
+	if b, ok := reopened.Lookup("a"); !ok || !b.IP.Equal(net.IP{192, 168, 1, 20}) {
+		t.Errorf("Lookup(a) after reopening = %v, %v; want 192.168.1.20", b.IP, ok)
+	}
+	if n := len(reopened.All()); n != 2 {
+		t.Errorf("All() after reopening has %d bindings, want 2", n)
+	}
+
+	if _, err := OpenFileLeases(path, subnet); err == nil {
+		t.Errorf("OpenFileLeases() of the encrypted file without a key succeeded")
+	}
+	if _, err := OpenFileLeases(path, subnet, WithEncryption(staticKey(bytes.Repeat([]byte{8}, 32)))); err == nil {
+		t.Errorf("OpenFileLeases() with the wrong key succeeded")
+	}
+	data[len(data)-1] ^= 1
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenFileLeases(path, subnet, WithEncryption(staticKey(key))); err == nil {
+		t.Errorf("OpenFileLeases() of a corrupted file succeeded")
+	}
+}
+
+func TestKeyFromFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "leases")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, tt := range []struct {
+		contents string
+		want     []byte
+		wantErr  bool
+	}{
+		{contents: "000102030405060708090a0b0c0d0e0f\n", want: []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}},
+		{contents: "not hex", wantErr: true},
+	} {
+		path := filepath.Join(dir, "key")
+		if err := ioutil.WriteFile(path, []byte(tt.contents), 0600); err != nil {
+			t.Fatal(err)
+		}
+		got, err := KeyFromFile(path)()
+		if (err != nil) != tt.wantErr || !bytes.Equal(got, tt.want) {
+			t.Errorf("KeyFromFile() of %q = %v, %v; want %v, error %t", tt.contents, got, err, tt.want, tt.wantErr)
+		}
+	}
+
+	if _, err := KeyFromFile(filepath.Join(dir, "missing"))(); err == nil {
+		t.Errorf("KeyFromFile() of a missing file succeeded")
+	}
+	if _, err := OpenFileLeases(filepath.Join(dir, "leases.json"), nil, WithEncryption(staticKey([]byte{1, 2, 3}))); err == nil {
+		t.Errorf("OpenFileLeases() with a 3-byte key succeeded")
+	}
+}
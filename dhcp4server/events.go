@@ -0,0 +1,135 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4server
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+)
+
+// LeaseEventKind is what happened to a lease.
+type LeaseEventKind int
+
+// Lease event kinds.
+const (
+	// LeaseAllocated is sent when a client is first bound to an address,
+	// by a REQUEST or by rapid commit. Offers are not leases yet.
+	LeaseAllocated LeaseEventKind = iota + 1
+
+	// LeaseRenewed is sent when a bound client requests its address
+	// again.
+	LeaseRenewed
+
+	// LeaseReleased is sent when a client releases or declines its
+	// address.
+	LeaseReleased
+
+	// LeaseExpired is sent when the server ends a lease the client did not
+	// release: because its lease time ran out, through ReleaseLease,
+	// because its address is outside a resized pool, or because the client
+	// moved to another link.
+	LeaseExpired
+)
+
+// String implements fmt.Stringer.
+func (k LeaseEventKind) String() string {
+	switch k {
+	case LeaseAllocated:
+		return "allocated"
+	case LeaseRenewed:
+		return "renewed"
+	case LeaseReleased:
+		return "released"
+	case LeaseExpired:
+		return "expired"
+	}
+	return fmt.Sprintf("LeaseEventKind(%d)", int(k))
+}
+
+// LeaseEvent is a change in the lifecycle of a lease.
+type LeaseEvent struct {
+	Kind LeaseEventKind
+	Time time.Time
+
+	IP           net.IP
+	HardwareAddr net.HardwareAddr
+	ClientID     []byte
+
+	// HostName is the name the client asked for in its Client FQDN option
+	// (RFC 4702), or else in its Host Name option. Names ending in a dot
+	// are fully qualified. It is only set for LeaseAllocated and
+	// LeaseRenewed, taken from the request.
+	HostName string
+
+	// NoUpdate is set if the client asked servers not to update DNS for
+	// it with the N flag of its Client FQDN option.
+	NoUpdate bool
+}
+
+// Subscribe returns a channel receiving the lease events of the server, and
+// a function ending the subscription and closing the channel.
+//
+// The server never waits for subscribers: events arriving while the channel
+// already holds buffer events are dropped. Subscribers must keep up, or use
+// a buffer large enough for bursts of clients.
+func (s *Server) Subscribe(buffer int) (<-chan LeaseEvent, func()) {
+	ch := make(chan LeaseEvent, buffer)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.subscribers == nil {
+		s.subscribers = make(map[chan LeaseEvent]struct{})
+	}
+	s.subscribers[ch] = struct{}{}
+
+	cancel := func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if _, ok := s.subscribers[ch]; ok {
+			delete(s.subscribers, ch)
+			close(ch)
+		}
+	}
+	return ch, cancel
+}
+
+// emit sends the event of kind for binding b to the subscribers. request is
+// the request causing it, if any.
+//
+// s.mu must be held.
+func (s *Server) emit(kind LeaseEventKind, b Binding, request *dhcp4.Packet, now time.Time) {
+	if len(s.subscribers) == 0 {
+		return
+	}
+	ev := LeaseEvent{
+		Kind:         kind,
+		Time:         now,
+		IP:           b.IP,
+		HardwareAddr: b.HardwareAddr,
+		ClientID:     b.ClientID,
+	}
+	if request != nil {
+		ev.HostName, ev.NoUpdate = requestedHostName(request)
+	}
+	for ch := range s.subscribers {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// requestedHostName returns the host name the client of request asked for,
+// and whether it asked servers not to update DNS.
+func requestedHostName(request *dhcp4.Packet) (string, bool) {
+	if f := request.Options.ClientFQDN(); f != nil {
+		return f.Name, f.Flags&dhcp4.FQDNNoUpdate != 0
+	}
+	return strings.TrimSpace(request.Options.HostName()), false
+}
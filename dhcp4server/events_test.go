@@ -0,0 +1,72 @@
+package dhcp4server
+
+import (
+	"net"
+	"testing"
+
+	"github.com/mergetb/dhcp4"
+	"github.com/mergetb/dhcp4/dhcp4opts"
+)
+
+// bind binds the client mac on s and returns its address.
+func bind(t *testing.T, s *Server, mac net.HardwareAddr, host string) net.IP {
+	t.Helper()
+	offer := exchange(t, s, newRequest(dhcp4opts.DHCPDiscover, mac))
+	if offer == nil {
+		t.Fatal("no offer")
+	}
+	request := newRequest(dhcp4opts.DHCPRequest, mac)
+	request.Options.SetRequestedIPAddress(offer.YIAddr)
+	if host != "" {
+		request.Options.SetClientFQDN(&dhcp4.ClientFQDN{Flags: dhcp4.FQDNServerUpdate, Name: host})
+	}
+	if ack := exchange(t, s, request); ack == nil || ack.Options.MessageType() != dhcp4.DHCPACK {
+		t.Fatalf("response to REQUEST = %v, want ACK", ack)
+	}
+	return offer.YIAddr
+}
+
+func TestSubscribe(t *testing.T) {
+	s := newTestServer(t)
+	events, cancel := s.Subscribe(10)
+	released := net.HardwareAddr{2, 0, 0, 0, 0, 1}
+	expired := net.HardwareAddr{2, 0, 0, 0, 0, 2}
+
+	ip := bind(t, s, released, "pc1")
+	request := newRequest(dhcp4opts.DHCPRequest, released)
+	request.Options.SetRequestedIPAddress(ip)
+	exchange(t, s, request)
+	exchange(t, s, newRelease(s, released, ip))
+
+	ip2 := bind(t, s, expired, "")
+	if err := s.ReleaseLease(ip2); err != nil {
+		t.Fatal(err)
+	}
+	// Offers never requested are not leases.
+	exchange(t, s, newRequest(dhcp4opts.DHCPDiscover, net.HardwareAddr{2, 0, 0, 0, 0, 3}))
+	cancel()
+
+	want := []struct {
+		kind LeaseEventKind
+		ip   net.IP
+		host string
+	}{
+		{LeaseAllocated, ip, "pc1"},
+		{LeaseRenewed, ip, ""},
+		{LeaseReleased, ip, ""},
+		{LeaseAllocated, ip2, ""},
+		{LeaseExpired, ip2, ""},
+	}
+	var got []LeaseEvent
+	for ev := range events {
+		got = append(got, ev)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d events %v, want %d", len(got), got, len(want))
+	}
+	for i, w := range want {
+		if got[i].Kind != w.kind || !got[i].IP.Equal(w.ip) || got[i].HostName != w.host {
+			t.Errorf("event %d = %v %v %q, want %v %v %q", i, got[i].Kind, got[i].IP, got[i].HostName, w.kind, w.ip, w.host)
+		}
+	}
+}
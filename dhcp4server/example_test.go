@@ -0,0 +1,108 @@
+package dhcp4server_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+	"github.com/mergetb/dhcp4/dhcp4client"
+	"github.com/mergetb/dhcp4/dhcp4server"
+	"github.com/mergetb/dhcp4/dhcp4test"
+)
+
+// A Handler that only leases reserved addresses. The client and connections
+// of dhcp4test stand in for a real client; a real server would call
+// ListenAndServe. See examples/server for a complete program.
+func ExampleServeHandler() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	serverID := net.IP{192, 168, 0, 1}
+	reservations := map[string]net.IP{
+		"02:00:00:00:00:01": {192, 168, 0, 10},
+	}
+	h := dhcp4server.HandlerFunc(func(req *dhcp4.Packet, peer net.Addr) *dhcp4.Packet {
+		ip, ok := reservations[req.CHAddr.String()]
+		if !ok {
+			return nil
+		}
+		reply := dhcp4.NewPacket(dhcp4.BootReply)
+		switch req.Options.MessageType() {
+		case dhcp4.DHCPDiscover:
+			reply.Options.SetMessageType(dhcp4.DHCPOffer)
+		case dhcp4.DHCPRequest:
+			reply.Options.SetMessageType(dhcp4.DHCPACK)
+		default:
+			return nil
+		}
+		reply.YIAddr = ip
+		reply.Options.SetServerIdentifier(serverID)
+		reply.Options.SetLeaseTime(time.Hour)
+		return reply
+	})
+
+	clientConn, serverConn := dhcp4test.Pipe()
+	go dhcp4server.ServeHandler(ctx, serverConn, h)
+
+	c, err := dhcp4client.New(nil,
+		dhcp4client.WithConn(clientConn),
+		dhcp4client.WithIdentity(dhcp4client.Identity{HardwareAddr: net.HardwareAddr{2, 0, 0, 0, 0, 1}}),
+	)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer c.Close()
+
+	lease, err := c.RequestLease(ctx)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println("leased", lease.IP)
+	// Output: leased 192.168.0.10
+}
+
+// A Server embedded in another program: started and stopped with the
+// program, managed through its methods, and logging to the program's logger.
+func ExampleServer_Start() {
+	ctx := context.Background()
+
+	_, pool, _ := net.ParseCIDR("192.168.0.0/24")
+	s := dhcp4server.New(net.IP{192, 168, 0, 1}, pool, "", "",
+		dhcp4server.WithLogger(log.New(ioutil.Discard, "dhcp: ", 0)),
+	)
+	if err := s.Reserve(net.HardwareAddr{2, 0, 0, 0, 0, 1}, net.IP{192, 168, 0, 10}); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	clientConn, serverConn := dhcp4test.Pipe()
+	if err := s.Start(ctx, serverConn); err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer s.Stop()
+
+	c, err := dhcp4client.New(nil,
+		dhcp4client.WithConn(clientConn),
+		dhcp4client.WithIdentity(dhcp4client.Identity{HardwareAddr: net.HardwareAddr{2, 0, 0, 0, 0, 1}}),
+	)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer c.Close()
+
+	lease, err := c.RequestLease(ctx)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println("leased", lease.IP)
+	// Output: leased 192.168.0.10
+}
@@ -0,0 +1,52 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4server
+
+import (
+	"context"
+	"time"
+)
+
+// setLeaseEnd records that the binding of the client key, renewed at now
+// for leaseTime, expires then. Bindings renewed without a lease time do not
+// expire.
+//
+// s.mu must be held.
+func (s *Server) setLeaseEnd(key bindingKey, now time.Time, leaseTime time.Duration) {
+	if leaseTime <= 0 || leaseTime == infiniteLease {
+		delete(s.leaseEnds, key)
+		return
+	}
+	if s.leaseEnds == nil {
+		s.leaseEnds = make(map[bindingKey]time.Time)
+	}
+	s.leaseEnds[key] = now.Add(leaseTime)
+}
+
+// expireLeases releases the bindings whose lease time ran out, so that
+// clients requesting them again are NAKed and their addresses freed.
+// Bindings restored by persistent Leases after a restart have no recorded
+// lease end until they are renewed.
+//
+// s.mu must be held.
+func (s *Server) expireLeases(ctx context.Context, now time.Time) {
+	for key, end := range s.leaseEnds {
+		if !now.Before(end) {
+			s.release(ctx, key, LeaseExpired)
+		}
+	}
+}
+
+// leaseTimeLeft returns the time left on the lease of the client key at
+// now, or infiniteLease if it does not expire.
+//
+// s.mu must be held.
+func (s *Server) leaseTimeLeft(key bindingKey, now time.Time) time.Duration {
+	end, ok := s.leaseEnds[key]
+	if !ok {
+		return infiniteLease
+	}
+	return end.Sub(now)
+}
@@ -0,0 +1,123 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/mergetb/dhcp4"
+)
+
+// Decision is a decision made while handling a request.
+type Decision struct {
+	// Stage is the stage of handling the decision was made in, one of
+	// "classify", "key", "schedule", "allocate", "boot", "options" and
+	// "release".
+	Stage string
+
+	// Reason describes the decision.
+	Reason string
+}
+
+// String implements fmt.Stringer.
+func (d Decision) String() string {
+	return d.Stage + ": " + d.Reason
+}
+
+// Explanation is how the server would handle a request.
+type Explanation struct {
+	// Decisions are the decisions made, in order.
+	Decisions []Decision
+
+	// Response is the response the server would send, or nil if it would
+	// not respond.
+	Response *dhcp4.Packet
+}
+
+// String implements fmt.Stringer.
+func (e *Explanation) String() string {
+	s := make([]string, 0, len(e.Decisions))
+	for _, d := range e.Decisions {
+		s = append(s, d.String())
+	}
+	return strings.Join(s, "\n")
+}
+
+// Explain returns how the server would handle pkt received from peer, e.g.
+// to find out why a client got an address or boot file, without changing any
+// bindings.
+//
+// Callbacks such as the boot decider and lease scheduler are called as they
+// would be for a real request.
+func (s *Server) Explain(ctx context.Context, pkt *dhcp4.Packet, peer net.Addr) *Explanation {
+	ctx, cancel := s.requestContext(ctx, peer)
+	defer cancel()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d := &decisions{dryRun: true}
+	re, p := s.respond(ctx, d, peer, pkt)
+	for p != nil {
+		s.mu.Unlock()
+		p.run(ctx)
+		s.mu.Lock()
+		re, p = p.resume(ctx)
+	}
+	if re != nil {
+		// Resolve the options as writePacket does.
+		for code, v := range s.sharedOptions().Options() {
+			if _, ok := re.Options[code]; !ok {
+				re.Options[code] = v
+			}
+		}
+		codes := make([]int, 0, len(re.Options))
+		for code := range re.Options {
+			codes = append(codes, int(code))
+		}
+		sort.Ints(codes)
+		for _, code := range codes {
+			d.add("options", "option %d = %v", code, re.Options[dhcp4.OptionCode(code)])
+		}
+	}
+	return &Explanation{
+		Decisions: d.list,
+		Response:  re,
+	}
+}
+
+// decisions records the decisions made while handling a request.
+type decisions struct {
+	// logger logs notable decisions, if set.
+	logger *log.Logger
+
+	// dryRun means that no bindings must be changed and all decisions are
+	// recorded in list.
+	dryRun bool
+	list   []Decision
+}
+
+// add records a decision, if explaining.
+func (d *decisions) add(stage, format string, args ...interface{}) {
+	if d.dryRun {
+		d.list = append(d.list, Decision{
+			Stage:  stage,
+			Reason: fmt.Sprintf(format, args...),
+		})
+	}
+}
+
+// log records and logs a notable decision.
+func (d *decisions) log(stage, format string, args ...interface{}) {
+	d.add(stage, format, args...)
+	if d.logger != nil {
+		d.logger.Printf(format, args...)
+	}
+}
@@ -0,0 +1,108 @@
+package dhcp4server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mergetb/dhcp4"
+	"github.com/mergetb/dhcp4/dhcp4opts"
+)
+
+func TestExplain(t *testing.T) {
+	s := newTestServer(t, WithIPXE("undionly.kpxe", "http://boot/script.ipxe"))
+	mac := net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 1}
+
+	discover := newRequest(dhcp4opts.DHCPDiscover, mac)
+	discover.Options.AddRaw(dhcp4.OptionUserClass, []byte("iPXE"))
+	e := s.Explain(context.Background(), discover, testPeer)
+	if e.Response == nil || e.Response.Options.MessageType() != dhcp4.DHCPOffer {
+		t.Fatalf("Explain() response = %v, want an offer", e.Response)
+	}
+	if sid := e.Response.Options.ServerIdentifier(); !sid.Equal(s.ip) {
+		t.Errorf("Explain() response server identifier = %v, want %v", sid, s.ip)
+	}
+
+	var stages []string
+	for _, d := range e.Decisions {
+		stages = append(stages, d.Stage)
+	}
+	for _, want := range []string{"classify", "key", "allocate", "boot", "options"} {
+		var found bool
+		for _, stage := range stages {
+			found = found || stage == want
+		}
+		if !found {
+			t.Errorf("Explain() decisions %v lack stage %q", e, want)
+		}
+	}
+	if !strings.Contains(e.String(), `boot file "http://boot/script.ipxe"`) {
+		t.Errorf("Explain() = %q, want the iPXE script explained", e)
+	}
+
+	// Explaining does not bind.
+	if got := len(s.Leases(HistoryQuery{})); got != 0 {
+		t.Errorf("Explain() created %d bindings, want none", got)
+	}
+	offer := exchange(t, s, discover)
+	if !offer.YIAddr.Equal(e.Response.YIAddr) {
+		t.Errorf("server offered %v, but explained %v", offer.YIAddr, e.Response.YIAddr)
+	}
+
+	// Once bound, the same address is explained.
+	e = s.Explain(context.Background(), newRequest(dhcp4opts.DHCPDiscover, mac), testPeer)
+	if e.Response == nil || !e.Response.YIAddr.Equal(offer.YIAddr) || !strings.Contains(e.String(), "already bound") {
+		t.Errorf("Explain() = %v, want %v already bound", e, offer.YIAddr)
+	}
+
+	// Releases are explained, but not applied.
+	e = s.Explain(context.Background(), newRelease(s, mac, offer.YIAddr), testPeer)
+	if e.Response != nil || !strings.Contains(e.String(), "release") {
+		t.Errorf("Explain(release) = %v", e)
+	}
+	if leases := s.Leases(HistoryQuery{}); len(leases) != 1 || !leases[0].Active() {
+		t.Errorf("explaining a release left leases %v, want one active", leases)
+	}
+}
+
+func TestAdminExplain(t *testing.T) {
+	s := newTestServer(t)
+	b, err := newRequest(dhcp4opts.DHCPDiscover, net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 1}).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		path       string
+		body       []byte
+		wantStatus int
+	}{
+		{path: "/explain", body: b, wantStatus: http.StatusOK},
+		{path: "/explain?peer=192.168.1.10:68", body: b, wantStatus: http.StatusOK},
+		{path: "/explain?peer=nowhere", body: b, wantStatus: http.StatusBadRequest},
+		{path: "/explain", body: []byte("garbage"), wantStatus: http.StatusBadRequest},
+	} {
+		rec := httptest.NewRecorder()
+		s.AdminHandler().ServeHTTP(rec, httptest.NewRequest("POST", tt.path, bytes.NewReader(tt.body)))
+		if rec.Code != tt.wantStatus {
+			t.Errorf("POST %s = %d, want %d", tt.path, rec.Code, tt.wantStatus)
+			continue
+		}
+		if rec.Code != http.StatusOK {
+			continue
+		}
+
+		var e explanationJSON
+		if err := json.Unmarshal(rec.Body.Bytes(), &e); err != nil {
+			t.Fatalf("POST %s returned invalid JSON: %v", tt.path, err)
+		}
+		if e.Response == nil || e.Response.MessageType != "DHCPOFFER" || len(e.Decisions) == 0 {
+			t.Errorf("POST %s = %+v, want an explained offer", tt.path, e)
+		}
+	}
+}
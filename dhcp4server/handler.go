@@ -0,0 +1,177 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+)
+
+const (
+	// serverPort and clientPort are the UDP ports of DHCP servers (and
+	// relay agents) and clients.
+	serverPort = 67
+	clientPort = 68
+)
+
+// Handler answers DHCP requests, for servers whose policy does not fit
+// Server.
+type Handler interface {
+	// ServeDHCP returns the response to req received from peer, or nil
+	// to not respond.
+	//
+	// The response's BOOTP header fields that must match the request are
+	// filled in by the caller, see ServeHandler.
+	ServeDHCP(req *dhcp4.Packet, peer net.Addr) *dhcp4.Packet
+}
+
+// HandlerFunc is a function implementing Handler.
+type HandlerFunc func(req *dhcp4.Packet, peer net.Addr) *dhcp4.Packet
+
+// ServeDHCP implements Handler.
+func (f HandlerFunc) ServeDHCP(req *dhcp4.Packet, peer net.Addr) *dhcp4.Packet {
+	return f(req, peer)
+}
+
+// ListenAndServe listens on UDP address addr, ":67" if empty, and serves
+// requests with h until ctx is canceled or reading fails.
+func ListenAndServe(ctx context.Context, addr string, h Handler) error {
+	if addr == "" {
+		addr = fmt.Sprintf(":%d", serverPort)
+	}
+	conn, err := net.ListenPacket("udp4", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return ServeHandler(ctx, conn, h)
+}
+
+// ServeHandler reads requests from conn and answers them with h until ctx is
+// canceled or reading fails. Each request is handled in its own goroutine;
+// packets that are not BOOTP requests are ignored.
+//
+// Responses are turned into proper replies to their request: their op code,
+// transaction ID, hardware address, flags and relay agent address are copied
+// from the request, as are the relay agent information option of relayed
+// requests (RFC 3046) and the client identifier (RFC 6842). They are sent as
+// RFC 2131 Section 4.1 requires: through the relay agent if the request was
+// relayed, by unicast to clients that have an address (ciaddr), and by
+// broadcast otherwise. Responses larger than the client's Maximum DHCP
+// Message Size are overloaded, or dropped if they still do not fit.
+func ServeHandler(ctx context.Context, conn net.PacketConn, h Handler) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		// Unblock ReadFrom.
+		<-ctx.Done()
+		conn.SetReadDeadline(time.Now())
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	var buf [maxMessageSize]byte
+	for {
+		n, peer, err := conn.ReadFrom(buf[:])
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			return err
+		}
+
+		req, err := dhcp4.ParsePacket(buf[:n])
+		if err != nil || req.Op != dhcp4.BootRequest {
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reply := h.ServeDHCP(req, peer)
+			if reply == nil {
+				return
+			}
+			prepareReply(req, reply)
+			echoPolicy{}.echoOptions(req, reply)
+			dest, err := replyAddr(reply, peer)
+			if err != nil {
+				return
+			}
+			b, err := dhcp4.MarshalOptions{MaxSize: dhcp4.MaxReplySize(req)}.Marshal(reply)
+			if err != nil {
+				return
+			}
+			conn.WriteTo(b, dest)
+		}()
+	}
+}
+
+// prepareReply copies the fields of req that reply must repeat, as listed by
+// RFC 2131 Section 4.3.1, Table 3.
+func prepareReply(req, reply *dhcp4.Packet) {
+	reply.Op = dhcp4.BootReply
+	reply.HType = req.HType
+	reply.Hops = 0
+	reply.TransactionID = req.TransactionID
+	reply.CHAddr = req.CHAddr
+	reply.GIAddr = req.GIAddr
+	reply.Broadcast = req.Broadcast
+	if reply.Options.MessageType() == dhcp4.DHCPNAK && !unspecified(req.GIAddr) {
+		// The relay agent must broadcast NAKs, RFC 2131 Section 4.3.2.
+		reply.Broadcast = true
+	}
+}
+
+// replyAddr returns where to send reply to a request from peer, following
+// RFC 2131 Section 4.1.
+//
+// Replies to clients without an address that did not ask for broadcast
+// should be unicast to the hardware address and yiaddr. That needs the ARP
+// cache or a raw socket, so they are sent to the request's source address if
+// it is one, and broadcast otherwise.
+func replyAddr(reply *dhcp4.Packet, peer net.Addr) (*net.UDPAddr, error) {
+	bcast := &net.UDPAddr{IP: net.IPv4bcast, Port: clientPort}
+	switch {
+	case !unspecified(reply.GIAddr):
+		return &net.UDPAddr{IP: reply.GIAddr, Port: serverPort}, nil
+	case reply.Options.MessageType() == dhcp4.DHCPNAK:
+		return bcast, nil
+	case isLeaseQueryReply(reply):
+		// ciaddr is the address queried, not that of the requester.
+		break
+	case !unspecified(reply.CIAddr):
+		return &net.UDPAddr{IP: reply.CIAddr, Port: clientPort}, nil
+	case reply.Broadcast:
+		return bcast, nil
+	}
+
+	uaddr, ok := peer.(*net.UDPAddr)
+	if !ok {
+		return nil, fmt.Errorf("DHCP send: addr %v is not a UDP address", peer)
+	}
+	if unspecified(uaddr.IP) {
+		return bcast, nil
+	}
+	return uaddr, nil
+}
+
+func isLeaseQueryReply(p *dhcp4.Packet) bool {
+	switch p.Options.MessageType() {
+	case dhcp4.DHCPLeaseUnassigned, dhcp4.DHCPLeaseUnknown, dhcp4.DHCPLeaseActive:
+		return true
+	}
+	return false
+}
+
+func unspecified(ip net.IP) bool {
+	return ip == nil || ip.IsUnspecified()
+}
@@ -0,0 +1,163 @@
+package dhcp4server
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+)
+
+func TestReplyAddr(t *testing.T) {
+	relay := net.IP{10, 0, 0, 1}
+	client := net.IP{10, 0, 1, 10}
+	peer := &net.UDPAddr{IP: client, Port: clientPort}
+	bcast := &net.UDPAddr{IP: net.IPv4bcast, Port: clientPort}
+
+	reply := func(typ dhcp4.MessageType, giaddr, ciaddr net.IP, broadcast bool) *dhcp4.Packet {
+		p := dhcp4.NewPacket(dhcp4.BootReply)
+		p.Options.SetMessageType(typ)
+		p.GIAddr = giaddr
+		p.CIAddr = ciaddr
+		p.Broadcast = broadcast
+		return p
+	}
+	for _, tt := range []struct {
+		desc  string
+		reply *dhcp4.Packet
+		peer  net.Addr
+		want  *net.UDPAddr
+	}{
+		{
+			desc:  "relayed",
+			reply: reply(dhcp4.DHCPACK, relay, client, false),
+			peer:  &net.UDPAddr{IP: relay, Port: serverPort},
+			want:  &net.UDPAddr{IP: relay, Port: serverPort},
+		},
+		{
+			desc:  "relayed NAK",
+			reply: reply(dhcp4.DHCPNAK, relay, nil, false),
+			peer:  &net.UDPAddr{IP: relay, Port: serverPort},
+			want:  &net.UDPAddr{IP: relay, Port: serverPort},
+		},
+		{
+			desc:  "NAK",
+			reply: reply(dhcp4.DHCPNAK, nil, client, false),
+			peer:  peer,
+			want:  bcast,
+		},
+		{
+			desc:  "renewal",
+			reply: reply(dhcp4.DHCPACK, net.IPv4zero, client, true),
+			peer:  peer,
+			want:  &net.UDPAddr{IP: client, Port: clientPort},
+		},
+		{
+			desc:  "broadcast flag",
+			reply: reply(dhcp4.DHCPOffer, nil, nil, true),
+			peer:  testPeer,
+			want:  bcast,
+		},
+		{
+			desc:  "no address",
+			reply: reply(dhcp4.DHCPOffer, nil, nil, false),
+			peer:  testPeer,
+			want:  bcast,
+		},
+		{
+			desc:  "source address",
+			reply: reply(dhcp4.DHCPOffer, nil, nil, false),
+			peer:  peer,
+			want:  peer,
+		},
+	} {
+		got, err := replyAddr(tt.reply, tt.peer)
+		if err != nil || got.String() != tt.want.String() {
+			t.Errorf("%s: replyAddr() = %v, %v, want %v", tt.desc, got, err, tt.want)
+		}
+	}
+}
+
+// sentPacket is a packet written to a replyConn.
+type sentPacket struct {
+	p    *dhcp4.Packet
+	dest net.Addr
+}
+
+// replyConn is a chanConn that sends written packets to a channel.
+type replyConn struct {
+	chanConn
+	out chan sentPacket
+}
+
+func (rc *replyConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	p, err := dhcp4.ParsePacket(b)
+	if err != nil {
+		return 0, err
+	}
+	rc.out <- sentPacket{p: p, dest: addr}
+	return len(b), nil
+}
+
+func TestServeHandler(t *testing.T) {
+	conn := &replyConn{
+		chanConn: chanConn{
+			in:       make(chan packet),
+			deadline: make(chan struct{}),
+		},
+		out: make(chan sentPacket, 1),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- ServeHandler(ctx, conn, HandlerFunc(func(req *dhcp4.Packet, peer net.Addr) *dhcp4.Packet {
+			if req.Options.MessageType() != dhcp4.DHCPDiscover {
+				return nil
+			}
+			offer := dhcp4.NewPacket(dhcp4.BootReply)
+			offer.YIAddr = net.IP{10, 0, 1, 10}
+			offer.Options.SetMessageType(dhcp4.DHCPOffer)
+			return offer
+		}))
+	}()
+
+	relay := &net.UDPAddr{IP: net.IP{10, 0, 0, 1}, Port: serverPort}
+	send := func(typ dhcp4.MessageType) {
+		req := newRequest(typ, net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 1})
+		req.GIAddr = relay.IP
+		req.Hops = 1
+		b, err := req.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.in <- packet{b: b, addr: relay}
+	}
+
+	send(dhcp4.DHCPRequest)
+	send(dhcp4.DHCPDiscover)
+	var sent sentPacket
+	select {
+	case sent = <-conn.out:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no reply sent")
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("ServeHandler() = %v, want %v", err, context.Canceled)
+	}
+	select {
+	case extra := <-conn.out:
+		t.Errorf("unexpected reply %v", extra.p)
+	default:
+	}
+
+	if sent.dest.String() != relay.String() {
+		t.Errorf("reply sent to %v, want relay %v", sent.dest, relay)
+	}
+	offer := sent.p
+	if offer.Op != dhcp4.BootReply || offer.TransactionID != [4]byte{1, 2, 3, 4} || offer.Hops != 0 ||
+		!offer.GIAddr.Equal(relay.IP) || offer.HardwareAddr().String() != "00:00:5e:00:53:01" {
+		t.Errorf("reply %v does not match request", offer)
+	}
+}
@@ -0,0 +1,414 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// LeaseRecord is a binding of an IP address to a client for a period of time.
+type LeaseRecord struct {
+	// IP is the address that was bound.
+	IP net.IP
+
+	// HardwareAddr is the client hardware address of the client.
+	HardwareAddr net.HardwareAddr
+
+	// Start is when the address was bound to the client.
+	Start time.Time
+
+	// End is when the binding ended. It is the zero time for bindings
+	// that are still active.
+	End time.Time
+
+	// key is the key of the client under the server's KeyPolicy, if
+	// known.
+	key string
+}
+
+// Active returns true if the binding has not ended yet.
+func (r LeaseRecord) Active() bool {
+	return r.End.IsZero()
+}
+
+// covers returns true if the binding was in place at any time in [from, to].
+//
+// A zero from or to leaves that end of the range open.
+func (r LeaseRecord) covers(from, to time.Time) bool {
+	if !to.IsZero() && r.Start.After(to) {
+		return false
+	}
+	if !from.IsZero() && !r.Active() && r.End.Before(from) {
+		return false
+	}
+	return true
+}
+
+// HistoryQuery selects lease records.
+//
+// Zero-valued fields match all records.
+type HistoryQuery struct {
+	// IP selects bindings of this address.
+	IP net.IP
+
+	// HardwareAddr selects bindings to this client hardware address.
+	HardwareAddr net.HardwareAddr
+
+	// From and To select bindings that were in place at any time in the
+	// range [From, To]. To answer "who had this IP at 14:00", set both to
+	// 14:00.
+	From, To time.Time
+}
+
+// Match returns true if r is selected by q.
+func (q HistoryQuery) Match(r LeaseRecord) bool {
+	if q.IP != nil && !q.IP.Equal(r.IP) {
+		return false
+	}
+	if q.HardwareAddr != nil && !bytes.Equal(q.HardwareAddr, r.HardwareAddr) {
+		return false
+	}
+	return r.covers(q.From, q.To)
+}
+
+// History retains ended leases for a configurable retention window.
+//
+// A History returned by OpenFileHistory also appends ended leases to a
+// file, so that they survive restarts. Compaction rewrites the file without
+// the leases it drops.
+//
+// History is safe for concurrent use.
+type History struct {
+	mu        sync.Mutex
+	retention time.Duration
+
+	// records is sorted by End.
+	records []LeaseRecord
+
+	// last is the record of records that ended last for each client key.
+	last map[string]LeaseRecord
+
+	// file is the file ended leases are appended to, if any, opened at
+	// path.
+	file *os.File
+	path string
+
+	// aead encrypts the records in file if set.
+	aead cipher.AEAD
+}
+
+// recordJSON is the file representation of a LeaseRecord.
+type recordJSON struct {
+	// Key is binary, which JSON strings cannot hold.
+	Key          []byte    `json:"key,omitempty"`
+	IP           string    `json:"ip"`
+	HardwareAddr string    `json:"hardware_addr"`
+	Start        time.Time `json:"start"`
+	End          time.Time `json:"end"`
+}
+
+// NewHistory returns a History that keeps ended leases for retention.
+//
+// A retention of 0 keeps ended leases forever.
+func NewHistory(retention time.Duration) *History {
+	return &History{
+		retention: retention,
+		last:      make(map[string]LeaseRecord),
+	}
+}
+
+// OpenFileHistory returns a History that keeps ended leases for retention
+// and appends them to the file at path, starting with the leases saved
+// there if the file exists.
+//
+// If key is not nil, the records written are encrypted with AES-GCM under
+// the key it returns, like the lease file of WithEncryption. Unencrypted
+// records are read and encrypted by the next compaction.
+func OpenFileHistory(path string, retention time.Duration, key KeyFunc) (*History, error) {
+	h := NewHistory(retention)
+	h.path = path
+	if key != nil {
+		k, err := key()
+		if err != nil {
+			return nil, fmt.Errorf("history file %s: %v", path, err)
+		}
+		if h.aead, err = newAEAD(k); err != nil {
+			return nil, fmt.Errorf("history file %s: %v", path, err)
+		}
+	}
+	if err := h.load(); err != nil {
+		return nil, fmt.Errorf("history file %s: %v", path, err)
+	}
+	// Rewrite the file, which drops the leases out of the retention
+	// window and a last record cut short by a crash.
+	if _, err := h.Compact(time.Now()); err != nil {
+		return nil, err
+	}
+	if h.file == nil {
+		if err := h.rewrite(); err != nil {
+			return nil, err
+		}
+	}
+	return h, nil
+}
+
+// load reads the records of the file.
+func (h *History) load() error {
+	b, err := ioutil.ReadFile(h.path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	lines := bytes.Split(b, []byte("\n"))
+	for i, line := range lines {
+		if len(line) == 0 {
+			continue
+		}
+		r, err := h.unmarshalRecord(line)
+		if err != nil && i == len(lines)-1 {
+			// The last record was cut short by a crash while it was
+			// appended.
+			break
+		} else if err != nil {
+			return fmt.Errorf("line %d: %v", i+1, err)
+		}
+		h.records = append(h.records, r)
+	}
+	sort.SliceStable(h.records, func(i, j int) bool {
+		return h.records[i].End.Before(h.records[j].End)
+	})
+	for _, r := range h.records {
+		h.remember(r)
+	}
+	return nil
+}
+
+// marshalRecord returns the line of r in the file.
+func (h *History) marshalRecord(r LeaseRecord) ([]byte, error) {
+	b, err := json.Marshal(recordJSON{
+		Key:          []byte(r.key),
+		IP:           r.IP.String(),
+		HardwareAddr: r.HardwareAddr.String(),
+		Start:        r.Start,
+		End:          r.End,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if h.aead != nil {
+		sealed, err := seal(h.aead, b)
+		if err != nil {
+			return nil, err
+		}
+		b = []byte(base64.StdEncoding.EncodeToString(sealed))
+	}
+	return append(b, '\n'), nil
+}
+
+// unmarshalRecord parses a line of the file.
+func (h *History) unmarshalRecord(line []byte) (LeaseRecord, error) {
+	if !bytes.HasPrefix(line, []byte("{")) {
+		sealed, err := base64.StdEncoding.DecodeString(string(line))
+		if err != nil || !isEncrypted(sealed) {
+			return LeaseRecord{}, fmt.Errorf("invalid record")
+		}
+		if h.aead == nil {
+			return LeaseRecord{}, fmt.Errorf("record is encrypted, but no key is configured")
+		}
+		if line, err = unseal(h.aead, sealed); err != nil {
+			return LeaseRecord{}, err
+		}
+	}
+	var rj recordJSON
+	if err := json.Unmarshal(line, &rj); err != nil {
+		return LeaseRecord{}, err
+	}
+	ip := net.ParseIP(rj.IP).To4()
+	haddr, err := parseHardwareAddr(rj.HardwareAddr)
+	if ip == nil || err != nil {
+		return LeaseRecord{}, fmt.Errorf("invalid record of %q and %q", rj.HardwareAddr, rj.IP)
+	}
+	return LeaseRecord{IP: ip, HardwareAddr: haddr, Start: rj.Start, End: rj.End, key: string(rj.Key)}, nil
+}
+
+// rewrite replaces the file with one holding the retained records,
+// atomically, and appends to the new file from then on. h.mu must be held.
+func (h *History) rewrite() error {
+	f, err := ioutil.TempFile(filepath.Dir(h.path), filepath.Base(h.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, r := range h.records {
+		line, err := h.marshalRecord(r)
+		if err == nil {
+			_, err = w.Write(line)
+		}
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), h.path); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	// The temporary file is now the file at path, and its offset is at
+	// the end.
+	if h.file != nil {
+		h.file.Close()
+	}
+	h.file = f
+	return nil
+}
+
+// remember updates last with r. h.mu must be held.
+func (h *History) remember(r LeaseRecord) {
+	if r.key == "" {
+		return
+	}
+	if l, ok := h.last[r.key]; !ok || !r.End.Before(l.End) {
+		h.last[r.key] = r
+	}
+}
+
+// previous returns the address of the lease of the client key that ended
+// last, or nil.
+func (h *History) previous(key string) net.IP {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.last[key].IP
+}
+
+// Add records an ended lease. If h has a file, Add appends the lease to it
+// and returns an error if it cannot; the lease is retained either way.
+func (h *History) Add(r LeaseRecord) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	i := sort.Search(len(h.records), func(i int) bool {
+		return h.records[i].End.After(r.End)
+	})
+	h.records = append(h.records, LeaseRecord{})
+	copy(h.records[i+1:], h.records[i:])
+	h.records[i] = r
+	h.remember(r)
+
+	if h.file == nil {
+		return nil
+	}
+	line, err := h.marshalRecord(r)
+	if err != nil {
+		return err
+	}
+	_, err = h.file.Write(line)
+	return err
+}
+
+// Query returns all retained leases matching q, ordered by end time.
+func (h *History) Query(q HistoryQuery) []LeaseRecord {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var rs []LeaseRecord
+	for _, r := range h.records {
+		if q.Match(r) {
+			rs = append(rs, r)
+		}
+	}
+	return rs
+}
+
+// Len returns the number of retained leases.
+func (h *History) Len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.records)
+}
+
+// Compact drops leases that ended longer than the retention window before
+// now, and rewrites the file of h without them. It returns the number of
+// leases dropped.
+func (h *History) Compact(now time.Time) (int, error) {
+	if h.retention <= 0 {
+		return 0, nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	cutoff := now.Add(-h.retention)
+	n := sort.Search(len(h.records), func(i int) bool {
+		return !h.records[i].End.Before(cutoff)
+	})
+	if n == 0 {
+		return 0, nil
+	}
+	for _, r := range h.records[:n] {
+		if l, ok := h.last[r.key]; ok && l.End.Before(cutoff) {
+			delete(h.last, r.key)
+		}
+	}
+	// Copy so that the dropped records can be garbage collected.
+	h.records = append([]LeaseRecord(nil), h.records[n:]...)
+	if h.path == "" {
+		return n, nil
+	}
+	return n, h.rewrite()
+}
+
+// RunCompaction calls Compact every interval until ctx is canceled, and
+// logs the compactions that fail to logger.
+func (h *History) RunCompaction(ctx context.Context, logger *log.Logger, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			if _, err := h.Compact(now); err != nil {
+				logger.Printf("Could not compact lease history: %v", err)
+			}
+		}
+	}
+}
+
+// Close closes the file of h, if any.
+func (h *History) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.file == nil {
+		return nil
+	}
+	err := h.file.Close()
+	h.file = nil
+	return err
+}
@@ -0,0 +1,183 @@
+package dhcp4server
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHistory(t *testing.T) {
+	base := time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC)
+	at := func(hour int) time.Time {
+		return base.Add(time.Duration(hour) * time.Hour)
+	}
+	ip := net.IP{192, 168, 1, 5}
+	macA := net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 1}
+	macB := net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 2}
+
+	h := NewHistory(24 * time.Hour)
+	h.Add(LeaseRecord{IP: ip, HardwareAddr: macB, Start: at(3), End: at(5)})
+	h.Add(LeaseRecord{IP: ip, HardwareAddr: macA, Start: at(0), End: at(2)})
+	h.Add(LeaseRecord{IP: net.IP{192, 168, 1, 6}, HardwareAddr: macA, Start: at(2), End: at(30)})
+
+	for _, tt := range []struct {
+		desc string
+		q    HistoryQuery
+		want []net.HardwareAddr
+	}{
+		{
+			desc: "who had the IP at 13:00",
+			q:    HistoryQuery{IP: ip, From: at(1), To: at(1)},
+			want: []net.HardwareAddr{macA},
+		},
+		{
+			desc: "who had the IP at 16:00",
+			q:    HistoryQuery{IP: ip, From: at(4), To: at(4)},
+			want: []net.HardwareAddr{macB},
+		},
+		{
+			desc: "who had the IP ever",
+			q:    HistoryQuery{IP: ip},
+			want: []net.HardwareAddr{macA, macB},
+		},
+		{
+			desc: "nobody at 14:30",
+			q:    HistoryQuery{IP: ip, From: at(2).Add(30 * time.Minute), To: at(2).Add(30 * time.Minute)},
+		},
+		{
+			desc: "leases of a client",
+			q:    HistoryQuery{HardwareAddr: macA},
+			want: []net.HardwareAddr{macA, macA},
+		},
+	} {
+		got := h.Query(tt.q)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %d records, want %d", tt.desc, len(got), len(tt.want))
+			continue
+		}
+		for i := range got {
+			if got[i].HardwareAddr.String() != tt.want[i].String() {
+				t.Errorf("%s: record %d is for %v, want %v", tt.desc, i, got[i].HardwareAddr, tt.want[i])
+			}
+		}
+	}
+
+	if n, err := h.Compact(at(30)); err != nil || n != 2 {
+		t.Errorf("Compact() = %d, %v, want 2 records dropped", n, err)
+	}
+	if n := h.Len(); n != 1 {
+		t.Errorf("Len() = %d after compaction, want 1", n)
+	}
+}
+
+func TestFileHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "history")
+	now := time.Now().Truncate(time.Second)
+	mac := net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 1}
+	record := func(ip byte, ended time.Duration) LeaseRecord {
+		return LeaseRecord{IP: net.IP{192, 168, 1, ip}, HardwareAddr: mac, Start: now.Add(-ended - time.Hour), End: now.Add(-ended)}
+	}
+
+	h, err := OpenFileHistory(path, 24*time.Hour, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range []LeaseRecord{record(5, 48*time.Hour), record(6, time.Hour), record(7, 2*time.Hour)} {
+		if err := h.Add(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h.Close()
+
+	// Cut the last record short, as a crash while appending it would.
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, b[:len(b)-10], 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reopening drops the expired and the torn record, and encrypts the
+	// others.
+	key := staticKey(bytes.Repeat([]byte{7}, 32))
+	h, err = OpenFileHistory(path, 24*time.Hour, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := h.Query(HistoryQuery{HardwareAddr: mac}); len(got) != 1 || !got[0].IP.Equal(net.IP{192, 168, 1, 6}) || !got[0].End.Equal(now.Add(-time.Hour)) {
+		t.Errorf("Query() after reopening = %v, want the lease of 192.168.1.6", got)
+	}
+	if err := h.Add(record(8, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := h.Compact(now.Add(24*time.Hour - time.Minute)); err != nil || n != 1 {
+		t.Errorf("Compact() = %d, %v, want 1 record dropped", n, err)
+	}
+	h.Close()
+
+	if b, err := ioutil.ReadFile(path); err != nil {
+		t.Fatal(err)
+	} else if bytes.Contains(b, []byte("192.168.1")) {
+		t.Errorf("history file is not encrypted: %q", b)
+	}
+	if _, err := OpenFileHistory(path, 24*time.Hour, nil); err == nil {
+		t.Errorf("OpenFileHistory() of an encrypted file without a key succeeded")
+	}
+	h, err = OpenFileHistory(path, 0, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	if got := h.Query(HistoryQuery{HardwareAddr: mac}); len(got) != 1 || !got[0].IP.Equal(net.IP{192, 168, 1, 8}) {
+		t.Errorf("Query() after compaction = %v, want the lease of 192.168.1.8", got)
+	}
+}
+
+func TestFileHistoryHardwareAddrs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "history")
+	end := time.Now().Truncate(time.Second)
+
+	// Clients keyed by client identifier may send no hardware address, or
+	// one of any length.
+	haddrs := []net.HardwareAddr{nil, {1, 2, 3, 4}, {0, 0, 0x5e, 0, 0x53, 1}}
+	h, err := OpenFileHistory(path, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, haddr := range haddrs {
+		if err := h.Add(LeaseRecord{IP: net.IP{10, 0, 0, byte(5 + i)}, HardwareAddr: haddr, Start: end.Add(-time.Hour), End: end, key: "id:" + string(rune('a'+i))}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h.Close()
+
+	h, err = OpenFileHistory(path, 0, nil)
+	if err != nil {
+		t.Fatalf("OpenFileHistory() after restart = %v", err)
+	}
+	defer h.Close()
+	for i, haddr := range haddrs {
+		got := h.Query(HistoryQuery{IP: net.IP{10, 0, 0, byte(5 + i)}})
+		if len(got) != 1 || !bytes.Equal(got[0].HardwareAddr, haddr) || (haddr == nil) != (got[0].HardwareAddr == nil) {
+			t.Errorf("Query() of the lease of %v after restart = %v", haddr, got)
+		}
+		if key, ip := "id:"+string(rune('a'+i)), (net.IP{10, 0, 0, byte(5 + i)}); !h.previous(key).Equal(ip) {
+			t.Errorf("previous(%q) after restart = %v, want %v", key, h.previous(key), ip)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4server
+
+import (
+	"net"
+
+	"github.com/mergetb/dhcp4"
+)
+
+// Host is configuration overriding the server's for one client.
+type Host struct {
+	HardwareAddr net.HardwareAddr
+
+	// Boot overrides the boot parameters decided for the client: its
+	// non-empty fields replace those of the boot decider.
+	Boot BootParams
+
+	// Options are sent to the client, replacing options with the same
+	// codes of its class and of WithOptions.
+	Options dhcp4.Options
+}
+
+// WithHosts configures per-client overrides, e.g. from an inventory of
+// machines. Later hosts with the same hardware address replace earlier
+// ones.
+func WithHosts(hs ...Host) ServerOpt {
+	return func(s *Server) {
+		if s.hosts == nil {
+			s.hosts = make(map[string]Host)
+		}
+		for _, h := range hs {
+			s.hosts[h.HardwareAddr.String()] = h
+		}
+	}
+}
+
+// ClientClass is a set of clients served a boot file and options of their
+// own.
+type ClientClass struct {
+	Name string
+
+	// Match returns whether a client is in the class.
+	Match func(Classification) bool
+
+	// BootFile, if not empty, replaces the boot file decided for clients
+	// in the class.
+	BootFile string
+
+	// Options are sent to clients in the class, replacing options with
+	// the same codes of WithOptions.
+	Options dhcp4.Options
+}
+
+// WithClasses configures client classes. A client is in the first class
+// matching it, if any.
+func WithClasses(cs ...ClientClass) ServerOpt {
+	return func(s *Server) {
+		s.classes = append(s.classes, cs...)
+	}
+}
+
+// WithOptions configures options sent to all clients in offers and
+// acknowledgements, e.g. the subnet mask, routers and DNS servers. Options
+// the server sets itself, such as the lease time, are not replaced.
+func WithOptions(o dhcp4.Options) ServerOpt {
+	return func(s *Server) {
+		s.defaultOptions = o
+	}
+}
+
+// WithAddressRange restricts the addresses allocated to clients to those
+// from first to last. Reserved addresses are still allocated to their
+// clients if they are outside the range.
+//
+// Default is the whole subnet.
+func WithAddressRange(first, last net.IP) ServerOpt {
+	return func(s *Server) {
+		s.rangeFirst, s.rangeLast = beUint32(first), beUint32(last)
+		s.ranged = true
+	}
+}
+
+// inRange returns whether ip is in the range of WithAddressRange.
+func (s *Server) inRange(ip net.IP) bool {
+	if !s.ranged {
+		return true
+	}
+	n := beUint32(ip)
+	return s.rangeFirst <= n && n <= s.rangeLast
+}
+
+// clientClass returns the class of the client of req, or nil if it is in
+// none.
+func (s *Server) clientClass(req Classification) *ClientClass {
+	for i := range s.classes {
+		if s.classes[i].Match(req) {
+			return &s.classes[i]
+		}
+	}
+	return nil
+}
+
+// overrideBoot applies the boot parameters of the class and host of the
+// client of req to bp.
+func (s *Server) overrideBoot(bp *BootParams, req Classification) {
+	if cl := s.clientClass(req); cl != nil && cl.BootFile != "" {
+		bp.BootFile = cl.BootFile
+	}
+	h, ok := s.hosts[req.HardwareAddr.String()]
+	if !ok {
+		return
+	}
+	if h.Boot.ServerName != "" {
+		bp.ServerName = h.Boot.ServerName
+	}
+	if h.Boot.BootFile != "" {
+		bp.BootFile = h.Boot.BootFile
+	}
+	if h.Boot.NextServer != nil {
+		bp.NextServer = h.Boot.NextServer
+	}
+}
+
+// setOptions adds the configured options for the client of req on sub to
+// response: those of its host, then of its class, then of its subnet, then
+// of WithOptions.
+func (s *Server) setOptions(d *decisions, response *dhcp4.Packet, req Classification, sub *Subnet) {
+	add := func(source string, o dhcp4.Options) {
+		var n int
+		for code, v := range o {
+			if _, ok := response.Options[code]; !ok {
+				response.Options[code] = v
+				n++
+			}
+		}
+		if n > 0 {
+			d.add("options", "%d options from %s", n, source)
+		}
+	}
+	if h, ok := s.hosts[req.HardwareAddr.String()]; ok {
+		add("host "+req.HardwareAddr.String(), h.Options)
+	}
+	if cl := s.clientClass(req); cl != nil {
+		add("class "+cl.Name, cl.Options)
+	}
+	setSubnetOptions(d, response, sub)
+	add("server", s.defaultOptions)
+}
@@ -19,6 +19,28 @@ func nextIP(ip net.IP) {
 	}
 }
 
+// hostAddr returns whether ip of subnet may be bound to a host: whether it
+// is neither the network nor the broadcast address of subnet. Point-to-point
+// subnets of two addresses or less have neither (RFC 3021).
+func hostAddr(subnet *net.IPNet, ip net.IP) bool {
+	ones, bits := subnet.Mask.Size()
+	if bits-ones < 2 {
+		return true
+	}
+	ip4 := ip.To4()
+	if ip4 == nil {
+		return true
+	}
+	mask := subnet.Mask[len(subnet.Mask)-net.IPv4len:]
+	var network, broadcast = true, true
+	for i := range ip4 {
+		host := ip4[i] &^ mask[i]
+		network = network && host == 0
+		broadcast = broadcast && host == ^mask[i]
+	}
+	return !network && !broadcast
+}
+
 type ipAllocator struct {
 	// subnet is the range of IP addresses that can be allocated by this
 	// DHCP server.
@@ -27,6 +49,10 @@ type ipAllocator struct {
 	// allocated is the set of IP addresses currently allocated to a
 	// client.
 	allocated map[uint32]struct{}
+
+	// exclude, if set, returns whether an address must not be allocated
+	// although it is free.
+	exclude func(net.IP) bool
 }
 
 func newIPAllocator(subnet *net.IPNet) *ipAllocator {
@@ -46,13 +72,46 @@ func (ia *ipAllocator) usable(ip net.IP) bool {
 }
 
 func (ia *ipAllocator) grab(ip net.IP) bool {
-	if !ia.subnet.Contains(ip) || !ia.usable(ip) {
+	if !ia.available(ip) {
 		return false
 	}
 	ia.allocated[ipToUint32(ip)] = struct{}{}
 	return true
 }
 
+// reserve marks ip as allocated even if it is outside the subnet, e.g.
+// because it was bound before the subnet shrank.
+func (ia *ipAllocator) reserve(ip net.IP) bool {
+	if !ia.usable(ip) {
+		return false
+	}
+	ia.allocated[ipToUint32(ip)] = struct{}{}
+	return true
+}
+
+// available returns whether ip can be grabbed.
+func (ia *ipAllocator) available(ip net.IP) bool {
+	return ia.subnet.Contains(ip) && ia.allocatable(ip)
+}
+
+// allocatable returns whether ip is a free host address and not excluded.
+func (ia *ipAllocator) allocatable(ip net.IP) bool {
+	return ia.usable(ip) && hostAddr(ia.subnet, ip) && (ia.exclude == nil || !ia.exclude(ip))
+}
+
+// peek returns the address alloc would return, without allocating it.
+func (ia *ipAllocator) peek() net.IP {
+	try := make([]byte, len(ia.subnet.IP))
+	copy(try, ia.subnet.IP)
+	for ia.subnet.Contains(try) {
+		if ia.allocatable(try) {
+			return try
+		}
+		nextIP(try)
+	}
+	return nil
+}
+
 func (ia *ipAllocator) alloc() net.IP {
 	// Make a copy so we can modify it.
 	try := make([]byte, len(ia.subnet.IP))
@@ -60,7 +119,7 @@ func (ia *ipAllocator) alloc() net.IP {
 
 	// Just try em all.
 	for ia.subnet.Contains(try) {
-		if ia.usable(try) {
+		if ia.allocatable(try) {
 			ia.allocated[ipToUint32(try)] = struct{}{}
 			return try
 		}
@@ -46,30 +46,30 @@ func TestIPAlloc(t *testing.T) {
 
 	ipa := newIPAllocator(subnet)
 
-	want := net.IP{192, 168, 1, 0}
+	want := net.IP{192, 168, 1, 1}
 	if got := ipa.alloc(); !got.Equal(want) {
 		t.Fatalf("first alloc() = %v, want %v", got, want)
 	}
 
-	want = net.IP{192, 168, 1, 1}
+	want = net.IP{192, 168, 1, 2}
 	if got := ipa.alloc(); !got.Equal(want) {
 		t.Fatalf("second alloc() = %v, want %v", got, want)
 	}
 
-	ipa.free(net.IP{192, 168, 1, 0})
-	want = net.IP{192, 168, 1, 0}
+	ipa.free(net.IP{192, 168, 1, 1})
+	want = net.IP{192, 168, 1, 1}
 	if got := ipa.alloc(); !got.Equal(want) {
 		t.Fatalf("third alloc() = %v, want %v", got, want)
 	}
 
-	want = net.IP{192, 168, 1, 2}
+	want = net.IP{192, 168, 1, 3}
 	if got := ipa.alloc(); !got.Equal(want) {
 		t.Fatalf("fourth alloc() = %v, want %v", got, want)
 	}
 
-	ipa.free(net.IP{192, 168, 1, 3})
+	ipa.free(net.IP{192, 168, 1, 4})
 
-	want = net.IP{192, 168, 1, 3}
+	want = net.IP{192, 168, 1, 4}
 	if got := ipa.alloc(); !got.Equal(want) {
 		t.Fatalf("fifth alloc() = %v, want %v", got, want)
 	}
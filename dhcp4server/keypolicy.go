@@ -0,0 +1,160 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4server
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+)
+
+// KeyPolicy determines how the server tells clients apart, i.e. which
+// requests share a binding.
+type KeyPolicy int
+
+const (
+	// KeyHardwareAddr identifies clients by their hardware address
+	// (chaddr) only, ignoring any client identifier. A machine booting
+	// firmware, installer and OS on the same NIC keeps one address, even
+	// if each stage sends a different client identifier.
+	//
+	// This is the default.
+	KeyHardwareAddr KeyPolicy = iota
+
+	// KeyClientID identifies clients by their client identifier
+	// (option 61) only. Requests without a client identifier are ignored.
+	KeyClientID
+
+	// KeyClientIDThenHardwareAddr identifies clients by their client
+	// identifier if they send one and by their hardware address otherwise,
+	// as RFC 2131 Section 4.2 describes. A machine whose boot stages send
+	// different client identifiers gets one address per stage.
+	KeyClientIDThenHardwareAddr
+)
+
+var keyPolicyNames = map[KeyPolicy]string{
+	KeyHardwareAddr:             "mac",
+	KeyClientID:                 "client-id",
+	KeyClientIDThenHardwareAddr: "client-id-then-mac",
+}
+
+// String implements fmt.Stringer.
+func (p KeyPolicy) String() string {
+	if s, ok := keyPolicyNames[p]; ok {
+		return s
+	}
+	return fmt.Sprintf("KeyPolicy(%d)", int(p))
+}
+
+// ParseKeyPolicy parses "mac", "client-id" or "client-id-then-mac".
+func ParseKeyPolicy(s string) (KeyPolicy, error) {
+	for p, name := range keyPolicyNames {
+		if s == name {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown lease key policy %q", s)
+}
+
+// bindingKey identifies the client of a binding.
+type bindingKey string
+
+// key returns the key of the client with clientID and haddr, or false if the
+// client cannot be identified under p.
+func (p KeyPolicy) key(clientID []byte, haddr net.HardwareAddr) (bindingKey, bool) {
+	switch p {
+	case KeyClientID:
+		if len(clientID) == 0 {
+			return "", false
+		}
+		return bindingKey("id:" + string(clientID)), true
+
+	case KeyClientIDThenHardwareAddr:
+		if len(clientID) > 0 {
+			return bindingKey("id:" + string(clientID)), true
+		}
+	}
+	return bindingKey("hw:" + string(haddr)), true
+}
+
+// requestKey returns the key of the client of request.
+func (p KeyPolicy) requestKey(request *dhcp4.Packet) (bindingKey, bool) {
+	return p.key(request.Options.Get(dhcp4.OptionClientIdentifier), request.CHAddr)
+}
+
+// WithKeyPolicy configures how clients are told apart.
+//
+// Default is KeyHardwareAddr.
+func WithKeyPolicy(p KeyPolicy) ServerOpt {
+	return func(s *Server) {
+		s.keyPolicy = p
+	}
+}
+
+// KeyPolicy returns how the server tells clients apart.
+func (s *Server) KeyPolicy() KeyPolicy {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.keyPolicy
+}
+
+// SetKeyPolicy changes how the server tells clients apart and migrates the
+// active bindings to the new policy.
+//
+// Bindings that cannot be identified under p, i.e. bindings of clients that
+// sent no client identifier when switching to KeyClientID, are ended. When
+// several bindings map to the same client under p, e.g. a client identifier
+// used on two NICs when switching to KeyClientIDThenHardwareAddr, the most
+// recent one is kept and the others are ended. Ended bindings are moved to
+// the lease history and returned.
+func (s *Server) SetKeyPolicy(p KeyPolicy) []LeaseRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bs := s.leases.All()
+	// Most recent first, so it wins collisions.
+	sort.Slice(bs, func(i, j int) bool {
+		return bs[i].Start.After(bs[j].Start)
+	})
+
+	now := time.Now()
+	var ended []LeaseRecord
+	for _, b := range bs {
+		s.leases.Release(b.Key)
+	}
+	offers, ends := s.offers, s.leaseEnds
+	s.offers = make(map[bindingKey]pendingOffer)
+	s.leaseEnds = make(map[bindingKey]time.Time)
+	for _, b := range bs {
+		o, pending := offers[bindingKey(b.Key)]
+		end, expires := ends[bindingKey(b.Key)]
+		key, ok := p.key(b.ClientID, b.HardwareAddr)
+		if ok {
+			if _, taken := s.leases.Lookup(string(key)); !taken {
+				b.Key = string(key)
+				// The address was just released, so it is free.
+				if _, err := s.leases.Allocate(b, b.IP); err == nil {
+					if pending {
+						s.offers[key] = o
+					}
+					if expires {
+						s.leaseEnds[key] = end
+					}
+					continue
+				}
+			}
+		}
+		r := b.record(now)
+		if err := s.history.Add(r); err != nil {
+			s.logger.Printf("Could not record ended lease of %v: %v", r.IP, err)
+		}
+		ended = append(ended, r)
+	}
+	s.keyPolicy = p
+	return ended
+}
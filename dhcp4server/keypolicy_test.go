@@ -0,0 +1,128 @@
+package dhcp4server
+
+import (
+	"net"
+	"testing"
+
+	"github.com/mergetb/dhcp4"
+	"github.com/mergetb/dhcp4/dhcp4opts"
+)
+
+func newIDRequest(typ dhcp4opts.DHCPMessageType, mac net.HardwareAddr, clientID string) *dhcp4.Packet {
+	p := newRequest(typ, mac)
+	if clientID != "" {
+		p.Options[dhcp4.OptionClientIdentifier] = []byte(clientID)
+	}
+	return p
+}
+
+func TestKeyPolicy(t *testing.T) {
+	mac1 := net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 1}
+	mac2 := net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 2}
+
+	for _, tt := range []struct {
+		policy KeyPolicy
+		a, b   *dhcp4.Packet
+		// same is whether a and b are the same client.
+		same bool
+		// ignored is whether b gets no offer.
+		ignored bool
+	}{
+		{
+			policy: KeyHardwareAddr,
+			a:      newIDRequest(dhcp4opts.DHCPDiscover, mac1, "pxe"),
+			b:      newIDRequest(dhcp4opts.DHCPDiscover, mac1, "os"),
+			same:   true,
+		},
+		{
+			policy: KeyHardwareAddr,
+			a:      newIDRequest(dhcp4opts.DHCPDiscover, mac1, "node"),
+			b:      newIDRequest(dhcp4opts.DHCPDiscover, mac2, "node"),
+		},
+		{
+			policy: KeyClientID,
+			a:      newIDRequest(dhcp4opts.DHCPDiscover, mac1, "node"),
+			b:      newIDRequest(dhcp4opts.DHCPDiscover, mac2, "node"),
+			same:   true,
+		},
+		{
+			policy:  KeyClientID,
+			a:       newIDRequest(dhcp4opts.DHCPDiscover, mac1, "node"),
+			b:       newIDRequest(dhcp4opts.DHCPDiscover, mac1, ""),
+			ignored: true,
+		},
+		{
+			policy: KeyClientIDThenHardwareAddr,
+			a:      newIDRequest(dhcp4opts.DHCPDiscover, mac1, "pxe"),
+			b:      newIDRequest(dhcp4opts.DHCPDiscover, mac1, "os"),
+		},
+		{
+			policy: KeyClientIDThenHardwareAddr,
+			a:      newIDRequest(dhcp4opts.DHCPDiscover, mac1, ""),
+			b:      newIDRequest(dhcp4opts.DHCPDiscover, mac1, ""),
+			same:   true,
+		},
+	} {
+		s := newTestServer(t, WithKeyPolicy(tt.policy))
+		a := exchange(t, s, tt.a)
+		b := exchange(t, s, tt.b)
+		if a == nil {
+			t.Errorf("%v: got no offer for first client", tt.policy)
+			continue
+		}
+		if tt.ignored {
+			if b != nil {
+				t.Errorf("%v: got offer %v for second client, want none", tt.policy, b)
+			}
+			continue
+		}
+		if b == nil {
+			t.Errorf("%v: got no offer for second client", tt.policy)
+			continue
+		}
+		if same := a.YIAddr.Equal(b.YIAddr); same != tt.same {
+			t.Errorf("%v: offers %v and %v, want same client %t", tt.policy, a.YIAddr, b.YIAddr, tt.same)
+		}
+	}
+}
+
+func TestSetKeyPolicy(t *testing.T) {
+	mac1 := net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 1}
+	mac2 := net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 2}
+	mac3 := net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 3}
+
+	s := newTestServer(t)
+	exchange(t, s, newIDRequest(dhcp4opts.DHCPDiscover, mac1, "node"))
+	kept := exchange(t, s, newIDRequest(dhcp4opts.DHCPDiscover, mac2, "node"))
+	exchange(t, s, newIDRequest(dhcp4opts.DHCPDiscover, mac3, ""))
+
+	// mac1 and mac2 collide as client "node", mac3 has no client ID.
+	ended := s.SetKeyPolicy(KeyClientID)
+	if len(ended) != 2 {
+		t.Fatalf("SetKeyPolicy ended %d bindings, want 2", len(ended))
+	}
+	if got := s.History().Len(); got != 2 {
+		t.Errorf("history has %d records, want 2", got)
+	}
+	if got := s.KeyPolicy(); got != KeyClientID {
+		t.Errorf("KeyPolicy() = %v, want %v", got, KeyClientID)
+	}
+
+	// The most recent binding of "node" survived the migration, even for
+	// another NIC.
+	offer := exchange(t, s, newIDRequest(dhcp4opts.DHCPDiscover, mac1, "node"))
+	if offer == nil || !offer.YIAddr.Equal(kept.YIAddr) {
+		t.Errorf("got offer %v after migration, want %v", offer, kept.YIAddr)
+	}
+}
+
+func TestParseKeyPolicy(t *testing.T) {
+	for _, p := range []KeyPolicy{KeyHardwareAddr, KeyClientID, KeyClientIDThenHardwareAddr} {
+		if got, err := ParseKeyPolicy(p.String()); err != nil || got != p {
+			t.Errorf("ParseKeyPolicy(%q) = %v, %v, want %v", p, got, err, p)
+		}
+	}
+	if _, err := ParseKeyPolicy("uuid"); err == nil {
+		t.Errorf("ParseKeyPolicy(uuid) = nil error, want error")
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4server
+
+import (
+	"bytes"
+	"net"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+)
+
+// WithLeaseQuery makes the server answer DHCPLEASEQUERY messages (RFC 4388)
+// from requesters in the allowed networks, or from anywhere if none are
+// given. The requester is the relay agent in giaddr, or the source address
+// of queries sent directly.
+//
+// Queries are answered from the bindings: an address offered but not
+// requested yet is unassigned. Active leases are reported with the time
+// left on them, which is infinite if they were granted no lease time.
+//
+// Default is to ignore DHCPLEASEQUERY messages.
+func WithLeaseQuery(allowed ...*net.IPNet) ServerOpt {
+	return func(s *Server) {
+		s.leaseQuery = true
+		s.leaseQueryAllowed = allowed
+	}
+}
+
+// allowLeaseQuery returns whether a DHCPLEASEQUERY request from addr may be
+// answered.
+func (s *Server) allowLeaseQuery(addr net.Addr, request *dhcp4.Packet) bool {
+	if !s.leaseQuery {
+		return false
+	}
+	if len(s.leaseQueryAllowed) == 0 {
+		return true
+	}
+	requester := request.GIAddr
+	if unspecified(requester) {
+		uaddr, ok := addr.(*net.UDPAddr)
+		if !ok {
+			return false
+		}
+		requester = uaddr.IP
+	}
+	for _, n := range s.leaseQueryAllowed {
+		if n.Contains(requester) {
+			return true
+		}
+	}
+	return false
+}
+
+// answerLeaseQuery returns the reply to the DHCPLEASEQUERY request, as
+// described by RFC 4388, Section 6.4, or nil if the query is malformed.
+//
+// s.mu must be held.
+func (s *Server) answerLeaseQuery(d *decisions, request *dhcp4.Packet, now time.Time) *dhcp4.Packet {
+	var bound []Binding
+	for _, b := range s.leases.All() {
+		if _, pending := s.offers[bindingKey(b.Key)]; !pending {
+			bound = append(bound, b)
+		}
+	}
+
+	var matches []Binding
+	switch id := request.Options.ClientIdentifier(); {
+	case !unspecified(request.CIAddr):
+		for _, b := range bound {
+			if b.IP.Equal(request.CIAddr) {
+				d.add("leasequery", "%v is bound to %v", request.CIAddr, b.HardwareAddr)
+				return s.leaseActive(request, []Binding{b}, now)
+			}
+		}
+		typ := dhcp4.DHCPLeaseUnassigned
+		if rl, ok := s.local.(ResizableLeases); ok && !rl.Pool().Contains(request.CIAddr) && s.subnetContaining(request.CIAddr) == nil {
+			d.add("leasequery", "%v is outside the pool", request.CIAddr)
+			typ = dhcp4.DHCPLeaseUnknown
+		} else {
+			d.add("leasequery", "%v is not bound", request.CIAddr)
+		}
+		reply := s.responsePacket(request, typ)
+		reply.CIAddr = request.CIAddr
+		return reply
+
+	case id != nil:
+		for _, b := range bound {
+			if bytes.Equal(b.ClientID, id) {
+				matches = append(matches, b)
+			}
+		}
+
+	case len(request.CHAddr) > 0:
+		for _, b := range bound {
+			if bytes.Equal(b.HardwareAddr, request.CHAddr) {
+				matches = append(matches, b)
+			}
+		}
+
+	default:
+		d.log("leasequery", "Ignoring DHCPLEASEQUERY without ciaddr, chaddr or client identifier")
+		return nil
+	}
+
+	if len(matches) == 0 {
+		d.add("leasequery", "client has no binding")
+		return s.responsePacket(request, dhcp4.DHCPLeaseUnknown)
+	}
+	d.add("leasequery", "client is bound to %d addresses", len(matches))
+	return s.leaseActive(request, matches, now)
+}
+
+// leaseActive returns a DHCPLEASEACTIVE reply to request for the bindings of
+// one client. The binding renewed last is reported in ciaddr, and all of
+// them in the associated IP option if there are several.
+func (s *Server) leaseActive(request *dhcp4.Packet, bs []Binding, now time.Time) *dhcp4.Packet {
+	last := bs[0]
+	for _, b := range bs[1:] {
+		if b.Renewed.After(last.Renewed) {
+			last = b
+		}
+	}
+
+	reply := s.responsePacket(request, dhcp4.DHCPLeaseActive)
+	reply.CIAddr = last.IP
+	if len(last.HardwareAddr) > 0 {
+		// Bindings only hold hardware addresses that fit chaddr.
+		reply.SetHardwareAddr(last.HardwareAddr)
+	}
+	if last.ClientID != nil {
+		reply.Options.SetClientIdentifier(last.ClientID)
+	}
+	reply.Options.SetLeaseTime(s.leaseTimeLeft(bindingKey(last.Key), now))
+	if !last.Renewed.IsZero() {
+		reply.Options.SetClientLastTransactionTime(now.Sub(last.Renewed))
+	}
+	if len(bs) > 1 {
+		ips := make([]net.IP, 0, len(bs))
+		for _, b := range bs {
+			ips = append(ips, b.IP)
+		}
+		reply.Options.SetAssociatedIPs(ips)
+	}
+	return reply
+}
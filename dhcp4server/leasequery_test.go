@@ -0,0 +1,95 @@
+package dhcp4server
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/mergetb/dhcp4"
+	"github.com/mergetb/dhcp4/dhcp4opts"
+)
+
+func TestLeaseQuery(t *testing.T) {
+	s := newTestServer(t, WithLeaseQuery())
+	bound := net.HardwareAddr{2, 0, 0, 0, 0, 1}
+	offered := net.HardwareAddr{2, 0, 0, 0, 0, 2}
+
+	offer := exchange(t, s, newRequest(dhcp4opts.DHCPDiscover, bound))
+	if offer == nil {
+		t.Fatal("no offer")
+	}
+	request := newRequest(dhcp4opts.DHCPRequest, bound)
+	request.Options.SetRequestedIPAddress(offer.YIAddr)
+	if ack := exchange(t, s, request); ack == nil || ack.Options.MessageType() != dhcp4.DHCPACK {
+		t.Fatalf("response to REQUEST = %v, want ACK", ack)
+	}
+	pending := exchange(t, s, newRequest(dhcp4opts.DHCPDiscover, offered))
+	if pending == nil {
+		t.Fatal("no offer to second client")
+	}
+
+	for _, tt := range []struct {
+		name   string
+		ciaddr net.IP
+		mac    net.HardwareAddr
+		want   dhcp4.MessageType
+		wantIP net.IP
+	}{
+		{name: "bound address", ciaddr: offer.YIAddr, want: dhcp4.DHCPLeaseActive, wantIP: offer.YIAddr},
+		{name: "offered address", ciaddr: pending.YIAddr, want: dhcp4.DHCPLeaseUnassigned, wantIP: pending.YIAddr},
+		{name: "foreign address", ciaddr: net.IP{10, 0, 0, 1}, want: dhcp4.DHCPLeaseUnknown, wantIP: net.IP{10, 0, 0, 1}},
+		{name: "bound client", mac: bound, want: dhcp4.DHCPLeaseActive, wantIP: offer.YIAddr},
+		{name: "offered client", mac: offered, want: dhcp4.DHCPLeaseUnknown},
+		{name: "no criteria"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			query := newRequest(dhcp4opts.DHCPLeaseQuery, tt.mac)
+			query.CIAddr = tt.ciaddr
+			reply := exchange(t, s, query)
+			if tt.want == 0 {
+				if reply != nil {
+					t.Errorf("reply = %v, want none", reply)
+				}
+				return
+			}
+			if reply == nil {
+				t.Fatalf("no reply, want %v", tt.want)
+			}
+			if got := reply.Options.MessageType(); got != tt.want {
+				t.Errorf("reply type = %v, want %v", got, tt.want)
+			}
+			if tt.wantIP != nil && !reply.CIAddr.Equal(tt.wantIP) {
+				t.Errorf("reply ciaddr = %v, want %v", reply.CIAddr, tt.wantIP)
+			}
+			if tt.want != dhcp4.DHCPLeaseActive {
+				return
+			}
+			if !bytes.Equal(reply.CHAddr, bound) {
+				t.Errorf("reply chaddr = %v, want %v", reply.CHAddr, bound)
+			}
+			if reply.Options.LeaseTime() != infiniteLease {
+				t.Errorf("reply lease time = %v, want infinite", reply.Options.LeaseTime())
+			}
+		})
+	}
+}
+
+func TestLeaseQueryNotAllowed(t *testing.T) {
+	_, relays, err := net.ParseCIDR("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := newRequest(dhcp4opts.DHCPLeaseQuery, net.HardwareAddr{2, 0, 0, 0, 0, 1})
+
+	if reply := exchange(t, newTestServer(t), query); reply != nil {
+		t.Errorf("reply without WithLeaseQuery = %v, want none", reply)
+	}
+	if reply := exchange(t, newTestServer(t, WithLeaseQuery(relays)), query); reply != nil {
+		t.Errorf("reply to requester outside %v = %v, want none", relays, reply)
+	}
+
+	query.GIAddr = net.IP{10, 0, 0, 1}
+	if reply := exchange(t, newTestServer(t, WithLeaseQuery(relays)), query); reply == nil {
+		t.Errorf("no reply to relay agent in %v", relays)
+	}
+}
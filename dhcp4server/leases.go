@@ -0,0 +1,417 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4server
+
+import (
+	"crypto/cipher"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Binding is an address bound to a client.
+type Binding struct {
+	// Key identifies the client, see KeyPolicy.
+	Key string
+
+	IP           net.IP
+	HardwareAddr net.HardwareAddr
+	ClientID     []byte
+
+	// Start is when the address was bound.
+	Start time.Time
+
+	// Renewed is when the client last confirmed the binding.
+	Renewed time.Time
+}
+
+// record returns the lease record of b, ended at end.
+func (b Binding) record(end time.Time) LeaseRecord {
+	return LeaseRecord{
+		IP:           b.IP,
+		HardwareAddr: b.HardwareAddr,
+		Start:        b.Start,
+		End:          end,
+		key:          b.Key,
+	}
+}
+
+var (
+	// ErrNoAddress is returned by Leases.Allocate when all addresses are
+	// bound.
+	ErrNoAddress = errors.New("no free address")
+
+	// ErrNotBound is returned by Leases for clients without a binding.
+	ErrNotBound = errors.New("client has no binding")
+)
+
+// Leases stores the bindings of a server and allocates addresses to them.
+//
+// The server serializes calls, so implementations need not be safe for
+// concurrent use by several servers.
+type Leases interface {
+	// Allocate binds an address to the client b.Key and returns the
+	// binding. If the client has a binding already, it is returned
+	// unchanged. Otherwise requested is bound if it is free, and any free
+	// address if not. The binding's IP is set by Allocate; all other
+	// fields are taken from b.
+	//
+	// If no address is free, Allocate returns ErrNoAddress.
+	Allocate(b Binding, requested net.IP) (Binding, error)
+
+	// Free returns the address Allocate would bind to a new client
+	// requesting requested, or nil if none is free, without binding it.
+	Free(requested net.IP) net.IP
+
+	// Renew records that the client key confirmed its binding at now.
+	Renew(key string, now time.Time) (Binding, error)
+
+	// Release ends the binding of the client key and returns it.
+	Release(key string) (Binding, error)
+
+	// Lookup returns the binding of the client key.
+	Lookup(key string) (Binding, bool)
+
+	// All returns all bindings.
+	All() []Binding
+}
+
+// ResizableLeases are Leases whose pool of addresses can change at runtime,
+// see Server.ResizePool.
+type ResizableLeases interface {
+	Leases
+
+	// Pool returns the subnet addresses are allocated from.
+	Pool() *net.IPNet
+
+	// Resize makes Allocate and Free use the addresses of subnet.
+	// Bindings outside subnet are kept, but their addresses are not
+	// allocated again once they are released.
+	Resize(subnet *net.IPNet) error
+}
+
+// WithLeases configures where the server stores bindings.
+//
+// Default is NewMemoryLeases with the subnet passed to New.
+func WithLeases(l Leases) ServerOpt {
+	return func(s *Server) {
+		s.leases = l
+	}
+}
+
+// MemoryLeases are Leases kept in memory, allocating addresses from a subnet.
+type MemoryLeases struct {
+	ips      *ipAllocator
+	bindings map[string]Binding
+}
+
+var _ ResizableLeases = &MemoryLeases{}
+
+// NewMemoryLeases returns empty Leases allocating addresses from subnet.
+func NewMemoryLeases(subnet *net.IPNet) *MemoryLeases {
+	return &MemoryLeases{
+		ips:      newIPAllocator(subnet),
+		bindings: make(map[string]Binding),
+	}
+}
+
+// Allocate implements Leases.Allocate.
+func (ml *MemoryLeases) Allocate(b Binding, requested net.IP) (Binding, error) {
+	if existing, ok := ml.bindings[b.Key]; ok {
+		return existing, nil
+	}
+	if requested != nil && ml.ips.grab(requested) {
+		b.IP = requested
+	} else if b.IP = ml.ips.alloc(); b.IP == nil {
+		return Binding{}, ErrNoAddress
+	}
+	ml.bindings[b.Key] = b
+	return b, nil
+}
+
+// restore adds the binding b, which may be outside the pool.
+func (ml *MemoryLeases) restore(b Binding) error {
+	if _, ok := ml.bindings[b.Key]; ok || !ml.ips.reserve(b.IP) {
+		return errors.New("duplicate binding")
+	}
+	ml.bindings[b.Key] = b
+	return nil
+}
+
+// Free implements Leases.Free.
+func (ml *MemoryLeases) Free(requested net.IP) net.IP {
+	if requested != nil && ml.ips.available(requested) {
+		return requested
+	}
+	return ml.ips.peek()
+}
+
+// Renew implements Leases.Renew.
+func (ml *MemoryLeases) Renew(key string, now time.Time) (Binding, error) {
+	b, ok := ml.bindings[key]
+	if !ok {
+		return Binding{}, ErrNotBound
+	}
+	b.Renewed = now
+	ml.bindings[key] = b
+	return b, nil
+}
+
+// Release implements Leases.Release.
+func (ml *MemoryLeases) Release(key string) (Binding, error) {
+	b, ok := ml.bindings[key]
+	if !ok {
+		return Binding{}, ErrNotBound
+	}
+	delete(ml.bindings, key)
+	ml.ips.free(b.IP)
+	return b, nil
+}
+
+// Lookup implements Leases.Lookup.
+func (ml *MemoryLeases) Lookup(key string) (Binding, bool) {
+	b, ok := ml.bindings[key]
+	return b, ok
+}
+
+// All implements Leases.All.
+func (ml *MemoryLeases) All() []Binding {
+	bs := make([]Binding, 0, len(ml.bindings))
+	for _, b := range ml.bindings {
+		bs = append(bs, b)
+	}
+	return bs
+}
+
+// setExclude makes Allocate and Free skip the addresses exclude returns
+// true for.
+func (ml *MemoryLeases) setExclude(exclude func(net.IP) bool) {
+	ml.ips.exclude = exclude
+}
+
+// available returns whether Allocate would bind ip if requested, without
+// looking for another free address as Free does.
+func (ml *MemoryLeases) available(ip net.IP) bool {
+	return ml.ips.available(ip)
+}
+
+// Pool implements ResizableLeases.Pool.
+func (ml *MemoryLeases) Pool() *net.IPNet {
+	return ml.ips.subnet
+}
+
+// Resize implements ResizableLeases.Resize.
+func (ml *MemoryLeases) Resize(subnet *net.IPNet) error {
+	if subnet.IP.To4() == nil {
+		return fmt.Errorf("pool %v is not an IPv4 subnet", subnet)
+	}
+	ml.ips.subnet = subnet
+	return nil
+}
+
+// FileLeases are Leases kept in memory and saved to a JSON file after every
+// change, so that bindings survive restarts.
+//
+// The file holds client identities such as hardware addresses; use
+// WithEncryption where they must be protected at rest.
+type FileLeases struct {
+	mem  *MemoryLeases
+	path string
+
+	// aead encrypts the file if set.
+	aead cipher.AEAD
+}
+
+var _ ResizableLeases = &FileLeases{}
+
+// bindingJSON is the file representation of a Binding.
+type bindingJSON struct {
+	// Key is binary, which JSON strings cannot hold.
+	Key          []byte    `json:"key"`
+	IP           string    `json:"ip"`
+	HardwareAddr string    `json:"hardware_addr"`
+	ClientID     []byte    `json:"client_id,omitempty"`
+	Start        time.Time `json:"start"`
+	Renewed      time.Time `json:"renewed,omitempty"`
+}
+
+// OpenFileLeases returns Leases allocating addresses from subnet and saved to
+// the file at path, starting with the bindings saved there if the file
+// exists. Saved bindings outside subnet, e.g. of a pool that has shrunk, are
+// kept until they are released.
+func OpenFileLeases(path string, subnet *net.IPNet, opts ...FileLeasesOpt) (*FileLeases, error) {
+	fl := &FileLeases{
+		mem:  NewMemoryLeases(subnet),
+		path: path,
+	}
+	for _, opt := range opts {
+		if err := opt(fl); err != nil {
+			return nil, err
+		}
+	}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return fl, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if isEncrypted(b) {
+		if fl.aead == nil {
+			return nil, fmt.Errorf("lease file %s is encrypted, but no key is configured", path)
+		}
+		if b, err = unseal(fl.aead, b); err != nil {
+			return nil, fmt.Errorf("lease file %s: %v", path, err)
+		}
+	}
+
+	var bjs []bindingJSON
+	if err := json.Unmarshal(b, &bjs); err != nil {
+		return nil, fmt.Errorf("lease file %s: %v", path, err)
+	}
+	for _, bj := range bjs {
+		ip := net.ParseIP(bj.IP).To4()
+		haddr, err := parseHardwareAddr(bj.HardwareAddr)
+		if ip == nil || err != nil {
+			return nil, fmt.Errorf("lease file %s: invalid binding of %q to %q", path, bj.HardwareAddr, bj.IP)
+		}
+		b := Binding{
+			Key:          string(bj.Key),
+			HardwareAddr: haddr,
+			ClientID:     bj.ClientID,
+			Start:        bj.Start,
+			Renewed:      bj.Renewed,
+		}
+		b.IP = ip
+		if err := fl.mem.restore(b); err != nil {
+			return nil, fmt.Errorf("lease file %s: cannot restore binding of %v to %v: %v", path, haddr, ip, err)
+		}
+	}
+	return fl, nil
+}
+
+// parseHardwareAddr parses a hardware address as written by
+// net.HardwareAddr.String, which is empty for clients that did not send one
+// and colon-separated hex of any length otherwise. Unlike net.ParseMAC, it
+// accepts both.
+func parseHardwareAddr(s string) (net.HardwareAddr, error) {
+	if s == "" {
+		return nil, nil
+	}
+	b, err := hex.DecodeString(strings.Replace(s, ":", "", -1))
+	if err != nil || net.HardwareAddr(b).String() != s {
+		return nil, fmt.Errorf("invalid hardware address %q", s)
+	}
+	return net.HardwareAddr(b), nil
+}
+
+// save writes all bindings to the file, replacing it atomically.
+func (fl *FileLeases) save() error {
+	bjs := []bindingJSON{}
+	for _, b := range fl.mem.All() {
+		bjs = append(bjs, bindingJSON{
+			Key:          []byte(b.Key),
+			IP:           b.IP.String(),
+			HardwareAddr: b.HardwareAddr.String(),
+			ClientID:     b.ClientID,
+			Start:        b.Start,
+			Renewed:      b.Renewed,
+		})
+	}
+	data, err := json.MarshalIndent(bjs, "", "\t")
+	if err != nil {
+		return err
+	}
+	if fl.aead != nil {
+		if data, err = seal(fl.aead, data); err != nil {
+			return err
+		}
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(fl.path), filepath.Base(fl.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), fl.path)
+}
+
+// Allocate implements Leases.Allocate.
+func (fl *FileLeases) Allocate(b Binding, requested net.IP) (Binding, error) {
+	if existing, ok := fl.mem.Lookup(b.Key); ok {
+		return existing, nil
+	}
+	b, err := fl.mem.Allocate(b, requested)
+	if err != nil {
+		return b, err
+	}
+	return b, fl.save()
+}
+
+// Free implements Leases.Free.
+func (fl *FileLeases) Free(requested net.IP) net.IP {
+	return fl.mem.Free(requested)
+}
+
+// Renew implements Leases.Renew.
+func (fl *FileLeases) Renew(key string, now time.Time) (Binding, error) {
+	b, err := fl.mem.Renew(key, now)
+	if err != nil {
+		return b, err
+	}
+	return b, fl.save()
+}
+
+// Release implements Leases.Release.
+func (fl *FileLeases) Release(key string) (Binding, error) {
+	b, err := fl.mem.Release(key)
+	if err != nil {
+		return b, err
+	}
+	return b, fl.save()
+}
+
+// Lookup implements Leases.Lookup.
+func (fl *FileLeases) Lookup(key string) (Binding, bool) {
+	return fl.mem.Lookup(key)
+}
+
+// All implements Leases.All.
+func (fl *FileLeases) All() []Binding {
+	return fl.mem.All()
+}
+
+func (fl *FileLeases) setExclude(exclude func(net.IP) bool) {
+	fl.mem.setExclude(exclude)
+}
+
+func (fl *FileLeases) available(ip net.IP) bool {
+	return fl.mem.available(ip)
+}
+
+// Pool implements ResizableLeases.Pool.
+func (fl *FileLeases) Pool() *net.IPNet {
+	return fl.mem.Pool()
+}
+
+// Resize implements ResizableLeases.Resize. The pool is not saved; pass the
+// new subnet to OpenFileLeases after a restart.
+func (fl *FileLeases) Resize(subnet *net.IPNet) error {
+	return fl.mem.Resize(subnet)
+}
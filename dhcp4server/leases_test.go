@@ -0,0 +1,138 @@
+package dhcp4server
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+	"github.com/mergetb/dhcp4/dhcp4opts"
+)
+
+func TestMemoryLeases(t *testing.T) {
+	_, subnet, _ := net.ParseCIDR("192.168.1.0/31")
+	l := NewMemoryLeases(subnet)
+
+	a, err := l.Allocate(Binding{Key: "a"}, net.IP{192, 168, 1, 1})
+	if err != nil || !a.IP.Equal(net.IP{192, 168, 1, 1}) {
+		t.Fatalf("Allocate(a, .1) = %v, %v, want .1", a.IP, err)
+	}
+	if again, err := l.Allocate(Binding{Key: "a"}, nil); err != nil || !again.IP.Equal(a.IP) {
+		t.Errorf("Allocate(a) again = %v, %v, want %v", again.IP, err, a.IP)
+	}
+	if free := l.Free(a.IP); free == nil || free.Equal(a.IP) {
+		t.Errorf("Free(%v) = %v, want another address", a.IP, free)
+	}
+	b, err := l.Allocate(Binding{Key: "b"}, a.IP)
+	if err != nil || b.IP.Equal(a.IP) {
+		t.Fatalf("Allocate(b, %v) = %v, %v, want another address", a.IP, b.IP, err)
+	}
+	if _, err := l.Allocate(Binding{Key: "c"}, nil); err != ErrNoAddress {
+		t.Errorf("Allocate(c) with all addresses bound = %v, want ErrNoAddress", err)
+	}
+
+	now := time.Now()
+	if r, err := l.Renew("a", now); err != nil || !r.Renewed.Equal(now) {
+		t.Errorf("Renew(a) = %v, %v, want renewed at %v", r.Renewed, err, now)
+	}
+	if _, err := l.Renew("c", now); err != ErrNotBound {
+		t.Errorf("Renew(c) = %v, want ErrNotBound", err)
+	}
+
+	if _, err := l.Release("a"); err != nil {
+		t.Errorf("Release(a) = %v", err)
+	}
+	if _, ok := l.Lookup("a"); ok {
+		t.Errorf("Lookup(a) after release found a binding")
+	}
+	if c, err := l.Allocate(Binding{Key: "c"}, nil); err != nil || !c.IP.Equal(a.IP) {
+		t.Errorf("Allocate(c) after release = %v, %v, want %v", c.IP, err, a.IP)
+	}
+	if n := len(l.All()); n != 2 {
+		t.Errorf("All() has %d bindings, want 2", n)
+	}
+}
+
+func TestFileLeases(t *testing.T) {
+	dir, err := ioutil.TempDir("", "leases")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "leases.json")
+	_, subnet, _ := net.ParseCIDR("192.168.1.0/24")
+
+	l, err := OpenFileLeases(path, subnet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now().Round(0)
+	mac := net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 1}
+	key := "hw:" + string(mac)
+	bound, err := l.Allocate(Binding{Key: key, HardwareAddr: mac, ClientID: []byte{1, 2}, Start: start}, net.IP{192, 168, 1, 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Allocate(Binding{Key: "released"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	// Clients keyed by client identifier may not send a hardware address,
+	// or one of any length.
+	odd := net.HardwareAddr{1, 2, 3, 4}
+	if _, err := l.Allocate(Binding{Key: "id:none", ClientID: []byte{3}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Allocate(Binding{Key: "id:odd", HardwareAddr: odd, ClientID: []byte{4}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Release("released"); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := OpenFileLeases(path, subnet)
+	if err != nil {
+		t.Fatalf("OpenFileLeases() after restart = %v", err)
+	}
+	got, ok := reopened.Lookup(key)
+	if !ok || !got.IP.Equal(bound.IP) || got.HardwareAddr.String() != mac.String() || string(got.ClientID) != "\x01\x02" || !got.Start.Equal(start) {
+		t.Errorf("Lookup() after restart = %+v, %v; want %+v", got, ok, bound)
+	}
+	if got, ok := reopened.Lookup("id:none"); !ok || got.HardwareAddr != nil {
+		t.Errorf("Lookup() of a binding without hardware address after restart = %+v, %v", got, ok)
+	}
+	if got, ok := reopened.Lookup("id:odd"); !ok || got.HardwareAddr.String() != odd.String() {
+		t.Errorf("Lookup() of a binding with a 4-byte hardware address after restart = %+v, %v", got, ok)
+	}
+	if n := len(reopened.All()); n != 3 {
+		t.Errorf("All() after restart has %d bindings, want 3", n)
+	}
+	if free := reopened.Free(bound.IP); free.Equal(bound.IP) {
+		t.Errorf("Free(%v) after restart = %v, want another address", bound.IP, free)
+	}
+}
+
+func TestServerWithLeases(t *testing.T) {
+	_, subnet, _ := net.ParseCIDR("192.168.1.0/24")
+	l := NewMemoryLeases(subnet)
+	mac := net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 1}
+	if _, err := l.Allocate(Binding{Key: "hw:" + string(mac), HardwareAddr: mac}, net.IP{192, 168, 1, 50}); err != nil {
+		t.Fatal(err)
+	}
+
+	s := newTestServer(t, WithLeases(l))
+	offer := exchange(t, s, newRequest(dhcp4opts.DHCPDiscover, mac))
+	if offer == nil || !offer.YIAddr.Equal(net.IP{192, 168, 1, 50}) {
+		t.Fatalf("offer = %v, want the stored binding 192.168.1.50", offer)
+	}
+	req := newRequest(dhcp4opts.DHCPRequest, mac)
+	req.Options[dhcp4.OptionRequestedIPAddress] = offer.YIAddr
+	if ack := exchange(t, s, req); ack == nil || dhcp4opts.GetDHCPMessageType(ack.Options) != dhcp4opts.DHCPACK {
+		t.Fatalf("reply to REQUEST = %v, want ACK", ack)
+	}
+	if b, _ := l.Lookup("hw:" + string(mac)); b.Renewed.IsZero() {
+		t.Errorf("binding not renewed by ACK")
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4server
+
+import (
+	"container/list"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+)
+
+// WithClientRateLimit makes ServeContext drop the requests of clients
+// sending more than burst requests at once, or more than rate per second in
+// the long run, as soon as they are read: a client stuck in a request loop
+// then neither crowds out the queue nor costs allocation work. Clients are
+// told apart by hardware address.
+//
+// Unlike the RateLimit middleware, which runs when a worker handles the
+// request, the limit applies before requests are queued.
+//
+// Default is no limit.
+func WithClientRateLimit(rate float64, burst int) ServerOpt {
+	return func(s *Server) {
+		s.clientLimit = newRateLimiter(rate, burst)
+	}
+}
+
+// WithGlobalRateLimit makes ServeContext drop requests beyond burst at once,
+// or rate per second in the long run, from all clients together, as soon as
+// they are read. It bounds the work a storm of clients with changing
+// hardware addresses causes. Requests dropped by WithClientRateLimit do not
+// count against it.
+//
+// Default is no limit.
+func WithGlobalRateLimit(rate float64, burst int) ServerOpt {
+	return func(s *Server) {
+		s.globalLimit = newRateLimiter(rate, burst)
+	}
+}
+
+// WithMaxPendingOffers bounds the number of addresses offered but not
+// requested yet, see WithOfferHold. While n offers are pending, DISCOVERs of
+// clients without an address are not answered, so that a flood of
+// DISCOVERs with made-up hardware addresses cannot exhaust the pool.
+// Clients already holding an address or an offer are answered.
+//
+// Default is no bound.
+func WithMaxPendingOffers(n int) ServerOpt {
+	return func(s *Server) {
+		if n > 0 {
+			s.maxPendingOffers = n
+		}
+	}
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	return &rateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// Reasons ServeContext drops requests for, see ServerState.Dropped.
+const (
+	dropMalformed   = "malformed"
+	dropNotRequest  = "not a request"
+	dropClientRate  = "client rate limit"
+	dropGlobalRate  = "global rate limit"
+	dropQueueFull   = "queue full"
+	dropWorkerDelay = "waited too long for a worker"
+)
+
+// admit returns why the request pkt read at now must be dropped before it
+// is queued, or "" if it may be queued.
+func (s *Server) admit(pkt *dhcp4.Packet, now time.Time) string {
+	if pkt.Op != dhcp4.BootRequest {
+		return dropNotRequest
+	}
+	if s.clientLimit != nil && !s.clientLimit.allow(pkt.HardwareAddr().String(), now) {
+		return dropClientRate
+	}
+	if s.globalLimit != nil && !s.globalLimit.allow("", now) {
+		return dropGlobalRate
+	}
+	return ""
+}
+
+// dropLogInterval is how often ServeContext logs the requests it drops for
+// one reason.
+const dropLogInterval = 10 * time.Second
+
+// dropLog counts the requests ServeContext drops and logs them, but only
+// the first for each reason every dropLogInterval: the log of a server
+// under a flood would otherwise be a flood too.
+type dropLog struct {
+	mu         sync.Mutex
+	counts     map[string]uint64
+	logged     map[string]time.Time
+	suppressed map[string]uint64
+}
+
+// drop counts a request dropped at now for reason and logs it, formatted
+// as fmt.Sprintf(format, args...), unless it was logged recently.
+func (l *dropLog) drop(logger *log.Logger, now time.Time, reason, format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.counts == nil {
+		l.counts = make(map[string]uint64)
+		l.logged = make(map[string]time.Time)
+		l.suppressed = make(map[string]uint64)
+	}
+	l.counts[reason]++
+	if last, ok := l.logged[reason]; ok && now.Sub(last) < dropLogInterval {
+		l.suppressed[reason]++
+		return
+	}
+	msg := fmt.Sprintf(format, args...)
+	if n := l.suppressed[reason]; n > 0 {
+		msg += fmt.Sprintf(" (%d more dropped for %s since)", n, reason)
+	}
+	logger.Print(msg)
+	l.logged[reason] = now
+	l.suppressed[reason] = 0
+}
+
+// snapshot returns the number of requests dropped by reason.
+func (l *dropLog) snapshot() map[string]uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	counts := make(map[string]uint64, len(l.counts))
+	for reason, n := range l.counts {
+		counts[reason] = n
+	}
+	return counts
+}
+
+// pendingOffersFull returns whether no more offers may be made.
+//
+// s.mu must be held.
+func (s *Server) pendingOffersFull() bool {
+	return s.maxPendingOffers > 0 && len(s.offers) >= s.maxPendingOffers
+}
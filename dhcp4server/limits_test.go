@@ -0,0 +1,152 @@
+package dhcp4server
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+	"github.com/mergetb/dhcp4/dhcp4opts"
+)
+
+func TestAdmit(t *testing.T) {
+	macA := net.HardwareAddr{2, 0, 0, 0, 0, 1}
+	macB := net.HardwareAddr{2, 0, 0, 0, 0, 2}
+	reply := newRequest(dhcp4opts.DHCPOffer, macA)
+	reply.Op = dhcp4.BootReply
+
+	for _, tt := range []struct {
+		name string
+		opts []ServerOpt
+		pkts []*dhcp4.Packet
+		want []string
+	}{
+		{
+			name: "no limits",
+			pkts: []*dhcp4.Packet{newRequest(dhcp4opts.DHCPDiscover, macA), newRequest(dhcp4opts.DHCPDiscover, macA), reply},
+			want: []string{"", "", dropNotRequest},
+		},
+		{
+			name: "client",
+			opts: []ServerOpt{WithClientRateLimit(0, 1)},
+			pkts: []*dhcp4.Packet{newRequest(dhcp4opts.DHCPDiscover, macA), newRequest(dhcp4opts.DHCPDiscover, macA), newRequest(dhcp4opts.DHCPDiscover, macB)},
+			want: []string{"", dropClientRate, ""},
+		},
+		{
+			name: "global",
+			opts: []ServerOpt{WithGlobalRateLimit(0, 2)},
+			pkts: []*dhcp4.Packet{newRequest(dhcp4opts.DHCPDiscover, macA), newRequest(dhcp4opts.DHCPDiscover, macB), newRequest(dhcp4opts.DHCPDiscover, macB)},
+			want: []string{"", "", dropGlobalRate},
+		},
+		{
+			// The client's dropped request does not use up the
+			// global budget.
+			name: "client before global",
+			opts: []ServerOpt{WithClientRateLimit(0, 1), WithGlobalRateLimit(0, 2)},
+			pkts: []*dhcp4.Packet{newRequest(dhcp4opts.DHCPDiscover, macA), newRequest(dhcp4opts.DHCPDiscover, macA), newRequest(dhcp4opts.DHCPDiscover, macB)},
+			want: []string{"", dropClientRate, ""},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, tt.opts...)
+			now := time.Now()
+			for i, p := range tt.pkts {
+				if got := s.admit(p, now); got != tt.want[i] {
+					t.Errorf("admit(packet %d) = %q, want %q", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDropLog(t *testing.T) {
+	var buf bytes.Buffer
+	logger := log.New(&buf, "", 0)
+	var l dropLog
+	now := time.Now()
+
+	l.drop(logger, now, dropMalformed, "first")
+	l.drop(logger, now.Add(time.Second), dropMalformed, "second")
+	l.drop(logger, now.Add(time.Second), dropQueueFull, "queue")
+	l.drop(logger, now.Add(dropLogInterval), dropMalformed, "third")
+
+	want := "first\nqueue\nthird (1 more dropped for malformed since)\n"
+	if got := buf.String(); got != want {
+		t.Errorf("logged %q, want %q", got, want)
+	}
+	if got := l.snapshot(); got[dropMalformed] != 3 || got[dropQueueFull] != 1 {
+		t.Errorf("counts = %v, want 3 malformed and 1 queue full", got)
+	}
+}
+
+func TestMaxPendingOffers(t *testing.T) {
+	s := newTestServer(t, WithMaxPendingOffers(1))
+	macA := net.HardwareAddr{2, 0, 0, 0, 0, 1}
+	macB := net.HardwareAddr{2, 0, 0, 0, 0, 2}
+
+	if offer := exchange(t, s, newRequest(dhcp4opts.DHCPDiscover, macA)); offer == nil {
+		t.Fatal("no offer to the first client")
+	}
+	if offer := exchange(t, s, newRequest(dhcp4opts.DHCPDiscover, macB)); offer != nil {
+		t.Errorf("second client got offer %v while an offer is pending", offer)
+	}
+	// The client with the pending offer is still answered.
+	if offer := exchange(t, s, newRequest(dhcp4opts.DHCPDiscover, macA)); offer == nil {
+		t.Error("no offer to the first client discovering again")
+	}
+
+	// Once the first client requests its address, another may be
+	// offered one.
+	bind(t, s, macA, "")
+	if offer := exchange(t, s, newRequest(dhcp4opts.DHCPDiscover, macB)); offer == nil {
+		t.Error("no offer to the second client after the first was bound")
+	}
+}
+
+func TestServeContextDrops(t *testing.T) {
+	var buf bytes.Buffer
+	s := newTestServer(t, WithClientRateLimit(0, 1))
+	conn := &chanConn{
+		in:       make(chan packet),
+		deadline: make(chan struct{}),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- s.ServeContext(ctx, log.New(&buf, "", 0), conn)
+	}()
+
+	b, err := newRequest(dhcp4opts.DHCPDiscover, net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 1}).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.in <- packet{b: b, addr: testPeer}
+	conn.in <- packet{b: b, addr: testPeer}
+	conn.in <- packet{b: []byte("garbage"), addr: testPeer}
+	conn.in <- packet{b: []byte("garbage"), addr: testPeer}
+	// Unbuffered: the packets before were read once this one is
+	// accepted.
+	conn.in <- packet{b: []byte("garbage"), addr: testPeer}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(s.Leases(HistoryQuery{})) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("ServeContext() = %v, want %v", err, context.Canceled)
+	}
+
+	dropped := s.DumpState().Dropped
+	if dropped[dropClientRate] != 1 || dropped[dropMalformed] < 2 {
+		t.Errorf("dropped %v, want 1 over the client rate limit and at least 2 malformed", dropped)
+	}
+	if n := strings.Count(buf.String(), "Invalid DHCP packet"); n != 1 {
+		t.Errorf("logged %d malformed packets, want 1:\n%s", n, buf.String())
+	}
+}
@@ -0,0 +1,42 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4server
+
+import (
+	"math"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+	"github.com/mergetb/dhcp4/dhcp4metrics"
+)
+
+// WithMetrics configures where the server reports the requests it receives,
+// the responses it sends and the durations of the leases it grants.
+// dhcp4metrics.Registry exposes them to Prometheus. A nil m reports
+// nothing.
+func WithMetrics(m dhcp4metrics.Metrics) ServerOpt {
+	return func(s *Server) {
+		if m == nil {
+			m = dhcp4metrics.Discard
+		}
+		s.metrics = m
+	}
+}
+
+// infiniteLease is the lease time of leases that never expire, RFC 2131
+// Section 3.3.
+const infiniteLease = math.MaxUint32 * time.Second
+
+// observeResponse reports the sent response re to the server's Metrics.
+func (s *Server) observeResponse(re *dhcp4.Packet) {
+	typ := re.Options.MessageType()
+	s.metrics.MessageSent(typ)
+	if typ != dhcp4.DHCPACK {
+		return
+	}
+	if d := re.Options.LeaseTime(); d > 0 && d != infiniteLease {
+		s.metrics.Lease(d)
+	}
+}
@@ -0,0 +1,48 @@
+package dhcp4server
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+	"github.com/mergetb/dhcp4/dhcp4metrics"
+	"github.com/mergetb/dhcp4/dhcp4opts"
+)
+
+func TestMetrics(t *testing.T) {
+	r := dhcp4metrics.NewRegistry("dhcp_server")
+	s := newTestServer(t, WithMetrics(r), WithLeaseScheduler(func(context.Context, time.Time, Classification) LeaseDecision {
+		return LeaseDecision{LeaseTime: time.Hour}
+	}))
+	mac := net.HardwareAddr{2, 0, 0, 0, 0, 1}
+
+	offer := exchange(t, s, newRequest(dhcp4opts.DHCPDiscover, mac))
+	if offer == nil {
+		t.Fatal("no offer")
+	}
+	request := newRequest(dhcp4opts.DHCPRequest, mac)
+	request.Options.SetRequestedIPAddress(offer.YIAddr)
+	request.Options.SetServerIdentifier(s.ServerID())
+	if ack := exchange(t, s, request); ack == nil || ack.Options.MessageType() != dhcp4.DHCPACK {
+		t.Fatalf("response to REQUEST = %v, want ACK", ack)
+	}
+
+	var b bytes.Buffer
+	r.WriteTo(&b)
+	for _, want := range []string{
+		`dhcp_server_messages_received_total{type="DHCPDISCOVER"} 1`,
+		`dhcp_server_messages_received_total{type="DHCPREQUEST"} 1`,
+		`dhcp_server_messages_sent_total{type="DHCPOFFER"} 1`,
+		`dhcp_server_messages_sent_total{type="DHCPACK"} 1`,
+		`dhcp_server_lease_duration_seconds_bucket{le="3600"} 1`,
+		`dhcp_server_lease_duration_seconds_count 1`,
+	} {
+		if !strings.Contains(b.String(), want+"\n") {
+			t.Errorf("metrics do not contain %q:\n%s", want, b.String())
+		}
+	}
+}
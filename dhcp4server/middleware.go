@@ -0,0 +1,204 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4server
+
+import (
+	"container/list"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+	"github.com/mergetb/dhcp4/fingerprint"
+)
+
+// Middleware wraps a Handler to inspect, drop or rewrite requests and
+// responses, e.g. to enforce policy, without changing the handler itself.
+// Middlewares must not modify requests; they may modify responses.
+type Middleware func(next Handler) Handler
+
+// Chain returns h wrapped by mws. The first middleware sees requests first
+// and responses last.
+func Chain(h Handler, mws ...Middleware) Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
+// WithMiddleware makes the server run requests through mws before handling
+// them, as Chain does. Middlewares run without the server's lock held, so
+// they may call its methods. Explain does not run them.
+//
+// Default is no middleware.
+func WithMiddleware(mws ...Middleware) ServerOpt {
+	return func(s *Server) {
+		s.middleware = append(s.middleware, mws...)
+	}
+}
+
+// Logging returns a middleware logging every request and its response to
+// logger.
+func Logging(logger *log.Logger) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(req *dhcp4.Packet, peer net.Addr) *dhcp4.Packet {
+			start := time.Now()
+			re := next.ServeDHCP(req, peer)
+			if re == nil {
+				logger.Printf("%v from %v (%v): no response (%v)", req.Options.MessageType(), req.HardwareAddr(), peer, time.Since(start))
+			} else {
+				logger.Printf("%v from %v (%v): %v of %v (%v)", req.Options.MessageType(), req.HardwareAddr(), peer, re.Options.MessageType(), re.YIAddr, time.Since(start))
+			}
+			return re
+		})
+	}
+}
+
+// maxRateLimited is the number of clients a rate limiter tracks. Beyond it,
+// the client seen least recently is forgotten, so that a flood of made-up
+// hardware addresses costs bounded memory and constant time per request.
+const maxRateLimited = 4096
+
+// RateLimit returns a middleware dropping requests of clients sending more
+// than burst requests at once, or more than rate per second in the long
+// run. Clients are told apart by hardware address.
+func RateLimit(rate float64, burst int) Middleware {
+	rl := newRateLimiter(rate, burst)
+	return func(next Handler) Handler {
+		return HandlerFunc(func(req *dhcp4.Packet, peer net.Addr) *dhcp4.Packet {
+			if !rl.allow(req.HardwareAddr().String(), time.Now()) {
+				return nil
+			}
+			return next.ServeDHCP(req, peer)
+		})
+	}
+}
+
+// rateLimiter is a token bucket per client, for the maxRateLimited clients
+// seen most recently.
+type rateLimiter struct {
+	rate, burst float64
+
+	mu      sync.Mutex
+	buckets map[string]*list.Element
+
+	// lru holds the *bucket of every client, the one seen most recently
+	// first.
+	lru *list.List
+}
+
+type bucket struct {
+	client string
+	tokens float64
+	last   time.Time
+}
+
+// allow takes a token from the bucket of client and returns true, or returns
+// false if it is empty.
+func (rl *rateLimiter) allow(client string, now time.Time) bool {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	var b *bucket
+	if e, ok := rl.buckets[client]; ok {
+		rl.lru.MoveToFront(e)
+		b = e.Value.(*bucket)
+	} else {
+		if rl.lru.Len() >= maxRateLimited {
+			oldest := rl.lru.Back()
+			rl.lru.Remove(oldest)
+			delete(rl.buckets, oldest.Value.(*bucket).client)
+		}
+		b = &bucket{client: client, tokens: rl.burst, last: now}
+		rl.buckets[client] = rl.lru.PushFront(b)
+	}
+	b.tokens += now.Sub(b.last).Seconds() * rl.rate
+	if b.tokens > rl.burst {
+		b.tokens = rl.burst
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// TrustRelayAgentInfo returns a middleware dropping requests carrying
+// relay agent information (option 82) that did not come through a trusted
+// relay agent: those without a relay agent address, which RFC 3046, Section
+// 2.1.1 asks servers to drop, and, if trusted is not empty, those relayed by
+// agents outside the trusted networks. Policy based on option 82, e.g.
+// the switch port of a client, can then not be spoofed by clients.
+func TrustRelayAgentInfo(trusted ...*net.IPNet) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(req *dhcp4.Packet, peer net.Addr) *dhcp4.Packet {
+			if req.Options.Get(dhcp4.OptionRelayAgentInformation) == nil {
+				return next.ServeDHCP(req, peer)
+			}
+			if unspecified(req.GIAddr) {
+				return nil
+			}
+			if len(trusted) == 0 {
+				return next.ServeDHCP(req, peer)
+			}
+			for _, n := range trusted {
+				if n.Contains(req.GIAddr) {
+					return next.ServeDHCP(req, peer)
+				}
+			}
+			return nil
+		})
+	}
+}
+
+// AllowHardwareAddrs returns a middleware dropping requests of clients
+// whose hardware address is not in hws.
+func AllowHardwareAddrs(hws ...net.HardwareAddr) Middleware {
+	return hardwareAddrFilter(hws, true)
+}
+
+// DenyHardwareAddrs returns a middleware dropping requests of clients whose
+// hardware address is in hws.
+func DenyHardwareAddrs(hws ...net.HardwareAddr) Middleware {
+	return hardwareAddrFilter(hws, false)
+}
+
+// hardwareAddrFilter returns a middleware passing requests of clients with
+// a hardware address in hws if allow, or not in hws otherwise.
+func hardwareAddrFilter(hws []net.HardwareAddr, allow bool) Middleware {
+	set := make(map[string]bool, len(hws))
+	for _, hw := range hws {
+		set[hw.String()] = true
+	}
+	return func(next Handler) Handler {
+		return HandlerFunc(func(req *dhcp4.Packet, peer net.Addr) *dhcp4.Packet {
+			if set[req.HardwareAddr().String()] != allow {
+				return nil
+			}
+			return next.ServeDHCP(req, peer)
+		})
+	}
+}
+
+// ByDevice returns a middleware running requests through the middleware of
+// the device db identifies the client as from its fingerprint, e.g. to
+// serve BMCs, OS installers and switches differently, and requests of
+// other devices through none.
+func ByDevice(db fingerprint.Database, mws map[fingerprint.Device]Middleware) Middleware {
+	return func(next Handler) Handler {
+		handlers := make(map[fingerprint.Device]Handler, len(mws))
+		for dev, mw := range mws {
+			handlers[dev] = mw(next)
+		}
+		return HandlerFunc(func(req *dhcp4.Packet, peer net.Addr) *dhcp4.Packet {
+			if h, ok := handlers[db.Identify(fingerprint.Of(req))]; ok {
+				return h.ServeDHCP(req, peer)
+			}
+			return next.ServeDHCP(req, peer)
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package dhcp4server
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+	"github.com/mergetb/dhcp4/dhcp4opts"
+	"github.com/mergetb/dhcp4/fingerprint"
+)
+
+func TestChain(t *testing.T) {
+	var calls []string
+	mw := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return HandlerFunc(func(req *dhcp4.Packet, peer net.Addr) *dhcp4.Packet {
+				calls = append(calls, name)
+				return next.ServeDHCP(req, peer)
+			})
+		}
+	}
+	h := Chain(HandlerFunc(func(req *dhcp4.Packet, peer net.Addr) *dhcp4.Packet {
+		calls = append(calls, "handler")
+		return req
+	}), mw("first"), mw("second"))
+
+	if h.ServeDHCP(dhcp4.NewPacket(dhcp4.BootRequest), testPeer) == nil {
+		t.Errorf("ServeDHCP() = nil, want the handler's response")
+	}
+	if want := []string{"first", "second", "handler"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+}
+
+func TestWithMiddleware(t *testing.T) {
+	denied := net.HardwareAddr{2, 0, 0, 0, 0, 1}
+	s := newTestServer(t, WithMiddleware(DenyHardwareAddrs(denied)))
+
+	if re := exchange(t, s, newRequest(dhcp4opts.DHCPDiscover, denied)); re != nil {
+		t.Errorf("denied client got %v, want no response", re)
+	}
+	if re := exchange(t, s, newRequest(dhcp4opts.DHCPDiscover, net.HardwareAddr{2, 0, 0, 0, 0, 2})); re == nil {
+		t.Errorf("other client got no response")
+	}
+}
+
+func TestHardwareAddrFilters(t *testing.T) {
+	listed := net.HardwareAddr{2, 0, 0, 0, 0, 1}
+	other := net.HardwareAddr{2, 0, 0, 0, 0, 2}
+	echo := HandlerFunc(func(req *dhcp4.Packet, peer net.Addr) *dhcp4.Packet { return req })
+
+	for _, tt := range []struct {
+		name string
+		mw   Middleware
+		hw   net.HardwareAddr
+		want bool
+	}{
+		{name: "allowed", mw: AllowHardwareAddrs(listed), hw: listed, want: true},
+		{name: "not allowed", mw: AllowHardwareAddrs(listed), hw: other},
+		{name: "denied", mw: DenyHardwareAddrs(listed), hw: listed},
+		{name: "not denied", mw: DenyHardwareAddrs(listed), hw: other, want: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			req := newRequest(dhcp4opts.DHCPDiscover, tt.hw)
+			if got := tt.mw(echo).ServeDHCP(req, testPeer) != nil; got != tt.want {
+				t.Errorf("served = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	rl := newRateLimiter(1, 2)
+	now := time.Now()
+	for i, tt := range []struct {
+		client string
+		at     time.Duration
+		want   bool
+	}{
+		{client: "a", want: true},
+		{client: "a", want: true},
+		{client: "a", want: false},
+		{client: "b", want: true},
+		{client: "a", at: 500 * time.Millisecond, want: false},
+		{client: "a", at: time.Second, want: true},
+		{client: "a", at: time.Second, want: false},
+	} {
+		if got := rl.allow(tt.client, now.Add(tt.at)); got != tt.want {
+			t.Errorf("request %d of %s at %v: allow() = %v, want %v", i, tt.client, tt.at, got, tt.want)
+		}
+	}
+}
+
+func TestRateLimitBounded(t *testing.T) {
+	rl := newRateLimiter(1, 1)
+	now := time.Now()
+	if !rl.allow("limited", now) || rl.allow("limited", now) {
+		t.Fatal("client not limited after its burst")
+	}
+	// A flood of made-up hardware addresses.
+	for i := 0; i < 3*maxRateLimited; i++ {
+		mac := net.HardwareAddr{2, 0, byte(i >> 16), byte(i >> 8), byte(i), 0}
+		if !rl.allow(mac.String(), now) {
+			t.Fatalf("first request of %v limited", mac)
+		}
+		if n := rl.lru.Len(); n > maxRateLimited || len(rl.buckets) != n {
+			t.Fatalf("tracking %d buckets in %d entries, want at most %d", len(rl.buckets), n, maxRateLimited)
+		}
+	}
+	// The least recently seen clients were forgotten.
+	if _, ok := rl.buckets["limited"]; ok {
+		t.Error("bucket of the client seen least recently kept")
+	}
+	if !rl.allow("limited", now) {
+		t.Error("forgotten client limited")
+	}
+}
+
+func TestTrustRelayAgentInfo(t *testing.T) {
+	_, relays, err := net.ParseCIDR("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	echo := HandlerFunc(func(req *dhcp4.Packet, peer net.Addr) *dhcp4.Packet { return req })
+
+	for _, tt := range []struct {
+		name    string
+		trusted []*net.IPNet
+		giaddr  net.IP
+		info    bool
+		want    bool
+	}{
+		{name: "no option 82", want: true},
+		{name: "option 82 without relay", info: true},
+		{name: "option 82 from any relay", giaddr: net.IP{192, 168, 0, 1}, info: true, want: true},
+		{name: "option 82 from trusted relay", trusted: []*net.IPNet{relays}, giaddr: net.IP{10, 0, 0, 1}, info: true, want: true},
+		{name: "option 82 from untrusted relay", trusted: []*net.IPNet{relays}, giaddr: net.IP{192, 168, 0, 1}, info: true},
+		{name: "untrusted relay without option 82", trusted: []*net.IPNet{relays}, giaddr: net.IP{192, 168, 0, 1}, want: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			req := newRequest(dhcp4opts.DHCPDiscover, net.HardwareAddr{2, 0, 0, 0, 0, 1})
+			req.GIAddr = tt.giaddr
+			if tt.info {
+				req.Options.SetRelayAgentInfo(&dhcp4.RelayAgentInfo{CircuitID: []byte("port1")})
+			}
+			if got := TrustRelayAgentInfo(tt.trusted...)(echo).ServeDHCP(req, testPeer) != nil; got != tt.want {
+				t.Errorf("served = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestByDevice(t *testing.T) {
+	echo := HandlerFunc(func(req *dhcp4.Packet, peer net.Addr) *dhcp4.Packet { return req })
+	drop := func(next Handler) Handler {
+		return HandlerFunc(func(req *dhcp4.Packet, peer net.Addr) *dhcp4.Packet { return nil })
+	}
+	h := ByDevice(fingerprint.Default, map[fingerprint.Device]Middleware{
+		fingerprint.Windows: drop,
+	})(echo)
+
+	for _, tt := range []struct {
+		vendorClass string
+		want        bool
+	}{
+		{vendorClass: "MSFT 5.0"},
+		{vendorClass: "PXEClient:Arch:00000:UNDI:002001", want: true},
+		{vendorClass: "", want: true},
+	} {
+		req := newRequest(dhcp4opts.DHCPDiscover, net.HardwareAddr{2, 0, 0, 0, 0, 1})
+		if tt.vendorClass != "" {
+			req.Options.AddRaw(dhcp4.OptionVendorClassIdentifier, []byte(tt.vendorClass))
+		}
+		if got := h.ServeDHCP(req, testPeer) != nil; got != tt.want {
+			t.Errorf("%q: served = %v, want %v", tt.vendorClass, got, tt.want)
+		}
+	}
+}
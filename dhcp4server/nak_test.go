@@ -0,0 +1,143 @@
+package dhcp4server
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+	"github.com/mergetb/dhcp4/dhcp4opts"
+)
+
+func TestRequestNAK(t *testing.T) {
+	hour := WithLeaseScheduler(func(context.Context, time.Time, Classification) LeaseDecision {
+		return LeaseDecision{LeaseTime: time.Hour}
+	})
+	mac := net.HardwareAddr{2, 0, 0, 0, 0, 1}
+
+	// renewal returns the REQUEST of the client renewing its lease on ip.
+	renewal := func(ip net.IP) *dhcp4.Packet {
+		p := newRequest(dhcp4opts.DHCPRequest, mac)
+		p.TransactionID = [4]byte{5, 6, 7, 8}
+		p.CIAddr = ip
+		return p
+	}
+
+	for _, tt := range []struct {
+		name    string
+		opts    []ServerOpt
+		request func(s *Server, ip net.IP) *dhcp4.Packet
+		want    string
+	}{
+		{
+			name:    "renewal",
+			request: func(s *Server, ip net.IP) *dhcp4.Packet { return renewal(ip) },
+		},
+		{
+			name: "expired",
+			opts: []ServerOpt{hour},
+			request: func(s *Server, ip net.IP) *dhcp4.Packet {
+				s.mu.Lock()
+				s.expireLeases(context.Background(), time.Now().Add(2*time.Hour))
+				s.mu.Unlock()
+				// Selecting the server's offer.
+				p := newRequest(dhcp4opts.DHCPRequest, mac)
+				p.Options.SetRequestedIPAddress(ip)
+				p.Options.SetServerIdentifier(s.ServerID())
+				return p
+			},
+			want: "no binding",
+		},
+		{
+			name:    "other address",
+			request: func(s *Server, ip net.IP) *dhcp4.Packet { return renewal(net.IP{192, 168, 1, 200}) },
+			want:    "address not bound to the client",
+		},
+		{
+			name: "wrong network",
+			opts: []ServerOpt{WithSubnets(Subnet{Network: &net.IPNet{IP: net.IP{10, 1, 0, 0}, Mask: net.CIDRMask(24, 32)}})},
+			request: func(s *Server, ip net.IP) *dhcp4.Packet {
+				p := newRequest(dhcp4opts.DHCPRequest, mac)
+				p.Options.SetRequestedIPAddress(net.IP{10, 1, 0, 5})
+				return p
+			},
+			want: "wrong network",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, tt.opts...)
+			events, cancel := s.Subscribe(10)
+			ip := bind(t, s, mac, "")
+
+			reply := exchange(t, s, tt.request(s, ip))
+			if reply == nil {
+				t.Fatal("no reply")
+			}
+			if tt.want == "" {
+				if reply.Options.MessageType() != dhcp4.DHCPACK || !reply.YIAddr.Equal(ip) {
+					t.Errorf("reply = %v, want ACK of %v", reply, ip)
+				}
+				return
+			}
+			if reply.Options.MessageType() != dhcp4.DHCPNAK {
+				t.Fatalf("reply = %v, want NAK", reply)
+			}
+			if got := reply.Options.Message(); got != tt.want {
+				t.Errorf("NAK message = %q, want %q", got, tt.want)
+			}
+
+			cancel()
+			var kinds []LeaseEventKind
+			for ev := range events {
+				kinds = append(kinds, ev.Kind)
+			}
+			if tt.name == "expired" && (len(kinds) != 2 || kinds[1] != LeaseExpired) {
+				t.Errorf("events = %v, want allocated and expired", kinds)
+			}
+		})
+	}
+}
+
+func TestRequestSilent(t *testing.T) {
+	hour := WithLeaseScheduler(func(context.Context, time.Time, Classification) LeaseDecision {
+		return LeaseDecision{LeaseTime: time.Hour}
+	})
+	mac := net.HardwareAddr{2, 0, 0, 0, 0, 1}
+
+	t.Run("other server", func(t *testing.T) {
+		s := newTestServer(t)
+		offer := exchange(t, s, newRequest(dhcp4opts.DHCPDiscover, mac))
+		if offer == nil {
+			t.Fatal("no offer")
+		}
+		req := newRequest(dhcp4opts.DHCPRequest, mac)
+		req.Options.SetRequestedIPAddress(net.IP{192, 168, 1, 10})
+		req.Options.SetServerIdentifier(net.IP{192, 168, 0, 2})
+		if reply := exchange(t, s, req); reply != nil {
+			t.Errorf("REQUEST for another server got %v, want no reply", reply.Options.MessageType())
+		}
+		if ip := s.getIP(keyOf(t, s, mac)); ip != nil {
+			t.Errorf("offer of %v still pending after the client chose another server", ip)
+		}
+	})
+
+	t.Run("no binding", func(t *testing.T) {
+		s := newTestServer(t, hour)
+		ip := bind(t, s, mac, "")
+		s.mu.Lock()
+		s.expireLeases(context.Background(), time.Now().Add(2*time.Hour))
+		s.mu.Unlock()
+
+		reboot := newRequest(dhcp4opts.DHCPRequest, mac)
+		reboot.Options.SetRequestedIPAddress(ip)
+		renewal := newRequest(dhcp4opts.DHCPRequest, mac)
+		renewal.TransactionID = [4]byte{5, 6, 7, 8}
+		renewal.CIAddr = ip
+		for _, req := range []*dhcp4.Packet{reboot, renewal} {
+			if reply := exchange(t, s, req); reply != nil {
+				t.Errorf("REQUEST without binding got %v, want no reply", reply.Options.MessageType())
+			}
+		}
+	})
+}
@@ -0,0 +1,85 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4server
+
+import (
+	"context"
+	"net"
+	"sort"
+	"time"
+)
+
+// WithOfferHold configures how long an address offered to a new client is
+// held for it. If the client does not request it in time, the address is
+// freed for other clients. Until then, no other client is offered it.
+//
+// Default is 30 seconds.
+func WithOfferHold(d time.Duration) ServerOpt {
+	return func(s *Server) {
+		s.offerHold = d
+	}
+}
+
+// PendingOffer is an address offered to a client that has not requested it
+// yet.
+type PendingOffer struct {
+	IP           string    `json:"ip"`
+	HardwareAddr string    `json:"hardware_addr"`
+	Offered      time.Time `json:"offered"`
+
+	// Expires is when the address is freed unless the client requests
+	// it.
+	Expires time.Time `json:"expires"`
+}
+
+// pendingOffer is an address bound to a client to offer it.
+type pendingOffer struct {
+	ip               net.IP
+	hwAddr           net.HardwareAddr
+	offered, expires time.Time
+}
+
+// holdOffer records that ip was bound to the client key at now to offer it.
+//
+// s.mu must be held.
+func (s *Server) holdOffer(key bindingKey, ip net.IP, hwAddr net.HardwareAddr, now time.Time) {
+	if s.offers == nil {
+		s.offers = make(map[bindingKey]pendingOffer)
+	}
+	o, ok := s.offers[key]
+	if !ok || !o.ip.Equal(ip) {
+		o = pendingOffer{ip: ip, hwAddr: hwAddr, offered: now}
+	}
+	o.expires = now.Add(s.offerHold)
+	s.offers[key] = o
+}
+
+// expireOffers releases the addresses of offers not requested in time.
+//
+// s.mu must be held.
+func (s *Server) expireOffers(ctx context.Context, now time.Time) {
+	for key, o := range s.offers {
+		if !now.Before(o.expires) {
+			s.release(ctx, key, LeaseExpired)
+		}
+	}
+}
+
+// pendingOffers returns the pending offers, the one expiring first first.
+//
+// s.mu must be held.
+func (s *Server) pendingOffers() []PendingOffer {
+	ps := make([]PendingOffer, 0, len(s.offers))
+	for _, o := range s.offers {
+		ps = append(ps, PendingOffer{
+			IP:           o.ip.String(),
+			HardwareAddr: o.hwAddr.String(),
+			Offered:      o.offered,
+			Expires:      o.expires,
+		})
+	}
+	sort.Slice(ps, func(i, j int) bool { return ps[i].Expires.Before(ps[j].Expires) })
+	return ps
+}
@@ -0,0 +1,71 @@
+package dhcp4server
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+	"github.com/mergetb/dhcp4/dhcp4opts"
+)
+
+func TestOfferHold(t *testing.T) {
+	_, subnet, err := net.ParseCIDR("192.168.1.0/31")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newTestServer(t, WithLeases(NewMemoryLeases(subnet)))
+	a := net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 1}
+	b := net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 2}
+	c := net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 3}
+
+	offerA := exchange(t, s, newRequest(dhcp4opts.DHCPDiscover, a))
+	offerB := exchange(t, s, newRequest(dhcp4opts.DHCPDiscover, b))
+	if offerA == nil || offerB == nil {
+		t.Fatalf("got offers %v, %v, want two", offerA, offerB)
+	}
+	if offerA.YIAddr.Equal(offerB.YIAddr) {
+		t.Errorf("offered %v to both clients", offerA.YIAddr)
+	}
+	if offer := exchange(t, s, newRequest(dhcp4opts.DHCPDiscover, c)); offer != nil {
+		t.Errorf("offered %v with all addresses held", offer.YIAddr)
+	}
+	if got := s.DumpState().Leases.PendingOffers; len(got) != 2 {
+		t.Errorf("pending offers %+v, want 2", got)
+	}
+
+	req := newRequest(dhcp4opts.DHCPRequest, a)
+	req.Options.Add(dhcp4.OptionRequestedIPAddress, dhcp4opts.IP(offerA.YIAddr))
+	if ack := exchange(t, s, req); ack == nil || dhcp4opts.GetDHCPMessageType(ack.Options) != dhcp4opts.DHCPACK {
+		t.Fatalf("REQUEST of %v got %v, want ACK", offerA.YIAddr, ack)
+	}
+	got := s.DumpState().Leases.PendingOffers
+	if len(got) != 1 || got[0].IP != offerB.YIAddr.String() {
+		t.Errorf("pending offers %+v after A's REQUEST, want only B's", got)
+	}
+
+	// B never requests its offer, so it goes to C once the hold expires.
+	s.mu.Lock()
+	s.expireOffers(context.Background(), time.Now().Add(time.Minute))
+	s.mu.Unlock()
+	if _, ok := s.leases.Lookup(string(keyOf(t, s, b))); ok {
+		t.Errorf("B is still bound after its offer expired")
+	}
+	if _, ok := s.leases.Lookup(string(keyOf(t, s, a))); !ok {
+		t.Errorf("A lost its lease when B's offer expired")
+	}
+	offerC := exchange(t, s, newRequest(dhcp4opts.DHCPDiscover, c))
+	if offerC == nil || !offerC.YIAddr.Equal(offerB.YIAddr) {
+		t.Errorf("C was offered %v, want %v", offerC, offerB.YIAddr)
+	}
+}
+
+// keyOf returns the binding key of the client mac.
+func keyOf(t *testing.T, s *Server, mac net.HardwareAddr) bindingKey {
+	key, ok := s.keyPolicy.requestKey(newRequest(dhcp4opts.DHCPDiscover, mac))
+	if !ok {
+		t.Fatalf("no binding key for %v", mac)
+	}
+	return key
+}
@@ -0,0 +1,53 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4server
+
+import (
+	"sync"
+
+	"github.com/mergetb/dhcp4"
+	"github.com/mergetb/dhcp4/dhcp4opts"
+)
+
+// optionCache keeps pre-encoded option blocks shared by responses, so that
+// option sets common to many clients are encoded once rather than for every
+// response.
+type optionCache struct {
+	mu     sync.Mutex
+	blocks map[string]*dhcp4.EncodedOptions
+}
+
+// get returns the block for key, encoding the options returned by build if
+// it is not cached yet.
+func (oc *optionCache) get(key string, build func() dhcp4.Options) *dhcp4.EncodedOptions {
+	oc.mu.Lock()
+	defer oc.mu.Unlock()
+	if b, ok := oc.blocks[key]; ok {
+		return b
+	}
+	if oc.blocks == nil {
+		oc.blocks = make(map[string]*dhcp4.EncodedOptions)
+	}
+	b := dhcp4.EncodeOptions(build())
+	oc.blocks[key] = b
+	return b
+}
+
+// serverOptionsKey is the cache key of the options sent in every response.
+const serverOptionsKey = "server"
+
+// serverOptions returns the options the server sends in every response.
+func (s *Server) serverOptions() dhcp4.Options {
+	o := make(dhcp4.Options)
+	o.Add(dhcp4.OptionServerIdentifier, dhcp4opts.IP(s.ServerID()))
+	// Optional.
+	o.Add(dhcp4.OptionMaximumDHCPMessageSize, dhcp4opts.Uint16(maxMessageSize))
+	return o
+}
+
+// sharedOptions returns the pre-encoded options sent in every response.
+func (s *Server) sharedOptions() *dhcp4.EncodedOptions {
+	return s.options.get(serverOptionsKey, s.serverOptions)
+}
@@ -0,0 +1,183 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// ShrinkPolicy selects what ResizePool does with bindings outside the new
+// pool.
+type ShrinkPolicy uint8
+
+const (
+	// ShrinkRefuse leaves the pool unchanged if any binding would be
+	// outside the new pool.
+	ShrinkRefuse ShrinkPolicy = iota
+
+	// ShrinkDrain resizes the pool and drains the bindings outside of it:
+	// their clients keep their addresses until they renew them, which the
+	// server answers with a NAK, so that they restart and get an address
+	// from the new pool.
+	ShrinkDrain
+)
+
+// ErrNotResizable is returned by ResizePool if the server's Leases are not
+// ResizableLeases.
+var ErrNotResizable = errors.New("leases do not support resizing the pool")
+
+// StrandedError is returned by ResizePool if it refused to resize the pool
+// because of bindings outside the new pool.
+type StrandedError struct {
+	// Pool is the refused pool.
+	Pool *net.IPNet
+
+	// Bindings are the bindings outside Pool.
+	Bindings []Binding
+}
+
+// Error implements error.
+func (se *StrandedError) Error() string {
+	return fmt.Sprintf("%d bindings are outside pool %v", len(se.Bindings), se.Pool)
+}
+
+// Pool returns the subnet addresses are allocated from, or nil if the
+// server's Leases are not ResizableLeases.
+func (s *Server) Pool() *net.IPNet {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if rl, ok := s.local.(ResizableLeases); ok {
+		return rl.Pool()
+	}
+	return nil
+}
+
+// ResizePool makes the server allocate addresses from subnet from now on,
+// e.g. to grow or shrink the pool of an elastic testbed without a restart.
+//
+// It returns the bindings outside subnet, ordered by address. If there are
+// any and policy is ShrinkRefuse, the pool is left unchanged and the error
+// is a *StrandedError.
+func (s *Server) ResizePool(subnet *net.IPNet, policy ShrinkPolicy) ([]Binding, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rl, ok := s.local.(ResizableLeases)
+	if !ok {
+		return nil, ErrNotResizable
+	}
+	outside := s.bindingsOutside(subnet)
+	if len(outside) > 0 && policy == ShrinkRefuse {
+		return outside, &StrandedError{Pool: subnet, Bindings: outside}
+	}
+	if err := rl.Resize(subnet); err != nil {
+		return nil, err
+	}
+	return outside, nil
+}
+
+// bindingsOutside returns the bindings outside pool, ordered by address.
+//
+// s.mu must be held.
+func (s *Server) bindingsOutside(pool *net.IPNet) []Binding {
+	var outside []Binding
+	for _, b := range s.local.All() {
+		if !pool.Contains(b.IP) {
+			outside = append(outside, b)
+		}
+	}
+	sort.Slice(outside, func(i, j int) bool {
+		return bytes.Compare(outside[i].IP.To4(), outside[j].IP.To4()) < 0
+	})
+	return outside
+}
+
+// draining returns whether ip is bound outside the pool, see ShrinkDrain.
+//
+// s.mu must be held.
+func (s *Server) draining(ip net.IP) bool {
+	rl, ok := s.local.(ResizableLeases)
+	return ok && ip != nil && !rl.Pool().Contains(ip) && s.subnetContaining(ip) == nil
+}
+
+// poolJSON is the admin API representation of the pool.
+type poolJSON struct {
+	Pool string `json:"pool"`
+
+	// Outside are the bindings outside the pool, which are draining or
+	// stranded.
+	Outside []leaseJSON `json:"outside"`
+}
+
+func newPoolJSON(pool *net.IPNet, outside []Binding) poolJSON {
+	pj := poolJSON{Pool: pool.String(), Outside: []leaseJSON{}}
+	for _, b := range outside {
+		pj.Outside = append(pj.Outside, newLeaseJSON(b.record(time.Time{})))
+	}
+	return pj
+}
+
+func (s *Server) servePool(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.mu.Lock()
+		rl, ok := s.local.(ResizableLeases)
+		if !ok {
+			s.mu.Unlock()
+			http.Error(w, ErrNotResizable.Error(), http.StatusNotImplemented)
+			return
+		}
+		pool := rl.Pool()
+		outside := s.bindingsOutside(pool)
+		s.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(newPoolJSON(pool, outside))
+
+	case http.MethodPost:
+		q := r.URL.Query()
+		_, subnet, err := net.ParseCIDR(q.Get("subnet"))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid subnet %q: %v", q.Get("subnet"), err), http.StatusBadRequest)
+			return
+		}
+		policy := ShrinkRefuse
+		if v := q.Get("drain"); v != "" {
+			drain, err := strconv.ParseBool(v)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("invalid drain %q", v), http.StatusBadRequest)
+				return
+			}
+			if drain {
+				policy = ShrinkDrain
+			}
+		}
+
+		outside, err := s.ResizePool(subnet, policy)
+		status := http.StatusOK
+		if _, ok := err.(*StrandedError); ok {
+			status = http.StatusConflict
+		} else if err == ErrNotResizable {
+			http.Error(w, err.Error(), http.StatusNotImplemented)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(newPoolJSON(subnet, outside))
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,143 @@
+package dhcp4server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mergetb/dhcp4"
+	"github.com/mergetb/dhcp4/dhcp4opts"
+)
+
+func TestResizePool(t *testing.T) {
+	s := newTestServer(t)
+	a := net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 1}
+	b := net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 2}
+	for _, mac := range []net.HardwareAddr{a, b} {
+		if offer := exchange(t, s, newRequest(dhcp4opts.DHCPDiscover, mac)); offer == nil {
+			t.Fatalf("no offer for %v", mac)
+		}
+	}
+
+	_, upper, _ := net.ParseCIDR("192.168.1.128/25")
+	outside, err := s.ResizePool(upper, ShrinkRefuse)
+	if _, ok := err.(*StrandedError); !ok || len(outside) != 2 {
+		t.Fatalf("ResizePool(%v, ShrinkRefuse) = %d bindings, %v; want 2 stranded", upper, len(outside), err)
+	}
+	if pool := s.Pool(); pool.String() != "192.168.1.0/24" {
+		t.Errorf("Pool() after refused shrink = %v, want 192.168.1.0/24", pool)
+	}
+
+	if outside, err := s.ResizePool(upper, ShrinkDrain); err != nil || len(outside) != 2 {
+		t.Fatalf("ResizePool(%v, ShrinkDrain) = %d bindings, %v; want 2 draining", upper, len(outside), err)
+	}
+
+	// a restarts and moves into the new pool.
+	offer := exchange(t, s, newRequest(dhcp4opts.DHCPDiscover, a))
+	if offer == nil || !upper.Contains(offer.YIAddr) {
+		t.Errorf("offer to draining client = %v, want address in %v", offer, upper)
+	}
+
+	// b renews its old address and is told to restart.
+	old := s.getIP(bindingKey("hw:" + string(b)))
+	req := newRequest(dhcp4opts.DHCPRequest, b)
+	req.Options[dhcp4.OptionRequestedIPAddress] = old
+	if nak := exchange(t, s, req); nak == nil || dhcp4opts.GetDHCPMessageType(nak.Options) != dhcp4opts.DHCPNAK {
+		t.Errorf("reply to renewal of draining %v = %v, want NAK", old, nak)
+	}
+	if ip := s.getIP(bindingKey("hw:" + string(b))); ip != nil {
+		t.Errorf("draining binding of %v still bound to %v after NAK", b, ip)
+	}
+	if n := s.history.Len(); n != 2 {
+		t.Errorf("history has %d leases after draining, want 2", n)
+	}
+}
+
+func TestResizePoolNotResizable(t *testing.T) {
+	s := newTestServer(t, WithLeases(struct{ Leases }{NewMemoryLeases(nil)}))
+	_, subnet, _ := net.ParseCIDR("192.168.2.0/24")
+	if _, err := s.ResizePool(subnet, ShrinkDrain); err != ErrNotResizable {
+		t.Errorf("ResizePool() = %v, want %v", err, ErrNotResizable)
+	}
+}
+
+func TestFileLeasesOutsidePool(t *testing.T) {
+	dir, err := ioutil.TempDir("", "leases")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "leases.json")
+	_, subnet, _ := net.ParseCIDR("192.168.1.0/24")
+	_, upper, _ := net.ParseCIDR("192.168.1.128/25")
+
+	l, err := OpenFileLeases(path, subnet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ip := net.IP{192, 168, 1, 20}
+	if _, err := l.Allocate(Binding{Key: "a", HardwareAddr: net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 1}}, ip); err != nil {
+		t.Fatal(err)
+	}
+
+	// Restart with the shrunk pool.
+	reopened, err := OpenFileLeases(path, upper)
+	if err != nil {
+		t.Fatalf("OpenFileLeases() with shrunk pool = %v", err)
+	}
+	if b, ok := reopened.Lookup("a"); !ok || !b.IP.Equal(ip) {
+		t.Errorf("Lookup() with shrunk pool = %+v, %v; want %v", b, ok, ip)
+	}
+	if _, err := reopened.Release("a"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := reopened.Allocate(Binding{Key: "b"}, ip); err != nil || !upper.Contains(got.IP) {
+		t.Errorf("Allocate(%v) after release = %v, %v; want address in %v", ip, got.IP, err, upper)
+	}
+}
+
+func TestAdminPool(t *testing.T) {
+	s := newTestServer(t)
+	exchange(t, s, newRequest(dhcp4opts.DHCPDiscover, net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 1}))
+
+	for _, tt := range []struct {
+		method     string
+		query      string
+		wantStatus int
+		wantPool   string
+		wantOut    int
+	}{
+		{method: "GET", wantStatus: http.StatusOK, wantPool: "192.168.1.0/24"},
+		{method: "POST", query: "?subnet=192.168.1.0/23", wantStatus: http.StatusOK, wantPool: "192.168.0.0/23"},
+		{method: "POST", query: "?subnet=192.168.1.128/25", wantStatus: http.StatusConflict, wantPool: "192.168.1.128/25", wantOut: 1},
+		{method: "GET", wantStatus: http.StatusOK, wantPool: "192.168.0.0/23"},
+		{method: "POST", query: "?subnet=192.168.1.128/25&drain=true", wantStatus: http.StatusOK, wantPool: "192.168.1.128/25", wantOut: 1},
+		{method: "GET", wantStatus: http.StatusOK, wantPool: "192.168.1.128/25", wantOut: 1},
+		{method: "POST", query: "?subnet=foo", wantStatus: http.StatusBadRequest},
+		{method: "POST", query: "?subnet=192.168.1.0/24&drain=maybe", wantStatus: http.StatusBadRequest},
+		{method: "DELETE", wantStatus: http.StatusMethodNotAllowed},
+	} {
+		rec := httptest.NewRecorder()
+		s.AdminHandler().ServeHTTP(rec, httptest.NewRequest(tt.method, "/pool"+tt.query, nil))
+		if rec.Code != tt.wantStatus {
+			t.Errorf("%s /pool%s = %d, want %d", tt.method, tt.query, rec.Code, tt.wantStatus)
+			continue
+		}
+		if tt.wantPool == "" {
+			continue
+		}
+
+		var pj poolJSON
+		if err := json.Unmarshal(rec.Body.Bytes(), &pj); err != nil {
+			t.Fatalf("%s /pool%s returned invalid JSON: %v", tt.method, tt.query, err)
+		}
+		if pj.Pool != tt.wantPool || len(pj.Outside) != tt.wantOut {
+			t.Errorf("%s /pool%s = pool %s with %d bindings outside, want %s with %d", tt.method, tt.query, pj.Pool, len(pj.Outside), tt.wantPool, tt.wantOut)
+		}
+	}
+}
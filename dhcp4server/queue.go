@@ -0,0 +1,219 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4server
+
+import (
+	"container/heap"
+	"context"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+)
+
+// WithWorkers configures the number of requests handled concurrently.
+//
+// Default is 1.
+func WithWorkers(n int) ServerOpt {
+	return func(s *Server) {
+		if n > 0 {
+			s.workers = n
+		}
+	}
+}
+
+// WithQueueSize configures how many requests wait for a worker at most.
+// When the queue is full, the request with the lowest priority is dropped.
+//
+// Default is 64.
+func WithQueueSize(n int) ServerOpt {
+	return func(s *Server) {
+		if n > 0 {
+			s.queueSize = n
+		}
+	}
+}
+
+// WithSecsPriority makes waiting requests be handled in order of the secs
+// field, i.e. how long clients report to have been trying, rather than in
+// order of arrival. When all workers are busy, e.g. while a whole testbed
+// reboots after an outage, the clients that were starved the longest are
+// served first, and the freshest are dropped first when the queue is full.
+func WithSecsPriority() ServerOpt {
+	return func(s *Server) {
+		s.secsPriority = true
+	}
+}
+
+// WithMessagePriority makes waiting requests be handled by message type
+// before anything else: renewals and rebindings first, then the other
+// requests of clients with an address or an offer (REQUESTs, RELEASEs,
+// DECLINEs and INFORMs), and DISCOVERs last. During a boot storm, clients
+// that are up keep their leases rather than expiring behind a flood of
+// DISCOVERs, and DISCOVERs are dropped first when the queue is full.
+//
+// Within a message type, requests are handled in order of arrival, or of
+// the secs field with WithSecsPriority.
+func WithMessagePriority() ServerOpt {
+	return func(s *Server) {
+		s.messagePriority = true
+	}
+}
+
+// Message priorities of WithMessagePriority, the most urgent first.
+const (
+	priorityRenewal = iota
+	priorityBound
+	priorityDiscover
+)
+
+// messagePriority returns the priority class of p.
+func messagePriority(p *dhcp4.Packet) int {
+	switch p.Options.MessageType() {
+	case dhcp4.DHCPDiscover:
+		return priorityDiscover
+	case dhcp4.DHCPRequest:
+		// RENEWING and REBINDING clients fill in ciaddr and send
+		// neither a server identifier nor a requested address, see RFC
+		// 2131 Section 4.3.2.
+		if !unspecified(p.CIAddr) && p.Options.ServerIdentifier() == nil && p.Options.RequestedIPAddress() == nil {
+			return priorityRenewal
+		}
+	}
+	return priorityBound
+}
+
+// queuedRequest is a request waiting for a worker.
+type queuedRequest struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	addr   net.Addr
+	pkt    *dhcp4.Packet
+
+	// conn is the conn the request was read from, and its response is
+	// sent through.
+	conn net.PacketConn
+
+	// seq is the arrival order.
+	seq uint64
+
+	// priority is the message priority class.
+	priority int
+
+	// queued is when the request was queued.
+	queued time.Time
+}
+
+// requestQueue is a bounded priority queue of requests.
+type requestQueue struct {
+	secsPriority    bool
+	messagePriority bool
+	max             int
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	reqs   []*queuedRequest
+	seq    uint64
+	closed bool
+}
+
+func newRequestQueue(max int, secsPriority, messagePriority bool) *requestQueue {
+	q := &requestQueue{
+		secsPriority:    secsPriority,
+		messagePriority: messagePriority,
+		max:             max,
+	}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// before returns whether a is handled before b.
+func (q *requestQueue) before(a, b *queuedRequest) bool {
+	if q.messagePriority && a.priority != b.priority {
+		return a.priority < b.priority
+	}
+	if q.secsPriority && a.pkt.Secs != b.pkt.Secs {
+		return a.pkt.Secs > b.pkt.Secs
+	}
+	return a.seq < b.seq
+}
+
+// Len, Less, Swap, Push and Pop implement heap.Interface. They must be
+// called with mu held.
+func (q *requestQueue) Len() int           { return len(q.reqs) }
+func (q *requestQueue) Less(i, j int) bool { return q.before(q.reqs[i], q.reqs[j]) }
+func (q *requestQueue) Swap(i, j int)      { q.reqs[i], q.reqs[j] = q.reqs[j], q.reqs[i] }
+
+func (q *requestQueue) Push(x interface{}) {
+	q.reqs = append(q.reqs, x.(*queuedRequest))
+}
+
+func (q *requestQueue) Pop() interface{} {
+	r := q.reqs[len(q.reqs)-1]
+	q.reqs = q.reqs[:len(q.reqs)-1]
+	return r
+}
+
+// push queues r. If the queue is full, it returns the request with the
+// lowest priority, which may be r, and drops it from the queue.
+func (q *requestQueue) push(r *queuedRequest) *queuedRequest {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.seq++
+	r.seq = q.seq
+	r.priority = messagePriority(r.pkt)
+	r.queued = time.Now()
+	heap.Push(q, r)
+	q.cond.Signal()
+	if len(q.reqs) <= q.max {
+		return nil
+	}
+
+	last := 0
+	for i := range q.reqs {
+		if q.before(q.reqs[last], q.reqs[i]) {
+			last = i
+		}
+	}
+	return heap.Remove(q, last).(*queuedRequest)
+}
+
+// pop waits for and returns the request with the highest priority. It
+// returns false once the queue is closed.
+func (q *requestQueue) pop() (*queuedRequest, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.reqs) == 0 && !q.closed {
+		q.cond.Wait()
+	}
+	if q.closed {
+		return nil, false
+	}
+	return heap.Pop(q).(*queuedRequest), true
+}
+
+// snapshot returns the queued requests in the order they will be handled.
+func (q *requestQueue) snapshot() []*queuedRequest {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	reqs := append([]*queuedRequest(nil), q.reqs...)
+	sort.Slice(reqs, func(i, j int) bool { return q.before(reqs[i], reqs[j]) })
+	return reqs
+}
+
+// close wakes up all waiting workers and drops the remaining requests.
+func (q *requestQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	for _, r := range q.reqs {
+		r.cancel()
+	}
+	q.reqs = nil
+	q.cond.Broadcast()
+}
@@ -0,0 +1,343 @@
+package dhcp4server
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+	"github.com/mergetb/dhcp4/dhcp4opts"
+)
+
+func queued(secs uint16) *queuedRequest {
+	p := dhcp4.NewPacket(dhcp4.BootRequest)
+	p.Secs = secs
+	return &queuedRequest{
+		ctx:    context.Background(),
+		cancel: func() {},
+		pkt:    p,
+	}
+}
+
+func TestRequestQueue(t *testing.T) {
+	for _, tt := range []struct {
+		desc         string
+		secsPriority bool
+		max          int
+		push         []uint16
+		wantDropped  []uint16
+		want         []uint16
+	}{
+		{
+			desc: "FIFO",
+			max:  10,
+			push: []uint16{0, 30, 5, 30},
+			want: []uint16{0, 30, 5, 30},
+		},
+		{
+			desc:        "FIFO drops newest",
+			max:         2,
+			push:        []uint16{0, 30, 5},
+			wantDropped: []uint16{5},
+			want:        []uint16{0, 30},
+		},
+		{
+			desc:         "secs priority",
+			secsPriority: true,
+			max:          10,
+			push:         []uint16{0, 30, 5, 30, 4},
+			want:         []uint16{30, 30, 5, 4, 0},
+		},
+		{
+			desc:         "secs priority drops freshest",
+			secsPriority: true,
+			max:          2,
+			push:         []uint16{0, 30, 5, 1},
+			wantDropped:  []uint16{0, 1},
+			want:         []uint16{30, 5},
+		},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			q := newRequestQueue(tt.max, tt.secsPriority, false)
+			var dropped []uint16
+			for _, secs := range tt.push {
+				if d := q.push(queued(secs)); d != nil {
+					dropped = append(dropped, d.pkt.Secs)
+				}
+			}
+			if !reflect.DeepEqual(dropped, tt.wantDropped) {
+				t.Errorf("dropped %v, want %v", dropped, tt.wantDropped)
+			}
+
+			var got []uint16
+			for range tt.want {
+				r, ok := q.pop()
+				if !ok {
+					t.Fatalf("pop() = closed")
+				}
+				got = append(got, r.pkt.Secs)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("popped %v, want %v", got, tt.want)
+			}
+
+			q.close()
+			if _, ok := q.pop(); ok {
+				t.Errorf("pop() after close = ok, want closed")
+			}
+		})
+	}
+}
+
+// queuedMessage returns a queued request named name: "discover",
+// "select", "reboot", "renew", "release" or "inform".
+func queuedMessage(name string, secs uint16) *queuedRequest {
+	r := queued(secs)
+	o := r.pkt.Options
+	switch name {
+	case "discover":
+		o.SetMessageType(dhcp4.DHCPDiscover)
+	case "select":
+		o.SetMessageType(dhcp4.DHCPRequest)
+		o.SetServerIdentifier(net.IP{192, 168, 0, 1})
+		o.SetRequestedIPAddress(net.IP{192, 168, 1, 10})
+	case "reboot":
+		o.SetMessageType(dhcp4.DHCPRequest)
+		o.SetRequestedIPAddress(net.IP{192, 168, 1, 10})
+	case "renew":
+		o.SetMessageType(dhcp4.DHCPRequest)
+		r.pkt.CIAddr = net.IP{192, 168, 1, 10}
+	case "release":
+		o.SetMessageType(dhcp4.DHCPRelease)
+		r.pkt.CIAddr = net.IP{192, 168, 1, 10}
+	case "inform":
+		o.SetMessageType(dhcp4.DHCPInform)
+		r.pkt.CIAddr = net.IP{192, 168, 1, 10}
+	}
+	r.pkt.ServerName = name
+	return r
+}
+
+func TestMessagePriority(t *testing.T) {
+	for _, tt := range []struct {
+		desc         string
+		secsPriority bool
+		max          int
+		push         []string
+		secs         []uint16
+		wantDropped  []string
+		want         []string
+	}{
+		{
+			desc: "by type",
+			max:  10,
+			push: []string{"discover", "select", "renew", "inform", "reboot", "release", "renew"},
+			want: []string{"renew", "renew", "select", "inform", "reboot", "release", "discover"},
+		},
+		{
+			desc:        "drops discovers first",
+			max:         3,
+			push:        []string{"renew", "discover", "discover", "select", "renew"},
+			wantDropped: []string{"discover", "discover"},
+			want:        []string{"renew", "renew", "select"},
+		},
+		{
+			desc:         "secs within type",
+			secsPriority: true,
+			max:          10,
+			push:         []string{"discover", "renew", "discover", "renew"},
+			secs:         []uint16{30, 0, 60, 5},
+			want:         []string{"renew", "renew", "discover", "discover"},
+		},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			q := newRequestQueue(tt.max, tt.secsPriority, true)
+			var dropped []string
+			for i, name := range tt.push {
+				var secs uint16
+				if tt.secs != nil {
+					secs = tt.secs[i]
+				}
+				if d := q.push(queuedMessage(name, secs)); d != nil {
+					dropped = append(dropped, d.pkt.ServerName)
+				}
+			}
+			if !reflect.DeepEqual(dropped, tt.wantDropped) {
+				t.Errorf("dropped %v, want %v", dropped, tt.wantDropped)
+			}
+
+			var got []string
+			var secs []uint16
+			for range tt.want {
+				r, ok := q.pop()
+				if !ok {
+					t.Fatalf("pop() = closed")
+				}
+				got = append(got, r.pkt.ServerName)
+				secs = append(secs, r.pkt.Secs)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("popped %v, want %v", got, tt.want)
+			}
+			if tt.secsPriority && (secs[0] != 5 || secs[2] != 60) {
+				t.Errorf("popped secs %v, want the longest waiting of each type first", secs)
+			}
+		})
+	}
+}
+
+// packet is a packet read from a chanConn.
+type packet struct {
+	b    []byte
+	addr net.Addr
+}
+
+// chanConn is a net.PacketConn reading packets from a channel.
+type chanConn struct {
+	recordConn
+	in       chan packet
+	deadline chan struct{}
+}
+
+func (cc *chanConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	select {
+	case p := <-cc.in:
+		return copy(b, p.b), p.addr, nil
+	case <-cc.deadline:
+		return 0, nil, &net.OpError{Op: "read", Err: context.DeadlineExceeded}
+	}
+}
+
+func (cc *chanConn) SetReadDeadline(time.Time) error {
+	close(cc.deadline)
+	return nil
+}
+
+func (cc *chanConn) Close() error {
+	return nil
+}
+
+func TestServeContext(t *testing.T) {
+	s := newTestServer(t, WithWorkers(2), WithSecsPriority())
+	conn := &chanConn{
+		in:       make(chan packet),
+		deadline: make(chan struct{}),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- s.ServeContext(ctx, testLogger, conn)
+	}()
+
+	b, err := newRequest(dhcp4opts.DHCPDiscover, net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 1}).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.in <- packet{b: b, addr: testPeer}
+	// Unbuffered: the first packet was read once the second is accepted.
+	conn.in <- packet{b: []byte("garbage"), addr: testPeer}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(s.Leases(HistoryQuery{})) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("ServeContext() = %v, want %v", err, context.Canceled)
+	}
+	if got := len(s.Leases(HistoryQuery{})); got != 1 {
+		t.Errorf("got %d leases, want 1", got)
+	}
+}
+
+func TestServeConns(t *testing.T) {
+	s := newTestServer(t, WithWorkers(2))
+	conns := []*chanConn{
+		{in: make(chan packet), deadline: make(chan struct{})},
+		{in: make(chan packet), deadline: make(chan struct{})},
+	}
+	macs := []net.HardwareAddr{{0, 0, 0x5e, 0, 0x53, 1}, {0, 0, 0x5e, 0, 0x53, 2}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- s.ServeConns(ctx, testLogger, conns[0], conns[1])
+	}()
+
+	for i, conn := range conns {
+		b, err := newRequest(dhcp4opts.DHCPDiscover, macs[i]).MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.in <- packet{b: b, addr: testPeer}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(s.Leases(HistoryQuery{})) < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("ServeConns() = %v, want %v", err, context.Canceled)
+	}
+	for i, conn := range conns {
+		if len(conn.sent) != 1 || conn.sent[0].HardwareAddr().String() != macs[i].String() {
+			t.Errorf("conn %d sent %v, want the offer to %v", i, conn.sent, macs[i])
+		}
+	}
+}
+
+// stallConn is a chanConn whose writes block until release is closed.
+type stallConn struct {
+	*chanConn
+	writing chan<- struct{}
+	release <-chan struct{}
+}
+
+func (sc *stallConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	sc.writing <- struct{}{}
+	<-sc.release
+	return len(b), nil
+}
+
+func TestWorkersWriteConcurrently(t *testing.T) {
+	s := newTestServer(t, WithWorkers(2))
+	writing := make(chan struct{}, 2)
+	release := make(chan struct{})
+	conn := &stallConn{
+		chanConn: &chanConn{in: make(chan packet), deadline: make(chan struct{})},
+		writing:  writing,
+		release:  release,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- s.ServeContext(ctx, testLogger, conn)
+	}()
+
+	for _, mac := range []net.HardwareAddr{{0, 0, 0x5e, 0, 0x53, 1}, {0, 0, 0x5e, 0, 0x53, 2}} {
+		b, err := newRequest(dhcp4opts.DHCPDiscover, mac).MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.in <- packet{b: b, addr: testPeer}
+	}
+
+	// A write in progress must not keep the other worker from answering.
+	for i := 0; i < 2; i++ {
+		select {
+		case <-writing:
+		case <-time.After(5 * time.Second):
+			t.Errorf("%d of 2 responses written while the first write blocks", i)
+		}
+	}
+	close(release)
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("ServeContext() = %v, want %v", err, context.Canceled)
+	}
+}
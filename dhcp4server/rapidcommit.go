@@ -0,0 +1,20 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4server
+
+// WithRapidCommit makes the server honor the rapid commit option of RFC
+// 4039: a DHCPDISCOVER carrying it is answered with a DHCPACK binding the
+// address right away, rather than with an offer the client must request.
+//
+// RFC 4039, Section 3 asks servers to only do so if they are the only server
+// on the network or if all servers there agree: clients accept the first
+// rapid commit ACK, and addresses other servers committed to them stay bound.
+//
+// Default is to ignore the option and offer addresses as usual.
+func WithRapidCommit() ServerOpt {
+	return func(s *Server) {
+		s.rapidCommit = true
+	}
+}
@@ -0,0 +1,40 @@
+package dhcp4server
+
+import (
+	"net"
+	"testing"
+
+	"github.com/mergetb/dhcp4"
+	"github.com/mergetb/dhcp4/dhcp4opts"
+)
+
+func TestRapidCommit(t *testing.T) {
+	mac := net.HardwareAddr{2, 0, 0, 0, 0, 1}
+	discover := newRequest(dhcp4opts.DHCPDiscover, mac)
+	discover.Options.SetRapidCommit(true)
+
+	for _, tt := range []struct {
+		name      string
+		opts      []ServerOpt
+		want      dhcp4.MessageType
+		wantBound bool
+	}{
+		{name: "enabled", opts: []ServerOpt{WithRapidCommit()}, want: dhcp4.DHCPACK, wantBound: true},
+		{name: "disabled", want: dhcp4.DHCPOffer},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, tt.opts...)
+			reply := exchange(t, s, discover)
+			if reply == nil || reply.Options.MessageType() != tt.want {
+				t.Fatalf("response to DHCPDISCOVER = %v, want %v", reply, tt.want)
+			}
+			if got := reply.Options.RapidCommit(); got != tt.wantBound {
+				t.Errorf("response rapid commit = %v, want %v", got, tt.wantBound)
+			}
+			key, _ := s.keyPolicy.requestKey(discover)
+			if _, pending := s.offers[key]; pending == tt.wantBound {
+				t.Errorf("offer pending = %v, want %v", pending, !tt.wantBound)
+			}
+		})
+	}
+}
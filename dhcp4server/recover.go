@@ -0,0 +1,131 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4server
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"syscall"
+	"time"
+)
+
+// RecoveryEvent reports the server replacing its connection after a socket
+// error.
+type RecoveryEvent struct {
+	// Time is when the connection was replaced or reopening it failed.
+	Time time.Time
+
+	// Err is the socket error that triggered recovery.
+	Err error
+
+	// ReopenErr is the error opening a new connection, or nil if the
+	// server recovered. The server keeps trying with backoff.
+	ReopenErr error
+}
+
+// WithRecoveryHandler configures a function called whenever ServeRecovering
+// replaced, or failed to replace, its connection.
+func WithRecoveryHandler(fn func(RecoveryEvent)) ServerOpt {
+	return func(s *Server) {
+		s.onRecovery = fn
+	}
+}
+
+// WithRecoveryBackoff configures how long ServeRecovering waits before
+// retrying to open a connection. The wait starts at base and doubles after
+// every failure up to max.
+//
+// Default is 1 second doubling up to 30 seconds.
+func WithRecoveryBackoff(base, max time.Duration) ServerOpt {
+	return func(s *Server) {
+		s.recoveryBase = base
+		s.recoveryMax = max
+	}
+}
+
+// socketGone returns whether err means that the socket can no longer be used
+// and must be replaced, e.g. because its interface went down or was deleted.
+func socketGone(err error) bool {
+	for _, errno := range []syscall.Errno{syscall.ENETDOWN, syscall.ENODEV, syscall.ENXIO} {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	return false
+}
+
+// ServeRecovering serves DHCP requests like ServeContext on connections
+// opened by listen.
+//
+// When the connection fails because its interface went down or away, e.g.
+// because it was deleted and recreated, ServeRecovering closes it, opens a
+// new one with listen and continues serving. Bindings and history are kept.
+// Other errors, and ctx being canceled, stop serving.
+func (s *Server) ServeRecovering(ctx context.Context, logger *log.Logger, listen func() (net.PacketConn, error)) error {
+	return s.ServeRecoveringConns(ctx, logger, func() ([]net.PacketConn, error) {
+		conn, err := listen()
+		if err != nil {
+			return nil, err
+		}
+		return []net.PacketConn{conn}, nil
+	})
+}
+
+// ServeRecoveringConns is ServeRecovering for groups of connections served
+// with ServeConns, e.g. opened by ListenReusePort: when one fails, all are
+// closed and listen opens a new group.
+func (s *Server) ServeRecoveringConns(ctx context.Context, logger *log.Logger, listen func() ([]net.PacketConn, error)) error {
+	conns, err := listen()
+	if err != nil {
+		return err
+	}
+	for {
+		err := s.ServeConns(ctx, logger, conns...)
+		for _, conn := range conns {
+			conn.Close()
+		}
+		if ctx.Err() != nil || !socketGone(err) {
+			return err
+		}
+		logger.Printf("Connection failed: %v; reopening", err)
+
+		conns, err = s.reopen(ctx, err, listen)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// reopen opens new connections with listen after cause, retrying with
+// backoff until it succeeds or ctx is canceled.
+func (s *Server) reopen(ctx context.Context, cause error, listen func() ([]net.PacketConn, error)) ([]net.PacketConn, error) {
+	wait := s.recoveryBase
+	for {
+		conns, err := listen()
+		if s.onRecovery != nil {
+			s.onRecovery(RecoveryEvent{
+				Time:      time.Now(),
+				Err:       cause,
+				ReopenErr: err,
+			})
+		}
+		if err == nil {
+			return conns, nil
+		}
+
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, ctx.Err()
+		case <-t.C:
+		}
+		if wait *= 2; wait > s.recoveryMax {
+			wait = s.recoveryMax
+		}
+	}
+}
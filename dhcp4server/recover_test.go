@@ -0,0 +1,104 @@
+package dhcp4server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/mergetb/dhcp4/dhcp4opts"
+)
+
+// goneConn is a connection whose interface went away.
+type goneConn struct {
+	net.PacketConn
+}
+
+func (goneConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	return 0, nil, &net.OpError{Op: "read", Err: os.NewSyscallError("recvfrom", syscall.ENETDOWN)}
+}
+
+func (goneConn) SetReadDeadline(time.Time) error {
+	return nil
+}
+
+func (goneConn) Close() error {
+	return nil
+}
+
+func TestServeRecovering(t *testing.T) {
+	var events []RecoveryEvent
+	s := newTestServer(t,
+		WithRecoveryHandler(func(e RecoveryEvent) {
+			events = append(events, e)
+		}),
+		WithRecoveryBackoff(time.Millisecond, time.Millisecond),
+	)
+	conn := &chanConn{
+		in:       make(chan packet),
+		deadline: make(chan struct{}),
+	}
+
+	// The first connection fails, opening the second fails once, and the
+	// third works.
+	var listens int
+	listen := func() (net.PacketConn, error) {
+		listens++
+		switch listens {
+		case 1:
+			return &goneConn{}, nil
+		case 2:
+			return nil, syscall.ENODEV
+		default:
+			return conn, nil
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- s.ServeRecovering(ctx, testLogger, listen)
+	}()
+
+	b, err := newRequest(dhcp4opts.DHCPDiscover, net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 1}).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.in <- packet{b: b, addr: testPeer}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(s.Leases(HistoryQuery{})) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("ServeRecovering() = %v, want %v", err, context.Canceled)
+	}
+	if got := len(s.Leases(HistoryQuery{})); got != 1 {
+		t.Errorf("got %d leases, want 1", got)
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("got %d recovery events, want 2", len(events))
+	}
+	if !errors.Is(events[0].Err, syscall.ENETDOWN) || !errors.Is(events[0].ReopenErr, syscall.ENODEV) {
+		t.Errorf("first event = %+v, want ENETDOWN and failed reopen", events[0])
+	}
+	if events[1].ReopenErr != nil {
+		t.Errorf("second event = %+v, want successful reopen", events[1])
+	}
+}
+
+func TestServeRecoveringOtherError(t *testing.T) {
+	s := newTestServer(t)
+	want := errors.New("listen failed")
+	err := s.ServeRecovering(context.Background(), testLogger, func() (net.PacketConn, error) {
+		return nil, want
+	})
+	if err != want {
+		t.Errorf("ServeRecovering() = %v, want %v", err, want)
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"sort"
+)
+
+// Reservation is an address reserved for a client.
+type Reservation struct {
+	HardwareAddr net.HardwareAddr
+	IP           net.IP
+}
+
+// WithReservations reserves addresses for clients, like Server.Reserve does
+// at runtime. Reservations are not checked; later ones for the same client
+// or address replace earlier ones.
+func WithReservations(rs ...Reservation) ServerOpt {
+	return func(s *Server) {
+		for _, r := range rs {
+			s.reserve(r.HardwareAddr, r.IP.To4())
+		}
+	}
+}
+
+// Reserve reserves ip for the client with hardware address hw, replacing any
+// address reserved for it before.
+//
+// The client is offered ip, and no other client is, once the client has no
+// binding to another address. Reserve fails if ip is outside the pool,
+// reserved for another client, or bound to another client.
+//
+// Reservations are only enforced against other clients when allocating
+// from MemoryLeases or FileLeases.
+func (s *Server) Reserve(hw net.HardwareAddr, ip net.IP) error {
+	ip4 := ip.To4()
+	if ip4 == nil {
+		return fmt.Errorf("%v is not an IPv4 address", ip)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if rl, ok := s.local.(ResizableLeases); ok && !rl.Pool().Contains(ip4) && s.subnetContaining(ip4) == nil {
+		return fmt.Errorf("%v is outside the pool %v", ip4, rl.Pool())
+	}
+	if ip4.Equal(s.ip) || ip4.Equal(s.serverID) {
+		return fmt.Errorf("%v is the server's address", ip4)
+	}
+	if pool := s.poolContaining(ip4); pool != nil && !hostAddr(pool, ip4) {
+		return fmt.Errorf("%v is the network or broadcast address of %v", ip4, pool)
+	}
+	if other, ok := s.reservedIPs[beUint32(ip4)]; ok && other != hw.String() {
+		return fmt.Errorf("%v is reserved for %s", ip4, other)
+	}
+	for _, b := range s.leases.All() {
+		if b.IP.Equal(ip4) && !bytes.Equal(b.HardwareAddr, hw) {
+			return fmt.Errorf("%v is bound to %v", ip4, b.HardwareAddr)
+		}
+	}
+	s.reserve(hw, ip4)
+	return nil
+}
+
+// Unreserve removes the reservation of the client with hardware address hw,
+// if any. A binding to the reserved address is kept until it ends.
+func (s *Server) Unreserve(hw net.HardwareAddr) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.unreserve(hw.String())
+}
+
+// Reservations returns the reservations, ordered by address.
+func (s *Server) Reservations() []Reservation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rs := make([]Reservation, 0, len(s.reservations))
+	for hw, ip := range s.reservations {
+		mac, _ := net.ParseMAC(hw)
+		rs = append(rs, Reservation{HardwareAddr: mac, IP: ip})
+	}
+	sort.Slice(rs, func(i, j int) bool {
+		return beUint32(rs[i].IP) < beUint32(rs[j].IP)
+	})
+	return rs
+}
+
+// ReleaseLease ends the binding of ip, as if its client had released it,
+// so that the address can be allocated again. It returns ErrNotBound if ip
+// is not bound.
+func (s *Server) ReleaseLease(ip net.IP) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, b := range s.leases.All() {
+		if b.IP.Equal(ip) {
+			s.release(context.Background(), bindingKey(b.Key), LeaseExpired)
+			return nil
+		}
+	}
+	return ErrNotBound
+}
+
+// reserve reserves ip for hw.
+//
+// s.mu must be held.
+func (s *Server) reserve(hw net.HardwareAddr, ip net.IP) {
+	if s.reservations == nil {
+		s.reservations = make(map[string]net.IP)
+		s.reservedIPs = make(map[uint32]string)
+	}
+	key := hw.String()
+	s.unreserve(key)
+	if other, ok := s.reservedIPs[beUint32(ip)]; ok {
+		s.unreserve(other)
+	}
+	s.reservations[key] = ip
+	s.reservedIPs[beUint32(ip)] = key
+}
+
+// unreserve removes the reservation of the hardware address hw.
+//
+// s.mu must be held.
+func (s *Server) unreserve(hw string) {
+	if ip, ok := s.reservations[hw]; ok {
+		delete(s.reservedIPs, beUint32(ip))
+		delete(s.reservations, hw)
+	}
+}
+
+// reservedIP returns the address reserved for hw, or nil if there is none.
+//
+// s.mu must be held.
+func (s *Server) reservedIP(hw net.HardwareAddr) net.IP {
+	return s.reservations[hw.String()]
+}
+
+// excluded returns whether ip must not be allocated to the client
+// s.allocatingFor: it is the server's own address or identifier, the
+// network or broadcast address of its pool, its relay agent's address, a
+// conflict in quarantine, reserved for another client, excluded by
+// coexistence mode, or in the server's own pool but outside the address
+// range and not reserved.
+//
+// s.mu must be held.
+func (s *Server) excluded(ip net.IP) bool {
+	if ip.Equal(s.ip) || ip.Equal(s.serverID) || ip.Equal(s.allocatingRelay) {
+		return true
+	}
+	if pool := s.poolContaining(ip); pool != nil && !hostAddr(pool, ip) {
+		return true
+	}
+	if s.inQuarantine(ip) {
+		return true
+	}
+	if s.coexist != nil && s.coexist.excluded(ip) {
+		return true
+	}
+	if hw, ok := s.reservedIPs[beUint32(ip)]; ok {
+		return hw != s.allocatingFor
+	}
+	return s.subnetContaining(ip) == nil && !s.inRange(ip)
+}
+
+// poolContaining returns the network of the subnet containing ip, else the
+// server's own pool if known, or nil.
+//
+// s.mu must be held.
+func (s *Server) poolContaining(ip net.IP) *net.IPNet {
+	if sub := s.subnetContaining(ip); sub != nil {
+		return sub.Network
+	}
+	if rl, ok := s.local.(ResizableLeases); ok {
+		return rl.Pool()
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package dhcp4server
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/mergetb/dhcp4/dhcp4opts"
+)
+
+func TestReservations(t *testing.T) {
+	reservedMAC := net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 1}
+	otherMAC := net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 2}
+	// The first address of the pool, which is handed out first.
+	first := net.IP{192, 168, 1, 1}
+	s := newTestServer(t, WithReservations(Reservation{HardwareAddr: reservedMAC, IP: first}))
+
+	other := exchange(t, s, newRequest(dhcp4opts.DHCPDiscover, otherMAC))
+	if other == nil || other.YIAddr.Equal(first) {
+		t.Fatalf("other client got offer %v, want an address other than %v", other, first)
+	}
+	if offer := exchange(t, s, newRequest(dhcp4opts.DHCPDiscover, reservedMAC)); offer == nil || !offer.YIAddr.Equal(first) {
+		t.Errorf("client got offer %v, want reserved %v", offer, first)
+	}
+
+	if err := s.Reserve(otherMAC, first); err == nil {
+		t.Errorf("Reserve(%v) of another client's address = nil, want error", first)
+	}
+	if err := s.Reserve(reservedMAC, other.YIAddr); err == nil {
+		t.Errorf("Reserve(%v) of a bound address = nil, want error", other.YIAddr)
+	}
+	if err := s.Reserve(reservedMAC, net.IP{10, 0, 0, 1}); err == nil {
+		t.Errorf("Reserve(10.0.0.1) outside the pool = nil, want error")
+	}
+	for _, ip := range []net.IP{{192, 168, 1, 0}, {192, 168, 1, 255}} {
+		if err := s.Reserve(reservedMAC, ip); err == nil {
+			t.Errorf("Reserve(%v) of the network or broadcast address = nil, want error", ip)
+		}
+	}
+	if want := []Reservation{{HardwareAddr: reservedMAC, IP: first}}; !reflect.DeepEqual(s.Reservations(), want) {
+		t.Errorf("Reservations() = %v, want %v", s.Reservations(), want)
+	}
+
+	if err := s.ReleaseLease(first); err != nil {
+		t.Fatalf("ReleaseLease(%v) = %v", first, err)
+	}
+	if err := s.ReleaseLease(first); err != ErrNotBound {
+		t.Errorf("ReleaseLease(%v) again = %v, want %v", first, err, ErrNotBound)
+	}
+	s.Unreserve(reservedMAC)
+	if rs := s.Reservations(); len(rs) != 0 {
+		t.Errorf("Reservations() after Unreserve = %v, want none", rs)
+	}
+	third := exchange(t, s, newRequest(dhcp4opts.DHCPDiscover, net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 3}))
+	if third == nil || !third.YIAddr.Equal(first) {
+		t.Errorf("third client got offer %v, want released %v", third, first)
+	}
+}
+
+func TestPoolExcludes(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		subnet string
+		self   net.IP
+		opts   []ServerOpt
+		// want are the addresses handed out, in order.
+		want []net.IP
+	}{
+		{
+			name:   "/30 with the server in the pool",
+			subnet: "10.0.0.0/30",
+			self:   net.IP{10, 0, 0, 1},
+			want:   []net.IP{{10, 0, 0, 2}},
+		},
+		{
+			name:   "/29 with a server identifier in the pool",
+			subnet: "10.0.0.0/29",
+			self:   net.IP{10, 0, 1, 1},
+			opts:   []ServerOpt{WithServerID(net.IP{10, 0, 0, 3})},
+			want:   []net.IP{{10, 0, 0, 1}, {10, 0, 0, 2}, {10, 0, 0, 4}, {10, 0, 0, 5}, {10, 0, 0, 6}},
+		},
+		{
+			name:   "/31 point-to-point",
+			subnet: "10.0.0.0/31",
+			self:   net.IP{10, 0, 1, 1},
+			want:   []net.IP{{10, 0, 0, 0}, {10, 0, 0, 1}},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, subnet, err := net.ParseCIDR(tt.subnet)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := New(tt.self, subnet, "", "", tt.opts...)
+
+			var got []net.IP
+			for i := byte(1); i <= 16; i++ {
+				mac := net.HardwareAddr{0, 0, 0x5e, 0, 0x53, i}
+				offer := exchange(t, s, newRequest(dhcp4opts.DHCPDiscover, mac))
+				if offer == nil {
+					break
+				}
+				got = append(got, bind(t, s, mac, ""))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("handed out %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4server
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net"
+)
+
+// ListenReusePort opens n UDP sockets on addr, ":67" if empty, to be served
+// with ServeConns. The sockets share the port with SO_REUSEPORT, and the
+// kernel spreads the requests sent to the server over them by source
+// address, so that n goroutines read and decode requests instead of one.
+//
+// Broadcast requests, e.g. DISCOVERs of clients without a relay agent, are
+// delivered to every socket; each socket keeps those of the clients whose
+// hardware address hashes to it, so that every request is served once.
+//
+// SO_REUSEPORT sharding is only supported on Linux; elsewhere n must be 1.
+func ListenReusePort(addr string, n int) ([]net.PacketConn, error) {
+	if addr == "" {
+		addr = fmt.Sprintf(":%d", serverPort)
+	}
+	if n <= 1 {
+		conn, err := net.ListenPacket("udp4", addr)
+		if err != nil {
+			return nil, err
+		}
+		return []net.PacketConn{conn}, nil
+	}
+
+	conns := make([]net.PacketConn, 0, n)
+	closeAll := func() {
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}
+	for i := 0; i < n; i++ {
+		conn, err := listenReusePort(addr, shard{index: uint32(i), count: uint32(n)})
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		if i == 0 {
+			// Port 0 picks a port; the other sockets must share it.
+			addr = conn.LocalAddr().String()
+		}
+		conns = append(conns, conn)
+	}
+	return conns, nil
+}
+
+// shard is the position of a socket in the group of ListenReusePort.
+type shard struct {
+	index, count uint32
+}
+
+// keep returns whether the socket reads the datagram b sent to dst: all
+// unicast datagrams, which the kernel delivers to one socket only, and the
+// broadcasts of clients whose hardware address hashes to it.
+func (s shard) keep(b []byte, dst net.IP) bool {
+	if !dst.Equal(net.IPv4bcast) {
+		return true
+	}
+	return shardOf(b, s.count) == s.index
+}
+
+// chaddrOffset and chaddrLen locate the chaddr field in a BOOTP message.
+const (
+	chaddrOffset = 28
+	chaddrLen    = 16
+)
+
+// shardOf returns which of n shards the BOOTP message b belongs to, by its
+// client hardware address. Messages too short to have one belong to shard 0,
+// which drops them as malformed.
+func shardOf(b []byte, n uint32) uint32 {
+	if len(b) < chaddrOffset+chaddrLen {
+		return 0
+	}
+	h := fnv.New32a()
+	h.Write(b[chaddrOffset : chaddrOffset+chaddrLen])
+	return h.Sum32() % n
+}
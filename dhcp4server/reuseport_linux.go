@@ -0,0 +1,59 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4server
+
+import (
+	"context"
+	"net"
+	"syscall"
+
+	"golang.org/x/net/ipv4"
+	"golang.org/x/sys/unix"
+)
+
+// listenReusePort opens a UDP socket on addr with SO_REUSEPORT set, as
+// socket sh of its group.
+func listenReusePort(addr string, sh shard) (net.PacketConn, error) {
+	lc := net.ListenConfig{
+		Control: func(network, address string, rc syscall.RawConn) error {
+			var serr error
+			if err := rc.Control(func(fd uintptr) {
+				serr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+			}); err != nil {
+				return err
+			}
+			return serr
+		},
+	}
+	conn, err := lc.ListenPacket(context.Background(), "udp4", addr)
+	if err != nil {
+		return nil, err
+	}
+	pc := ipv4.NewPacketConn(conn)
+	if err := pc.SetControlMessage(ipv4.FlagDst, true); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &shardConn{PacketConn: conn, pc: pc, shard: sh}, nil
+}
+
+// shardConn is a socket of ListenReusePort, reporting the destination
+// address of the datagrams read.
+type shardConn struct {
+	net.PacketConn
+	pc    *ipv4.PacketConn
+	shard shard
+}
+
+// ReadFrom implements net.PacketConn. It skips broadcasts that another
+// socket of the group reads.
+func (c *shardConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	for {
+		n, cm, addr, err := c.pc.ReadFrom(b)
+		if err != nil || cm == nil || c.shard.keep(b[:n], cm.Dst) {
+			return n, addr, err
+		}
+	}
+}
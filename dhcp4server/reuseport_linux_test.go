@@ -0,0 +1,77 @@
+package dhcp4server
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+	"github.com/mergetb/dhcp4/dhcp4opts"
+)
+
+func TestListenReusePort(t *testing.T) {
+	conns, err := ListenReusePort("127.0.0.1:0", 4)
+	if err != nil {
+		t.Fatalf("ListenReusePort() = %v", err)
+	}
+	if len(conns) != 4 {
+		t.Fatalf("got %d sockets, want 4", len(conns))
+	}
+	addr := conns[0].LocalAddr().(*net.UDPAddr)
+	for _, conn := range conns[1:] {
+		if got := conn.LocalAddr().(*net.UDPAddr); got.Port != addr.Port {
+			t.Errorf("socket on port %d, want %d", got.Port, addr.Port)
+		}
+	}
+
+	s := newTestServer(t, WithWorkers(4))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- s.ServeConns(ctx, testLogger, conns...)
+	}()
+	defer func() {
+		cancel()
+		if err := <-done; err != context.Canceled {
+			t.Errorf("ServeConns() = %v, want %v", err, context.Canceled)
+		}
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}()
+
+	// Clients on different ports are spread over the sockets; each is
+	// answered once.
+	for i := byte(0); i < 16; i++ {
+		client, err := net.ListenPacket("udp4", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+
+		b, err := newRequest(dhcp4opts.DHCPDiscover, net.HardwareAddr{0, 0, 0x5e, 0, 0x53, i}).MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := client.WriteTo(b, addr); err != nil {
+			t.Fatal(err)
+		}
+
+		client.SetReadDeadline(time.Now().Add(5 * time.Second))
+		buf := make([]byte, maxMessageSize)
+		n, _, err := client.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("client %d: no offer: %v", i, err)
+		}
+		offer, err := dhcp4.ParsePacket(buf[:n])
+		if err != nil || offer.Options.MessageType() != dhcp4.DHCPOffer {
+			t.Fatalf("client %d: got %v, %v; want an offer", i, offer, err)
+		}
+
+		client.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+		if _, _, err := client.ReadFrom(buf); err == nil {
+			t.Errorf("client %d: answered twice", i)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux
+// +build !linux
+
+package dhcp4server
+
+import (
+	"fmt"
+	"net"
+	"runtime"
+)
+
+// listenReusePort is not supported.
+func listenReusePort(addr string, sh shard) (net.PacketConn, error) {
+	return nil, fmt.Errorf("SO_REUSEPORT sharding is not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,38 @@
+package dhcp4server
+
+import (
+	"net"
+	"testing"
+
+	"github.com/mergetb/dhcp4/dhcp4opts"
+)
+
+func TestShardKeep(t *testing.T) {
+	const shards = 4
+	unicast := net.IP{192, 168, 0, 1}
+
+	for i := byte(0); i < 32; i++ {
+		b, err := newRequest(dhcp4opts.DHCPDiscover, net.HardwareAddr{0, 0, 0x5e, 0, 0x53, i}).MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var broadcasts int
+		for index := uint32(0); index < shards; index++ {
+			sh := shard{index: index, count: shards}
+			if !sh.keep(b, unicast) {
+				t.Errorf("shard %d drops a unicast request", index)
+			}
+			if sh.keep(b, net.IPv4bcast) {
+				broadcasts++
+			}
+		}
+		if broadcasts != 1 {
+			t.Errorf("broadcast request of client %d kept by %d shards, want 1", i, broadcasts)
+		}
+	}
+
+	short := make([]byte, chaddrOffset)
+	if !(shard{index: 0, count: shards}).keep(short, net.IPv4bcast) {
+		t.Errorf("shard 0 drops a short broadcast, want it to read it")
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4server
+
+import (
+	"context"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+)
+
+// LeaseDecision is a schedule's decision on the lease of a request.
+type LeaseDecision struct {
+	// Refuse refuses the client a lease. The server does not answer
+	// DISCOVERs and answers REQUESTs with a NAK.
+	Refuse bool
+
+	// LeaseTime is the lease time granted. If 0, the server sends no
+	// lease time and the lease does not expire.
+	LeaseTime time.Duration
+}
+
+// LeaseScheduler decides the lease of a request received at now, e.g. to hand
+// out short leases during maintenance windows or to refuse leases outside of
+// reserved hours.
+//
+// It is called for every DISCOVER and REQUEST with the request's context.
+type LeaseScheduler func(ctx context.Context, now time.Time, req Classification) LeaseDecision
+
+// WithLeaseScheduler configures the lease scheduler.
+//
+// By default, leases are never refused and do not expire.
+func WithLeaseScheduler(ls LeaseScheduler) ServerOpt {
+	return func(s *Server) {
+		s.leaseScheduler = ls
+	}
+}
+
+// Window is a recurring daily time window.
+type Window struct {
+	// Start and End are the times of day the window starts and ends, as
+	// durations since midnight. A window ending before it starts spans
+	// midnight, and a window starting when it ends spans the whole day.
+	Start, End time.Duration
+
+	// Weekdays are the days the window starts on. If empty, it starts
+	// every day.
+	Weekdays []time.Weekday
+
+	// Location is the time zone of Start and End. If nil, the local time
+	// zone is used.
+	Location *time.Location
+}
+
+// Contains returns whether t is within the window.
+func (w Window) Contains(t time.Time) bool {
+	if w.Location != nil {
+		t = t.In(w.Location)
+	}
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	sinceMidnight := t.Sub(midnight)
+
+	start := midnight
+	switch {
+	case w.Start < w.End:
+		if sinceMidnight < w.Start || sinceMidnight >= w.End {
+			return false
+		}
+	case sinceMidnight < w.End:
+		// Started the day before.
+		start = midnight.AddDate(0, 0, -1)
+	case sinceMidnight < w.Start:
+		return false
+	}
+	return w.startsOn(start.Weekday())
+}
+
+func (w Window) startsOn(d time.Weekday) bool {
+	if len(w.Weekdays) == 0 {
+		return true
+	}
+	for _, wd := range w.Weekdays {
+		if wd == d {
+			return true
+		}
+	}
+	return false
+}
+
+// ScheduleRule is a lease decision applying to a class of clients during a
+// window.
+type ScheduleRule struct {
+	// Match selects the clients the rule applies to. If nil, it applies
+	// to all clients.
+	Match func(req Classification) bool
+
+	// Window is when the rule applies. The zero Window applies all day.
+	Window Window
+
+	// Decision is the lease decision of the rule.
+	Decision LeaseDecision
+}
+
+// RuleSchedule returns a LeaseScheduler deciding by the first rule that
+// applies to a request, or def if none does.
+//
+// For example, to refuse leases to a class of clients outside of 8:00 to
+// 18:00 on weekdays and otherwise grant leases of an hour:
+//
+//	RuleSchedule(LeaseDecision{LeaseTime: time.Hour},
+//		ScheduleRule{
+//			Match:    isStudent,
+//			Window:   Window{Start: 8 * time.Hour, End: 18 * time.Hour, Weekdays: workdays},
+//			Decision: LeaseDecision{LeaseTime: time.Hour},
+//		},
+//		ScheduleRule{
+//			Match:    isStudent,
+//			Decision: LeaseDecision{Refuse: true},
+//		},
+//	)
+func RuleSchedule(def LeaseDecision, rules ...ScheduleRule) LeaseScheduler {
+	return func(ctx context.Context, now time.Time, req Classification) LeaseDecision {
+		for _, r := range rules {
+			if (r.Match == nil || r.Match(req)) && r.Window.Contains(now) {
+				return r.Decision
+			}
+		}
+		return def
+	}
+}
+
+// schedule returns the lease decision for req.
+func (s *Server) schedule(ctx context.Context, d *decisions, req Classification) LeaseDecision {
+	if s.leaseScheduler == nil {
+		return LeaseDecision{}
+	}
+	ctx, end := s.tracer.StartSpan(ctx, "dhcp4server.schedule")
+	defer end()
+	lease := s.leaseScheduler(ctx, time.Now(), req)
+	if !lease.Refuse {
+		d.add("schedule", "lease time %v", lease.LeaseTime)
+	}
+	return lease
+}
+
+// setLeaseTime sets the lease time of response as decided.
+func setLeaseTime(response *dhcp4.Packet, lease LeaseDecision) {
+	if lease.LeaseTime > 0 {
+		response.Options.SetLeaseTime(lease.LeaseTime)
+	}
+}
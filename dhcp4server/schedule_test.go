@@ -0,0 +1,80 @@
+package dhcp4server
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+	"github.com/mergetb/dhcp4/dhcp4opts"
+)
+
+func TestWindowContains(t *testing.T) {
+	// 2018-06-04 is a Monday.
+	at := func(day, hour, min int) time.Time {
+		return time.Date(2018, 6, day, hour, min, 0, 0, time.UTC)
+	}
+	office := Window{Start: 8 * time.Hour, End: 18 * time.Hour, Location: time.UTC}
+	night := Window{Start: 22 * time.Hour, End: 6 * time.Hour, Weekdays: []time.Weekday{time.Friday}, Location: time.UTC}
+	for _, tt := range []struct {
+		w    Window
+		t    time.Time
+		want bool
+	}{
+		{w: office, t: at(4, 7, 59), want: false},
+		{w: office, t: at(4, 8, 0), want: true},
+		{w: office, t: at(4, 17, 59), want: true},
+		{w: office, t: at(4, 18, 0), want: false},
+		// Friday night into Saturday morning.
+		{w: night, t: at(8, 21, 59), want: false},
+		{w: night, t: at(8, 23, 0), want: true},
+		{w: night, t: at(9, 5, 59), want: true},
+		{w: night, t: at(9, 6, 0), want: false},
+		// Saturday night does not start on Friday.
+		{w: night, t: at(9, 23, 0), want: false},
+		{w: Window{}, t: at(4, 12, 0), want: true},
+	} {
+		if got := tt.w.Contains(tt.t); got != tt.want {
+			t.Errorf("%+v.Contains(%v) = %v, want %v", tt.w, tt.t, got, tt.want)
+		}
+	}
+}
+
+func TestLeaseScheduler(t *testing.T) {
+	student := net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 1}
+	staff := net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 2}
+	isStudent := func(req Classification) bool {
+		return req.HardwareAddr.String() == student.String()
+	}
+	// Students are refused all day.
+	s := newTestServer(t, WithLeaseScheduler(RuleSchedule(
+		LeaseDecision{LeaseTime: time.Hour},
+		ScheduleRule{Match: isStudent, Decision: LeaseDecision{Refuse: true}},
+	)))
+
+	if offer := exchange(t, s, newRequest(dhcp4opts.DHCPDiscover, student)); offer != nil {
+		t.Errorf("refused client got offer %v, want none", offer)
+	}
+	if got := len(s.Leases(HistoryQuery{})); got != 0 {
+		t.Errorf("refused client got %d bindings, want none", got)
+	}
+
+	offer := exchange(t, s, newRequest(dhcp4opts.DHCPDiscover, staff))
+	if offer == nil || offer.Options.LeaseTime() != time.Hour {
+		t.Fatalf("client got offer %v, want one with lease time 1h", offer)
+	}
+	request := newRequest(dhcp4opts.DHCPRequest, staff)
+	request.Options.SetRequestedIPAddress(offer.YIAddr)
+	if ack := exchange(t, s, request); ack == nil || ack.Options.MessageType() != dhcp4.DHCPACK || ack.Options.LeaseTime() != time.Hour {
+		t.Errorf("client got %v, want ACK with lease time 1h", ack)
+	}
+
+	// Refusing a client with a binding NAKs its requests.
+	s.leaseScheduler = func(ctx context.Context, now time.Time, req Classification) LeaseDecision {
+		return LeaseDecision{Refuse: true}
+	}
+	if nak := exchange(t, s, request); nak == nil || nak.Options.MessageType() != dhcp4.DHCPNAK {
+		t.Errorf("refused client got %v, want NAK", nak)
+	}
+}
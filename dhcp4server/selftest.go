@@ -0,0 +1,137 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/mergetb/dhcp4"
+)
+
+// selfTestAddr is the hardware address of the client run by SelfTest. It is
+// locally administered, so no real client has it.
+var selfTestAddr = net.HardwareAddr{0x02, 0x00, 0x5e, 0x5e, 0x1f, 0x7e}
+
+// SelfTestError is returned by SelfTest if the server did not answer its
+// client as expected.
+type SelfTestError struct {
+	// Step is the message the client sent when things went wrong.
+	Step dhcp4.MessageType
+
+	Err error
+}
+
+func (se *SelfTestError) Error() string {
+	return fmt.Sprintf("self-test %v: %v", se.Step, se.Err)
+}
+
+// SelfTest runs a client through a complete DISCOVER, OFFER, REQUEST, ACK
+// exchange with the server and returns a *SelfTestError if the server did
+// not answer as a real client needs, e.g. because its pool is exhausted or
+// the lease scheduler refuses every lease. Run it after configuring the
+// server and before serving, to catch misconfiguration before real clients
+// see it.
+//
+// The exchange goes through the server's request handling, callbacks
+// included, but neither through the network nor WithUnsafeChaos. The
+// address leased to the client is given back afterwards.
+func (s *Server) SelfTest(ctx context.Context) error {
+	discover := selfTestRequest(dhcp4.DHCPDiscover)
+	// The server may have made an offer even if the client did not
+	// receive it.
+	defer s.selfTestRelease(discover)
+	offer, err := s.selfTestExchange(ctx, discover)
+	if err == nil {
+		err = checkSelfTestReply(offer, dhcp4.DHCPOffer, s.Pool(), s.ServerID())
+	}
+	if err != nil {
+		return &SelfTestError{Step: dhcp4.DHCPDiscover, Err: err}
+	}
+
+	request := selfTestRequest(dhcp4.DHCPRequest)
+	request.Options.SetRequestedIPAddress(offer.YIAddr)
+	request.Options.SetServerIdentifier(s.ServerID())
+	ack, err := s.selfTestExchange(ctx, request)
+	if err == nil {
+		err = checkSelfTestReply(ack, dhcp4.DHCPACK, s.Pool(), s.ServerID())
+	}
+	if err == nil && !ack.YIAddr.Equal(offer.YIAddr) {
+		err = fmt.Errorf("acknowledged %v, but offered %v", ack.YIAddr, offer.YIAddr)
+	}
+	if err != nil {
+		return &SelfTestError{Step: dhcp4.DHCPRequest, Err: err}
+	}
+	return nil
+}
+
+// selfTestRequest returns a request of type typ from the self-test client.
+func selfTestRequest(typ dhcp4.MessageType) *dhcp4.Packet {
+	p := dhcp4.NewPacket(dhcp4.BootRequest)
+	p.SetHardwareAddr(selfTestAddr)
+	p.TransactionID = [4]byte{0x5e, 0x1f, 0x7e, 0x57}
+	p.Options.SetMessageType(typ)
+	// Identify the client under every key policy.
+	p.Options.SetClientIdentifier(append([]byte{1}, selfTestAddr...))
+	return p
+}
+
+// selfTestExchange has the server handle request as handle does, and
+// returns the reply as the client receives it. Faults injected by
+// WithUnsafeChaos are skipped.
+func (s *Server) selfTestExchange(ctx context.Context, request *dhcp4.Packet) (*dhcp4.Packet, error) {
+	peer := &net.UDPAddr{IP: net.IPv4zero, Port: clientPort}
+	ctx, cancel := s.requestContext(ctx, peer)
+	defer cancel()
+
+	s.mu.Lock()
+	reply, p := s.respond(ctx, &decisions{}, peer, request)
+	for p != nil {
+		s.mu.Unlock()
+		p.run(ctx)
+		s.mu.Lock()
+		reply, p = p.resume(ctx)
+	}
+	s.mu.Unlock()
+	if reply == nil {
+		return nil, errors.New("no reply")
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	b, err := s.codec.Encode(reply, s.marshalOptions(request))
+	if err != nil {
+		return nil, err
+	}
+	return s.codec.Decode(b)
+}
+
+// selfTestRelease gives back the address leased to the self-test client of
+// request, without recording it in the lease history.
+func (s *Server) selfTestRelease(request *dhcp4.Packet) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if key, ok := s.keyPolicy.requestKey(request); ok {
+		delete(s.offers, key)
+		s.leases.Release(string(key))
+	}
+}
+
+// checkSelfTestReply returns an error if reply is not of type typ from
+// server id, leasing an address of pool.
+func checkSelfTestReply(reply *dhcp4.Packet, typ dhcp4.MessageType, pool *net.IPNet, id net.IP) error {
+	if got := reply.Options.MessageType(); got != typ {
+		return fmt.Errorf("got %v, want %v", got, typ)
+	}
+	if !pool.Contains(reply.YIAddr) {
+		return fmt.Errorf("leased %v, which is outside the pool %v", reply.YIAddr, pool)
+	}
+	if got := reply.Options.ServerIdentifier(); !got.Equal(id) {
+		return fmt.Errorf("server identifier %v, want %v", got, id)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package dhcp4server
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+	"github.com/mergetb/dhcp4/dhcp4opts"
+)
+
+// truncatingCodec encodes packets too short to decode.
+type truncatingCodec struct{}
+
+func (truncatingCodec) Encode(p *dhcp4.Packet, mo dhcp4.MarshalOptions) ([]byte, error) {
+	b, err := dhcp4.WireCodec.Encode(p, mo)
+	if err != nil {
+		return nil, err
+	}
+	return b[:100], nil
+}
+
+func (truncatingCodec) Decode(b []byte) (*dhcp4.Packet, error) {
+	return dhcp4.WireCodec.Decode(b)
+}
+
+func TestSelfTest(t *testing.T) {
+	_, small, err := net.ParseCIDR("192.168.1.0/31")
+	if err != nil {
+		t.Fatal(err)
+	}
+	full := NewMemoryLeases(small)
+	for _, key := range []string{"a", "b"} {
+		if _, err := full.Allocate(Binding{Key: key}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	refuse := func(ctx context.Context, now time.Time, req Classification) LeaseDecision {
+		return LeaseDecision{Refuse: req.MessageType == dhcp4opts.DHCPRequest}
+	}
+
+	for _, tt := range []struct {
+		desc string
+		opts []ServerOpt
+		// step is where the self-test fails, if it does.
+		step dhcp4.MessageType
+	}{
+		{desc: "ok"},
+		{desc: "key by client identifier", opts: []ServerOpt{WithKeyPolicy(KeyClientID)}},
+		{desc: "pool exhausted", opts: []ServerOpt{WithLeases(full)}, step: dhcp4.DHCPDiscover},
+		{desc: "requests refused", opts: []ServerOpt{WithLeaseScheduler(refuse)}, step: dhcp4.DHCPRequest},
+		{desc: "broken codec", opts: []ServerOpt{WithCodec(truncatingCodec{})}, step: dhcp4.DHCPDiscover},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			s := newTestServer(t, tt.opts...)
+			before := len(s.leases.All())
+			err := s.SelfTest(context.Background())
+			if tt.step == 0 {
+				if err != nil {
+					t.Errorf("SelfTest() = %v, want nil", err)
+				}
+			} else if se, ok := err.(*SelfTestError); !ok || se.Step != tt.step {
+				t.Errorf("SelfTest() = %v, want *SelfTestError at %v", err, tt.step)
+			}
+			if got := len(s.leases.All()); got != before {
+				t.Errorf("SelfTest() left %d bindings, want %d", got, before)
+			}
+		})
+	}
+}
@@ -5,209 +5,970 @@
 package dhcp4server
 
 import (
-	"fmt"
+	"context"
+	"errors"
 	"log"
 	"net"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/mergetb/dhcp4"
+	"github.com/mergetb/dhcp4/dhcp4metrics"
 	"github.com/mergetb/dhcp4/dhcp4opts"
 )
 
-type macAddr [16]byte
-
 const maxMessageSize = 1500
 
+// Server is a simple IPv4 DHCP server handing out addresses from one subnet.
 type Server struct {
 	// whoami
 	ip net.IP
 
-	ips   *ipAllocator
-	conns map[macAddr]net.IP
+	// serverID is sent as option 54 instead of ip if set.
+	serverID net.IP
+
+	// mu protects leases, offers, acks, reservations and keyPolicy.
+	mu        sync.Mutex
+	leases    Leases
+	keyPolicy KeyPolicy
+
+	// local are the leases of the server's own pool. leases are the same
+	// unless there are subnets, whose leases they include.
+	local   Leases
+	subnets []Subnet
+
+	// reservations maps hardware addresses to the addresses reserved for
+	// them, and reservedIPs the other way around.
+	reservations map[string]net.IP
+	reservedIPs  map[uint32]string
+
+	// ranged restricts allocation to the addresses from rangeFirst to
+	// rangeLast.
+	ranged                bool
+	rangeFirst, rangeLast uint32
+
+	// allocatingFor is the hardware address of the client addresses are
+	// being allocated to, which may be allocated its reserved address.
+	allocatingFor string
+
+	// allocatingRelay is the relay agent address of the request addresses
+	// are being allocated for, which is never allocated.
+	allocatingRelay net.IP
+
+	// allocation chooses the addresses of clients without a reservation.
+	allocation AllocationStrategy
+
+	// offers are the bindings made to offer an address that the client
+	// has not requested yet. They are released after offerHold.
+	offers    map[bindingKey]pendingOffer
+	offerHold time.Duration
+
+	// leaseEnds are when the bindings granted a lease time expire.
+	// Bindings without one do not expire.
+	leaseEnds map[bindingKey]time.Time
+
+	// acks are the last ACKs sent to clients, sent again for
+	// retransmitted REQUESTs within ackWindow.
+	acks      map[bindingKey]*cachedACK
+	ackWindow time.Duration
+
+	// history keeps ended bindings.
+	history *History
+
+	// options caches encoded option blocks shared by responses.
+	options optionCache
 
 	sname, filename string
+
+	// defaultOptions are sent to all clients, and hosts and classes
+	// override options and boot parameters for some.
+	defaultOptions dhcp4.Options
+	hosts          map[string]Host
+	classes        []ClientClass
+
+	// ipxeScript is the boot file handed to iPXE clients. If empty, iPXE
+	// clients get filename like everybody else.
+	ipxeScript string
+
+	// echo selects the request options repeated in responses.
+	echo echoPolicy
+
+	bootDecider    BootDecider
+	leaseScheduler LeaseScheduler
+
+	// bootPlacement is where boot server names and files are put.
+	bootPlacement dhcp4.BootPlacement
+
+	// rapidCommit makes the server ACK DHCPDISCOVERs asking for rapid
+	// commit.
+	rapidCommit bool
+
+	// bootp makes the server answer BOOTP requests of clients with a
+	// reserved address.
+	bootp bool
+
+	// leaseQuery makes the server answer DHCPLEASEQUERY messages from
+	// requesters in leaseQueryAllowed, or from anywhere if it is empty.
+	leaseQuery        bool
+	leaseQueryAllowed []*net.IPNet
+
+	tracer         Tracer
+	metrics        dhcp4metrics.Metrics
+	requestTimeout time.Duration
+
+	// middleware wraps the handling of requests.
+	middleware []Middleware
+
+	workers         int
+	queueSize       int
+	secsPriority    bool
+	messagePriority bool
+
+	// clientLimit and globalLimit drop requests before they are queued,
+	// if set.
+	clientLimit, globalLimit *rateLimiter
+
+	// maxPendingOffers bounds offers, if positive.
+	maxPendingOffers int
+
+	// drops counts and logs the requests ServeContext drops.
+	drops dropLog
+
+	onRecovery                func(RecoveryEvent)
+	recoveryBase, recoveryMax time.Duration
+
+	// codec encodes responses and decodes requests.
+	codec dhcp4.Codec
+
+	// coexist is the state of coexistence mode, if enabled.
+	coexist            *coexistence
+	conflictQuarantine time.Duration
+
+	// quarantined are the addresses found in use, by address, not
+	// allocated until their quarantine ends.
+	quarantined map[uint32]Conflict
+
+	// probing are the client keys whose address is being probed before
+	// it is offered.
+	probing map[bindingKey]bool
+
+	// trim are the options left out of responses too large for the
+	// client, least important first.
+	trim []dhcp4.OptionCode
+
+	// chaos injects faults into responses if set.
+	chaos *chaosInjector
+
+	// requests tracks the requests of ServeContext for DumpState.
+	requests requestTracker
+
+	// logger logs for runs started by Start.
+	logger *log.Logger
+
+	// subscribers receive lease events, see Subscribe.
+	subscribers map[chan LeaseEvent]struct{}
+
+	// runMu protects run, the current or last run started by Start.
+	runMu sync.Mutex
+	run   *serveRun
 }
 
-func New(ip net.IP, subnet *net.IPNet, sname, filename string) *Server {
-	return &Server{
+// ServerOpt is a function that configures the Server.
+type ServerOpt func(*Server)
+
+// WithHistoryRetention configures how long ended leases are retained in the
+// lease history.
+//
+// Default is 7 days. A retention of 0 keeps ended leases forever.
+func WithHistoryRetention(d time.Duration) ServerOpt {
+	return func(s *Server) {
+		s.history = NewHistory(d)
+	}
+}
+
+// WithHistory configures the lease history, e.g. one returned by
+// OpenFileHistory that keeps ended leases across restarts. It replaces the
+// history of WithHistoryRetention.
+func WithHistory(h *History) ServerOpt {
+	return func(s *Server) {
+		s.history = h
+	}
+}
+
+// WithIPXE configures the server to chainload iPXE.
+//
+// Clients that are not iPXE are served chainloader (e.g. "undionly.kpxe"),
+// which is the boot file passed to New if chainloader is empty. Clients that
+// are iPXE, e.g. because they were just chainloaded, are served script
+// instead, usually the URL of an iPXE script. Without this distinction, iPXE
+// would chainload itself forever.
+func WithIPXE(chainloader, script string) ServerOpt {
+	return func(s *Server) {
+		if chainloader != "" {
+			s.filename = chainloader
+		}
+		s.ipxeScript = script
+	}
+}
+
+// WithBootDecider configures a callback that decides the boot parameters of
+// each client at runtime, e.g. based on external provisioning state.
+//
+// The decider runs without the server's lock, after the client's address is
+// bound, so a slow decider only delays its own response. The response is
+// dropped if the binding ended while the decider ran, e.g. because the client
+// released it. The decider is called concurrently by the workers, see
+// WithWorkers, and must be safe for concurrent use.
+//
+// The default serves the boot file passed to New and configured by WithIPXE.
+func WithBootDecider(d BootDecider) ServerOpt {
+	return func(s *Server) {
+		s.bootDecider = d
+	}
+}
+
+// WithBootPlacement configures where the boot server name and boot file go
+// in responses: the sname and file fields, the TFTP server name and boot
+// file name options, or both, see dhcp4.BootPlacement. Replies to BOOTP
+// clients always use the fields.
+//
+// Default is dhcp4.BootFields.
+func WithBootPlacement(place dhcp4.BootPlacement) ServerOpt {
+	return func(s *Server) {
+		s.bootPlacement = place
+	}
+}
+
+// WithCodec configures how packets are encoded and decoded.
+//
+// Default is dhcp4.WireCodec.
+func WithCodec(codec dhcp4.Codec) ServerOpt {
+	return func(s *Server) {
+		s.codec = codec
+	}
+}
+
+// WithTrimOrder configures the options that may be left out of responses,
+// least important first, if a response does not fit into the client's
+// Maximum DHCP Message Size even with option overload. Large PXE and vendor
+// options are the usual candidates.
+//
+// Responses that still do not fit are dropped and logged rather than sent
+// and dropped on the wire. By default no options are left out.
+func WithTrimOrder(codes ...dhcp4.OptionCode) ServerOpt {
+	return func(s *Server) {
+		s.trim = codes
+	}
+}
+
+// New returns a new server identifying itself as ip and allocating addresses
+// from subnet.
+func New(ip net.IP, subnet *net.IPNet, sname, filename string, opts ...ServerOpt) *Server {
+	s := &Server{
 		ip:       ip.To4(),
-		ips:      newIPAllocator(subnet),
-		conns:    make(map[macAddr]net.IP),
+		leases:   NewMemoryLeases(subnet),
+		history:  NewHistory(7 * 24 * time.Hour),
 		sname:    sname,
 		filename: filename,
+		codec:    dhcp4.WireCodec,
+		logger:   defaultLogger(),
+
+		offerHold:  30 * time.Second,
+		allocation: AllocateRequested,
+
+		conflictQuarantine: time.Hour,
+
+		tracer:         nopTracer{},
+		metrics:        dhcp4metrics.Discard,
+		requestTimeout: 5 * time.Second,
+
+		workers:   1,
+		queueSize: 64,
+
+		recoveryBase: time.Second,
+		recoveryMax:  30 * time.Second,
+	}
+	s.bootDecider = s.defaultBoot
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.local = s.leases
+	if len(s.subnets) > 0 {
+		s.leases = &subnetLeases{local: s.local, subnets: s.subnets}
+	}
+	if ex, ok := s.leases.(excluder); ok {
+		ex.setExclude(s.excluded)
+	}
+	return s
+}
+
+// History returns the history of ended leases.
+//
+// Callers should run History().RunCompaction for as long as the server runs
+// to drop leases older than the retention window.
+func (s *Server) History() *History {
+	return s.history
+}
+
+// Leases returns all active and retained ended leases that match q, ordered
+// by start time.
+func (s *Server) Leases(q HistoryQuery) []LeaseRecord {
+	rs := s.history.Query(q)
+
+	s.mu.Lock()
+	for _, b := range s.leases.All() {
+		if r := b.record(time.Time{}); q.Match(r) {
+			rs = append(rs, r)
+		}
 	}
+	s.mu.Unlock()
+
+	sort.SliceStable(rs, func(i, j int) bool {
+		return rs[i].Start.Before(rs[j].Start)
+	})
+	return rs
 }
 
 func (s *Server) responsePacket(request *dhcp4.Packet, typ dhcp4opts.DHCPMessageType) *dhcp4.Packet {
 	packet := dhcp4.NewPacket(dhcp4.BootReply)
-	packet.HType = request.HType
-
-	// Must include the following according to RFC 2131 Section 4.3.1 Table 3.
-	packet.TransactionID = request.TransactionID
-	packet.CHAddr = request.CHAddr
-	packet.Broadcast = request.Broadcast
-	packet.GIAddr = request.GIAddr
 	packet.Options.Add(dhcp4.OptionDHCPMessageType, typ)
-	packet.Options.Add(dhcp4.OptionServerIdentifier, dhcp4opts.IP(s.ip))
+	// The server identifier is one of the shared options written by
+	// writePacket.
+
+	prepareReply(request, packet)
+	s.echo.echoOptions(request, packet)
 
 	// IP of next bootstrap server (us).
 	packet.SIAddr = s.ip
-
-	// Optional.
-	packet.Options.Add(dhcp4.OptionMaximumDHCPMessageSize, dhcp4opts.Uint16(maxMessageSize))
 	return packet
 }
 
-func (s *Server) getIP(haddr net.HardwareAddr) net.IP {
-	mac := getMac(haddr)
+// nak returns a DHCPNAK to request telling the client why, see RFC 2131,
+// Section 4.3.2.
+func (s *Server) nak(request *dhcp4.Packet, msg string) *dhcp4.Packet {
+	nak := s.responsePacket(request, dhcp4opts.DHCPNAK)
+	nak.Options.SetMessage(msg)
+	return nak
+}
 
+func (s *Server) getIP(key bindingKey) net.IP {
 	// Already allocated an IP to this client.
-	if ip, ok := s.conns[mac]; ok {
-		return ip
+	if b, ok := s.leases.Lookup(string(key)); ok {
+		return b.IP
 	}
 	return nil
 }
 
-func (s *Server) newIP(haddr net.HardwareAddr) net.IP {
-	mac := getMac(haddr)
+// allocate returns the address to offer to the client of request on sub, or
+// nil if there is none. In coexistence mode, a newly bound address must be
+// probed before it is offered, see probeOffer.
+func (s *Server) allocate(ctx context.Context, d *decisions, key bindingKey, request *dhcp4.Packet, sub *Subnet) (ip net.IP, probe bool) {
+	_, end := s.tracer.StartSpan(ctx, "dhcp4server.allocate")
+	defer end()
 
-	// Already allocated an IP to this client.
-	if ip, ok := s.conns[mac]; ok {
-		return ip
+	if s.probing[key] {
+		d.add("allocate", "not offering an address: probing %v for the client", s.getIP(key))
+		return nil, false
+	}
+	if b, ok := s.leases.Lookup(string(key)); ok && !s.onLink(b.IP, sub) {
+		d.add("allocate", "%v: bound to the client, but on another link", b.IP)
+		if !d.dryRun {
+			s.release(ctx, key, LeaseExpired)
+		}
+	} else if ok {
+		if !s.draining(b.IP) {
+			// Already has an IP allocated.
+			d.add("allocate", "%v: already bound to the client", b.IP)
+			if _, pending := s.offers[key]; pending && !d.dryRun {
+				// Offered again, so hold it longer.
+				s.holdOffer(key, b.IP, request.CHAddr, time.Now())
+			}
+			return b.IP, false
+		}
+		d.add("allocate", "%v: bound to the client, but outside the pool", b.IP)
+		if !d.dryRun {
+			s.release(ctx, key, LeaseExpired)
+		}
+	}
+	if s.pendingOffersFull() {
+		d.add("allocate", "not offering an address: %d offers pending", len(s.offers))
+		return nil, false
 	}
 
-	ip := s.ips.alloc()
-	if ip == nil {
-		return nil
+	// Prefer the reserved IP, then the one the allocation strategy chooses
+	// if it is available.
+	requested := net.IP(dhcp4opts.GetRequestedIPAddress(request.Options))
+	reserved := s.reservedIP(request.CHAddr)
+	s.allocatingFor = request.CHAddr.String()
+	s.allocatingRelay = request.GIAddr
+	defer func() {
+		s.allocatingFor = ""
+		s.allocatingRelay = nil
+	}()
+	pool := s.leasesFor(sub)
+	rip := reserved
+	if rip == nil {
+		rip = s.allocation(s.allocationRequest(key, request.CHAddr, requested, pool))
 	}
-	s.conns[mac] = ip
-	return ip
+	if d.dryRun {
+		ip = pool.Free(rip)
+		if ip != nil && s.coexist != nil {
+			d.add("coexist", "%v would be probed before it is offered", ip)
+		}
+	} else {
+		b, err := pool.Allocate(Binding{
+			Key:          string(key),
+			HardwareAddr: append(net.HardwareAddr(nil), request.CHAddr...),
+			ClientID:     append([]byte(nil), request.Options.Get(dhcp4.OptionClientIdentifier)...),
+			Start:        time.Now(),
+		}, rip)
+		if err != nil && err != ErrNoAddress {
+			d.log("allocate", "Could not bind address for %v: %v", request.HardwareAddr(), err)
+		}
+		ip = b.IP
+		probe = ip != nil && s.coexist != nil
+		if ip != nil && !probe {
+			s.holdOffer(key, ip, b.HardwareAddr, time.Now())
+		}
+	}
+
+	switch {
+	case ip == nil:
+		d.log("allocate", "No address left for %v", request.HardwareAddr())
+	case reserved != nil && ip.Equal(reserved):
+		d.add("allocate", "%v: reserved for the client", ip)
+	case reserved != nil:
+		d.log("allocate", "Reserved address %v for %v is not free; offering %v", reserved, request.HardwareAddr(), ip)
+	case ip.Equal(requested):
+		d.add("allocate", "%v: requested by the client and free", ip)
+	case ip.Equal(rip):
+		d.add("allocate", "%v: chosen by the allocation strategy and free", ip)
+	default:
+		d.add("allocate", "%v: free address", ip)
+	}
+	return ip, probe
 }
 
-func (s *Server) grabIP(haddr net.HardwareAddr, ip net.IP) bool {
-	mac := getMac(haddr)
+// renew records that the client key confirmed its binding.
+func (s *Server) renew(d *decisions, key bindingKey, request *dhcp4.Packet, leaseTime time.Duration) {
+	if d.dryRun {
+		return
+	}
+	now := time.Now()
+	b, err := s.leases.Renew(string(key), now)
+	if err != nil {
+		d.log("allocate", "Could not renew binding %q: %v", key, err)
+	}
+	s.setLeaseEnd(key, now, leaseTime)
+	kind := LeaseRenewed
+	if _, pending := s.offers[key]; pending {
+		kind = LeaseAllocated
+	}
+	delete(s.offers, key)
+	if err == nil {
+		s.emit(kind, b, request, now)
+	}
+}
 
-	if _, ok := s.conns[mac]; ok {
-		return false
+// release ends the binding of key, sending a lease event of kind unless the
+// binding was only offered.
+func (s *Server) release(ctx context.Context, key bindingKey, kind LeaseEventKind) {
+	_, end := s.tracer.StartSpan(ctx, "dhcp4server.release")
+	defer end()
+
+	_, pending := s.offers[key]
+	delete(s.offers, key)
+	delete(s.acks, key)
+	delete(s.leaseEnds, key)
+	b, err := s.leases.Release(string(key))
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	if err := s.history.Add(b.record(now)); err != nil {
+		s.logger.Printf("Could not record ended lease of %v: %v", b.IP, err)
 	}
+	if !pending {
+		s.emit(kind, b, nil, now)
+	}
+}
 
-	if !s.ips.grab(ip) {
-		return false
+// marshalOptions returns how responses to request are encoded: with the
+// shared options, and sized to fit the client's Maximum DHCP Message Size,
+// or as BOOTP messages if request is one.
+func (s *Server) marshalOptions(request *dhcp4.Packet) dhcp4.MarshalOptions {
+	if request.IsBOOTP() {
+		// Replies to BOOTP clients are BOOTP messages, without the
+		// server identifier and other DHCP options.
+		return dhcp4.MarshalOptions{
+			Padding: dhcp4.PadBOOTP,
+			MaxSize: bootpMessageSize,
+			Trim:    s.trim,
+		}
+	}
+	return dhcp4.MarshalOptions{
+		Shared:  s.sharedOptions(),
+		MaxSize: dhcp4.MaxReplySize(request),
+		Trim:    s.trim,
 	}
-	s.conns[mac] = ip
-	return true
 }
 
-func getMac(haddr net.HardwareAddr) macAddr {
-	var mac macAddr
-	copy(mac[:], haddr)
-	return mac
+// sendBuffers holds the buffers responses are encoded into: workers encode
+// and write concurrently, and a buffer is only needed until its response is
+// written.
+var sendBuffers = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 0, maxMessageSize)
+		return &b
+	},
 }
 
-func (s *Server) release(haddr net.HardwareAddr) {
-	mac := getMac(haddr)
-	ip, ok := s.conns[mac]
-	if !ok {
-		return
+// encode returns the encoding of the response p to request, appended to buf
+// if the codec can append.
+func (s *Server) encode(buf []byte, request, p *dhcp4.Packet) ([]byte, error) {
+	mo := s.marshalOptions(request)
+	if ae, ok := s.codec.(dhcp4.AppendEncoder); ok {
+		return ae.AppendEncode(buf, p, mo)
 	}
-	delete(s.conns, mac)
-	s.ips.free(ip)
+	return s.codec.Encode(p, mo)
 }
 
-func (s *Server) writePacket(conn net.PacketConn, addr net.Addr, p *dhcp4.Packet) error {
-	pkt, err := p.MarshalBinary()
+func (s *Server) writePacket(conn net.PacketConn, addr net.Addr, request, p *dhcp4.Packet) error {
+	bp := sendBuffers.Get().(*[]byte)
+	defer sendBuffers.Put(bp)
+	buf := (*bp)[:0]
+	if s.chaos != nil {
+		// Chaos may write the response after writePacket returns.
+		buf = nil
+	}
+	pkt, err := s.encode(buf, request, p)
 	if err != nil {
 		return err
 	}
-
-	uaddr, ok := addr.(*net.UDPAddr)
-	if !ok {
-		return fmt.Errorf("DHCP send: addr %v is not a UDP address", addr)
+	if s.chaos == nil {
+		*bp = pkt[:0]
 	}
-	if uaddr.IP.Equal(net.IPv4zero) {
-		// Broadcast instead
-		_, err = conn.WriteTo(pkt, &net.UDPAddr{IP: net.IPv4bcast, Port: uaddr.Port})
+
+	dest, err := replyAddr(p, addr)
+	if err != nil {
 		return err
 	}
-	_, err = conn.WriteTo(pkt, addr)
+	if s.chaos != nil {
+		return s.chaos.writeTo(conn, pkt, dest)
+	}
+	_, err = conn.WriteTo(pkt, dest)
 	return err
 }
 
+// Serve reads DHCP requests from conn and answers them until reading from
+// conn fails.
 func (s *Server) Serve(logger *log.Logger, conn net.PacketConn) error {
-	var buf [maxMessageSize]byte
+	return s.ServeContext(context.Background(), logger, conn)
+}
+
+// ServeContext reads DHCP requests from conn and answers them until reading
+// from conn fails, answering fails, or ctx is canceled.
+//
+// Each request is handled with a context derived from ctx, carrying the
+// request's RequestInfo and the configured request timeout. Requests wait
+// for one of the configured workers in a queue, see WithWorkers,
+// WithQueueSize, WithSecsPriority and WithMessagePriority. Packets that are
+// not requests, and requests beyond WithClientRateLimit and
+// WithGlobalRateLimit, are dropped before they are queued.
+func (s *Server) ServeContext(ctx context.Context, logger *log.Logger, conn net.PacketConn) error {
+	return s.ServeConns(ctx, logger, conn)
+}
+
+// ServeConns is ServeContext reading requests from several conns at once,
+// e.g. the sockets of ListenReusePort: a goroutine reads each conn, and the
+// requests read share the queue and workers. Responses are sent through the
+// conn their request was read from. Serving stops when reading from any conn
+// fails.
+//
+// With a single conn, one read loop decodes, rate limits and queues every
+// request; during a mass boot of hundreds of clients, it rather than the
+// workers limits how fast requests are served.
+func (s *Server) ServeConns(ctx context.Context, logger *log.Logger, conns ...net.PacketConn) error {
+	if len(conns) == 0 {
+		return errors.New("no conns to serve")
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		// Unblock ReadFrom.
+		<-ctx.Done()
+		for _, conn := range conns {
+			conn.SetReadDeadline(time.Now())
+		}
+	}()
+
+	q := newRequestQueue(s.queueSize, s.secsPriority, s.messagePriority)
+	s.requests.serve(q)
+	var wg sync.WaitGroup
+	defer func() {
+		q.close()
+		wg.Wait()
+		s.requests.stop()
+	}()
+
+	// The first error reading or handling a request stops serving.
+	errc := make(chan error, 1)
+	fail := func(err error) {
+		select {
+		case errc <- err:
+		default:
+		}
+		cancel()
+	}
+	for i := 0; i < s.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				r, ok := q.pop()
+				if !ok {
+					return
+				}
+				if err := r.ctx.Err(); err != nil {
+					s.drops.drop(logger, time.Now(), dropWorkerDelay, "Dropping request from %v: %v", r.addr, err)
+					continue
+				}
+				s.requests.start(r)
+				err := s.handle(r.ctx, logger, r.conn, r.addr, r.pkt)
+				s.requests.done(r)
+				r.cancel()
+				if err != nil {
+					fail(err)
+				}
+			}
+		}()
+	}
+
+	var readers sync.WaitGroup
+	for _, conn := range conns {
+		readers.Add(1)
+		go func(conn net.PacketConn) {
+			defer readers.Done()
+			fail(s.readRequests(ctx, logger, conn, q))
+		}(conn)
+	}
+	readers.Wait()
+	return <-errc
+}
+
+// readBuffers holds the buffers requests are read into: the read loops of
+// ServeConns share them, and a buffer is only needed until its request is
+// decoded.
+var readBuffers = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, maxMessageSize)
+		return &b
+	},
+}
+
+// readRequests reads requests from conn and queues them in q until reading
+// fails or ctx is canceled.
+func (s *Server) readRequests(ctx context.Context, logger *log.Logger, conn net.PacketConn, q *requestQueue) error {
 	for {
-		n, addr, err := conn.ReadFrom(buf[:])
-		if err != nil {
+		buf := readBuffers.Get().(*[]byte)
+		n, addr, err := conn.ReadFrom(*buf)
+		if ctx.Err() != nil || err != nil {
+			readBuffers.Put(buf)
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
 			return err
 		}
 
-		pkt, err := dhcp4.ParsePacket(buf[:n])
+		now := time.Now()
+		pkt, err := s.codec.Decode((*buf)[:n])
+		readBuffers.Put(buf)
 		if err != nil {
-			logger.Printf("Invalid DHCP packet from %v: %v", addr, err)
+			s.drops.drop(logger, now, dropMalformed, "Invalid DHCP packet from %v: %v", addr, err)
+			continue
+		}
+		if reason := s.admit(pkt, now); reason != "" {
+			s.drops.drop(logger, now, reason, "Dropping request from %v (%v): %s", addr, pkt.HardwareAddr(), reason)
 			continue
 		}
 
-		switch typ := dhcp4opts.GetDHCPMessageType(pkt.Options); typ {
-		case dhcp4opts.DHCPDiscover:
-			offer := s.responsePacket(pkt, dhcp4opts.DHCPOffer)
-			mac := getMac(pkt.CHAddr)
-
-			if ip, ok := s.conns[mac]; ok {
-				// Already has an IP allocated.
-				offer.YIAddr = ip
-			} else if rip := dhcp4opts.GetRequestedIPAddress(pkt.Options); s.grabIP(pkt.CHAddr, net.IP(rip)) {
-				// Requested IP is available.
-				offer.YIAddr = net.IP(rip)
-			} else if ip := s.newIP(pkt.CHAddr); ip != nil {
-				// Grab a random new IP.
-				offer.YIAddr = ip
-			}
+		rctx, rcancel := s.requestContext(ctx, addr)
+		if d := q.push(&queuedRequest{ctx: rctx, cancel: rcancel, conn: conn, addr: addr, pkt: pkt}); d != nil {
+			s.drops.drop(logger, now, dropQueueFull, "Dropping request from %v (secs %d): queue full", d.addr, d.pkt.Secs)
+			d.cancel()
+		}
+	}
+}
 
-			offer.ServerName = s.sname
-			offer.BootFile = s.filename
-			if offer.YIAddr != nil {
-				if err := s.writePacket(conn, addr, offer); err != nil {
-					// TODO Undo address assignment.
-					return err
-				}
-			} else {
+func (s *Server) handle(ctx context.Context, logger *log.Logger, conn net.PacketConn, addr net.Addr, pkt *dhcp4.Packet) error {
+	ctx, end := s.tracer.StartSpan(ctx, "dhcp4server.handle")
+	defer end()
+
+	s.metrics.MessageReceived(pkt.Options.MessageType())
+
+	// Only deciding the response changes the server's state: middleware,
+	// encoding and writing run concurrently in the workers.
+	serve := func(req *dhcp4.Packet, peer net.Addr) *dhcp4.Packet {
+		return s.serve(ctx, logger, peer, req)
+	}
+	var re *dhcp4.Packet
+	if len(s.middleware) == 0 {
+		re = serve(pkt, addr)
+	} else {
+		re = Chain(HandlerFunc(serve), s.middleware...).ServeDHCP(pkt, addr)
+	}
+	if re == nil {
+		return nil
+	}
+	// Do not send a response if handling the request took too long.
+	if err := ctx.Err(); err != nil {
+		logger.Printf("Dropping response to %v: %v", addr, err)
+		return nil
+	}
+	// TODO: Undo address assignment if sending fails.
+	err := s.writePacket(conn, addr, pkt, re)
+	if err == dhcp4.ErrTooLarge {
+		logger.Printf("Dropping response to %v: %v (client accepts %d bytes)", addr, err, dhcp4.MaxReplySize(pkt))
+		return nil
+	}
+	if err == nil {
+		s.observeResponse(re)
+	}
+	return err
+}
+
+// serve returns the response to pkt received from addr, or nil if there is
+// none: the cached ACK of a retransmitted REQUEST, or a new response.
+//
+// The response is the caller's: it is used after s.mu is released, so the
+// cache keeps a copy.
+//
+// s.mu must not be held.
+func (s *Server) serve(ctx context.Context, logger *log.Logger, addr net.Addr, pkt *dhcp4.Packet) *dhcp4.Packet {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if re := s.cachedResponse(pkt, now); re != nil {
+		return re.Clone()
+	}
+	re, p := s.respond(ctx, &decisions{logger: logger}, addr, pkt)
+	for p != nil {
+		s.mu.Unlock()
+		p.run(ctx)
+		s.mu.Lock()
+		re, p = p.resume(ctx)
+	}
+	if re != nil {
+		s.cacheResponse(pkt, re.Clone(), now)
+	}
+	return re
+}
+
+// pending is work a response waits for that must run without s.mu, such as
+// calling the boot decider. Whoever took s.mu releases it to run the work,
+// takes it again and resumes: resume checks that the state the work was
+// started for is still in place, and returns the response or more work.
+type pending struct {
+	// run does the work. It must not access the server's state.
+	run func(ctx context.Context)
+
+	// resume is called with s.mu held once run returned.
+	resume func(ctx context.Context) (*dhcp4.Packet, *pending)
+}
+
+// respond returns the response to pkt received from addr, or nil if there is
+// none, or the work it waits for, and records the decisions made in d.
+//
+// s.mu must be held.
+func (s *Server) respond(ctx context.Context, d *decisions, addr net.Addr, pkt *dhcp4.Packet) (*dhcp4.Packet, *pending) {
+	if !d.dryRun {
+		now := time.Now()
+		s.expireOffers(ctx, now)
+		s.expireLeases(ctx, now)
+	}
+
+	class := classify(ctx, s.tracer, pkt, addr)
+	d.add("classify", "%v from %v: hardware address %v, vendor class %q, iPXE %v, relayed %v",
+		class.MessageType, addr, class.HardwareAddr, class.VendorClass, class.IPXE, class.Relayed)
+
+	switch typ := class.MessageType; typ {
+	case dhcp4opts.DHCPDiscover, dhcp4opts.DHCPRequest, dhcp4opts.DHCPDecline, dhcp4opts.DHCPRelease, dhcp4opts.DHCPInform:
+		if err := pkt.ValidateMessage(dhcp4.RoleClient); err != nil {
+			d.log("validate", "Ignoring %v from %v: %v", typ, addr, err)
+			return nil, nil
+		}
+	}
+
+	key, keyed := s.keyPolicy.requestKey(pkt)
+
+	switch typ := class.MessageType; typ {
+	case dhcp4opts.DHCPDiscover, dhcp4opts.DHCPRequest, dhcp4opts.DHCPDecline, dhcp4opts.DHCPRelease:
+		if !keyed {
+			d.log("key", "Ignoring %v from %v: no client identifier", typ, addr)
+			return nil, nil
+		}
+		d.add("key", "binding key %q by policy %v", key, s.keyPolicy)
+	}
+
+	var sub *Subnet
+	switch typ := class.MessageType; typ {
+	case dhcp4opts.DHCPDiscover, dhcp4opts.DHCPRequest:
+		var ok bool
+		if sub, ok = s.subnetFor(d, pkt); !ok {
+			d.log("subnet", "Ignoring %v from %v: no subnet for link %v", typ, addr, linkAddr(pkt))
+			return nil, nil
+		}
+	}
+
+	switch typ := class.MessageType; typ {
+	case dhcp4opts.DHCPDiscover:
+		lease := s.schedule(ctx, d, class)
+		if lease.Refuse {
+			d.log("schedule", "Refusing lease to %v: not scheduled", addr)
+			return nil, nil
+		}
+
+		rapid := s.rapidCommit && pkt.Options.RapidCommit()
+		offerType := dhcp4opts.DHCPOffer
+		if rapid {
+			offerType = dhcp4opts.DHCPACK
+		}
+		offerIP := func(ip net.IP) (*dhcp4.Packet, *pending) {
+			if ip == nil {
 				// TODO: send rejection.
+				return nil, nil
 			}
-
-		case dhcp4opts.DHCPRequest:
-			offered := s.getIP(pkt.CHAddr)
-
-			rip := dhcp4opts.GetRequestedIPAddress(pkt.Options)
-			var re *dhcp4.Packet
-			if !net.IP(rip).Equal(offered) {
-				// Client is confused about IP offered?
-				re = s.responsePacket(pkt, dhcp4opts.DHCPNAK)
-			} else {
-				re = s.responsePacket(pkt, dhcp4opts.DHCPACK)
-				re.CIAddr = pkt.CIAddr
-				re.YIAddr = offered
-				re.ServerName = s.sname
-				re.BootFile = s.filename
+			offer := s.responsePacket(pkt, offerType)
+			offer.YIAddr = ip
+			setLeaseTime(offer, lease)
+			return nil, s.decideBoot(d, key, offer, class, func() *dhcp4.Packet {
+				if rapid {
+					d.add("allocate", "%v: bound to the client by rapid commit", offer.YIAddr)
+					s.renew(d, key, pkt, lease.LeaseTime)
+					offer.Options.SetRapidCommit(true)
+				}
+				s.setOptions(d, offer, class, sub)
+				return offer
+			})
+		}
+		ip, probe := s.allocate(ctx, d, key, pkt, sub)
+		if probe {
+			return s.probeOffer(d, key, pkt, sub, ip, 1, offerIP)
+		}
+		return offerIP(ip)
+
+	case dhcp4opts.DHCPRequest:
+		sid := pkt.Options.ServerIdentifier()
+		if sid != nil && !sid.Equal(s.ServerID()) {
+			// The client chose another server's offer, so the
+			// address offered here is free again, see RFC 2131,
+			// Section 4.3.2.
+			d.add("allocate", "%v selects another server's offer", typ)
+			if _, pending := s.offers[key]; pending && !d.dryRun {
+				s.unbind(key)
 			}
-
-			if err := s.writePacket(conn, addr, re); err != nil {
-				// TODO: Undo address assignment.
-				return err
+			return nil, nil
+		}
+		if s.foreignRequest(key) {
+			d.add("coexist", "%v from a client without binding is for the other server", typ)
+			return nil, nil
+		}
+		if s.probing[key] {
+			// Not offered yet.
+			d.add("coexist", "%v while the client's address is probed", typ)
+			return nil, nil
+		}
+		// Clients renewing or rebinding their lease send its address in
+		// ciaddr instead, see RFC 2131, Section 4.3.2.
+		rip := net.IP(dhcp4opts.GetRequestedIPAddress(pkt.Options))
+		if rip == nil && !unspecified(pkt.CIAddr) {
+			rip = pkt.CIAddr
+		}
+		if rip != nil && !s.onLink(rip, sub) {
+			d.add("allocate", "NAK: %v is on the wrong network", rip)
+			return s.nak(pkt, "wrong network"), nil
+		}
+		offered := s.getIP(key)
+		if s.draining(offered) {
+			d.add("allocate", "NAK: %v is outside the pool", offered)
+			if !d.dryRun {
+				s.release(ctx, key, LeaseExpired)
+			}
+			return s.nak(pkt, "address outside the pool"), nil
+		}
+		if offered != nil && !s.onLink(offered, sub) {
+			// The client moved, see RFC 2131, Section 4.3.2.
+			d.add("allocate", "NAK: %v is not on the client's link", offered)
+			if !d.dryRun {
+				s.release(ctx, key, LeaseExpired)
 			}
+			return s.nak(pkt, "wrong network"), nil
+		}
 
-		case dhcp4opts.DHCPDecline, dhcp4opts.DHCPRelease:
-			// TODO
-			s.release(pkt.CHAddr)
+		lease := s.schedule(ctx, d, class)
+		if offered == nil && sid == nil {
+			// An INIT-REBOOT, renewing or rebinding client the server
+			// has no record of, see RFC 2131, Section 4.3.2.
+			d.add("allocate", "requested %v, but not bound: staying silent", rip)
+			return nil, nil
+		} else if offered == nil {
+			// The offer expired before the client selected it.
+			d.add("allocate", "NAK: requested %v, but not bound", rip)
+			return s.nak(pkt, "no binding"), nil
+		} else if !rip.Equal(offered) {
+			// Client is confused about IP offered?
+			d.add("allocate", "NAK: requested %v, but bound to %v", rip, offered)
+			return s.nak(pkt, "address not bound to the client"), nil
+		} else if lease.Refuse {
+			d.log("schedule", "Refusing lease to %v: not scheduled", addr)
+			return s.nak(pkt, "not scheduled"), nil
+		}
+		ack := s.responsePacket(pkt, dhcp4opts.DHCPACK)
+		ack.CIAddr = pkt.CIAddr
+		ack.YIAddr = offered
+		setLeaseTime(ack, lease)
+		return nil, s.decideBoot(d, key, ack, class, func() *dhcp4.Packet {
+			d.add("allocate", "%v: bound to the client", offered)
+			s.renew(d, key, pkt, lease.LeaseTime)
+			s.setOptions(d, ack, class, sub)
+			return ack
+		})
+
+	case dhcp4opts.DHCPDecline, dhcp4opts.DHCPRelease:
+		// A declined address is in use by another host: RFC 2131,
+		// Section 4.3.3 has the server mark it as not available.
+		if b, ok := s.leases.Lookup(string(key)); ok && typ == dhcp4opts.DHCPDecline && !d.dryRun {
+			d.log("decline", "Conflict: %v declined by %v", b.IP, addr)
+			s.learnConflict(b.IP, "decline", time.Now())
+		}
+		d.add("release", "binding %q is released", key)
+		if !d.dryRun {
+			s.release(ctx, key, LeaseReleased)
+		}
 
-		case dhcp4opts.DHCPInform:
-			// TODO
+	case 0:
+		return s.answerBOOTP(ctx, d, addr, pkt, class)
 
-		case dhcp4opts.DHCPOffer, dhcp4opts.DHCPACK, dhcp4opts.DHCPNAK:
-			// DHCP servers ignore these according to RFC 2131,
-			// Section 4.3.
+	case dhcp4opts.DHCPInform:
+		// TODO
 
-		default:
-			logger.Printf("DHCP message with unknown type %v", typ)
-			continue
+	case dhcp4opts.DHCPLeaseQuery:
+		if !s.allowLeaseQuery(addr, pkt) {
+			d.log("leasequery", "Ignoring %v from %v: not allowed", typ, addr)
+			return nil, nil
 		}
+		return s.answerLeaseQuery(d, pkt, time.Now()), nil
+
+	case dhcp4opts.DHCPOffer, dhcp4opts.DHCPACK, dhcp4opts.DHCPNAK,
+		dhcp4opts.DHCPLeaseUnassigned, dhcp4opts.DHCPLeaseUnknown, dhcp4opts.DHCPLeaseActive:
+		// DHCP servers ignore these according to RFC 2131,
+		// Section 4.3.
+		d.add("classify", "%v is ignored by servers", typ)
+
+	default:
+		d.log("classify", "DHCP message with unknown type %v", typ)
 	}
+	return nil, nil
 }
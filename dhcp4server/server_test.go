@@ -0,0 +1,426 @@
+package dhcp4server
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"log"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+	"github.com/mergetb/dhcp4/dhcp4opts"
+)
+
+// recordConn is a net.PacketConn that records written packets.
+type recordConn struct {
+	net.PacketConn
+	sent []*dhcp4.Packet
+}
+
+func (rc *recordConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	p, err := dhcp4.ParsePacket(b)
+	if err != nil {
+		return 0, err
+	}
+	rc.sent = append(rc.sent, p)
+	return len(b), nil
+}
+
+func (rc *recordConn) SetReadDeadline(time.Time) error {
+	return nil
+}
+
+var (
+	testLogger = log.New(ioutil.Discard, "", 0)
+	testPeer   = &net.UDPAddr{IP: net.IPv4zero, Port: 68}
+)
+
+func newTestServer(t *testing.T, opts ...ServerOpt) *Server {
+	_, subnet, err := net.ParseCIDR("192.168.1.0/24")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New(net.IP{192, 168, 0, 1}, subnet, "", "boot.img", opts...)
+}
+
+func newRequest(typ dhcp4opts.DHCPMessageType, mac net.HardwareAddr) *dhcp4.Packet {
+	p := dhcp4.NewPacket(dhcp4.BootRequest)
+	p.SetHardwareAddr(mac)
+	p.TransactionID = [4]byte{1, 2, 3, 4}
+	p.Options.Add(dhcp4.OptionDHCPMessageType, typ)
+	return p
+}
+
+// newRelease returns the DHCPRELEASE of ip by mac to s.
+func newRelease(s *Server, mac net.HardwareAddr, ip net.IP) *dhcp4.Packet {
+	p := newRequest(dhcp4opts.DHCPRelease, mac)
+	p.CIAddr = ip
+	p.Options.SetServerIdentifier(s.ServerID())
+	return p
+}
+
+// exchange has s handle request and returns the response sent, if any.
+func exchange(t *testing.T, s *Server, request *dhcp4.Packet) *dhcp4.Packet {
+	var conn recordConn
+	ctx, cancel := s.requestContext(context.Background(), testPeer)
+	defer cancel()
+	if err := s.handle(ctx, testLogger, &conn, testPeer, request); err != nil {
+		t.Fatalf("handle() = %v", err)
+	}
+	switch len(conn.sent) {
+	case 0:
+		return nil
+	case 1:
+		return conn.sent[0]
+	default:
+		t.Fatalf("server sent %d responses, want at most 1", len(conn.sent))
+		return nil
+	}
+}
+
+func TestIPXEChainload(t *testing.T) {
+	s := newTestServer(t, WithIPXE("undionly.kpxe", "http://boot/script.ipxe"))
+
+	pxe := newRequest(dhcp4opts.DHCPDiscover, net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 1})
+	if offer := exchange(t, s, pxe); offer == nil || offer.BootFile != "undionly.kpxe" {
+		t.Errorf("PXE client got offer %v, want boot file undionly.kpxe", offer)
+	}
+
+	ipxe := newRequest(dhcp4opts.DHCPDiscover, net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 1})
+	ipxe.Options.AddRaw(dhcp4.OptionUserClass, []byte("iPXE"))
+	if offer := exchange(t, s, ipxe); offer == nil || offer.BootFile != "http://boot/script.ipxe" {
+		t.Errorf("iPXE client got offer %v, want boot file http://boot/script.ipxe", offer)
+	}
+}
+
+func TestBootDecider(t *testing.T) {
+	installer := net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 1}
+	s := newTestServer(t, WithBootDecider(func(ctx context.Context, req Classification) BootParams {
+		if req.HardwareAddr.String() == installer.String() {
+			return BootParams{BootFile: "installer.img", NextServer: net.IP{10, 0, 0, 1}}
+		}
+		return BootParams{BootFile: "disk.img"}
+	}))
+
+	offer := exchange(t, s, newRequest(dhcp4opts.DHCPDiscover, installer))
+	if offer == nil || offer.BootFile != "installer.img" || !offer.SIAddr.Equal(net.IP{10, 0, 0, 1}) {
+		t.Errorf("installer got offer %v, want installer.img from 10.0.0.1", offer)
+	}
+
+	offer = exchange(t, s, newRequest(dhcp4opts.DHCPDiscover, net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 2}))
+	if offer == nil || offer.BootFile != "disk.img" || !offer.SIAddr.Equal(s.ip) {
+		t.Errorf("other node got offer %v, want disk.img from %v", offer, s.ip)
+	}
+}
+
+func TestSlowBootDecider(t *testing.T) {
+	slow := net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 1}
+	deciding := make(chan struct{})
+	release := make(chan struct{})
+	s := newTestServer(t, WithBootDecider(func(ctx context.Context, req Classification) BootParams {
+		if req.HardwareAddr.String() == slow.String() {
+			close(deciding)
+			<-release
+		}
+		return BootParams{BootFile: "boot.img"}
+	}))
+
+	done := make(chan *dhcp4.Packet)
+	go func() {
+		done <- exchange(t, s, newRequest(dhcp4opts.DHCPDiscover, slow))
+	}()
+	<-deciding
+
+	// Other clients are served while the decider is busy.
+	other := make(chan *dhcp4.Packet)
+	go func() {
+		other <- exchange(t, s, newRequest(dhcp4opts.DHCPDiscover, net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 2}))
+	}()
+	select {
+	case offer := <-other:
+		if offer == nil || offer.BootFile != "boot.img" {
+			t.Errorf("other client got offer %v, want boot.img", offer)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("other client not served while the boot decider blocks")
+	}
+
+	close(release)
+	if offer := <-done; offer == nil || offer.BootFile != "boot.img" {
+		t.Errorf("slow client got offer %v, want boot.img", offer)
+	}
+}
+
+func TestBootDeciderRelease(t *testing.T) {
+	slow := net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 1}
+	deciding := make(chan net.IP)
+	release := make(chan struct{})
+	s := newTestServer(t, WithBootDecider(func(ctx context.Context, req Classification) BootParams {
+		if req.HardwareAddr.String() == slow.String() {
+			deciding <- req.IP
+			<-release
+		}
+		return BootParams{BootFile: "boot.img"}
+	}))
+
+	done := make(chan *dhcp4.Packet)
+	go func() {
+		done <- exchange(t, s, newRequest(dhcp4opts.DHCPDiscover, slow))
+	}()
+	ip := <-deciding
+
+	// The slow client releases its address while the decider is busy, and
+	// another client is offered it.
+	exchange(t, s, newRelease(s, slow, ip))
+	if offer := exchange(t, s, newRequest(dhcp4opts.DHCPDiscover, net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 2})); offer == nil || !offer.YIAddr.Equal(ip) {
+		t.Fatalf("other client got offer %v, want %v", offer, ip)
+	}
+
+	close(release)
+	if offer := <-done; offer != nil {
+		t.Errorf("slow client got offer of %v after releasing it, want none", offer.YIAddr)
+	}
+}
+
+func TestBootPlacement(t *testing.T) {
+	mac := net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 1}
+	for _, tt := range []struct {
+		place      dhcp4.BootPlacement
+		wantField  string
+		wantOption string
+	}{
+		{place: dhcp4.BootFields, wantField: "boot.img"},
+		{place: dhcp4.BootOptions, wantOption: "boot.img"},
+		{place: dhcp4.BootBoth, wantField: "boot.img", wantOption: "boot.img"},
+	} {
+		t.Run(tt.place.String(), func(t *testing.T) {
+			s := newTestServer(t, WithBootPlacement(tt.place))
+			offer := exchange(t, s, newRequest(dhcp4opts.DHCPDiscover, mac))
+			if offer == nil {
+				t.Fatal("no offer")
+			}
+			if offer.BootFile != tt.wantField || offer.Options.BootFileName() != tt.wantOption {
+				t.Errorf("offer has file %q and boot file name option %q, want %q and %q", offer.BootFile, offer.Options.BootFileName(), tt.wantField, tt.wantOption)
+			}
+			if got := offer.BootInfo().BootFile; got != "boot.img" {
+				t.Errorf("offer BootInfo().BootFile = %q, want boot.img", got)
+			}
+		})
+	}
+}
+
+func TestBootDeciderRelayAgentInfo(t *testing.T) {
+	s := newTestServer(t, WithBootDecider(func(ctx context.Context, req Classification) BootParams {
+		if req.RelayAgentInfo != nil {
+			return BootParams{BootFile: string(req.RelayAgentInfo.CircuitID) + ".img"}
+		}
+		return BootParams{BootFile: "default.img"}
+	}))
+
+	req := newRequest(dhcp4opts.DHCPDiscover, net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 1})
+	req.Options.SetRelayAgentInfo(&dhcp4.RelayAgentInfo{CircuitID: []byte("rack1-port7")})
+	if offer := exchange(t, s, req); offer == nil || offer.BootFile != "default.img" {
+		t.Errorf("unrelayed request got offer %v, want default.img", offer)
+	}
+
+	req.GIAddr = net.IP{192, 168, 1, 254}
+	if offer := exchange(t, s, req); offer == nil || offer.BootFile != "rack1-port7.img" {
+		t.Errorf("relayed request got offer %v, want rack1-port7.img", offer)
+	}
+}
+
+type recordTracer []string
+
+func (rt *recordTracer) StartSpan(ctx context.Context, name string) (context.Context, func()) {
+	*rt = append(*rt, name)
+	return ctx, func() {}
+}
+
+func TestRequestContext(t *testing.T) {
+	var tracer recordTracer
+	var info RequestInfo
+	s := newTestServer(t,
+		WithTracer(&tracer),
+		WithRequestTimeout(10*time.Millisecond),
+		WithBootDecider(func(ctx context.Context, req Classification) BootParams {
+			info, _ = RequestInfoFromContext(ctx)
+			// Be a slow external dependency.
+			<-ctx.Done()
+			return BootParams{}
+		}))
+
+	mac := net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 1}
+	if offer := exchange(t, s, newRequest(dhcp4opts.DHCPDiscover, mac)); offer != nil {
+		t.Errorf("got offer %v after request timed out, want none", offer)
+	}
+	if info.Peer != testPeer {
+		t.Errorf("RequestInfo.Peer = %v, want %v", info.Peer, testPeer)
+	}
+
+	want := []string{"dhcp4server.handle", "dhcp4server.classify", "dhcp4server.allocate", "dhcp4server.boot"}
+	if len(tracer) != len(want) {
+		t.Fatalf("got spans %v, want %v", tracer, want)
+	}
+	for i := range want {
+		if tracer[i] != want[i] {
+			t.Errorf("got spans %v, want %v", tracer, want)
+			break
+		}
+	}
+}
+
+func TestSharedOptions(t *testing.T) {
+	s := newTestServer(t)
+	for _, mac := range []net.HardwareAddr{
+		{0, 0, 0x5e, 0, 0x53, 1},
+		{0, 0, 0x5e, 0, 0x53, 2},
+	} {
+		offer := exchange(t, s, newRequest(dhcp4opts.DHCPDiscover, mac))
+		if offer == nil {
+			t.Fatalf("got no offer for %v", mac)
+		}
+		if got := dhcp4opts.GetDHCPMessageType(offer.Options); got != dhcp4opts.DHCPOffer {
+			t.Errorf("got message type %v, want %v", got, dhcp4opts.DHCPOffer)
+		}
+		if got := net.IP(dhcp4opts.GetServerIdentifier(offer.Options)); !got.Equal(s.ip) {
+			t.Errorf("got server identifier %v, want %v", got, s.ip)
+		}
+	}
+	if got := len(s.options.blocks); got != 1 {
+		t.Errorf("got %d cached option blocks, want 1", got)
+	}
+}
+
+func TestResponseSize(t *testing.T) {
+	for _, tt := range []struct {
+		desc    string
+		maxSize uint16
+		trim    []dhcp4.OptionCode
+		want    bool
+		trimmed bool
+	}{
+		{desc: "fits", maxSize: 1500, want: true},
+		{desc: "too large", maxSize: 576},
+		{desc: "too large without option 57"},
+		{desc: "trimmed", maxSize: 576, trim: []dhcp4.OptionCode{dhcp4.OptionRouters, dhcp4.OptionClientIdentifier}, want: true, trimmed: true},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			s := newTestServer(t, WithTrimOrder(tt.trim...))
+			req := newRequest(dhcp4opts.DHCPDiscover, net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 1})
+			req.GIAddr = net.IP{192, 168, 1, 254}
+			req.Options.SetClientIdentifier(bytes.Repeat([]byte{1}, 255))
+			req.Options[dhcp4.OptionRelayAgentInformation] = append([]byte{1, 253}, bytes.Repeat([]byte{'a'}, 253)...)
+			if tt.maxSize != 0 {
+				req.Options.SetMaximumDHCPMessageSize(tt.maxSize)
+			}
+
+			offer := exchange(t, s, req)
+			if (offer != nil) != tt.want {
+				t.Fatalf("got offer %v, want one: %t", offer, tt.want)
+			}
+			if offer == nil {
+				return
+			}
+			if got := offer.Options.Get(dhcp4.OptionClientIdentifier) == nil; got != tt.trimmed {
+				t.Errorf("client identifier left out: %t, want %t", got, tt.trimmed)
+			}
+			if offer.Options.Get(dhcp4.OptionRelayAgentInformation) == nil {
+				t.Errorf("relay agent information left out")
+			}
+		})
+	}
+}
+
+func TestInvalidRequests(t *testing.T) {
+	mac := net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 1}
+
+	for _, tt := range []struct {
+		desc    string
+		request func(s *Server, ip net.IP) *dhcp4.Packet
+	}{
+		{
+			desc: "discover with ciaddr",
+			request: func(s *Server, ip net.IP) *dhcp4.Packet {
+				p := newRequest(dhcp4opts.DHCPDiscover, mac)
+				p.CIAddr = ip
+				return p
+			},
+		},
+		{
+			desc: "request with requested IP and ciaddr",
+			request: func(s *Server, ip net.IP) *dhcp4.Packet {
+				p := newRequest(dhcp4opts.DHCPRequest, mac)
+				p.CIAddr = ip
+				p.Options.SetRequestedIPAddress(ip)
+				return p
+			},
+		},
+		{
+			desc: "release without server identifier",
+			request: func(s *Server, ip net.IP) *dhcp4.Packet {
+				p := newRelease(s, mac, ip)
+				delete(p.Options, dhcp4.OptionServerIdentifier)
+				return p
+			},
+		},
+		{
+			desc: "decline without requested IP",
+			request: func(s *Server, ip net.IP) *dhcp4.Packet {
+				p := newRequest(dhcp4opts.DHCPDecline, mac)
+				p.Options.SetServerIdentifier(s.ServerID())
+				return p
+			},
+		},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			s := newTestServer(t)
+			ip := bind(t, s, mac, "")
+
+			if resp := exchange(t, s, tt.request(s, ip)); resp != nil {
+				t.Errorf("got %v, want no response", resp)
+			}
+			if leases := s.Leases(HistoryQuery{}); len(leases) != 1 || !leases[0].Active() {
+				t.Errorf("leases %v, want the lease of %v kept", leases, ip)
+			}
+		})
+	}
+}
+
+func TestDecline(t *testing.T) {
+	mac := net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 1}
+	for _, tt := range []struct {
+		name string
+		opts []ServerOpt
+	}{
+		{name: "default"},
+		{name: "sticky", opts: []ServerOpt{WithAllocationStrategy(AllocateSticky)}},
+		{name: "hash", opts: []ServerOpt{WithAllocationStrategy(AllocateHash)}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, tt.opts...)
+			ip := bind(t, s, mac, "")
+
+			decline := newRequest(dhcp4opts.DHCPDecline, mac)
+			decline.Options.SetRequestedIPAddress(ip)
+			decline.Options.SetServerIdentifier(s.ServerID())
+			if resp := exchange(t, s, decline); resp != nil {
+				t.Fatalf("DECLINE got %v, want no response", resp)
+			}
+			if cs := s.Conflicts(); len(cs) != 1 || !cs[0].IP.Equal(ip) || cs[0].Source != "decline" {
+				t.Errorf("conflicts %+v, want %v declined", cs, ip)
+			}
+
+			// Neither the client nor another one is offered the
+			// declined address, even if they request it.
+			for _, m := range []net.HardwareAddr{mac, {0, 0, 0x5e, 0, 0x53, 2}} {
+				discover := newRequest(dhcp4opts.DHCPDiscover, m)
+				discover.Options.SetRequestedIPAddress(ip)
+				if offer := exchange(t, s, discover); offer == nil || offer.YIAddr.Equal(ip) {
+					t.Errorf("%v was offered %v, want an address other than the declined %v", m, offer, ip)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4server
+
+import (
+	"fmt"
+	"net"
+)
+
+// WithServerID configures the address the server identifies itself with in
+// option 54, which clients unicast renewals and releases to.
+//
+// Multi-homed servers, and servers reached through NAT or relays, need it to
+// be the address clients of the subnet can reach, which may differ from the
+// address passed to New. Check it with CheckServerID.
+//
+// Default is the address passed to New.
+func WithServerID(id net.IP) ServerOpt {
+	return func(s *Server) {
+		s.serverID = id.To4()
+	}
+}
+
+// ServerID returns the address the server identifies itself with in option
+// 54.
+func (s *Server) ServerID() net.IP {
+	if s.serverID != nil {
+		return s.serverID
+	}
+	return s.ip
+}
+
+// CheckServerID returns an error if clients on subnet could not reach the
+// server at id: if id is not a unicast IPv4 address, if it is the network or
+// broadcast address of subnet, or if it is not an address of this host.
+func CheckServerID(id net.IP, subnet *net.IPNet) error {
+	if err := checkServerIDFormat(id, subnet); err != nil {
+		return err
+	}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return err
+	}
+	for _, a := range addrs {
+		if n, ok := a.(*net.IPNet); ok && n.IP.Equal(id) {
+			return nil
+		}
+	}
+	return fmt.Errorf("server identifier %v is not an address of this host", id)
+}
+
+// checkServerIDFormat checks the parts of CheckServerID that do not depend
+// on the host.
+func checkServerIDFormat(id net.IP, subnet *net.IPNet) error {
+	ip := id.To4()
+	if ip == nil || ip.IsUnspecified() || ip.IsLoopback() || ip.IsMulticast() || ip.Equal(net.IPv4bcast) {
+		return fmt.Errorf("server identifier %v is not a unicast IPv4 address", id)
+	}
+	if subnet != nil && subnet.Contains(ip) {
+		network := subnet.IP.Mask(subnet.Mask).To4()
+		broadcast := make(net.IP, net.IPv4len)
+		for i := range broadcast {
+			broadcast[i] = network[i] | ^subnet.Mask[len(subnet.Mask)-net.IPv4len+i]
+		}
+		if ip.Equal(network) || ip.Equal(broadcast) {
+			return fmt.Errorf("server identifier %v is the network or broadcast address of %v", id, subnet)
+		}
+	}
+	return nil
+}
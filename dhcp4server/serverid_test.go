@@ -0,0 +1,57 @@
+package dhcp4server
+
+import (
+	"net"
+	"testing"
+
+	"github.com/mergetb/dhcp4"
+	"github.com/mergetb/dhcp4/dhcp4opts"
+)
+
+func TestWithServerID(t *testing.T) {
+	id := net.IP{192, 168, 1, 1}
+	s := newTestServer(t, WithServerID(id))
+	offer := exchange(t, s, newRequest(dhcp4opts.DHCPDiscover, net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 1}))
+	if offer == nil {
+		t.Fatal("got no offer")
+	}
+	if got := net.IP(dhcp4opts.GetServerIdentifier(offer.Options)); !got.Equal(id) {
+		t.Errorf("got server identifier %v, want %v", got, id)
+	}
+	if got := offer.Options[dhcp4.OptionServerIdentifier]; len(got) != net.IPv4len {
+		t.Errorf("got %d byte server identifier, want %d", len(got), net.IPv4len)
+	}
+}
+
+func TestCheckServerIDFormat(t *testing.T) {
+	_, subnet, err := net.ParseCIDR("192.168.1.0/24")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		id    net.IP
+		valid bool
+	}{
+		{id: net.IP{192, 168, 1, 1}, valid: true},
+		// Reached through a relay.
+		{id: net.IP{10, 0, 0, 1}, valid: true},
+		{id: net.IP{192, 168, 1, 0}},
+		{id: net.IP{192, 168, 1, 255}},
+		{id: net.IPv4zero},
+		{id: net.IPv4bcast},
+		{id: net.IP{127, 0, 0, 1}},
+		{id: net.IP{224, 0, 0, 1}},
+		{id: net.ParseIP("2001:db8::1")},
+		{id: nil},
+	} {
+		if err := checkServerIDFormat(tt.id, subnet); (err == nil) != tt.valid {
+			t.Errorf("checkServerIDFormat(%v) = %v, want valid %v", tt.id, err, tt.valid)
+		}
+	}
+}
+
+func TestCheckServerID(t *testing.T) {
+	if err := CheckServerID(net.IP{192, 0, 2, 1}, nil); err == nil {
+		t.Errorf("CheckServerID() of an address of no interface = nil, want error")
+	}
+}
@@ -0,0 +1,223 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// stateLockWait is how long DumpState waits for the lock protecting the
+// lease table.
+var stateLockWait = time.Second
+
+// ServerState is a snapshot of the runtime state of a server, see
+// Server.DumpState.
+type ServerState struct {
+	Time     time.Time `json:"time"`
+	ServerIP string    `json:"server_ip"`
+	ServerID string    `json:"server_id"`
+
+	KeyPolicy       string `json:"key_policy"`
+	Workers         int    `json:"workers"`
+	QueueSize       int    `json:"queue_size"`
+	SecsPriority    bool   `json:"secs_priority"`
+	MessagePriority bool   `json:"message_priority"`
+
+	// Serving is whether ServeContext is running.
+	Serving bool `json:"serving"`
+
+	// Handling are the requests being handled by workers, the longest
+	// running first.
+	Handling []RequestState `json:"handling"`
+
+	// Queued are the requests waiting for a worker, in the order they
+	// will be handled.
+	Queued []RequestState `json:"queued"`
+
+	// Dropped is the number of requests ServeContext dropped without
+	// handling them, by reason: malformed, not a request, over a rate
+	// limit, queue full or waited too long for a worker.
+	Dropped map[string]uint64 `json:"dropped"`
+
+	// KeyPolicy and Leases are empty if the lease table was locked for
+	// too long, e.g. by a hung request, in which case LeasesError says so.
+	Leases      *LeaseSummary `json:"leases,omitempty"`
+	LeasesError string        `json:"leases_error,omitempty"`
+
+	// History is the number of retained ended leases.
+	History int `json:"history"`
+}
+
+// RequestState describes a request being handled or waiting for a worker.
+type RequestState struct {
+	Peer         string `json:"peer"`
+	MessageType  string `json:"message_type"`
+	HardwareAddr string `json:"hardware_addr"`
+	XID          string `json:"xid"`
+	Secs         uint16 `json:"secs"`
+
+	// Since is when the request was queued or when handling it started.
+	Since time.Time `json:"since"`
+}
+
+// LeaseSummary summarizes the lease table.
+type LeaseSummary struct {
+	// Bindings is the number of bound addresses.
+	Bindings int `json:"bindings"`
+
+	// Exhausted is whether no address is free.
+	Exhausted bool `json:"exhausted"`
+
+	// OldestRenewal is when the binding renewed least recently was
+	// renewed, if there are any bindings.
+	OldestRenewal *time.Time `json:"oldest_renewal,omitempty"`
+
+	// PendingOffers are the addresses offered but not requested yet, the
+	// one expiring first first.
+	PendingOffers []PendingOffer `json:"pending_offers"`
+
+	// Conflicts are the addresses learned in use in coexistence mode,
+	// see WithCoexistence.
+	Conflicts []Conflict `json:"conflicts,omitempty"`
+}
+
+// requestTracker tracks the requests of a running ServeContext.
+type requestTracker struct {
+	mu       sync.Mutex
+	queue    *requestQueue
+	handling map[*queuedRequest]time.Time
+}
+
+func (rt *requestTracker) serve(q *requestQueue) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.queue = q
+	rt.handling = make(map[*queuedRequest]time.Time)
+}
+
+func (rt *requestTracker) stop() {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.queue = nil
+	rt.handling = nil
+}
+
+func (rt *requestTracker) start(r *queuedRequest) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if rt.handling != nil {
+		rt.handling[r] = time.Now()
+	}
+}
+
+func (rt *requestTracker) done(r *queuedRequest) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	delete(rt.handling, r)
+}
+
+func newRequestState(r *queuedRequest, since time.Time) RequestState {
+	return RequestState{
+		Peer:         r.addr.String(),
+		MessageType:  r.pkt.Options.MessageType().String(),
+		HardwareAddr: r.pkt.HardwareAddr().String(),
+		XID:          fmt.Sprintf("%x", r.pkt.TransactionID),
+		Secs:         r.pkt.Secs,
+		Since:        since,
+	}
+}
+
+// DumpState returns a snapshot of the runtime state of s, for debugging a
+// live server.
+//
+// DumpState does not wait more than a second for requests holding the lease
+// table, so that it works while a request hangs.
+func (s *Server) DumpState() *ServerState {
+	st := &ServerState{
+		Time:            time.Now(),
+		ServerIP:        s.ip.String(),
+		ServerID:        s.ServerID().String(),
+		Workers:         s.workers,
+		QueueSize:       s.queueSize,
+		SecsPriority:    s.secsPriority,
+		MessagePriority: s.messagePriority,
+		Handling:        []RequestState{},
+		Queued:          []RequestState{},
+		History:         s.history.Len(),
+		Dropped:         s.drops.snapshot(),
+	}
+
+	s.requests.mu.Lock()
+	st.Serving = s.requests.queue != nil
+	for r, since := range s.requests.handling {
+		st.Handling = append(st.Handling, newRequestState(r, since))
+	}
+	q := s.requests.queue
+	s.requests.mu.Unlock()
+	sort.Slice(st.Handling, func(i, j int) bool { return st.Handling[i].Since.Before(st.Handling[j].Since) })
+	if q != nil {
+		for _, r := range q.snapshot() {
+			st.Queued = append(st.Queued, newRequestState(r, r.queued))
+		}
+	}
+
+	type leaseState struct {
+		keyPolicy KeyPolicy
+		summary   *LeaseSummary
+	}
+	// The buffer lets the goroutine finish if DumpState gave up waiting.
+	ls := make(chan leaseState, 1)
+	go func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		sum := &LeaseSummary{
+			Exhausted:     s.leases.Free(nil) == nil,
+			PendingOffers: s.pendingOffers(),
+			Conflicts:     s.conflicts(),
+		}
+		for _, b := range s.leases.All() {
+			sum.Bindings++
+			if sum.OldestRenewal == nil || b.Renewed.Before(*sum.OldestRenewal) {
+				renewed := b.Renewed
+				sum.OldestRenewal = &renewed
+			}
+		}
+		ls <- leaseState{s.keyPolicy, sum}
+	}()
+	select {
+	case l := <-ls:
+		st.KeyPolicy = l.keyPolicy.String()
+		st.Leases = l.summary
+	case <-time.After(stateLockWait):
+		st.LeasesError = fmt.Sprintf("lease table locked for more than %v", stateLockWait)
+	}
+	return st
+}
+
+// WriteState writes the runtime state of s, see DumpState, to w as indented
+// JSON.
+func (s *Server) WriteState(w io.Writer) error {
+	b, err := json.MarshalIndent(s.DumpState(), "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+func (s *Server) serveState(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	s.WriteState(w)
+}
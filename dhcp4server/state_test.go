@@ -0,0 +1,71 @@
+package dhcp4server
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mergetb/dhcp4/dhcp4opts"
+)
+
+func TestDumpState(t *testing.T) {
+	s := newTestServer(t, WithSecsPriority())
+	mac := net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 1}
+	exchange(t, s, newRequest(dhcp4opts.DHCPDiscover, mac))
+
+	st := s.DumpState()
+	if st.Serving || len(st.Handling) != 0 || len(st.Queued) != 0 {
+		t.Errorf("DumpState() of idle server = %+v, want no requests", st)
+	}
+	if st.Leases == nil || st.Leases.Bindings != 1 || st.Leases.OldestRenewal == nil {
+		t.Errorf("DumpState().Leases = %+v, want 1 binding", st.Leases)
+	}
+
+	// Pretend to serve a request that hangs holding the lease table and
+	// one that waits for a worker.
+	q := newRequestQueue(s.queueSize, s.secsPriority, s.messagePriority)
+	s.requests.serve(q)
+	defer s.requests.stop()
+	hung, waiting := queued(10), queued(3)
+	hung.addr = &net.UDPAddr{IP: net.IPv4zero, Port: clientPort}
+	waiting.addr = &net.UDPAddr{IP: net.IP{192, 168, 0, 3}, Port: serverPort}
+	s.requests.start(hung)
+	q.push(waiting)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	defer func(d time.Duration) { stateLockWait = d }(stateLockWait)
+	stateLockWait = 10 * time.Millisecond
+	st = s.DumpState()
+	if !st.Serving {
+		t.Errorf("DumpState().Serving = false, want true")
+	}
+	if len(st.Handling) != 1 || st.Handling[0].Secs != 10 {
+		t.Errorf("DumpState().Handling = %+v, want the hung request", st.Handling)
+	}
+	if len(st.Queued) != 1 || st.Queued[0].Peer != "192.168.0.3:67" {
+		t.Errorf("DumpState().Queued = %+v, want the waiting request", st.Queued)
+	}
+	if st.Leases != nil || st.LeasesError == "" {
+		t.Errorf("DumpState() with locked lease table = %+v, %q, want error", st.Leases, st.LeasesError)
+	}
+}
+
+func TestAdminState(t *testing.T) {
+	s := newTestServer(t)
+	rec := httptest.NewRecorder()
+	s.AdminHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/state", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /state = %d, want %d", rec.Code, http.StatusOK)
+	}
+	var st ServerState
+	if err := json.Unmarshal(rec.Body.Bytes(), &st); err != nil {
+		t.Fatalf("GET /state returned invalid JSON: %v", err)
+	}
+	if st.Leases == nil || st.Workers != 1 {
+		t.Errorf("GET /state = %+v, want lease summary and 1 worker", st)
+	}
+}
@@ -0,0 +1,221 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4server
+
+import (
+	"net"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+)
+
+// Subnet is a network whose clients the server serves through relay agents,
+// e.g. in a routed topology.
+type Subnet struct {
+	// Network is the network of the clients. Relayed requests are served
+	// from the subnet whose Network contains the link selection
+	// sub-option (RFC 3527) of their relay agent information, or, without
+	// one, their relay agent address (giaddr).
+	Network *net.IPNet
+
+	// Leases stores the bindings of the subnet. Default is
+	// NewMemoryLeases(Network).
+	Leases Leases
+
+	// Options are sent to clients on the subnet, replacing options with
+	// the same codes of WithOptions, e.g. their routers. The subnet mask
+	// is that of Network unless set here.
+	Options dhcp4.Options
+}
+
+// WithSubnets makes the server serve relayed clients on subnets. Addresses
+// of relayed clients are allocated from the subnet of their link, and
+// replies are sent to the relay agent. Requests relayed from links in no
+// subnet are served from the server's own pool if it contains the link,
+// and dropped otherwise.
+//
+// Link selection sub-options are trusted: use TrustRelayAgentInfo to drop
+// those clients may have spoofed. Address ranges of WithAddressRange only
+// apply to the server's own pool, and the relay agent's address is never
+// allocated to its clients.
+//
+// Default is to serve all clients from the server's own pool.
+func WithSubnets(subnets ...Subnet) ServerOpt {
+	return func(s *Server) {
+		for _, sub := range subnets {
+			if sub.Leases == nil {
+				sub.Leases = NewMemoryLeases(sub.Network)
+			}
+			s.subnets = append(s.subnets, sub)
+		}
+	}
+}
+
+// linkAddr returns the address of the link the client of request is on, or
+// nil if it is on the server's own link.
+func linkAddr(request *dhcp4.Packet) net.IP {
+	if unspecified(request.GIAddr) {
+		return nil
+	}
+	if info := request.Options.RelayAgentInfo(); info != nil && !unspecified(info.LinkSelection) {
+		return info.LinkSelection
+	}
+	return request.GIAddr
+}
+
+// subnetFor returns the subnet the client of request is on, or nil for the
+// server's own pool. It returns false if the server serves no subnet on the
+// link.
+func (s *Server) subnetFor(d *decisions, request *dhcp4.Packet) (*Subnet, bool) {
+	link := linkAddr(request)
+	if link == nil {
+		return nil, true
+	}
+	if sub := s.subnetContaining(link); sub != nil {
+		d.add("subnet", "link %v is on subnet %v", link, sub.Network)
+		return sub, true
+	}
+	if rl, ok := s.local.(ResizableLeases); ok && !rl.Pool().Contains(link) {
+		return nil, false
+	}
+	d.add("subnet", "link %v is on the server's pool", link)
+	return nil, true
+}
+
+// subnetContaining returns the subnet containing ip, or nil if there is
+// none.
+func (s *Server) subnetContaining(ip net.IP) *Subnet {
+	for i := range s.subnets {
+		if s.subnets[i].Network.Contains(ip) {
+			return &s.subnets[i]
+		}
+	}
+	return nil
+}
+
+// onLink returns whether ip may be bound to a client on sub, or on the
+// server's own link if sub is nil.
+func (s *Server) onLink(ip net.IP, sub *Subnet) bool {
+	if sub == nil {
+		return s.subnetContaining(ip) == nil
+	}
+	return sub.Network.Contains(ip)
+}
+
+// leasesFor returns the Leases allocating addresses to clients on sub.
+func (s *Server) leasesFor(sub *Subnet) Leases {
+	if sub == nil {
+		return s.local
+	}
+	return sub.Leases
+}
+
+// setSubnetOptions adds the options of sub to response.
+func setSubnetOptions(d *decisions, response *dhcp4.Packet, sub *Subnet) {
+	if sub == nil {
+		return
+	}
+	var n int
+	for code, v := range sub.Options {
+		if _, ok := response.Options[code]; !ok {
+			response.Options[code] = v
+			n++
+		}
+	}
+	if _, ok := response.Options[dhcp4.OptionSubnetMask]; !ok {
+		response.Options[dhcp4.OptionSubnetMask] = []byte(sub.Network.Mask)
+		n++
+	}
+	d.add("options", "%d options from subnet %v", n, sub.Network)
+}
+
+// subnetLeases are the Leases of the server's own pool and of its subnets.
+// Clients are bound in the pool of their link only, so lookups by key try
+// all of them.
+type subnetLeases struct {
+	local   Leases
+	subnets []Subnet
+}
+
+var _ excluder = &subnetLeases{}
+
+// leasesFor returns the Leases of the pool containing ip.
+func (sl *subnetLeases) leasesFor(ip net.IP) Leases {
+	for _, sub := range sl.subnets {
+		if ip != nil && sub.Network.Contains(ip) {
+			return sub.Leases
+		}
+	}
+	return sl.local
+}
+
+func (sl *subnetLeases) all() []Leases {
+	ls := []Leases{sl.local}
+	for _, sub := range sl.subnets {
+		ls = append(ls, sub.Leases)
+	}
+	return ls
+}
+
+// Allocate implements Leases.Allocate. New bindings are made in the pool
+// containing requested.
+func (sl *subnetLeases) Allocate(b Binding, requested net.IP) (Binding, error) {
+	if existing, ok := sl.Lookup(b.Key); ok {
+		return existing, nil
+	}
+	return sl.leasesFor(requested).Allocate(b, requested)
+}
+
+// Free implements Leases.Free.
+func (sl *subnetLeases) Free(requested net.IP) net.IP {
+	return sl.leasesFor(requested).Free(requested)
+}
+
+// Renew implements Leases.Renew.
+func (sl *subnetLeases) Renew(key string, now time.Time) (Binding, error) {
+	for _, l := range sl.all() {
+		if _, ok := l.Lookup(key); ok {
+			return l.Renew(key, now)
+		}
+	}
+	return Binding{}, ErrNotBound
+}
+
+// Release implements Leases.Release.
+func (sl *subnetLeases) Release(key string) (Binding, error) {
+	for _, l := range sl.all() {
+		if _, ok := l.Lookup(key); ok {
+			return l.Release(key)
+		}
+	}
+	return Binding{}, ErrNotBound
+}
+
+// Lookup implements Leases.Lookup.
+func (sl *subnetLeases) Lookup(key string) (Binding, bool) {
+	for _, l := range sl.all() {
+		if b, ok := l.Lookup(key); ok {
+			return b, true
+		}
+	}
+	return Binding{}, false
+}
+
+// All implements Leases.All.
+func (sl *subnetLeases) All() []Binding {
+	var bs []Binding
+	for _, l := range sl.all() {
+		bs = append(bs, l.All()...)
+	}
+	return bs
+}
+
+func (sl *subnetLeases) setExclude(exclude func(net.IP) bool) {
+	for _, l := range sl.all() {
+		if ex, ok := l.(excluder); ok {
+			ex.setExclude(exclude)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package dhcp4server
+
+import (
+	"net"
+	"testing"
+
+	"github.com/mergetb/dhcp4"
+	"github.com/mergetb/dhcp4/dhcp4opts"
+)
+
+func newSubnetServer(t *testing.T) *Server {
+	var subnets []Subnet
+	for _, cidr := range []string{"10.1.0.0/24", "10.2.0.0/16"} {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		o := make(dhcp4.Options)
+		o.SetRouters([]net.IP{n.IP.To4()})
+		subnets = append(subnets, Subnet{Network: n, Options: o})
+	}
+	return newTestServer(t, WithSubnets(subnets...))
+}
+
+func TestSubnetSelection(t *testing.T) {
+	s := newSubnetServer(t)
+
+	for i, tt := range []struct {
+		name     string
+		giaddr   net.IP
+		link     net.IP
+		want     string
+		wantMask net.IPMask
+	}{
+		{name: "direct", want: "192.168.1.0/24"},
+		{name: "relayed", giaddr: net.IP{10, 1, 0, 1}, want: "10.1.0.0/24", wantMask: net.CIDRMask(24, 32)},
+		{name: "link selection", giaddr: net.IP{172, 16, 0, 1}, link: net.IP{10, 2, 0, 0}, want: "10.2.0.0/16", wantMask: net.CIDRMask(16, 32)},
+		{name: "relayed from own pool", giaddr: net.IP{192, 168, 1, 254}, want: "192.168.1.0/24"},
+		{name: "unknown link", giaddr: net.IP{172, 16, 0, 1}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			req := newRequest(dhcp4opts.DHCPDiscover, net.HardwareAddr{2, 0, 0, 0, 0, byte(i)})
+			req.GIAddr = tt.giaddr
+			if tt.link != nil {
+				req.Options.SetRelayAgentInfo(&dhcp4.RelayAgentInfo{LinkSelection: tt.link})
+			}
+			offer := exchange(t, s, req)
+			if tt.want == "" {
+				if offer != nil {
+					t.Errorf("offer = %v, want none", offer)
+				}
+				return
+			}
+			if offer == nil {
+				t.Fatal("no offer")
+			}
+			_, want, _ := net.ParseCIDR(tt.want)
+			if !want.Contains(offer.YIAddr) {
+				t.Errorf("offered %v, want address in %v", offer.YIAddr, want)
+			}
+			if offer.YIAddr.Equal(tt.giaddr) {
+				t.Errorf("offered the relay agent's address %v", offer.YIAddr)
+			}
+			if got := offer.Options.SubnetMask(); tt.wantMask != nil && got.String() != tt.wantMask.String() {
+				t.Errorf("subnet mask = %v, want %v", got, tt.wantMask)
+			}
+			if tt.giaddr == nil {
+				return
+			}
+			addr, err := replyAddr(offer, testPeer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !addr.IP.Equal(tt.giaddr) || addr.Port != serverPort {
+				t.Errorf("reply sent to %v, want relay agent %v:%d", addr, tt.giaddr, serverPort)
+			}
+		})
+	}
+}
+
+func TestSubnetMovedClient(t *testing.T) {
+	s := newSubnetServer(t)
+	mac := net.HardwareAddr{2, 0, 0, 0, 0, 1}
+
+	discover := newRequest(dhcp4opts.DHCPDiscover, mac)
+	discover.GIAddr = net.IP{10, 1, 0, 1}
+	offer := exchange(t, s, discover)
+	if offer == nil {
+		t.Fatal("no offer")
+	}
+	request := newRequest(dhcp4opts.DHCPRequest, mac)
+	request.GIAddr = discover.GIAddr
+	request.Options.SetRequestedIPAddress(offer.YIAddr)
+	if ack := exchange(t, s, request); ack == nil || ack.Options.MessageType() != dhcp4.DHCPACK {
+		t.Fatalf("response to REQUEST = %v, want ACK", ack)
+	}
+
+	// The client moves to another subnet and tries to keep its address.
+	request.GIAddr = net.IP{10, 2, 0, 1}
+	if nak := exchange(t, s, request); nak == nil || nak.Options.MessageType() != dhcp4.DHCPNAK {
+		t.Fatalf("response to REQUEST on another link = %v, want NAK", nak)
+	}
+	discover.GIAddr = request.GIAddr
+	offer = exchange(t, s, discover)
+	if offer == nil {
+		t.Fatal("no offer on the new link")
+	}
+	if _, n, _ := net.ParseCIDR("10.2.0.0/16"); !n.Contains(offer.YIAddr) {
+		t.Errorf("offered %v on the new link, want address in %v", offer.YIAddr, n)
+	}
+}
@@ -0,0 +1,177 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package dhcp4test provides test doubles for programs using the DHCP
+// client and server packages: an in-memory net.PacketConn and a scriptable
+// fake DHCP server.
+//
+// A client is tested against the fake server by connecting them with Pipe:
+//
+//	clientConn, serverConn := dhcp4test.Pipe()
+//	s := dhcp4test.NewServer(net.IP{192, 168, 0, 1}, dhcp4test.WithDropRate(0.1))
+//	go s.Serve(ctx, serverConn)
+//	c, err := dhcp4client.New(nil, dhcp4client.WithConn(clientConn))
+package dhcp4test
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Packet is a UDP datagram sent over a Conn.
+type Packet struct {
+	Source, Dest *net.UDPAddr
+	Payload      []byte
+}
+
+// errClosed is returned by Conn once it is closed.
+var errClosed = errors.New("use of closed network connection")
+
+// timeoutError is returned by Conn.ReadFrom when the read deadline passes.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// Conn is an in-memory net.PacketConn. Packets written to it are sent on a
+// channel, whatever their destination, and packets are read from another.
+type Conn struct {
+	addr *net.UDPAddr
+	in   <-chan Packet
+	out  chan<- Packet
+
+	mu       sync.Mutex
+	deadline time.Time
+	// changed is closed and replaced when the deadline changes, waking
+	// blocked readers like a socket does.
+	changed chan struct{}
+	closed  chan struct{}
+	once    sync.Once
+}
+
+var _ net.PacketConn = &Conn{}
+
+// NewConn returns a Conn with local address addr, reading packets from in
+// and writing them to out. ReadFrom returns io.EOF once in is closed.
+func NewConn(addr *net.UDPAddr, in <-chan Packet, out chan<- Packet) *Conn {
+	return &Conn{
+		addr:    addr,
+		in:      in,
+		out:     out,
+		changed: make(chan struct{}),
+		closed:  make(chan struct{}),
+	}
+}
+
+// Pipe returns two connected Conns: a DHCP client's on port 68 and a DHCP
+// server's on port 67. What one writes, the other reads.
+func Pipe() (client, server *Conn) {
+	toServer := make(chan Packet, 64)
+	toClient := make(chan Packet, 64)
+	client = NewConn(&net.UDPAddr{IP: net.IPv4zero, Port: 68}, toClient, toServer)
+	server = NewConn(&net.UDPAddr{IP: net.IPv4zero, Port: 67}, toServer, toClient)
+	return client, server
+}
+
+// ReadFrom implements net.PacketConn.ReadFrom.
+func (c *Conn) ReadFrom(b []byte) (int, net.Addr, error) {
+	for {
+		c.mu.Lock()
+		deadline, changed := c.deadline, c.changed
+		c.mu.Unlock()
+
+		var timeout <-chan time.Time
+		var t *time.Timer
+		if !deadline.IsZero() {
+			d := time.Until(deadline)
+			if d <= 0 {
+				return 0, nil, &net.OpError{Op: "read", Net: "udp", Err: timeoutError{}}
+			}
+			t = time.NewTimer(d)
+			timeout = t.C
+		}
+
+		select {
+		case p, ok := <-c.in:
+			stopTimer(t)
+			if !ok {
+				return 0, nil, io.EOF
+			}
+			return copy(b, p.Payload), p.Source, nil
+		case <-timeout:
+			return 0, nil, &net.OpError{Op: "read", Net: "udp", Err: timeoutError{}}
+		case <-c.closed:
+			stopTimer(t)
+			return 0, nil, &net.OpError{Op: "read", Net: "udp", Err: errClosed}
+		case <-changed:
+			// Wait again with the new deadline.
+			stopTimer(t)
+		}
+	}
+}
+
+func stopTimer(t *time.Timer) {
+	if t != nil {
+		t.Stop()
+	}
+}
+
+// WriteTo implements net.PacketConn.WriteTo. It blocks until the packet
+// is read if the channel is unbuffered or full.
+func (c *Conn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	dest, _ := addr.(*net.UDPAddr)
+	p := Packet{
+		Source:  c.addr,
+		Dest:    dest,
+		Payload: append([]byte(nil), b...),
+	}
+	select {
+	case <-c.closed:
+		return 0, &net.OpError{Op: "write", Net: "udp", Err: errClosed}
+	default:
+	}
+	select {
+	case c.out <- p:
+		return len(b), nil
+	case <-c.closed:
+		return 0, &net.OpError{Op: "write", Net: "udp", Err: errClosed}
+	}
+}
+
+// Close implements net.PacketConn.Close.
+func (c *Conn) Close() error {
+	c.once.Do(func() { close(c.closed) })
+	return nil
+}
+
+// LocalAddr implements net.PacketConn.LocalAddr.
+func (c *Conn) LocalAddr() net.Addr {
+	return c.addr
+}
+
+// SetDeadline implements net.PacketConn.SetDeadline. Writes never time
+// out.
+func (c *Conn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+// SetReadDeadline implements net.PacketConn.SetReadDeadline.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.deadline = t
+	close(c.changed)
+	c.changed = make(chan struct{})
+	return nil
+}
+
+// SetWriteDeadline implements net.PacketConn.SetWriteDeadline. Writes
+// never time out.
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
@@ -0,0 +1,311 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4test
+
+import (
+	"context"
+	"encoding/binary"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+)
+
+// Handler returns the reply of a fake server to req, or nil for none.
+// Handlers can wrap Server.Respond to change the default replies.
+type Handler func(req *dhcp4.Packet) *dhcp4.Packet
+
+// Server is a fake DHCP server. By default it offers the addresses after
+// its own to clients in order, ACKs requests for offered and bound
+// addresses, NAKs other requests, and frees addresses that are released
+// or declined.
+//
+// Replies are sent to the source of the request, without the routing
+// rules of real servers, so it works with any net.PacketConn.
+type Server struct {
+	id        net.IP
+	pool      []net.IP
+	leaseTime time.Duration
+	options   dhcp4.Options
+	handler   Handler
+	dropRate  float64
+	delay     time.Duration
+	rand      *rand.Rand
+
+	mu       sync.Mutex
+	bindings map[string]net.IP
+	declined map[string]bool
+	received []*dhcp4.Packet
+}
+
+// ServerOpt configures a Server.
+type ServerOpt func(*Server)
+
+// WithPool configures the addresses the server hands out, in order.
+//
+// Default are the 100 addresses after the server's own.
+func WithPool(ips ...net.IP) ServerOpt {
+	return func(s *Server) {
+		s.pool = ips
+	}
+}
+
+// WithLeaseTime configures the lease time sent in offers and ACKs.
+//
+// Default is 1 hour.
+func WithLeaseTime(d time.Duration) ServerOpt {
+	return func(s *Server) {
+		s.leaseTime = d
+	}
+}
+
+// WithOptions configures options added to every offer and ACK, e.g. the
+// subnet mask and routers.
+func WithOptions(o dhcp4.Options) ServerOpt {
+	return func(s *Server) {
+		s.options = o
+	}
+}
+
+// WithHandler replaces the default replies, see Server.Respond.
+func WithHandler(h Handler) ServerOpt {
+	return func(s *Server) {
+		s.handler = h
+	}
+}
+
+// WithDropRate makes the server ignore the fraction rate of requests, at
+// random but reproducibly for the same seed, see WithSeed.
+//
+// Default is 0.
+func WithDropRate(rate float64) ServerOpt {
+	return func(s *Server) {
+		s.dropRate = rate
+	}
+}
+
+// WithSeed seeds the randomness of WithDropRate.
+//
+// Default is 1.
+func WithSeed(seed int64) ServerOpt {
+	return func(s *Server) {
+		s.rand = rand.New(rand.NewSource(seed))
+	}
+}
+
+// WithDelay delays every reply by d.
+//
+// Default is no delay.
+func WithDelay(d time.Duration) ServerOpt {
+	return func(s *Server) {
+		s.delay = d
+	}
+}
+
+// NewServer returns a fake server with server identifier id.
+func NewServer(id net.IP, opts ...ServerOpt) *Server {
+	s := &Server{
+		id:        id.To4(),
+		leaseTime: time.Hour,
+		rand:      rand.New(rand.NewSource(1)),
+		bindings:  make(map[string]net.IP),
+		declined:  make(map[string]bool),
+	}
+	for i := uint32(1); i <= 100; i++ {
+		ip := make(net.IP, net.IPv4len)
+		binary.BigEndian.PutUint32(ip, binary.BigEndian.Uint32(s.id)+i)
+		s.pool = append(s.pool, ip)
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.handler == nil {
+		s.handler = s.Respond
+	}
+	return s
+}
+
+// Serve answers the requests read from conn until ctx is done or reading
+// fails. Packets that are not valid DHCP requests are ignored.
+func (s *Server) Serve(ctx context.Context, conn net.PacketConn) error {
+	go func() {
+		<-ctx.Done()
+		// Unblock ReadFrom.
+		conn.SetReadDeadline(time.Now())
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	b := make([]byte, 1500)
+	for {
+		n, peer, err := conn.ReadFrom(b)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			return err
+		}
+		req, err := dhcp4.ParsePacket(b[:n])
+		if err != nil || req.Op != dhcp4.BootRequest {
+			continue
+		}
+
+		s.mu.Lock()
+		s.received = append(s.received, req)
+		drop := s.dropRate > 0 && s.rand.Float64() < s.dropRate
+		s.mu.Unlock()
+		if drop {
+			continue
+		}
+		reply := s.handler(req)
+		if reply == nil {
+			continue
+		}
+		out, err := reply.MarshalBinary()
+		if err != nil {
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if s.delay > 0 {
+				t := time.NewTimer(s.delay)
+				defer t.Stop()
+				select {
+				case <-t.C:
+				case <-ctx.Done():
+					return
+				}
+			}
+			conn.WriteTo(out, peer)
+		}()
+	}
+}
+
+// Received returns the requests the server received, including those it
+// dropped.
+func (s *Server) Received() []*dhcp4.Packet {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*dhcp4.Packet(nil), s.received...)
+}
+
+// Binding returns the address bound or offered to the client with hardware
+// address mac, or nil.
+func (s *Server) Binding(mac net.HardwareAddr) net.IP {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.bindings[mac.String()]
+}
+
+// Respond returns the default reply to req.
+func (s *Server) Respond(req *dhcp4.Packet) *dhcp4.Packet {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := req.CHAddr.String()
+	switch req.Options.MessageType() {
+	case dhcp4.DHCPDiscover:
+		ip := s.allocate(key, req.Options.RequestedIPAddress())
+		if ip == nil {
+			return nil
+		}
+		return s.lease(req, dhcp4.DHCPOffer, ip)
+
+	case dhcp4.DHCPRequest:
+		if sid := req.Options.ServerIdentifier(); sid != nil && !sid.Equal(s.id) {
+			// The client chose another server.
+			delete(s.bindings, key)
+			return nil
+		}
+		want := req.Options.RequestedIPAddress()
+		if want == nil {
+			want = req.CIAddr
+		}
+		if ip := s.bindings[key]; ip != nil && ip.Equal(want) {
+			return s.lease(req, dhcp4.DHCPACK, ip)
+		}
+		return NewReply(req, dhcp4.DHCPNAK, s.id)
+
+	case dhcp4.DHCPDecline:
+		if ip := s.bindings[key]; ip != nil {
+			s.declined[ip.String()] = true
+		}
+		delete(s.bindings, key)
+
+	case dhcp4.DHCPRelease:
+		delete(s.bindings, key)
+
+	case dhcp4.DHCPInform:
+		reply := NewReply(req, dhcp4.DHCPACK, s.id)
+		for code, v := range s.options {
+			reply.Options[code] = v
+		}
+		return reply
+	}
+	return nil
+}
+
+// allocate returns the address bound to key, or binds requested if it is
+// free, or the first free address.
+//
+// s.mu must be held.
+func (s *Server) allocate(key string, requested net.IP) net.IP {
+	if ip := s.bindings[key]; ip != nil {
+		return ip
+	}
+	used := make(map[string]bool, len(s.bindings))
+	for _, ip := range s.bindings {
+		used[ip.String()] = true
+	}
+	free := func(ip net.IP) bool {
+		return !used[ip.String()] && !s.declined[ip.String()]
+	}
+	for _, ip := range s.pool {
+		if requested.Equal(ip) && free(ip) {
+			s.bindings[key] = ip
+			return ip
+		}
+	}
+	for _, ip := range s.pool {
+		if free(ip) {
+			s.bindings[key] = ip
+			return ip
+		}
+	}
+	return nil
+}
+
+// lease returns a reply of type typ leasing ip.
+func (s *Server) lease(req *dhcp4.Packet, typ dhcp4.MessageType, ip net.IP) *dhcp4.Packet {
+	reply := NewReply(req, typ, s.id)
+	reply.YIAddr = ip
+	reply.Options.SetLeaseTime(s.leaseTime)
+	for code, v := range s.options {
+		reply.Options[code] = v
+	}
+	return reply
+}
+
+// NewReply returns a reply of type typ from server id to req, repeating the
+// fields and client identifier of req that replies must repeat (RFC 2131
+// Section 4.3.1, RFC 6842).
+func NewReply(req *dhcp4.Packet, typ dhcp4.MessageType, id net.IP) *dhcp4.Packet {
+	reply := dhcp4.NewPacket(dhcp4.BootReply)
+	reply.HType = req.HType
+	reply.TransactionID = req.TransactionID
+	reply.Broadcast = req.Broadcast
+	reply.GIAddr = req.GIAddr
+	reply.CHAddr = req.CHAddr
+	reply.Options.SetMessageType(typ)
+	reply.Options.SetServerIdentifier(id)
+	if cid := req.Options.ClientIdentifier(); cid != nil {
+		reply.Options.SetClientIdentifier(cid)
+	}
+	return reply
+}
@@ -0,0 +1,171 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4test_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+	"github.com/mergetb/dhcp4/dhcp4client"
+	"github.com/mergetb/dhcp4/dhcp4test"
+)
+
+var serverID = net.IP{192, 168, 0, 1}
+
+// newClient returns a client talking to a fake server configured by opts.
+func newClient(ctx context.Context, t *testing.T, opts ...dhcp4test.ServerOpt) (*dhcp4client.Client, *dhcp4test.Server) {
+	clientConn, serverConn := dhcp4test.Pipe()
+	s := dhcp4test.NewServer(serverID, opts...)
+	go s.Serve(ctx, serverConn)
+	c, err := dhcp4client.New(nil,
+		dhcp4client.WithConn(clientConn),
+		dhcp4client.WithIdentity(dhcp4client.Identity{HardwareAddr: net.HardwareAddr{2, 0, 0, 0, 0, 1}}),
+		dhcp4client.WithTimeout(100*time.Millisecond),
+		dhcp4client.WithRetry(2),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, s
+}
+
+func TestServer(t *testing.T) {
+	mask := dhcp4.Options{}
+	mask.SetSubnetMask(net.IPMask{255, 255, 255, 0})
+
+	for _, tt := range []struct {
+		desc    string
+		opts    []dhcp4test.ServerOpt
+		want    net.IP
+		wantErr bool
+	}{
+		{desc: "default", want: net.IP{192, 168, 0, 2}},
+		{desc: "pool", opts: []dhcp4test.ServerOpt{dhcp4test.WithPool(net.IP{10, 0, 0, 5})}, want: net.IP{10, 0, 0, 5}},
+		{desc: "options", opts: []dhcp4test.ServerOpt{dhcp4test.WithOptions(mask), dhcp4test.WithLeaseTime(time.Minute)}, want: net.IP{192, 168, 0, 2}},
+		{desc: "delayed", opts: []dhcp4test.ServerOpt{dhcp4test.WithDelay(20 * time.Millisecond)}, want: net.IP{192, 168, 0, 2}},
+		{desc: "delayed too long", opts: []dhcp4test.ServerOpt{dhcp4test.WithDelay(time.Second)}, wantErr: true},
+		{desc: "dropping", opts: []dhcp4test.ServerOpt{dhcp4test.WithDropRate(1)}, wantErr: true},
+		{desc: "empty pool", opts: []dhcp4test.ServerOpt{dhcp4test.WithPool()}, wantErr: true},
+		{
+			desc: "NAKing",
+			opts: []dhcp4test.ServerOpt{dhcp4test.WithHandler(func(req *dhcp4.Packet) *dhcp4.Packet {
+				if req.Options.MessageType() == dhcp4.DHCPRequest {
+					return dhcp4test.NewReply(req, dhcp4.DHCPNAK, serverID)
+				}
+				return nil
+			})},
+			wantErr: true,
+		},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			c, s := newClient(ctx, t, tt.opts...)
+			defer c.Close()
+
+			lease, err := c.RequestLease(ctx)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Request() = %v, want error", lease)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Request() = %v", err)
+			}
+			if !lease.IP.Equal(tt.want) || !lease.ServerID.Equal(serverID) {
+				t.Errorf("Request() = %v from %v, want %v from %v", lease.IP, lease.ServerID, tt.want, serverID)
+			}
+			if got := s.Binding(net.HardwareAddr{2, 0, 0, 0, 0, 1}); !got.Equal(tt.want) {
+				t.Errorf("server bound %v, want %v", got, tt.want)
+			}
+			if got := len(s.Received()); got != 2 {
+				t.Errorf("server received %d requests, want 2", got)
+			}
+		})
+	}
+}
+
+func TestServerDropRate(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	clientConn, serverConn := dhcp4test.Pipe()
+	s := dhcp4test.NewServer(serverID, dhcp4test.WithDropRate(0.5), dhcp4test.WithSeed(42))
+	go s.Serve(ctx, serverConn)
+
+	const n = 200
+	discover := dhcp4.NewPacket(dhcp4.BootRequest)
+	discover.Options.SetMessageType(dhcp4.DHCPDiscover)
+	for i := 0; i < n; i++ {
+		discover.SetHardwareAddr(net.HardwareAddr{2, 0, 0, 0, byte(i >> 8), byte(i)})
+		b, err := discover.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := clientConn.WriteTo(b, &net.UDPAddr{IP: net.IPv4bcast, Port: 67}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var replies int
+	buf := make([]byte, 1500)
+	for {
+		clientConn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		if _, _, err := clientConn.ReadFrom(buf); err != nil {
+			break
+		}
+		replies++
+	}
+	if got := len(s.Received()); got != n {
+		t.Errorf("server received %d requests, want %d", got, n)
+	}
+	if replies < n/4 || replies > 3*n/4 {
+		t.Errorf("server answered %d of %d requests, want about half", replies, n)
+	}
+}
+
+func TestConn(t *testing.T) {
+	a, b := dhcp4test.Pipe()
+	if _, err := a.WriteTo([]byte("hello"), &net.UDPAddr{IP: net.IPv4bcast, Port: 67}); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 16)
+	n, from, err := b.ReadFrom(buf)
+	if err != nil || string(buf[:n]) != "hello" || from.(*net.UDPAddr).Port != 68 {
+		t.Errorf("ReadFrom() = %q from %v, %v; want hello from port 68", buf[:n], from, err)
+	}
+
+	b.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	if _, _, err := b.ReadFrom(buf); err == nil {
+		t.Errorf("ReadFrom() after deadline = nil, want timeout")
+	} else if nerr, ok := err.(net.Error); !ok || !nerr.Timeout() {
+		t.Errorf("ReadFrom() after deadline = %v, want timeout", err)
+	}
+
+	// Setting a deadline wakes a blocked reader.
+	b.SetReadDeadline(time.Time{})
+	done := make(chan error)
+	go func() {
+		_, _, err := b.ReadFrom(buf)
+		done <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	b.SetReadDeadline(time.Now())
+	if err := <-done; err == nil {
+		t.Errorf("ReadFrom() blocked before deadline = nil, want timeout")
+	}
+
+	b.SetReadDeadline(time.Time{})
+	b.Close()
+	if _, _, err := b.ReadFrom(buf); err == nil {
+		t.Errorf("ReadFrom() after Close = nil, want error")
+	}
+	if _, err := b.WriteTo([]byte("hello"), nil); err == nil {
+		t.Errorf("WriteTo() after Close = nil, want error")
+	}
+}
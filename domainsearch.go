@@ -0,0 +1,176 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// maxNameLen is the maximum length of an encoded DNS name, RFC 1035
+	// Section 2.3.4.
+	maxNameLen = 255
+
+	// maxLabelLen is the maximum length of a DNS label.
+	maxLabelLen = 63
+
+	// pointerFlag marks a compression pointer, RFC 1035 Section 4.1.4.
+	pointerFlag = 0xc0
+
+	// maxPointer is the largest offset a compression pointer can hold.
+	maxPointer = 0x3fff
+)
+
+// ParseDomainSearch decodes the domain search list in b, the value of
+// OptionDomainSearch as defined by RFC 3397.
+//
+// Names are encoded as DNS names (RFC 1035, Section 3.1), which may end in a
+// compression pointer to a name earlier in b. Names are returned without the
+// trailing dot.
+func ParseDomainSearch(b []byte) ([]string, error) {
+	var names []string
+	for off := 0; off < len(b); {
+		name, next, err := readName(b, off)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+		off = next
+	}
+	return names, nil
+}
+
+// readName reads the name at off in b and returns it and the offset after
+// it.
+func readName(b []byte, off int) (string, int, error) {
+	var labels []string
+	length := 0
+	next := -1
+	// start is where the labels being read begin.
+	start := off
+	for pos := off; ; {
+		if pos >= len(b) {
+			return "", 0, fmt.Errorf("domain search: name at %d truncated", off)
+		}
+		n := int(b[pos])
+		switch {
+		case n == 0:
+			if next < 0 {
+				next = pos + 1
+			}
+			return strings.Join(labels, "."), next, nil
+
+		case n&pointerFlag == pointerFlag:
+			if pos+1 >= len(b) {
+				return "", 0, fmt.Errorf("domain search: name at %d truncated", off)
+			}
+			target := int(b[pos]&^pointerFlag)<<8 | int(b[pos+1])
+			// Each pointer must point before the labels it
+			// follows, so that pointers cannot loop.
+			if target >= start {
+				return "", 0, fmt.Errorf("domain search: pointer at %d does not point backwards", pos)
+			}
+			if next < 0 {
+				next = pos + 2
+			}
+			pos, start = target, target
+
+		case n&pointerFlag != 0:
+			return "", 0, fmt.Errorf("domain search: label type %#x at %d", n&pointerFlag, pos)
+
+		default:
+			if pos+1+n > len(b) {
+				return "", 0, fmt.Errorf("domain search: name at %d truncated", off)
+			}
+			label := string(b[pos+1 : pos+1+n])
+			if err := checkLabel(label); err != nil {
+				return "", 0, fmt.Errorf("domain search: %v", err)
+			}
+			length += 1 + n
+			if length+1 > maxNameLen {
+				return "", 0, fmt.Errorf("domain search: name at %d longer than %d bytes", off, maxNameLen)
+			}
+			labels = append(labels, label)
+			pos += 1 + n
+		}
+	}
+}
+
+// checkLabel returns an error if label is not a valid DNS label.
+func checkLabel(label string) error {
+	if label == "" || len(label) > maxLabelLen {
+		return fmt.Errorf("label %q must be 1 to %d bytes long", label, maxLabelLen)
+	}
+	for _, r := range label {
+		if !isDNSNameChar(r) || r == '.' {
+			return fmt.Errorf("label %q has invalid character %q", label, r)
+		}
+	}
+	return nil
+}
+
+// MarshalDomainSearch encodes names as the value of OptionDomainSearch, see
+// ParseDomainSearch. Common suffixes are compressed.
+func MarshalDomainSearch(names []string) ([]byte, error) {
+	var b []byte
+	suffixes := make(map[string]int)
+	for _, name := range names {
+		name = strings.TrimSuffix(name, ".")
+		if name == "" {
+			return nil, fmt.Errorf("domain search: empty name")
+		}
+		if len(name)+2 > maxNameLen {
+			return nil, fmt.Errorf("domain search: name %q longer than %d bytes", name, maxNameLen)
+		}
+		labels := strings.Split(name, ".")
+		for _, l := range labels {
+			if err := checkLabel(l); err != nil {
+				return nil, fmt.Errorf("domain search: name %q: %v", name, err)
+			}
+		}
+
+		for i := range labels {
+			suffix := strings.Join(labels[i:], ".")
+			if off, ok := suffixes[suffix]; ok {
+				b = append(b, pointerFlag|uint8(off>>8), uint8(off))
+				break
+			}
+			if len(b) <= maxPointer {
+				suffixes[suffix] = len(b)
+			}
+			b = append(b, uint8(len(labels[i])))
+			b = append(b, labels[i]...)
+			if i == len(labels)-1 {
+				b = append(b, 0)
+			}
+		}
+	}
+	return b, nil
+}
+
+// DomainSearch returns the domain search list.
+//
+// It returns nil if the option is not present or malformed. The option is
+// defined by RFC 3397.
+func (o Options) DomainSearch() []string {
+	names, err := ParseDomainSearch(o[OptionDomainSearch])
+	if err != nil {
+		return nil
+	}
+	return names
+}
+
+// SetDomainSearch sets the domain search list. Use MarshalDomainSearch to
+// learn why a list cannot be encoded.
+//
+// An empty or invalid value removes the option.
+func (o Options) SetDomainSearch(v []string) {
+	b, err := MarshalDomainSearch(v)
+	if err != nil {
+		b = nil
+	}
+	o.setBytes(OptionDomainSearch, b)
+}
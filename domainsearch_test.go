@@ -0,0 +1,117 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDomainSearch(t *testing.T) {
+	for _, tt := range []struct {
+		desc  string
+		names []string
+		wire  []byte
+	}{
+		{
+			desc:  "single name",
+			names: []string{"example.com"},
+			wire:  []byte("\x07example\x03com\x00"),
+		},
+		{
+			// The example of RFC 3397, Section 2.
+			desc:  "RFC 3397",
+			names: []string{"eng.apple.com", "marketing.apple.com"},
+			wire:  []byte("\x03eng\x05apple\x03com\x00\x09marketing\xc0\x04"),
+		},
+		{
+			desc:  "repeated name",
+			names: []string{"example.com", "example.com"},
+			wire:  []byte("\x07example\x03com\x00\xc0\x00"),
+		},
+		{
+			desc:  "no common suffix",
+			names: []string{"example.com", "example.org"},
+			wire:  []byte("\x07example\x03com\x00\x07example\x03org\x00"),
+		},
+	} {
+		got, err := MarshalDomainSearch(tt.names)
+		if err != nil || !bytes.Equal(got, tt.wire) {
+			t.Errorf("%s: MarshalDomainSearch(%v) = %q, %v; want %q", tt.desc, tt.names, got, err, tt.wire)
+		}
+		names, err := ParseDomainSearch(tt.wire)
+		if err != nil || !reflect.DeepEqual(names, tt.names) {
+			t.Errorf("%s: ParseDomainSearch(%q) = %v, %v; want %v", tt.desc, tt.wire, names, err, tt.names)
+		}
+	}
+}
+
+func TestParseDomainSearchPointerIntoName(t *testing.T) {
+	// The second name points into the middle of the first, as servers
+	// that compress every suffix send.
+	b := []byte("\x04corp\x07example\x03com\x00\x03lab\xc0\x05")
+	want := []string{"corp.example.com", "lab.example.com"}
+	if got, err := ParseDomainSearch(b); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseDomainSearch(%q) = %v, %v; want %v", b, got, err, want)
+	}
+}
+
+func TestParseDomainSearchMalformed(t *testing.T) {
+	long := bytes.Repeat([]byte("\x3f"+strings.Repeat("a", 63)), 4)
+	for _, tt := range []struct {
+		desc string
+		b    []byte
+	}{
+		{"self pointer", []byte("\xc0\x00")},
+		{"forward pointer", []byte("\x03com\xc0\x06\x00\x00")},
+		{"pointer to own name", []byte("\x03com\xc0\x00")},
+		{"pointer loop", []byte("\x03com\x00\x03www\xc0\x05")},
+		{"truncated label", []byte("\x07example\x03co")},
+		{"missing terminator", []byte("\x07example\x03com")},
+		{"truncated pointer", []byte("\x03com\x00\xc0")},
+		{"extended label type", []byte("\x41com\x00")},
+		{"invalid character", []byte("\x03c m\x00")},
+		{"dot in label", []byte("\x03c.m\x00")},
+		{"name too long", append(long, 0)},
+	} {
+		if names, err := ParseDomainSearch(tt.b); err == nil {
+			t.Errorf("%s: ParseDomainSearch(%q) = %v, want error", tt.desc, tt.b, names)
+		}
+	}
+}
+
+func TestMarshalDomainSearchInvalid(t *testing.T) {
+	for _, names := range [][]string{
+		{""},
+		{"example..com"},
+		{"exa mple.com"},
+		{strings.Repeat("a", 64) + ".com"},
+		{strings.Repeat(strings.Repeat("a", 63)+".", 4) + "com"},
+	} {
+		if b, err := MarshalDomainSearch(names); err == nil {
+			t.Errorf("MarshalDomainSearch(%q) = %q, want error", names, b)
+		}
+	}
+}
+
+func TestDomainSearchOption(t *testing.T) {
+	names := []string{"eng.example.com", "example.com"}
+	o := make(Options)
+	o.SetDomainSearch([]string{"eng.example.com.", "example.com"})
+	if got := o.DomainSearch(); !reflect.DeepEqual(got, names) {
+		t.Errorf("DomainSearch() = %v, want %v", got, names)
+	}
+
+	o[OptionDomainSearch] = []byte("\xc0\x00")
+	if got := o.DomainSearch(); got != nil {
+		t.Errorf("DomainSearch() of malformed option = %v, want nil", got)
+	}
+	o.SetDomainSearch([]string{"exa mple.com"})
+	if _, ok := o[OptionDomainSearch]; ok {
+		t.Errorf("SetDomainSearch of an invalid name did not remove the option")
+	}
+}
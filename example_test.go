@@ -0,0 +1,41 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4_test
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/mergetb/dhcp4"
+)
+
+// A relay agent forwards a client's DISCOVER to a server, and the server's
+// OFFER back to the client. See examples/relay for a complete relay agent.
+func ExampleRelayRequest() {
+	discover := dhcp4.NewPacket(dhcp4.BootRequest)
+	discover.CHAddr = net.HardwareAddr{2, 0, 0, 0, 0, 1}
+	discover.Options.SetMessageType(dhcp4.DHCPDiscover)
+
+	info := &dhcp4.RelayAgentInfo{CircuitID: []byte("eth1")}
+	if err := dhcp4.RelayRequest(discover, net.IP{10, 0, 1, 1}, info); err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("hops %d, giaddr %v, circuit %s\n", discover.Hops, discover.GIAddr, discover.Options.RelayAgentInfo().CircuitID)
+
+	// The server answers the relay agent, echoing the relay agent
+	// information.
+	offer := dhcp4.NewPacket(dhcp4.BootReply)
+	offer.CHAddr = discover.CHAddr
+	offer.GIAddr = discover.GIAddr
+	offer.YIAddr = net.IP{10, 0, 1, 100}
+	offer.Options.SetMessageType(dhcp4.DHCPOffer)
+	offer.Options.SetRelayAgentInfo(info)
+
+	fmt.Println("deliver to", dhcp4.RelayReply(offer))
+	// Output:
+	// hops 1, giaddr 10.0.1.1, circuit eth1
+	// deliver to 255.255.255.255:68
+}
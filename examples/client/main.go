@@ -0,0 +1,58 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// client requests a lease on an interface and prints it, without
+// configuring the interface.
+//
+// Usage:
+//
+//	client [-timeout 30s] eth0
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/mergetb/dhcp4/dhcp4client"
+)
+
+var timeout = flag.Duration("timeout", 30*time.Second, "How long to wait for a lease")
+
+func main() {
+	flag.Parse()
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: client [-timeout d] <interface>")
+		os.Exit(2)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	lease, err := dhcp4client.Acquire(ctx, flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("Address:     %v/%d\n", lease.IP, maskSize(lease))
+	fmt.Printf("Server:      %v\n", lease.ServerID)
+	fmt.Printf("Lease time:  %v\n", lease.Duration)
+	fmt.Printf("Routers:     %v\n", lease.Options.Routers())
+	fmt.Printf("DNS servers: %v\n", lease.Options.DomainNameServers())
+	if name := lease.Options.DomainName(); name != "" {
+		fmt.Printf("Domain:      %s\n", name)
+	}
+}
+
+// maskSize returns the prefix length of the lease's subnet mask, or 32 if
+// the server sent none.
+func maskSize(lease *dhcp4client.Lease) int {
+	if mask := lease.Options.SubnetMask(); mask != nil {
+		ones, _ := mask.Size()
+		return ones
+	}
+	return 32
+}
@@ -0,0 +1,85 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// leased configures an interface with a lease and keeps the lease alive
+// until it is interrupted, when it releases the lease.
+//
+// Usage:
+//
+//	leased eth0
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/mergetb/dhcp4/dhcp4client"
+	"github.com/vishvananda/netlink"
+)
+
+func main() {
+	if len(os.Args) != 2 {
+		fmt.Fprintln(os.Stderr, "Usage: leased <interface>")
+		os.Exit(2)
+	}
+	iface := os.Args[1]
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sig
+		cancel()
+	}()
+
+	link, err := netlink.LinkByName(iface)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := netlink.LinkSetUp(link); err != nil {
+		log.Fatalf("Could not bring up %s: %v", iface, err)
+	}
+	c, err := dhcp4client.New(link,
+		dhcp4client.WithReleaseOnStop(true),
+		dhcp4client.WithMACChangePolicy(dhcp4client.MACReacquire),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer c.Close()
+
+	for ctx.Err() == nil {
+		lease, err := c.RequestLease(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		configure(iface, lease)
+		for ev := range c.Maintain(ctx, lease) {
+			if ev.Err != nil {
+				log.Printf("Lease %v %v: %v", ev.Lease.IP, ev.Kind, ev.Err)
+			} else {
+				log.Printf("Lease %v %v", ev.Lease.IP, ev.Kind)
+			}
+			if ev.Kind != dhcp4client.LeaseLost && ev.Kind != dhcp4client.LeaseExpired {
+				configure(iface, ev.Lease)
+			}
+			// Otherwise Maintain is done, and a new lease is requested.
+		}
+	}
+	log.Printf("Released the lease")
+}
+
+// configure configures iface with lease, logging failures: a daemon keeps
+// the lease even if configuring it partly failed.
+func configure(iface string, lease *dhcp4client.Lease) {
+	if err := dhcp4client.Configure(iface, lease); err != nil {
+		log.Printf("Could not configure %s with %v: %v", iface, lease.IP, err)
+		return
+	}
+	log.Printf("Configured %s with %v from %v for %v", iface, lease.IP, lease.ServerID, lease.Duration)
+}
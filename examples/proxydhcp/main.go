@@ -0,0 +1,71 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// proxydhcp is a ProxyDHCP server for iPXE: it leaves addresses to the
+// network's DHCP server and tells PXE clients where to boot from, as
+// described by the PXE 2.1 specification. PXE ROMs are sent the iPXE
+// chainloader; iPXE, once chainloaded, is sent the script.
+//
+// Usage:
+//
+//	proxydhcp -id 192.168.0.5 -chainloader undionly.kpxe \
+//		-script http://192.168.0.5/boot.ipxe
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net"
+	"strings"
+
+	"github.com/mergetb/dhcp4"
+	"github.com/mergetb/dhcp4/dhcp4opts"
+	"github.com/mergetb/dhcp4/dhcp4server"
+)
+
+var (
+	id          = flag.String("id", "", "Server identifier and TFTP server, an address of this host clients can reach")
+	chainloader = flag.String("chainloader", "undionly.kpxe", "Boot file served to PXE ROMs")
+	script      = flag.String("script", "", "Boot file, usually an iPXE script URL, served to iPXE")
+)
+
+func main() {
+	flag.Parse()
+	serverID := net.ParseIP(*id).To4()
+	if serverID == nil || *script == "" {
+		log.Fatal("-id and -script are required")
+	}
+
+	h := dhcp4server.HandlerFunc(func(req *dhcp4.Packet, peer net.Addr) *dhcp4.Packet {
+		if !strings.HasPrefix(req.Options.VendorClassIdentifier(), dhcp4opts.PXEProfile.ClassPrefix) {
+			// Not a PXE client.
+			return nil
+		}
+		reply := dhcp4.NewPacket(dhcp4.BootReply)
+		switch req.Options.MessageType() {
+		case dhcp4.DHCPDiscover:
+			// A ProxyDHCP offer has no address (PXE 2.1, Section 2.2.4).
+			reply.Options.SetMessageType(dhcp4.DHCPOffer)
+		case dhcp4.DHCPRequest:
+			if sid := req.Options.ServerIdentifier(); sid != nil && !sid.Equal(serverID) {
+				// The client chose another server.
+				return nil
+			}
+			reply.Options.SetMessageType(dhcp4.DHCPACK)
+		default:
+			return nil
+		}
+		reply.SIAddr = serverID
+		reply.BootFile = *chainloader
+		if dhcp4opts.IsIPXE(req.Options) {
+			reply.BootFile = *script
+		}
+		reply.Options.SetServerIdentifier(serverID)
+		reply.Options.SetVendorClassIdentifier(dhcp4opts.PXEProfile.ClassPrefix)
+		log.Printf("%v %s to %v", reply.Options.MessageType(), reply.BootFile, req.CHAddr)
+		return reply
+	})
+	log.Fatal(dhcp4server.ListenAndServe(context.Background(), "", h))
+}
@@ -0,0 +1,169 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// relay is a DHCP relay agent: it forwards requests of clients on its link
+// to servers on other subnets, and the servers' replies back to the
+// clients, as described by RFC 1542, Section 4. Requests are tagged with
+// the interface name as the circuit ID (RFC 3046).
+//
+// Requests already carrying relay agent information with an empty giaddr
+// come from a client rather than a relay agent and are dropped, as RFC 3046
+// Section 2.1 asks of relay agents on untrusted circuits, unless -trust-info
+// is given.
+//
+// With -metrics, the requests and replies forwarded and dropped are counted
+// per interface and server, and served for Prometheus at /metrics.
+//
+// Usage:
+//
+//	relay -iface eth1 -server 10.0.0.1,10.0.0.2 -metrics :9067
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/mergetb/dhcp4"
+	"github.com/mergetb/dhcp4/dhcp4metrics"
+)
+
+var (
+	iface     = flag.String("iface", "", "Interface the clients are on")
+	servers   = flag.String("server", "", "Comma-separated addresses of the DHCP servers")
+	trustInfo = flag.Bool("trust-info", false, "Forward requests of clients carrying relay agent information")
+	metrics   = flag.String("metrics", "", "Address to serve Prometheus metrics on, e.g. :9067")
+)
+
+func main() {
+	flag.Parse()
+	if *iface == "" || *servers == "" {
+		log.Fatal("-iface and -server are required")
+	}
+	var serverAddrs []*net.UDPAddr
+	for _, s := range strings.Split(*servers, ",") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			log.Fatalf("invalid server address %q", s)
+		}
+		serverAddrs = append(serverAddrs, &net.UDPAddr{IP: ip, Port: 67})
+	}
+	giaddr, err := ifaceAddr(*iface)
+	if err != nil {
+		log.Fatal(err)
+	}
+	info := &dhcp4.RelayAgentInfo{CircuitID: []byte(*iface)}
+
+	m := dhcp4metrics.Discard
+	if *metrics != "" {
+		registry := dhcp4metrics.NewRegistry("dhcp")
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", registry)
+		go func() {
+			log.Fatalf("Metrics server failed: %v", http.ListenAndServe(*metrics, mux))
+		}()
+		m = registry
+	}
+
+	// Clients' broadcasts and the servers' replies both arrive on port 67.
+	conn, err := net.ListenPacket("udp4", ":67")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Close()
+
+	buf := make([]byte, 1500)
+	for {
+		n, peer, err := conn.ReadFrom(buf)
+		if err != nil {
+			log.Fatal(err)
+		}
+		p, err := dhcp4.ParsePacket(buf[:n])
+		if err != nil {
+			continue
+		}
+
+		var dests []*net.UDPAddr
+		switch p.Op {
+		case dhcp4.BootRequest:
+			fromClient := p.GIAddr == nil || p.GIAddr.IsUnspecified()
+			if fromClient && !*trustInfo && p.Options.Get(dhcp4.OptionRelayAgentInformation) != nil {
+				log.Printf("Dropped request from %v with relay agent information", p.CHAddr)
+				m.RelayDropped(*iface, nil, dhcp4metrics.RelayAgentInfoPolicy)
+				continue
+			}
+			if err := dhcp4.RelayRequest(p, giaddr, info); err != nil {
+				log.Printf("Dropped request from %v: %v", p.CHAddr, err)
+				m.RelayDropped(*iface, nil, dhcp4metrics.RelayHopLimit)
+				continue
+			}
+			dests = serverAddrs
+		case dhcp4.BootReply:
+			server := peerIP(peer)
+			if !p.GIAddr.Equal(giaddr) || !knownServer(serverAddrs, server) {
+				m.RelayDropped(*iface, server, dhcp4metrics.RelayReplyMismatch)
+				continue
+			}
+			dests = []*net.UDPAddr{dhcp4.RelayReply(p)}
+		default:
+			continue
+		}
+
+		b, err := p.MarshalBinary()
+		if err != nil {
+			log.Printf("Could not relay %v from %v: %v", p.Options.MessageType(), peer, err)
+			continue
+		}
+		for _, dest := range dests {
+			if _, err := conn.WriteTo(b, dest); err != nil {
+				log.Printf("Could not relay %v to %v: %v", p.Options.MessageType(), dest, err)
+				continue
+			}
+			server := dest.IP
+			if p.Op == dhcp4.BootReply {
+				server = peerIP(peer)
+			}
+			m.RelayForwarded(*iface, server, p.Op)
+		}
+	}
+}
+
+// peerIP returns the IP address of peer, or nil if it has none.
+func peerIP(peer net.Addr) net.IP {
+	if u, ok := peer.(*net.UDPAddr); ok {
+		return u.IP
+	}
+	return nil
+}
+
+// knownServer returns whether ip is the address of one of servers.
+func knownServer(servers []*net.UDPAddr, ip net.IP) bool {
+	for _, s := range servers {
+		if s.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ifaceAddr returns the first IPv4 address of the interface named name.
+func ifaceAddr(name string) (net.IP, error) {
+	ifi, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := ifi.Addrs()
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range addrs {
+		if ipn, ok := a.(*net.IPNet); ok && ipn.IP.To4() != nil {
+			return ipn.IP.To4(), nil
+		}
+	}
+	return nil, fmt.Errorf("%s has no IPv4 address", name)
+}
@@ -0,0 +1,128 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// server is a minimal DHCP server that only leases reserved addresses,
+// implemented as a dhcp4server.Handler. Clients without a reservation are
+// ignored, so it can run next to another server.
+//
+// Usage:
+//
+//	server -id 192.168.0.1 -mask 255.255.255.0 -router 192.168.0.1 \
+//		02:00:00:00:00:01=192.168.0.10 02:00:00:00:00:02=192.168.0.11
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+	"github.com/mergetb/dhcp4/dhcp4server"
+)
+
+var (
+	id        = flag.String("id", "", "Server identifier, an address of this host clients can reach")
+	mask      = flag.String("mask", "255.255.255.0", "Subnet mask sent to clients")
+	router    = flag.String("router", "", "Router sent to clients (none if empty)")
+	leaseTime = flag.Duration("lease-time", 24*time.Hour, "Lease time")
+)
+
+// reservations answers clients with the address reserved for their
+// hardware address.
+type reservations struct {
+	serverID net.IP
+	options  dhcp4.Options
+	ips      map[string]net.IP
+}
+
+// ServeDHCP implements dhcp4server.Handler.
+func (r *reservations) ServeDHCP(req *dhcp4.Packet, peer net.Addr) *dhcp4.Packet {
+	ip, ok := r.ips[req.CHAddr.String()]
+	if !ok {
+		return nil
+	}
+	reply := dhcp4.NewPacket(dhcp4.BootReply)
+	switch req.Options.MessageType() {
+	case dhcp4.DHCPDiscover:
+		reply.Options.SetMessageType(dhcp4.DHCPOffer)
+	case dhcp4.DHCPRequest:
+		// Selecting, or renewing and rebinding.
+		requested := req.Options.RequestedIPAddress()
+		if requested == nil {
+			requested = req.CIAddr
+		}
+		if sid := req.Options.ServerIdentifier(); sid != nil && !sid.Equal(r.serverID) {
+			// The client chose another server.
+			return nil
+		}
+		if !ip.Equal(requested) {
+			reply.Options.SetMessageType(dhcp4.DHCPNAK)
+			reply.Options.SetServerIdentifier(r.serverID)
+			return reply
+		}
+		reply.Options.SetMessageType(dhcp4.DHCPACK)
+	default:
+		return nil
+	}
+	reply.YIAddr = ip
+	for code, v := range r.options {
+		reply.Options[code] = v
+	}
+	log.Printf("%v %v to %v", reply.Options.MessageType(), ip, req.CHAddr)
+	return reply
+}
+
+func main() {
+	flag.Parse()
+	r := &reservations{
+		serverID: net.ParseIP(*id).To4(),
+		options:  make(dhcp4.Options),
+		ips:      make(map[string]net.IP),
+	}
+	if r.serverID == nil {
+		log.Fatalf("-id %q is not an IPv4 address", *id)
+	}
+	r.options.SetServerIdentifier(r.serverID)
+	r.options.SetLeaseTime(*leaseTime)
+	r.options.SetSubnetMask(net.IPMask(net.ParseIP(*mask).To4()))
+	if *router != "" {
+		r.options.SetRouters([]net.IP{net.ParseIP(*router)})
+	}
+
+	for _, arg := range flag.Args() {
+		mac, ip, err := parseReservation(arg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		r.ips[mac.String()] = ip
+	}
+	if len(r.ips) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: server -id <address> [flags] <mac>=<address>...")
+		os.Exit(2)
+	}
+
+	log.Fatal(dhcp4server.ListenAndServe(context.Background(), "", r))
+}
+
+// parseReservation parses a reservation of the form mac=address.
+func parseReservation(s string) (net.HardwareAddr, net.IP, error) {
+	i := strings.IndexByte(s, '=')
+	if i < 0 {
+		return nil, nil, fmt.Errorf("reservation %q is not of the form mac=address", s)
+	}
+	mac, err := net.ParseMAC(s[:i])
+	if err != nil {
+		return nil, nil, fmt.Errorf("reservation %q: %v", s, err)
+	}
+	ip := net.ParseIP(s[i+1:]).To4()
+	if ip == nil {
+		return nil, nil, fmt.Errorf("reservation %q: %q is not an IPv4 address", s, s[i+1:])
+	}
+	return mac, ip, nil
+}
@@ -0,0 +1,133 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package fingerprint identifies the kind of device a DHCP client is from
+// the options it sends, as Fingerbank does: the parameters it requests, in
+// the order it requests them, the options it sends, and its vendor class.
+//
+// These depend on the DHCP client software, not on the device, so that
+// devices are told apart by the firmware or operating system they run,
+// e.g. a BMC's embedded client, PXE firmware, an OS installer or a
+// switch's network OS.
+package fingerprint
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/mergetb/dhcp4"
+	"github.com/mergetb/dhcp4/dhcp4opts"
+)
+
+// Fingerprint is what identifies the DHCP client software of a request.
+type Fingerprint struct {
+	// ParameterList is the parameter request list (option 55) as a
+	// comma-separated list of option codes in the order requested, e.g.
+	// "1,3,6,15", as in Fingerbank.
+	ParameterList string
+
+	// Options is the codes of the options sent, in the order sent, as a
+	// comma-separated list.
+	Options string
+
+	// VendorClass is the vendor class identifier (option 60), if sent.
+	VendorClass string
+}
+
+// Of returns the fingerprint of the client that sent p.
+func Of(p *dhcp4.Packet) Fingerprint {
+	var params []string
+	for _, code := range p.Options.Get(dhcp4.OptionParameterRequestList) {
+		params = append(params, strconv.Itoa(int(code)))
+	}
+	var opts []string
+	for _, code := range p.OptionCodes() {
+		opts = append(opts, strconv.Itoa(int(code)))
+	}
+	return Fingerprint{
+		ParameterList: strings.Join(params, ","),
+		Options:       strings.Join(opts, ","),
+		VendorClass:   dhcp4opts.GetString(dhcp4.OptionVendorClassIdentifier, p.Options),
+	}
+}
+
+// String implements fmt.Stringer.
+func (f Fingerprint) String() string {
+	s := "params " + f.ParameterList + " options " + f.Options
+	if f.VendorClass != "" {
+		s += " vendor " + strconv.Quote(f.VendorClass)
+	}
+	return s
+}
+
+// Device is a kind of device, e.g. "bmc", named by a Rule.
+type Device string
+
+// Unknown is the device of fingerprints no rule matches.
+const Unknown Device = "unknown"
+
+// Devices of the rules in Default.
+const (
+	PXEFirmware Device = "pxe-firmware"
+	Installer   Device = "installer"
+	Switch      Device = "switch"
+	Embedded    Device = "embedded"
+	Linux       Device = "linux"
+	Windows     Device = "windows"
+)
+
+// Rule identifies the clients whose fingerprint matches all of its non-empty
+// fields as Device.
+type Rule struct {
+	Device Device
+
+	// ParameterList matches fingerprints with this parameter list
+	// exactly.
+	ParameterList string
+
+	// Options matches fingerprints with these options, in this order,
+	// exactly.
+	Options string
+
+	// VendorClassPrefix matches fingerprints whose vendor class starts
+	// with it.
+	VendorClassPrefix string
+}
+
+// matches returns whether f matches r.
+func (r Rule) matches(f Fingerprint) bool {
+	if r.ParameterList == "" && r.Options == "" && r.VendorClassPrefix == "" {
+		return false
+	}
+	return (r.ParameterList == "" || r.ParameterList == f.ParameterList) &&
+		(r.Options == "" || r.Options == f.Options) &&
+		(r.VendorClassPrefix == "" || strings.HasPrefix(f.VendorClass, r.VendorClassPrefix))
+}
+
+// Database is a list of rules, of which the first matching a fingerprint
+// identifies it.
+type Database []Rule
+
+// Identify returns the device of the first rule f matches, or Unknown.
+func (db Database) Identify(f Fingerprint) Device {
+	for _, r := range db {
+		if r.matches(f) {
+			return r.Device
+		}
+	}
+	return Unknown
+}
+
+// Default identifies clients by the vendor classes of common DHCP client
+// software. Testbeds usually prepend rules for the exact parameter lists
+// of their BMCs and switches, which embedded clients share.
+var Default = Database{
+	{Device: PXEFirmware, VendorClassPrefix: "PXEClient"},
+	{Device: Installer, VendorClassPrefix: "anaconda-"},
+	{Device: Installer, VendorClassPrefix: "d-i"},
+	{Device: Switch, VendorClassPrefix: "onie_vendor:"},
+	{Device: Embedded, VendorClassPrefix: "udhcp"},
+	{Device: Linux, VendorClassPrefix: "dhcpcd-"},
+	{Device: Windows, VendorClassPrefix: "MSFT "},
+}
@@ -0,0 +1,82 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fingerprint
+
+import (
+	"testing"
+
+	"github.com/mergetb/dhcp4"
+)
+
+func TestOf(t *testing.T) {
+	p := dhcp4.NewPacket(dhcp4.BootRequest)
+	p.Options.AddRaw(dhcp4.OptionDHCPMessageType, []byte{1})
+	p.Options.AddRaw(dhcp4.OptionParameterRequestList, []byte{1, 3, 6, 15, 119})
+	p.Options.AddRaw(dhcp4.OptionVendorClassIdentifier, []byte("udhcp 1.30.1"))
+
+	// Options keep the order they were received in.
+	b, err := p.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err = dhcp4.ParsePacket(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Fingerprint{
+		ParameterList: "1,3,6,15,119",
+		Options:       "53,55,60",
+		VendorClass:   "udhcp 1.30.1",
+	}
+	if got := Of(p); got != want {
+		t.Errorf("Of() = %+v, want %+v", got, want)
+	}
+}
+
+func TestIdentify(t *testing.T) {
+	bmc := Device("bmc")
+	db := append(Database{
+		{Device: bmc, ParameterList: "1,3,6,12,15,28,42"},
+	}, Default...)
+
+	for _, tt := range []struct {
+		name string
+		f    Fingerprint
+		want Device
+	}{
+		{
+			name: "parameter list",
+			f:    Fingerprint{ParameterList: "1,3,6,12,15,28,42", VendorClass: "udhcp 1.30.1"},
+			want: bmc,
+		},
+		{
+			name: "parameter list in another order",
+			f:    Fingerprint{ParameterList: "1,3,6,12,15,42,28", VendorClass: "udhcp 1.30.1"},
+			want: Embedded,
+		},
+		{
+			name: "vendor class prefix",
+			f:    Fingerprint{VendorClass: "PXEClient:Arch:00007:UNDI:003016"},
+			want: PXEFirmware,
+		},
+		{
+			name: "installer",
+			f:    Fingerprint{VendorClass: "anaconda-Linux 5.14.0 x86_64"},
+			want: Installer,
+		},
+		{
+			name: "unknown",
+			f:    Fingerprint{ParameterList: "1,3,6"},
+			want: Unknown,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := db.Identify(tt.f); got != tt.want {
+				t.Errorf("Identify(%v) = %v, want %v", tt.f, got, tt.want)
+			}
+		})
+	}
+}
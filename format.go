@@ -0,0 +1,316 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Summary returns a one-line description of the packet for logs, e.g.
+//
+//	DHCPACK xid 0x12345678 chaddr 02:00:00:00:00:01 yiaddr 10.0.0.5 server 10.0.0.1
+//
+// Addresses that are not set are left out.
+func (p *Packet) Summary() string {
+	var b strings.Builder
+	if t := p.Options.MessageType(); t != 0 {
+		b.WriteString(t.String())
+	} else {
+		// A BOOTP packet.
+		b.WriteString(p.Op.String())
+	}
+	fmt.Fprintf(&b, " xid 0x%x", p.TransactionID[:])
+	if hw := p.HardwareAddrString(); hw != "" {
+		fmt.Fprintf(&b, " chaddr %s", hw)
+	}
+	for _, f := range []struct {
+		name string
+		ip   net.IP
+	}{
+		{"ciaddr", p.CIAddr},
+		{"yiaddr", p.YIAddr},
+		{"giaddr", p.GIAddr},
+		{"requested", p.Options.RequestedIPAddress()},
+		{"server", p.Options.ServerIdentifier()},
+	} {
+		if f.ip != nil && !f.ip.IsUnspecified() {
+			fmt.Fprintf(&b, " %s %v", f.name, f.ip)
+		}
+	}
+	return b.String()
+}
+
+// String implements fmt.Stringer. It returns the Summary of the packet; see
+// Verbose for all of its fields and options.
+func (p *Packet) String() string {
+	return p.Summary()
+}
+
+// Verbose returns a multi-line description of all fields and options of the
+// packet, with options decoded by name as by FormatOption, e.g.
+//
+//	DHCPACK xid 0x12345678 chaddr 02:00:00:00:00:01 yiaddr 10.0.0.5 server 10.0.0.1
+//	  op BOOTREPLY htype 1 hops 0 secs 0 broadcast false
+//	  ciaddr 0.0.0.0 yiaddr 10.0.0.5 siaddr 0.0.0.0 giaddr 0.0.0.0
+//	  Option (53) DHCP Message Type: DHCPACK
+//	  Option (51) IP Address Lease Time: 1h0m0s
+//	  ...
+//
+// Options are listed in the order they are marshaled in.
+func (p *Packet) Verbose() string {
+	var b strings.Builder
+	b.WriteString(p.Summary())
+	fmt.Fprintf(&b, "\n  op %v htype %d hops %d secs %d broadcast %v", p.Op, p.HType, p.Hops, p.Secs, p.Broadcast)
+	fmt.Fprintf(&b, "\n  ciaddr %v yiaddr %v siaddr %v giaddr %v",
+		dottedQuad(p.CIAddr), dottedQuad(p.YIAddr), dottedQuad(p.SIAddr), dottedQuad(p.GIAddr))
+	if p.ServerName != "" {
+		fmt.Fprintf(&b, "\n  sname %q", SanitizeString([]byte(p.ServerName)))
+	}
+	if p.BootFile != "" {
+		fmt.Fprintf(&b, "\n  file %q", SanitizeString([]byte(p.BootFile)))
+	}
+	if p.VendorArea != nil {
+		fmt.Fprintf(&b, "\n  vend %x", p.VendorArea)
+	}
+	for _, code := range p.Options.sortedKeys() {
+		code := OptionCode(code)
+		fmt.Fprintf(&b, "\n  Option (%d) %v: %s", uint8(code), code, FormatOption(code, p.Options[code]))
+	}
+	return b.String()
+}
+
+// dottedQuad returns ip, or 0.0.0.0 if it is nil.
+func dottedQuad(ip net.IP) net.IP {
+	if ip == nil {
+		return net.IPv4zero
+	}
+	return ip
+}
+
+// FormatOption renders the value b of option code for humans: addresses in
+// dotted quads, times as durations, message types and option codes by name,
+// strings sanitized and quoted. Values of unknown options and malformed
+// values are rendered in hex.
+func FormatOption(code OptionCode, b []byte) string {
+	if s, ok := formatOption(code, b); ok {
+		return s
+	}
+	return fmt.Sprintf("%x", b)
+}
+
+func formatOption(code OptionCode, b []byte) (string, bool) {
+	o := Options{code: b}
+	switch code {
+	case OptionDHCPMessageType:
+		if len(b) != 1 {
+			return "", false
+		}
+		return MessageType(b[0]).String(), true
+
+	case OptionTimeOffset:
+		if len(b) != 4 {
+			return "", false
+		}
+		return (time.Duration(int32(binary.BigEndian.Uint32(b))) * time.Second).String(), true
+
+	case OptionIPAddressLeaseTime, OptionRenewalTimeValue, OptionRebindingTimeValue:
+		if len(b) == 4 && binary.BigEndian.Uint32(b) == math.MaxUint32 {
+			return "infinite", true
+		}
+
+	case OptionClientIdentifier:
+		// RFC 2132, Section 9.14: a hardware type and address, or
+		// something else if the type is 0.
+		if len(b) < 2 || b[0] == 0 {
+			return "", false
+		}
+		return fmt.Sprintf("htype %d %s", b[0], net.HardwareAddr(b[1:])), true
+
+	case OptionClasslessStaticRoute:
+		routes, err := ParseClasslessRoutes(b)
+		if err != nil {
+			return "", false
+		}
+		return join(len(routes), func(i int) string { return routes[i].String() }), true
+
+	case OptionRelayAgentInformation:
+		r, err := ParseRelayAgentInfo(b)
+		if err != nil {
+			return "", false
+		}
+		return formatRelayAgentInfo(r), true
+
+	case OptionVIVendorClass:
+		v, err := ParseVIVendorClass(b)
+		if err != nil {
+			return "", false
+		}
+		return formatVIVendorClass(v), true
+
+	case OptionVIVendorSpecificInformation:
+		v, err := ParseVIVendorInfo(b)
+		if err != nil {
+			return "", false
+		}
+		return formatVIVendorInfo(v), true
+
+	case OptionAuthentication:
+		a, err := ParseAuthentication(b)
+		if err != nil {
+			return "", false
+		}
+		return a.String(), true
+
+	case OptionUserClass:
+		classes := o.UserClasses()
+		if classes == nil {
+			return "", false
+		}
+		return join(len(classes), func(i int) string { return fmt.Sprintf("%q", SanitizeString([]byte(classes[i]))) }), true
+
+	case OptionClientSystemArchitecture:
+		archs := o.ClientSystemArchitectures()
+		if archs == nil {
+			return "", false
+		}
+		return join(len(archs), func(i int) string { return archs[i].String() }), true
+
+	case OptionClientNetworkInterfaceIdentifier:
+		id, ok := o.ClientNetworkInterfaceID()
+		return id.String(), ok
+
+	case OptionClientMachineIdentifier:
+		id, ok := o.ClientMachineID()
+		return id.String(), ok
+	}
+
+	v := NewOptionValue(code)
+	if v == nil || v.UnmarshalBinary(b) != nil {
+		return "", false
+	}
+	return formatValue(v), true
+}
+
+// formatValue renders a decoded option value.
+func formatValue(v OptionValue) string {
+	switch v := v.(type) {
+	case *IP:
+		return net.IP(*v).String()
+	case *IPList:
+		return join(len(*v), func(i int) string { return (*v)[i].String() })
+	case *Duration:
+		return time.Duration(*v).String()
+	case *String:
+		return fmt.Sprintf("%q", SanitizeString([]byte(*v)))
+	case *Bool:
+		return fmt.Sprint(bool(*v))
+	case *U8:
+		return fmt.Sprint(*v)
+	case *U16:
+		return fmt.Sprint(*v)
+	case *U32:
+		return fmt.Sprint(*v)
+	case *I32:
+		return fmt.Sprint(*v)
+	case *U16List:
+		return join(len(*v), func(i int) string { return fmt.Sprint((*v)[i]) })
+	case *CodeList:
+		return join(len(*v), func(i int) string { return fmt.Sprintf("(%d) %v", uint8((*v)[i]), (*v)[i]) })
+	case *IPNetList:
+		return join(len(*v), func(i int) string { return (*v)[i].String() })
+	case *StaticRouteList:
+		return join(len(*v), func(i int) string { return fmt.Sprintf("%v via %v", (*v)[i].Destination, (*v)[i].Router) })
+	case *DomainList:
+		return strings.Join(*v, ", ")
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// formatRelayAgentInfo renders the sub-options of r.
+func formatRelayAgentInfo(r *RelayAgentInfo) string {
+	var parts []string
+	if r.CircuitID != nil {
+		parts = append(parts, fmt.Sprintf("circuit-id %x", r.CircuitID))
+	}
+	if r.RemoteID != nil {
+		parts = append(parts, fmt.Sprintf("remote-id %x", r.RemoteID))
+	}
+	if r.LinkSelection != nil {
+		parts = append(parts, fmt.Sprintf("link-selection %v", r.LinkSelection))
+	}
+	if r.VSS != nil {
+		parts = append(parts, r.VSS.String())
+	}
+	codes := make([]int, 0, len(r.Other))
+	for code := range r.Other {
+		codes = append(codes, int(code))
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		parts = append(parts, fmt.Sprintf("sub-option %d %x", code, r.Other[uint8(code)]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// formatVIVendorClass renders the vendor classes sorted by enterprise
+// number.
+func formatVIVendorClass(v VIVendorClass) string {
+	ents := make([]uint32, 0, len(v))
+	for ent := range v {
+		ents = append(ents, ent)
+	}
+	sort.Slice(ents, func(i, j int) bool { return ents[i] < ents[j] })
+
+	parts := make([]string, 0, len(ents))
+	for _, ent := range ents {
+		classes := v[ent]
+		parts = append(parts, fmt.Sprintf("enterprise %d %s", ent, join(len(classes), func(i int) string {
+			return fmt.Sprintf("%q", SanitizeString([]byte(classes[i])))
+		})))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// formatVIVendorInfo renders the sub-options sorted by enterprise number
+// and code.
+func formatVIVendorInfo(v VIVendorInfo) string {
+	ents := make([]uint32, 0, len(v))
+	for ent := range v {
+		ents = append(ents, ent)
+	}
+	sort.Slice(ents, func(i, j int) bool { return ents[i] < ents[j] })
+
+	parts := make([]string, 0, len(ents))
+	for _, ent := range ents {
+		sub := v[ent]
+		codes := make([]int, 0, len(sub))
+		for code := range sub {
+			codes = append(codes, int(code))
+		}
+		sort.Ints(codes)
+		parts = append(parts, fmt.Sprintf("enterprise %d %s", ent, join(len(codes), func(i int) string {
+			return fmt.Sprintf("sub-option %d %x", codes[i], sub[uint8(codes[i])])
+		})))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// join renders the n elements returned by elem separated by commas.
+func join(n int, elem func(int) string) string {
+	s := make([]string, n)
+	for i := range s {
+		s[i] = elem(i)
+	}
+	return strings.Join(s, ", ")
+}
@@ -0,0 +1,96 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestOptionCodeString(t *testing.T) {
+	for _, tt := range []struct {
+		code OptionCode
+		want string
+	}{
+		{OptionSubnetMask, "Subnet Mask"},
+		{OptionIPAddressLeaseTime, "IP Address Lease Time"},
+		{OptionClasslessStaticRoute, "Classless Static Route"},
+		{200, "OptionCode(200)"},
+	} {
+		if got := tt.code.String(); got != tt.want {
+			t.Errorf("OptionCode(%d).String() = %q, want %q", uint8(tt.code), got, tt.want)
+		}
+	}
+}
+
+func TestFormatOption(t *testing.T) {
+	for _, tt := range []struct {
+		code OptionCode
+		in   []byte
+		want string
+	}{
+		{OptionDHCPMessageType, []byte{5}, "DHCPACK"},
+		{OptionSubnetMask, []byte{255, 255, 255, 0}, "255.255.255.0"},
+		{OptionRouters, []byte{10, 0, 0, 1, 10, 0, 0, 2}, "10.0.0.1, 10.0.0.2"},
+		{OptionIPAddressLeaseTime, []byte{0, 0, 0x0e, 0x10}, "1h0m0s"},
+		{OptionIPAddressLeaseTime, []byte{0xff, 0xff, 0xff, 0xff}, "infinite"},
+		{OptionTimeOffset, []byte{0xff, 0xff, 0xff, 0xc4}, "-1m0s"},
+		{OptionHostName, []byte("node0\nx"), `"node0�x"`},
+		{OptionParameterRequestList, []byte{1, 3, 200}, "(1) Subnet Mask, (3) Router, (200) OptionCode(200)"},
+		{OptionInterfaceMTU, []byte{0x05, 0xdc}, "1500"},
+		{OptionIPForwardingEnableDisable, []byte{1}, "true"},
+		{OptionClientIdentifier, []byte{1, 2, 0, 0, 0, 0, 1}, "htype 1 02:00:00:00:00:01"},
+		{OptionClientIdentifier, []byte{0, 'i', 'd'}, "006964"},
+		{OptionClasslessStaticRoute, []byte{24, 10, 0, 1, 10, 0, 0, 1}, "10.0.1.0/24 via 10.0.0.1"},
+		{OptionRelayAgentInformation, []byte{1, 2, 0, 3, 2, 1, 9}, "circuit-id 0003, remote-id 09"},
+		{OptionDomainSearch, []byte{3, 'e', 'n', 'g', 0}, "eng"},
+		{OptionUserClass, []byte("\x03foo\x04iPXE"), `"foo", "iPXE"`},
+		{OptionVIVendorClass, []byte("\x00\x00\x00\x09\x04\x03ios"), `enterprise 9 "ios"`},
+		{OptionVIVendorSpecificInformation, []byte{0, 0, 0, 9, 3, 1, 1, 7, 0, 0, 0x0a, 0x4c, 2, 2, 0}, "enterprise 9 sub-option 1 07; enterprise 2636 sub-option 2 "},
+
+		// Malformed and unknown values are rendered in hex.
+		{OptionSubnetMask, []byte{255, 255}, "ffff"},
+		{OptionDHCPMessageType, nil, ""},
+		{200, []byte{0xde, 0xad}, "dead"},
+	} {
+		if got := FormatOption(tt.code, tt.in); got != tt.want {
+			t.Errorf("FormatOption(%v, %x) = %q, want %q", tt.code, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestPacketSummary(t *testing.T) {
+	p := NewPacket(BootReply)
+	p.TransactionID = [4]byte{0x12, 0x34, 0x56, 0x78}
+	p.CHAddr = net.HardwareAddr{2, 0, 0, 0, 0, 1}
+	p.YIAddr = net.IP{10, 0, 0, 5}
+	p.Options.SetMessageType(DHCPACK)
+	p.Options.SetServerIdentifier(net.IP{10, 0, 0, 1})
+	p.Options.SetLeaseTime(time.Hour)
+
+	want := "DHCPACK xid 0x12345678 chaddr 02:00:00:00:00:01 yiaddr 10.0.0.5 server 10.0.0.1"
+	if got := p.Summary(); got != want {
+		t.Errorf("Summary() = %q, want %q", got, want)
+	}
+	if got := p.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+
+	want += "\n" +
+		"  op BOOTREPLY htype 1 hops 0 secs 0 broadcast false\n" +
+		"  ciaddr 0.0.0.0 yiaddr 10.0.0.5 siaddr 0.0.0.0 giaddr 0.0.0.0\n" +
+		"  Option (51) IP Address Lease Time: 1h0m0s\n" +
+		"  Option (53) DHCP Message Type: DHCPACK\n" +
+		"  Option (54) Server Identifier: 10.0.0.1"
+	if got := p.Verbose(); got != want {
+		t.Errorf("Verbose() = \n%s\nwant\n%s", got, want)
+	}
+
+	bootp := NewPacket(BootRequest)
+	if got, want := bootp.Summary(), "BOOTREQUEST xid 0x00000000"; got != want {
+		t.Errorf("Summary() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Client FQDN flags, see ClientFQDN.
+const (
+	// FQDNServerUpdate (S) asks the server to update the A RR of the
+	// client, or tells the client the server did.
+	FQDNServerUpdate uint8 = 1 << 0
+
+	// FQDNOverride (O) tells the client that the server overrode its
+	// preference given by FQDNServerUpdate. Clients do not set it.
+	FQDNOverride uint8 = 1 << 1
+
+	// FQDNEncoded (E) means the name is in DNS wire format rather than
+	// ASCII, which is deprecated. MarshalBinary always sets it.
+	FQDNEncoded uint8 = 1 << 2
+
+	// FQDNNoUpdate (N) asks the server not to update any DNS RRs. It
+	// must not be combined with FQDNServerUpdate.
+	FQDNNoUpdate uint8 = 1 << 3
+)
+
+// ClientFQDN is the value of OptionClientFQDN as defined by RFC 4702: the
+// client's domain name, and who updates DNS for it.
+type ClientFQDN struct {
+	// Flags is a combination of the FQDN flags.
+	Flags uint8 `json:"flags"`
+
+	// Name is the domain name. A name ending in a dot is fully qualified;
+	// servers complete other names with their domain (RFC 4702 Section
+	// 3.1).
+	Name string `json:"name"`
+}
+
+// String implements fmt.Stringer.
+func (f ClientFQDN) String() string {
+	return fmt.Sprintf("%s (flags %#x)", f.Name, f.Flags)
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler. The name is encoded in
+// canonical DNS wire format, and the deprecated RCODE fields are 0, as RFC
+// 4702 Section 2.2 requires of clients.
+func (f ClientFQDN) MarshalBinary() ([]byte, error) {
+	if f.Flags&FQDNServerUpdate != 0 && f.Flags&FQDNNoUpdate != 0 {
+		return nil, errors.New("client FQDN: S and N flags both set")
+	}
+	b := []byte{f.Flags | FQDNEncoded, 0, 0}
+	name := strings.TrimSuffix(f.Name, ".")
+	if name == "" {
+		if f.Name == "." {
+			b = append(b, 0)
+		}
+		return b, nil
+	}
+	if len(name)+2 > maxNameLen {
+		return nil, fmt.Errorf("client FQDN: name %q longer than %d bytes", name, maxNameLen)
+	}
+	for _, label := range strings.Split(name, ".") {
+		if err := checkLabel(label); err != nil {
+			return nil, fmt.Errorf("client FQDN: name %q: %v", f.Name, err)
+		}
+		b = append(b, uint8(len(label)))
+		b = append(b, label...)
+	}
+	if strings.HasSuffix(f.Name, ".") {
+		b = append(b, 0)
+	}
+	return b, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler. Names in wire
+// format that end in the root label are returned with a trailing dot.
+func (f *ClientFQDN) UnmarshalBinary(b []byte) error {
+	if len(b) < 3 {
+		return errLength(b, "at least 3")
+	}
+	flags := b[0] &^ 0xf0
+	if flags&FQDNServerUpdate != 0 && flags&FQDNNoUpdate != 0 {
+		return errors.New("client FQDN: S and N flags both set")
+	}
+	name := b[3:]
+	if flags&FQDNEncoded == 0 {
+		// Deprecated ASCII encoding.
+		for _, r := range string(name) {
+			if !isDNSNameChar(r) {
+				return fmt.Errorf("client FQDN: name %q has invalid character %q", name, r)
+			}
+		}
+		*f = ClientFQDN{Flags: flags, Name: string(name)}
+		return nil
+	}
+
+	var labels []string
+	fqdn := false
+	for pos := 0; pos < len(name); {
+		n := int(name[pos])
+		if n == 0 {
+			if pos != len(name)-1 {
+				return fmt.Errorf("client FQDN: data after the root label at %d", pos)
+			}
+			fqdn = true
+			break
+		}
+		if pos+1+n > len(name) {
+			return fmt.Errorf("client FQDN: label at %d truncated", pos)
+		}
+		label := string(name[pos+1 : pos+1+n])
+		if err := checkLabel(label); err != nil {
+			return fmt.Errorf("client FQDN: %v", err)
+		}
+		labels = append(labels, label)
+		pos += 1 + n
+	}
+	if len(name) > maxNameLen {
+		return fmt.Errorf("client FQDN: name longer than %d bytes", maxNameLen)
+	}
+	v := ClientFQDN{Flags: flags, Name: strings.Join(labels, ".")}
+	if fqdn {
+		v.Name += "."
+	}
+	*f = v
+	return nil
+}
+
+// ClientFQDN returns the client FQDN.
+//
+// It returns nil if the option is not present or malformed. The option is
+// defined by RFC 4702.
+func (o Options) ClientFQDN() *ClientFQDN {
+	f := new(ClientFQDN)
+	if !o.Value(OptionClientFQDN, f) {
+		return nil
+	}
+	return f
+}
+
+// SetClientFQDN sets the client FQDN.
+//
+// A nil or invalid value removes the option.
+func (o Options) SetClientFQDN(v *ClientFQDN) {
+	var b []byte
+	if v != nil {
+		var err error
+		if b, err = v.MarshalBinary(); err != nil {
+			b = nil
+		}
+	}
+	o.setBytes(OptionClientFQDN, b)
+}
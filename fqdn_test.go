@@ -0,0 +1,98 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestClientFQDN(t *testing.T) {
+	for _, tt := range []struct {
+		desc string
+		fqdn ClientFQDN
+		wire []byte
+	}{
+		{
+			desc: "fully qualified",
+			fqdn: ClientFQDN{Flags: FQDNServerUpdate | FQDNEncoded, Name: "host.example.com."},
+			wire: []byte("\x05\x00\x00\x04host\x07example\x03com\x00"),
+		},
+		{
+			desc: "partial",
+			fqdn: ClientFQDN{Flags: FQDNEncoded, Name: "host"},
+			wire: []byte("\x04\x00\x00\x04host"),
+		},
+		{
+			desc: "no update",
+			fqdn: ClientFQDN{Flags: FQDNNoUpdate | FQDNEncoded, Name: "a.b"},
+			wire: []byte("\x0c\x00\x00\x01a\x01b"),
+		},
+		{
+			desc: "empty name",
+			fqdn: ClientFQDN{Flags: FQDNEncoded},
+			wire: []byte("\x04\x00\x00"),
+		},
+	} {
+		got, err := tt.fqdn.MarshalBinary()
+		if err != nil || !bytes.Equal(got, tt.wire) {
+			t.Errorf("%s: MarshalBinary() = %q, %v; want %q", tt.desc, got, err, tt.wire)
+		}
+		var f ClientFQDN
+		if err := f.UnmarshalBinary(tt.wire); err != nil || f != tt.fqdn {
+			t.Errorf("%s: UnmarshalBinary(%q) = %v, %v; want %v", tt.desc, tt.wire, f, err, tt.fqdn)
+		}
+	}
+}
+
+func TestClientFQDNASCII(t *testing.T) {
+	var f ClientFQDN
+	want := ClientFQDN{Flags: FQDNServerUpdate, Name: "host.example.com"}
+	if err := f.UnmarshalBinary([]byte("\x01\xff\xffhost.example.com")); err != nil || f != want {
+		t.Errorf("UnmarshalBinary(ASCII) = %v, %v; want %v", f, err, want)
+	}
+}
+
+func TestClientFQDNInvalid(t *testing.T) {
+	for _, b := range [][]byte{
+		[]byte("\x04\x00"),
+		[]byte("\x0d\x00\x00\x04host"),
+		[]byte("\x04\x00\x00\x05host"),
+		[]byte("\x04\x00\x00\x04host\x00\x01a"),
+		[]byte("\x04\x00\x00\x04h st"),
+		[]byte("\x00\x00\x00h st"),
+	} {
+		var f ClientFQDN
+		if err := f.UnmarshalBinary(b); err == nil {
+			t.Errorf("UnmarshalBinary(%q) = %v, want error", b, f)
+		}
+	}
+
+	for _, f := range []ClientFQDN{
+		{Flags: FQDNServerUpdate | FQDNNoUpdate, Name: "host"},
+		{Name: "bad..name"},
+		{Name: "host name"},
+	} {
+		if b, err := f.MarshalBinary(); err == nil {
+			t.Errorf("MarshalBinary(%v) = %q, want error", f, b)
+		}
+	}
+}
+
+func TestClientFQDNOption(t *testing.T) {
+	o := make(Options)
+	if got := o.ClientFQDN(); got != nil {
+		t.Errorf("ClientFQDN() = %v, want nil", got)
+	}
+	want := &ClientFQDN{Flags: FQDNServerUpdate | FQDNEncoded, Name: "host.example.com."}
+	o.SetClientFQDN(want)
+	if got := o.ClientFQDN(); got == nil || *got != *want {
+		t.Errorf("ClientFQDN() = %v, want %v", got, want)
+	}
+	o.SetClientFQDN(nil)
+	if _, ok := o[OptionClientFQDN]; ok {
+		t.Errorf("SetClientFQDN(nil) left the option")
+	}
+}
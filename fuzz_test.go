@@ -0,0 +1,80 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4
+
+import (
+	"net"
+	"testing"
+)
+
+// fuzzPacket returns a packet with options of many kinds, as a seed for the
+// fuzz targets.
+func fuzzPacket(f *testing.F) []byte {
+	p := NewPacket(BootRequest)
+	p.TransactionID = [4]byte{1, 2, 3, 4}
+	p.CHAddr = net.HardwareAddr{2, 0, 0, 0, 0, 1}
+	p.Options.SetMessageType(DHCPDiscover)
+	p.Options.SetHostName("node0")
+	p.Options.SetParameterRequestList([]OptionCode{OptionSubnetMask, OptionRouters, OptionDomainSearch})
+	p.Options.SetDomainSearch([]string{"eng.example.com", "example.com"})
+	p.Options.SetClientFQDN(&ClientFQDN{Flags: FQDNServerUpdate, Name: "node0.example.com."})
+	p.Options.SetRelayAgentInfo(&RelayAgentInfo{CircuitID: []byte("eth0"), LinkSelection: net.IP{10, 0, 0, 0}})
+	p.Options.SetClasslessStaticRoutes([]Route{{Dest: &net.IPNet{IP: net.IP{10, 0, 0, 0}, Mask: net.CIDRMask(8, 32)}, Router: net.IP{10, 0, 0, 1}}})
+	b, err := p.MarshalBinary()
+	if err != nil {
+		f.Fatal(err)
+	}
+	return b
+}
+
+// FuzzParsePacket checks that parsing never panics, and that packets that
+// parse can be marshaled, formatted and parsed again.
+func FuzzParsePacket(f *testing.F) {
+	seed := fuzzPacket(f)
+	f.Add(seed)
+	f.Add(seed[:len(seed)-3])
+	f.Fuzz(func(t *testing.T, b []byte) {
+		for _, uo := range []UnmarshalOptions{{}, {Lenient: true}} {
+			var p Packet
+			if err := uo.Unmarshal(&p, b); err != nil {
+				continue
+			}
+			p.Verbose()
+			Lint(&p)
+			out, err := p.MarshalBinary()
+			if err != nil {
+				continue
+			}
+			if _, err := ParsePacket(out); err != nil {
+				t.Errorf("ParsePacket(MarshalBinary(%x)) = %v", b, err)
+			}
+		}
+	})
+}
+
+// FuzzOptionValues checks that decoding and formatting option values never
+// panics.
+func FuzzOptionValues(f *testing.F) {
+	f.Add(uint8(OptionDomainSearch), []byte{3, 'e', 'n', 'g', 0xc0, 0})
+	f.Add(uint8(OptionClientFQDN), []byte{1, 0, 0, 3, 'f', 'o', 'o', 0})
+	f.Add(uint8(OptionRelayAgentInformation), []byte{1, 2, 'a', 'b', 151, 1, 255})
+	f.Add(uint8(OptionClasslessStaticRoute), []byte{24, 10, 0, 1, 10, 0, 0, 1})
+	f.Add(uint8(OptionClientSystemArchitecture), []byte{0, 7})
+	f.Fuzz(func(t *testing.T, code uint8, b []byte) {
+		if v := NewOptionValue(OptionCode(code)); v != nil && v.UnmarshalBinary(b) == nil {
+			v.MarshalBinary()
+		}
+		FormatOption(OptionCode(code), b)
+		ParseDomainSearch(b)
+		ParseRelayAgentInfo(b)
+		ParseClasslessRoutes(b)
+
+		o := Options{OptionCode(code): b}
+		o.ClientSystemArchitectures()
+		o.ClientNetworkInterfaceID()
+		o.ClientMachineID()
+		o.MarshalJSON()
+	})
+}
@@ -0,0 +1,113 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Hardware types as listed in the IANA ARP assigned numbers, for use in
+// Packet.HType.
+const (
+	HTypeEthernet   uint8 = 1
+	HTypeIEEE802    uint8 = 6
+	HTypeEUI64      uint8 = 27
+	HTypeInfiniBand uint8 = 32
+)
+
+// infiniBandAddrLen is the length of an IP over InfiniBand link-layer
+// address as described by RFC 4391, Section 9.1.1.
+const infiniBandAddrLen = 20
+
+// ParseHardwareAddr parses s as a link-layer address.
+//
+// In addition to the formats accepted by net.ParseMAC (colon- and
+// hyphen-separated, Cisco-style dotted, and 20-octet IP over InfiniBand
+// addresses), ParseHardwareAddr accepts unseparated hex digits, such as
+// "00005e005301".
+func ParseHardwareAddr(s string) (net.HardwareAddr, error) {
+	s = strings.TrimSpace(s)
+	if !strings.ContainsAny(s, ":-.") {
+		b, err := hex.DecodeString(s)
+		if err != nil || len(b) == 0 {
+			return nil, fmt.Errorf("invalid hardware address %q", s)
+		}
+		return net.HardwareAddr(b), nil
+	}
+	return net.ParseMAC(s)
+}
+
+// FormatHardwareAddr renders the client hardware address addr of type htype.
+//
+// Ethernet and other addresses are rendered in colon-separated hex. An
+// InfiniBand address is rendered in the same form, but RFC 4390 requires
+// InfiniBand clients to leave chaddr empty, in which case FormatHardwareAddr
+// returns "infiniband" since the client is only identified by its client
+// identifier.
+func FormatHardwareAddr(htype uint8, addr net.HardwareAddr) string {
+	if len(addr) == 0 {
+		if htype == HTypeInfiniBand {
+			return "infiniband"
+		}
+		return ""
+	}
+	return addr.String()
+}
+
+// HardwareAddr returns the client hardware address, respecting the hardware
+// address length that was on the wire.
+func (p *Packet) HardwareAddr() net.HardwareAddr {
+	if len(p.CHAddr) > chaddrLen {
+		return p.CHAddr[:chaddrLen]
+	}
+	return p.CHAddr
+}
+
+// HardwareAddrString renders the client hardware address according to the
+// packet's hardware type.
+func (p *Packet) HardwareAddrString() string {
+	return FormatHardwareAddr(p.HType, p.HardwareAddr())
+}
+
+// SetHardwareAddr sets the hardware type and client hardware address fields
+// for the link-layer address addr.
+//
+// The hardware type is derived from the length of addr: 6-octet addresses
+// are Ethernet, 8-octet addresses are EUI-64, and 20-octet addresses are IP
+// over InfiniBand. As required by RFC 4390, Section 2.1, InfiniBand clients
+// leave chaddr empty and set the broadcast flag; they must identify
+// themselves using a client identifier. Other addresses of at most 16
+// octets keep the packet's current hardware type.
+func (p *Packet) SetHardwareAddr(addr net.HardwareAddr) error {
+	switch len(addr) {
+	case 6:
+		p.HType = HTypeEthernet
+	case 8:
+		p.HType = HTypeEUI64
+	case infiniBandAddrLen:
+		p.HType = HTypeInfiniBand
+		p.CHAddr = net.HardwareAddr{}
+		p.Broadcast = true
+		return nil
+	}
+	if len(addr) > chaddrLen {
+		return fmt.Errorf("hardware address %v is longer than %d bytes", addr, chaddrLen)
+	}
+	p.CHAddr = append(net.HardwareAddr(nil), addr...)
+	return nil
+}
+
+// SetHardwareAddrString parses s using ParseHardwareAddr and sets it as the
+// client hardware address using SetHardwareAddr.
+func (p *Packet) SetHardwareAddrString(s string) error {
+	addr, err := ParseHardwareAddr(s)
+	if err != nil {
+		return err
+	}
+	return p.SetHardwareAddr(addr)
+}
@@ -0,0 +1,101 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4
+
+import (
+	"bytes"
+	"net"
+	"testing"
+)
+
+func TestParseHardwareAddr(t *testing.T) {
+	for _, tt := range []struct {
+		s       string
+		want    net.HardwareAddr
+		wantErr bool
+	}{
+		{s: "00:00:5e:00:53:01", want: net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 1}},
+		{s: "00-00-5E-00-53-01", want: net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 1}},
+		{s: "0000.5e00.5301", want: net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 1}},
+		{s: "00005e005301", want: net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 1}},
+		{s: " 00005e005301\n", want: net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 1}},
+		{
+			s:    "00:00:00:00:fe:80:00:00:00:00:00:00:02:00:5e:10:00:00:00:01",
+			want: net.HardwareAddr{0, 0, 0, 0, 0xfe, 0x80, 0, 0, 0, 0, 0, 0, 2, 0, 0x5e, 0x10, 0, 0, 0, 1},
+		},
+		{s: "", wantErr: true},
+		{s: "00005e00530", wantErr: true},
+		{s: "zz:00:5e:00:53:01", wantErr: true},
+	} {
+		got, err := ParseHardwareAddr(tt.s)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseHardwareAddr(%q) error = %v, want error %t", tt.s, err, tt.wantErr)
+			continue
+		}
+		if !bytes.Equal(got, tt.want) {
+			t.Errorf("ParseHardwareAddr(%q) = %v, want %v", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestSetHardwareAddr(t *testing.T) {
+	for _, tt := range []struct {
+		addr       string
+		wantHType  uint8
+		wantCHAddr net.HardwareAddr
+		wantString string
+		wantErr    bool
+	}{
+		{
+			addr:       "0000.5e00.5301",
+			wantHType:  HTypeEthernet,
+			wantCHAddr: net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 1},
+			wantString: "00:00:5e:00:53:01",
+		},
+		{
+			addr:       "02:00:5e:10:00:00:00:01",
+			wantHType:  HTypeEUI64,
+			wantCHAddr: net.HardwareAddr{2, 0, 0x5e, 0x10, 0, 0, 0, 1},
+			wantString: "02:00:5e:10:00:00:00:01",
+		},
+		{
+			addr:       "00:00:00:00:fe:80:00:00:00:00:00:00:02:00:5e:10:00:00:00:01",
+			wantHType:  HTypeInfiniBand,
+			wantCHAddr: net.HardwareAddr{},
+			wantString: "infiniband",
+		},
+		{
+			addr:    "00:11:22:33:44:55:66:77:88:99:aa:bb:cc:dd:ee:ff:00",
+			wantErr: true,
+		},
+	} {
+		p := NewPacket(BootRequest)
+		if err := p.SetHardwareAddrString(tt.addr); (err != nil) != tt.wantErr {
+			t.Errorf("SetHardwareAddrString(%q) = %v, want error %t", tt.addr, err, tt.wantErr)
+			continue
+		} else if err != nil {
+			continue
+		}
+
+		// Make sure it survives the wire.
+		b, err := p.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, err = ParsePacket(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.HType != tt.wantHType {
+			t.Errorf("%q: HType = %d, want %d", tt.addr, p.HType, tt.wantHType)
+		}
+		if !bytes.Equal(p.HardwareAddr(), tt.wantCHAddr) {
+			t.Errorf("%q: HardwareAddr() = %v, want %v", tt.addr, p.HardwareAddr(), tt.wantCHAddr)
+		}
+		if got := p.HardwareAddrString(); got != tt.wantString {
+			t.Errorf("%q: HardwareAddrString() = %q, want %q", tt.addr, got, tt.wantString)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package preflight reports missing permissions to speak DHCP before
+// clients and servers start. It is shared by dhcp4client and the commands.
+package preflight
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Error lists the problems found by Check.
+type Error struct {
+	Errors []error
+}
+
+// Error implements error.
+func (pe *Error) Error() string {
+	s := make([]string, 0, len(pe.Errors))
+	for _, err := range pe.Errors {
+		s = append(s, err.Error())
+	}
+	return "preflight failed: " + strings.Join(s, "; ")
+}
+
+// Check opens and closes the connections opened by listen, or a UDP socket
+// on port if there are none, so that missing permissions are reported
+// before a client or server is started rather than on first use.
+//
+// Permission problems binding port are reported as *PermissionError.
+func Check(port int, listen ...func() (net.PacketConn, error)) error {
+	if len(listen) == 0 {
+		listen = append(listen, func() (net.PacketConn, error) {
+			conn, err := net.ListenPacket("udp4", fmt.Sprintf(":%d", port))
+			if err != nil {
+				return nil, BindErr(port, err)
+			}
+			return conn, nil
+		})
+	}
+
+	var errs []error
+	for _, l := range listen {
+		conn, err := l()
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		conn.Close()
+	}
+	if len(errs) > 0 {
+		return &Error{Errors: errs}
+	}
+	return nil
+}
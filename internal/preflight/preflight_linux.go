@@ -0,0 +1,126 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package preflight
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Capability is a Linux capability, as listed in capabilities(7).
+type Capability uint
+
+// Capabilities needed to run DHCP clients and servers.
+const (
+	CapNetBindService Capability = 10
+	CapNetRaw         Capability = 13
+)
+
+// String implements fmt.Stringer.
+func (c Capability) String() string {
+	switch c {
+	case CapNetBindService:
+		return "CAP_NET_BIND_SERVICE"
+	case CapNetRaw:
+		return "CAP_NET_RAW"
+	default:
+		return fmt.Sprintf("capability %d", uint(c))
+	}
+}
+
+// PermissionError is returned when the kernel refuses to set up a socket
+// for lack of privilege.
+type PermissionError struct {
+	// Op describes the refused operation.
+	Op string
+
+	// Capability is the capability the operation requires.
+	Capability Capability
+
+	// HasCapability is true if the process has Capability in its
+	// effective set, in which case the operation was most likely refused
+	// by a Linux Security Module such as SELinux or AppArmor.
+	HasCapability bool
+
+	// Err is the error returned by the kernel.
+	Err error
+}
+
+// Error implements error.
+func (pe *PermissionError) Error() string {
+	return fmt.Sprintf("%s: %v (%s)", pe.Op, pe.Err, pe.Remediation())
+}
+
+// Unwrap returns the error returned by the kernel.
+func (pe *PermissionError) Unwrap() error {
+	return pe.Err
+}
+
+// Remediation explains how to grant the missing permission.
+func (pe *PermissionError) Remediation() string {
+	if pe.HasCapability {
+		return fmt.Sprintf("the process has %s, so a security module probably denied it; "+
+			"check the audit log (ausearch -m avc) for SELinux or the kernel log for apparmor=\"DENIED\"", pe.Capability)
+	}
+	return fmt.Sprintf("requires %s; run as root or grant it with `setcap %s+ep <binary>` "+
+		"or AmbientCapabilities=%s in a systemd unit", pe.Capability, strings.ToLower(pe.Capability.String()), pe.Capability)
+}
+
+// PermissionErr wraps err in a *PermissionError if the kernel refused op for
+// lack of privilege, and returns it unchanged otherwise.
+func PermissionErr(op string, c Capability, err error) error {
+	if !errors.Is(err, syscall.EPERM) && !errors.Is(err, syscall.EACCES) {
+		return err
+	}
+	has, _ := hasCapability(c)
+	return &PermissionError{
+		Op:            op,
+		Capability:    c,
+		HasCapability: has,
+		Err:           err,
+	}
+}
+
+// hasCapability returns whether c is in the effective capability set of the
+// process.
+func hasCapability(c Capability) (bool, error) {
+	f, err := os.Open("/proc/self/status")
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	eff, err := parseCapEff(f)
+	if err != nil {
+		return false, err
+	}
+	return eff&(1<<c) != 0, nil
+}
+
+// parseCapEff returns the effective capability set in a /proc/<pid>/status
+// file.
+func parseCapEff(r io.Reader) (uint64, error) {
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		if v := strings.TrimPrefix(s.Text(), "CapEff:"); v != s.Text() {
+			return strconv.ParseUint(strings.TrimSpace(v), 16, 64)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("no CapEff in status")
+}
+
+// BindErr wraps an error binding to port.
+func BindErr(port int, err error) error {
+	return PermissionErr(fmt.Sprintf("bind to UDP port %d", port), CapNetBindService, err)
+}
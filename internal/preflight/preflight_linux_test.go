@@ -0,0 +1,54 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package preflight
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestParseCapEff(t *testing.T) {
+	const status = "Name:\tdhcp4server\nCapInh:\t0000000000000000\nCapPrm:\t0000000000002400\nCapEff:\t0000000000002400\n"
+	eff, err := parseCapEff(strings.NewReader(status))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []Capability{CapNetBindService, CapNetRaw} {
+		if eff&(1<<c) == 0 {
+			t.Errorf("CapEff %#x does not have %v", eff, c)
+		}
+	}
+
+	if _, err := parseCapEff(strings.NewReader("Name:\tfoo\n")); err == nil {
+		t.Errorf("parseCapEff without CapEff = nil, want error")
+	}
+}
+
+func TestPermissionErr(t *testing.T) {
+	for _, tt := range []struct {
+		err      error
+		wantPerm bool
+	}{
+		{err: syscall.EPERM, wantPerm: true},
+		{err: fmt.Errorf("listen: %w", syscall.EACCES), wantPerm: true},
+		{err: syscall.EADDRINUSE},
+	} {
+		err := PermissionErr("bind", CapNetBindService, tt.err)
+		var pe *PermissionError
+		if got := errors.As(err, &pe); got != tt.wantPerm {
+			t.Errorf("PermissionErr(%v) = %v, want PermissionError %t", tt.err, err, tt.wantPerm)
+			continue
+		}
+		if !errors.Is(err, tt.err) {
+			t.Errorf("PermissionErr(%v) = %v, does not wrap original error", tt.err, err)
+		}
+		if pe != nil && !strings.Contains(err.Error(), "CAP_NET_BIND_SERVICE") {
+			t.Errorf("PermissionErr(%v) = %v, does not name the capability", tt.err, err)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux
+// +build !linux
+
+package preflight
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+)
+
+// BindErr wraps an error binding to port. Without Linux capabilities,
+// binding ports below 1024 requires root.
+func BindErr(port int, err error) error {
+	if !errors.Is(err, syscall.EPERM) && !errors.Is(err, syscall.EACCES) {
+		return err
+	}
+	return fmt.Errorf("bind to UDP port %d: %w (requires root)", port, err)
+}
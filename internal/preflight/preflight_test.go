@@ -0,0 +1,33 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package preflight
+
+import (
+	"errors"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	refused := func() (net.PacketConn, error) {
+		return nil, BindErr(67, syscall.EACCES)
+	}
+	var e *Error
+	if err := Check(0, refused, refused); !errors.As(err, &e) || len(e.Errors) != 2 {
+		t.Fatalf("Check(refused, refused) = %v, want 2 errors", err)
+	}
+	if !errors.Is(e.Errors[0], syscall.EACCES) {
+		t.Errorf("Check(refused) error %v does not wrap EACCES", e.Errors[0])
+	}
+
+	if os.Geteuid() != 0 {
+		t.Skip("needs root")
+	}
+	if err := Check(0); err != nil {
+		t.Errorf("Check(0) = %v", err)
+	}
+}
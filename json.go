@@ -0,0 +1,373 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// optionKeys are the keys of options in the JSON form of Options, named
+// after their typed accessors.
+var optionKeys = map[OptionCode]string{
+	OptionSubnetMask:                                 "subnet_mask",
+	OptionTimeOffset:                                 "time_offset",
+	OptionRouters:                                    "routers",
+	OptionTimeServers:                                "time_servers",
+	OptionNameServers:                                "name_servers",
+	OptionDomainNameServers:                          "domain_name_servers",
+	OptionLogServers:                                 "log_servers",
+	OptionCookieServers:                              "cookie_servers",
+	OptionLPRServers:                                 "lpr_servers",
+	OptionImpressServers:                             "impress_servers",
+	OptionResourceLocationServers:                    "resource_location_servers",
+	OptionHostName:                                   "host_name",
+	OptionBootFileSize:                               "boot_file_size",
+	OptionMeritDumpFile:                              "merit_dump_file",
+	OptionDomainName:                                 "domain_name",
+	OptionSwapServer:                                 "swap_server",
+	OptionRootPath:                                   "root_path",
+	OptionExtensionsPath:                             "extensions_path",
+	OptionIPForwardingEnableDisable:                  "ip_forwarding",
+	OptionNonLocalSourceRoutingEnableDisable:         "non_local_source_routing",
+	OptionPolicyFilter:                               "policy_filter",
+	OptionMaximumDatagramReassemblySize:              "maximum_datagram_reassembly_size",
+	OptionDefaultIPTimeToLive:                        "default_ip_time_to_live",
+	OptionPathMTUAgingTimeout:                        "path_mtu_aging_timeout",
+	OptionPathMTUPlateauTable:                        "path_mtu_plateau_table",
+	OptionInterfaceMTU:                               "interface_mtu",
+	OptionAllSubnetsAreLocal:                         "all_subnets_are_local",
+	OptionBroadcastAddress:                           "broadcast_address",
+	OptionPerformMaskDiscovery:                       "perform_mask_discovery",
+	OptionMaskSupplier:                               "mask_supplier",
+	OptionPerformRouterDiscovery:                     "perform_router_discovery",
+	OptionRouterSolicitationAddress:                  "router_solicitation_address",
+	OptionStaticRoute:                                "static_routes",
+	OptionTrailerEncapsulation:                       "trailer_encapsulation",
+	OptionARPCacheTimeout:                            "arp_cache_timeout",
+	OptionEthernetEncapsulation:                      "ethernet_encapsulation",
+	OptionTCPDefaultTTL:                              "tcp_default_ttl",
+	OptionTCPKeepaliveInterval:                       "tcp_keepalive_interval",
+	OptionTCPKeepaliveGarbage:                        "tcp_keepalive_garbage",
+	OptionNetworkInformationServiceDomain:            "nis_domain",
+	OptionNetworkInformationServers:                  "nis_servers",
+	OptionNetworkTimeProtocolServers:                 "ntp_servers",
+	OptionNetBIOSOverTCPIPNameServer:                 "netbios_name_servers",
+	OptionNetBIOSOverTCPIPDatagramDistributionServer: "netbios_datagram_distribution_servers",
+	OptionNetBIOSOverTCPIPNodeType:                   "netbios_node_type",
+	OptionNetBIOSOverTCPIPScope:                      "netbios_scope",
+	OptionXWindowSystemFontServer:                    "x_window_system_font_servers",
+	OptionXWindowSystemDisplayManager:                "x_window_system_display_managers",
+	OptionRequestedIPAddress:                         "requested_ip_address",
+	OptionIPAddressLeaseTime:                         "lease_time",
+	OptionOverload:                                   "overload",
+	OptionDHCPMessageType:                            "message_type",
+	OptionServerIdentifier:                           "server_identifier",
+	OptionParameterRequestList:                       "parameter_request_list",
+	OptionMessage:                                    "message",
+	OptionMaximumDHCPMessageSize:                     "maximum_dhcp_message_size",
+	OptionRenewalTimeValue:                           "renewal_time",
+	OptionRebindingTimeValue:                         "rebinding_time",
+	OptionVendorClassIdentifier:                      "vendor_class_identifier",
+	OptionTFTPServerName:                             "tftp_server_name",
+	OptionBootFileName:                               "boot_file_name",
+	OptionRapidCommit:                                "rapid_commit",
+	OptionClientFQDN:                                 "client_fqdn",
+	OptionDomainSearch:                               "domain_search",
+	OptionClasslessStaticRoute:                       "classless_static_routes",
+}
+
+// optionCodes maps the keys of optionKeys back to their codes.
+var optionCodes = func() map[string]OptionCode {
+	m := make(map[string]OptionCode, len(optionKeys))
+	for code, key := range optionKeys {
+		m[key] = code
+	}
+	return m
+}()
+
+// rawOptionKey is the prefix of the JSON keys of options without a
+// symbolic form, e.g. "option_43".
+const rawOptionKey = "option_"
+
+// messageTypeNames are the JSON forms of message types.
+var messageTypeNames = map[MessageType]string{
+	DHCPDiscover: "Discover",
+	DHCPOffer:    "Offer",
+	DHCPRequest:  "Request",
+	DHCPDecline:  "Decline",
+	DHCPACK:      "ACK",
+	DHCPNAK:      "NAK",
+	DHCPRelease:  "Release",
+	DHCPInform:   "Inform",
+
+	DHCPForceRenew:      "ForceRenew",
+	DHCPLeaseQuery:      "LeaseQuery",
+	DHCPLeaseUnassigned: "LeaseUnassigned",
+	DHCPLeaseUnknown:    "LeaseUnknown",
+	DHCPLeaseActive:     "LeaseActive",
+}
+
+// parseMessageType parses the JSON form of a message type. Names are
+// matched case-insensitively, with or without the "DHCP" prefix.
+func parseMessageType(s string) (MessageType, error) {
+	name := strings.TrimPrefix(strings.ToUpper(s), "DHCP")
+	for t, n := range messageTypeNames {
+		if strings.ToUpper(n) == name {
+			return t, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown message type %q", s)
+}
+
+// routeJSON is the JSON form of a Route.
+type routeJSON struct {
+	Destination string `json:"destination"`
+	Router      net.IP `json:"router"`
+}
+
+// MarshalJSON implements json.Marshaler. Options are keyed by name, such as
+// "routers" or "lease_time", with values in the JSON form of their
+// OptionValue: addresses as strings, times as numbers of seconds. The
+// message type is a name such as "Offer", and classless static routes are
+// objects with "destination" in CIDR notation and "router".
+//
+// Options without a symbolic form, and values of known options that are
+// malformed or not in canonical encoding, are keyed "option_<code>" with the
+// value in hex, so that any Options survive MarshalJSON and UnmarshalJSON
+// unchanged.
+func (o Options) MarshalJSON() ([]byte, error) {
+	m := make(map[string]json.RawMessage, len(o))
+	for code, b := range o {
+		key, v, ok := marshalOptionJSON(code, b)
+		if !ok {
+			key = rawOptionKey + strconv.Itoa(int(code))
+			v, _ = json.Marshal(hex.EncodeToString(b))
+		}
+		m[key] = v
+	}
+	return json.Marshal(m)
+}
+
+// marshalOptionJSON returns the key and JSON value of a known option, or
+// false if the option has no symbolic form, is malformed or would not
+// unmarshal to b.
+func marshalOptionJSON(code OptionCode, b []byte) (string, json.RawMessage, bool) {
+	key, ok := optionKeys[code]
+	if !ok {
+		return "", nil, false
+	}
+	var v interface{}
+	switch code {
+	case OptionDHCPMessageType:
+		if len(b) != 1 || messageTypeNames[MessageType(b[0])] == "" {
+			return "", nil, false
+		}
+		v = messageTypeNames[MessageType(b[0])]
+
+	case OptionClasslessStaticRoute:
+		routes, err := ParseClasslessRoutes(b)
+		if err != nil {
+			return "", nil, false
+		}
+		rs := make([]routeJSON, 0, len(routes))
+		for _, r := range routes {
+			rs = append(rs, routeJSON{Destination: r.Dest.String(), Router: r.Router})
+		}
+		v = rs
+
+	default:
+		ov := NewOptionValue(code)
+		if ov == nil || ov.UnmarshalBinary(b) != nil {
+			return "", nil, false
+		}
+		v = ov
+	}
+	js, err := json.Marshal(v)
+	if err != nil {
+		return "", nil, false
+	}
+	// Values that do not survive the round trip, e.g. compressed domain
+	// lists or policy filters with host bits set, are left raw.
+	if _, back, err := unmarshalOptionJSON(key, js); err != nil || !bytes.Equal(back, b) {
+		return "", nil, false
+	}
+	return key, js, true
+}
+
+// UnmarshalJSON implements json.Unmarshaler for the form of MarshalJSON.
+func (o *Options) UnmarshalJSON(b []byte) error {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(b, &m); err != nil {
+		return err
+	}
+	opts := make(Options, len(m))
+	for key, v := range m {
+		code, value, err := unmarshalOptionJSON(key, v)
+		if err != nil {
+			return fmt.Errorf("option %q: %v", key, err)
+		}
+		opts[code] = value
+	}
+	*o = opts
+	return nil
+}
+
+// unmarshalOptionJSON decodes the option with JSON key and value v.
+func unmarshalOptionJSON(key string, v json.RawMessage) (OptionCode, []byte, error) {
+	if strings.HasPrefix(key, rawOptionKey) {
+		code, err := strconv.ParseUint(strings.TrimPrefix(key, rawOptionKey), 10, 8)
+		if err != nil || code == uint64(Pad) || code == uint64(End) {
+			return 0, nil, fmt.Errorf("invalid option code")
+		}
+		var s string
+		if err := json.Unmarshal(v, &s); err != nil {
+			return 0, nil, err
+		}
+		b, err := hex.DecodeString(s)
+		return OptionCode(code), b, err
+	}
+
+	code, ok := optionCodes[key]
+	if !ok {
+		return 0, nil, fmt.Errorf("unknown option")
+	}
+	switch code {
+	case OptionDHCPMessageType:
+		var s string
+		if err := json.Unmarshal(v, &s); err != nil {
+			return 0, nil, err
+		}
+		t, err := parseMessageType(s)
+		if err != nil {
+			return 0, nil, err
+		}
+		return code, []byte{byte(t)}, nil
+
+	case OptionClasslessStaticRoute:
+		var rs []routeJSON
+		if err := json.Unmarshal(v, &rs); err != nil {
+			return 0, nil, err
+		}
+		routes := make([]Route, 0, len(rs))
+		for _, r := range rs {
+			_, dest, err := net.ParseCIDR(r.Destination)
+			if err != nil {
+				return 0, nil, err
+			}
+			routes = append(routes, Route{Dest: dest, Router: r.Router})
+		}
+		return code, MarshalClasslessRoutes(routes), nil
+	}
+
+	ov := NewOptionValue(code)
+	if err := json.Unmarshal(v, ov); err != nil {
+		return 0, nil, err
+	}
+	b, err := ov.MarshalBinary()
+	return code, b, err
+}
+
+// packetJSON is the JSON form of a Packet.
+type packetJSON struct {
+	Op         string  `json:"op"`
+	HType      uint8   `json:"htype"`
+	Hops       uint8   `json:"hops,omitempty"`
+	XID        string  `json:"xid"`
+	Secs       uint16  `json:"secs,omitempty"`
+	Broadcast  bool    `json:"broadcast,omitempty"`
+	CIAddr     IP      `json:"ciaddr,omitempty"`
+	YIAddr     IP      `json:"yiaddr,omitempty"`
+	SIAddr     IP      `json:"siaddr,omitempty"`
+	GIAddr     IP      `json:"giaddr,omitempty"`
+	CHAddr     string  `json:"chaddr,omitempty"`
+	ServerName string  `json:"sname,omitempty"`
+	BootFile   string  `json:"file,omitempty"`
+	Options    Options `json:"options,omitempty"`
+	VendorArea string  `json:"vend,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler. Fields are keyed by their RFC 2131
+// names, the op code is "BOOTREQUEST" or "BOOTREPLY", the transaction ID is
+// in hex, and options are in the form of Options.MarshalJSON, e.g.
+//
+//	{"op":"BOOTREPLY","htype":1,"xid":"12345678","yiaddr":"10.0.0.5",
+//	 "chaddr":"02:00:00:00:00:01","options":{"message_type":"Offer",
+//	 "routers":["10.0.0.1"],"lease_time":3600}}
+//
+// Unset fields are left out.
+func (p *Packet) MarshalJSON() ([]byte, error) {
+	return json.Marshal(packetJSON{
+		Op:         p.Op.String(),
+		HType:      p.HType,
+		Hops:       p.Hops,
+		XID:        hex.EncodeToString(p.TransactionID[:]),
+		Secs:       p.Secs,
+		Broadcast:  p.Broadcast,
+		CIAddr:     IP(p.CIAddr),
+		YIAddr:     IP(p.YIAddr),
+		SIAddr:     IP(p.SIAddr),
+		GIAddr:     IP(p.GIAddr),
+		CHAddr:     p.HardwareAddr().String(),
+		ServerName: p.ServerName,
+		BootFile:   p.BootFile,
+		Options:    p.Options,
+		VendorArea: hex.EncodeToString(p.VendorArea),
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler for the form of MarshalJSON.
+func (p *Packet) UnmarshalJSON(b []byte) error {
+	var pj packetJSON
+	if err := json.Unmarshal(b, &pj); err != nil {
+		return err
+	}
+	q := Packet{
+		HType:      pj.HType,
+		Hops:       pj.Hops,
+		Secs:       pj.Secs,
+		Broadcast:  pj.Broadcast,
+		CIAddr:     net.IP(pj.CIAddr),
+		YIAddr:     net.IP(pj.YIAddr),
+		SIAddr:     net.IP(pj.SIAddr),
+		GIAddr:     net.IP(pj.GIAddr),
+		ServerName: pj.ServerName,
+		BootFile:   pj.BootFile,
+		Options:    pj.Options,
+	}
+	switch strings.ToUpper(pj.Op) {
+	case BootRequest.String():
+		q.Op = BootRequest
+	case BootReply.String():
+		q.Op = BootReply
+	default:
+		return fmt.Errorf("invalid op %q", pj.Op)
+	}
+	xid, err := hex.DecodeString(pj.XID)
+	if err != nil || len(xid) != len(q.TransactionID) {
+		return fmt.Errorf("invalid xid %q", pj.XID)
+	}
+	copy(q.TransactionID[:], xid)
+	if pj.VendorArea != "" {
+		if q.VendorArea, err = hex.DecodeString(pj.VendorArea); err != nil {
+			return fmt.Errorf("invalid vend %q", pj.VendorArea)
+		}
+	}
+	if pj.CHAddr != "" {
+		if q.CHAddr, err = ParseHardwareAddr(pj.CHAddr); err != nil {
+			return err
+		}
+	}
+	if q.Options == nil {
+		q.Options = make(Options)
+	}
+	*p = q
+	return nil
+}
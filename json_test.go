@@ -0,0 +1,143 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4
+
+import (
+	"encoding/json"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestOptionsJSON(t *testing.T) {
+	for _, tt := range []struct {
+		desc string
+		opts Options
+		json string
+	}{
+		{
+			desc: "message type",
+			opts: Options{OptionDHCPMessageType: {2}},
+			json: `{"message_type":"Offer"}`,
+		},
+		{
+			desc: "addresses and times",
+			opts: Options{
+				OptionRouters:            {10, 0, 0, 1},
+				OptionSubnetMask:         {255, 255, 255, 0},
+				OptionIPAddressLeaseTime: {0, 0, 0x0e, 0x10},
+			},
+			json: `{"lease_time":3600,"routers":["10.0.0.1"],"subnet_mask":"255.255.255.0"}`,
+		},
+		{
+			desc: "classless static routes",
+			opts: Options{OptionClasslessStaticRoute: {24, 10, 0, 1, 10, 0, 0, 1}},
+			json: `{"classless_static_routes":[{"destination":"10.0.1.0/24","router":"10.0.0.1"}]}`,
+		},
+		{
+			desc: "unknown option",
+			opts: Options{200: {0xde, 0xad}},
+			json: `{"option_200":"dead"}`,
+		},
+		{
+			desc: "opaque option",
+			opts: Options{OptionClientIdentifier: {1, 2, 0, 0, 0, 0, 1}},
+			json: `{"option_61":"01020000000001"}`,
+		},
+		{
+			desc: "malformed value",
+			opts: Options{OptionSubnetMask: {255, 255}},
+			json: `{"option_1":"ffff"}`,
+		},
+		{
+			desc: "non-canonical value",
+			opts: Options{OptionPolicyFilter: {10, 0, 0, 5, 255, 255, 255, 0}},
+			json: `{"option_21":"0a000005ffffff00"}`,
+		},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			b, err := json.Marshal(tt.opts)
+			if err != nil {
+				t.Fatalf("Marshal = %v", err)
+			}
+			if string(b) != tt.json {
+				t.Errorf("Marshal = %s, want %s", b, tt.json)
+			}
+			var got Options
+			if err := json.Unmarshal(b, &got); err != nil {
+				t.Fatalf("Unmarshal = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.opts) {
+				t.Errorf("Unmarshal = %v, want %v", got, tt.opts)
+			}
+		})
+	}
+}
+
+func TestOptionsUnmarshalJSON(t *testing.T) {
+	for _, tt := range []struct {
+		json string
+		want Options
+		err  bool
+	}{
+		{json: `{"message_type":"DHCPACK"}`, want: Options{OptionDHCPMessageType: {5}}},
+		{json: `{"message_type":"nak"}`, want: Options{OptionDHCPMessageType: {6}}},
+		{json: `{"message_type":"Bogus"}`, err: true},
+		{json: `{"bogus":1}`, err: true},
+		{json: `{"option_0":""}`, err: true},
+		{json: `{"option_300":""}`, err: true},
+		{json: `{"option_200":"xyz"}`, err: true},
+		{json: `{"routers":"10.0.0.1"}`, err: true},
+	} {
+		var got Options
+		err := json.Unmarshal([]byte(tt.json), &got)
+		if (err != nil) != tt.err {
+			t.Errorf("Unmarshal(%s) = %v, want error %v", tt.json, err, tt.err)
+		}
+		if err == nil && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Unmarshal(%s) = %v, want %v", tt.json, got, tt.want)
+		}
+	}
+}
+
+func TestPacketJSON(t *testing.T) {
+	p := NewPacket(BootReply)
+	p.TransactionID = [4]byte{0x12, 0x34, 0x56, 0x78}
+	p.CHAddr = net.HardwareAddr{2, 0, 0, 0, 0, 1}
+	p.YIAddr = net.IP{10, 0, 0, 5}
+	p.BootFile = "pxelinux.0"
+	p.Options.SetMessageType(DHCPOffer)
+	p.Options.SetRouters([]net.IP{{10, 0, 0, 1}})
+	p.Options.SetLeaseTime(time.Hour)
+
+	b, err := json.Marshal(p)
+	if err != nil {
+		t.Fatalf("Marshal = %v", err)
+	}
+	want := `{"op":"BOOTREPLY","htype":1,"xid":"12345678","yiaddr":"10.0.0.5","chaddr":"02:00:00:00:00:01",` +
+		`"file":"pxelinux.0","options":{"lease_time":3600,"message_type":"Offer","routers":["10.0.0.1"]}}`
+	if string(b) != want {
+		t.Errorf("Marshal = %s, want %s", b, want)
+	}
+
+	got := &Packet{}
+	if err := json.Unmarshal(b, got); err != nil {
+		t.Fatalf("Unmarshal = %v", err)
+	}
+	if !reflect.DeepEqual(got, p) {
+		t.Errorf("Unmarshal = %#v, want %#v", got, p)
+	}
+
+	for _, bad := range []string{
+		`{"op":"BOOTSTRAP","xid":"12345678"}`,
+		`{"op":"BOOTREQUEST","xid":"1234"}`,
+		`{"op":"BOOTREQUEST","xid":"12345678","chaddr":"zz"}`,
+	} {
+		if err := json.Unmarshal([]byte(bad), &Packet{}); err == nil {
+			t.Errorf("Unmarshal(%s) = nil, want error", bad)
+		}
+	}
+}
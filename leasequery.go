@@ -0,0 +1,41 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4
+
+import (
+	"net"
+	"time"
+)
+
+// ClientLastTransactionTime returns how long ago the server last heard from
+// the client of a lease, as reported in replies to DHCPLEASEQUERY.
+//
+// It returns 0 if the option is not present or malformed. The option is
+// defined by RFC 4388, Section 6.1.
+func (o Options) ClientLastTransactionTime() time.Duration {
+	return time.Duration(o.getUint32(OptionClientLastTransactionTime)) * time.Second
+}
+
+// SetClientLastTransactionTime sets how long ago the server last heard from
+// the client of a lease.
+func (o Options) SetClientLastTransactionTime(v time.Duration) {
+	o.setUint32(OptionClientLastTransactionTime, uint32(v/time.Second))
+}
+
+// AssociatedIPs returns all addresses bound to the client of a lease, as
+// reported in replies to DHCPLEASEQUERY for clients with several bindings.
+//
+// It returns nil if the option is not present or malformed. The option is
+// defined by RFC 4388, Section 6.1.
+func (o Options) AssociatedIPs() []net.IP {
+	return o.getIPs(OptionAssociatedIP)
+}
+
+// SetAssociatedIPs sets all addresses bound to the client of a lease.
+//
+// An empty value removes the option.
+func (o Options) SetAssociatedIPs(v []net.IP) {
+	o.setIPs(OptionAssociatedIP, v)
+}
@@ -0,0 +1,270 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+)
+
+// LintFinding is a problem found by Lint.
+type LintFinding struct {
+	// Option is the option the finding is about, or Pad if it is about
+	// the packet as a whole.
+	Option OptionCode
+
+	// Message describes the problem.
+	Message string
+}
+
+// String implements fmt.Stringer.
+func (f LintFinding) String() string {
+	if f.Option == Pad {
+		return f.Message
+	}
+	return fmt.Sprintf("option %d: %s", f.Option, f.Message)
+}
+
+// deprecatedOptions are options that are obsolete, and what to use instead.
+var deprecatedOptions = map[OptionCode]string{
+	OptionTimeServers:          "RFC 868 time servers are obsolete; use option 42 (NTP servers)",
+	OptionNameServers:          "IEN 116 name servers are obsolete; use option 6 (domain name servers)",
+	OptionStaticRoute:          "classful static routes are obsolete; use option 121 (RFC 3442)",
+	OptionTrailerEncapsulation: "trailer encapsulation is obsolete",
+}
+
+// optionLengths are the valid lengths of fixed-size options. A negative
+// length -n means a non-empty multiple of n.
+var optionLengths = map[OptionCode]int{
+	OptionSubnetMask:                 -4,
+	OptionRouters:                    -4,
+	OptionDomainNameServers:          -4,
+	OptionBroadcastAddress:           4,
+	OptionRouterSolicitationAddress:  4,
+	OptionRequestedIPAddress:         4,
+	OptionIPAddressLeaseTime:         4,
+	OptionOverload:                   1,
+	OptionDHCPMessageType:            1,
+	OptionServerIdentifier:           4,
+	OptionMaximumDHCPMessageSize:     2,
+	OptionRenewalTimeValue:           4,
+	OptionRebindingTimeValue:         4,
+	OptionNetworkTimeProtocolServers: -4,
+
+	// RFC 4578.
+	OptionClientSystemArchitecture:         -2,
+	OptionClientNetworkInterfaceIdentifier: 3,
+	OptionClientMachineIdentifier:          17,
+}
+
+// Lint reports constructions in p that are valid enough to be sent and
+// parsed, but are likely mistakes: malformed fixed-size options, deprecated
+// options, conflicting options, the rules of ValidateMessage for p's message
+// type, and requests without a parameter request list.
+//
+// Lint returns no findings for a good packet.
+func Lint(p *Packet) []LintFinding {
+	var fs []LintFinding
+	add := func(code OptionCode, format string, args ...interface{}) {
+		fs = append(fs, LintFinding{Option: code, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if p.missingEnd {
+		add(Pad, "options not terminated by End option")
+	}
+	if p.truncated {
+		add(Pad, "last option truncated")
+	}
+
+	// Option lengths, in option order.
+	for _, k := range p.Options.sortedKeys() {
+		code := OptionCode(k)
+		want, ok := optionLengths[code]
+		if !ok {
+			continue
+		}
+		n := len(p.Options[code])
+		if want > 0 && n != want {
+			add(code, "length %d, want %d", n, want)
+		} else if want < 0 && (n == 0 || n%-want != 0) {
+			add(code, "length %d, want a non-zero multiple of %d", n, -want)
+		}
+	}
+	if v, ok := p.Options[OptionClasslessStaticRoute]; ok {
+		if _, err := ParseClasslessRoutes(v); err != nil {
+			add(OptionClasslessStaticRoute, "%v", err)
+		}
+	}
+	if v, ok := p.Options[OptionDomainSearch]; ok {
+		if _, err := ParseDomainSearch(v); err != nil {
+			add(OptionDomainSearch, "%v", err)
+		}
+	}
+	if v, ok := p.Options[OptionClientFQDN]; ok {
+		if err := new(ClientFQDN).UnmarshalBinary(v); err != nil {
+			add(OptionClientFQDN, "%v", err)
+		}
+	}
+	if v, ok := p.Options[OptionRelayAgentInformation]; ok {
+		if _, err := ParseRelayAgentInfo(v); err != nil {
+			add(OptionRelayAgentInformation, "%v", err)
+		}
+	}
+	if v, ok := p.Options[OptionVIVendorClass]; ok {
+		if _, err := ParseVIVendorClass(v); err != nil {
+			add(OptionVIVendorClass, "%v", err)
+		}
+	}
+	if v, ok := p.Options[OptionVIVendorSpecificInformation]; ok {
+		if _, err := ParseVIVendorInfo(v); err != nil {
+			add(OptionVIVendorSpecificInformation, "%v", err)
+		}
+	}
+	if v, ok := p.Options[OptionAuthentication]; ok {
+		if _, err := ParseAuthentication(v); err != nil {
+			add(OptionAuthentication, "%v", err)
+		}
+	}
+	if v, ok := p.Options[OptionRapidCommit]; ok && len(v) != 0 {
+		add(OptionRapidCommit, "length %d, want 0", len(v))
+	}
+	if v := p.Options[OptionMaximumDHCPMessageSize]; len(v) == 2 && binary.BigEndian.Uint16(v) < 576 {
+		add(OptionMaximumDHCPMessageSize, "maximum message size %d is below the minimum of 576", binary.BigEndian.Uint16(v))
+	}
+
+	// Deprecated and conflicting options.
+	_, classless := p.Options[OptionClasslessStaticRoute]
+	for _, k := range p.Options.sortedKeys() {
+		code := OptionCode(k)
+		if code == OptionStaticRoute && classless {
+			add(code, "ignored by clients because option 121 is present (RFC 3442)")
+		} else if msg, ok := deprecatedOptions[code]; ok {
+			add(code, "deprecated: %s", msg)
+		}
+	}
+	if _, routers := p.Options[OptionRouters]; routers && classless {
+		add(OptionRouters, "ignored by clients because option 121 is present; include a default route in option 121 instead (RFC 3442)")
+	}
+
+	lease := optionUint32(p.Options, OptionIPAddressLeaseTime)
+	t1 := optionUint32(p.Options, OptionRenewalTimeValue)
+	t2 := optionUint32(p.Options, OptionRebindingTimeValue)
+	if t1 != nil && t2 != nil && *t1 >= *t2 {
+		add(OptionRenewalTimeValue, "renewal time %ds is not before rebinding time %ds", *t1, *t2)
+	}
+	if t2 != nil && lease != nil && *t2 >= *lease && *lease != 0xffffffff {
+		add(OptionRebindingTimeValue, "rebinding time %ds is not before lease time %ds", *t2, *lease)
+	}
+
+	typ, ok := p.Options[OptionDHCPMessageType]
+	if !ok || len(typ) != 1 {
+		// BOOTP, or already reported.
+		return fs
+	}
+	lintMessageType(p, MessageType(typ[0]), add)
+	return fs
+}
+
+// lintMessageType checks the fields and options the message type requires
+// or forbids. The message types of RFC 2131 are checked by ValidateMessage,
+// for the role that sends them; lintMessageType adds the advisory checks and
+// those of the message types of later RFCs.
+func lintMessageType(p *Packet, typ MessageType, add func(OptionCode, string, ...interface{})) {
+	has := func(code OptionCode) bool {
+		_, ok := p.Options[code]
+		return ok
+	}
+	require := func(code OptionCode, what string) {
+		if !has(code) {
+			add(code, "missing %s, required in %s", what, typ)
+		}
+	}
+
+	switch typ {
+	case DHCPDiscover, DHCPRequest, DHCPDecline, DHCPRelease, DHCPInform:
+		lintValidation(p.ValidateMessage(RoleClient), add)
+	case DHCPOffer, DHCPACK, DHCPNAK:
+		lintValidation(p.ValidateMessage(RoleServer), add)
+	case DHCPLeaseQuery:
+		if p.Op != BootRequest {
+			add(OptionDHCPMessageType, "%s sent with op %d, want BootRequest", typ, p.Op)
+		}
+	case DHCPForceRenew, DHCPLeaseUnassigned, DHCPLeaseUnknown, DHCPLeaseActive:
+		if p.Op != BootReply {
+			add(OptionDHCPMessageType, "%s sent with op %d, want BootReply", typ, p.Op)
+		}
+	default:
+		add(OptionDHCPMessageType, "unknown message type %d", uint8(typ))
+		return
+	}
+
+	if typ != DHCPDiscover && typ != DHCPACK && has(OptionRapidCommit) {
+		add(OptionRapidCommit, "rapid commit (RFC 4039, Section 3) must not be sent in %s", typ)
+	}
+
+	switch typ {
+	case DHCPDiscover, DHCPRequest:
+		if !has(OptionParameterRequestList) {
+			add(OptionParameterRequestList, "no parameter request list; servers will only send default options")
+		}
+
+	case DHCPLeaseQuery:
+		// RFC 4388, Section 6.1.
+		var criteria int
+		if !isZeroIP(p.CIAddr) {
+			criteria++
+		}
+		if len(p.CHAddr) > 0 {
+			criteria++
+		}
+		if has(OptionClientIdentifier) {
+			criteria++
+		}
+		if criteria != 1 {
+			add(Pad, "DHCPLEASEQUERY by %d of ciaddr, chaddr and client identifier, want exactly one", criteria)
+		}
+
+	case DHCPLeaseActive:
+		require(OptionIPAddressLeaseTime, "lease time")
+
+	case DHCPForceRenew:
+		require(OptionServerIdentifier, "server identifier")
+		require(OptionAuthentication, "authentication (RFC 3203, Section 6)")
+	}
+}
+
+// lintValidation adds a finding for every rule in err, the error of
+// ValidateMessage. Rules about the op field are reported against the
+// message type, those about other fields against the packet as a whole.
+func lintValidation(err error, add func(OptionCode, string, ...interface{})) {
+	errs, _ := err.(ValidationErrors)
+	for _, e := range errs {
+		code := e.Option
+		switch e.Field {
+		case "":
+		case "op":
+			code = OptionDHCPMessageType
+		default:
+			code = Pad
+		}
+		add(code, "%v", e)
+	}
+}
+
+// optionUint32 returns the value of a 32-bit option, or nil if it is not
+// present or malformed.
+func optionUint32(o Options, code OptionCode) *uint32 {
+	v := o[code]
+	if len(v) != 4 {
+		return nil
+	}
+	n := binary.BigEndian.Uint32(v)
+	return &n
+}
+
+func isZeroIP(ip net.IP) bool {
+	return ip == nil || ip.Equal(net.IPv4zero)
+}
@@ -0,0 +1,160 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+// lintPacket returns a packet of message type typ with the given options.
+func lintPacket(op OpCode, typ MessageType, opts Options) *Packet {
+	p := NewPacket(op)
+	p.SetHardwareAddr(net.HardwareAddr{2, 0, 0, 0, 0, 1})
+	p.Options.SetMessageType(typ)
+	for k, v := range opts {
+		p.Options[k] = v
+	}
+	return p
+}
+
+func TestLint(t *testing.T) {
+	sid := []byte{192, 168, 0, 1}
+	prl := []byte{1, 3, 6}
+	lease := []byte{0, 0, 0x0e, 0x10}
+
+	offer := lintPacket(BootReply, DHCPOffer, Options{
+		OptionServerIdentifier:   sid,
+		OptionIPAddressLeaseTime: lease,
+	})
+	offer.YIAddr = net.IP{192, 168, 1, 10}
+
+	for i, tt := range []struct {
+		p    *Packet
+		want []OptionCode
+	}{
+		{
+			p: lintPacket(BootRequest, DHCPDiscover, Options{OptionParameterRequestList: prl}),
+		},
+		{
+			p: offer,
+		},
+		{
+			// BOOTP.
+			p: NewPacket(BootRequest),
+		},
+		{
+			p:    &Packet{Op: BootRequest, CHAddr: []byte{2, 0, 0, 0, 0, 1}, Options: Options{OptionDHCPMessageType: {byte(DHCPDiscover)}, OptionParameterRequestList: prl}, missingEnd: true},
+			want: []OptionCode{Pad},
+		},
+		{
+			p:    lintPacket(BootRequest, DHCPDiscover, Options{OptionParameterRequestList: prl, OptionServerIdentifier: sid}),
+			want: []OptionCode{OptionServerIdentifier},
+		},
+		{
+			p:    lintPacket(BootRequest, DHCPDiscover, nil),
+			want: []OptionCode{OptionParameterRequestList},
+		},
+		{
+			p:    lintPacket(BootReply, DHCPDiscover, Options{OptionParameterRequestList: prl}),
+			want: []OptionCode{OptionDHCPMessageType},
+		},
+		{
+			p:    lintPacket(BootRequest, DHCPRequest, Options{OptionParameterRequestList: prl}),
+			want: []OptionCode{Pad},
+		},
+		{
+			p:    lintPacket(BootReply, DHCPOffer, nil),
+			want: []OptionCode{Pad, OptionServerIdentifier, OptionIPAddressLeaseTime},
+		},
+		{
+			p:    lintPacket(BootReply, DHCPNAK, Options{OptionServerIdentifier: sid, OptionIPAddressLeaseTime: lease}),
+			want: []OptionCode{OptionIPAddressLeaseTime},
+		},
+		{
+			// Rules only ValidateMessage had: DHCPINFORM without
+			// ciaddr, DHCPNAK with ciaddr.
+			p:    lintPacket(BootRequest, DHCPInform, Options{OptionParameterRequestList: prl}),
+			want: []OptionCode{Pad},
+		},
+		{
+			p: func() *Packet {
+				p := lintPacket(BootReply, DHCPNAK, Options{OptionServerIdentifier: sid})
+				p.CIAddr = net.IP{192, 168, 1, 10}
+				return p
+			}(),
+			want: []OptionCode{Pad},
+		},
+		{
+			p:    lintPacket(BootRequest, 42, nil),
+			want: []OptionCode{OptionDHCPMessageType},
+		},
+		{
+			p: lintPacket(BootRequest, DHCPDiscover, Options{
+				OptionParameterRequestList:   prl,
+				OptionServerIdentifier:       {192, 168, 0},
+				OptionMaximumDHCPMessageSize: {0x01, 0x00},
+			}),
+			want: []OptionCode{OptionServerIdentifier, OptionMaximumDHCPMessageSize, OptionServerIdentifier},
+		},
+		{
+			// Deprecated and conflicting options.
+			p: lintPacket(BootRequest, DHCPDiscover, Options{
+				OptionParameterRequestList: prl,
+				OptionRouters:              sid,
+				OptionTimeServers:          sid,
+				OptionStaticRoute:          {10, 0, 0, 0, 192, 168, 0, 1},
+				OptionClasslessStaticRoute: {0, 192, 168, 0, 1},
+			}),
+			want: []OptionCode{OptionTimeServers, OptionStaticRoute, OptionRouters},
+		},
+		{
+			p: lintPacket(BootRequest, DHCPDiscover, Options{
+				OptionParameterRequestList: prl,
+				OptionClasslessStaticRoute: {24, 10, 17, 0, 192, 168},
+			}),
+			want: []OptionCode{OptionClasslessStaticRoute},
+		},
+		{
+			p: lintPacket(BootRequest, DHCPDiscover, Options{
+				OptionParameterRequestList: prl,
+				OptionDomainSearch:         []byte("\x07example\xc0\x00"),
+			}),
+			want: []OptionCode{OptionDomainSearch},
+		},
+		{
+			p: lintPacket(BootRequest, DHCPDiscover, Options{
+				OptionParameterRequestList:  prl,
+				OptionRelayAgentInformation: {RelayLinkSelection, 2, 10, 0},
+			}),
+			want: []OptionCode{OptionRelayAgentInformation},
+		},
+		{
+			p: lintPacket(BootRequest, DHCPDiscover, Options{
+				OptionParameterRequestList:        prl,
+				OptionVIVendorSpecificInformation: {0, 0, 0, 9, 3, 1, 2, 7},
+			}),
+			want: []OptionCode{OptionVIVendorSpecificInformation},
+		},
+		{
+			p: lintPacket(BootRequest, DHCPDiscover, Options{
+				OptionParameterRequestList: prl,
+				OptionIPAddressLeaseTime:   {0, 0, 0, 100},
+				OptionRenewalTimeValue:     {0, 0, 0, 90},
+				OptionRebindingTimeValue:   {0, 0, 0, 80},
+			}),
+			want: []OptionCode{OptionRenewalTimeValue},
+		},
+	} {
+		var got []OptionCode
+		for _, f := range Lint(tt.p) {
+			got = append(got, f.Option)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("#%d: Lint() = %v, want findings for options %v", i, Lint(tt.p), tt.want)
+		}
+	}
+}
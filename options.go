@@ -5,6 +5,7 @@
 package dhcp4
 
 import (
+	"bytes"
 	"encoding"
 	"io"
 	"math"
@@ -67,107 +68,347 @@ func (o Options) Get(key OptionCode) []byte {
 // It is used with various different types to enable parsing of both top-level
 // options. If options data is malformed, it returns ErrInvalidOptions or
 // io.ErrUnexpectedEOF.
+//
+// If the data ends without an End option, all options read so far are kept
+// and io.ErrUnexpectedEOF is returned, as it always has been. Packets are
+// parsed leniently instead, see Packet.Validate.
 func (o *Options) Unmarshal(buf *uio.Lexer) error {
-	*o = make(Options)
+	if err := o.unmarshal(buf, false); err != ErrMissingEnd {
+		return err
+	}
+	return io.ErrUnexpectedEOF
+}
 
-	var end bool
-	for buf.Has(1) {
+// unmarshal implements Unmarshal. If lenient, see decodeOptions.
+func (o *Options) unmarshal(buf *uio.Lexer, lenient bool) error {
+	// Size the map and a single buffer backing all option data up front:
+	// a packet's options are then decoded with two allocations, rather
+	// than one per option.
+	data := buf.Data()
+	count, size := scanOptions(data)
+	*o = make(Options, count)
+	_, err := decodeOptions(*o, data, lenient, make([]byte, 0, size))
+	buf.Consume(len(data))
+	return err
+}
+
+// decodeOptions adds the options in b to o. The data of each option is
+// appended to backing, which is returned; if backing has room for the
+// size scanOptions returns, decoding does not allocate.
+//
+// If lenient, an option cut short by the end of b is kept with the data
+// there is and ErrTruncatedOption is returned, and bytes after the End
+// option are ignored.
+func decodeOptions(o Options, b []byte, lenient bool, backing []byte) ([]byte, error) {
+	for len(b) > 0 {
 		// 1 byte: option code
 		// 1 byte: option length n
 		// n bytes: data
-		code := OptionCode(buf.Read8())
+		code := OptionCode(b[0])
+		b = b[1:]
 
 		if code == Pad {
 			continue
 		} else if code == End {
-			end = true
-			break
+			if lenient {
+				return backing, nil
+			}
+			// Any bytes left must be padding.
+			for _, c := range b {
+				if OptionCode(c) != Pad {
+					return backing, ErrInvalidOptions
+				}
+			}
+			return backing, nil
 		}
-		if !buf.Has(1) {
-			return io.ErrUnexpectedEOF
+		if len(b) == 0 {
+			if lenient {
+				// Only the code is left; keep it without data.
+				if _, ok := o[code]; !ok {
+					o[code] = []byte{}
+				}
+				return backing, ErrTruncatedOption
+			}
+			return backing, io.ErrUnexpectedEOF
 		}
 
-		length := int(buf.Read8())
+		length := int(b[0])
+		b = b[1:]
 		if length == 0 {
+			// Options without data, such as OptionRapidCommit,
+			// are kept: their presence is their value.
+			if _, ok := o[code]; !ok {
+				o[code] = []byte{}
+			}
 			continue
 		}
-
-		if !buf.Has(length) {
-			return io.ErrUnexpectedEOF
-		}
-
-		// N bytes: option data
-		data := buf.Consume(length)
-		if data == nil {
-			return io.ErrUnexpectedEOF
+		if len(b) < length {
+			if lenient {
+				o.AddRaw(code, b)
+				return backing, ErrTruncatedOption
+			}
+			return backing, io.ErrUnexpectedEOF
 		}
-		data = data[:length:length]
+		data := b[:length]
+		b = b[length:]
 
 		// RFC 3396: Just concatenate the data if the option code was
 		// specified multiple times.
-		o.AddRaw(code, data)
-	}
-
-	if !end {
-		return io.ErrUnexpectedEOF
+		if _, ok := o[code]; ok {
+			o.AddRaw(code, data)
+			continue
+		}
+		start := len(backing)
+		backing = append(backing, data...)
+		o[code] = backing[start:len(backing):len(backing)]
 	}
+	return backing, ErrMissingEnd
+}
 
-	// Any bytes left must be padding.
-	for buf.Has(1) {
-		if OptionCode(buf.Read8()) != Pad {
-			return ErrInvalidOptions
+// scanOptions returns the number of options in b and their total data
+// length, counting options given several times once per instance.
+func scanOptions(b []byte) (count, size int) {
+	for len(b) > 0 {
+		switch OptionCode(b[0]) {
+		case Pad:
+			b = b[1:]
+			continue
+		case End:
+			return count, size
 		}
+		if len(b) < 2 {
+			break
+		}
+		n := int(b[1])
+		if len(b) < 2+n {
+			break
+		}
+		count++
+		size += n
+		b = b[2+n:]
 	}
-	return nil
+	return count, size
 }
 
-// Marshal writes options into the provided Buffer sorted by option codes.
+// Marshal writes options into the provided Buffer sorted by option codes,
+// except for OptionRelayAgentInformation, which is written last as RFC 3046
+// asks of relay agents and servers.
+//
+// Exactly one End option is always written last. Pad and End entries in the
+// map are ignored.
+//
+// Options does not record the order of the options it was unmarshaled from;
+// Packet.MarshalBinary writes the options of an unmarshaled packet as they
+// were read.
 func (o Options) Marshal(b *uio.Lexer) {
-	for _, c := range o.sortedKeys() {
+	o.marshal(b)
+	b.Write8(uint8(End))
+}
+
+// marshal writes options in the order of Marshal, without an End option.
+func (o Options) marshal(b *uio.Lexer) {
+	b.WriteBytes(o.appendTo(nil))
+}
+
+// appendTo appends options in the order of Marshal, without an End option,
+// to b.
+func (o Options) appendTo(b []byte) []byte {
+	return o.appendOrdered(b, nil)
+}
+
+// appendOrdered appends options without an End option to b: first those
+// whose codes are listed in order, in that order, then the others in the
+// order of Marshal.
+func (o Options) appendOrdered(b []byte, order []byte) []byte {
+	var keys [32]int
+	for _, c := range o.appendKeys(keys[:0], order) {
 		code := OptionCode(c)
+		if code == End || code == Pad {
+			continue
+		}
 		data := o[code]
+		if len(data) == 0 {
+			b = append(b, uint8(code), 0)
+			continue
+		}
 
 		// RFC 3396: If more than 256 bytes of data are given, the
 		// option is simply listed multiple times.
 		for len(data) > 0 {
-			// 1 byte: option code
-			b.Write8(uint8(code))
-
-			// Some DHCPv4 options have fixed length and do not put
-			// length on the wire.
-			if code == End || code == Pad {
-				continue
-			}
-
 			n := len(data)
 			if n > math.MaxUint8 {
 				n = math.MaxUint8
 			}
 
+			// 1 byte: option code
 			// 1 byte: option length
-			b.Write8(uint8(n))
-
 			// N bytes: option data
-			b.WriteBytes(data[:n])
+			b = append(b, uint8(code), uint8(n))
+			b = append(b, data[:n]...)
 			data = data[n:]
 		}
 	}
+	return b
+}
+
+// encodedLen returns the length of the options as written by marshal.
+func (o Options) encodedLen() int {
+	var n int
+	for code, data := range o {
+		if code == End || code == Pad {
+			continue
+		}
+		if len(data) == 0 {
+			n += 2
+			continue
+		}
+		// Two bytes of code and length per instance of at most 255
+		// bytes.
+		n += len(data) + 2*((len(data)+math.MaxUint8-1)/math.MaxUint8)
+	}
+	return n
+}
 
-	// If "End" option is not in map, marshal it manually.
-	if _, ok := o[End]; !ok {
-		b.Write8(uint8(End))
+// EncodedOptions are options encoded once, to be shared by the many packets
+// marshaled with MarshalOptions.Shared.
+type EncodedOptions struct {
+	opts Options
+	data []byte
+}
+
+// EncodeOptions encodes o. o must not be modified afterwards.
+func EncodeOptions(o Options) *EncodedOptions {
+	b := uio.NewBigEndianBuffer(nil)
+	o.marshal(b)
+	return &EncodedOptions{
+		opts: o,
+		data: b.Data(),
+	}
+}
+
+// Options returns the encoded options. They must not be modified.
+func (e *EncodedOptions) Options() Options {
+	return e.opts
+}
+
+// overlaps returns whether o has any of the encoded options.
+func (e *EncodedOptions) overlaps(o Options) bool {
+	for k := range o {
+		if _, ok := e.opts[k]; ok {
+			return true
+		}
 	}
+	return false
+}
+
+// merged returns the encoded options overridden by o.
+func (e *EncodedOptions) merged(o Options) Options {
+	m := make(Options, len(e.opts)+len(o))
+	for k, v := range e.opts {
+		m[k] = v
+	}
+	for k, v := range o {
+		m[k] = v
+	}
+	return m
+}
+
+// without returns a copy of o without the option code.
+func (o Options) without(code OptionCode) Options {
+	m := make(Options, len(o))
+	for k, v := range o {
+		if k != code {
+			m[k] = v
+		}
+	}
+	return m
 }
 
 // sortedKeys returns an ordered slice of option keys from the Options map, for
 // use in serializing options to binary.
 func (o Options) sortedKeys() []int {
+	return o.appendSortedKeys(make([]int, 0, len(o)))
+}
+
+// appendSortedKeys appends the codes of sortedKeys to codes.
+func (o Options) appendSortedKeys(codes []int) []int {
+	return o.appendKeys(codes, nil)
+}
+
+// appendKeys appends the codes of the options listed in order, in that
+// order, to codes, followed by the codes of the other options as ordered by
+// sortedKeys.
+func (o Options) appendKeys(codes []int, order []byte) []int {
+	for _, c := range order {
+		if _, ok := o[OptionCode(c)]; ok {
+			codes = append(codes, int(c))
+		}
+	}
+
 	// Send all values for a given key
-	var codes []int
+	start := len(codes)
 	for k := range o {
-		codes = append(codes, int(k))
+		if k != OptionRelayAgentInformation && bytes.IndexByte(order, uint8(k)) < 0 {
+			codes = append(codes, int(k))
+		}
 	}
 
-	sort.Sort(sort.IntSlice(codes))
+	sort.Ints(codes[start:])
+	if _, ok := o[OptionRelayAgentInformation]; ok && bytes.IndexByte(order, uint8(OptionRelayAgentInformation)) < 0 {
+		codes = append(codes, int(OptionRelayAgentInformation))
+	}
 	return codes
 }
+
+// encodedBy returns whether the options encoded in b, up to an End option,
+// are exactly o: every option given in b, with the data of the instances of
+// an option given several times concatenated, and no other.
+func (o Options) encodedBy(b []byte) bool {
+	var n int
+	var seen [256]bool
+	var off [256]int
+	for len(b) > 0 {
+		code := OptionCode(b[0])
+		if code == Pad {
+			b = b[1:]
+			continue
+		} else if code == End {
+			break
+		}
+		if len(b) < 2 || len(b) < 2+int(b[1]) {
+			return false
+		}
+		data := b[2 : 2+int(b[1])]
+		b = b[2+len(data):]
+		v, ok := o[code]
+		if !ok || len(v) < off[code]+len(data) || !bytes.Equal(v[off[code]:off[code]+len(data)], data) {
+			return false
+		}
+		if !seen[code] {
+			seen[code] = true
+			n++
+		}
+		off[code] += len(data)
+	}
+	if n != len(o) {
+		return false
+	}
+	for code, v := range o {
+		if off[code] != len(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// Clone returns a copy of o whose values do not share memory with o's.
+func (o Options) Clone() Options {
+	if o == nil {
+		return nil
+	}
+	c := make(Options, len(o))
+	for k, v := range o {
+		c[k] = cloneBytes(v)
+	}
+	return c
+}
@@ -45,6 +45,20 @@ func TestOptionsMarshal(t *testing.T) {
 				255,
 			},
 		},
+		{
+			// The relay agent information option goes last.
+			opts: Options{
+				5:   []byte{1},
+				82:  []byte{1, 1, 1},
+				100: []byte{2},
+			},
+			want: []byte{
+				5, 1, 1,
+				100, 1, 2,
+				82, 3, 1, 1, 1,
+				255,
+			},
+		},
 		{
 			// Test RFC 3396.
 			opts: Options{
@@ -56,6 +70,15 @@ func TestOptionsMarshal(t *testing.T) {
 				255,
 			),
 		},
+		{
+			// End is written exactly once, and Pad not at all.
+			opts: Options{
+				End: []byte{},
+				Pad: []byte{},
+				5:   []byte{1},
+			},
+			want: []byte{5, 1, 1, 255},
+		},
 	} {
 		t.Run(fmt.Sprintf("Test %02d", i), func(t *testing.T) {
 			b := uio.NewBigEndianBuffer(nil)
@@ -129,6 +152,19 @@ func TestOptionsUnmarshal(t *testing.T) {
 				3: bytes.Repeat([]byte{10}, math.MaxUint8+5),
 			},
 		},
+		{
+			// RFC 3396: instances need not be adjacent.
+			input: []byte{
+				3, 2, 1, 2,
+				4, 1, 9,
+				3, 1, 3,
+				byte(End),
+			},
+			want: Options{
+				3: []byte{1, 2, 3},
+				4: []byte{9},
+			},
+		},
 		{
 			input: []byte{
 				10, 2, 255, 254,
@@ -163,3 +199,30 @@ func TestOptionsUnmarshal(t *testing.T) {
 		})
 	}
 }
+
+func TestOptionsUnmarshalIndependentValues(t *testing.T) {
+	var o Options
+	if err := o.Unmarshal(uio.NewBigEndianBuffer([]byte{3, 1, 1, 4, 1, 2, byte(End)})); err != nil {
+		t.Fatal(err)
+	}
+	// Values share a buffer; growing one must not overwrite the next.
+	o.AddRaw(3, []byte{9})
+	if got := o.Get(4); !bytes.Equal(got, []byte{2}) {
+		t.Errorf("option 4 = %v after appending to option 3, want [2]", got)
+	}
+}
+
+func TestOptionsClone(t *testing.T) {
+	if c := Options(nil).Clone(); c != nil {
+		t.Errorf("Clone() of nil = %v, want nil", c)
+	}
+	o := Options{OptionDHCPMessageType: {1}, OptionHostName: []byte("node0")}
+	c := o.Clone()
+	if !reflect.DeepEqual(c, o) {
+		t.Errorf("Clone() = %v, want %v", c, o)
+	}
+	c[OptionHostName][0] = 'N'
+	if string(o[OptionHostName]) != "node0" {
+		t.Errorf("changing clone changed original to %q", o[OptionHostName])
+	}
+}
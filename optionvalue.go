@@ -0,0 +1,530 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4
+
+import (
+	"encoding"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"time"
+)
+
+// OptionValue is a typed option value. It converts to and from the bytes
+// carried in packets, independently of how options are packed, and to and
+// from JSON.
+//
+// MarshalBinary returns the value as carried in packets, and
+// UnmarshalBinary returns an error if the bytes are malformed, so values can
+// be passed to Options.Add.
+//
+// The typed accessors of Options, NewOptionValue, configuration files and
+// the types of package dhcp4opts share these types.
+type OptionValue interface {
+	encoding.BinaryMarshaler
+	encoding.BinaryUnmarshaler
+}
+
+// errLength is returned by UnmarshalBinary for values of the wrong length.
+func errLength(b []byte, want string) error {
+	return fmt.Errorf("value of %d bytes, want %s", len(b), want)
+}
+
+// IP is an IPv4 address. Its JSON form is a string.
+type IP net.IP
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (v IP) MarshalBinary() ([]byte, error) {
+	ip := net.IP(v).To4()
+	if ip == nil {
+		return nil, fmt.Errorf("%v is not an IPv4 address", net.IP(v))
+	}
+	return append([]byte(nil), ip...), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (v *IP) UnmarshalBinary(b []byte) error {
+	if len(b) != net.IPv4len {
+		return errLength(b, "4")
+	}
+	*v = IP(append(net.IP(nil), b...))
+	return nil
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (v IP) MarshalText() ([]byte, error) {
+	return net.IP(v).MarshalText()
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (v *IP) UnmarshalText(b []byte) error {
+	var ip net.IP
+	if err := ip.UnmarshalText(b); err != nil {
+		return err
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	*v = IP(ip)
+	return nil
+}
+
+// IPList is a non-empty list of IPv4 addresses. Its JSON form is an array of
+// strings.
+type IPList []net.IP
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (v IPList) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 0, net.IPv4len*len(v))
+	for _, ip := range v {
+		ip4 := ip.To4()
+		if ip4 == nil {
+			return nil, fmt.Errorf("%v is not an IPv4 address", ip)
+		}
+		b = append(b, ip4...)
+	}
+	return b, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (v *IPList) UnmarshalBinary(b []byte) error {
+	if len(b) == 0 || len(b)%net.IPv4len != 0 {
+		return errLength(b, "a multiple of 4")
+	}
+	ips := make(IPList, 0, len(b)/net.IPv4len)
+	for ; len(b) > 0; b = b[net.IPv4len:] {
+		ips = append(ips, append(net.IP(nil), b[:net.IPv4len]...))
+	}
+	*v = ips
+	return nil
+}
+
+// Duration is a time in seconds, encoded as an unsigned 32-bit integer like
+// lease times. Its JSON form is a number of seconds.
+type Duration time.Duration
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (v Duration) MarshalBinary() ([]byte, error) {
+	s := time.Duration(v) / time.Second
+	if s < 0 || s > math.MaxUint32 {
+		return nil, fmt.Errorf("%v is out of range", time.Duration(v))
+	}
+	return U32(s).MarshalBinary()
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (v *Duration) UnmarshalBinary(b []byte) error {
+	var s U32
+	if err := s.UnmarshalBinary(b); err != nil {
+		return err
+	}
+	*v = Duration(time.Duration(s) * time.Second)
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (v Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(int64(time.Duration(v) / time.Second))
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (v *Duration) UnmarshalJSON(b []byte) error {
+	var s uint32
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	*v = Duration(time.Duration(s) * time.Second)
+	return nil
+}
+
+// String is a string. Values are carried as they are; see SanitizeString
+// and ValidateString for strings from and to untrusted peers.
+type String string
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (v String) MarshalBinary() ([]byte, error) {
+	return []byte(v), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (v *String) UnmarshalBinary(b []byte) error {
+	*v = String(b)
+	return nil
+}
+
+// Bool is a flag, encoded as 0 or 1.
+type Bool bool
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (v Bool) MarshalBinary() ([]byte, error) {
+	if v {
+		return []byte{1}, nil
+	}
+	return []byte{0}, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (v *Bool) UnmarshalBinary(b []byte) error {
+	if len(b) != 1 || b[0] > 1 {
+		return errors.New("flag is neither 0 nor 1")
+	}
+	*v = b[0] == 1
+	return nil
+}
+
+// U8, U16 and U32 are unsigned integers of 8, 16 and 32 bits, and I32 is a
+// signed integer of 32 bits. Their JSON form is a number.
+type (
+	U8  uint8
+	U16 uint16
+	U32 uint32
+	I32 int32
+)
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (v U8) MarshalBinary() ([]byte, error) {
+	return []byte{uint8(v)}, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (v *U8) UnmarshalBinary(b []byte) error {
+	if len(b) != 1 {
+		return errLength(b, "1")
+	}
+	*v = U8(b[0])
+	return nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (v U16) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, uint16(v))
+	return b, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (v *U16) UnmarshalBinary(b []byte) error {
+	if len(b) != 2 {
+		return errLength(b, "2")
+	}
+	*v = U16(binary.BigEndian.Uint16(b))
+	return nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (v U32) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, uint32(v))
+	return b, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (v *U32) UnmarshalBinary(b []byte) error {
+	if len(b) != 4 {
+		return errLength(b, "4")
+	}
+	*v = U32(binary.BigEndian.Uint32(b))
+	return nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (v I32) MarshalBinary() ([]byte, error) {
+	return U32(v).MarshalBinary()
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (v *I32) UnmarshalBinary(b []byte) error {
+	var u U32
+	if err := u.UnmarshalBinary(b); err != nil {
+		return err
+	}
+	*v = I32(u)
+	return nil
+}
+
+// U16List is a non-empty list of unsigned 16-bit integers.
+type U16List []uint16
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (v U16List) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 2*len(v))
+	for i, u := range v {
+		binary.BigEndian.PutUint16(b[2*i:], u)
+	}
+	return b, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (v *U16List) UnmarshalBinary(b []byte) error {
+	if len(b) == 0 || len(b)%2 != 0 {
+		return errLength(b, "a multiple of 2")
+	}
+	us := make(U16List, 0, len(b)/2)
+	for ; len(b) > 0; b = b[2:] {
+		us = append(us, binary.BigEndian.Uint16(b))
+	}
+	*v = us
+	return nil
+}
+
+// CodeList is a non-empty list of option codes, like the parameter request
+// list. Its JSON form is an array of numbers.
+type CodeList []OptionCode
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (v CodeList) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 0, len(v))
+	for _, c := range v {
+		b = append(b, byte(c))
+	}
+	return b, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (v *CodeList) UnmarshalBinary(b []byte) error {
+	if len(b) == 0 {
+		return errLength(b, "at least 1")
+	}
+	codes := make(CodeList, 0, len(b))
+	for _, c := range b {
+		codes = append(codes, OptionCode(c))
+	}
+	*v = codes
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler. Unlike other byte slices, the
+// codes are not encoded as base64.
+func (v CodeList) MarshalJSON() ([]byte, error) {
+	codes := make([]int, 0, len(v))
+	for _, c := range v {
+		codes = append(codes, int(c))
+	}
+	return json.Marshal(codes)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (v *CodeList) UnmarshalJSON(b []byte) error {
+	var codes []uint8
+	if err := json.Unmarshal(b, &codes); err != nil {
+		return err
+	}
+	*v = make(CodeList, 0, len(codes))
+	for _, c := range codes {
+		*v = append(*v, OptionCode(c))
+	}
+	return nil
+}
+
+// IPNetList is a non-empty list of IPv4 networks, encoded as address and
+// mask pairs like the policy filter. Its JSON form is an array of strings in
+// CIDR notation.
+type IPNetList []net.IPNet
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (v IPNetList) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 0, 2*net.IPv4len*len(v))
+	for _, n := range v {
+		ip, mask := n.IP.To4(), n.Mask
+		if len(mask) == net.IPv6len {
+			mask = mask[12:]
+		}
+		if ip == nil || len(mask) != net.IPv4len {
+			return nil, fmt.Errorf("%v is not an IPv4 network", n.String())
+		}
+		b = append(append(b, ip...), mask...)
+	}
+	return b, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (v *IPNetList) UnmarshalBinary(b []byte) error {
+	var ips IPList
+	if err := ips.UnmarshalBinary(b); err != nil || len(ips)%2 != 0 {
+		return errLength(b, "a multiple of 8")
+	}
+	nets := make(IPNetList, 0, len(ips)/2)
+	for ; len(ips) > 0; ips = ips[2:] {
+		nets = append(nets, net.IPNet{IP: ips[0], Mask: net.IPMask(ips[1])})
+	}
+	*v = nets
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (v IPNetList) MarshalJSON() ([]byte, error) {
+	s := make([]string, 0, len(v))
+	for _, n := range v {
+		s = append(s, n.String())
+	}
+	return json.Marshal(s)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (v *IPNetList) UnmarshalJSON(b []byte) error {
+	var s []string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	nets := make(IPNetList, 0, len(s))
+	for _, cidr := range s {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return err
+		}
+		nets = append(nets, *n)
+	}
+	*v = nets
+	return nil
+}
+
+// StaticRouteList is a non-empty list of classful static routes. Its JSON
+// form is an array of objects with a destination and a router.
+type StaticRouteList []StaticRoute
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (v StaticRouteList) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 0, 2*net.IPv4len*len(v))
+	for _, r := range v {
+		dst, router := r.Destination.To4(), r.Router.To4()
+		if dst == nil || router == nil {
+			return nil, fmt.Errorf("route to %v via %v is not an IPv4 route", r.Destination, r.Router)
+		}
+		b = append(append(b, dst...), router...)
+	}
+	return b, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (v *StaticRouteList) UnmarshalBinary(b []byte) error {
+	var ips IPList
+	if err := ips.UnmarshalBinary(b); err != nil || len(ips)%2 != 0 {
+		return errLength(b, "a multiple of 8")
+	}
+	routes := make(StaticRouteList, 0, len(ips)/2)
+	for ; len(ips) > 0; ips = ips[2:] {
+		routes = append(routes, StaticRoute{Destination: ips[0], Router: ips[1]})
+	}
+	*v = routes
+	return nil
+}
+
+// DomainList is a non-empty list of domain names, encoded as defined by RFC
+// 3397 for OptionDomainSearch.
+type DomainList []string
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (v DomainList) MarshalBinary() ([]byte, error) {
+	return MarshalDomainSearch(v)
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (v *DomainList) UnmarshalBinary(b []byte) error {
+	names, err := ParseDomainSearch(b)
+	if err != nil {
+		return err
+	}
+	*v = names
+	return nil
+}
+
+// optionValues are the types of the options with values that are not opaque
+// bytes: those of RFC 2132 and later options with structured values.
+var optionValues = map[OptionCode]func() OptionValue{
+	OptionSubnetMask:                                 func() OptionValue { return new(IP) },
+	OptionTimeOffset:                                 func() OptionValue { return new(I32) },
+	OptionRouters:                                    func() OptionValue { return new(IPList) },
+	OptionTimeServers:                                func() OptionValue { return new(IPList) },
+	OptionNameServers:                                func() OptionValue { return new(IPList) },
+	OptionDomainNameServers:                          func() OptionValue { return new(IPList) },
+	OptionLogServers:                                 func() OptionValue { return new(IPList) },
+	OptionCookieServers:                              func() OptionValue { return new(IPList) },
+	OptionLPRServers:                                 func() OptionValue { return new(IPList) },
+	OptionImpressServers:                             func() OptionValue { return new(IPList) },
+	OptionResourceLocationServers:                    func() OptionValue { return new(IPList) },
+	OptionHostName:                                   func() OptionValue { return new(String) },
+	OptionBootFileSize:                               func() OptionValue { return new(U16) },
+	OptionMeritDumpFile:                              func() OptionValue { return new(String) },
+	OptionDomainName:                                 func() OptionValue { return new(String) },
+	OptionSwapServer:                                 func() OptionValue { return new(IP) },
+	OptionRootPath:                                   func() OptionValue { return new(String) },
+	OptionExtensionsPath:                             func() OptionValue { return new(String) },
+	OptionIPForwardingEnableDisable:                  func() OptionValue { return new(Bool) },
+	OptionNonLocalSourceRoutingEnableDisable:         func() OptionValue { return new(Bool) },
+	OptionPolicyFilter:                               func() OptionValue { return new(IPNetList) },
+	OptionMaximumDatagramReassemblySize:              func() OptionValue { return new(U16) },
+	OptionDefaultIPTimeToLive:                        func() OptionValue { return new(U8) },
+	OptionPathMTUAgingTimeout:                        func() OptionValue { return new(Duration) },
+	OptionPathMTUPlateauTable:                        func() OptionValue { return new(U16List) },
+	OptionInterfaceMTU:                               func() OptionValue { return new(U16) },
+	OptionAllSubnetsAreLocal:                         func() OptionValue { return new(Bool) },
+	OptionBroadcastAddress:                           func() OptionValue { return new(IP) },
+	OptionPerformMaskDiscovery:                       func() OptionValue { return new(Bool) },
+	OptionMaskSupplier:                               func() OptionValue { return new(Bool) },
+	OptionPerformRouterDiscovery:                     func() OptionValue { return new(Bool) },
+	OptionRouterSolicitationAddress:                  func() OptionValue { return new(IP) },
+	OptionStaticRoute:                                func() OptionValue { return new(StaticRouteList) },
+	OptionTrailerEncapsulation:                       func() OptionValue { return new(Bool) },
+	OptionARPCacheTimeout:                            func() OptionValue { return new(Duration) },
+	OptionEthernetEncapsulation:                      func() OptionValue { return new(Bool) },
+	OptionTCPDefaultTTL:                              func() OptionValue { return new(U8) },
+	OptionTCPKeepaliveInterval:                       func() OptionValue { return new(Duration) },
+	OptionTCPKeepaliveGarbage:                        func() OptionValue { return new(Bool) },
+	OptionNetworkInformationServiceDomain:            func() OptionValue { return new(String) },
+	OptionNetworkInformationServers:                  func() OptionValue { return new(IPList) },
+	OptionNetworkTimeProtocolServers:                 func() OptionValue { return new(IPList) },
+	OptionNetBIOSOverTCPIPNameServer:                 func() OptionValue { return new(IPList) },
+	OptionNetBIOSOverTCPIPDatagramDistributionServer: func() OptionValue { return new(IPList) },
+	OptionNetBIOSOverTCPIPNodeType:                   func() OptionValue { return new(U8) },
+	OptionNetBIOSOverTCPIPScope:                      func() OptionValue { return new(String) },
+	OptionXWindowSystemFontServer:                    func() OptionValue { return new(IPList) },
+	OptionXWindowSystemDisplayManager:                func() OptionValue { return new(IPList) },
+	OptionRequestedIPAddress:                         func() OptionValue { return new(IP) },
+	OptionIPAddressLeaseTime:                         func() OptionValue { return new(Duration) },
+	OptionOverload:                                   func() OptionValue { return new(U8) },
+	OptionDHCPMessageType:                            func() OptionValue { return new(U8) },
+	OptionServerIdentifier:                           func() OptionValue { return new(IP) },
+	OptionParameterRequestList:                       func() OptionValue { return new(CodeList) },
+	OptionMessage:                                    func() OptionValue { return new(String) },
+	OptionMaximumDHCPMessageSize:                     func() OptionValue { return new(U16) },
+	OptionRenewalTimeValue:                           func() OptionValue { return new(Duration) },
+	OptionRebindingTimeValue:                         func() OptionValue { return new(Duration) },
+	OptionVendorClassIdentifier:                      func() OptionValue { return new(String) },
+	OptionTFTPServerName:                             func() OptionValue { return new(String) },
+	OptionBootFileName:                               func() OptionValue { return new(String) },
+	OptionDomainSearch:                               func() OptionValue { return new(DomainList) },
+	OptionClientFQDN:                                 func() OptionValue { return new(ClientFQDN) },
+	OptionClientLastTransactionTime:                  func() OptionValue { return new(Duration) },
+	OptionAssociatedIP:                               func() OptionValue { return new(IPList) },
+}
+
+// NewOptionValue returns a new zero value of the type of the option code, or
+// nil if its value is opaque bytes or unknown.
+func NewOptionValue(code OptionCode) OptionValue {
+	if fn, ok := optionValues[code]; ok {
+		return fn()
+	}
+	return nil
+}
+
+// Value decodes the option code into v and returns true, or returns false if
+// the option is not present or malformed.
+func (o Options) Value(code OptionCode, v OptionValue) bool {
+	b, ok := o[code]
+	return ok && v.UnmarshalBinary(b) == nil
+}
+
+// SetValue sets the option code to v. An empty value removes the option.
+func (o Options) SetValue(code OptionCode, v OptionValue) error {
+	b, err := v.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	o.setBytes(code, b)
+	return nil
+}
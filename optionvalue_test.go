@@ -0,0 +1,194 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestOptionValues(t *testing.T) {
+	for _, tt := range []struct {
+		desc  string
+		code  OptionCode
+		value OptionValue
+		bytes []byte
+		json  string
+	}{
+		{
+			desc:  "IP",
+			code:  OptionSubnetMask,
+			value: &IP{255, 255, 255, 0},
+			bytes: []byte{255, 255, 255, 0},
+			json:  `"255.255.255.0"`,
+		},
+		{
+			desc:  "IPList",
+			code:  OptionRouters,
+			value: &IPList{{10, 0, 0, 1}, {10, 0, 0, 2}},
+			bytes: []byte{10, 0, 0, 1, 10, 0, 0, 2},
+			json:  `["10.0.0.1","10.0.0.2"]`,
+		},
+		{
+			desc:  "Duration",
+			code:  OptionIPAddressLeaseTime,
+			value: func() *Duration { d := Duration(time.Hour); return &d }(),
+			bytes: []byte{0, 0, 0x0e, 0x10},
+			json:  `3600`,
+		},
+		{
+			desc:  "String",
+			code:  OptionDomainName,
+			value: func() *String { s := String("example.net"); return &s }(),
+			bytes: []byte("example.net"),
+			json:  `"example.net"`,
+		},
+		{
+			desc:  "Bool",
+			code:  OptionIPForwardingEnableDisable,
+			value: func() *Bool { b := Bool(true); return &b }(),
+			bytes: []byte{1},
+			json:  `true`,
+		},
+		{
+			desc:  "U8",
+			code:  OptionDefaultIPTimeToLive,
+			value: func() *U8 { u := U8(64); return &u }(),
+			bytes: []byte{64},
+			json:  `64`,
+		},
+		{
+			desc:  "U16",
+			code:  OptionInterfaceMTU,
+			value: func() *U16 { u := U16(1500); return &u }(),
+			bytes: []byte{0x05, 0xdc},
+			json:  `1500`,
+		},
+		{
+			desc:  "I32",
+			code:  OptionTimeOffset,
+			value: func() *I32 { i := I32(-1); return &i }(),
+			bytes: []byte{0xff, 0xff, 0xff, 0xff},
+			json:  `-1`,
+		},
+		{
+			desc:  "U16List",
+			code:  OptionPathMTUPlateauTable,
+			value: &U16List{1500, 9000},
+			bytes: []byte{0x05, 0xdc, 0x23, 0x28},
+			json:  `[1500,9000]`,
+		},
+		{
+			desc:  "CodeList",
+			code:  OptionParameterRequestList,
+			value: &CodeList{OptionSubnetMask, OptionRouters},
+			bytes: []byte{1, 3},
+			json:  `[1,3]`,
+		},
+		{
+			desc:  "IPNetList",
+			code:  OptionPolicyFilter,
+			value: &IPNetList{{IP: net.IP{10, 0, 0, 0}, Mask: net.CIDRMask(8, 32)}},
+			bytes: []byte{10, 0, 0, 0, 255, 0, 0, 0},
+			json:  `["10.0.0.0/8"]`,
+		},
+		{
+			desc:  "StaticRouteList",
+			code:  OptionStaticRoute,
+			value: &StaticRouteList{{Destination: net.IP{10, 0, 0, 0}, Router: net.IP{192, 168, 0, 1}}},
+			bytes: []byte{10, 0, 0, 0, 192, 168, 0, 1},
+			json:  `[{"destination":"10.0.0.0","router":"192.168.0.1"}]`,
+		},
+		{
+			desc:  "DomainList",
+			code:  OptionDomainSearch,
+			value: &DomainList{"a.example", "example"},
+			bytes: []byte("\x01a\x07example\x00\xc0\x02"),
+			json:  `["a.example","example"]`,
+		},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			b, err := tt.value.MarshalBinary()
+			if err != nil || !bytes.Equal(b, tt.bytes) {
+				t.Errorf("MarshalBinary() = %v, %v, want %v", b, err, tt.bytes)
+			}
+			j, err := json.Marshal(tt.value)
+			if err != nil || string(j) != tt.json {
+				t.Errorf("json.Marshal() = %s, %v, want %s", j, err, tt.json)
+			}
+
+			// The registry has the same type for the option, which
+			// decodes both forms back to the value.
+			v := NewOptionValue(tt.code)
+			if reflect.TypeOf(v) != reflect.TypeOf(tt.value) {
+				t.Fatalf("NewOptionValue(%d) = %T, want %T", tt.code, v, tt.value)
+			}
+			if err := v.UnmarshalBinary(tt.bytes); err != nil || !reflect.DeepEqual(v, tt.value) {
+				t.Errorf("UnmarshalBinary() = %v, %v, want %v", v, err, tt.value)
+			}
+			v = NewOptionValue(tt.code)
+			if err := json.Unmarshal([]byte(tt.json), v); err != nil {
+				t.Errorf("json.Unmarshal() = %v", err)
+			} else if b, err := v.MarshalBinary(); err != nil || !bytes.Equal(b, tt.bytes) {
+				t.Errorf("json.Unmarshal() = %v, encoded as %v, %v, want %v", v, b, err, tt.bytes)
+			}
+
+			o := make(Options)
+			if err := o.SetValue(tt.code, tt.value); err != nil {
+				t.Fatalf("SetValue() = %v", err)
+			}
+			if !o.Value(tt.code, NewOptionValue(tt.code)) {
+				t.Errorf("Value() = false, want true")
+			}
+		})
+	}
+}
+
+func TestOptionValuesMalformed(t *testing.T) {
+	for _, tt := range []struct {
+		value OptionValue
+		b     []byte
+	}{
+		{new(IP), []byte{10, 0, 0}},
+		{new(IPList), nil},
+		{new(IPList), []byte{10, 0, 0, 1, 10}},
+		{new(Duration), []byte{0, 1}},
+		{new(Bool), []byte{2}},
+		{new(U8), []byte{1, 2}},
+		{new(U16), []byte{1}},
+		{new(U32), []byte{1, 2, 3}},
+		{new(U16List), []byte{1, 2, 3}},
+		{new(CodeList), nil},
+		{new(IPNetList), []byte{10, 0, 0, 0}},
+		{new(StaticRouteList), []byte{10, 0, 0, 0, 192, 168, 0}},
+		{new(DomainList), []byte{5, 'a'}},
+	} {
+		if err := tt.value.UnmarshalBinary(tt.b); err == nil {
+			t.Errorf("%T.UnmarshalBinary(%v) = %v, want error", tt.value, tt.b, tt.value)
+		}
+	}
+
+	for _, v := range []OptionValue{
+		&IP{0xfe, 0x80, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1},
+		&IPList{net.ParseIP("::1")},
+		func() *Duration { d := Duration(-time.Second); return &d }(),
+	} {
+		if b, err := v.MarshalBinary(); err == nil {
+			t.Errorf("%T.MarshalBinary() = %v, want error", v, b)
+		}
+	}
+}
+
+func TestNewOptionValueOpaque(t *testing.T) {
+	for _, code := range []OptionCode{OptionVendorSpecificInformation, OptionClientIdentifier, 224} {
+		if v := NewOptionValue(code); v != nil {
+			t.Errorf("NewOptionValue(%d) = %T, want nil", code, v)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4
+
+import (
+	"math"
+
+	"github.com/u-root/u-root/pkg/uio"
+)
+
+// Values of the option overload option as defined by RFC 2132, Section 9.3.
+// Both may be set.
+const (
+	// OverloadFile means the file field carries options.
+	OverloadFile uint8 = 1
+
+	// OverloadSName means the sname field carries options.
+	OverloadSName uint8 = 2
+)
+
+const (
+	// fixedLen is the length of a packet up to and including the magic
+	// cookie.
+	fixedLen = minPacketLen + len(magicCookie)
+
+	snameLen = 64
+	fileLen  = 128
+)
+
+// overloaded is the encoding of options spread over the options, file and
+// sname fields.
+type overloaded struct {
+	// options is the options field, including the option overload option
+	// and End.
+	options []byte
+
+	// file and sname are the fields if they carry options, or nil.
+	file, sname []byte
+}
+
+// overload encodes o, spreading the options over the options field and the
+// unused ones of the file and sname fields of p, so that the packet is at
+// most max bytes long. It returns nil if o fits into the options field.
+//
+// Options of up to 255 bytes are placed first, whole, so that short options
+// such as the message type stay in the options field where possible. Longer
+// options, which receivers concatenate anyway (RFC 3396), fill the remaining
+// space in order.
+func overload(p *Packet, o Options, max int) (*overloaded, error) {
+	if fixedLen+o.encodedLen()+1 <= max {
+		return nil, nil
+	}
+
+	// Room in the options, file and sname fields, keeping space for End
+	// in each and for the option overload option in the options field.
+	room := [3]int{max - fixedLen - 1 - 3, -1, -1}
+	if p.BootFile == "" {
+		room[1] = fileLen - 1
+	}
+	if p.ServerName == "" {
+		room[2] = snameLen - 1
+	}
+
+	var fields [3][]byte
+	var long []OptionCode
+	for _, c := range o.sortedKeys() {
+		code := OptionCode(c)
+		data := o[code]
+		if code == End || code == Pad || code == OptionOverload || len(data) == 0 {
+			continue
+		}
+		if len(data) > math.MaxUint8 {
+			long = append(long, code)
+			continue
+		}
+		placed := false
+		for f := range fields {
+			if len(fields[f])+2+len(data) <= room[f] {
+				fields[f] = append(append(fields[f], uint8(code), uint8(len(data))), data...)
+				placed = true
+				break
+			}
+		}
+		if !placed {
+			return nil, ErrTooLarge
+		}
+	}
+	for _, code := range long {
+		data := o[code]
+		for f := 0; len(data) > 0; {
+			if f == len(fields) {
+				return nil, ErrTooLarge
+			}
+			n := room[f] - len(fields[f]) - 2
+			if n < 1 {
+				f++
+				continue
+			}
+			if n > math.MaxUint8 {
+				n = math.MaxUint8
+			}
+			if n > len(data) {
+				n = len(data)
+			}
+			fields[f] = append(append(fields[f], uint8(code), uint8(n)), data[:n]...)
+			data = data[n:]
+		}
+	}
+
+	var ov overloaded
+	var flag uint8
+	if fields[1] != nil {
+		flag |= OverloadFile
+		ov.file = padField(fields[1], fileLen)
+	}
+	if fields[2] != nil {
+		flag |= OverloadSName
+		ov.sname = padField(fields[2], snameLen)
+	}
+	ov.options = append([]byte{uint8(OptionOverload), 1, flag}, fields[0]...)
+	ov.options = append(ov.options, uint8(End))
+	return &ov, nil
+}
+
+// padField terminates the options in b with End and pads them to n bytes.
+func padField(b []byte, n int) []byte {
+	f := make([]byte, n)
+	copy(f, b)
+	f[len(b)] = uint8(End)
+	return f
+}
+
+// unoverload adds the options carried in the file and sname fields, as
+// announced by the option overload option, to p's options. The fields then
+// hold no names, and the option overload option is removed, as the options
+// are no longer overloaded once parsed. If lenient, the fields are parsed
+// like Options.unmarshal does leniently.
+func (p *Packet) unoverload(sname, file []byte, lenient bool) error {
+	flag := p.Options.Overload()
+	if flag == 0 || flag > OverloadFile|OverloadSName {
+		return nil
+	}
+	delete(p.Options, OptionOverload)
+
+	// RFC 3396, Section 7: options continue in the file field, then in
+	// the sname field.
+	for _, f := range []struct {
+		bit  uint8
+		data []byte
+		name *string
+	}{
+		{OverloadFile, file, &p.BootFile},
+		{OverloadSName, sname, &p.ServerName},
+	} {
+		if flag&f.bit == 0 {
+			continue
+		}
+		*f.name = ""
+
+		var o Options
+		switch err := o.unmarshal(uio.NewBigEndianBuffer(f.data), lenient); err {
+		case nil:
+		case ErrMissingEnd:
+			p.missingEnd = true
+		case ErrTruncatedOption:
+			p.truncated = true
+		default:
+			return err
+		}
+		for _, c := range o.sortedKeys() {
+			if code := OptionCode(c); code != OptionOverload {
+				p.Options.AddRaw(code, o[code])
+			}
+		}
+	}
+	return nil
+}
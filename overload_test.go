@@ -0,0 +1,224 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/u-root/u-root/pkg/uio"
+)
+
+func TestUnmarshalOverload(t *testing.T) {
+	p := NewPacket(BootReply)
+	p.Options = Options{
+		OptionDHCPMessageType:           {byte(DHCPOffer)},
+		OptionOverload:                  {OverloadFile | OverloadSName},
+		OptionVendorSpecificInformation: {1, 2},
+	}
+	b, err := p.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Fill sname (offset 44) and file (offset 108) with options by hand.
+	copy(b[44:], []byte{byte(OptionDomainName), 3, 'n', 'e', 't', byte(End)})
+	copy(b[108:], []byte{
+		byte(OptionRouters), 4, 192, 168, 0, 1,
+		byte(OptionVendorSpecificInformation), 1, 3,
+		byte(End),
+	})
+
+	got, err := ParsePacket(b)
+	if err != nil {
+		t.Fatalf("ParsePacket() = %v", err)
+	}
+	want := Options{
+		OptionDHCPMessageType:           {byte(DHCPOffer)},
+		OptionVendorSpecificInformation: {1, 2, 3},
+		OptionRouters:                   {192, 168, 0, 1},
+		OptionDomainName:                []byte("net"),
+	}
+	if !reflect.DeepEqual(got.Options, want) {
+		t.Errorf("options = %v, want %v", got.Options, want)
+	}
+	if got.ServerName != "" || got.BootFile != "" {
+		t.Errorf("sname %q, file %q; want both empty", got.ServerName, got.BootFile)
+	}
+	if err := got.Validate(); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+}
+
+func TestMarshalOverload(t *testing.T) {
+	opts := Options{
+		OptionDHCPMessageType:           {byte(DHCPACK)},
+		OptionServerIdentifier:          {192, 168, 0, 1},
+		OptionDomainName:                bytes.Repeat([]byte{'a'}, 100),
+		OptionVendorSpecificInformation: bytes.Repeat([]byte{1}, 300),
+	}
+
+	for _, tt := range []struct {
+		desc       string
+		sname      string
+		file       string
+		max        int
+		err        error
+		overloaded uint8
+	}{
+		{
+			desc: "fits",
+			max:  1500,
+		},
+		{
+			desc:       "file",
+			max:        548,
+			overloaded: OverloadFile,
+		},
+		{
+			desc:       "file and sname",
+			max:        500,
+			overloaded: OverloadFile | OverloadSName,
+		},
+		{
+			desc:       "sname only",
+			file:       "pxelinux.0",
+			max:        600,
+			overloaded: OverloadSName,
+		},
+		{
+			desc:  "too large",
+			sname: "boot",
+			file:  "pxelinux.0",
+			max:   548,
+			err:   ErrTooLarge,
+		},
+	} {
+		p := NewPacket(BootReply)
+		p.ServerName = tt.sname
+		p.BootFile = tt.file
+		p.Options = opts
+		b, err := MarshalOptions{MaxSize: tt.max}.Marshal(p)
+		if err != tt.err {
+			t.Errorf("%s: Marshal() = %v, want %v", tt.desc, err, tt.err)
+			continue
+		} else if err != nil {
+			continue
+		}
+		if len(b) > tt.max {
+			t.Errorf("%s: marshaled %d bytes, want at most %d", tt.desc, len(b), tt.max)
+		}
+
+		// Check where options went before they are merged again.
+		var main Options
+		if err := main.Unmarshal(uio.NewBigEndianBuffer(b[fixedLen:])); err != nil {
+			t.Fatalf("%s: options field: %v", tt.desc, err)
+		}
+		if got := main.Overload(); got != tt.overloaded {
+			t.Errorf("%s: overload %d, want %d", tt.desc, got, tt.overloaded)
+		}
+		if main.MessageType() != DHCPACK {
+			t.Errorf("%s: message type not in the options field", tt.desc)
+		}
+
+		got, err := ParsePacket(b)
+		if err != nil {
+			t.Fatalf("%s: ParsePacket() = %v", tt.desc, err)
+		}
+		if !reflect.DeepEqual(got.Options, opts) {
+			t.Errorf("%s: options = %v, want %v", tt.desc, got.Options, opts)
+		}
+		if got.ServerName != tt.sname || got.BootFile != tt.file {
+			t.Errorf("%s: sname %q, file %q; want %q, %q", tt.desc, got.ServerName, got.BootFile, tt.sname, tt.file)
+		}
+	}
+}
+
+func TestMarshalTrim(t *testing.T) {
+	opts := Options{
+		OptionDHCPMessageType:           {byte(DHCPACK)},
+		OptionServerIdentifier:          {192, 168, 0, 1},
+		OptionDomainName:                bytes.Repeat([]byte{'a'}, 100),
+		OptionVendorSpecificInformation: bytes.Repeat([]byte{1}, 300),
+		OptionBootFileName:              []byte("pxelinux.0"),
+	}
+
+	for _, tt := range []struct {
+		desc    string
+		trim    []OptionCode
+		err     error
+		trimmed []OptionCode
+	}{
+		{
+			desc: "nothing to trim",
+			err:  ErrTooLarge,
+		},
+		{
+			desc: "trim not enough",
+			trim: []OptionCode{OptionBootFileName},
+			err:  ErrTooLarge,
+		},
+		{
+			desc:    "trim one",
+			trim:    []OptionCode{OptionRouters, OptionVendorSpecificInformation, OptionDomainName},
+			trimmed: []OptionCode{OptionVendorSpecificInformation},
+		},
+		{
+			desc:    "trim two",
+			trim:    []OptionCode{OptionBootFileName, OptionVendorSpecificInformation, OptionDomainName},
+			trimmed: []OptionCode{OptionBootFileName, OptionVendorSpecificInformation},
+		},
+	} {
+		p := NewPacket(BootReply)
+		p.ServerName = "boot"
+		p.BootFile = "pxelinux.0"
+		p.Options = opts
+		b, err := MarshalOptions{MaxSize: 400, Trim: tt.trim}.Marshal(p)
+		if err != tt.err {
+			t.Errorf("%s: Marshal() = %v, want %v", tt.desc, err, tt.err)
+			continue
+		} else if err != nil {
+			continue
+		}
+		if len(b) > 400 {
+			t.Errorf("%s: marshaled %d bytes, want at most 400", tt.desc, len(b))
+		}
+
+		got, err := ParsePacket(b)
+		if err != nil {
+			t.Fatalf("%s: ParsePacket() = %v", tt.desc, err)
+		}
+		want := opts
+		for _, code := range tt.trimmed {
+			want = want.without(code)
+		}
+		if !reflect.DeepEqual(got.Options, want) {
+			t.Errorf("%s: options = %v, want %v", tt.desc, got.Options, want)
+		}
+		if len(p.Options) != len(opts) {
+			t.Errorf("%s: Marshal() changed the packet's options", tt.desc)
+		}
+	}
+}
+
+func TestMaxReplySize(t *testing.T) {
+	for _, tt := range []struct {
+		size uint16
+		want int
+	}{
+		{size: 0, want: 548},
+		{size: 300, want: 548},
+		{size: 576, want: 548},
+		{size: 1500, want: 1472},
+	} {
+		p := NewPacket(BootRequest)
+		if tt.size != 0 {
+			p.Options.SetMaximumDHCPMessageSize(tt.size)
+		}
+		if got := MaxReplySize(p); got != tt.want {
+			t.Errorf("MaxReplySize(%d) = %d, want %d", tt.size, got, tt.want)
+		}
+	}
+}
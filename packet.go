@@ -5,11 +5,10 @@
 package dhcp4
 
 import (
+	"bytes"
+	"encoding/binary"
 	"fmt"
 	"net"
-	"strings"
-
-	"github.com/u-root/u-root/pkg/uio"
 )
 
 const (
@@ -23,8 +22,87 @@ const (
 	// flagBroadcast is the broadcast bit in the flag field as defined by
 	// RFC 2131, Section 2, Figure 2.
 	flagBroadcast = 1 << 15
+
+	// bootpMinLen is the minimum length of a BOOTP message as required by
+	// RFC 1542, Section 2.1.
+	bootpMinLen = 300
+
+	// ethernetMinLen is the length a DHCP packet must have for the IPv4
+	// and UDP datagram carrying it to be bootpMinLen bytes long.
+	ethernetMinLen = bootpMinLen - 20 - 8
+)
+
+// Padding is a policy for padding a marshaled packet after the End option.
+type Padding uint8
+
+// Padding policies for MarshalOptions.
+const (
+	// PadNone does not pad the packet.
+	PadNone Padding = iota
+
+	// PadBOOTP pads the packet to the 300 byte minimum BOOTP message
+	// length of RFC 1542, Section 2.1.
+	PadBOOTP
+
+	// PadEthernet pads the packet so that the minimal IPv4 and UDP
+	// datagram carrying it is at least 300 bytes long, which some old
+	// relay agents and firmware expect of the Ethernet payload.
+	PadEthernet
+)
+
+// MarshalOptions configures how a Packet is written to binary.
+//
+// The zero value marshals a packet exactly like Packet.MarshalBinary.
+type MarshalOptions struct {
+	// Padding is the padding policy applied after the End option.
+	Padding Padding
+
+	// Shared are options added to the packet's own options. They are
+	// written from their pre-encoded bytes, which saves encoding them for
+	// every packet when many packets carry the same options.
+	//
+	// If the packet has any of the shared options itself, its own values
+	// win and all options are encoded from scratch.
+	Shared *EncodedOptions
+
+	// MaxSize, if not zero, is the maximum length of the marshaled packet.
+	// Options that do not fit into the options field are moved to the
+	// file and sname fields, if the packet does not use them, as described
+	// by RFC 2132, Section 9.3. If they still do not fit, Marshal returns
+	// ErrTooLarge.
+	//
+	// Servers set it from the client's Maximum DHCP Message Size option,
+	// or to 548 bytes (576 minus IP and UDP headers) if the client sent
+	// none, see MaxReplySize.
+	MaxSize int
+
+	// Trim lists options that may be left out, least important first, if
+	// the packet does not fit into MaxSize even with option overload.
+	// They are left out one by one until it fits.
+	Trim []OptionCode
+}
+
+const (
+	// minMaxMessageSize is the smallest Maximum DHCP Message Size, which
+	// every client must accept, see RFC 2132, Section 9.10.
+	minMaxMessageSize = 576
+
+	// ipUDPLen is the length of the IPv4 and UDP headers of a DHCP
+	// message without IP options.
+	ipUDPLen = 20 + 8
 )
 
+// MaxReplySize returns the MarshalOptions.MaxSize for replies to request:
+// the Maximum DHCP Message Size the client sent less the IP and UDP
+// headers, or 548 bytes if it sent none or one below the minimum of 576.
+func MaxReplySize(request *Packet) int {
+	size := int(request.Options.MaximumDHCPMessageSize())
+	if size < minMaxMessageSize {
+		size = minMaxMessageSize
+	}
+	return size - ipUDPLen
+}
+
 var (
 	// This is the magic cookie for BOOTP/DHCP packets as defined in RFC
 	// 1497 and RFC 2131, Section 3.
@@ -81,6 +159,36 @@ type Packet struct {
 
 	// Options is the list of vendor-specific extensions.
 	Options Options
+
+	// VendorArea is the vendor area of a BOOTP message (RFC 951) that
+	// does not start with the magic cookie, kept as is since it holds no
+	// options. It is nil for DHCP packets and for BOOTP messages with the
+	// vendor extensions of RFC 1497, whose extensions are in Options.
+	//
+	// If VendorArea is not nil, it is marshaled instead of the magic
+	// cookie and Options.
+	VendorArea []byte
+
+	// missingEnd is set by UnmarshalBinary if the options were not
+	// terminated by an End option.
+	missingEnd bool
+
+	// truncated is set by a lenient Unmarshal if the last option was cut
+	// short.
+	truncated bool
+
+	// order lists the codes of the options as read by UnmarshalBinary,
+	// in the order they first appeared, for Marshal to keep.
+	order []byte
+
+	// raw is the options area as read by UnmarshalBinary, written again by
+	// Marshal as long as Options still holds what it encodes.
+	raw []byte
+
+	// buf backs the addresses, hardware address and option values of a
+	// packet unmarshaled with UnmarshalOptions.Reuse, to be reused by the
+	// next.
+	buf []byte
 }
 
 // NewPacket returns a new DHCP packet with the given op code.
@@ -92,55 +200,192 @@ func NewPacket(op OpCode) *Packet {
 	}
 }
 
-func writeIP(b *uio.Lexer, ip net.IP) {
-	var zeros [net.IPv4len]byte
-	if ip == nil {
-		b.WriteBytes(zeros[:])
-	} else {
-		b.WriteBytes(ip[:net.IPv4len])
+// appendIP appends the IPv4 address ip to b, or 0.0.0.0 if ip is nil.
+func appendIP(b []byte, ip net.IP) []byte {
+	if ip4 := ip.To4(); ip4 != nil {
+		return append(b, ip4...)
+	} else if len(ip) >= net.IPv4len {
+		return append(b, ip[:net.IPv4len]...)
+	}
+	return append(b, 0, 0, 0, 0)
+}
+
+// appendField appends s to b, truncated or padded with zeros to n bytes.
+func appendField(b []byte, s string, n int) []byte {
+	if len(s) > n {
+		s = s[:n]
+	}
+	b = append(b, s...)
+	for i := len(s); i < n; i++ {
+		b = append(b, 0)
 	}
+	return b
 }
 
 // MarshalBinary writes the packet to binary.
+//
+// Options longer than 255 bytes are split into several options with the same
+// code, as described in RFC 3396.
+//
+// The options of an unmarshaled packet are written byte for byte as they
+// were read, including options given several times, Pad options and
+// padding, as long as they are unchanged, so that a packet forwarded
+// unchanged is not changed. Once changed, they are written in the order they
+// were read, followed by options added since in the order of
+// Options.Marshal. Options read from or moved to the sname and file fields
+// are written in the order of Options.Marshal.
 func (p *Packet) MarshalBinary() ([]byte, error) {
-	b := uio.NewBigEndianBuffer(make([]byte, 0, minPacketLen))
-	b.Write8(uint8(p.Op))
-	b.Write8(p.HType)
+	return MarshalOptions{}.Marshal(p)
+}
 
-	// HLen
-	b.Write8(uint8(len(p.CHAddr)))
-	b.Write8(p.Hops)
-	b.WriteBytes(p.TransactionID[:])
-	b.Write16(p.Secs)
+// AppendBinary appends the packet in binary to b and returns the extended
+// buffer, like MarshalBinary.
+func (p *Packet) AppendBinary(b []byte) ([]byte, error) {
+	return MarshalOptions{}.Append(b, p)
+}
 
+// Marshal writes the packet to binary according to mo.
+func (mo MarshalOptions) Marshal(p *Packet) ([]byte, error) {
+	// Most packets fit into the 576 bytes every client must accept.
+	return mo.Append(make([]byte, 0, 576), p)
+}
+
+// Append appends the packet in binary according to mo to buf and returns the
+// extended buffer.
+//
+// Append does not allocate if buf has room for the packet, p has at most
+// 32 options, none of them given in mo.Shared too, and the packet fits into
+// mo.MaxSize without option overload. Servers and clients sending many packets can reuse one buffer:
+//
+//	buf, err = mo.Append(buf[:0], p)
+func (mo MarshalOptions) Append(buf []byte, p *Packet) ([]byte, error) {
+	start := len(buf)
+	chaddr := p.HardwareAddr()
 	var flags uint16
 	if p.Broadcast {
 		flags |= flagBroadcast
 	}
-	b.Write16(flags)
+	b := append(buf, uint8(p.Op), p.HType, uint8(len(chaddr)), p.Hops)
+	b = append(b, p.TransactionID[:]...)
+	b = append(b, uint8(p.Secs>>8), uint8(p.Secs), uint8(flags>>8), uint8(flags))
+	b = appendIP(b, p.CIAddr)
+	b = appendIP(b, p.YIAddr)
+	b = appendIP(b, p.SIAddr)
+	b = appendIP(b, p.GIAddr)
+	b = append(b, chaddr...)
+	for i := len(chaddr); i < chaddrLen; i++ {
+		b = append(b, 0)
+	}
 
-	writeIP(b, p.CIAddr)
-	writeIP(b, p.YIAddr)
-	writeIP(b, p.SIAddr)
-	writeIP(b, p.GIAddr)
-	copy(b.WriteN(chaddrLen), p.CHAddr)
+	if p.VendorArea != nil {
+		b = appendField(b, p.ServerName, snameLen)
+		b = appendField(b, p.BootFile, fileLen)
+		b = append(b, p.VendorArea...)
+		// The vendor area is at least 64 bytes long.
+		for len(b)-start < bootpMinLen {
+			b = append(b, 0)
+		}
+		return b, nil
+	}
 
-	var sname [64]byte
-	copy(sname[:], []byte(p.ServerName))
-	sname[len(p.ServerName)] = 0
-	b.WriteBytes(sname[:])
+	var ov *overloaded
+	var trimmed Options
+	if mo.MaxSize > 0 && !mo.fits(p) {
+		opts := p.Options
+		if mo.Shared != nil {
+			opts = mo.Shared.merged(p.Options)
+		}
+		fitted, o, err := mo.fit(p, opts)
+		if err != nil {
+			return nil, err
+		}
+		ov = fitted
+		if len(o) != len(opts) {
+			trimmed = o
+		}
+	}
 
-	var file [128]byte
-	copy(file[:], []byte(p.BootFile))
-	file[len(p.BootFile)] = 0
-	b.WriteBytes(file[:])
+	// A name filling the whole field is not NUL-terminated.
+	if ov != nil && ov.sname != nil {
+		b = append(b, ov.sname...)
+	} else {
+		b = appendField(b, p.ServerName, snameLen)
+	}
+	if ov != nil && ov.file != nil {
+		b = append(b, ov.file...)
+	} else {
+		b = appendField(b, p.BootFile, fileLen)
+	}
 
 	// The magic cookie.
-	b.WriteBytes(magicCookie[:])
+	b = append(b, magicCookie[:]...)
+
+	switch {
+	case ov != nil:
+		b = append(b, ov.options...)
+	case p.raw != nil && mo.Shared == nil && trimmed == nil && p.Options.encodedBy(p.raw):
+		b = append(b, p.raw...)
+	case trimmed != nil:
+		b = append(trimmed.appendOrdered(b, p.order), uint8(End))
+	case mo.Shared == nil:
+		b = append(p.Options.appendOrdered(b, p.order), uint8(End))
+	case mo.Shared.overlaps(p.Options) || p.Options[OptionRelayAgentInformation] != nil:
+		// The relay agent information option goes after the shared
+		// options.
+		b = append(mo.Shared.merged(p.Options).appendOrdered(b, p.order), uint8(End))
+	default:
+		b = p.Options.appendOrdered(b, p.order)
+		b = append(b, mo.Shared.data...)
+		b = append(b, uint8(End))
+	}
+
+	var min int
+	switch mo.Padding {
+	case PadNone:
+	case PadBOOTP:
+		min = bootpMinLen
+	case PadEthernet:
+		min = ethernetMinLen
+	default:
+		return nil, fmt.Errorf("unknown padding policy %d", mo.Padding)
+	}
+	// Pad is the zero byte.
+	for len(b)-start < min {
+		b = append(b, uint8(Pad))
+	}
+	return b, nil
+}
 
-	p.Options.Marshal(b)
-	// TODO pad to 272 bytes for really old crap.
-	return b.Data(), nil
+// fits returns whether p fits into mo.MaxSize without overloading the
+// sname and file fields.
+func (mo MarshalOptions) fits(p *Packet) bool {
+	n := p.Options.encodedLen()
+	if mo.Shared != nil {
+		if mo.Shared.overlaps(p.Options) {
+			n = mo.Shared.merged(p.Options).encodedLen()
+		} else {
+			n += len(mo.Shared.data)
+		}
+	}
+	return fixedLen+n+1 <= mo.MaxSize
+}
+
+// fit returns the encoding of o for p overloaded to fit into mo.MaxSize, or
+// nil if o fits without, after leaving out as few options of mo.Trim as
+// needed. It returns the options encoded too.
+func (mo MarshalOptions) fit(p *Packet, o Options) (*overloaded, Options, error) {
+	ov, err := overload(p, o, mo.MaxSize)
+	for _, code := range mo.Trim {
+		if err != ErrTooLarge {
+			break
+		}
+		if _, ok := o[code]; !ok {
+			continue
+		}
+		o = o.without(code)
+		ov, err = overload(p, o, mo.MaxSize)
+	}
+	return ov, o, err
 }
 
 // ParsePacket parses a DHCP4 packet from q.
@@ -152,63 +397,193 @@ func ParsePacket(q []byte) (*Packet, error) {
 	return &pkt, nil
 }
 
+// UnmarshalOptions configures how a Packet is read from binary.
+//
+// The zero value unmarshals a packet exactly like Packet.UnmarshalBinary.
+type UnmarshalOptions struct {
+	// Lenient keeps what can be read of malformed options rather than
+	// failing the whole packet: an option cut short by the end of the
+	// packet is kept with the data there is, and bytes after the End
+	// option are ignored. Validate then reports ErrTruncatedOption.
+	//
+	// The fixed header and the magic cookie must still be intact.
+	Lenient bool
+
+	// Reuse reuses the memory of the packet unmarshaled into, which
+	// saves allocating for every packet when a loop reads many packets
+	// into one: its options map, and the slices of its addresses and
+	// option values, are overwritten by the next packet. Copy what must
+	// be kept across packets.
+	Reuse bool
+}
+
 // UnmarshalBinary reads the packet from binary.
+//
+// Options given several times are concatenated in the order they appear, as
+// described in RFC 3396. Options carried in the sname and file fields, as
+// announced by the option overload option (RFC 2132, Section 9.3), are added
+// to the packet's options; ServerName and BootFile are then empty.
 func (p *Packet) UnmarshalBinary(q []byte) error {
-	b := uio.NewBigEndianBuffer(q)
-
-	p.Op = OpCode(b.Read8())
-	p.HType = b.Read8()
-	hlen := b.Read8()
-	p.Hops = b.Read8()
-	b.ReadBytes(p.TransactionID[:])
-	p.Secs = b.Read16()
+	return UnmarshalOptions{}.Unmarshal(p, q)
+}
 
-	flags := b.Read16()
-	if flags&flagBroadcast != 0 {
-		p.Broadcast = true
+// Unmarshal reads the packet p from binary according to uo.
+//
+// A packet without the magic cookie is read as a BOOTP message of RFC 951 if
+// it is at least 300 bytes long; its vendor area is kept in VendorArea.
+func (uo UnmarshalOptions) Unmarshal(p *Packet, q []byte) error {
+	if len(q) < fixedLen {
+		return fmt.Errorf("malformed DHCP packet: got %d bytes, want at least %d", len(q), fixedLen)
+	}
+	opts := q[fixedLen:]
+	p.VendorArea = nil
+	if cookie := q[minPacketLen:fixedLen]; !bytes.Equal(cookie, magicCookie[:]) {
+		if len(q) < bootpMinLen {
+			return fmt.Errorf("malformed DHCP packet: got magic cookie %v, want %v", cookie, magicCookie[:])
+		}
+		p.VendorArea = append([]byte(nil), q[minPacketLen:]...)
+		opts = nil
+	}
+	count, size := scanOptions(opts)
+
+	// One buffer for the four addresses, the hardware address, the
+	// option data, the option order and the options as read.
+	n := 4*net.IPv4len + chaddrLen + size + count + len(opts)
+	var buf []byte
+	if uo.Reuse && cap(p.buf) >= n {
+		buf = p.buf[:0]
+	} else {
+		buf = make([]byte, 0, n)
 	}
 
-	p.CIAddr = make(net.IP, net.IPv4len)
-	b.ReadBytes(p.CIAddr)
-	p.YIAddr = make(net.IP, net.IPv4len)
-	b.ReadBytes(p.YIAddr)
-	p.SIAddr = make(net.IP, net.IPv4len)
-	b.ReadBytes(p.SIAddr)
-	p.GIAddr = make(net.IP, net.IPv4len)
-	b.ReadBytes(p.GIAddr)
+	p.Op = OpCode(q[0])
+	p.HType = q[1]
+	hlen := q[2]
+	p.Hops = q[3]
+	copy(p.TransactionID[:], q[4:8])
+	p.Secs = binary.BigEndian.Uint16(q[8:10])
+	p.Broadcast = binary.BigEndian.Uint16(q[10:12])&flagBroadcast != 0
+
+	buf = append(buf, q[12:28]...)
+	p.CIAddr = net.IP(buf[0:4:4])
+	p.YIAddr = net.IP(buf[4:8:8])
+	p.SIAddr = net.IP(buf[8:12:12])
+	p.GIAddr = net.IP(buf[12:16:16])
 
 	if hlen > chaddrLen {
 		hlen = chaddrLen
 	}
 	// Always read 16 bytes, but only use hlen of them.
-	p.CHAddr = make(net.HardwareAddr, chaddrLen)
-	b.ReadBytes(p.CHAddr)
-	p.CHAddr = p.CHAddr[:hlen]
+	buf = append(buf, q[28:44]...)
+	p.CHAddr = net.HardwareAddr(buf[16 : 16+hlen : 16+hlen])
+
+	sname, file := q[44:108], q[108:minPacketLen]
+	p.ServerName = cString(p.ServerName, sname)
+	p.BootFile = cString(p.BootFile, file)
 
-	var sname [64]byte
-	b.ReadBytes(sname[:])
-	length := strings.Index(string(sname[:]), "\x00")
-	if length == -1 {
-		length = 64
+	if uo.Reuse && p.Options != nil {
+		for k := range p.Options {
+			delete(p.Options, k)
+		}
+	} else {
+		p.Options = make(Options, count)
+	}
+	p.missingEnd, p.truncated = false, false
+	var err error
+	if p.VendorArea == nil {
+		buf, err = decodeOptions(p.Options, opts, uo.Lenient, buf)
+	}
+	switch err {
+	case nil:
+	case ErrMissingEnd:
+		// Be lenient: plenty of implementations forget the End
+		// option. Validate reports it.
+		p.missingEnd = true
+	case ErrTruncatedOption:
+		p.truncated = true
+	default:
+		return err
 	}
-	p.ServerName = string(sname[:length])
 
-	var file [128]byte
-	b.ReadBytes(file[:])
-	length = strings.Index(string(file[:]), "\x00")
-	if length == -1 {
-		length = 128
+	start := len(buf)
+	walkOptions(opts, func(code OptionCode, _ []byte) {
+		if bytes.IndexByte(buf[start:], uint8(code)) < 0 {
+			buf = append(buf, uint8(code))
+		}
+	})
+	p.order = nil
+	if len(buf) > start {
+		p.order = buf[start:len(buf):len(buf)]
+	}
+	p.raw = nil
+	if p.VendorArea == nil && err == nil {
+		start = len(buf)
+		buf = append(buf, opts...)
+		p.raw = buf[start:len(buf):len(buf)]
 	}
-	p.BootFile = string(file[:length])
+	if uo.Reuse {
+		p.buf = buf
+	}
+	return p.unoverload(sname, file, uo.Lenient)
+}
 
-	var cookie [4]byte
-	b.ReadBytes(cookie[:])
-	if cookie != magicCookie {
-		return fmt.Errorf("malformed DHCP packet: got magic cookie %v, want %v", cookie[:], magicCookie[:])
+// OptionCodes returns the codes of the packet's options in the order
+// MarshalBinary writes them.
+func (p *Packet) OptionCodes() []OptionCode {
+	keys := p.Options.appendKeys(make([]int, 0, len(p.Options)), p.order)
+	codes := make([]OptionCode, 0, len(keys))
+	for _, k := range keys {
+		if c := OptionCode(k); c != Pad && c != End {
+			codes = append(codes, c)
+		}
 	}
+	return codes
+}
 
-	if err := p.Options.Unmarshal(b); err != nil {
-		return err
+// Clone returns a deep copy of p, which keeps the order of p's options.
+func (p *Packet) Clone() *Packet {
+	c := *p
+	c.CIAddr = cloneBytes(p.CIAddr)
+	c.YIAddr = cloneBytes(p.YIAddr)
+	c.SIAddr = cloneBytes(p.SIAddr)
+	c.GIAddr = cloneBytes(p.GIAddr)
+	c.CHAddr = cloneBytes(p.CHAddr)
+	c.VendorArea = cloneBytes(p.VendorArea)
+	c.Options = p.Options.Clone()
+	c.order = cloneBytes(p.order)
+	c.raw = cloneBytes(p.raw)
+	c.buf = nil
+	return &c
+}
+
+// cloneBytes returns a copy of b, or nil if b is nil.
+func cloneBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append(make([]byte, 0, len(b)), b...)
+}
+
+// cString returns the NUL-terminated string in b, or old if that is the
+// same, which saves allocating it again.
+func cString(old string, b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	if old == string(b) {
+		return old
+	}
+	return string(b)
+}
+
+// Validate reports problems with a packet that do not prevent it from being
+// parsed, such as options that were not terminated by an End option.
+func (p *Packet) Validate() error {
+	if p.truncated {
+		return ErrTruncatedOption
+	}
+	if p.missingEnd {
+		return ErrMissingEnd
 	}
-	return b.FinError()
+	return nil
 }
@@ -6,7 +6,9 @@ package dhcp4
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"reflect"
 	"testing"
@@ -95,6 +97,7 @@ func TestPacketUnmarshalBinary(t *testing.T) {
 				GIAddr:    net.IP{0, 0, 0, 0},
 				CHAddr:    net.HardwareAddr{},
 				Options:   Options{},
+				raw:       []byte{byte(End)},
 			},
 		},
 		{
@@ -122,6 +125,7 @@ func TestPacketUnmarshalBinary(t *testing.T) {
 				GIAddr:        net.IP{0, 0, 0, 0},
 				CHAddr:        net.HardwareAddr{0xfe, 0xab, 0x67},
 				Options:       Options{},
+				raw:           []byte{byte(End)},
 			},
 		},
 	} {
@@ -140,3 +144,468 @@ func TestPacketUnmarshalBinary(t *testing.T) {
 		})
 	}
 }
+
+func TestPacketMarshalPadding(t *testing.T) {
+	for _, tt := range []struct {
+		padding Padding
+		want    int
+	}{
+		{padding: PadNone, want: 241},
+		{padding: PadBOOTP, want: 300},
+		{padding: PadEthernet, want: 272},
+	} {
+		b, err := MarshalOptions{Padding: tt.padding}.Marshal(NewPacket(BootRequest))
+		if err != nil {
+			t.Fatalf("Marshal(padding %d) = %v", tt.padding, err)
+		}
+		if len(b) != tt.want {
+			t.Errorf("Marshal(padding %d) got length %d, want %d", tt.padding, len(b), tt.want)
+		}
+		if b[240] != byte(End) {
+			t.Errorf("Marshal(padding %d) got option byte %d, want End", tt.padding, b[240])
+		}
+
+		p, err := ParsePacket(b)
+		if err != nil {
+			t.Fatalf("ParsePacket(padding %d) = %v", tt.padding, err)
+		}
+		if err := p.Validate(); err != nil {
+			t.Errorf("Validate(padding %d) = %v, want nil", tt.padding, err)
+		}
+	}
+}
+
+func TestPacketUnmarshalMissingEnd(t *testing.T) {
+	b, err := NewPacket(BootRequest).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Replace End with an option that is not terminated.
+	b = append(b[:len(b)-1], 3, 1, 5)
+
+	p, err := ParsePacket(b)
+	if err != nil {
+		t.Fatalf("ParsePacket = %v, want nil", err)
+	}
+	if got := p.Options.Get(3); !bytes.Equal(got, []byte{5}) {
+		t.Errorf("option 3 = %v, want [5]", got)
+	}
+	if err := p.Validate(); err != ErrMissingEnd {
+		t.Errorf("Validate() = %v, want %v", err, ErrMissingEnd)
+	}
+	if !errors.Is(ErrMissingEnd, io.ErrUnexpectedEOF) {
+		t.Errorf("ErrMissingEnd does not match io.ErrUnexpectedEOF")
+	}
+}
+
+func TestPacketUnmarshalLenient(t *testing.T) {
+	b, err := NewPacket(BootRequest).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := b[:len(b)-1]
+
+	for i, tt := range []struct {
+		options  []byte
+		want     Options
+		validate error
+	}{
+		{
+			// Option 3 announces 4 bytes, but only 2 follow.
+			options:  []byte{1, 1, 9, 3, 4, 10, 0},
+			want:     Options{1: {9}, 3: {10, 0}},
+			validate: ErrTruncatedOption,
+		},
+		{
+			// Only the code of option 3 is left.
+			options:  []byte{1, 1, 9, 3},
+			want:     Options{1: {9}, 3: {}},
+			validate: ErrTruncatedOption,
+		},
+		{
+			// Garbage after End.
+			options: []byte{1, 1, 9, byte(End), 3, 4},
+			want:    Options{1: {9}},
+		},
+	} {
+		t.Run(fmt.Sprintf("Test %02d", i), func(t *testing.T) {
+			q := append(append([]byte(nil), header...), tt.options...)
+			if _, err := ParsePacket(q); err == nil {
+				t.Errorf("ParsePacket = nil, want error")
+			}
+
+			var p Packet
+			if err := (UnmarshalOptions{Lenient: true}).Unmarshal(&p, q); err != nil {
+				t.Fatalf("Unmarshal = %v, want nil", err)
+			}
+			if !reflect.DeepEqual(p.Options, tt.want) {
+				t.Errorf("options = %v, want %v", p.Options, tt.want)
+			}
+			if err := p.Validate(); err != tt.validate {
+				t.Errorf("Validate() = %v, want %v", err, tt.validate)
+			}
+		})
+	}
+}
+
+func TestPacketMarshalFullNames(t *testing.T) {
+	p := NewPacket(BootReply)
+	p.ServerName = string(bytes.Repeat([]byte{'s'}, 64))
+	p.BootFile = string(bytes.Repeat([]byte{'f'}, 128))
+	b, err := p.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary = %v", err)
+	}
+	got, err := ParsePacket(b)
+	if err != nil {
+		t.Fatalf("ParsePacket = %v", err)
+	}
+	if got.ServerName != p.ServerName || got.BootFile != p.BootFile {
+		t.Errorf("got names %q, %q, want %q, %q", got.ServerName, got.BootFile, p.ServerName, p.BootFile)
+	}
+}
+
+func TestPacketMarshalShared(t *testing.T) {
+	shared := EncodeOptions(Options{
+		OptionServerIdentifier: {192, 168, 0, 1},
+		OptionRouters:          {192, 168, 0, 254},
+	})
+
+	for _, tt := range []struct {
+		own  Options
+		want Options
+	}{
+		{
+			own: Options{OptionDHCPMessageType: {2}},
+			want: Options{
+				OptionDHCPMessageType:  {2},
+				OptionServerIdentifier: {192, 168, 0, 1},
+				OptionRouters:          {192, 168, 0, 254},
+			},
+		},
+		{
+			// The packet's own options win.
+			own: Options{OptionDHCPMessageType: {5}, OptionRouters: {10, 0, 0, 1}},
+			want: Options{
+				OptionDHCPMessageType:  {5},
+				OptionServerIdentifier: {192, 168, 0, 1},
+				OptionRouters:          {10, 0, 0, 1},
+			},
+		},
+	} {
+		p := NewPacket(BootReply)
+		p.Options = tt.own
+		b, err := MarshalOptions{Shared: shared}.Marshal(p)
+		if err != nil {
+			t.Fatalf("Marshal() = %v", err)
+		}
+		got, err := ParsePacket(b)
+		if err != nil {
+			t.Fatalf("ParsePacket() = %v", err)
+		}
+		if err := got.Validate(); err != nil {
+			t.Errorf("Validate() = %v", err)
+		}
+		if !reflect.DeepEqual(got.Options, tt.want) {
+			t.Errorf("Marshal(%v) with shared %v got options %v, want %v", tt.own, shared.Options(), got.Options, tt.want)
+		}
+	}
+}
+
+func TestPacketMarshalSharedRelayAgentInformationLast(t *testing.T) {
+	shared := EncodeOptions(Options{OptionServerIdentifier: {192, 168, 0, 1}})
+	p := NewPacket(BootReply)
+	p.Options = Options{
+		OptionDHCPMessageType:       {2},
+		OptionRelayAgentInformation: {1, 1, 7},
+	}
+	b, err := MarshalOptions{Shared: shared}.Marshal(p)
+	if err != nil {
+		t.Fatalf("Marshal() = %v", err)
+	}
+	want := []byte{82, 3, 1, 1, 7, 255}
+	if !bytes.HasSuffix(b, want) {
+		t.Errorf("Marshal() options end in %v, want %v", b[len(b)-len(want):], want)
+	}
+}
+
+func TestPacketRoundTripOrder(t *testing.T) {
+	p := NewPacket(BootRequest)
+	p.SetHardwareAddr(net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 1})
+	header, err := p.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary() = %v", err)
+	}
+	// Relay agent information amid unsorted and unknown options.
+	options := []byte{
+		53, 1, 3,
+		224, 3, 'a', 'b', 'c',
+		82, 3, 1, 1, 7,
+		12, 5, 'n', 'o', 'd', 'e', '0',
+		55, 3, 1, 3, 6,
+		255,
+	}
+	in := append(header[:fixedLen:fixedLen], options...)
+
+	got, err := ParsePacket(in)
+	if err != nil {
+		t.Fatalf("ParsePacket() = %v", err)
+	}
+	wantCodes := []OptionCode{53, 224, 82, 12, 55}
+	if codes := got.OptionCodes(); !reflect.DeepEqual(codes, wantCodes) {
+		t.Errorf("OptionCodes() = %v, want %v", codes, wantCodes)
+	}
+	out, err := got.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary() = %v", err)
+	}
+	if !bytes.Equal(out, in) {
+		t.Errorf("MarshalBinary() = %v, want %v", out[fixedLen:], options)
+	}
+
+	// Options added later follow in the order of Options.Marshal, and
+	// removed options are left out.
+	c := got.Clone()
+	c.Options[OptionRequestedIPAddress] = []byte{192, 168, 0, 10}
+	c.Options[OptionClientIdentifier] = []byte{1, 0, 0, 0x5e, 0, 0x53, 1}
+	delete(c.Options, OptionHostName)
+	c.Options[OptionDHCPMessageType][0] = 1
+	wantCodes = []OptionCode{53, 224, 82, 55, 50, 61}
+	if codes := c.OptionCodes(); !reflect.DeepEqual(codes, wantCodes) {
+		t.Errorf("OptionCodes() of changed clone = %v, want %v", codes, wantCodes)
+	}
+	b, err := c.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary() = %v", err)
+	}
+	want := []byte{
+		53, 1, 1,
+		224, 3, 'a', 'b', 'c',
+		82, 3, 1, 1, 7,
+		55, 3, 1, 3, 6,
+		50, 4, 192, 168, 0, 10,
+		61, 7, 1, 0, 0, 0x5e, 0, 0x53, 1,
+		255,
+	}
+	if !bytes.Equal(b[fixedLen:], want) {
+		t.Errorf("MarshalBinary() of changed clone = %v, want %v", b[fixedLen:], want)
+	}
+
+	// The clone shares no memory with the original.
+	if out2, err := got.MarshalBinary(); err != nil || !bytes.Equal(out2, in) {
+		t.Errorf("MarshalBinary() after changing clone = %v, %v, want %v", out2, err, in)
+	}
+}
+
+func TestPacketRoundTripEmptyOption(t *testing.T) {
+	p := NewPacket(BootRequest)
+	header, err := p.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary() = %v", err)
+	}
+	// An unknown option without data amid others.
+	options := []byte{53, 1, 1, 224, 0, 12, 1, 'a', 255}
+	in := append(header[:fixedLen:fixedLen], options...)
+
+	got, err := ParsePacket(in)
+	if err != nil {
+		t.Fatalf("ParsePacket() = %v", err)
+	}
+	if v, ok := got.Options[224]; !ok || len(v) != 0 {
+		t.Errorf("Options[224] = %v, %v, want empty", v, ok)
+	}
+	if v := View(in).Option(224); v == nil || len(v) != 0 {
+		t.Errorf("View.Option(224) = %v, want empty", v)
+	}
+	wantCodes := []OptionCode{53, 224, 12}
+	if codes := got.OptionCodes(); !reflect.DeepEqual(codes, wantCodes) {
+		t.Errorf("OptionCodes() = %v, want %v", codes, wantCodes)
+	}
+	out, err := got.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary() = %v", err)
+	}
+	if !bytes.Equal(out, in) {
+		t.Errorf("MarshalBinary() = %v, want %v", out[fixedLen:], options)
+	}
+}
+
+func TestPacketRoundTripRepeated(t *testing.T) {
+	p := NewPacket(BootRequest)
+	header, err := p.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary() = %v", err)
+	}
+	// A host name given twice, split by another option and Pad options,
+	// and padding after End.
+	options := []byte{
+		53, 1, 1,
+		12, 2, 'n', 'o',
+		0, 0,
+		55, 2, 1, 3,
+		12, 3, 'd', 'e', '0',
+		255,
+		0, 0, 0,
+	}
+	in := append(header[:fixedLen:fixedLen], options...)
+
+	got, err := ParsePacket(in)
+	if err != nil {
+		t.Fatalf("ParsePacket() = %v", err)
+	}
+	if name := got.Options.HostName(); name != "node0" {
+		t.Errorf("HostName() = %q, want node0", name)
+	}
+	out, err := got.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary() = %v", err)
+	}
+	if !bytes.Equal(out, in) {
+		t.Errorf("MarshalBinary() = %v, want %v", out[fixedLen:], options)
+	}
+
+	// Once changed, the options are encoded again.
+	got.Options[OptionParameterRequestList] = []byte{1, 3, 6}
+	out, err = got.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary() = %v", err)
+	}
+	want := []byte{
+		53, 1, 1,
+		12, 5, 'n', 'o', 'd', 'e', '0',
+		55, 3, 1, 3, 6,
+		255,
+	}
+	if !bytes.Equal(out[fixedLen:], want) {
+		t.Errorf("MarshalBinary() of changed packet = %v, want %v", out[fixedLen:], want)
+	}
+}
+
+func TestPacketLongOptions(t *testing.T) {
+	search := bytes.Repeat([]byte("\x07testbed\x07example\x03net\x00"), 30)
+	vendor := bytes.Repeat([]byte{1, 2, 3}, 100)
+	shared := EncodeOptions(Options{OptionDomainSearch: search})
+
+	for _, mo := range []MarshalOptions{{}, {Shared: shared}} {
+		p := NewPacket(BootReply)
+		p.Options = Options{OptionVendorSpecificInformation: vendor}
+		if mo.Shared == nil {
+			p.Options[OptionDomainSearch] = search
+		}
+		b, err := mo.Marshal(p)
+		if err != nil {
+			t.Fatalf("Marshal() = %v", err)
+		}
+		got, err := ParsePacket(b)
+		if err != nil {
+			t.Fatalf("ParsePacket() = %v", err)
+		}
+		if err := got.Validate(); err != nil {
+			t.Errorf("Validate() = %v", err)
+		}
+		if v := got.Options.Get(OptionDomainSearch); !bytes.Equal(v, search) {
+			t.Errorf("domain search of %d bytes came back as %d bytes", len(search), len(v))
+		}
+		if v := got.Options.Get(OptionVendorSpecificInformation); !bytes.Equal(v, vendor) {
+			t.Errorf("vendor information of %d bytes came back as %d bytes", len(vendor), len(v))
+		}
+	}
+}
+
+func BenchmarkPacketMarshal(b *testing.B) {
+	opts := Options{
+		OptionServerIdentifier:       {192, 168, 0, 1},
+		OptionRouters:                {192, 168, 0, 254},
+		OptionDomainNameServers:      {192, 168, 0, 53, 192, 168, 0, 54},
+		OptionDomainName:             []byte("testbed.example.net"),
+		OptionIPAddressLeaseTime:     {0, 0, 0x0e, 0x10},
+		OptionMaximumDHCPMessageSize: {0x05, 0xdc},
+	}
+	p := NewPacket(BootReply)
+
+	b.Run("options", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			p.Options = Options{OptionDHCPMessageType: {2}}
+			for k, v := range opts {
+				p.Options[k] = v
+			}
+			if _, err := p.MarshalBinary(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("append", func(b *testing.B) {
+		p.Options = Options{OptionDHCPMessageType: {2}}
+		for k, v := range opts {
+			p.Options[k] = v
+		}
+		buf := make([]byte, 0, 576)
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var err error
+			if buf, err = p.AppendBinary(buf[:0]); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("shared", func(b *testing.B) {
+		mo := MarshalOptions{Shared: EncodeOptions(opts)}
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			p.Options = Options{OptionDHCPMessageType: {2}}
+			if _, err := mo.Marshal(p); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkPacketUnmarshal(b *testing.B) {
+	p := NewPacket(BootRequest)
+	p.SetHardwareAddr(net.HardwareAddr{0, 0, 0x5e, 0, 0x53, 1})
+	p.Options = Options{
+		OptionDHCPMessageType:        {1},
+		OptionClientIdentifier:       {1, 0, 0, 0x5e, 0, 0x53, 1},
+		OptionParameterRequestList:   {1, 3, 6, 12, 15, 28, 42, 51, 54, 58, 59, 119, 121},
+		OptionMaximumDHCPMessageSize: {0x05, 0xdc},
+		OptionVendorClassIdentifier:  []byte("PXEClient:Arch:00007:UNDI:003016"),
+		OptionHostName:               []byte("node0"),
+		OptionUserClass:              []byte("iPXE"),
+	}
+	data, err := p.MarshalBinary()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.Run("packet", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var q Packet
+			if err := q.UnmarshalBinary(data); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("reuse", func(b *testing.B) {
+		var q Packet
+		uo := UnmarshalOptions{Reuse: true}
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if err := uo.Unmarshal(&q, data); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("view", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			v, err := NewView(data)
+			if err != nil {
+				b.Fatal(err)
+			}
+			v.MessageType()
+			v.HardwareAddr()
+		}
+	})
+}
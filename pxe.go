@@ -0,0 +1,155 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4
+
+import (
+	"fmt"
+)
+
+// Arch is a client system architecture type carried by
+// OptionClientSystemArchitecture, as defined by RFC 4578, Section 2.1 and
+// the IANA Processor Architecture Types registry.
+type Arch uint16
+
+// Client system architecture types. RFC 4578 swaps 7 and 9; the values here
+// are the corrected ones of the IANA registry, which clients send.
+const (
+	ArchX86BIOS       Arch = 0
+	ArchItanium       Arch = 2
+	ArchX86UEFI       Arch = 6
+	ArchX64UEFI       Arch = 7
+	ArchEBC           Arch = 9
+	ArchARM32UEFI     Arch = 10
+	ArchARM64UEFI     Arch = 11
+	ArchX86UEFIHTTP   Arch = 15
+	ArchX64UEFIHTTP   Arch = 16
+	ArchARM64UEFIHTTP Arch = 19
+	ArchRISCV64UEFI   Arch = 27
+)
+
+var archNames = map[Arch]string{
+	ArchX86BIOS:       "x86 BIOS",
+	ArchItanium:       "Itanium",
+	ArchX86UEFI:       "x86 UEFI",
+	ArchX64UEFI:       "x64 UEFI",
+	ArchEBC:           "EFI byte code",
+	ArchARM32UEFI:     "ARM 32-bit UEFI",
+	ArchARM64UEFI:     "ARM 64-bit UEFI",
+	ArchX86UEFIHTTP:   "x86 UEFI HTTP",
+	ArchX64UEFIHTTP:   "x64 UEFI HTTP",
+	ArchARM64UEFIHTTP: "ARM 64-bit UEFI HTTP",
+	ArchRISCV64UEFI:   "RISC-V 64-bit UEFI",
+}
+
+// String implements fmt.Stringer.
+func (a Arch) String() string {
+	if name, ok := archNames[a]; ok {
+		return name
+	}
+	return fmt.Sprintf("Arch(%d)", uint16(a))
+}
+
+// NetworkInterfaceID is the client network interface identifier carried by
+// OptionClientNetworkInterfaceIdentifier, as defined by RFC 4578, Section
+// 2.2.
+type NetworkInterfaceID struct {
+	// Type is the interface type. 1, NetworkInterfaceUNDI, is the only
+	// one defined.
+	Type uint8
+
+	// Major and Minor are the interface version, e.g. 2 and 1 for UNDI
+	// version 2.1.
+	Major, Minor uint8
+}
+
+// NetworkInterfaceUNDI is the network interface type of the Universal
+// Network Device Interface of PXE.
+const NetworkInterfaceUNDI uint8 = 1
+
+// String implements fmt.Stringer.
+func (id NetworkInterfaceID) String() string {
+	if id.Type == NetworkInterfaceUNDI {
+		return fmt.Sprintf("UNDI %d.%d", id.Major, id.Minor)
+	}
+	return fmt.Sprintf("type %d %d.%d", id.Type, id.Major, id.Minor)
+}
+
+// UUID is the client machine identifier carried by
+// OptionClientMachineIdentifier, as defined by RFC 4578, Section 2.3: a
+// 16-byte UUID, usually the SMBIOS system UUID.
+type UUID [16]byte
+
+// String returns the UUID in the usual hyphenated hex form.
+func (u UUID) String() string {
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16])
+}
+
+// machineIDTypeUUID is the only client machine identifier type.
+const machineIDTypeUUID = 0
+
+// ClientSystemArchitectures returns the client system architectures, in the
+// client's order of preference.
+//
+// It returns nil if the option is not present or malformed. The option is
+// defined by RFC 4578, Section 2.1.
+func (o Options) ClientSystemArchitectures() []Arch {
+	us := o.getUint16s(OptionClientSystemArchitecture)
+	if us == nil {
+		return nil
+	}
+	archs := make([]Arch, len(us))
+	for i, u := range us {
+		archs[i] = Arch(u)
+	}
+	return archs
+}
+
+// SetClientSystemArchitectures sets the client system architectures.
+//
+// An empty value removes the option.
+func (o Options) SetClientSystemArchitectures(v []Arch) {
+	us := make([]uint16, len(v))
+	for i, a := range v {
+		us[i] = uint16(a)
+	}
+	o.setUint16s(OptionClientSystemArchitecture, us)
+}
+
+// ClientNetworkInterfaceID returns the client network interface identifier
+// and whether it is present.
+//
+// It returns false if the option is not present or malformed. The option is
+// defined by RFC 4578, Section 2.2.
+func (o Options) ClientNetworkInterfaceID() (NetworkInterfaceID, bool) {
+	v := o[OptionClientNetworkInterfaceIdentifier]
+	if len(v) != 3 {
+		return NetworkInterfaceID{}, false
+	}
+	return NetworkInterfaceID{Type: v[0], Major: v[1], Minor: v[2]}, true
+}
+
+// SetClientNetworkInterfaceID sets the client network interface identifier.
+func (o Options) SetClientNetworkInterfaceID(v NetworkInterfaceID) {
+	o.setBytes(OptionClientNetworkInterfaceIdentifier, []byte{v.Type, v.Major, v.Minor})
+}
+
+// ClientMachineID returns the client machine UUID and whether it is present.
+//
+// It returns false if the option is not present or malformed. The option is
+// defined by RFC 4578, Section 2.3.
+func (o Options) ClientMachineID() (UUID, bool) {
+	var u UUID
+	v := o[OptionClientMachineIdentifier]
+	if len(v) != 1+len(u) || v[0] != machineIDTypeUUID {
+		return u, false
+	}
+	copy(u[:], v[1:])
+	return u, true
+}
+
+// SetClientMachineID sets the client machine UUID.
+func (o Options) SetClientMachineID(v UUID) {
+	o.setBytes(OptionClientMachineIdentifier, append([]byte{machineIDTypeUUID}, v[:]...))
+}
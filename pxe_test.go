@@ -0,0 +1,73 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPXEOptions(t *testing.T) {
+	uuid := UUID{0x4c, 0x4c, 0x45, 0x44, 0, 0x32, 0x10, 0x80, 0x80, 0x36, 0xb4, 0xc0, 0x4f, 0x4e, 0x4d, 0x31}
+	o := make(Options)
+	o.SetClientSystemArchitectures([]Arch{ArchX64UEFI, ArchX86BIOS})
+	o.SetClientNetworkInterfaceID(NetworkInterfaceID{Type: NetworkInterfaceUNDI, Major: 3, Minor: 16})
+	o.SetClientMachineID(uuid)
+
+	want := Options{
+		OptionClientSystemArchitecture:         {0, 7, 0, 0},
+		OptionClientNetworkInterfaceIdentifier: {1, 3, 16},
+		OptionClientMachineIdentifier:          append([]byte{0}, uuid[:]...),
+	}
+	if !reflect.DeepEqual(o, want) {
+		t.Fatalf("setters set %v, want %v", o, want)
+	}
+
+	if got := o.ClientSystemArchitectures(); !reflect.DeepEqual(got, []Arch{ArchX64UEFI, ArchX86BIOS}) {
+		t.Errorf("ClientSystemArchitectures() = %v, want [x64 UEFI x86 BIOS]", got)
+	}
+	if got, ok := o.ClientNetworkInterfaceID(); !ok || got.String() != "UNDI 3.16" {
+		t.Errorf("ClientNetworkInterfaceID() = %v, %t; want UNDI 3.16", got, ok)
+	}
+	if got, ok := o.ClientMachineID(); !ok || got.String() != "4c4c4544-0032-1080-8036-b4c04f4e4d31" {
+		t.Errorf("ClientMachineID() = %v, %t; want 4c4c4544-0032-1080-8036-b4c04f4e4d31", got, ok)
+	}
+
+	o.SetClientSystemArchitectures(nil)
+	if _, ok := o[OptionClientSystemArchitecture]; ok {
+		t.Errorf("SetClientSystemArchitectures(nil) did not remove the option")
+	}
+}
+
+func TestPXEOptionsMalformed(t *testing.T) {
+	o := Options{
+		OptionClientSystemArchitecture:         {0, 7, 0},
+		OptionClientNetworkInterfaceIdentifier: {1, 2},
+		// Machine identifier type 1 is not defined.
+		OptionClientMachineIdentifier: append([]byte{1}, make([]byte, 16)...),
+	}
+	if got := o.ClientSystemArchitectures(); got != nil {
+		t.Errorf("ClientSystemArchitectures() = %v, want nil", got)
+	}
+	if got, ok := o.ClientNetworkInterfaceID(); ok {
+		t.Errorf("ClientNetworkInterfaceID() = %v, want not present", got)
+	}
+	if got, ok := o.ClientMachineID(); ok {
+		t.Errorf("ClientMachineID() = %v, want not present", got)
+	}
+}
+
+func TestArchString(t *testing.T) {
+	for a, want := range map[Arch]string{
+		ArchX86BIOS:     "x86 BIOS",
+		ArchARM64UEFI:   "ARM 64-bit UEFI",
+		ArchRISCV64UEFI: "RISC-V 64-bit UEFI",
+		0x1234:          "Arch(4660)",
+	} {
+		if got := a.String(); got != want {
+			t.Errorf("Arch(%d).String() = %q, want %q", uint16(a), got, want)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4
+
+// RapidCommit returns whether the rapid commit option is present: in a
+// DHCPDISCOVER, the client accepts a DHCPACK right away; in a DHCPACK, the
+// server committed the lease without a DHCPREQUEST.
+//
+// The option is defined by RFC 4039.
+func (o Options) RapidCommit() bool {
+	_, ok := o[OptionRapidCommit]
+	return ok
+}
+
+// SetRapidCommit adds the rapid commit option, or removes it if v is false.
+func (o Options) SetRapidCommit(v bool) {
+	if v {
+		o[OptionRapidCommit] = []byte{}
+	} else {
+		delete(o, OptionRapidCommit)
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4
+
+import (
+	"bytes"
+	"net"
+	"testing"
+)
+
+func TestRapidCommit(t *testing.T) {
+	p := NewPacket(BootRequest)
+	p.SetHardwareAddr(net.HardwareAddr{2, 0, 0, 0, 0, 1})
+	p.Options.SetMessageType(DHCPDiscover)
+	p.Options.SetRapidCommit(true)
+	b, err := p.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(b[fixedLen:], []byte{uint8(OptionRapidCommit), 0}) {
+		t.Errorf("MarshalBinary() = %v, want rapid commit option without data", b[fixedLen:])
+	}
+
+	got, err := ParsePacket(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Options.RapidCommit() {
+		t.Errorf("RapidCommit() of parsed packet = false, want true")
+	}
+	if v := View(b).Option(OptionRapidCommit); v == nil {
+		t.Errorf("View.Option(OptionRapidCommit) = nil, want empty")
+	}
+	if fs := Lint(got); len(fs) != 1 || fs[0].Option != OptionParameterRequestList {
+		t.Errorf("Lint(DHCPDISCOVER) = %v, want only the missing parameter request list", fs)
+	}
+
+	got.Options.SetMessageType(DHCPRequest)
+	got.Options.SetRequestedIPAddress(net.IP{192, 168, 0, 10})
+	if fs := Lint(got); len(fs) == 0 || fs[0].Option != OptionRapidCommit {
+		t.Errorf("Lint(DHCPREQUEST) = %v, want rapid commit finding", fs)
+	}
+
+	got.Options.SetRapidCommit(false)
+	if got.Options.RapidCommit() {
+		t.Errorf("RapidCommit() after SetRapidCommit(false) = true, want false")
+	}
+
+	// Other options of length zero are written the same way.
+	o := Options{OptionHostName: {}}
+	if b, want := o.appendTo(nil), []byte{uint8(OptionHostName), 0}; !bytes.Equal(b, want) {
+		t.Errorf("appendTo(empty host name) = %v, want %v", b, want)
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4
+
+import (
+	"net"
+)
+
+// MaxHops is the number of relay agents a request may pass through before
+// it is discarded, as recommended by RFC 1542, Section 4.1.1.
+const MaxHops = 16
+
+// RelayRequest prepares request for forwarding to a server by the relay
+// agent with address giaddr on the client's link, following RFC 1542,
+// Section 4.1.1: it increments the hop count and sets giaddr, unless an
+// earlier relay agent already did. If info is not nil and the request does
+// not carry relay agent information yet, info is added (RFC 3046, Section
+// 2.1).
+//
+// RelayRequest returns ErrHopLimit and leaves request unchanged if the
+// request must be discarded.
+func RelayRequest(request *Packet, giaddr net.IP, info *RelayAgentInfo) error {
+	if request.Hops >= MaxHops {
+		return ErrHopLimit
+	}
+	request.Hops++
+	if request.GIAddr == nil || request.GIAddr.IsUnspecified() {
+		request.GIAddr = giaddr
+		if info != nil && request.Options.Get(OptionRelayAgentInformation) == nil {
+			request.Options.SetRelayAgentInfo(info)
+		}
+	}
+	return nil
+}
+
+// RelayReply prepares reply, relayed by a server to the relay agent in its
+// giaddr, for delivery to the client and returns where to send it, following
+// RFC 1542, Section 4.1.2: the relay agent information the server echoed is
+// removed (RFC 3046, Section 2.1), and the reply is sent to the client's
+// address if it has one and broadcast otherwise.
+//
+// Replies to clients without an address that did not ask for broadcast
+// should be unicast to the hardware address and yiaddr. That needs the ARP
+// cache or a raw socket, so they are broadcast as well.
+func RelayReply(reply *Packet) *net.UDPAddr {
+	delete(reply.Options, OptionRelayAgentInformation)
+	if reply.Options.MessageType() != DHCPNAK && reply.CIAddr != nil && !reply.CIAddr.IsUnspecified() {
+		return &net.UDPAddr{IP: reply.CIAddr, Port: 68}
+	}
+	return &net.UDPAddr{IP: net.IPv4bcast, Port: 68}
+}
@@ -0,0 +1,78 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestRelayRequest(t *testing.T) {
+	giaddr := net.IP{10, 0, 1, 1}
+	info := &RelayAgentInfo{CircuitID: []byte("eth1")}
+	for _, tt := range []struct {
+		desc       string
+		hops       uint8
+		giaddr     net.IP
+		info       *RelayAgentInfo
+		want       error
+		wantHops   uint8
+		wantGIAddr net.IP
+		wantInfo   *RelayAgentInfo
+	}{
+		{desc: "from the client", info: info, wantHops: 1, wantGIAddr: giaddr, wantInfo: info},
+		{desc: "without information", wantHops: 1, wantGIAddr: giaddr},
+		{desc: "from another relay", hops: 2, giaddr: net.IP{10, 0, 2, 1}, info: info, wantHops: 3, wantGIAddr: net.IP{10, 0, 2, 1}},
+		{desc: "last hop", hops: MaxHops - 1, info: info, wantHops: MaxHops, wantGIAddr: giaddr, wantInfo: info},
+		{desc: "too many hops", hops: MaxHops, info: info, want: ErrHopLimit, wantHops: MaxHops},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			p := NewPacket(BootRequest)
+			p.Options.SetMessageType(DHCPDiscover)
+			p.Hops = tt.hops
+			p.GIAddr = tt.giaddr
+			if err := RelayRequest(p, giaddr, tt.info); err != tt.want {
+				t.Fatalf("RelayRequest = %v, want %v", err, tt.want)
+			}
+			if p.Hops != tt.wantHops {
+				t.Errorf("hops = %d, want %d", p.Hops, tt.wantHops)
+			}
+			if !p.GIAddr.Equal(tt.wantGIAddr) {
+				t.Errorf("giaddr = %v, want %v", p.GIAddr, tt.wantGIAddr)
+			}
+			if got := p.Options.RelayAgentInfo(); !reflect.DeepEqual(got, tt.wantInfo) {
+				t.Errorf("relay agent information = %+v, want %+v", got, tt.wantInfo)
+			}
+		})
+	}
+}
+
+func TestRelayReply(t *testing.T) {
+	bcast := &net.UDPAddr{IP: net.IPv4bcast, Port: 68}
+	for _, tt := range []struct {
+		desc   string
+		typ    MessageType
+		ciaddr net.IP
+		want   *net.UDPAddr
+	}{
+		{desc: "offer", typ: DHCPOffer, want: bcast},
+		{desc: "renewal", typ: DHCPACK, ciaddr: net.IP{10, 0, 1, 5}, want: &net.UDPAddr{IP: net.IP{10, 0, 1, 5}, Port: 68}},
+		{desc: "NAK", typ: DHCPNAK, ciaddr: net.IP{10, 0, 1, 5}, want: bcast},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			p := NewPacket(BootReply)
+			p.Options.SetMessageType(tt.typ)
+			p.Options.SetRelayAgentInfo(&RelayAgentInfo{CircuitID: []byte("eth1")})
+			p.CIAddr = tt.ciaddr
+			if got := RelayReply(p); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("RelayReply = %v, want %v", got, tt.want)
+			}
+			if p.Options.Get(OptionRelayAgentInformation) != nil {
+				t.Errorf("relay agent information not removed")
+			}
+		})
+	}
+}
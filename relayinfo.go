@@ -0,0 +1,218 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+)
+
+// Relay agent information sub-option codes.
+const (
+	// RelayCircuitID and RelayRemoteID are defined by RFC 3046, Section
+	// 3.
+	RelayCircuitID uint8 = 1
+	RelayRemoteID  uint8 = 2
+
+	// RelayLinkSelection is defined by RFC 3527.
+	RelayLinkSelection uint8 = 5
+
+	// RelayVSS is the Virtual Subnet Selection sub-option defined by RFC
+	// 6607.
+	RelayVSS uint8 = 151
+)
+
+// VSS types, see VSS.
+const (
+	// VSSNVT is a VPN identifier in NVT ASCII.
+	VSSNVT uint8 = 0
+
+	// VSSVPNID is a 7-byte VPN-ID as defined by RFC 2685.
+	VSSVPNID uint8 = 1
+
+	// VSSGlobal is the global, default VPN. It carries no information.
+	VSSGlobal uint8 = 255
+)
+
+// VSS is a virtual subnet selector, the value of the RelayVSS sub-option
+// as defined by RFC 6607, Section 3.1. It names the VPN the client is on.
+type VSS struct {
+	// Type is VSSNVT, VSSVPNID or VSSGlobal.
+	Type uint8
+
+	// Info is the VPN identifier, of the format given by Type.
+	Info []byte
+}
+
+// String implements fmt.Stringer.
+func (v VSS) String() string {
+	switch v.Type {
+	case VSSNVT:
+		return fmt.Sprintf("VPN %q", v.Info)
+	case VSSVPNID:
+		if len(v.Info) == 7 {
+			return fmt.Sprintf("VPN-ID %x:%x", v.Info[:3], v.Info[3:])
+		}
+	case VSSGlobal:
+		return "global VPN"
+	}
+	return fmt.Sprintf("VSS type %d %x", v.Type, v.Info)
+}
+
+func parseVSS(b []byte) (*VSS, error) {
+	if len(b) < 1 {
+		return nil, errors.New("empty virtual subnet selector")
+	}
+	v := &VSS{Type: b[0], Info: b[1:]}
+	switch {
+	case v.Type == VSSVPNID && len(v.Info) != 7:
+		return nil, fmt.Errorf("VPN-ID of %d bytes, want 7", len(v.Info))
+	case v.Type == VSSGlobal && len(v.Info) != 0:
+		return nil, errors.New("global VPN selector with information")
+	}
+	return v, nil
+}
+
+// RelayAgentInfo is the relay agent information inserted by relay agents
+// into requests they forward, as carried by OptionRelayAgentInformation and
+// defined by RFC 3046.
+type RelayAgentInfo struct {
+	// CircuitID identifies the circuit the request came in on, e.g. a
+	// switch port.
+	CircuitID []byte
+
+	// RemoteID identifies the remote end of the circuit, e.g. a modem.
+	RemoteID []byte
+
+	// LinkSelection is the subnet the client is on, if it differs from the
+	// relay's address in giaddr.
+	LinkSelection net.IP
+
+	// VSS is the VPN the client is on, or nil.
+	VSS *VSS
+
+	// Other are the sub-options not covered above, by code.
+	Other map[uint8][]byte
+}
+
+// ParseRelayAgentInfo decodes the relay agent information in b, the value
+// of OptionRelayAgentInformation.
+//
+// Sub-options are encoded like options, as their code, length and value,
+// but without pad and end, see RFC 3046, Section 2.0.
+func ParseRelayAgentInfo(b []byte) (*RelayAgentInfo, error) {
+	r := &RelayAgentInfo{}
+	seen := make(map[uint8]bool)
+	for len(b) > 0 {
+		if len(b) < 2 || len(b) < 2+int(b[1]) {
+			return nil, fmt.Errorf("sub-option %d truncated", b[0])
+		}
+		code, v := b[0], append([]byte(nil), b[2:2+int(b[1])]...)
+		b = b[2+len(v):]
+		if seen[code] {
+			return nil, fmt.Errorf("sub-option %d repeated", code)
+		}
+		seen[code] = true
+
+		switch code {
+		case RelayCircuitID:
+			r.CircuitID = v
+		case RelayRemoteID:
+			r.RemoteID = v
+		case RelayLinkSelection:
+			if len(v) != net.IPv4len {
+				return nil, fmt.Errorf("link selection of %d bytes, want 4", len(v))
+			}
+			r.LinkSelection = net.IP(v)
+		case RelayVSS:
+			vss, err := parseVSS(v)
+			if err != nil {
+				return nil, err
+			}
+			r.VSS = vss
+		default:
+			if r.Other == nil {
+				r.Other = make(map[uint8][]byte)
+			}
+			r.Other[code] = v
+		}
+	}
+	return r, nil
+}
+
+// MarshalBinary encodes r as the value of OptionRelayAgentInformation, with
+// the sub-options sorted by code.
+//
+// Values must be at most 255 bytes long.
+func (r *RelayAgentInfo) MarshalBinary() ([]byte, error) {
+	sub := make(map[uint8][]byte, len(r.Other)+4)
+	for code, v := range r.Other {
+		sub[code] = v
+	}
+	if r.CircuitID != nil {
+		sub[RelayCircuitID] = r.CircuitID
+	}
+	if r.RemoteID != nil {
+		sub[RelayRemoteID] = r.RemoteID
+	}
+	if r.LinkSelection != nil {
+		ip := r.LinkSelection.To4()
+		if ip == nil {
+			return nil, fmt.Errorf("link selection %v is not an IPv4 address", r.LinkSelection)
+		}
+		sub[RelayLinkSelection] = ip
+	}
+	if r.VSS != nil {
+		sub[RelayVSS] = append([]byte{r.VSS.Type}, r.VSS.Info...)
+	}
+
+	codes := make([]int, 0, len(sub))
+	for code := range sub {
+		codes = append(codes, int(code))
+	}
+	sort.Ints(codes)
+
+	var b []byte
+	for _, code := range codes {
+		v := sub[uint8(code)]
+		if len(v) > math.MaxUint8 {
+			return nil, fmt.Errorf("sub-option %d: value of %d bytes is longer than 255 bytes", code, len(v))
+		}
+		b = append(b, uint8(code), uint8(len(v)))
+		b = append(b, v...)
+	}
+	return b, nil
+}
+
+// RelayAgentInfo returns the relay agent information.
+//
+// It returns nil if the option is not present or malformed. The option is
+// defined by RFC 3046.
+func (o Options) RelayAgentInfo() *RelayAgentInfo {
+	v := o.Get(OptionRelayAgentInformation)
+	if v == nil {
+		return nil
+	}
+	r, err := ParseRelayAgentInfo(v)
+	if err != nil {
+		return nil
+	}
+	return r
+}
+
+// SetRelayAgentInfo sets the relay agent information. Only relay agents
+// should set it; servers echo it, see RFC 3046, Section 2.2.
+//
+// A nil or invalid value removes the option.
+func (o Options) SetRelayAgentInfo(v *RelayAgentInfo) {
+	var b []byte
+	if v != nil {
+		b, _ = v.MarshalBinary()
+	}
+	o.setBytes(OptionRelayAgentInformation, b)
+}
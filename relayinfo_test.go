@@ -0,0 +1,89 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestRelayAgentInfo(t *testing.T) {
+	for _, tt := range []struct {
+		desc string
+		info *RelayAgentInfo
+		wire []byte
+	}{
+		{
+			desc: "circuit and remote ID",
+			info: &RelayAgentInfo{CircuitID: []byte("eth0/1"), RemoteID: []byte{0, 0, 0x5e, 0, 0x53, 1}},
+			wire: []byte("\x01\x06eth0/1\x02\x06\x00\x00\x5e\x00\x53\x01"),
+		},
+		{
+			desc: "link selection",
+			info: &RelayAgentInfo{CircuitID: []byte{1}, LinkSelection: net.IP{10, 0, 1, 0}},
+			wire: []byte{1, 1, 1, 5, 4, 10, 0, 1, 0},
+		},
+		{
+			desc: "VPN-ID",
+			info: &RelayAgentInfo{VSS: &VSS{Type: VSSVPNID, Info: []byte{0, 0, 0x5e, 0, 0, 0, 7}}},
+			wire: []byte{151, 8, 1, 0, 0, 0x5e, 0, 0, 0, 7},
+		},
+		{
+			desc: "global VPN",
+			info: &RelayAgentInfo{VSS: &VSS{Type: VSSGlobal, Info: []byte{}}},
+			wire: []byte{151, 1, 255},
+		},
+		{
+			desc: "unknown sub-option sorted by code",
+			info: &RelayAgentInfo{RemoteID: []byte("r"), Other: map[uint8][]byte{9: {0, 0, 0, 9}}},
+			wire: []byte("\x02\x01r\x09\x04\x00\x00\x00\x09"),
+		},
+	} {
+		got, err := tt.info.MarshalBinary()
+		if err != nil || !bytes.Equal(got, tt.wire) {
+			t.Errorf("%s: MarshalBinary() = %v, %v; want %v", tt.desc, got, err, tt.wire)
+		}
+		info, err := ParseRelayAgentInfo(tt.wire)
+		if err != nil || !reflect.DeepEqual(info, tt.info) {
+			t.Errorf("%s: ParseRelayAgentInfo(%v) = %+v, %v; want %+v", tt.desc, tt.wire, info, err, tt.info)
+		}
+	}
+}
+
+func TestParseRelayAgentInfoErrors(t *testing.T) {
+	for _, b := range [][]byte{
+		{1, 3, 'a'},
+		{1},
+		{1, 1, 'a', 1, 1, 'b'},
+		{5, 3, 10, 0, 1},
+		{151, 0},
+		{151, 3, 1, 0, 0},
+		{151, 2, 255, 0},
+	} {
+		if info, err := ParseRelayAgentInfo(b); err == nil {
+			t.Errorf("ParseRelayAgentInfo(%v) = %+v, want error", b, info)
+		}
+	}
+}
+
+func TestOptionsRelayAgentInfo(t *testing.T) {
+	o := make(Options)
+	if info := o.RelayAgentInfo(); info != nil {
+		t.Errorf("RelayAgentInfo() of empty options = %+v, want nil", info)
+	}
+
+	want := &RelayAgentInfo{CircuitID: []byte("port 7"), VSS: &VSS{Type: VSSNVT, Info: []byte("lab")}}
+	o.SetRelayAgentInfo(want)
+	if got := o.RelayAgentInfo(); !reflect.DeepEqual(got, want) {
+		t.Errorf("RelayAgentInfo() = %+v, want %+v", got, want)
+	}
+
+	o.SetRelayAgentInfo(nil)
+	if _, ok := o[OptionRelayAgentInformation]; ok {
+		t.Errorf("SetRelayAgentInfo(nil) kept the option")
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4
+
+import (
+	"fmt"
+	"net"
+)
+
+// Route is a classless static route as carried by
+// OptionClasslessStaticRoute.
+type Route struct {
+	// Dest is the destination network.
+	Dest *net.IPNet
+
+	// Router is the next hop. It is 0.0.0.0 for destinations on the
+	// client's link.
+	Router net.IP
+}
+
+// String implements fmt.Stringer.
+func (r Route) String() string {
+	return fmt.Sprintf("%v via %v", r.Dest, r.Router)
+}
+
+// ParseClasslessRoutes decodes the classless static routes in b, the value of
+// OptionClasslessStaticRoute as defined by RFC 3442.
+//
+// Each route is encoded as the destination prefix length, the significant
+// octets of the destination, and the router. Bits of the destination beyond
+// the prefix length are cleared.
+func ParseClasslessRoutes(b []byte) ([]Route, error) {
+	var routes []Route
+	for len(b) > 0 {
+		width := int(b[0])
+		if width > 32 {
+			return nil, fmt.Errorf("classless route with prefix length %d", width)
+		}
+		significant := (width + 7) / 8
+		if len(b) < 1+significant+net.IPv4len {
+			return nil, fmt.Errorf("classless route truncated after %d bytes", len(b))
+		}
+
+		dest := make(net.IP, net.IPv4len)
+		copy(dest, b[1:1+significant])
+		mask := net.CIDRMask(width, 32)
+		router := make(net.IP, net.IPv4len)
+		copy(router, b[1+significant:])
+		routes = append(routes, Route{
+			Dest:   &net.IPNet{IP: dest.Mask(mask), Mask: mask},
+			Router: router,
+		})
+		b = b[1+significant+net.IPv4len:]
+	}
+	return routes, nil
+}
+
+// MarshalClasslessRoutes encodes routes as the value of
+// OptionClasslessStaticRoute, see ParseClasslessRoutes.
+//
+// Routes without an IPv4 destination, a canonical IPv4 mask or an IPv4
+// router are left out.
+func MarshalClasslessRoutes(routes []Route) []byte {
+	var b []byte
+	for _, r := range routes {
+		if r.Dest == nil {
+			continue
+		}
+		dest, router := r.Dest.IP.To4(), r.Router.To4()
+		mask := r.Dest.Mask
+		if len(mask) == net.IPv6len {
+			mask = mask[12:]
+		}
+		width, bits := mask.Size()
+		if dest == nil || router == nil || bits != 32 {
+			continue
+		}
+		b = append(b, uint8(width))
+		b = append(b, dest.Mask(mask)[:(width+7)/8]...)
+		b = append(b, router...)
+	}
+	return b
+}
+
+// ClasslessStaticRoutes returns the classless static routes.
+//
+// It returns nil if the option is not present or malformed. The option is
+// defined by RFC 3442; clients receiving it ignore OptionRouters and
+// OptionStaticRoute.
+func (o Options) ClasslessStaticRoutes() []Route {
+	routes, err := ParseClasslessRoutes(o[OptionClasslessStaticRoute])
+	if err != nil {
+		return nil
+	}
+	return routes
+}
+
+// SetClasslessStaticRoutes sets the classless static routes.
+//
+// An empty value removes the option. Include a route to 0.0.0.0/0 for the
+// default route, as clients ignore OptionRouters.
+func (o Options) SetClasslessStaticRoutes(v []Route) {
+	o.setBytes(OptionClasslessStaticRoute, MarshalClasslessRoutes(v))
+}
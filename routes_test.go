@@ -0,0 +1,91 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func mustRoute(t *testing.T, cidr string, router net.IP) Route {
+	_, dest, err := net.ParseCIDR(cidr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Route{Dest: dest, Router: router}
+}
+
+func TestClasslessRoutes(t *testing.T) {
+	gw := net.IP{192, 168, 0, 1}
+	for _, tt := range []struct {
+		desc  string
+		route Route
+		wire  []byte
+	}{
+		// The examples of RFC 3442, Section 3.
+		{"default", mustRoute(t, "0.0.0.0/0", gw), []byte{0, 192, 168, 0, 1}},
+		{"/8", mustRoute(t, "10.0.0.0/8", gw), []byte{8, 10, 192, 168, 0, 1}},
+		{"/9", mustRoute(t, "10.0.0.0/9", gw), []byte{9, 10, 0, 192, 168, 0, 1}},
+		{"/24", mustRoute(t, "10.17.0.0/24", gw), []byte{24, 10, 17, 0, 192, 168, 0, 1}},
+		{"/25", mustRoute(t, "10.229.0.128/25", gw), []byte{25, 10, 229, 0, 128, 192, 168, 0, 1}},
+		{"/32", mustRoute(t, "10.27.129.1/32", gw), []byte{32, 10, 27, 129, 1, 192, 168, 0, 1}},
+		{"on-link", mustRoute(t, "172.16.0.0/12", net.IPv4zero.To4()), []byte{12, 172, 16, 0, 0, 0, 0}},
+	} {
+		if got := MarshalClasslessRoutes([]Route{tt.route}); !bytes.Equal(got, tt.wire) {
+			t.Errorf("%s: MarshalClasslessRoutes(%v) = %v, want %v", tt.desc, tt.route, got, tt.wire)
+		}
+		got, err := ParseClasslessRoutes(tt.wire)
+		if err != nil || len(got) != 1 || got[0].String() != tt.route.String() {
+			t.Errorf("%s: ParseClasslessRoutes(%v) = %v, %v; want %v", tt.desc, tt.wire, got, err, tt.route)
+		}
+	}
+}
+
+func TestParseClasslessRoutesMasksDest(t *testing.T) {
+	// Bits beyond the prefix length are set on the wire.
+	got, err := ParseClasslessRoutes([]byte{9, 10, 255, 192, 168, 0, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dest := got[0].Dest.String(); dest != "10.128.0.0/9" {
+		t.Errorf("destination %v, want 10.128.0.0/9", dest)
+	}
+}
+
+func TestParseClasslessRoutesMalformed(t *testing.T) {
+	for _, b := range [][]byte{
+		{33, 10, 0, 0, 0, 0, 192, 168, 0, 1},
+		{24, 10, 17, 0, 192, 168, 0},
+		{24, 10, 17},
+		{0, 192, 168, 0, 1, 8},
+	} {
+		if routes, err := ParseClasslessRoutes(b); err == nil {
+			t.Errorf("ParseClasslessRoutes(%v) = %v, want error", b, routes)
+		}
+	}
+}
+
+func TestClasslessStaticRoutesOption(t *testing.T) {
+	routes := []Route{
+		mustRoute(t, "10.0.0.0/8", net.IP{192, 168, 0, 2}),
+		mustRoute(t, "0.0.0.0/0", net.IP{192, 168, 0, 1}),
+	}
+	o := make(Options)
+	o.SetClasslessStaticRoutes(append(routes, Route{Router: net.IP{192, 168, 0, 1}}))
+	if got := o.ClasslessStaticRoutes(); !reflect.DeepEqual(got, routes) {
+		t.Errorf("ClasslessStaticRoutes() = %v, want %v", got, routes)
+	}
+
+	o[OptionClasslessStaticRoute] = []byte{40}
+	if got := o.ClasslessStaticRoutes(); got != nil {
+		t.Errorf("ClasslessStaticRoutes() of malformed option = %v, want nil", got)
+	}
+	o.SetClasslessStaticRoutes(nil)
+	if _, ok := o[OptionClasslessStaticRoute]; ok {
+		t.Errorf("SetClasslessStaticRoutes(nil) did not remove the option")
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// String-valued options are text: RFC 2132 defines most as NVT ASCII, and
+// UTF-8 is what implementations send in practice. Their values end up in
+// logs, DNS updates and file names, so the typed accessors of this package
+// apply these rules:
+//
+//   - Getters return SanitizeString of the value.
+//   - Setters store SanitizeString of the value. Use ValidateString to reject
+//     values that would be changed.
+//   - Get and direct map access return and store the raw bytes.
+
+// dnsNameOptions are the string options holding DNS names, which are ASCII
+// (RFC 1035, Section 2.3.1); internationalized names are sent in their
+// ASCII form (RFC 5891).
+var dnsNameOptions = map[OptionCode]bool{
+	OptionHostName:                        true,
+	OptionDomainName:                      true,
+	OptionNetworkInformationServiceDomain: true,
+	OptionTFTPServerName:                  true,
+}
+
+// isControl returns whether r is a C0 or C1 control character.
+func isControl(r rune) bool {
+	return r < 0x20 || (r >= 0x7f && r <= 0x9f)
+}
+
+// SanitizeString returns the option value b as a string that is safe to log
+// and store: trailing NUL bytes, which some implementations send, are
+// removed, and invalid UTF-8 and control characters are replaced by U+FFFD.
+func SanitizeString(b []byte) string {
+	for len(b) > 0 && b[len(b)-1] == 0 {
+		b = b[:len(b)-1]
+	}
+
+	var sb strings.Builder
+	for len(b) > 0 {
+		r, n := utf8.DecodeRune(b)
+		if (r == utf8.RuneError && n == 1) || isControl(r) {
+			r = utf8.RuneError
+		}
+		sb.WriteRune(r)
+		b = b[n:]
+	}
+	return sb.String()
+}
+
+// ValidateString returns an error if s cannot be sent unchanged as the value
+// of the string option code: if it is not valid UTF-8 or has control
+// characters, or, for options holding DNS names, has characters other than
+// ASCII letters, digits, hyphens, underscores and dots.
+func ValidateString(code OptionCode, s string) error {
+	if !utf8.ValidString(s) {
+		return fmt.Errorf("option %d: %q is not valid UTF-8", code, s)
+	}
+	for _, r := range s {
+		if isControl(r) {
+			return fmt.Errorf("option %d: %q has control character %U", code, s, r)
+		}
+		if dnsNameOptions[code] && !isDNSNameChar(r) {
+			return fmt.Errorf("option %d: %q has %q, which DNS names cannot have; use the ASCII form of internationalized names", code, s, r)
+		}
+	}
+	return nil
+}
+
+// isDNSNameChar returns whether r may appear in a DNS name. Underscores are
+// not valid in host names, but common in practice.
+func isDNSNameChar(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' ||
+		r == '-' || r == '_' || r == '.'
+}
+
+func (o Options) getString(code OptionCode) string {
+	return SanitizeString(o[code])
+}
+
+func (o Options) setString(code OptionCode, v string) {
+	o.setBytes(code, []byte(SanitizeString([]byte(v))))
+}
@@ -0,0 +1,65 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSanitizeString(t *testing.T) {
+	for _, tt := range []struct {
+		in   []byte
+		want string
+	}{
+		{in: []byte("node0"), want: "node0"},
+		{in: []byte("node0\x00\x00"), want: "node0"},
+		{in: []byte("Grüße"), want: "Grüße"},
+		{in: []byte("a\xffb"), want: "a�b"},
+		{in: []byte("evil\nlog line"), want: "evil�log line"},
+		{in: []byte("nul\x00inside"), want: "nul�inside"},
+		{in: []byte("c1 \xc2\x85"), want: "c1 �"},
+	} {
+		if got := SanitizeString(tt.in); got != tt.want {
+			t.Errorf("SanitizeString(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestValidateString(t *testing.T) {
+	for _, tt := range []struct {
+		code OptionCode
+		s    string
+		ok   bool
+	}{
+		{code: OptionHostName, s: "node-0", ok: true},
+		{code: OptionDomainName, s: "xn--bcher-kva.example", ok: true},
+		{code: OptionDomainName, s: "_srv.example", ok: true},
+		{code: OptionDomainName, s: "bücher.example"},
+		{code: OptionHostName, s: "node 0"},
+		{code: OptionMessage, s: "Grüße", ok: true},
+		{code: OptionMessage, s: "tab\there"},
+		{code: OptionRootPath, s: "/srv/\xff"},
+	} {
+		if err := ValidateString(tt.code, tt.s); (err == nil) != tt.ok {
+			t.Errorf("ValidateString(%d, %q) = %v, want ok %v", tt.code, tt.s, err, tt.ok)
+		}
+	}
+}
+
+func TestStringOptionsSanitized(t *testing.T) {
+	o := Options{OptionHostName: []byte("node\r\n0\x00")}
+	if got := o.HostName(); got != "node��0" {
+		t.Errorf("HostName() = %q, want control characters replaced", got)
+	}
+	if got := o.Get(OptionHostName); !bytes.Equal(got, []byte("node\r\n0\x00")) {
+		t.Errorf("Get() = %q, want the raw value", got)
+	}
+
+	o.SetMessage("bad \xff byte")
+	if got := o.Get(OptionMessage); !bytes.Equal(got, []byte("bad � byte")) {
+		t.Errorf("SetMessage() stored %q, want invalid UTF-8 replaced", got)
+	}
+}
@@ -0,0 +1,11 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package tftpserver is a tiny read-only TFTP server as described in RFC
+// 1350, with the blksize, tsize, and timeout options of RFC 2348 and RFC
+// 2349.
+//
+// It is meant to run alongside dhcp4server to netboot small labs from a
+// single binary. It is only built with the "tftp" build tag.
+package tftpserver
@@ -0,0 +1,317 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build tftp
+// +build tftp
+
+package tftpserver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TFTP opcodes as defined by RFC 1350, Section 5 and RFC 2347.
+const (
+	opRRQ   = 1
+	opWRQ   = 2
+	opDATA  = 3
+	opACK   = 4
+	opERROR = 5
+	opOACK  = 6
+)
+
+// TFTP error codes as defined by RFC 1350, Appendix.
+const (
+	errNotDefined       = 0
+	errFileNotFound     = 1
+	errAccessViolation  = 2
+	errIllegalOperation = 4
+	errUnknownTID       = 5
+	errOptionRejected   = 8
+)
+
+const (
+	defaultBlockSize = 512
+	minBlockSize     = 8
+	maxBlockSize     = 65464
+)
+
+// Server serves files read-only over TFTP.
+type Server struct {
+	fsys fs.FS
+
+	// Timeout is how long to wait for an acknowledgement before
+	// retransmitting a block. Clients may override it with the timeout
+	// option.
+	Timeout time.Duration
+
+	// Retries is how often a block is retransmitted before the transfer
+	// is aborted.
+	Retries int
+
+	// Logger logs failed transfers. If nil, nothing is logged.
+	Logger *log.Logger
+}
+
+// New returns a server serving files from fsys.
+func New(fsys fs.FS) *Server {
+	return &Server{
+		fsys:    fsys,
+		Timeout: 2 * time.Second,
+		Retries: 5,
+	}
+}
+
+// NewDir returns a server serving files from the directory root.
+func NewDir(root string) *Server {
+	return New(os.DirFS(root))
+}
+
+func (s *Server) logf(format string, v ...interface{}) {
+	if s.Logger != nil {
+		s.Logger.Printf(format, v...)
+	}
+}
+
+// Serve reads requests from conn, usually bound to UDP port 69, and serves
+// each transfer from a new socket on the same local address until reading
+// from conn fails.
+func (s *Server) Serve(conn net.PacketConn) error {
+	var laddr *net.UDPAddr
+	if a, ok := conn.LocalAddr().(*net.UDPAddr); ok {
+		laddr = &net.UDPAddr{IP: a.IP}
+	}
+
+	buf := make([]byte, maxBlockSize+4)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+		raddr, ok := addr.(*net.UDPAddr)
+		if !ok {
+			continue
+		}
+		req, err := parseRequest(buf[:n])
+		if err != nil {
+			conn.WriteTo(errorPacket(errIllegalOperation, err.Error()), addr)
+			continue
+		}
+		if req.op == opWRQ {
+			conn.WriteTo(errorPacket(errAccessViolation, "server is read-only"), addr)
+			continue
+		}
+
+		tconn, err := net.ListenUDP("udp4", laddr)
+		if err != nil {
+			s.logf("TFTP: cannot open transfer socket for %v: %v", addr, err)
+			continue
+		}
+		go func() {
+			defer tconn.Close()
+			if err := s.transfer(tconn, raddr, req); err != nil {
+				s.logf("TFTP: transfer of %q to %v failed: %v", req.filename, raddr, err)
+			}
+		}()
+	}
+}
+
+type request struct {
+	op       uint16
+	filename string
+	mode     string
+	options  map[string]string
+}
+
+// parseRequest parses a RRQ or WRQ packet as defined by RFC 1350, Section 5
+// and RFC 2347.
+func parseRequest(b []byte) (*request, error) {
+	if len(b) < 2 {
+		return nil, errors.New("short packet")
+	}
+	req := &request{op: binary.BigEndian.Uint16(b)}
+	if req.op != opRRQ && req.op != opWRQ {
+		return nil, fmt.Errorf("unexpected opcode %d", req.op)
+	}
+
+	fields := bytes.Split(b[2:], []byte{0})
+	// The packet must end in a zero byte, leaving an empty last field.
+	if len(fields) < 3 || len(fields[len(fields)-1]) != 0 {
+		return nil, errors.New("malformed request")
+	}
+	fields = fields[:len(fields)-1]
+
+	req.filename = string(fields[0])
+	req.mode = strings.ToLower(string(fields[1]))
+	if req.mode != "octet" && req.mode != "netascii" {
+		return nil, fmt.Errorf("unsupported mode %q", req.mode)
+	}
+
+	req.options = make(map[string]string)
+	for opts := fields[2:]; len(opts) >= 2; opts = opts[2:] {
+		req.options[strings.ToLower(string(opts[0]))] = string(opts[1])
+	}
+	return req, nil
+}
+
+func errorPacket(code uint16, msg string) []byte {
+	b := make([]byte, 4, 5+len(msg))
+	binary.BigEndian.PutUint16(b, opERROR)
+	binary.BigEndian.PutUint16(b[2:], code)
+	b = append(b, msg...)
+	return append(b, 0)
+}
+
+func (s *Server) open(name string) (fs.File, int64, error) {
+	// Clients commonly ask for absolute paths.
+	name = path.Clean(strings.TrimLeft(name, "/"))
+	if !fs.ValidPath(name) {
+		return nil, 0, fs.ErrPermission
+	}
+	f, err := s.fsys.Open(name)
+	if err != nil {
+		return nil, 0, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	if fi.IsDir() {
+		f.Close()
+		return nil, 0, fs.ErrPermission
+	}
+	return f, fi.Size(), nil
+}
+
+// transfer sends the requested file to raddr over conn.
+//
+// Netascii transfers are served byte-for-byte, like octet transfers.
+func (s *Server) transfer(conn *net.UDPConn, raddr *net.UDPAddr, req *request) error {
+	f, size, err := s.open(req.filename)
+	if err != nil {
+		code := uint16(errNotDefined)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			code = errFileNotFound
+		case errors.Is(err, fs.ErrPermission):
+			code = errAccessViolation
+		}
+		conn.WriteToUDP(errorPacket(code, err.Error()), raddr)
+		return err
+	}
+	defer f.Close()
+
+	blockSize := defaultBlockSize
+	timeout := s.Timeout
+
+	// Negotiate options per RFC 2347.
+	oack := []byte{0, opOACK}
+	for name, value := range req.options {
+		switch name {
+		case "blksize":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < minBlockSize {
+				conn.WriteToUDP(errorPacket(errOptionRejected, "invalid blksize"), raddr)
+				return fmt.Errorf("invalid blksize %q", value)
+			}
+			if n > maxBlockSize {
+				n = maxBlockSize
+			}
+			blockSize = n
+			value = strconv.Itoa(n)
+		case "tsize":
+			value = strconv.FormatInt(size, 10)
+		case "timeout":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 || n > 255 {
+				continue
+			}
+			timeout = time.Duration(n) * time.Second
+		default:
+			// Unknown options are ignored.
+			continue
+		}
+		oack = append(append(append(append(oack, name...), 0), value...), 0)
+	}
+
+	buf := make([]byte, blockSize+4)
+	if len(oack) > 2 {
+		// Block 0 acknowledges the OACK.
+		if err := s.sendAndAwaitAck(conn, raddr, oack, 0, timeout, buf); err != nil {
+			return err
+		}
+	}
+
+	block := make([]byte, blockSize+4)
+	binary.BigEndian.PutUint16(block, opDATA)
+	for n := uint16(1); ; n++ {
+		binary.BigEndian.PutUint16(block[2:], n)
+		m, err := io.ReadFull(f, block[4:])
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			conn.WriteToUDP(errorPacket(errNotDefined, "read error"), raddr)
+			return err
+		}
+		if err := s.sendAndAwaitAck(conn, raddr, block[:4+m], n, timeout, buf); err != nil {
+			return err
+		}
+		// A block shorter than blockSize ends the transfer.
+		if m < blockSize {
+			return nil
+		}
+	}
+}
+
+// sendAndAwaitAck sends pkt to raddr until it is acknowledged as block n.
+func (s *Server) sendAndAwaitAck(conn *net.UDPConn, raddr *net.UDPAddr, pkt []byte, n uint16, timeout time.Duration, buf []byte) error {
+	for try := 0; try <= s.Retries; try++ {
+		if _, err := conn.WriteToUDP(pkt, raddr); err != nil {
+			return err
+		}
+
+		deadline := time.Now().Add(timeout)
+		for {
+			conn.SetReadDeadline(deadline)
+			m, addr, err := conn.ReadFromUDP(buf)
+			if oerr, ok := err.(net.Error); ok && oerr.Timeout() {
+				break
+			} else if err != nil {
+				return err
+			}
+			if !addr.IP.Equal(raddr.IP) || addr.Port != raddr.Port {
+				// RFC 1350, Section 4: packets from other
+				// ports get an error, and the transfer
+				// continues.
+				conn.WriteToUDP(errorPacket(errUnknownTID, "unknown transfer ID"), addr)
+				continue
+			}
+			if m < 4 {
+				continue
+			}
+			switch binary.BigEndian.Uint16(buf) {
+			case opACK:
+				if binary.BigEndian.Uint16(buf[2:]) == n {
+					return nil
+				}
+				// Duplicate ACKs of earlier blocks are ignored
+				// to avoid the Sorcerer's Apprentice bug.
+			case opERROR:
+				return fmt.Errorf("client aborted transfer: %s", bytes.TrimRight(buf[4:m], "\x00"))
+			}
+		}
+	}
+	return fmt.Errorf("timed out waiting for ACK of block %d", n)
+}
@@ -0,0 +1,121 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build tftp
+// +build tftp
+
+package tftpserver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// get fetches filename from the server at addr with the given options.
+func get(t *testing.T, addr net.Addr, filename string, opts ...string) ([]byte, map[string]string) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	rrq := []byte{0, opRRQ}
+	for _, f := range append([]string{filename, "octet"}, opts...) {
+		rrq = append(append(rrq, f...), 0)
+	}
+	if _, err := conn.WriteTo(rrq, addr); err != nil {
+		t.Fatal(err)
+	}
+
+	var data []byte
+	oack := map[string]string{}
+	blockSize := defaultBlockSize
+	buf := make([]byte, maxBlockSize+4)
+	for {
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		n, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("reading from server: %v", err)
+		}
+		switch binary.BigEndian.Uint16(buf) {
+		case opERROR:
+			t.Fatalf("server returned error %q", buf[4:n])
+		case opOACK:
+			fields := bytes.Split(buf[2:n-1], []byte{0})
+			for i := 0; i+1 < len(fields); i += 2 {
+				oack[string(fields[i])] = string(fields[i+1])
+			}
+			if bs, ok := oack["blksize"]; ok {
+				blockSize = 0
+				for _, c := range bs {
+					blockSize = blockSize*10 + int(c-'0')
+				}
+			}
+			conn.WriteTo([]byte{0, opACK, 0, 0}, from)
+		case opDATA:
+			data = append(data, buf[4:n]...)
+			conn.WriteTo([]byte{0, opACK, buf[2], buf[3]}, from)
+			if n-4 < blockSize {
+				return data, oack
+			}
+		}
+	}
+}
+
+func TestServe(t *testing.T) {
+	big := bytes.Repeat([]byte("0123456789"), 200)
+	s := New(fstest.MapFS{
+		"pxelinux.0":      {Data: []byte("bootloader")},
+		"boot/kernel.img": {Data: big},
+		"empty":           {Data: []byte{}},
+	})
+
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Skipf("no loopback UDP: %v", err)
+	}
+	defer conn.Close()
+	go s.Serve(conn)
+
+	if got, _ := get(t, conn.LocalAddr(), "pxelinux.0"); string(got) != "bootloader" {
+		t.Errorf("got %q, want %q", got, "bootloader")
+	}
+	if got, _ := get(t, conn.LocalAddr(), "/boot/kernel.img"); !bytes.Equal(got, big) {
+		t.Errorf("got %d bytes, want %d", len(got), len(big))
+	}
+	if got, _ := get(t, conn.LocalAddr(), "empty"); len(got) != 0 {
+		t.Errorf("got %q, want empty file", got)
+	}
+
+	got, oack := get(t, conn.LocalAddr(), "boot/kernel.img", "blksize", "1024", "tsize", "0")
+	if !bytes.Equal(got, big) {
+		t.Errorf("got %d bytes, want %d", len(got), len(big))
+	}
+	if oack["blksize"] != "1024" || oack["tsize"] != "2000" {
+		t.Errorf("got OACK %v, want blksize 1024 and tsize 2000", oack)
+	}
+}
+
+func TestParseRequest(t *testing.T) {
+	for _, tt := range []struct {
+		b       []byte
+		wantErr bool
+	}{
+		{b: []byte("\x00\x01file\x00octet\x00")},
+		{b: []byte("\x00\x01file\x00octet\x00blksize\x001428\x00")},
+		{b: []byte("\x00\x02file\x00netascii\x00")},
+		{b: []byte("\x00\x01file\x00mail\x00"), wantErr: true},
+		{b: []byte("\x00\x01file\x00octet"), wantErr: true},
+		{b: []byte("\x00\x03file\x00octet\x00"), wantErr: true},
+		{b: []byte("\x00"), wantErr: true},
+	} {
+		if _, err := parseRequest(tt.b); (err != nil) != tt.wantErr {
+			t.Errorf("parseRequest(%q) = %v, want error %t", tt.b, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,1078 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4
+
+import (
+	"math"
+	"net"
+	"time"
+)
+
+// StaticRoute is a classful static route as carried by OptionStaticRoute.
+type StaticRoute struct {
+	Destination net.IP `json:"destination"`
+	Router      net.IP `json:"router"`
+}
+
+// The typed accessors below cover the options of RFC 2132. Getters return
+// the zero value if an option is not present or malformed; use Get to tell
+// the two apart. Setters replace any existing value of an option. IPv6
+// addresses cannot be encoded and are left out. String values are
+// sanitized both ways, see SanitizeString.
+
+// SubnetMask returns the subnet mask.
+//
+// It returns nil if the option is not present or malformed. The option is
+// defined by RFC 2132, Section 3.3.
+func (o Options) SubnetMask() net.IPMask {
+	return net.IPMask(o.getIP(OptionSubnetMask))
+}
+
+// SetSubnetMask sets the subnet mask.
+//
+// An empty value removes the option.
+func (o Options) SetSubnetMask(v net.IPMask) {
+	o.setIP(OptionSubnetMask, net.IP(v))
+}
+
+// TimeOffset returns the offset of the client's subnet from UTC.
+//
+// It returns 0 if the option is not present or malformed. The option is
+// defined by RFC 2132, Section 3.4.
+func (o Options) TimeOffset() time.Duration {
+	return time.Duration(int32(o.getUint32(OptionTimeOffset))) * time.Second
+}
+
+// SetTimeOffset sets the offset of the client's subnet from UTC.
+func (o Options) SetTimeOffset(v time.Duration) {
+	o.setUint32(OptionTimeOffset, uint32(int32(v/time.Second)))
+}
+
+// Routers returns the routers on the client's subnet.
+//
+// It returns nil if the option is not present or malformed. The option is
+// defined by RFC 2132, Section 3.5.
+func (o Options) Routers() []net.IP {
+	return o.getIPs(OptionRouters)
+}
+
+// SetRouters sets the routers on the client's subnet.
+//
+// An empty value removes the option.
+func (o Options) SetRouters(v []net.IP) {
+	o.setIPs(OptionRouters, v)
+}
+
+// TimeServers returns the RFC 868 time servers.
+//
+// It returns nil if the option is not present or malformed. The option is
+// defined by RFC 2132, Section 3.6.
+func (o Options) TimeServers() []net.IP {
+	return o.getIPs(OptionTimeServers)
+}
+
+// SetTimeServers sets the RFC 868 time servers.
+//
+// An empty value removes the option.
+func (o Options) SetTimeServers(v []net.IP) {
+	o.setIPs(OptionTimeServers, v)
+}
+
+// NameServers returns the IEN 116 name servers.
+//
+// It returns nil if the option is not present or malformed. The option is
+// defined by RFC 2132, Section 3.7.
+func (o Options) NameServers() []net.IP {
+	return o.getIPs(OptionNameServers)
+}
+
+// SetNameServers sets the IEN 116 name servers.
+//
+// An empty value removes the option.
+func (o Options) SetNameServers(v []net.IP) {
+	o.setIPs(OptionNameServers, v)
+}
+
+// DomainNameServers returns the DNS servers.
+//
+// It returns nil if the option is not present or malformed. The option is
+// defined by RFC 2132, Section 3.8.
+func (o Options) DomainNameServers() []net.IP {
+	return o.getIPs(OptionDomainNameServers)
+}
+
+// SetDomainNameServers sets the DNS servers.
+//
+// An empty value removes the option.
+func (o Options) SetDomainNameServers(v []net.IP) {
+	o.setIPs(OptionDomainNameServers, v)
+}
+
+// LogServers returns the MIT-LCS UDP log servers.
+//
+// It returns nil if the option is not present or malformed. The option is
+// defined by RFC 2132, Section 3.9.
+func (o Options) LogServers() []net.IP {
+	return o.getIPs(OptionLogServers)
+}
+
+// SetLogServers sets the MIT-LCS UDP log servers.
+//
+// An empty value removes the option.
+func (o Options) SetLogServers(v []net.IP) {
+	o.setIPs(OptionLogServers, v)
+}
+
+// CookieServers returns the RFC 865 cookie servers.
+//
+// It returns nil if the option is not present or malformed. The option is
+// defined by RFC 2132, Section 3.10.
+func (o Options) CookieServers() []net.IP {
+	return o.getIPs(OptionCookieServers)
+}
+
+// SetCookieServers sets the RFC 865 cookie servers.
+//
+// An empty value removes the option.
+func (o Options) SetCookieServers(v []net.IP) {
+	o.setIPs(OptionCookieServers, v)
+}
+
+// LPRServers returns the RFC 1179 line printer servers.
+//
+// It returns nil if the option is not present or malformed. The option is
+// defined by RFC 2132, Section 3.11.
+func (o Options) LPRServers() []net.IP {
+	return o.getIPs(OptionLPRServers)
+}
+
+// SetLPRServers sets the RFC 1179 line printer servers.
+//
+// An empty value removes the option.
+func (o Options) SetLPRServers(v []net.IP) {
+	o.setIPs(OptionLPRServers, v)
+}
+
+// ImpressServers returns the Imagen Impress servers.
+//
+// It returns nil if the option is not present or malformed. The option is
+// defined by RFC 2132, Section 3.12.
+func (o Options) ImpressServers() []net.IP {
+	return o.getIPs(OptionImpressServers)
+}
+
+// SetImpressServers sets the Imagen Impress servers.
+//
+// An empty value removes the option.
+func (o Options) SetImpressServers(v []net.IP) {
+	o.setIPs(OptionImpressServers, v)
+}
+
+// ResourceLocationServers returns the RFC 887 resource location servers.
+//
+// It returns nil if the option is not present or malformed. The option is
+// defined by RFC 2132, Section 3.13.
+func (o Options) ResourceLocationServers() []net.IP {
+	return o.getIPs(OptionResourceLocationServers)
+}
+
+// SetResourceLocationServers sets the RFC 887 resource location servers.
+//
+// An empty value removes the option.
+func (o Options) SetResourceLocationServers(v []net.IP) {
+	o.setIPs(OptionResourceLocationServers, v)
+}
+
+// HostName returns the client's host name.
+//
+// It returns empty if the option is not present or malformed. The option is
+// defined by RFC 2132, Section 3.14.
+func (o Options) HostName() string {
+	return o.getString(OptionHostName)
+}
+
+// SetHostName sets the client's host name.
+//
+// An empty value removes the option.
+func (o Options) SetHostName(v string) {
+	o.setString(OptionHostName, v)
+}
+
+// BootFileSize returns the size of the boot file in 512-octet blocks.
+//
+// It returns 0 if the option is not present or malformed. The option is
+// defined by RFC 2132, Section 3.15.
+func (o Options) BootFileSize() uint16 {
+	return o.getUint16(OptionBootFileSize)
+}
+
+// SetBootFileSize sets the size of the boot file in 512-octet blocks.
+func (o Options) SetBootFileSize(v uint16) {
+	o.setUint16(OptionBootFileSize, v)
+}
+
+// MeritDumpFile returns the path the client should dump its core image to.
+//
+// It returns empty if the option is not present or malformed. The option is
+// defined by RFC 2132, Section 3.16.
+func (o Options) MeritDumpFile() string {
+	return o.getString(OptionMeritDumpFile)
+}
+
+// SetMeritDumpFile sets the path the client should dump its core image to.
+//
+// An empty value removes the option.
+func (o Options) SetMeritDumpFile(v string) {
+	o.setString(OptionMeritDumpFile, v)
+}
+
+// DomainName returns the client's DNS domain name.
+//
+// It returns empty if the option is not present or malformed. The option is
+// defined by RFC 2132, Section 3.17.
+func (o Options) DomainName() string {
+	return o.getString(OptionDomainName)
+}
+
+// SetDomainName sets the client's DNS domain name.
+//
+// An empty value removes the option.
+func (o Options) SetDomainName(v string) {
+	o.setString(OptionDomainName, v)
+}
+
+// SwapServer returns the client's swap server.
+//
+// It returns nil if the option is not present or malformed. The option is
+// defined by RFC 2132, Section 3.18.
+func (o Options) SwapServer() net.IP {
+	return o.getIP(OptionSwapServer)
+}
+
+// SetSwapServer sets the client's swap server.
+//
+// An empty value removes the option.
+func (o Options) SetSwapServer(v net.IP) {
+	o.setIP(OptionSwapServer, v)
+}
+
+// RootPath returns the path of the client's root disk.
+//
+// It returns empty if the option is not present or malformed. The option is
+// defined by RFC 2132, Section 3.19.
+func (o Options) RootPath() string {
+	return o.getString(OptionRootPath)
+}
+
+// SetRootPath sets the path of the client's root disk.
+//
+// An empty value removes the option.
+func (o Options) SetRootPath(v string) {
+	o.setString(OptionRootPath, v)
+}
+
+// ExtensionsPath returns the path of a file with further options.
+//
+// It returns empty if the option is not present or malformed. The option is
+// defined by RFC 2132, Section 3.20.
+func (o Options) ExtensionsPath() string {
+	return o.getString(OptionExtensionsPath)
+}
+
+// SetExtensionsPath sets the path of a file with further options.
+//
+// An empty value removes the option.
+func (o Options) SetExtensionsPath(v string) {
+	o.setString(OptionExtensionsPath, v)
+}
+
+// IPForwarding returns whether the client should forward IP packets.
+//
+// It returns false if the option is not present or malformed. The option is
+// defined by RFC 2132, Section 4.1.
+func (o Options) IPForwarding() bool {
+	return o.getUint8(OptionIPForwardingEnableDisable) == 1
+}
+
+// SetIPForwarding sets whether the client should forward IP packets.
+func (o Options) SetIPForwarding(v bool) {
+	o.setBool(OptionIPForwardingEnableDisable, v)
+}
+
+// NonLocalSourceRouting returns whether the client should forward non-local source-routed datagrams.
+//
+// It returns false if the option is not present or malformed. The option is
+// defined by RFC 2132, Section 4.2.
+func (o Options) NonLocalSourceRouting() bool {
+	return o.getUint8(OptionNonLocalSourceRoutingEnableDisable) == 1
+}
+
+// SetNonLocalSourceRouting sets whether the client should forward non-local source-routed datagrams.
+func (o Options) SetNonLocalSourceRouting(v bool) {
+	o.setBool(OptionNonLocalSourceRoutingEnableDisable, v)
+}
+
+// PolicyFilter returns the destinations non-local source routes are allowed to.
+//
+// It returns nil if the option is not present or malformed. The option is
+// defined by RFC 2132, Section 4.3.
+func (o Options) PolicyFilter() []net.IPNet {
+	return o.getIPNets(OptionPolicyFilter)
+}
+
+// SetPolicyFilter sets the destinations non-local source routes are allowed to.
+//
+// An empty value removes the option.
+func (o Options) SetPolicyFilter(v []net.IPNet) {
+	o.setIPNets(OptionPolicyFilter, v)
+}
+
+// MaximumDatagramReassemblySize returns the largest datagram the client should reassemble.
+//
+// It returns 0 if the option is not present or malformed. The option is
+// defined by RFC 2132, Section 4.4.
+func (o Options) MaximumDatagramReassemblySize() uint16 {
+	return o.getUint16(OptionMaximumDatagramReassemblySize)
+}
+
+// SetMaximumDatagramReassemblySize sets the largest datagram the client should reassemble.
+func (o Options) SetMaximumDatagramReassemblySize(v uint16) {
+	o.setUint16(OptionMaximumDatagramReassemblySize, v)
+}
+
+// DefaultIPTimeToLive returns the default IP TTL of outgoing datagrams.
+//
+// It returns 0 if the option is not present or malformed. The option is
+// defined by RFC 2132, Section 4.5.
+func (o Options) DefaultIPTimeToLive() uint8 {
+	return o.getUint8(OptionDefaultIPTimeToLive)
+}
+
+// SetDefaultIPTimeToLive sets the default IP TTL of outgoing datagrams.
+func (o Options) SetDefaultIPTimeToLive(v uint8) {
+	o[OptionDefaultIPTimeToLive] = []byte{v}
+}
+
+// PathMTUAgingTimeout returns the timeout for aging path MTU values.
+//
+// It returns 0 if the option is not present or malformed. The option is
+// defined by RFC 2132, Section 4.6.
+func (o Options) PathMTUAgingTimeout() time.Duration {
+	return time.Duration(o.getUint32(OptionPathMTUAgingTimeout)) * time.Second
+}
+
+// SetPathMTUAgingTimeout sets the timeout for aging path MTU values.
+func (o Options) SetPathMTUAgingTimeout(v time.Duration) {
+	o.setUint32(OptionPathMTUAgingTimeout, uint32(v/time.Second))
+}
+
+// PathMTUPlateauTable returns the MTU sizes to try during path MTU discovery.
+//
+// It returns nil if the option is not present or malformed. The option is
+// defined by RFC 2132, Section 4.7.
+func (o Options) PathMTUPlateauTable() []uint16 {
+	return o.getUint16s(OptionPathMTUPlateauTable)
+}
+
+// SetPathMTUPlateauTable sets the MTU sizes to try during path MTU discovery.
+//
+// An empty value removes the option.
+func (o Options) SetPathMTUPlateauTable(v []uint16) {
+	o.setUint16s(OptionPathMTUPlateauTable, v)
+}
+
+// InterfaceMTU returns the MTU of the client's interface.
+//
+// It returns 0 if the option is not present or malformed. The option is
+// defined by RFC 2132, Section 5.1.
+func (o Options) InterfaceMTU() uint16 {
+	return o.getUint16(OptionInterfaceMTU)
+}
+
+// SetInterfaceMTU sets the MTU of the client's interface.
+func (o Options) SetInterfaceMTU(v uint16) {
+	o.setUint16(OptionInterfaceMTU, v)
+}
+
+// AllSubnetsAreLocal returns whether all subnets of the client's network share its MTU.
+//
+// It returns false if the option is not present or malformed. The option is
+// defined by RFC 2132, Section 5.2.
+func (o Options) AllSubnetsAreLocal() bool {
+	return o.getUint8(OptionAllSubnetsAreLocal) == 1
+}
+
+// SetAllSubnetsAreLocal sets whether all subnets of the client's network share its MTU.
+func (o Options) SetAllSubnetsAreLocal(v bool) {
+	o.setBool(OptionAllSubnetsAreLocal, v)
+}
+
+// BroadcastAddress returns the broadcast address of the client's subnet.
+//
+// It returns nil if the option is not present or malformed. The option is
+// defined by RFC 2132, Section 5.3.
+func (o Options) BroadcastAddress() net.IP {
+	return o.getIP(OptionBroadcastAddress)
+}
+
+// SetBroadcastAddress sets the broadcast address of the client's subnet.
+//
+// An empty value removes the option.
+func (o Options) SetBroadcastAddress(v net.IP) {
+	o.setIP(OptionBroadcastAddress, v)
+}
+
+// PerformMaskDiscovery returns whether the client should perform ICMP subnet mask discovery.
+//
+// It returns false if the option is not present or malformed. The option is
+// defined by RFC 2132, Section 5.4.
+func (o Options) PerformMaskDiscovery() bool {
+	return o.getUint8(OptionPerformMaskDiscovery) == 1
+}
+
+// SetPerformMaskDiscovery sets whether the client should perform ICMP subnet mask discovery.
+func (o Options) SetPerformMaskDiscovery(v bool) {
+	o.setBool(OptionPerformMaskDiscovery, v)
+}
+
+// MaskSupplier returns whether the client should answer ICMP subnet mask requests.
+//
+// It returns false if the option is not present or malformed. The option is
+// defined by RFC 2132, Section 5.5.
+func (o Options) MaskSupplier() bool {
+	return o.getUint8(OptionMaskSupplier) == 1
+}
+
+// SetMaskSupplier sets whether the client should answer ICMP subnet mask requests.
+func (o Options) SetMaskSupplier(v bool) {
+	o.setBool(OptionMaskSupplier, v)
+}
+
+// PerformRouterDiscovery returns whether the client should perform RFC 1256 router discovery.
+//
+// It returns false if the option is not present or malformed. The option is
+// defined by RFC 2132, Section 5.6.
+func (o Options) PerformRouterDiscovery() bool {
+	return o.getUint8(OptionPerformRouterDiscovery) == 1
+}
+
+// SetPerformRouterDiscovery sets whether the client should perform RFC 1256 router discovery.
+func (o Options) SetPerformRouterDiscovery(v bool) {
+	o.setBool(OptionPerformRouterDiscovery, v)
+}
+
+// RouterSolicitationAddress returns the address to send router solicitations to.
+//
+// It returns nil if the option is not present or malformed. The option is
+// defined by RFC 2132, Section 5.7.
+func (o Options) RouterSolicitationAddress() net.IP {
+	return o.getIP(OptionRouterSolicitationAddress)
+}
+
+// SetRouterSolicitationAddress sets the address to send router solicitations to.
+//
+// An empty value removes the option.
+func (o Options) SetRouterSolicitationAddress(v net.IP) {
+	o.setIP(OptionRouterSolicitationAddress, v)
+}
+
+// StaticRoutes returns the classful static routes.
+//
+// It returns nil if the option is not present or malformed. The option is
+// defined by RFC 2132, Section 5.8.
+func (o Options) StaticRoutes() []StaticRoute {
+	return o.getStaticRoutes(OptionStaticRoute)
+}
+
+// SetStaticRoutes sets the classful static routes.
+//
+// An empty value removes the option.
+func (o Options) SetStaticRoutes(v []StaticRoute) {
+	o.setStaticRoutes(OptionStaticRoute, v)
+}
+
+// TrailerEncapsulation returns whether the client should negotiate trailers.
+//
+// It returns false if the option is not present or malformed. The option is
+// defined by RFC 2132, Section 6.1.
+func (o Options) TrailerEncapsulation() bool {
+	return o.getUint8(OptionTrailerEncapsulation) == 1
+}
+
+// SetTrailerEncapsulation sets whether the client should negotiate trailers.
+func (o Options) SetTrailerEncapsulation(v bool) {
+	o.setBool(OptionTrailerEncapsulation, v)
+}
+
+// ARPCacheTimeout returns the timeout of ARP cache entries.
+//
+// It returns 0 if the option is not present or malformed. The option is
+// defined by RFC 2132, Section 6.2.
+func (o Options) ARPCacheTimeout() time.Duration {
+	return time.Duration(o.getUint32(OptionARPCacheTimeout)) * time.Second
+}
+
+// SetARPCacheTimeout sets the timeout of ARP cache entries.
+func (o Options) SetARPCacheTimeout(v time.Duration) {
+	o.setUint32(OptionARPCacheTimeout, uint32(v/time.Second))
+}
+
+// EthernetEncapsulation returns whether the client should use IEEE 802.3 rather than Ethernet v2 encapsulation.
+//
+// It returns false if the option is not present or malformed. The option is
+// defined by RFC 2132, Section 6.3.
+func (o Options) EthernetEncapsulation() bool {
+	return o.getUint8(OptionEthernetEncapsulation) == 1
+}
+
+// SetEthernetEncapsulation sets whether the client should use IEEE 802.3 rather than Ethernet v2 encapsulation.
+func (o Options) SetEthernetEncapsulation(v bool) {
+	o.setBool(OptionEthernetEncapsulation, v)
+}
+
+// TCPDefaultTTL returns the default TTL of TCP segments.
+//
+// It returns 0 if the option is not present or malformed. The option is
+// defined by RFC 2132, Section 7.1.
+func (o Options) TCPDefaultTTL() uint8 {
+	return o.getUint8(OptionTCPDefaultTTL)
+}
+
+// SetTCPDefaultTTL sets the default TTL of TCP segments.
+func (o Options) SetTCPDefaultTTL(v uint8) {
+	o[OptionTCPDefaultTTL] = []byte{v}
+}
+
+// TCPKeepaliveInterval returns the interval between TCP keepalive messages.
+//
+// It returns 0 if the option is not present or malformed. The option is
+// defined by RFC 2132, Section 7.2.
+func (o Options) TCPKeepaliveInterval() time.Duration {
+	return time.Duration(o.getUint32(OptionTCPKeepaliveInterval)) * time.Second
+}
+
+// SetTCPKeepaliveInterval sets the interval between TCP keepalive messages.
+func (o Options) SetTCPKeepaliveInterval(v time.Duration) {
+	o.setUint32(OptionTCPKeepaliveInterval, uint32(v/time.Second))
+}
+
+// TCPKeepaliveGarbage returns whether TCP keepalive messages should carry a garbage octet.
+//
+// It returns false if the option is not present or malformed. The option is
+// defined by RFC 2132, Section 7.3.
+func (o Options) TCPKeepaliveGarbage() bool {
+	return o.getUint8(OptionTCPKeepaliveGarbage) == 1
+}
+
+// SetTCPKeepaliveGarbage sets whether TCP keepalive messages should carry a garbage octet.
+func (o Options) SetTCPKeepaliveGarbage(v bool) {
+	o.setBool(OptionTCPKeepaliveGarbage, v)
+}
+
+// NetworkInformationServiceDomain returns the client's NIS domain.
+//
+// It returns empty if the option is not present or malformed. The option is
+// defined by RFC 2132, Section 8.1.
+func (o Options) NetworkInformationServiceDomain() string {
+	return o.getString(OptionNetworkInformationServiceDomain)
+}
+
+// SetNetworkInformationServiceDomain sets the client's NIS domain.
+//
+// An empty value removes the option.
+func (o Options) SetNetworkInformationServiceDomain(v string) {
+	o.setString(OptionNetworkInformationServiceDomain, v)
+}
+
+// NetworkInformationServers returns the NIS servers.
+//
+// It returns nil if the option is not present or malformed. The option is
+// defined by RFC 2132, Section 8.2.
+func (o Options) NetworkInformationServers() []net.IP {
+	return o.getIPs(OptionNetworkInformationServers)
+}
+
+// SetNetworkInformationServers sets the NIS servers.
+//
+// An empty value removes the option.
+func (o Options) SetNetworkInformationServers(v []net.IP) {
+	o.setIPs(OptionNetworkInformationServers, v)
+}
+
+// NetworkTimeProtocolServers returns the NTP servers.
+//
+// It returns nil if the option is not present or malformed. The option is
+// defined by RFC 2132, Section 8.3.
+func (o Options) NetworkTimeProtocolServers() []net.IP {
+	return o.getIPs(OptionNetworkTimeProtocolServers)
+}
+
+// SetNetworkTimeProtocolServers sets the NTP servers.
+//
+// An empty value removes the option.
+func (o Options) SetNetworkTimeProtocolServers(v []net.IP) {
+	o.setIPs(OptionNetworkTimeProtocolServers, v)
+}
+
+// VendorSpecificInformation returns the vendor-specific information.
+//
+// It returns nil if the option is not present or malformed. The option is
+// defined by RFC 2132, Section 8.4.
+func (o Options) VendorSpecificInformation() []byte {
+	return o.Get(OptionVendorSpecificInformation)
+}
+
+// SetVendorSpecificInformation sets the vendor-specific information.
+//
+// An empty value removes the option.
+func (o Options) SetVendorSpecificInformation(v []byte) {
+	o.setBytes(OptionVendorSpecificInformation, v)
+}
+
+// NetBIOSOverTCPIPNameServers returns the NetBIOS over TCP/IP name servers.
+//
+// It returns nil if the option is not present or malformed. The option is
+// defined by RFC 2132, Section 8.5.
+func (o Options) NetBIOSOverTCPIPNameServers() []net.IP {
+	return o.getIPs(OptionNetBIOSOverTCPIPNameServer)
+}
+
+// SetNetBIOSOverTCPIPNameServers sets the NetBIOS over TCP/IP name servers.
+//
+// An empty value removes the option.
+func (o Options) SetNetBIOSOverTCPIPNameServers(v []net.IP) {
+	o.setIPs(OptionNetBIOSOverTCPIPNameServer, v)
+}
+
+// NetBIOSOverTCPIPDatagramDistributionServers returns the NetBIOS over TCP/IP datagram distribution servers.
+//
+// It returns nil if the option is not present or malformed. The option is
+// defined by RFC 2132, Section 8.6.
+func (o Options) NetBIOSOverTCPIPDatagramDistributionServers() []net.IP {
+	return o.getIPs(OptionNetBIOSOverTCPIPDatagramDistributionServer)
+}
+
+// SetNetBIOSOverTCPIPDatagramDistributionServers sets the NetBIOS over TCP/IP datagram distribution servers.
+//
+// An empty value removes the option.
+func (o Options) SetNetBIOSOverTCPIPDatagramDistributionServers(v []net.IP) {
+	o.setIPs(OptionNetBIOSOverTCPIPDatagramDistributionServer, v)
+}
+
+// NetBIOSOverTCPIPNodeType returns the NetBIOS over TCP/IP node type.
+//
+// It returns 0 if the option is not present or malformed. The option is
+// defined by RFC 2132, Section 8.7.
+func (o Options) NetBIOSOverTCPIPNodeType() uint8 {
+	return o.getUint8(OptionNetBIOSOverTCPIPNodeType)
+}
+
+// SetNetBIOSOverTCPIPNodeType sets the NetBIOS over TCP/IP node type.
+func (o Options) SetNetBIOSOverTCPIPNodeType(v uint8) {
+	o[OptionNetBIOSOverTCPIPNodeType] = []byte{v}
+}
+
+// NetBIOSOverTCPIPScope returns the NetBIOS over TCP/IP scope.
+//
+// It returns empty if the option is not present or malformed. The option is
+// defined by RFC 2132, Section 8.8.
+func (o Options) NetBIOSOverTCPIPScope() string {
+	return o.getString(OptionNetBIOSOverTCPIPScope)
+}
+
+// SetNetBIOSOverTCPIPScope sets the NetBIOS over TCP/IP scope.
+//
+// An empty value removes the option.
+func (o Options) SetNetBIOSOverTCPIPScope(v string) {
+	o.setString(OptionNetBIOSOverTCPIPScope, v)
+}
+
+// XWindowSystemFontServers returns the X Window System font servers.
+//
+// It returns nil if the option is not present or malformed. The option is
+// defined by RFC 2132, Section 8.9.
+func (o Options) XWindowSystemFontServers() []net.IP {
+	return o.getIPs(OptionXWindowSystemFontServer)
+}
+
+// SetXWindowSystemFontServers sets the X Window System font servers.
+//
+// An empty value removes the option.
+func (o Options) SetXWindowSystemFontServers(v []net.IP) {
+	o.setIPs(OptionXWindowSystemFontServer, v)
+}
+
+// XWindowSystemDisplayManagers returns the X Window System display managers.
+//
+// It returns nil if the option is not present or malformed. The option is
+// defined by RFC 2132, Section 8.10.
+func (o Options) XWindowSystemDisplayManagers() []net.IP {
+	return o.getIPs(OptionXWindowSystemDisplayManager)
+}
+
+// SetXWindowSystemDisplayManagers sets the X Window System display managers.
+//
+// An empty value removes the option.
+func (o Options) SetXWindowSystemDisplayManagers(v []net.IP) {
+	o.setIPs(OptionXWindowSystemDisplayManager, v)
+}
+
+// RequestedIPAddress returns the address requested by the client.
+//
+// It returns nil if the option is not present or malformed. The option is
+// defined by RFC 2132, Section 9.1.
+func (o Options) RequestedIPAddress() net.IP {
+	return o.getIP(OptionRequestedIPAddress)
+}
+
+// SetRequestedIPAddress sets the address requested by the client.
+//
+// An empty value removes the option.
+func (o Options) SetRequestedIPAddress(v net.IP) {
+	o.setIP(OptionRequestedIPAddress, v)
+}
+
+// LeaseTime returns the lease time.
+//
+// It returns 0 if the option is not present or malformed. The option is
+// defined by RFC 2132, Section 9.2.
+func (o Options) LeaseTime() time.Duration {
+	return time.Duration(o.getUint32(OptionIPAddressLeaseTime)) * time.Second
+}
+
+// SetLeaseTime sets the lease time.
+//
+// Lease times of math.MaxUint32 seconds or more are set as infinite, RFC
+// 2131 Section 3.3. A negative lease time removes the option.
+func (o Options) SetLeaseTime(v time.Duration) {
+	o.setSeconds(OptionIPAddressLeaseTime, v)
+}
+
+// Overload returns which of the sname and file fields carry options.
+//
+// It returns 0 if the option is not present or malformed. The option is
+// defined by RFC 2132, Section 9.3.
+func (o Options) Overload() uint8 {
+	return o.getUint8(OptionOverload)
+}
+
+// SetOverload sets which of the sname and file fields carry options.
+func (o Options) SetOverload(v uint8) {
+	o[OptionOverload] = []byte{v}
+}
+
+// MessageType returns the DHCP message type.
+//
+// It returns 0 if the option is not present or malformed. The option is
+// defined by RFC 2132, Section 9.6.
+func (o Options) MessageType() MessageType {
+	return MessageType(o.getUint8(OptionDHCPMessageType))
+}
+
+// SetMessageType sets the DHCP message type.
+func (o Options) SetMessageType(v MessageType) {
+	o[OptionDHCPMessageType] = []byte{byte(v)}
+}
+
+// ServerIdentifier returns the server identifier.
+//
+// It returns nil if the option is not present or malformed. The option is
+// defined by RFC 2132, Section 9.7.
+func (o Options) ServerIdentifier() net.IP {
+	return o.getIP(OptionServerIdentifier)
+}
+
+// SetServerIdentifier sets the server identifier.
+//
+// An empty value removes the option.
+func (o Options) SetServerIdentifier(v net.IP) {
+	o.setIP(OptionServerIdentifier, v)
+}
+
+// ParameterRequestList returns the options requested by the client.
+//
+// It returns nil if the option is not present or malformed. The option is
+// defined by RFC 2132, Section 9.8.
+func (o Options) ParameterRequestList() []OptionCode {
+	return o.getCodes(OptionParameterRequestList)
+}
+
+// SetParameterRequestList sets the options requested by the client.
+//
+// An empty value removes the option.
+func (o Options) SetParameterRequestList(v []OptionCode) {
+	o.setCodes(OptionParameterRequestList, v)
+}
+
+// Message returns the error message.
+//
+// It returns empty if the option is not present or malformed. The option is
+// defined by RFC 2132, Section 9.9.
+func (o Options) Message() string {
+	return o.getString(OptionMessage)
+}
+
+// SetMessage sets the error message.
+//
+// An empty value removes the option.
+func (o Options) SetMessage(v string) {
+	o.setString(OptionMessage, v)
+}
+
+// MaximumDHCPMessageSize returns the largest DHCP message the sender accepts.
+//
+// It returns 0 if the option is not present or malformed. The option is
+// defined by RFC 2132, Section 9.10.
+func (o Options) MaximumDHCPMessageSize() uint16 {
+	return o.getUint16(OptionMaximumDHCPMessageSize)
+}
+
+// SetMaximumDHCPMessageSize sets the largest DHCP message the sender accepts.
+func (o Options) SetMaximumDHCPMessageSize(v uint16) {
+	o.setUint16(OptionMaximumDHCPMessageSize, v)
+}
+
+// RenewalTime returns the time until the client should renew its lease (T1).
+//
+// It returns 0 if the option is not present or malformed. The option is
+// defined by RFC 2132, Section 9.11.
+func (o Options) RenewalTime() time.Duration {
+	return time.Duration(o.getUint32(OptionRenewalTimeValue)) * time.Second
+}
+
+// SetRenewalTime sets the time until the client should renew its lease (T1).
+//
+// Times are clamped and negative times rejected as by SetLeaseTime.
+func (o Options) SetRenewalTime(v time.Duration) {
+	o.setSeconds(OptionRenewalTimeValue, v)
+}
+
+// RebindingTime returns the time until the client should rebind its lease (T2).
+//
+// It returns 0 if the option is not present or malformed. The option is
+// defined by RFC 2132, Section 9.12.
+func (o Options) RebindingTime() time.Duration {
+	return time.Duration(o.getUint32(OptionRebindingTimeValue)) * time.Second
+}
+
+// SetRebindingTime sets the time until the client should rebind its lease (T2).
+//
+// Times are clamped and negative times rejected as by SetLeaseTime.
+func (o Options) SetRebindingTime(v time.Duration) {
+	o.setSeconds(OptionRebindingTimeValue, v)
+}
+
+// VendorClassIdentifier returns the vendor class identifier.
+//
+// It returns empty if the option is not present or malformed. The option is
+// defined by RFC 2132, Section 9.13.
+func (o Options) VendorClassIdentifier() string {
+	return o.getString(OptionVendorClassIdentifier)
+}
+
+// SetVendorClassIdentifier sets the vendor class identifier.
+//
+// An empty value removes the option.
+func (o Options) SetVendorClassIdentifier(v string) {
+	o.setString(OptionVendorClassIdentifier, v)
+}
+
+// ClientIdentifier returns the client identifier.
+//
+// It returns nil if the option is not present or malformed. The option is
+// defined by RFC 2132, Section 9.14.
+func (o Options) ClientIdentifier() []byte {
+	return o.Get(OptionClientIdentifier)
+}
+
+// SetClientIdentifier sets the client identifier.
+//
+// An empty value removes the option.
+func (o Options) SetClientIdentifier(v []byte) {
+	o.setBytes(OptionClientIdentifier, v)
+}
+
+// TFTPServerName returns the TFTP server name.
+//
+// It returns empty if the option is not present or malformed. The option is
+// defined by RFC 2132, Section 9.4.
+func (o Options) TFTPServerName() string {
+	return o.getString(OptionTFTPServerName)
+}
+
+// SetTFTPServerName sets the TFTP server name.
+//
+// An empty value removes the option.
+func (o Options) SetTFTPServerName(v string) {
+	o.setString(OptionTFTPServerName, v)
+}
+
+// BootFileName returns the boot file name.
+//
+// It returns empty if the option is not present or malformed. The option is
+// defined by RFC 2132, Section 9.5.
+func (o Options) BootFileName() string {
+	return o.getString(OptionBootFileName)
+}
+
+// SetBootFileName sets the boot file name.
+//
+// An empty value removes the option.
+func (o Options) SetBootFileName(v string) {
+	o.setString(OptionBootFileName, v)
+}
+
+// The helpers below decode and encode values with the OptionValue types.
+
+func (o Options) getIP(code OptionCode) net.IP {
+	var v IP
+	if !o.Value(code, &v) {
+		return nil
+	}
+	return net.IP(v)
+}
+
+func (o Options) getIPs(code OptionCode) []net.IP {
+	var v IPList
+	if !o.Value(code, &v) {
+		return nil
+	}
+	return v
+}
+
+func (o Options) getIPNets(code OptionCode) []net.IPNet {
+	var v IPNetList
+	if !o.Value(code, &v) {
+		return nil
+	}
+	return v
+}
+
+func (o Options) getStaticRoutes(code OptionCode) []StaticRoute {
+	var v StaticRouteList
+	if !o.Value(code, &v) {
+		return nil
+	}
+	return v
+}
+
+func (o Options) getUint8(code OptionCode) uint8 {
+	var v U8
+	o.Value(code, &v)
+	return uint8(v)
+}
+
+func (o Options) getUint16(code OptionCode) uint16 {
+	var v U16
+	o.Value(code, &v)
+	return uint16(v)
+}
+
+func (o Options) getUint32(code OptionCode) uint32 {
+	var v U32
+	o.Value(code, &v)
+	return uint32(v)
+}
+
+func (o Options) getUint16s(code OptionCode) []uint16 {
+	var v U16List
+	if !o.Value(code, &v) {
+		return nil
+	}
+	return v
+}
+
+func (o Options) getCodes(code OptionCode) []OptionCode {
+	var v CodeList
+	if !o.Value(code, &v) {
+		return nil
+	}
+	return v
+}
+
+// setBytes sets the option to a copy of v, or removes it if v is empty.
+func (o Options) setBytes(code OptionCode, v []byte) {
+	if len(v) == 0 {
+		delete(o, code)
+		return
+	}
+	o[code] = append([]byte(nil), v...)
+}
+
+func (o Options) setIP(code OptionCode, ip net.IP) {
+	o.setIPs(code, []net.IP{ip})
+}
+
+// setIPs sets the option to the IPv4 addresses among ips.
+func (o Options) setIPs(code OptionCode, ips []net.IP) {
+	var v IPList
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			v = append(v, ip)
+		}
+	}
+	o.SetValue(code, &v)
+}
+
+// setIPNets sets the option to the IPv4 networks among nets.
+func (o Options) setIPNets(code OptionCode, nets []net.IPNet) {
+	var v IPNetList
+	for _, n := range nets {
+		if _, err := (IPNetList{n}).MarshalBinary(); err == nil {
+			v = append(v, n)
+		}
+	}
+	o.SetValue(code, &v)
+}
+
+// setStaticRoutes sets the option to the IPv4 routes among routes.
+func (o Options) setStaticRoutes(code OptionCode, routes []StaticRoute) {
+	var v StaticRouteList
+	for _, r := range routes {
+		if r.Destination.To4() != nil && r.Router.To4() != nil {
+			v = append(v, r)
+		}
+	}
+	o.SetValue(code, &v)
+}
+
+func (o Options) setBool(code OptionCode, v bool) {
+	w := Bool(v)
+	o.SetValue(code, &w)
+}
+
+func (o Options) setUint16(code OptionCode, v uint16) {
+	w := U16(v)
+	o.SetValue(code, &w)
+}
+
+func (o Options) setUint32(code OptionCode, v uint32) {
+	w := U32(v)
+	o.SetValue(code, &w)
+}
+
+// setSeconds sets a lease time of RFC 2131 in seconds: d is clamped to
+// math.MaxUint32 seconds, meaning infinity, and the option is removed if d
+// is negative.
+func (o Options) setSeconds(code OptionCode, d time.Duration) {
+	switch s := d / time.Second; {
+	case d < 0:
+		delete(o, code)
+	case s >= math.MaxUint32:
+		o.setUint32(code, math.MaxUint32)
+	default:
+		o.setUint32(code, uint32(s))
+	}
+}
+
+func (o Options) setUint16s(code OptionCode, us []uint16) {
+	w := U16List(us)
+	o.SetValue(code, &w)
+}
+
+func (o Options) setCodes(code OptionCode, codes []OptionCode) {
+	w := CodeList(codes)
+	o.SetValue(code, &w)
+}
@@ -0,0 +1,125 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4
+
+import (
+	"bytes"
+	"math"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTypedOptionsRoundTrip(t *testing.T) {
+	o := make(Options)
+	o.SetSubnetMask(net.CIDRMask(24, 32))
+	o.SetTimeOffset(-2 * time.Hour)
+	o.SetRouters([]net.IP{net.IPv4(192, 168, 0, 1), net.IPv4(192, 168, 0, 2)})
+	o.SetDomainNameServers([]net.IP{{8, 8, 8, 8}})
+	o.SetHostName("node0")
+	o.SetIPForwarding(true)
+	o.SetPolicyFilter([]net.IPNet{{IP: net.IP{10, 0, 0, 0}, Mask: net.CIDRMask(8, 32)}})
+	o.SetPathMTUPlateauTable([]uint16{1500, 9000})
+	o.SetInterfaceMTU(9000)
+	o.SetStaticRoutes([]StaticRoute{{Destination: net.IP{10, 0, 0, 0}, Router: net.IP{192, 168, 0, 1}}})
+	o.SetLeaseTime(time.Hour)
+	o.SetMessageType(DHCPOffer)
+	o.SetParameterRequestList([]OptionCode{OptionSubnetMask, OptionRouters})
+	o.SetClientIdentifier([]byte{1, 2, 3})
+
+	// Check the wire encoding of a few.
+	for code, want := range map[OptionCode][]byte{
+		OptionSubnetMask:         {255, 255, 255, 0},
+		OptionTimeOffset:         {0xff, 0xff, 0xe3, 0xe0},
+		OptionRouters:            {192, 168, 0, 1, 192, 168, 0, 2},
+		OptionIPAddressLeaseTime: {0, 0, 0x0e, 0x10},
+		OptionDHCPMessageType:    {2},
+		OptionPolicyFilter:       {10, 0, 0, 0, 255, 0, 0, 0},
+	} {
+		if got := o.Get(code); !bytes.Equal(got, want) {
+			t.Errorf("option %d = %v, want %v", code, got, want)
+		}
+	}
+
+	for _, tt := range []struct {
+		name      string
+		got, want interface{}
+	}{
+		{"SubnetMask", o.SubnetMask(), net.CIDRMask(24, 32)},
+		{"TimeOffset", o.TimeOffset(), -2 * time.Hour},
+		{"Routers", o.Routers(), []net.IP{{192, 168, 0, 1}, {192, 168, 0, 2}}},
+		{"DomainNameServers", o.DomainNameServers(), []net.IP{{8, 8, 8, 8}}},
+		{"HostName", o.HostName(), "node0"},
+		{"IPForwarding", o.IPForwarding(), true},
+		{"PolicyFilter", o.PolicyFilter(), []net.IPNet{{IP: net.IP{10, 0, 0, 0}, Mask: net.CIDRMask(8, 32)}}},
+		{"PathMTUPlateauTable", o.PathMTUPlateauTable(), []uint16{1500, 9000}},
+		{"InterfaceMTU", o.InterfaceMTU(), uint16(9000)},
+		{"StaticRoutes", o.StaticRoutes(), []StaticRoute{{Destination: net.IP{10, 0, 0, 0}, Router: net.IP{192, 168, 0, 1}}}},
+		{"LeaseTime", o.LeaseTime(), time.Hour},
+		{"MessageType", o.MessageType(), DHCPOffer},
+		{"ParameterRequestList", o.ParameterRequestList(), []OptionCode{OptionSubnetMask, OptionRouters}},
+		{"ClientIdentifier", o.ClientIdentifier(), []byte{1, 2, 3}},
+	} {
+		if !reflect.DeepEqual(tt.got, tt.want) {
+			t.Errorf("%s() = %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestTypedOptionsMissingOrMalformed(t *testing.T) {
+	o := Options{
+		OptionRouters:            {192, 168, 0},
+		OptionIPAddressLeaseTime: {0, 1},
+		OptionDHCPMessageType:    {1, 2},
+	}
+	if got := o.Routers(); got != nil {
+		t.Errorf("Routers() = %v, want nil", got)
+	}
+	if got := o.LeaseTime(); got != 0 {
+		t.Errorf("LeaseTime() = %v, want 0", got)
+	}
+	if got := o.MessageType(); got != 0 {
+		t.Errorf("MessageType() = %v, want 0", got)
+	}
+	if got := o.SubnetMask(); got != nil {
+		t.Errorf("SubnetMask() = %v, want nil", got)
+	}
+	if got := o.DomainName(); got != "" {
+		t.Errorf("DomainName() = %q, want empty", got)
+	}
+}
+
+func TestTypedOptionsRemove(t *testing.T) {
+	o := Options{
+		OptionRouters:    {192, 168, 0, 1},
+		OptionDomainName: []byte("example.com"),
+	}
+	o.SetRouters(nil)
+	o.SetDomainName("")
+	if len(o) != 0 {
+		t.Errorf("options %v left after setting empty values, want none", o)
+	}
+}
+
+func TestSetLeaseTimeRange(t *testing.T) {
+	for _, tt := range []struct {
+		d    time.Duration
+		want []byte
+	}{
+		{d: 0, want: []byte{0, 0, 0, 0}},
+		{d: math.MaxUint32*time.Second - 1, want: []byte{0xff, 0xff, 0xff, 0xfe}},
+		{d: math.MaxUint32 * time.Second, want: []byte{0xff, 0xff, 0xff, 0xff}},
+		{d: (math.MaxUint32 + 1) * time.Second, want: []byte{0xff, 0xff, 0xff, 0xff}},
+		{d: math.MaxInt64, want: []byte{0xff, 0xff, 0xff, 0xff}},
+		{d: -time.Second},
+	} {
+		o := Options{OptionIPAddressLeaseTime: {0, 0, 0, 1}}
+		o.SetLeaseTime(tt.d)
+		if got := o[OptionIPAddressLeaseTime]; !bytes.Equal(got, tt.want) {
+			t.Errorf("SetLeaseTime(%v) set %v, want %v", tt.d, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package dhcp4client is a drop-in replacement for the DHCP client of u-root
+// (github.com/u-root/u-root/pkg/dhcp4/dhcp4client), which
+// github.com/mergetb/dhcp4/dhcp4client was forked from.
+//
+// It keeps the function signatures of the original client while delegating
+// to the redesigned client, so that callers switch by changing import paths
+// only: this package for the client, github.com/mergetb/dhcp4 for
+// github.com/u-root/u-root/pkg/dhcp4, and github.com/mergetb/dhcp4/dhcp4opts
+// for its dhcp4opts package.
+//
+// The redesigned client is embedded in Client, so callers can move to it one
+// call at a time. The IPv4 and UDP header helpers are unchanged and live in
+// github.com/mergetb/dhcp4/dhcp4client.
+package dhcp4client
+
+import (
+	"net"
+	"time"
+
+	impl "github.com/mergetb/dhcp4/dhcp4client"
+	"github.com/vishvananda/netlink"
+)
+
+const (
+	// ClientPort is the port that DHCP clients listen on.
+	ClientPort = impl.ClientPort
+
+	// ServerPort is the port that DHCP servers and relay agents listen on.
+	ServerPort = impl.ServerPort
+)
+
+var (
+	// DefaultServers is the address of all link-local DHCP servers and
+	// relay agents.
+	DefaultServers = impl.DefaultServers
+)
+
+// ClientOpt is a function that configures the Client.
+type ClientOpt = impl.ClientOpt
+
+// ClientPacket is a DHCP packet and the interface it corresponds to.
+type ClientPacket = impl.ClientPacket
+
+// ClientError is an error that occured on the associated interface.
+type ClientError = impl.ClientError
+
+// Client is an IPv4 DHCP client with the methods of the original client.
+//
+// DiscoverOffer, SendAndReadOne, DiscoverPacket, RequestPacket,
+// SimpleSendAndRead, SendAndRead, Request, Renew and Close are those of the
+// redesigned client, which keeps their original signatures.
+type Client struct {
+	*impl.Client
+}
+
+// New creates a new DHCP client that sends and receives packets on the given
+// interface.
+func New(iface netlink.Link, opts ...ClientOpt) (*Client, error) {
+	c, err := impl.New(iface, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{c}, nil
+}
+
+// WithTimeout configures the retransmission timeout.
+//
+// Default is 10 seconds.
+func WithTimeout(d time.Duration) ClientOpt {
+	return impl.WithTimeout(d)
+}
+
+// WithRetry configures the number of transmissions to attempt.
+//
+// Default is 3.
+func WithRetry(r int) ClientOpt {
+	return impl.WithRetry(r)
+}
+
+// WithConn configures the packet connection to use.
+func WithConn(conn net.PacketConn) ClientOpt {
+	return impl.WithConn(conn)
+}
@@ -0,0 +1,166 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mergetb/dhcp4"
+	"github.com/vishvananda/netlink"
+)
+
+// The signatures of the original client.
+var (
+	_ func(netlink.Link, ...ClientOpt) (*Client, error)                                                                        = New
+	_ func(time.Duration) ClientOpt                                                                                            = WithTimeout
+	_ func(int) ClientOpt                                                                                                      = WithRetry
+	_ func(net.PacketConn) ClientOpt                                                                                           = WithConn
+	_ func(*Client) (*dhcp4.Packet, error)                                                                                     = (*Client).DiscoverOffer
+	_ func(*Client) (*dhcp4.Packet, error)                                                                                     = (*Client).Request
+	_ func(*Client, *dhcp4.Packet) (*dhcp4.Packet, error)                                                                      = (*Client).Renew
+	_ func(*Client) error                                                                                                      = (*Client).Close
+	_ func(*Client, *dhcp4.Packet) (*dhcp4.Packet, error)                                                                      = (*Client).SendAndReadOne
+	_ func(*Client) *dhcp4.Packet                                                                                              = (*Client).DiscoverPacket
+	_ func(*Client, *dhcp4.Packet) *dhcp4.Packet                                                                               = (*Client).RequestPacket
+	_ func(*Client, context.Context, *net.UDPAddr, *dhcp4.Packet) (*sync.WaitGroup, <-chan *ClientPacket, <-chan *ClientError) = (*Client).SimpleSendAndRead
+	_ func(*Client, context.Context, *net.UDPAddr, *dhcp4.Packet, chan<- *ClientPacket, chan<- *ClientError)                   = (*Client).SendAndRead
+	_ func(string, int) (net.PacketConn, error)                                                                                = NewIPv4UDPConn
+	_ func(string, int) (net.PacketConn, error)                                                                                = NewPacketUDPConn
+	_ func(net.PacketConn, *net.UDPAddr) net.PacketConn                                                                        = NewBroadcastUDPConn
+)
+
+var serverID = net.IP{192, 168, 0, 1}
+
+// serverConn is a net.PacketConn of a client talking to a server that
+// answers DISCOVERs with OFFERs and REQUESTs with ACKs.
+type serverConn struct {
+	mu       sync.Mutex
+	replies  chan []byte
+	deadline time.Time
+	dests    []net.Addr
+}
+
+func newServerConn() *serverConn {
+	return &serverConn{replies: make(chan []byte, 10)}
+}
+
+func (sc *serverConn) WriteTo(b []byte, dest net.Addr) (int, error) {
+	req, err := dhcp4.ParsePacket(b)
+	if err != nil {
+		return 0, err
+	}
+	sc.mu.Lock()
+	sc.dests = append(sc.dests, dest)
+	sc.mu.Unlock()
+
+	reply := dhcp4.NewPacket(dhcp4.BootReply)
+	reply.TransactionID = req.TransactionID
+	reply.CHAddr = req.CHAddr
+	reply.YIAddr = net.IP{192, 168, 0, 10}
+	reply.Options.SetServerIdentifier(serverID)
+	reply.Options.SetLeaseTime(time.Hour)
+	switch req.Options.MessageType() {
+	case dhcp4.DHCPDiscover:
+		reply.Options.SetMessageType(dhcp4.DHCPOffer)
+	case dhcp4.DHCPRequest:
+		reply.Options.SetMessageType(dhcp4.DHCPACK)
+	default:
+		return len(b), nil
+	}
+	rb, err := reply.MarshalBinary()
+	if err != nil {
+		return 0, err
+	}
+	sc.replies <- rb
+	return len(b), nil
+}
+
+func (sc *serverConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	sc.mu.Lock()
+	wait := time.Until(sc.deadline)
+	sc.mu.Unlock()
+	select {
+	case rb := <-sc.replies:
+		return copy(b, rb), &net.UDPAddr{IP: serverID, Port: ServerPort}, nil
+	case <-time.After(wait):
+		return 0, nil, &net.OpError{Op: "read", Err: timeoutError{}}
+	}
+}
+
+func (sc *serverConn) SetReadDeadline(t time.Time) error {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.deadline = t
+	return nil
+}
+
+func (sc *serverConn) Close() error                       { return nil }
+func (sc *serverConn) LocalAddr() net.Addr                { return &net.UDPAddr{Port: ClientPort} }
+func (sc *serverConn) SetDeadline(t time.Time) error      { return sc.SetReadDeadline(t) }
+func (sc *serverConn) SetWriteDeadline(t time.Time) error { return nil }
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string { return "i/o timeout" }
+func (timeoutError) Timeout() bool { return true }
+
+func TestRequestRenew(t *testing.T) {
+	conn := newServerConn()
+	c, err := New(nil, WithConn(conn), WithTimeout(time.Second), WithRetry(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	ack, err := c.Request()
+	if err != nil {
+		t.Fatalf("Request() = %v", err)
+	}
+	if ack.Options.MessageType() != dhcp4.DHCPACK || !ack.YIAddr.Equal(net.IP{192, 168, 0, 10}) {
+		t.Errorf("Request() = %v, want an ACK of 192.168.0.10", ack)
+	}
+
+	renewed, err := c.Renew(ack)
+	if err != nil {
+		t.Fatalf("Renew() = %v", err)
+	}
+	if renewed.Options.MessageType() != dhcp4.DHCPACK {
+		t.Errorf("Renew() = %v, want an ACK", renewed)
+	}
+	conn.mu.Lock()
+	last := conn.dests[len(conn.dests)-1].(*net.UDPAddr)
+	conn.mu.Unlock()
+	if !last.IP.Equal(net.IPv4bcast) {
+		t.Errorf("Renew() sent the renewal to %v, want broadcast", last)
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	conn := newServerConn()
+	c, err := New(nil, WithConn(&dropConn{conn}), WithTimeout(10*time.Millisecond), WithRetry(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if _, err := c.Request(); err == nil {
+		t.Errorf("Request() = nil, want *ClientError")
+	} else if _, ok := err.(*ClientError); !ok {
+		t.Errorf("Request() = %v, want *ClientError", err)
+	}
+}
+
+// dropConn drops every packet written.
+type dropConn struct {
+	*serverConn
+}
+
+func (dc *dropConn) WriteTo(b []byte, dest net.Addr) (int, error) {
+	return len(b), nil
+}
@@ -0,0 +1,39 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"net"
+
+	impl "github.com/mergetb/dhcp4/dhcp4client"
+)
+
+var (
+	BroadcastMac = impl.BroadcastMac
+)
+
+// UDPPacketConn implements net.PacketConn and marshals and unmarshals UDP
+// packets.
+type UDPPacketConn = impl.UDPPacketConn
+
+// NewIPv4UDPConn returns a UDP connection bound to both the interface and port
+// given based on a IPv4 DGRAM socket. The UDP connection allows broadcasting.
+func NewIPv4UDPConn(iface string, port int) (net.PacketConn, error) {
+	return impl.NewIPv4UDPConn(iface, port)
+}
+
+// NewPacketUDPConn returns a UDP connection bound to the interface and port
+// given based on a raw packet socket. All packets are broadcasted.
+func NewPacketUDPConn(iface string, port int) (net.PacketConn, error) {
+	return impl.NewPacketUDPConn(iface, port)
+}
+
+// NewBroadcastUDPConn returns a PacketConn that marshals and unmarshals UDP
+// packets, sending them to the broadcast MAC at on rawPacketConn.
+//
+// Calls to ReadFrom will only return packets destined to boundAddr.
+func NewBroadcastUDPConn(rawPacketConn net.PacketConn, boundAddr *net.UDPAddr) net.PacketConn {
+	return impl.NewBroadcastUDPConn(rawPacketConn, boundAddr)
+}
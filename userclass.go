@@ -0,0 +1,61 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4
+
+import "math"
+
+// UserClasses returns the user classes the client belongs to.
+//
+// RFC 3004, Section 4 defines the option as a list of length-prefixed class
+// names. Clients predating it, e.g. older iPXE versions, send a single name
+// as is; a value that is not a well-formed list is returned as that name.
+// It returns nil if the option is not present.
+func (o Options) UserClasses() []string {
+	b := o.Get(OptionUserClass)
+	if len(b) == 0 {
+		return nil
+	}
+	var classes []string
+	for rest := b; len(rest) > 0; {
+		n := int(rest[0])
+		if n == 0 || n+1 > len(rest) {
+			return []string{string(b)}
+		}
+		classes = append(classes, string(rest[1:n+1]))
+		rest = rest[n+1:]
+	}
+	return classes
+}
+
+// SetUserClasses sets the user classes in the format of RFC 3004. Empty
+// names and names longer than 255 bytes cannot be encoded and are left out.
+//
+// An empty value removes the option.
+func (o Options) SetUserClasses(v []string) {
+	var b []byte
+	for _, name := range v {
+		if len(name) == 0 || len(name) > math.MaxUint8 {
+			continue
+		}
+		b = append(b, uint8(len(name)))
+		b = append(b, name...)
+	}
+	if len(b) == 0 {
+		delete(o, OptionUserClass)
+		return
+	}
+	o[OptionUserClass] = b
+}
+
+// HasUserClass returns whether the client belongs to the user class name,
+// see UserClasses.
+func (o Options) HasUserClass(name string) bool {
+	for _, c := range o.UserClasses() {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,55 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUserClasses(t *testing.T) {
+	for _, tt := range []struct {
+		desc string
+		in   []byte
+		want []string
+	}{
+		{desc: "not present"},
+		{desc: "RFC 3004", in: []byte("\x03foo\x04iPXE"), want: []string{"foo", "iPXE"}},
+		{desc: "plain", in: []byte("iPXE"), want: []string{"iPXE"}},
+		{desc: "truncated", in: []byte("\x09iPXE"), want: []string{"\x09iPXE"}},
+		{desc: "empty name", in: []byte("\x03foo\x00"), want: []string{"\x03foo\x00"}},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			o := make(Options)
+			if tt.in != nil {
+				o[OptionUserClass] = tt.in
+			}
+			if got := o.UserClasses(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("UserClasses() = %q, want %q", got, tt.want)
+			}
+			for _, name := range tt.want {
+				if !o.HasUserClass(name) {
+					t.Errorf("HasUserClass(%q) = false, want true", name)
+				}
+			}
+			if o.HasUserClass("other") {
+				t.Errorf("HasUserClass(other) = true, want false")
+			}
+		})
+	}
+}
+
+func TestSetUserClasses(t *testing.T) {
+	o := make(Options)
+	o.SetUserClasses([]string{"foo", "", strings.Repeat("x", 256), "iPXE"})
+	if got, want := o.Get(OptionUserClass), []byte("\x03foo\x04iPXE"); string(got) != string(want) {
+		t.Errorf("SetUserClasses() = %q, want %q", got, want)
+	}
+	o.SetUserClasses(nil)
+	if got := o.Get(OptionUserClass); got != nil {
+		t.Errorf("SetUserClasses(nil) left %q, want option removed", got)
+	}
+}
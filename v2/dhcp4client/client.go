@@ -0,0 +1,199 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package dhcp4client is version 2 of the IPv4 DHCP client
+// github.com/mergetb/dhcp4/dhcp4client.
+//
+// Version 2 only has the redesigned API: exchanges take a context and
+// return a Lease, Maintain reports the life of a lease as events,
+// DiscoverOffers collects offers and Listen streams the packets read. The
+// packet-level methods of version 1, e.g. DiscoverOffer, SendAndReadOne and
+// Request and Renew on packets, are left out.
+//
+// This package is only the API of version 2, a layer over version 1, which
+// keeps the one implementation both share. The types of this package are
+// aliases of those of version 1, so leases, events and options pass
+// between both, and Client.V1 returns the version 1 client underneath.
+// Programs can move to version 2 one package at a time.
+//
+// Two steps of the v2 plan are not done yet. The implementation has not
+// moved here with version 1 becoming the wrappers, and the v2 directory is
+// not a module of its own: the repository is still built with dep, whose
+// import paths have no major version suffix, so this package is imported
+// as github.com/mergetb/dhcp4/v2/dhcp4client from the same repository.
+package dhcp4client
+
+import (
+	"context"
+	"net"
+
+	"github.com/mergetb/dhcp4"
+	v1 "github.com/mergetb/dhcp4/dhcp4client"
+)
+
+const (
+	// ClientPort is the port that DHCP clients listen on.
+	ClientPort = v1.ClientPort
+
+	// ServerPort is the port that DHCP servers and relay agents listen on.
+	ServerPort = v1.ServerPort
+)
+
+// ClientOpt is a function that configures the Client.
+//
+// The options of version 1 that are not repeated here can be used too.
+type ClientOpt = v1.ClientOpt
+
+// Lease is an address leased from a server.
+type Lease = v1.Lease
+
+// LeaseEvent is a change of a lease reported by Maintain.
+type LeaseEvent = v1.LeaseEvent
+
+// Offers collects the offers of DiscoverOffers.
+type Offers = v1.Offers
+
+// Offer is an offer collected by Offers.
+type Offer = v1.Offer
+
+// NAKError is the error of exchanges a server answered with a NAK.
+type NAKError = v1.NAKError
+
+// ClientError is an error that occurred on the associated interface.
+type ClientError = v1.ClientError
+
+// ClientState is a snapshot of the runtime state of a Client.
+type ClientState = v1.ClientState
+
+// Link is a network interface a client runs on.
+type Link = v1.Link
+
+// Client is an IPv4 DHCP client.
+type Client struct {
+	c *v1.Client
+}
+
+// New creates a new DHCP client that sends and receives packets on the given
+// interface.
+func New(iface Link, opts ...ClientOpt) (*Client, error) {
+	c, err := v1.New(iface, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{c}, nil
+}
+
+// V1 returns the version 1 client c is built on, for the calls that have
+// not moved to version 2 yet.
+func (c *Client) V1() *v1.Client {
+	return c.c
+}
+
+// Close closes the client's connection.
+func (c *Client) Close() error {
+	return c.c.Close()
+}
+
+// Request acquires a lease, as described by RFC 2131 Section 4.4.1.
+//
+// If a server answers the request with a NAK, Request returns a *NAKError.
+// See RequestLease of version 1 for the options that change the exchange.
+func (c *Client) Request(ctx context.Context) (*Lease, error) {
+	return c.c.RequestLease(ctx)
+}
+
+// Renew renews lease with the server that granted it, as described by RFC
+// 2131 Section 4.4.5, and returns the renewed lease.
+//
+// If the server answers with a NAK, Renew returns a *NAKError and the lease
+// must not be used anymore.
+func (c *Client) Renew(ctx context.Context, lease *Lease) (*Lease, error) {
+	return c.c.RenewLease(ctx, lease)
+}
+
+// Rebind extends lease with any server, as described by RFC 2131 Section
+// 4.4.5, and returns the extended lease.
+func (c *Client) Rebind(ctx context.Context, lease *Lease) (*Lease, error) {
+	return c.c.Rebind(ctx, lease)
+}
+
+// Release gives lease back to the server that granted it, as described by
+// RFC 2131 Section 4.4.6.
+func (c *Client) Release(ctx context.Context, lease *Lease) error {
+	return c.c.Release(ctx, lease)
+}
+
+// Decline tells the server that granted lease that its address is already
+// in use, as described by RFC 2131 Section 4.4.1.
+func (c *Client) Decline(ctx context.Context, lease *Lease) error {
+	return c.c.Decline(ctx, lease)
+}
+
+// Inform asks servers for configuration for the address the client's
+// interface already has, as described by RFC 2131 Section 4.4.3.
+func (c *Client) Inform(ctx context.Context) (dhcp4.Options, error) {
+	return c.c.Inform(ctx)
+}
+
+// Maintain renews and rebinds lease until ctx is canceled, and sends every
+// change of the lease on the returned channel, which must be drained.
+func (c *Client) Maintain(ctx context.Context, lease *Lease) <-chan LeaseEvent {
+	return c.c.Maintain(ctx, lease)
+}
+
+// DiscoverOffers broadcasts a Discover and collects the offers received
+// until ctx is done, the configured retries are exhausted or Close is
+// called on the returned Offers.
+func (c *Client) DiscoverOffers(ctx context.Context) *Offers {
+	return c.c.DiscoverOffers(ctx)
+}
+
+// Listen reads the client's connection until ctx is done or reading fails,
+// and calls fn with every DHCP packet filter accepts and the address it came
+// from. A nil filter accepts all packets.
+func (c *Client) Listen(ctx context.Context, filter func(*dhcp4.Packet) bool, fn func(*dhcp4.Packet, net.Addr)) error {
+	return c.c.Listen(ctx, filter, fn)
+}
+
+// DumpState returns a snapshot of the runtime state of c, for debugging a
+// live client.
+func (c *Client) DumpState() *ClientState {
+	return c.c.DumpState()
+}
+
+// Acquire requests a lease on the interface named iface with a client
+// configured by opts.
+func Acquire(ctx context.Context, iface string, opts ...ClientOpt) (*Lease, error) {
+	return v1.Acquire(ctx, iface, opts...)
+}
+
+// Backoff decides when the client retransmits a packet nobody answered.
+type Backoff = v1.Backoff
+
+// WithBackoff configures the retransmission timeouts.
+func WithBackoff(b Backoff) ClientOpt {
+	return v1.WithBackoff(b)
+}
+
+// WithConn configures the packet connection to use.
+func WithConn(conn net.PacketConn) ClientOpt {
+	return v1.WithConn(conn)
+}
+
+// WithInterface configures a UDP socket bound to the interface named iface.
+func WithInterface(iface string) ClientOpt {
+	return v1.WithInterface(iface)
+}
+
+// WithRawSocket configures a raw socket on the interface named iface, which
+// works before the interface has an address.
+func WithRawSocket(iface string) ClientOpt {
+	return v1.WithRawSocket(iface)
+}
+
+// WithLeaseFile configures the file the lease is cached in across
+// restarts.
+func WithLeaseFile(path string) ClientOpt {
+	return v1.WithLeaseFile(path)
+}
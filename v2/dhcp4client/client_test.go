@@ -0,0 +1,82 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	v1 "github.com/mergetb/dhcp4/dhcp4client"
+	"github.com/mergetb/dhcp4/dhcp4test"
+)
+
+func TestRequestRenewRelease(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	clientConn, serverConn := dhcp4test.Pipe()
+	s := dhcp4test.NewServer(net.IP{192, 168, 0, 1}, dhcp4test.WithLeaseTime(time.Hour))
+	go s.Serve(ctx, serverConn)
+
+	mac := net.HardwareAddr{2, 0, 0, 0, 0, 1}
+	c, err := New(nil, WithConn(clientConn), v1.WithIdentity(v1.Identity{HardwareAddr: mac}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	lease, err := c.Request(ctx)
+	if err != nil {
+		t.Fatalf("Request() = %v", err)
+	}
+	if want := s.Binding(mac); !lease.IP.Equal(want) {
+		t.Errorf("Request() leased %v, want %v", lease.IP, want)
+	}
+
+	// Leases are those of version 1.
+	renewed, err := c.V1().RenewLease(ctx, lease)
+	if err != nil {
+		t.Fatalf("V1().RenewLease() = %v", err)
+	}
+	renewed, err = c.Renew(ctx, renewed)
+	if err != nil {
+		t.Fatalf("Renew() = %v", err)
+	}
+	if !renewed.IP.Equal(lease.IP) {
+		t.Errorf("Renew() = %v, want %v", renewed.IP, lease.IP)
+	}
+	if err := c.Release(ctx, renewed); err != nil {
+		t.Errorf("Release() = %v", err)
+	}
+}
+
+func TestRequestNAK(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	clientConn, serverConn := dhcp4test.Pipe()
+	id := net.IP{192, 168, 0, 1}
+	s := dhcp4test.NewServer(id)
+	go s.Serve(ctx, serverConn)
+
+	c, err := New(nil, WithConn(clientConn), v1.WithIdentity(v1.Identity{HardwareAddr: net.HardwareAddr{2, 0, 0, 0, 0, 1}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	lease, err := c.Request(ctx)
+	if err != nil {
+		t.Fatalf("Request() = %v", err)
+	}
+	lease.IP = net.IP{10, 0, 0, 1}
+	var nak *NAKError
+	if _, err := c.Renew(ctx, lease); !errors.As(err, &nak) {
+		t.Errorf("Renew(foreign address) = %v, want *NAKError", err)
+	}
+}
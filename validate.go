@@ -0,0 +1,243 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Role is the sender of a message: the rules of RFC 2131 for clients and
+// servers differ.
+type Role uint8
+
+const (
+	// RoleClient sends BOOTREQUESTs: DHCPDISCOVER, DHCPREQUEST,
+	// DHCPDECLINE, DHCPRELEASE and DHCPINFORM.
+	RoleClient Role = iota + 1
+
+	// RoleServer sends BOOTREPLYs: DHCPOFFER, DHCPACK and DHCPNAK.
+	RoleServer
+)
+
+// String returns the name of the role.
+func (r Role) String() string {
+	switch r {
+	case RoleClient:
+		return "client"
+	case RoleServer:
+		return "server"
+	default:
+		return fmt.Sprintf("Role(%d)", uint8(r))
+	}
+}
+
+// ValidationError is a rule of RFC 2131 a message breaks.
+type ValidationError struct {
+	// Type is the message type.
+	Type MessageType
+
+	// Field is the header field the rule is about, e.g. "ciaddr", or ""
+	// if it is about an option.
+	Field string
+
+	// Option is the option the rule is about, or 0 if it is about a
+	// header field.
+	Option OptionCode
+
+	// Reason describes the rule broken.
+	Reason string
+}
+
+// Error implements error.
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%v: %s", e.Type, e.Reason)
+}
+
+// ValidationErrors is every rule a message breaks, as returned by
+// ValidateMessage.
+type ValidationErrors []*ValidationError
+
+// Error implements error.
+func (e ValidationErrors) Error() string {
+	s := make([]string, 0, len(e))
+	for _, err := range e {
+		s = append(s, err.Error())
+	}
+	return strings.Join(s, "; ")
+}
+
+// ValidateMessage checks p as sent by role against the rules of RFC 2131
+// for its message type, Tables 3 and 5: which fields and options a client or
+// server must and must not set. It returns ValidationErrors listing every
+// rule broken, or nil.
+//
+// DHCPREQUESTs are checked for the client state their fields imply: with a
+// server identifier, SELECTING, which requests an offered address; without
+// one, INIT-REBOOT, which requests an address, or RENEWING and REBINDING,
+// which fill in ciaddr instead.
+//
+// Packets without a message type, BOOTP, and message types not defined by
+// RFC 2131 are not checked. Use Validate to check the encoding of options.
+func (p *Packet) ValidateMessage(role Role) error {
+	typ := p.Options.MessageType()
+	var sender Role
+	switch typ {
+	case DHCPDiscover, DHCPRequest, DHCPDecline, DHCPRelease, DHCPInform:
+		sender = RoleClient
+	case DHCPOffer, DHCPACK, DHCPNAK:
+		sender = RoleServer
+	default:
+		return nil
+	}
+
+	var errs ValidationErrors
+	field := func(name, reason string) {
+		errs = append(errs, &ValidationError{Type: typ, Field: name, Reason: reason})
+	}
+	option := func(code OptionCode, reason string) {
+		errs = append(errs, &ValidationError{Type: typ, Option: code, Reason: reason})
+	}
+
+	if sender != role {
+		option(OptionDHCPMessageType, fmt.Sprintf("sent by a %v, not a %v", sender, role))
+		return errs
+	}
+	wantOp := BootRequest
+	if sender == RoleServer {
+		wantOp = BootReply
+	}
+	if p.Op != wantOp {
+		field("op", fmt.Sprintf("op %v, want %v", p.Op, wantOp))
+	}
+
+	ciaddr := !isZeroIP(p.CIAddr)
+	yiaddr := !isZeroIP(p.YIAddr)
+	siaddr := !isZeroIP(p.SIAddr)
+	sid := p.Options.Get(OptionServerIdentifier) != nil
+	rip := p.Options.Get(OptionRequestedIPAddress) != nil
+	lease := p.Options.Get(OptionIPAddressLeaseTime) != nil
+
+	// Clients without a hardware address, e.g. on InfiniBand, identify
+	// themselves by client identifier, see RFC 4390.
+	if sender == RoleClient && len(p.CHAddr) == 0 && p.Options.Get(OptionClientIdentifier) == nil {
+		field("chaddr", "no client hardware address or client identifier")
+	}
+
+	switch typ {
+	case DHCPDiscover:
+		if ciaddr {
+			field("ciaddr", "ciaddr must be 0")
+		}
+		if sid {
+			option(OptionServerIdentifier, "must not carry a server identifier")
+		}
+
+	case DHCPRequest:
+		switch {
+		case sid && !rip:
+			option(OptionRequestedIPAddress, "server identifier without a requested IP address: SELECTING clients request the offered address")
+		case rip && ciaddr && !sid:
+			option(OptionRequestedIPAddress, "requested IP address and ciaddr: INIT-REBOOT clients leave ciaddr 0, RENEWING and REBINDING clients send no requested IP address")
+		case !rip && !ciaddr:
+			field("ciaddr", "neither a requested IP address nor ciaddr")
+		}
+		if sid && ciaddr {
+			field("ciaddr", "ciaddr must be 0 when SELECTING")
+		}
+
+	case DHCPDecline:
+		if !rip {
+			option(OptionRequestedIPAddress, "no requested IP address: the declined address is required")
+		}
+		if !sid {
+			option(OptionServerIdentifier, "no server identifier")
+		}
+		if ciaddr {
+			field("ciaddr", "ciaddr must be 0")
+		}
+		if lease {
+			option(OptionIPAddressLeaseTime, "must not carry a lease time")
+		}
+
+	case DHCPRelease:
+		if !ciaddr {
+			field("ciaddr", "ciaddr must be the released address")
+		}
+		if !sid {
+			option(OptionServerIdentifier, "no server identifier")
+		}
+		if rip {
+			option(OptionRequestedIPAddress, "must not carry a requested IP address")
+		}
+		if lease {
+			option(OptionIPAddressLeaseTime, "must not carry a lease time")
+		}
+
+	case DHCPInform:
+		if !ciaddr {
+			field("ciaddr", "ciaddr must be the client's address")
+		}
+		if sid {
+			option(OptionServerIdentifier, "must not carry a server identifier")
+		}
+		if rip {
+			option(OptionRequestedIPAddress, "must not carry a requested IP address")
+		}
+		if lease {
+			option(OptionIPAddressLeaseTime, "must not carry a lease time")
+		}
+
+	case DHCPOffer:
+		if !yiaddr {
+			field("yiaddr", "no offered address in yiaddr")
+		}
+		if !sid {
+			option(OptionServerIdentifier, "no server identifier")
+		}
+		if !lease {
+			option(OptionIPAddressLeaseTime, "no lease time")
+		}
+		if ciaddr {
+			field("ciaddr", "ciaddr must be 0")
+		}
+
+	case DHCPACK:
+		if !sid {
+			option(OptionServerIdentifier, "no server identifier")
+		}
+		switch {
+		case yiaddr && !lease:
+			option(OptionIPAddressLeaseTime, "no lease time for the assigned address")
+		case !yiaddr && lease:
+			option(OptionIPAddressLeaseTime, "lease time without an assigned address: DHCPACKs answering a DHCPINFORM carry none")
+		}
+
+	case DHCPNAK:
+		if !sid {
+			option(OptionServerIdentifier, "no server identifier")
+		}
+		if ciaddr {
+			field("ciaddr", "ciaddr must be 0")
+		}
+		if yiaddr {
+			field("yiaddr", "yiaddr must be 0")
+		}
+		if siaddr {
+			field("siaddr", "siaddr must be 0")
+		}
+		if lease {
+			option(OptionIPAddressLeaseTime, "must not carry a lease time")
+		}
+	}
+
+	if sender == RoleServer && rip {
+		option(OptionRequestedIPAddress, "servers must not send a requested IP address")
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
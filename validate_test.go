@@ -0,0 +1,177 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestValidateMessage(t *testing.T) {
+	mac := net.HardwareAddr{2, 0, 0, 0, 0, 1}
+	ip := net.IP{192, 168, 1, 10}
+	sid := net.IP{192, 168, 1, 1}
+
+	// packet returns a packet of type typ sent with op, changed by set.
+	packet := func(op OpCode, typ MessageType, set func(p *Packet)) *Packet {
+		p := NewPacket(op)
+		p.SetHardwareAddr(mac)
+		p.Options.SetMessageType(typ)
+		if set != nil {
+			set(p)
+		}
+		return p
+	}
+
+	for _, tt := range []struct {
+		desc string
+		p    *Packet
+		role Role
+
+		// want lists the field or, for options, the option of each
+		// error.
+		want []string
+	}{
+		{
+			desc: "discover",
+			p:    packet(BootRequest, DHCPDiscover, nil),
+			role: RoleClient,
+		},
+		{
+			desc: "discover received as a server message",
+			p:    packet(BootRequest, DHCPDiscover, nil),
+			role: RoleServer,
+			want: []string{OptionDHCPMessageType.String()},
+		},
+		{
+			desc: "discover without hardware address",
+			p:    packet(BootRequest, DHCPDiscover, func(p *Packet) { p.CHAddr = nil }),
+			role: RoleClient,
+			want: []string{"chaddr"},
+		},
+		{
+			desc: "discover by client identifier",
+			p: packet(BootRequest, DHCPDiscover, func(p *Packet) {
+				p.CHAddr = nil
+				p.Options.SetClientIdentifier([]byte{0x20, 1, 2, 3})
+			}),
+			role: RoleClient,
+		},
+		{
+			desc: "discover sent as a reply",
+			p:    packet(BootReply, DHCPDiscover, nil),
+			role: RoleClient,
+			want: []string{"op"},
+		},
+		{
+			desc: "selecting with ciaddr and without requested IP",
+			p: packet(BootRequest, DHCPRequest, func(p *Packet) {
+				p.CIAddr = ip
+				p.Options.SetServerIdentifier(sid)
+			}),
+			role: RoleClient,
+			want: []string{OptionRequestedIPAddress.String(), "ciaddr"},
+		},
+		{
+			desc: "renewing",
+			p:    packet(BootRequest, DHCPRequest, func(p *Packet) { p.CIAddr = ip }),
+			role: RoleClient,
+		},
+		{
+			desc: "release",
+			p: packet(BootRequest, DHCPRelease, func(p *Packet) {
+				p.CIAddr = ip
+				p.Options.SetServerIdentifier(sid)
+			}),
+			role: RoleClient,
+		},
+		{
+			desc: "empty release",
+			p:    packet(BootRequest, DHCPRelease, nil),
+			role: RoleClient,
+			want: []string{"ciaddr", OptionServerIdentifier.String()},
+		},
+		{
+			desc: "offer",
+			p: packet(BootReply, DHCPOffer, func(p *Packet) {
+				p.YIAddr = ip
+				p.Options.SetServerIdentifier(sid)
+				p.Options.SetLeaseTime(time.Hour)
+			}),
+			role: RoleServer,
+		},
+		{
+			desc: "offer with requested IP",
+			p: packet(BootReply, DHCPOffer, func(p *Packet) {
+				p.YIAddr = ip
+				p.Options.SetServerIdentifier(sid)
+				p.Options.SetLeaseTime(time.Hour)
+				p.Options.SetRequestedIPAddress(ip)
+			}),
+			role: RoleServer,
+			want: []string{OptionRequestedIPAddress.String()},
+		},
+		{
+			desc: "offer without hardware address",
+			p: packet(BootReply, DHCPOffer, func(p *Packet) {
+				p.CHAddr = nil
+				p.YIAddr = ip
+				p.Options.SetServerIdentifier(sid)
+				p.Options.SetLeaseTime(time.Hour)
+			}),
+			role: RoleServer,
+		},
+		{
+			desc: "nak",
+			p: packet(BootReply, DHCPNAK, func(p *Packet) {
+				p.YIAddr = ip
+				p.SIAddr = sid
+				p.Options.SetLeaseTime(time.Hour)
+			}),
+			role: RoleServer,
+			want: []string{OptionServerIdentifier.String(), "yiaddr", "siaddr", OptionIPAddressLeaseTime.String()},
+		},
+		{
+			desc: "bootp",
+			p:    NewPacket(BootRequest),
+			role: RoleClient,
+		},
+		{
+			desc: "lease query",
+			p:    packet(BootRequest, DHCPLeaseQuery, nil),
+			role: RoleClient,
+		},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			err := tt.p.ValidateMessage(tt.role)
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("ValidateMessage(%v) = %v, want nil", tt.role, err)
+				}
+				return
+			}
+			errs, ok := err.(ValidationErrors)
+			if !ok {
+				t.Fatalf("ValidateMessage(%v) = %v, want ValidationErrors", tt.role, err)
+			}
+			var got []string
+			for _, e := range errs {
+				if e.Type != tt.p.Options.MessageType() {
+					t.Errorf("error %q of message type %v, want %v", e, e.Type, tt.p.Options.MessageType())
+				}
+				if e.Option != 0 {
+					got = append(got, e.Option.String())
+				} else {
+					got = append(got, e.Field)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ValidateMessage(%v) = %v, want errors about %v", tt.role, err, tt.want)
+			}
+		})
+	}
+}
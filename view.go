@@ -0,0 +1,160 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+)
+
+// View is a packet in binary whose fields and options are decoded lazily, on
+// access, without copying. Read loops that look at a few fields of many
+// packets, e.g. to drop those not meant for them, can use a View and decode
+// only the packets they handle with Packet.
+//
+// A View aliases the bytes it was made from; values it returns are only
+// valid as long as those are.
+type View []byte
+
+// NewView returns a View of b. It fails if b is too short for the fixed
+// fields or lacks the magic cookie; options are only checked on access.
+func NewView(b []byte) (View, error) {
+	if len(b) < fixedLen {
+		return nil, fmt.Errorf("malformed DHCP packet: got %d bytes, want at least %d", len(b), fixedLen)
+	}
+	if cookie := b[minPacketLen:fixedLen]; !bytes.Equal(cookie, magicCookie[:]) {
+		return nil, fmt.Errorf("malformed DHCP packet: got magic cookie %v, want %v", cookie, magicCookie[:])
+	}
+	return View(b), nil
+}
+
+// Op returns the op code.
+func (v View) Op() OpCode {
+	return OpCode(v[0])
+}
+
+// TransactionID returns the transaction ID.
+func (v View) TransactionID() [4]byte {
+	var xid [4]byte
+	copy(xid[:], v[4:8])
+	return xid
+}
+
+// Secs returns the seconds elapsed since the client began acquisition or
+// renewal.
+func (v View) Secs() uint16 {
+	return binary.BigEndian.Uint16(v[8:10])
+}
+
+// Broadcast returns whether the broadcast flag is set.
+func (v View) Broadcast() bool {
+	return binary.BigEndian.Uint16(v[10:12])&flagBroadcast != 0
+}
+
+// CIAddr returns the client IP address.
+func (v View) CIAddr() net.IP {
+	return net.IP(v[12:16:16])
+}
+
+// YIAddr returns the address offered to or assigned to the client.
+func (v View) YIAddr() net.IP {
+	return net.IP(v[16:20:20])
+}
+
+// SIAddr returns the address of the next server.
+func (v View) SIAddr() net.IP {
+	return net.IP(v[20:24:24])
+}
+
+// GIAddr returns the relay agent address.
+func (v View) GIAddr() net.IP {
+	return net.IP(v[24:28:28])
+}
+
+// HardwareAddr returns the client hardware address.
+func (v View) HardwareAddr() net.HardwareAddr {
+	hlen := int(v[2])
+	if hlen > chaddrLen {
+		hlen = chaddrLen
+	}
+	return net.HardwareAddr(v[28 : 28+hlen : 28+hlen])
+}
+
+// Option returns the value of the option code, or nil if the packet does
+// not carry it, including options carried in the sname and file fields as
+// Packet does.
+//
+// Option does not allocate unless the option is given several times, in
+// which case the instances are concatenated (RFC 3396). Malformed options
+// end the search.
+func (v View) Option(code OptionCode) []byte {
+	var val []byte
+	var copied bool
+	add := func(c OptionCode, data []byte) {
+		switch {
+		case c != code:
+		case val == nil:
+			val = data
+		case !copied:
+			val = append(append([]byte(nil), val...), data...)
+			copied = true
+		default:
+			val = append(val, data...)
+		}
+	}
+
+	walkOptions(v[fixedLen:], add)
+	if code != OptionOverload {
+		var flag uint8
+		if o := v.Option(OptionOverload); len(o) == 1 {
+			flag = o[0]
+		}
+		// RFC 3396, Section 7: options continue in the file field, then
+		// in the sname field.
+		if flag&OverloadFile != 0 {
+			walkOptions(v[108:minPacketLen], add)
+		}
+		if flag&OverloadSName != 0 {
+			walkOptions(v[44:108], add)
+		}
+	}
+	return val
+}
+
+// MessageType returns the DHCP message type, or 0 if the packet has none.
+func (v View) MessageType() MessageType {
+	if o := v.Option(OptionDHCPMessageType); len(o) == 1 {
+		return MessageType(o[0])
+	}
+	return 0
+}
+
+// Packet decodes the whole packet, like ParsePacket.
+func (v View) Packet() (*Packet, error) {
+	return ParsePacket(v)
+}
+
+// walkOptions calls fn with each option in b, up to the End option or the
+// first malformed option.
+func walkOptions(b []byte, fn func(code OptionCode, data []byte)) {
+	for len(b) > 0 {
+		code := OptionCode(b[0])
+		switch code {
+		case Pad:
+			b = b[1:]
+			continue
+		case End:
+			return
+		}
+		if len(b) < 2 || len(b) < 2+int(b[1]) {
+			return
+		}
+		n := int(b[1])
+		fn(code, b[2:2+n:2+n])
+		b = b[2+n:]
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4
+
+import (
+	"bytes"
+	"net"
+	"testing"
+)
+
+func TestView(t *testing.T) {
+	p := NewPacket(BootRequest)
+	p.TransactionID = [4]byte{1, 2, 3, 4}
+	p.Secs = 7
+	p.Broadcast = true
+	p.GIAddr = net.IP{10, 0, 0, 1}
+	p.CHAddr = net.HardwareAddr{2, 0, 0, 0, 0, 1}
+	p.Options.SetMessageType(DHCPDiscover)
+	p.Options.SetHostName("node0")
+	// Long enough to be split into two instances, and overloaded.
+	p.Options[OptionVendorSpecificInformation] = bytes.Repeat([]byte{7}, 300)
+	b, err := MarshalOptions{MaxSize: 548}.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b[fixedLen] == 0 {
+		t.Fatal("test packet is not overloaded")
+	}
+
+	v, err := NewView(b)
+	if err != nil {
+		t.Fatalf("NewView = %v", err)
+	}
+	want, err := v.Packet()
+	if err != nil {
+		t.Fatalf("Packet = %v", err)
+	}
+	if v.Op() != want.Op || v.TransactionID() != want.TransactionID || v.Secs() != want.Secs || v.Broadcast() != want.Broadcast {
+		t.Errorf("view header %v %x %d %v, want %v %x %d %v", v.Op(), v.TransactionID(), v.Secs(), v.Broadcast(), want.Op, want.TransactionID, want.Secs, want.Broadcast)
+	}
+	for _, ip := range [][2]net.IP{{v.CIAddr(), want.CIAddr}, {v.YIAddr(), want.YIAddr}, {v.SIAddr(), want.SIAddr}, {v.GIAddr(), want.GIAddr}} {
+		if !ip[0].Equal(ip[1]) {
+			t.Errorf("view address %v, want %v", ip[0], ip[1])
+		}
+	}
+	if !bytes.Equal(v.HardwareAddr(), want.CHAddr) {
+		t.Errorf("view hardware address %v, want %v", v.HardwareAddr(), want.CHAddr)
+	}
+	if v.MessageType() != DHCPDiscover {
+		t.Errorf("view message type %v, want %v", v.MessageType(), DHCPDiscover)
+	}
+	for code, val := range want.Options {
+		if got := v.Option(code); !bytes.Equal(got, val) {
+			t.Errorf("view option %v = %x, want %x", code, got, val)
+		}
+	}
+	if got := v.Option(OptionRouters); got != nil {
+		t.Errorf("view option %v = %x, want nil", OptionRouters, got)
+	}
+
+	if allocs := testing.AllocsPerRun(10, func() {
+		v.MessageType()
+		v.HardwareAddr()
+	}); allocs != 0 {
+		t.Errorf("View allocates %v times, want 0", allocs)
+	}
+}
+
+func TestNewViewInvalid(t *testing.T) {
+	b, err := NewPacket(BootRequest).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewView(b[:fixedLen-1]); err == nil {
+		t.Errorf("NewView(short) = nil, want error")
+	}
+	b[minPacketLen] = 0
+	if _, err := NewView(b); err == nil {
+		t.Errorf("NewView(bad cookie) = nil, want error")
+	}
+}
+
+func TestPacketAppendUnmarshalReuse(t *testing.T) {
+	p := NewPacket(BootRequest)
+	p.CHAddr = net.HardwareAddr{2, 0, 0, 0, 0, 1}
+	p.Options.SetMessageType(DHCPRequest)
+	p.Options.SetHostName("node0")
+	p.Options.SetRequestedIPAddress(net.IP{192, 168, 0, 10})
+
+	buf := []byte("prefix")
+	out, err := p.AppendBinary(buf)
+	if err != nil {
+		t.Fatalf("AppendBinary = %v", err)
+	}
+	want, err := p.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out[:6], []byte("prefix")) || !bytes.Equal(out[6:], want) {
+		t.Errorf("AppendBinary appended %x, want %x", out[6:], want)
+	}
+
+	if allocs := testing.AllocsPerRun(10, func() {
+		out, err = p.AppendBinary(out[:0])
+	}); allocs != 0 || err != nil {
+		t.Errorf("AppendBinary allocates %v times (err %v), want 0", allocs, err)
+	}
+
+	var q Packet
+	uo := UnmarshalOptions{Reuse: true}
+	if err := uo.Unmarshal(&q, want); err != nil {
+		t.Fatalf("Unmarshal = %v", err)
+	}
+	if allocs := testing.AllocsPerRun(10, func() {
+		err = uo.Unmarshal(&q, want)
+	}); allocs != 0 || err != nil {
+		t.Errorf("Unmarshal with Reuse allocates %v times (err %v), want 0", allocs, err)
+	}
+	if q.Options.HostName() != "node0" || !bytes.Equal(q.CHAddr, p.CHAddr) {
+		t.Errorf("Unmarshal with Reuse = %v, want %v", &q, p)
+	}
+
+	// A packet with other options replaces the options of the last one.
+	p.Options = Options{OptionDHCPMessageType: {byte(DHCPRelease)}}
+	b, err := p.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := uo.Unmarshal(&q, b); err != nil {
+		t.Fatalf("Unmarshal = %v", err)
+	}
+	if len(q.Options) != 1 || q.Options.MessageType() != DHCPRelease {
+		t.Errorf("Unmarshal with Reuse got options %v, want only the message type", q.Options)
+	}
+}
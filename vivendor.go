@@ -0,0 +1,222 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// IANA private enterprise numbers of vendors that use the vendor-identifying
+// vendor options.
+const (
+	EnterpriseCisco          uint32 = 9
+	EnterpriseJuniper        uint32 = 2636
+	EnterpriseBroadbandForum uint32 = 3561
+)
+
+// VIVendorClass is the value of OptionVIVendorClass as defined by RFC 3925,
+// Section 3: the vendor classes the client belongs to, keyed by the
+// enterprise number of the vendor defining them.
+type VIVendorClass map[uint32][]string
+
+// VIVendorInfo is the value of OptionVIVendorSpecificInformation as defined
+// by RFC 3925, Section 4: sub-options keyed by the enterprise number of the
+// vendor defining them, and by their code.
+//
+// The sub-options use the code, length and value format of DHCP options,
+// but codes 0 and 255 have no special meaning.
+type VIVendorInfo map[uint32]map[uint8][]byte
+
+// parseEnterpriseData splits b into the data of each enterprise, a 4-byte
+// enterprise number followed by a 1-byte length and the data. Data of an
+// enterprise number that appears more than once is concatenated.
+func parseEnterpriseData(b []byte) (map[uint32][]byte, error) {
+	m := make(map[uint32][]byte)
+	for len(b) > 0 {
+		if len(b) < 5 {
+			return nil, errors.New("enterprise number truncated")
+		}
+		ent, n := binary.BigEndian.Uint32(b), int(b[4])
+		if len(b) < 5+n {
+			return nil, fmt.Errorf("data of enterprise %d truncated", ent)
+		}
+		m[ent] = append(m[ent], b[5:5+n]...)
+		b = b[5+n:]
+	}
+	return m, nil
+}
+
+// marshalEnterpriseData encodes the data of each enterprise sorted by
+// enterprise number.
+func marshalEnterpriseData(m map[uint32][]byte) ([]byte, error) {
+	ents := make([]uint32, 0, len(m))
+	for ent := range m {
+		ents = append(ents, ent)
+	}
+	sort.Slice(ents, func(i, j int) bool { return ents[i] < ents[j] })
+
+	var b []byte
+	for _, ent := range ents {
+		v := m[ent]
+		if len(v) > math.MaxUint8 {
+			return nil, fmt.Errorf("data of enterprise %d: %d bytes is longer than 255 bytes", ent, len(v))
+		}
+		b = append(b, 0, 0, 0, 0, uint8(len(v)))
+		binary.BigEndian.PutUint32(b[len(b)-5:], ent)
+		b = append(b, v...)
+	}
+	return b, nil
+}
+
+// ParseVIVendorClass decodes the vendor classes in b, the value of
+// OptionVIVendorClass. Each vendor's class data is a list of
+// length-prefixed, opaque classes.
+func ParseVIVendorClass(b []byte) (VIVendorClass, error) {
+	m, err := parseEnterpriseData(b)
+	if err != nil {
+		return nil, err
+	}
+	v := make(VIVendorClass, len(m))
+	for ent, data := range m {
+		classes := []string{}
+		for len(data) > 0 {
+			n := int(data[0])
+			if len(data) < 1+n {
+				return nil, fmt.Errorf("vendor class of enterprise %d truncated", ent)
+			}
+			classes = append(classes, string(data[1:1+n]))
+			data = data[1+n:]
+		}
+		v[ent] = classes
+	}
+	return v, nil
+}
+
+// MarshalBinary encodes v as the value of OptionVIVendorClass, sorted by
+// enterprise number.
+//
+// The classes of each enterprise must take at most 255 bytes, including a
+// length byte per class.
+func (v VIVendorClass) MarshalBinary() ([]byte, error) {
+	m := make(map[uint32][]byte, len(v))
+	for ent, classes := range v {
+		data := []byte{}
+		for _, c := range classes {
+			if len(c) > math.MaxUint8 {
+				return nil, fmt.Errorf("vendor class of enterprise %d is longer than 255 bytes", ent)
+			}
+			data = append(data, uint8(len(c)))
+			data = append(data, c...)
+		}
+		m[ent] = data
+	}
+	return marshalEnterpriseData(m)
+}
+
+// ParseVIVendorInfo decodes the vendor-specific information in b, the value
+// of OptionVIVendorSpecificInformation. Values of a sub-option that appears
+// more than once for an enterprise are concatenated.
+func ParseVIVendorInfo(b []byte) (VIVendorInfo, error) {
+	m, err := parseEnterpriseData(b)
+	if err != nil {
+		return nil, err
+	}
+	v := make(VIVendorInfo, len(m))
+	for ent, data := range m {
+		sub := make(map[uint8][]byte)
+		for len(data) > 0 {
+			if len(data) < 2 || len(data) < 2+int(data[1]) {
+				return nil, fmt.Errorf("sub-option %d of enterprise %d truncated", data[0], ent)
+			}
+			n := int(data[1])
+			sub[data[0]] = append(sub[data[0]], data[2:2+n]...)
+			data = data[2+n:]
+		}
+		v[ent] = sub
+	}
+	return v, nil
+}
+
+// MarshalBinary encodes v as the value of OptionVIVendorSpecificInformation,
+// sorted by enterprise number and sub-option code.
+//
+// The sub-options of each enterprise must take at most 255 bytes, including
+// two bytes of code and length per sub-option.
+func (v VIVendorInfo) MarshalBinary() ([]byte, error) {
+	m := make(map[uint32][]byte, len(v))
+	for ent, sub := range v {
+		codes := make([]int, 0, len(sub))
+		for code := range sub {
+			codes = append(codes, int(code))
+		}
+		sort.Ints(codes)
+
+		data := []byte{}
+		for _, code := range codes {
+			val := sub[uint8(code)]
+			if len(val) > math.MaxUint8 {
+				return nil, fmt.Errorf("sub-option %d of enterprise %d: value of %d bytes is longer than 255 bytes", code, ent, len(val))
+			}
+			data = append(data, uint8(code), uint8(len(val)))
+			data = append(data, val...)
+		}
+		m[ent] = data
+	}
+	return marshalEnterpriseData(m)
+}
+
+// VIVendorClass returns the vendor-identifying vendor classes.
+//
+// It returns nil if the option is not present or malformed. The option is
+// defined by RFC 3925.
+func (o Options) VIVendorClass() VIVendorClass {
+	v := o.Get(OptionVIVendorClass)
+	if v == nil {
+		return nil
+	}
+	c, err := ParseVIVendorClass(v)
+	if err != nil {
+		return nil
+	}
+	return c
+}
+
+// SetVIVendorClass sets the vendor-identifying vendor classes.
+//
+// An empty or invalid value removes the option.
+func (o Options) SetVIVendorClass(v VIVendorClass) {
+	b, _ := v.MarshalBinary()
+	o.setBytes(OptionVIVendorClass, b)
+}
+
+// VIVendorInfo returns the vendor-identifying vendor-specific information.
+//
+// It returns nil if the option is not present or malformed. The option is
+// defined by RFC 3925.
+func (o Options) VIVendorInfo() VIVendorInfo {
+	v := o.Get(OptionVIVendorSpecificInformation)
+	if v == nil {
+		return nil
+	}
+	info, err := ParseVIVendorInfo(v)
+	if err != nil {
+		return nil
+	}
+	return info
+}
+
+// SetVIVendorInfo sets the vendor-identifying vendor-specific information.
+// Servers send the sub-options of the enterprises in the client's
+// OptionVIVendorClass, see RFC 3925, Section 4.
+//
+// An empty or invalid value removes the option.
+func (o Options) SetVIVendorInfo(v VIVendorInfo) {
+	b, _ := v.MarshalBinary()
+	o.setBytes(OptionVIVendorSpecificInformation, b)
+}
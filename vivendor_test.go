@@ -0,0 +1,123 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp4
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestVIVendorClass(t *testing.T) {
+	for _, tt := range []struct {
+		desc  string
+		class VIVendorClass
+		wire  []byte
+	}{
+		{
+			desc:  "one class",
+			class: VIVendorClass{EnterpriseCisco: {"ios"}},
+			wire:  []byte("\x00\x00\x00\x09\x04\x03ios"),
+		},
+		{
+			desc:  "sorted by enterprise",
+			class: VIVendorClass{EnterpriseJuniper: {"ex", "4300"}, EnterpriseCisco: {"c"}},
+			wire:  []byte("\x00\x00\x00\x09\x02\x01c\x00\x00\x0a\x4c\x08\x02ex\x044300"),
+		},
+		{
+			desc:  "no classes",
+			class: VIVendorClass{EnterpriseCisco: {}},
+			wire:  []byte{0, 0, 0, 9, 0},
+		},
+	} {
+		got, err := tt.class.MarshalBinary()
+		if err != nil || !bytes.Equal(got, tt.wire) {
+			t.Errorf("%s: MarshalBinary() = %v, %v; want %v", tt.desc, got, err, tt.wire)
+		}
+		class, err := ParseVIVendorClass(tt.wire)
+		if err != nil || !reflect.DeepEqual(class, tt.class) {
+			t.Errorf("%s: ParseVIVendorClass(%v) = %v, %v; want %v", tt.desc, tt.wire, class, err, tt.class)
+		}
+	}
+}
+
+func TestVIVendorInfo(t *testing.T) {
+	for _, tt := range []struct {
+		desc string
+		info VIVendorInfo
+		wire []byte
+	}{
+		{
+			desc: "sub-options sorted by code",
+			info: VIVendorInfo{EnterpriseBroadbandForum: {2: []byte("x"), 1: []byte("acs")}},
+			wire: []byte("\x00\x00\x0d\xe9\x08\x01\x03acs\x02\x01x"),
+		},
+		{
+			desc: "codes 0 and 255",
+			info: VIVendorInfo{EnterpriseJuniper: {0: []byte("image"), 255: nil}},
+			wire: []byte("\x00\x00\x0a\x4c\x09\x00\x05image\xff\x00"),
+		},
+		{
+			desc: "two enterprises",
+			info: VIVendorInfo{EnterpriseCisco: {1: {7}}, EnterpriseJuniper: {2: {8}}},
+			wire: []byte{0, 0, 0, 9, 3, 1, 1, 7, 0, 0, 0x0a, 0x4c, 3, 2, 1, 8},
+		},
+	} {
+		got, err := tt.info.MarshalBinary()
+		if err != nil || !bytes.Equal(got, tt.wire) {
+			t.Errorf("%s: MarshalBinary() = %v, %v; want %v", tt.desc, got, err, tt.wire)
+		}
+		info, err := ParseVIVendorInfo(tt.wire)
+		if err != nil || !reflect.DeepEqual(info, tt.info) {
+			t.Errorf("%s: ParseVIVendorInfo(%v) = %v, %v; want %v", tt.desc, tt.wire, info, err, tt.info)
+		}
+	}
+
+	// An enterprise appearing twice has its sub-options merged.
+	info, err := ParseVIVendorInfo([]byte{0, 0, 0, 9, 3, 1, 1, 'a', 0, 0, 0, 9, 3, 1, 1, 'b'})
+	if want := (VIVendorInfo{EnterpriseCisco: {1: []byte("ab")}}); err != nil || !reflect.DeepEqual(info, want) {
+		t.Errorf("ParseVIVendorInfo() of repeated enterprise = %v, %v; want %v", info, err, want)
+	}
+}
+
+func TestParseVIVendorErrors(t *testing.T) {
+	for _, b := range [][]byte{
+		{0, 0, 0},
+		{0, 0, 0, 9, 3, 1},
+		{0, 0, 0, 9, 1, 1},
+	} {
+		if _, err := ParseVIVendorInfo(b); err == nil {
+			t.Errorf("ParseVIVendorInfo(%v) succeeded", b)
+		}
+	}
+	for _, b := range [][]byte{
+		{0, 0, 0, 9},
+		{0, 0, 0, 9, 2, 3, 'a'},
+	} {
+		if _, err := ParseVIVendorClass(b); err == nil {
+			t.Errorf("ParseVIVendorClass(%v) succeeded", b)
+		}
+	}
+}
+
+func TestSetVIVendorOptions(t *testing.T) {
+	o := make(Options)
+	o.SetVIVendorClass(VIVendorClass{EnterpriseCisco: {"ios"}})
+	o.SetVIVendorInfo(VIVendorInfo{EnterpriseCisco: {1: []byte("ztp")}})
+	if got := o.VIVendorClass(); !reflect.DeepEqual(got, VIVendorClass{EnterpriseCisco: {"ios"}}) {
+		t.Errorf("VIVendorClass() = %v", got)
+	}
+	if got := o.VIVendorInfo(); !reflect.DeepEqual(got, VIVendorInfo{EnterpriseCisco: {1: []byte("ztp")}}) {
+		t.Errorf("VIVendorInfo() = %v", got)
+	}
+
+	// Values that cannot be encoded remove the options.
+	o.SetVIVendorClass(VIVendorClass{EnterpriseCisco: {strings.Repeat("x", 256)}})
+	o.SetVIVendorInfo(nil)
+	if len(o) != 0 {
+		t.Errorf("options left: %v", o)
+	}
+}